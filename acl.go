@@ -0,0 +1,402 @@
+package msgstore
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/infodancer/msgstore/errors"
+)
+
+// RFC 4314 rights.
+const (
+	RightLookup        = 'l' // folder is visible to LIST
+	RightRead          = 'r' // SELECT, FETCH, SEARCH, COPY from
+	RightSeen          = 's' // keep \Seen across sessions
+	RightWrite         = 'w' // set flags other than \Seen and \Deleted
+	RightInsert        = 'i' // APPEND and COPY into
+	RightPost          = 'p' // send mail to the submission address
+	RightCreate        = 'k' // create child folders
+	RightDeleteMailbox = 'x' // delete or rename the folder
+	RightDeleteMessage = 't' // set or clear \Deleted
+	RightExpunge       = 'e' // EXPUNGE
+	RightAdmin         = 'a' // administer the ACL
+)
+
+// AllRights holds every RFC 4314 right. The mailbox owner always has them.
+const AllRights Rights = "lrswipkxtea"
+
+// IdentifierAnyone is the ACL identifier granting rights to every user.
+const IdentifierAnyone = "anyone"
+
+// Rights is a set of RFC 4314 rights, one character per right (e.g., "lrs").
+type Rights string
+
+// Has reports whether r includes right.
+func (r Rights) Has(right rune) bool {
+	return strings.ContainsRune(string(r), right)
+}
+
+// Validate returns ErrInvalidRights if r contains anything but RFC 4314 rights.
+func (r Rights) Validate() error {
+	for _, c := range r {
+		if !AllRights.Has(c) {
+			return errors.ErrInvalidRights
+		}
+	}
+	return nil
+}
+
+// Union returns the rights in r or other, in canonical order.
+func (r Rights) Union(other Rights) Rights {
+	var b strings.Builder
+	for _, c := range AllRights {
+		if r.Has(c) || other.Has(c) {
+			b.WriteRune(c)
+		}
+	}
+	return Rights(b.String())
+}
+
+// EffectiveRights returns the rights identifier holds on a folder of mailbox
+// under acl: all rights for the mailbox owner, otherwise the rights granted
+// to identifier combined with those granted to IdentifierAnyone.
+func EffectiveRights(acl map[string]Rights, mailbox, identifier string) Rights {
+	if strings.EqualFold(identifier, mailbox) {
+		return AllRights
+	}
+	return acl[identifier].Union(acl[IdentifierAnyone])
+}
+
+// ACLStore persists per-folder access control lists (RFC 4314), as
+// groundwork for shared mailboxes and delegated access.
+// Consumers that need it should type-assert to ACLStore.
+type ACLStore interface {
+	// GetACL returns the rights granted on a folder, keyed by identifier.
+	// The owner's implicit rights are not included. folder may be "INBOX".
+	GetACL(ctx context.Context, mailbox string, folder string) (map[string]Rights, error)
+
+	// SetACL grants identifier exactly rights on a folder; empty rights
+	// remove identifier from the ACL. Returns ErrInvalidRights for rights
+	// outside RFC 4314.
+	SetACL(ctx context.Context, mailbox string, folder string, identifier string, rights Rights) error
+
+	// MyRights returns the rights identifier holds on a folder, as computed
+	// by EffectiveRights.
+	MyRights(ctx context.Context, mailbox string, folder string, identifier string) (Rights, error)
+}
+
+// OtherUsersNamespace names the namespace holding folders shared by other
+// users (RFC 2342).
+const OtherUsersNamespace = "Other Users"
+
+// SharedStore exposes folders that other users have shared through their
+// ACLs, for team inboxes such as support@.
+// Consumers that need it should type-assert to SharedStore.
+type SharedStore interface {
+	// SharedFolders returns the names, under the Other Users namespace, of
+	// the folders of other mailboxes that user holds the lookup right on
+	// (e.g., "Other Users/support@example.com/INBOX").
+	SharedFolders(ctx context.Context, user string) ([]string, error)
+
+	// ResolveShared maps a name returned by SharedFolders to the owning
+	// mailbox and folder, and returns user's rights on it. Access then goes
+	// through an ACLEnforcingStore for user. Returns ErrFolderNotFound if
+	// the folder does not exist or user may not look it up.
+	ResolveShared(ctx context.Context, user string, name string) (mailbox string, folder string, rights Rights, err error)
+}
+
+// PublicNamespace names the namespace holding public folders (RFC 2342
+// shared namespace), visible to all authenticated users.
+const PublicNamespace = "Public"
+
+// PublicStore exposes a store-wide tree of public folders, such as
+// announcement and archive folders. Folder ACLs control who may read and
+// post.
+// Consumers that need it should type-assert to PublicStore.
+type PublicStore interface {
+	// PublicFolders returns the names, under the Public namespace, of the
+	// public folders user holds the lookup right on (e.g., "Public/News").
+	PublicFolders(ctx context.Context, user string) ([]string, error)
+
+	// ResolvePublic maps a name returned by PublicFolders to the mailbox and
+	// folder holding it, and returns user's rights on it. Access then goes
+	// through an ACLEnforcingStore for user. Returns ErrFolderNotFound if
+	// the folder does not exist or user may not look it up.
+	ResolvePublic(ctx context.Context, user string, name string) (mailbox string, folder string, rights Rights, err error)
+}
+
+// ACLEnforcingStore wraps a store for one authenticated user and rejects
+// operations the folder ACLs do not allow with ErrPermissionDenied.
+// Create one per session with NewACLEnforcingStore.
+type ACLEnforcingStore struct {
+	underlying MessageStore
+	folders    FolderStore
+	acl        ACLStore
+	user       string
+}
+
+// Compile-time interface checks.
+var (
+	_ MessageStore = (*ACLEnforcingStore)(nil)
+	_ FolderStore  = (*ACLEnforcingStore)(nil)
+	_ ACLStore     = (*ACLEnforcingStore)(nil)
+)
+
+// NewACLEnforcingStore wraps underlying for user, checking rights in acl.
+// If underlying does not implement FolderStore, folder operations return
+// ErrStoreConfigInvalid.
+func NewACLEnforcingStore(underlying MessageStore, acl ACLStore, user string) *ACLEnforcingStore {
+	folders, _ := underlying.(FolderStore)
+	return &ACLEnforcingStore{underlying: underlying, folders: folders, acl: acl, user: user}
+}
+
+// check returns ErrPermissionDenied unless the user holds every right in
+// need on folder.
+func (s *ACLEnforcingStore) check(ctx context.Context, mailbox, folder string, need Rights) error {
+	rights, err := s.acl.MyRights(ctx, mailbox, folder, s.user)
+	if err != nil {
+		return err
+	}
+	for _, right := range need {
+		if !rights.Has(right) {
+			return errors.ErrPermissionDenied
+		}
+	}
+	return nil
+}
+
+// checkFolder is check for folder operations, which need a FolderStore.
+func (s *ACLEnforcingStore) checkFolder(ctx context.Context, mailbox, folder string, need Rights) error {
+	if s.folders == nil {
+		return errors.ErrStoreConfigInvalid
+	}
+	return s.check(ctx, mailbox, folder, need)
+}
+
+// flagRights returns the rights needed to change flags: \Seen needs s,
+// \Deleted needs t and any other flag needs w.
+func flagRights(flags []string) Rights {
+	var need Rights
+	for _, f := range flags {
+		switch {
+		case strings.EqualFold(f, "\\Seen"):
+			need = need.Union(Rights(RightSeen))
+		case strings.EqualFold(f, "\\Deleted"):
+			need = need.Union(Rights(RightDeleteMessage))
+		default:
+			need = need.Union(Rights(RightWrite))
+		}
+	}
+	return need
+}
+
+// List checks the read right on the inbox.
+func (s *ACLEnforcingStore) List(ctx context.Context, mailbox string) ([]MessageInfo, error) {
+	if err := s.check(ctx, mailbox, "INBOX", Rights(RightRead)); err != nil {
+		return nil, err
+	}
+	return s.underlying.List(ctx, mailbox)
+}
+
+// Retrieve checks the read right on the inbox.
+func (s *ACLEnforcingStore) Retrieve(ctx context.Context, mailbox string, uid string) (io.ReadCloser, error) {
+	if err := s.check(ctx, mailbox, "INBOX", Rights(RightRead)); err != nil {
+		return nil, err
+	}
+	return s.underlying.Retrieve(ctx, mailbox, uid)
+}
+
+// Delete checks the delete-message right on the inbox.
+func (s *ACLEnforcingStore) Delete(ctx context.Context, mailbox string, uid string) error {
+	if err := s.check(ctx, mailbox, "INBOX", Rights(RightDeleteMessage)); err != nil {
+		return err
+	}
+	return s.underlying.Delete(ctx, mailbox, uid)
+}
+
+// Expunge checks the expunge right on the inbox.
+func (s *ACLEnforcingStore) Expunge(ctx context.Context, mailbox string) ([]string, error) {
+	if err := s.check(ctx, mailbox, "INBOX", Rights(RightExpunge)); err != nil {
+		return nil, err
+	}
+	return s.underlying.Expunge(ctx, mailbox)
+}
+
+// Stat checks the read right on the inbox.
+func (s *ACLEnforcingStore) Stat(ctx context.Context, mailbox string) (int, int64, error) {
+	if err := s.check(ctx, mailbox, "INBOX", Rights(RightRead)); err != nil {
+		return 0, 0, err
+	}
+	return s.underlying.Stat(ctx, mailbox)
+}
+
+// CreateFolder checks the create right on the inbox, the root of the
+// folder hierarchy.
+func (s *ACLEnforcingStore) CreateFolder(ctx context.Context, mailbox string, folder string) error {
+	if err := s.checkFolder(ctx, mailbox, "INBOX", Rights(RightCreate)); err != nil {
+		return err
+	}
+	return s.folders.CreateFolder(ctx, mailbox, folder)
+}
+
+// ListFolders returns only the folders the user holds the lookup right on.
+func (s *ACLEnforcingStore) ListFolders(ctx context.Context, mailbox string) ([]string, error) {
+	if s.folders == nil {
+		return nil, errors.ErrStoreConfigInvalid
+	}
+	all, err := s.folders.ListFolders(ctx, mailbox)
+	if err != nil {
+		return nil, err
+	}
+	var visible []string
+	for _, folder := range all {
+		err := s.check(ctx, mailbox, folder, Rights(RightLookup))
+		if err == errors.ErrPermissionDenied {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		visible = append(visible, folder)
+	}
+	return visible, nil
+}
+
+// DeleteFolder checks the delete-mailbox right on the folder.
+func (s *ACLEnforcingStore) DeleteFolder(ctx context.Context, mailbox string, folder string, opts ...DeleteFolderOption) error {
+	if err := s.checkFolder(ctx, mailbox, folder, Rights(RightDeleteMailbox)); err != nil {
+		return err
+	}
+	return s.folders.DeleteFolder(ctx, mailbox, folder, opts...)
+}
+
+// ListInFolder checks the read right on the folder.
+func (s *ACLEnforcingStore) ListInFolder(ctx context.Context, mailbox string, folder string) ([]MessageInfo, error) {
+	if err := s.checkFolder(ctx, mailbox, folder, Rights(RightRead)); err != nil {
+		return nil, err
+	}
+	return s.folders.ListInFolder(ctx, mailbox, folder)
+}
+
+// StatFolder checks the read right on the folder.
+func (s *ACLEnforcingStore) StatFolder(ctx context.Context, mailbox string, folder string) (int, int64, error) {
+	if err := s.checkFolder(ctx, mailbox, folder, Rights(RightRead)); err != nil {
+		return 0, 0, err
+	}
+	return s.folders.StatFolder(ctx, mailbox, folder)
+}
+
+// RetrieveFromFolder checks the read right on the folder.
+func (s *ACLEnforcingStore) RetrieveFromFolder(ctx context.Context, mailbox string, folder string, uid string) (io.ReadCloser, error) {
+	if err := s.checkFolder(ctx, mailbox, folder, Rights(RightRead)); err != nil {
+		return nil, err
+	}
+	return s.folders.RetrieveFromFolder(ctx, mailbox, folder, uid)
+}
+
+// DeleteInFolder checks the delete-message right on the folder.
+func (s *ACLEnforcingStore) DeleteInFolder(ctx context.Context, mailbox string, folder string, uid string) error {
+	if err := s.checkFolder(ctx, mailbox, folder, Rights(RightDeleteMessage)); err != nil {
+		return err
+	}
+	return s.folders.DeleteInFolder(ctx, mailbox, folder, uid)
+}
+
+// ExpungeFolder checks the expunge right on the folder.
+func (s *ACLEnforcingStore) ExpungeFolder(ctx context.Context, mailbox string, folder string) ([]string, error) {
+	if err := s.checkFolder(ctx, mailbox, folder, Rights(RightExpunge)); err != nil {
+		return nil, err
+	}
+	return s.folders.ExpungeFolder(ctx, mailbox, folder)
+}
+
+// DeliverToFolder checks the insert right on the folder.
+func (s *ACLEnforcingStore) DeliverToFolder(ctx context.Context, mailbox string, folder string, message io.Reader) error {
+	if err := s.checkFolder(ctx, mailbox, folder, Rights(RightInsert)); err != nil {
+		return err
+	}
+	return s.folders.DeliverToFolder(ctx, mailbox, folder, message)
+}
+
+// RenameFolder checks the delete-mailbox right on the folder and the create
+// right on the inbox.
+func (s *ACLEnforcingStore) RenameFolder(ctx context.Context, mailbox string, oldName string, newName string) error {
+	if err := s.checkFolder(ctx, mailbox, oldName, Rights(RightDeleteMailbox)); err != nil {
+		return err
+	}
+	if err := s.check(ctx, mailbox, "INBOX", Rights(RightCreate)); err != nil {
+		return err
+	}
+	return s.folders.RenameFolder(ctx, mailbox, oldName, newName)
+}
+
+// AppendToFolder checks the insert right on the folder and the rights
+// needed to set the initial flags.
+func (s *ACLEnforcingStore) AppendToFolder(ctx context.Context, mailbox string, folder string, r io.Reader, flags []string, date time.Time) (string, error) {
+	if err := s.checkFolder(ctx, mailbox, folder, Rights(RightInsert).Union(flagRights(flags))); err != nil {
+		return "", err
+	}
+	return s.folders.AppendToFolder(ctx, mailbox, folder, r, flags, date)
+}
+
+// SetFlagsInFolder checks the rights needed for the flags being changed. A
+// FlagModeSet replaces every flag, so it needs all three flag rights.
+func (s *ACLEnforcingStore) SetFlagsInFolder(ctx context.Context, mailbox string, folder string, uid string, mode FlagMode, flags []string) error {
+	need := flagRights(flags)
+	if mode == FlagModeSet {
+		need = Rights(RightSeen).Union(Rights(RightWrite)).Union(Rights(RightDeleteMessage))
+	}
+	if err := s.checkFolder(ctx, mailbox, folder, need); err != nil {
+		return err
+	}
+	return s.folders.SetFlagsInFolder(ctx, mailbox, folder, uid, mode, flags)
+}
+
+// CopyMessage checks the read right on the source and the insert right on
+// the destination.
+func (s *ACLEnforcingStore) CopyMessage(ctx context.Context, mailbox string, srcFolder string, uid string, destFolder string) (string, error) {
+	if err := s.checkFolder(ctx, mailbox, srcFolder, Rights(RightRead)); err != nil {
+		return "", err
+	}
+	if err := s.check(ctx, mailbox, destFolder, Rights(RightInsert)); err != nil {
+		return "", err
+	}
+	return s.folders.CopyMessage(ctx, mailbox, srcFolder, uid, destFolder)
+}
+
+// UIDValidity checks the read right on the folder.
+func (s *ACLEnforcingStore) UIDValidity(ctx context.Context, mailbox string, folder string) (uint32, error) {
+	if err := s.checkFolder(ctx, mailbox, folder, Rights(RightRead)); err != nil {
+		return 0, err
+	}
+	return s.folders.UIDValidity(ctx, mailbox, folder)
+}
+
+// GetACL checks the admin right on the folder.
+func (s *ACLEnforcingStore) GetACL(ctx context.Context, mailbox string, folder string) (map[string]Rights, error) {
+	if err := s.check(ctx, mailbox, folder, Rights(RightAdmin)); err != nil {
+		return nil, err
+	}
+	return s.acl.GetACL(ctx, mailbox, folder)
+}
+
+// SetACL checks the admin right on the folder.
+func (s *ACLEnforcingStore) SetACL(ctx context.Context, mailbox string, folder string, identifier string, rights Rights) error {
+	if err := s.check(ctx, mailbox, folder, Rights(RightAdmin)); err != nil {
+		return err
+	}
+	return s.acl.SetACL(ctx, mailbox, folder, identifier, rights)
+}
+
+// MyRights returns the rights of identifier. Users may always ask for their
+// own rights; asking about others needs the admin right.
+func (s *ACLEnforcingStore) MyRights(ctx context.Context, mailbox string, folder string, identifier string) (Rights, error) {
+	if identifier != s.user {
+		if err := s.check(ctx, mailbox, folder, Rights(RightAdmin)); err != nil {
+			return "", err
+		}
+	}
+	return s.acl.MyRights(ctx, mailbox, folder, identifier)
+}
@@ -0,0 +1,89 @@
+package msgstore_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+	"github.com/infodancer/msgstore/maildir"
+)
+
+func TestRights(t *testing.T) {
+	if err := msgstore.Rights("lrs").Validate(); err != nil {
+		t.Errorf("Validate(lrs) = %v", err)
+	}
+	if err := msgstore.Rights("lrz").Validate(); err != errors.ErrInvalidRights {
+		t.Errorf("Validate(lrz) = %v, want ErrInvalidRights", err)
+	}
+	if got := msgstore.Rights("sl").Union("rl"); got != "lrs" {
+		t.Errorf("Union = %q, want %q", got, "lrs")
+	}
+
+	acl := map[string]msgstore.Rights{"bob": "lr", msgstore.IdentifierAnyone: "l"}
+	if got := msgstore.EffectiveRights(acl, "alice", "alice"); got != msgstore.AllRights {
+		t.Errorf("owner rights = %q, want all", got)
+	}
+	if got := msgstore.EffectiveRights(acl, "alice", "carol"); got != "l" {
+		t.Errorf("anyone rights = %q, want %q", got, "l")
+	}
+}
+
+func TestACLEnforcingStore(t *testing.T) {
+	ctx := context.Background()
+	store := maildir.NewStore(t.TempDir(), "", "")
+	const owner = "alice@example.com"
+
+	if err := store.CreateFolder(ctx, owner, "Shared"); err != nil {
+		t.Fatalf("CreateFolder: %v", err)
+	}
+	if _, err := store.AppendToFolder(ctx, owner, "Shared", strings.NewReader("Subject: hi\r\n\r\nbody"), nil, time.Now()); err != nil {
+		t.Fatalf("AppendToFolder: %v", err)
+	}
+
+	// The owner may do anything, including granting bob read access.
+	alice := msgstore.NewACLEnforcingStore(store, store, owner)
+	if err := alice.SetACL(ctx, owner, "Shared", "bob", "lr"); err != nil {
+		t.Fatalf("SetACL: %v", err)
+	}
+
+	bob := msgstore.NewACLEnforcingStore(store, store, "bob")
+	msgs, err := bob.ListInFolder(ctx, owner, "Shared")
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("bob ListInFolder = %v, %v; want 1 message", msgs, err)
+	}
+	if err := bob.DeleteInFolder(ctx, owner, "Shared", msgs[0].UID); err != errors.ErrPermissionDenied {
+		t.Errorf("bob DeleteInFolder = %v, want ErrPermissionDenied", err)
+	}
+	if err := bob.SetFlagsInFolder(ctx, owner, "Shared", msgs[0].UID, msgstore.FlagModeAdd, []string{"\\Seen"}); err != errors.ErrPermissionDenied {
+		t.Errorf("bob set \\Seen = %v, want ErrPermissionDenied", err)
+	}
+	if _, err := bob.List(ctx, owner); err != errors.ErrPermissionDenied {
+		t.Errorf("bob List inbox = %v, want ErrPermissionDenied", err)
+	}
+	if err := bob.SetACL(ctx, owner, "Shared", "bob", msgstore.AllRights); err != errors.ErrPermissionDenied {
+		t.Errorf("bob SetACL = %v, want ErrPermissionDenied", err)
+	}
+	if rights, err := bob.MyRights(ctx, owner, "Shared", "bob"); err != nil || rights != "lr" {
+		t.Errorf("bob MyRights = %q, %v; want %q", rights, err, "lr")
+	}
+
+	// Folders without the lookup right are hidden from bob.
+	folders, err := bob.ListFolders(ctx, owner)
+	if err != nil {
+		t.Fatalf("bob ListFolders: %v", err)
+	}
+	if len(folders) != 1 || folders[0] != "Shared" {
+		t.Errorf("bob ListFolders = %v, want [Shared]", folders)
+	}
+
+	// Removing bob from the ACL revokes access.
+	if err := alice.SetACL(ctx, owner, "Shared", "bob", ""); err != nil {
+		t.Fatalf("SetACL remove: %v", err)
+	}
+	if _, err := bob.ListInFolder(ctx, owner, "Shared"); err != errors.ErrPermissionDenied {
+		t.Errorf("bob ListInFolder after revoke = %v, want ErrPermissionDenied", err)
+	}
+}
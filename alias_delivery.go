@@ -0,0 +1,168 @@
+package msgstore
+
+import (
+	"bytes"
+	"context"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/infodancer/msgstore/errors"
+)
+
+// maxAliasDepth bounds how many times an address produced by expansion is
+// itself expanded, so misconfigured alias maps cannot recurse forever.
+const maxAliasDepth = 10
+
+// RecipientExpander resolves virtual aliases, group lists and role
+// addresses to the addresses that should receive a copy. Implementations
+// are backed by whatever holds the alias data: a map file, a database or
+// a directory.
+type RecipientExpander interface {
+	// ExpandRecipients returns the addresses recipient stands for. It
+	// returns (nil, nil) if recipient is not an alias and should be
+	// delivered as is. An alias may include its own address to keep a copy
+	// in its mailbox; an empty, non-nil list delivers nothing.
+	ExpandRecipients(ctx context.Context, recipient string) ([]string, error)
+}
+
+// ExpandingDeliveryAgent wraps a DeliveryAgent to expand the envelope's
+// recipients before storage, so aliases are resolved inside the store
+// pipeline rather than in every frontend.
+//
+// Expanded addresses are expanded again, up to maxAliasDepth levels. An
+// address that reappears in its own expansion is delivered as is rather
+// than expanded again, and each resulting address receives one copy. If
+// expansion fails for any recipient, nothing is delivered.
+//
+// Expanded addresses outside the store are never handed to the wrapped
+// agent, which would deliver them to whichever local mailbox shares their
+// local part. They are sent on with Forward instead, once per alias, with
+// the alias as the forwarding address.
+type ExpandingDeliveryAgent struct {
+	// underlying is the wrapped delivery agent.
+	underlying DeliveryAgent
+
+	// expander resolves aliases.
+	expander RecipientExpander
+
+	// isLocal reports whether an address belongs to the store.
+	isLocal func(address string) bool
+
+	// submitter sends on the addresses outside the store.
+	submitter Submitter
+}
+
+// NewExpandingDeliveryAgent creates an alias expanding delivery agent.
+// underlying is the delivery agent to wrap. isLocal, which must not be
+// nil, reports whether an address belongs to the store; expanded addresses
+// it rejects are forwarded through submitter. If submitter is nil, a
+// delivery that expands to such an address fails with errors.ErrNoRelay
+// and nothing is delivered.
+func NewExpandingDeliveryAgent(underlying DeliveryAgent, expander RecipientExpander, isLocal func(address string) bool, submitter Submitter) *ExpandingDeliveryAgent {
+	return &ExpandingDeliveryAgent{
+		underlying: underlying,
+		expander:   expander,
+		isLocal:    isLocal,
+		submitter:  submitter,
+	}
+}
+
+// Deliver expands the recipients, delivers to the local results and
+// forwards to the remote ones. A failed delivery or forward does not stop
+// the others; all failures are returned joined.
+func (e *ExpandingDeliveryAgent) Deliver(ctx context.Context, envelope Envelope, message io.Reader) error {
+	var local, aliases []string
+	remote := make(map[string][]string)
+	seen := make(map[string]bool)
+	for _, recipient := range envelope.Recipients {
+		expanded, err := e.expand(ctx, recipient, nil)
+		if err != nil {
+			return err
+		}
+		for _, addr := range expanded {
+			key := strings.ToLower(addr)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			// The recipients the store was handed are its own.
+			if strings.EqualFold(addr, recipient) || e.isLocal(addr) {
+				local = append(local, addr)
+				continue
+			}
+			if remote[recipient] == nil {
+				aliases = append(aliases, recipient)
+			}
+			remote[recipient] = append(remote[recipient], addr)
+		}
+	}
+	if len(aliases) == 0 {
+		if len(local) == 0 {
+			return nil
+		}
+		expanded := envelope
+		expanded.Recipients = local
+		return e.underlying.Deliver(ctx, expanded, message)
+	}
+	if e.submitter == nil {
+		return fmt.Errorf("forward %s to %s: %w", aliases[0], remote[aliases[0]][0], errors.ErrNoRelay)
+	}
+
+	// The message goes out more than once.
+	data, err := io.ReadAll(message)
+	if err != nil {
+		return fmt.Errorf("read message: %w", err)
+	}
+	var errs []error
+	if len(local) > 0 {
+		expanded := envelope
+		expanded.Recipients = local
+		if err := e.underlying.Deliver(ctx, expanded, bytes.NewReader(data)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	for _, alias := range aliases {
+		forwarded := envelope
+		forwarded.Recipients = []string{alias}
+		if err := Forward(ctx, e.submitter, forwarded, bytes.NewReader(data), remote[alias]); err != nil {
+			errs = append(errs, fmt.Errorf("forward %s: %w", alias, err))
+		}
+	}
+	return stderrors.Join(errs...)
+}
+
+// expand returns the addresses recipient resolves to. chain holds the
+// aliases being expanded above recipient.
+func (e *ExpandingDeliveryAgent) expand(ctx context.Context, recipient string, chain []string) ([]string, error) {
+	for _, alias := range chain {
+		if strings.EqualFold(alias, recipient) {
+			return []string{recipient}, nil
+		}
+	}
+	if len(chain) > maxAliasDepth {
+		return nil, fmt.Errorf("expand %s: aliases nested more than %d levels", chain[0], maxAliasDepth)
+	}
+	targets, err := e.expander.ExpandRecipients(ctx, recipient)
+	if err != nil {
+		return nil, fmt.Errorf("expand %s: %w", recipient, err)
+	}
+	if targets == nil {
+		return []string{recipient}, nil
+	}
+
+	chain = append(chain, recipient)
+	var result []string
+	for _, target := range targets {
+		expanded, err := e.expand(ctx, target, chain)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, expanded...)
+	}
+	return result, nil
+}
+
+// Compile-time interface verification.
+var _ DeliveryAgent = (*ExpandingDeliveryAgent)(nil)
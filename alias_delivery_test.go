@@ -0,0 +1,121 @@
+package msgstore
+
+import (
+	"context"
+	stderrors "errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/infodancer/msgstore/errors"
+)
+
+// mapExpander expands aliases from a map; ExpandRecipients fails for
+// addresses in fail.
+type mapExpander struct {
+	aliases map[string][]string
+	fail    map[string]error
+}
+
+func (m mapExpander) ExpandRecipients(_ context.Context, recipient string) ([]string, error) {
+	if err := m.fail[recipient]; err != nil {
+		return nil, err
+	}
+	return m.aliases[strings.ToLower(recipient)], nil
+}
+
+// inExampleCom is the isLocal of a store holding example.com.
+func inExampleCom(address string) bool {
+	return strings.HasSuffix(strings.ToLower(address), "@example.com")
+}
+
+func TestExpandingDeliveryAgent_Deliver(t *testing.T) {
+	underlying := &mockDeliveryAgent{}
+	agent := NewExpandingDeliveryAgent(underlying, mapExpander{aliases: map[string][]string{
+		"postmaster@example.com": {"admins@example.com"},
+		"admins@example.com":     {"alice@example.com", "bob@example.com"},
+		"team@example.com":       {"bob@example.com", "carol@example.com", "team@example.com"},
+		"loop-a@example.com":     {"loop-b@example.com"},
+		"loop-b@example.com":     {"loop-a@example.com"},
+		"empty@example.com":      {},
+	}}, inExampleCom, nil)
+
+	if err := deliverTo(agent, "hi", "Postmaster@example.com", "team@example.com", "dave@example.com", "loop-a@example.com", "empty@example.com"); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	if len(underlying.deliveries) != 1 {
+		t.Fatalf("underlying received %d deliveries, want 1", len(underlying.deliveries))
+	}
+	want := []string{
+		"alice@example.com", "bob@example.com", "carol@example.com", "team@example.com",
+		"dave@example.com", "loop-a@example.com",
+	}
+	if got := underlying.deliveries[0].envelope.Recipients; !reflect.DeepEqual(got, want) {
+		t.Errorf("recipients = %v, want %v", got, want)
+	}
+
+	if err := deliverTo(agent, "hi", "empty@example.com"); err != nil {
+		t.Fatalf("Deliver to empty alias: %v", err)
+	}
+	if len(underlying.deliveries) != 1 {
+		t.Errorf("empty alias delivered a copy")
+	}
+}
+
+func TestExpandingDeliveryAgent_ExpansionError(t *testing.T) {
+	underlying := &mockDeliveryAgent{}
+	errLookup := stderrors.New("alias map unavailable")
+	agent := NewExpandingDeliveryAgent(underlying, mapExpander{fail: map[string]error{"list@example.com": errLookup}}, inExampleCom, nil)
+
+	if err := deliverTo(agent, "hi", "alice@example.com", "list@example.com"); !stderrors.Is(err, errLookup) {
+		t.Fatalf("error = %v, want %v", err, errLookup)
+	}
+	if len(underlying.deliveries) != 0 {
+		t.Errorf("underlying received %d deliveries, want 0", len(underlying.deliveries))
+	}
+}
+
+func TestExpandingDeliveryAgent_RemoteTargets(t *testing.T) {
+	underlying := &mockDeliveryAgent{}
+	var submitted []Envelope
+	var bodies []string
+	submitter := RelayFunc(func(_ context.Context, envelope Envelope, message io.Reader) error {
+		data, err := io.ReadAll(message)
+		submitted = append(submitted, envelope)
+		bodies = append(bodies, string(data))
+		return err
+	})
+	expander := mapExpander{aliases: map[string][]string{
+		"sales@example.com": {"bob@gmail.com", "carol@example.com"},
+	}}
+	agent := NewExpandingDeliveryAgent(underlying, expander, inExampleCom, submitter)
+
+	if err := deliverTo(agent, "Subject: hi\r\n\r\nbody\r\n", "sales@example.com", "dave@example.com"); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	var stored []string
+	for _, d := range underlying.deliveries {
+		stored = append(stored, d.envelope.Recipients...)
+	}
+	if want := []string{"carol@example.com", "dave@example.com"}; !reflect.DeepEqual(stored, want) {
+		t.Errorf("stored for %v, want %v", stored, want)
+	}
+	if len(submitted) != 1 || !reflect.DeepEqual(submitted[0].Recipients, []string{"bob@gmail.com"}) || submitted[0].From != "sender@example.com" {
+		t.Fatalf("submitted = %+v, want one forward to bob@gmail.com", submitted)
+	}
+	if !strings.Contains(bodies[0], "Resent-From: <sales@example.com>\r\n") || !strings.HasSuffix(bodies[0], "Subject: hi\r\n\r\nbody\r\n") {
+		t.Errorf("forwarded message = %q", bodies[0])
+	}
+
+	// Without a submitter, an external target fails the whole delivery
+	// rather than landing in a local mailbox.
+	underlying.deliveries = nil
+	agent = NewExpandingDeliveryAgent(underlying, expander, inExampleCom, nil)
+	if err := deliverTo(agent, "hi", "sales@example.com"); !stderrors.Is(err, errors.ErrNoRelay) {
+		t.Errorf("error = %v, want ErrNoRelay", err)
+	}
+	if len(underlying.deliveries) != 0 {
+		t.Errorf("underlying received %d deliveries, want 0", len(underlying.deliveries))
+	}
+}
@@ -0,0 +1,121 @@
+package msgstore
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+)
+
+// AuditOp identifies a mutating store operation in the audit log.
+type AuditOp string
+
+// Audited operations.
+const (
+	AuditDeliver      AuditOp = "deliver"
+	AuditAppend       AuditOp = "append"
+	AuditCopy         AuditOp = "copy"
+	AuditMove         AuditOp = "move"
+	AuditDelete       AuditOp = "delete"
+	AuditExpunge      AuditOp = "expunge"
+	AuditRestore      AuditOp = "restore"
+	AuditSetFlags     AuditOp = "set_flags"
+	AuditCreateFolder AuditOp = "create_folder"
+	AuditDeleteFolder AuditOp = "delete_folder"
+	AuditRenameFolder AuditOp = "rename_folder"
+	AuditKeyMismatch  AuditOp = "key_mismatch"
+)
+
+// AuditEvent records one mutating operation.
+type AuditEvent struct {
+	// Time is when the operation completed.
+	Time time.Time `json:"time"`
+
+	// Op is the operation performed.
+	Op AuditOp `json:"op"`
+
+	// Actor identifies who requested the operation (see WithActor).
+	// Empty if the caller did not set one.
+	Actor string `json:"actor,omitempty"`
+
+	// Mailbox is the mailbox operated on.
+	Mailbox string `json:"mailbox"`
+
+	// Folder is the folder operated on; empty for the inbox.
+	Folder string `json:"folder,omitempty"`
+
+	// UID is the message affected, if the operation targets a single message.
+	UID string `json:"uid,omitempty"`
+
+	// Detail carries operation-specific context, such as the new folder
+	// name of a rename or the flags set.
+	Detail string `json:"detail,omitempty"`
+
+	// Result is "ok", or the error message if the operation failed.
+	Result string `json:"result"`
+}
+
+// AuditLogger receives an event for every mutating store operation, for
+// compliance and abuse investigations. Audit must be safe for concurrent use.
+// A failure to record an event is logged by the store but does not fail the
+// operation being audited.
+type AuditLogger interface {
+	Audit(ctx context.Context, event AuditEvent) error
+}
+
+// actorKey is the context key for the audit actor.
+type actorKey struct{}
+
+// WithActor returns a context carrying the identity recorded as the actor of
+// audited operations performed with it (e.g., "imapd:alice@example.com").
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// ActorFromContext returns the actor set with WithActor, or "".
+func ActorFromContext(ctx context.Context) string {
+	actor, _ := ctx.Value(actorKey{}).(string)
+	return actor
+}
+
+// FileAuditLogger appends audit events to a file as JSON lines.
+type FileAuditLogger struct {
+	mu   sync.Mutex
+	file *os.File
+}
+
+// NewFileAuditLogger opens path for appending, creating it with mode 0600 if
+// it does not exist. Existing content is never truncated.
+func NewFileAuditLogger(path string) (*FileAuditLogger, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	return &FileAuditLogger{file: f}, nil
+}
+
+// Audit implements AuditLogger. Each event is written with a single write
+// call so that lines from concurrent writers are never interleaved.
+func (l *FileAuditLogger) Audit(ctx context.Context, event AuditEvent) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.file.Write(line)
+	return err
+}
+
+// Close closes the underlying file.
+func (l *FileAuditLogger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// Compile-time interface verification.
+var _ AuditLogger = (*FileAuditLogger)(nil)
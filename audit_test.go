@@ -0,0 +1,77 @@
+package msgstore
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestFileAuditLogger(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	ctx := WithActor(context.Background(), "imapd:alice@example.com")
+
+	// Two loggers over the same file append rather than truncate.
+	for i, uid := range []string{"1", "2"} {
+		logger, err := NewFileAuditLogger(path)
+		if err != nil {
+			t.Fatalf("NewFileAuditLogger failed: %v", err)
+		}
+		event := AuditEvent{
+			Time:    time.Date(2026, 1, 1, 0, 0, i, 0, time.UTC),
+			Op:      AuditDelete,
+			Actor:   ActorFromContext(ctx),
+			Mailbox: "alice@example.com",
+			UID:     uid,
+			Result:  "ok",
+		}
+		if err := logger.Audit(ctx, event); err != nil {
+			t.Fatalf("Audit failed: %v", err)
+		}
+		if err := logger.Close(); err != nil {
+			t.Fatalf("Close failed: %v", err)
+		}
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var events []AuditEvent
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var event AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			t.Fatalf("line %q is not JSON: %v", scanner.Text(), err)
+		}
+		events = append(events, event)
+	}
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	if events[0].UID != "1" || events[1].UID != "2" {
+		t.Errorf("events out of order: %+v", events)
+	}
+	if events[1].Actor != "imapd:alice@example.com" || events[1].Op != AuditDelete {
+		t.Errorf("unexpected event: %+v", events[1])
+	}
+
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode().Perm() != 0600 {
+		t.Errorf("audit log mode = %v, want 0600", fi.Mode().Perm())
+	}
+}
+
+func TestActorFromContext_Unset(t *testing.T) {
+	if actor := ActorFromContext(context.Background()); actor != "" {
+		t.Errorf("ActorFromContext = %q, want empty", actor)
+	}
+}
@@ -0,0 +1,161 @@
+package msgstore
+
+import (
+	"bytes"
+	"strings"
+)
+
+// AuthenticationResultsHeader is the header field written by
+// StampAuthenticationResults.
+const AuthenticationResultsHeader = "Authentication-Results"
+
+// FormatAuthenticationResults returns an RFC 8601 Authentication-Results
+// header field, including its trailing CRLF, for the verdicts carried by
+// envelope.Authentication. authservID names the host that performed the
+// checks. An envelope without verdicts yields "none". Verdicts that are not
+// RFC 8601 result keywords are left out, and property values that are not
+// plain tokens or addresses are quoted, so the envelope cannot inject
+// header fields or break the field's syntax.
+func FormatAuthenticationResults(authservID string, envelope Envelope) string {
+	var methods []string
+	if r := envelope.Authentication; r != nil {
+		if isResultKeyword(r.SPF) {
+			if envelope.From != "" {
+				methods = append(methods, "spf="+r.SPF+" smtp.mailfrom="+pvalue(envelope.From))
+			} else if envelope.ClientHostname != "" {
+				methods = append(methods, "spf="+r.SPF+" smtp.helo="+pvalue(envelope.ClientHostname))
+			} else {
+				methods = append(methods, "spf="+r.SPF)
+			}
+		}
+		if isResultKeyword(r.DKIM) {
+			if len(r.DKIMDomains) == 0 {
+				methods = append(methods, "dkim="+r.DKIM)
+			}
+			for _, domain := range r.DKIMDomains {
+				methods = append(methods, "dkim="+r.DKIM+" header.d="+pvalue(domain))
+			}
+		}
+		if isResultKeyword(r.DMARC) {
+			methods = append(methods, "dmarc="+r.DMARC)
+		}
+	}
+	if len(methods) == 0 {
+		return AuthenticationResultsHeader + ": " + authservID + "; none\r\n"
+	}
+	return AuthenticationResultsHeader + ": " + authservID + ";\r\n\t" + strings.Join(methods, ";\r\n\t") + "\r\n"
+}
+
+// isResultKeyword reports whether s is a non-empty RFC 8601 result keyword:
+// letters, digits and hyphens.
+func isResultKeyword(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range []byte(s) {
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+// pvalue formats v as an RFC 8601 pvalue: as is if it is an RFC 2045 token
+// or an address with a dot-atom local part, and otherwise as a
+// quoted-string. Control characters, which neither form may hold, are
+// dropped.
+func pvalue(v string) string {
+	v = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, v)
+	if isMIMEToken(v) {
+		return v
+	}
+	if local, domain, ok := strings.Cut(v, "@"); ok && isDotAtom(local) && isMIMEToken(domain) {
+		return v
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(v) + `"`
+}
+
+// isMIMEToken reports whether s is a token as defined by RFC 2045: printable
+// ASCII other than space and tspecials.
+func isMIMEToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range []byte(s) {
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`()<>@,;:\"/[]?=`, c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// isDotAtom reports whether s is an RFC 5322 dot-atom, or empty.
+func isDotAtom(s string) bool {
+	if s == "" {
+		return true
+	}
+	for _, atom := range strings.Split(s, ".") {
+		if atom == "" {
+			return false
+		}
+		for _, c := range []byte(atom) {
+			if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || strings.IndexByte("!#$%&'*+-/=?^_`{|}~", c) >= 0) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// StampAuthenticationResults prepends the Authentication-Results field
+// for envelope to message. Fields already in the message that claim to
+// come from authservID are removed first, as RFC 8601 section 5 requires,
+// so senders cannot forge verdicts in the receiver's name.
+func StampAuthenticationResults(message []byte, authservID string, envelope Envelope) []byte {
+	stamped := []byte(FormatAuthenticationResults(authservID, envelope))
+	return append(stamped, removeAuthenticationResults(message, authservID)...)
+}
+
+// removeAuthenticationResults returns message without the
+// Authentication-Results fields of its header section whose authserv-id
+// is authservID.
+func removeAuthenticationResults(message []byte, authservID string) []byte {
+	var out []byte
+	skipping := false
+	rest := message
+	for len(rest) > 0 {
+		line := rest
+		if i := bytes.IndexByte(rest, '\n'); i >= 0 {
+			line = rest[:i+1]
+		}
+		rest = rest[len(line):]
+		if len(bytes.TrimRight(line, "\r\n")) == 0 {
+			// End of the header section.
+			out = append(out, line...)
+			out = append(out, rest...)
+			break
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			if !skipping {
+				out = append(out, line...)
+			}
+			continue
+		}
+		skipping = false
+		name, value, ok := bytes.Cut(line, []byte(":"))
+		if ok && strings.EqualFold(string(bytes.TrimSpace(name)), AuthenticationResultsHeader) {
+			id, _, _ := bytes.Cut(value, []byte(";"))
+			if fields := strings.Fields(string(id)); len(fields) > 0 && strings.EqualFold(fields[0], authservID) {
+				skipping = true
+				continue
+			}
+		}
+		out = append(out, line...)
+	}
+	return out
+}
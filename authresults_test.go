@@ -0,0 +1,81 @@
+package msgstore
+
+import "testing"
+
+func TestFormatAuthenticationResults(t *testing.T) {
+	tests := []struct {
+		name     string
+		envelope Envelope
+		want     string
+	}{
+		{
+			name:     "no checks",
+			envelope: Envelope{From: "sender@example.org"},
+			want:     "Authentication-Results: mx.example.com; none\r\n",
+		},
+		{
+			name: "all verdicts",
+			envelope: Envelope{From: "sender@example.org", Authentication: &AuthenticationResults{
+				SPF: "pass", DKIM: "pass", DKIMDomains: []string{"example.org", "esp.example.net"}, DMARC: "pass",
+			}},
+			want: "Authentication-Results: mx.example.com;\r\n" +
+				"\tspf=pass smtp.mailfrom=sender@example.org;\r\n" +
+				"\tdkim=pass header.d=example.org;\r\n" +
+				"\tdkim=pass header.d=esp.example.net;\r\n" +
+				"\tdmarc=pass\r\n",
+		},
+		{
+			name:     "bounce uses helo",
+			envelope: Envelope{ClientHostname: "mta.example.org", Authentication: &AuthenticationResults{SPF: "softfail", DKIM: "none"}},
+			want: "Authentication-Results: mx.example.com;\r\n" +
+				"\tspf=softfail smtp.helo=mta.example.org;\r\n" +
+				"\tdkim=none\r\n",
+		},
+		{
+			name: "quoted local part",
+			envelope: Envelope{From: `"john doe;x"@example.org`, Authentication: &AuthenticationResults{
+				SPF: "pass", DKIM: "pass", DKIMDomains: []string{"example.org; dmarc=pass"},
+			}},
+			want: "Authentication-Results: mx.example.com;\r\n" +
+				"\tspf=pass smtp.mailfrom=\"\\\"john doe;x\\\"@example.org\";\r\n" +
+				"\tdkim=pass header.d=\"example.org; dmarc=pass\"\r\n",
+		},
+		{
+			name: "line breaks",
+			envelope: Envelope{ClientHostname: "mta.example.org\r\nX-Injected: yes", Authentication: &AuthenticationResults{
+				SPF: "pass", DKIM: "pass\r\nX-Injected: yes", DMARC: "fail",
+			}},
+			want: "Authentication-Results: mx.example.com;\r\n" +
+				"\tspf=pass smtp.helo=\"mta.example.orgX-Injected: yes\";\r\n" +
+				"\tdmarc=fail\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := FormatAuthenticationResults("mx.example.com", tt.envelope); got != tt.want {
+				t.Errorf("FormatAuthenticationResults = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStampAuthenticationResults(t *testing.T) {
+	message := "Authentication-Results: MX.example.com; spf=pass\r\n" +
+		"\tsmtp.mailfrom=forged@example.org\r\n" +
+		"Authentication-Results: relay.example.net; dkim=pass\r\n" +
+		"Subject: hi\r\n" +
+		"\r\n" +
+		"Authentication-Results: mx.example.com; body text\r\n"
+	envelope := Envelope{From: "sender@example.org", Authentication: &AuthenticationResults{SPF: "fail"}}
+
+	got := string(StampAuthenticationResults([]byte(message), "mx.example.com", envelope))
+	want := "Authentication-Results: mx.example.com;\r\n" +
+		"\tspf=fail smtp.mailfrom=sender@example.org\r\n" +
+		"Authentication-Results: relay.example.net; dkim=pass\r\n" +
+		"Subject: hi\r\n" +
+		"\r\n" +
+		"Authentication-Results: mx.example.com; body text\r\n"
+	if got != want {
+		t.Errorf("StampAuthenticationResults = %q, want %q", got, want)
+	}
+}
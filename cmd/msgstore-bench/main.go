@@ -0,0 +1,367 @@
+// Command msgstore-bench drives configurable workloads against any
+// registered store backend and reports latency percentiles, to validate
+// performance changes such as streaming delivery and index caches.
+//
+//	msgstore-bench -store 'maildir:///tmp/bench' -messages 5000 -size 16384 \
+//		-concurrency 16 -ops 20000 -mix list=1,stat=1,retrieve=6,expunge=2
+//
+// The run has two phases. The deliver phase stores -messages messages of
+// -size bytes, spread over -mailboxes mailboxes. The mixed phase then runs
+// -ops operations chosen by the weights of -mix. Both phases use
+// -concurrency workers, each acting as one client session. The store is
+// opened with msgstore.OpenURL, so any backend compiled in can be measured.
+// That includes a remote store behind the session protocol. The store is
+// not cleaned up afterwards.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/infodancer/msgstore"
+	_ "github.com/infodancer/msgstore/maildir"
+	_ "github.com/infodancer/msgstore/session"
+)
+
+// ops are the operations of the mixed phase, in report order.
+var ops = []string{"list", "stat", "retrieve", "expunge"}
+
+// config is the parsed command line.
+type config struct {
+	storeURL    string
+	messages    int
+	size        int
+	mailboxes   int
+	concurrency int
+	ops         int
+	mix         map[string]int
+	seed        uint64
+}
+
+func main() {
+	cfg, err := parseFlags(os.Args[1:])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "msgstore-bench:", err)
+		os.Exit(2)
+	}
+	if err := run(context.Background(), cfg, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "msgstore-bench:", err)
+		os.Exit(1)
+	}
+}
+
+// parseFlags parses the command line.
+func parseFlags(args []string) (config, error) {
+	var cfg config
+	var mix string
+	fs := flag.NewFlagSet("msgstore-bench", flag.ContinueOnError)
+	fs.StringVar(&cfg.storeURL, "store", "", "store URL, e.g. maildir:///tmp/bench (required)")
+	fs.IntVar(&cfg.messages, "messages", 1000, "messages to deliver")
+	fs.IntVar(&cfg.size, "size", 4096, "message size in bytes")
+	fs.IntVar(&cfg.mailboxes, "mailboxes", 10, "mailboxes to spread messages over")
+	fs.IntVar(&cfg.concurrency, "concurrency", 8, "concurrent sessions")
+	fs.IntVar(&cfg.ops, "ops", 10000, "operations in the mixed phase; 0 skips it")
+	fs.StringVar(&mix, "mix", "list=1,stat=1,retrieve=6,expunge=2", "weights of the mixed phase operations")
+	fs.Uint64Var(&cfg.seed, "seed", 1, "seed for choosing operations and messages")
+	if err := fs.Parse(args); err != nil {
+		return cfg, err
+	}
+	if cfg.storeURL == "" {
+		return cfg, fmt.Errorf("-store is required")
+	}
+	if cfg.messages < 0 || cfg.size < 0 || cfg.mailboxes < 1 || cfg.concurrency < 1 || cfg.ops < 0 {
+		return cfg, fmt.Errorf("counts must not be negative; -mailboxes and -concurrency must be at least 1")
+	}
+	var err error
+	cfg.mix, err = parseMix(mix)
+	return cfg, err
+}
+
+// parseMix parses operation weights written as op=weight pairs separated
+// by commas.
+func parseMix(s string) (map[string]int, error) {
+	mix := make(map[string]int)
+	total := 0
+	for _, pair := range strings.Split(s, ",") {
+		op, weight, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		n, err := strconv.Atoi(weight)
+		if !ok || err != nil || n < 0 {
+			return nil, fmt.Errorf("-mix: %q is not op=weight", pair)
+		}
+		if !slices.Contains(ops, op) {
+			return nil, fmt.Errorf("-mix: unknown operation %q (have %s)", op, strings.Join(ops, ", "))
+		}
+		mix[op] = n
+		total += n
+	}
+	if total == 0 {
+		return nil, fmt.Errorf("-mix: weights add up to zero")
+	}
+	return mix, nil
+}
+
+// recorder collects the latencies of one operation.
+type recorder struct {
+	mu        sync.Mutex
+	latencies []time.Duration
+	errors    int
+	lastErr   error
+}
+
+// record adds the outcome of one operation.
+func (r *recorder) record(d time.Duration, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err != nil {
+		r.errors++
+		r.lastErr = err
+		return
+	}
+	r.latencies = append(r.latencies, d)
+}
+
+// percentile returns the nearest-rank p-th percentile of sorted.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(p/100*float64(len(sorted))+0.5) - 1
+	return sorted[min(max(rank, 0), len(sorted)-1)]
+}
+
+// bench is the state of one run.
+type bench struct {
+	cfg     config
+	store   msgstore.MsgStore
+	message []byte
+	results map[string]*recorder
+
+	// uids holds the messages of each mailbox not yet expunged.
+	mu   sync.Mutex
+	uids map[string][]string
+}
+
+// run opens the store, runs both phases and writes the report to w.
+func run(ctx context.Context, cfg config, w io.Writer) error {
+	store, err := msgstore.OpenURL(cfg.storeURL)
+	if err != nil {
+		return err
+	}
+	if c, ok := store.(io.Closer); ok {
+		defer c.Close()
+	}
+	b := &bench{
+		cfg:     cfg,
+		store:   store,
+		message: testMessage(cfg.size),
+		results: make(map[string]*recorder),
+		uids:    make(map[string][]string),
+	}
+	for _, op := range append([]string{"deliver"}, ops...) {
+		b.results[op] = &recorder{}
+	}
+
+	start := time.Now()
+	b.parallel(cfg.messages, func(i int, _ *rand.Rand) {
+		b.deliver(ctx, b.mailbox(i))
+	})
+	deliverTime := time.Since(start)
+
+	for i := 0; i < cfg.mailboxes; i++ {
+		mailbox := b.mailbox(i)
+		msgs, err := store.List(ctx, mailbox)
+		if err != nil {
+			return fmt.Errorf("listing %s after delivery: %w", mailbox, err)
+		}
+		for _, m := range msgs {
+			b.uids[mailbox] = append(b.uids[mailbox], m.UID)
+		}
+	}
+
+	start = time.Now()
+	b.parallel(cfg.ops, func(_ int, rng *rand.Rand) {
+		b.mixed(ctx, rng)
+	})
+	mixedTime := time.Since(start)
+
+	return b.report(w, deliverTime, mixedTime)
+}
+
+// mailbox returns the i-th mailbox, wrapping around.
+func (b *bench) mailbox(i int) string {
+	return fmt.Sprintf("bench%d@example.com", i%b.cfg.mailboxes)
+}
+
+// parallel calls fn for 0..n-1 from cfg.concurrency workers, each with its
+// own random source.
+func (b *bench) parallel(n int, fn func(i int, rng *rand.Rand)) {
+	var next sync.Mutex
+	i := 0
+	var wg sync.WaitGroup
+	for worker := 0; worker < b.cfg.concurrency; worker++ {
+		rng := rand.New(rand.NewPCG(b.cfg.seed, uint64(worker)))
+		wg.Go(func() {
+			for {
+				next.Lock()
+				j := i
+				i++
+				next.Unlock()
+				if j >= n {
+					return
+				}
+				fn(j, rng)
+			}
+		})
+	}
+	wg.Wait()
+}
+
+// timed runs fn and records its latency under op.
+func (b *bench) timed(op string, fn func() error) {
+	start := time.Now()
+	err := fn()
+	b.results[op].record(time.Since(start), err)
+}
+
+func (b *bench) deliver(ctx context.Context, mailbox string) {
+	envelope := msgstore.Envelope{
+		From:         "bench@example.org",
+		Recipients:   []string{mailbox},
+		ReceivedTime: time.Now(),
+	}
+	b.timed("deliver", func() error {
+		return b.store.Deliver(ctx, envelope, strings.NewReader(string(b.message)))
+	})
+}
+
+// mixed runs one operation of the mixed phase, chosen by weight.
+func (b *bench) mixed(ctx context.Context, rng *rand.Rand) {
+	total := 0
+	for _, op := range ops {
+		total += b.cfg.mix[op]
+	}
+	pick := rng.IntN(total)
+	op := ops[0]
+	for _, o := range ops {
+		if pick < b.cfg.mix[o] {
+			op = o
+			break
+		}
+		pick -= b.cfg.mix[o]
+	}
+	mailbox := b.mailbox(rng.IntN(b.cfg.mailboxes))
+
+	switch op {
+	case "list":
+		b.timed(op, func() error {
+			_, err := b.store.List(ctx, mailbox)
+			return err
+		})
+	case "stat":
+		b.timed(op, func() error {
+			_, _, err := b.store.Stat(ctx, mailbox)
+			return err
+		})
+	case "retrieve":
+		uid, ok := b.pickUID(mailbox, rng, false)
+		if !ok {
+			return
+		}
+		b.timed(op, func() error {
+			rc, err := b.store.Retrieve(ctx, mailbox, uid)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(io.Discard, rc)
+			if cerr := rc.Close(); err == nil {
+				err = cerr
+			}
+			return err
+		})
+	case "expunge":
+		uid, ok := b.pickUID(mailbox, rng, true)
+		if !ok {
+			return
+		}
+		b.timed(op, func() error {
+			if err := b.store.Delete(ctx, mailbox, uid); err != nil {
+				return err
+			}
+			_, err := b.store.Expunge(ctx, mailbox)
+			return err
+		})
+	}
+}
+
+// pickUID returns a random message of mailbox that has not been expunged,
+// removing it from the pool if remove is set. ok is false if none is left.
+func (b *bench) pickUID(mailbox string, rng *rand.Rand, remove bool) (string, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	uids := b.uids[mailbox]
+	if len(uids) == 0 {
+		return "", false
+	}
+	i := rng.IntN(len(uids))
+	uid := uids[i]
+	if remove {
+		uids[i] = uids[len(uids)-1]
+		b.uids[mailbox] = uids[:len(uids)-1]
+	}
+	return uid, true
+}
+
+// report writes a table of the results.
+func (b *bench) report(w io.Writer, deliverTime, mixedTime time.Duration) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(tw, "op\tcount\terrors\tops/s\tp50\tp90\tp99\tmax\t")
+	var failures []string
+	for _, op := range append([]string{"deliver"}, ops...) {
+		r := b.results[op]
+		if len(r.latencies) == 0 && r.errors == 0 {
+			continue
+		}
+		elapsed := mixedTime
+		if op == "deliver" {
+			elapsed = deliverTime
+		}
+		sorted := slices.Clone(r.latencies)
+		slices.Sort(sorted)
+		count := len(sorted) + r.errors
+		rate := float64(count) / elapsed.Seconds()
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.0f\t%v\t%v\t%v\t%v\t\n", op, count, r.errors, rate,
+			percentile(sorted, 50), percentile(sorted, 90), percentile(sorted, 99), percentile(sorted, 100))
+		if r.lastErr != nil {
+			failures = append(failures, fmt.Sprintf("%s: %d errors, last: %v", op, r.errors, r.lastErr))
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	for _, f := range failures {
+		fmt.Fprintln(w, f)
+	}
+	return nil
+}
+
+// testMessage returns a message of size bytes: a small header and lines
+// of filler text.
+func testMessage(size int) []byte {
+	var b strings.Builder
+	b.WriteString("From: bench@example.org\r\nTo: bench@example.com\r\nSubject: msgstore-bench\r\n\r\n")
+	line := strings.Repeat("x", 76) + "\r\n"
+	for b.Len() < size {
+		b.WriteString(line)
+	}
+	return []byte(b.String()[:max(size, 0)])
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseMix(t *testing.T) {
+	mix, err := parseMix("list=2, retrieve=5,expunge=0")
+	if err != nil {
+		t.Fatalf("parseMix: %v", err)
+	}
+	if mix["list"] != 2 || mix["retrieve"] != 5 || mix["expunge"] != 0 || mix["stat"] != 0 {
+		t.Errorf("mix = %v", mix)
+	}
+
+	for _, bad := range []string{"", "list", "list=x", "list=-1", "fetch=1", "list=0,stat=0"} {
+		if _, err := parseMix(bad); err == nil {
+			t.Errorf("parseMix(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestParseFlagsRequiresStore(t *testing.T) {
+	if _, err := parseFlags(nil); err == nil {
+		t.Error("parseFlags without -store succeeded")
+	}
+	if _, err := parseFlags([]string{"-store", "maildir:///tmp/x", "-concurrency", "0"}); err == nil {
+		t.Error("parseFlags with -concurrency 0 succeeded")
+	}
+}
+
+func TestPercentile(t *testing.T) {
+	var sorted []time.Duration
+	for i := 1; i <= 100; i++ {
+		sorted = append(sorted, time.Duration(i))
+	}
+	for _, tc := range []struct {
+		p    float64
+		want time.Duration
+	}{{0, 1}, {50, 50}, {90, 90}, {99, 99}, {100, 100}} {
+		if got := percentile(sorted, tc.p); got != tc.want {
+			t.Errorf("percentile(%v) = %v, want %v", tc.p, got, tc.want)
+		}
+	}
+	if got := percentile(nil, 50); got != 0 {
+		t.Errorf("percentile of nothing = %v", got)
+	}
+}
+
+func TestTestMessageSize(t *testing.T) {
+	for _, size := range []int{0, 10, 4096} {
+		if got := len(testMessage(size)); got != size {
+			t.Errorf("len(testMessage(%d)) = %d", size, got)
+		}
+	}
+}
+
+func TestRunMaildir(t *testing.T) {
+	cfg, err := parseFlags([]string{
+		"-store", "maildir://" + t.TempDir(),
+		"-messages", "40", "-mailboxes", "4", "-concurrency", "4", "-ops", "100",
+	})
+	if err != nil {
+		t.Fatalf("parseFlags: %v", err)
+	}
+	var out bytes.Buffer
+	if err := run(context.Background(), cfg, &out); err != nil {
+		t.Fatalf("run: %v", err)
+	}
+	report := out.String()
+	for _, op := range []string{"deliver", "retrieve", "p99"} {
+		if !strings.Contains(report, op) {
+			t.Errorf("report lacks %q:\n%s", op, report)
+		}
+	}
+	if strings.Contains(report, "errors, last:") {
+		t.Errorf("run had errors:\n%s", report)
+	}
+	t.Log("\n" + report)
+}
@@ -0,0 +1,38 @@
+package msgstore
+
+import "context"
+
+// ConditionalStore makes folder mutations conditional on the folder being
+// unchanged, for optimistic concurrency between frontends sharing one store
+// (IMAP CONDSTORE's UNCHANGEDSINCE, RFC 7162). A caller learns the folder's
+// modification sequence from HighestModSeq, Resync or ExpungedSince and
+// passes it back with WithUnchangedSince; if another writer changed the
+// folder in between, the mutation fails with errors.ErrConflict and changes
+// nothing, and the caller rereads the folder and retries.
+//
+// Stores implementing ConditionalStore honour the precondition in Delete,
+// Expunge, DeleteInFolder, ExpungeFolder, SetFlagsInFolder, ExpungeUIDs and
+// MoveMessages (against the source folder).
+// Consumers that need it should type-assert to ConditionalStore.
+type ConditionalStore interface {
+	// HighestModSeq returns the current modification sequence of folder
+	// ("INBOX" for the inbox).
+	HighestModSeq(ctx context.Context, mailbox string, folder string) (uint64, error)
+}
+
+// unchangedSinceKey is the context key for the mutation precondition.
+type unchangedSinceKey struct{}
+
+// WithUnchangedSince returns a context under which the folder mutations of
+// a ConditionalStore succeed only if the folder's modification sequence is
+// still modSeq.
+func WithUnchangedSince(ctx context.Context, modSeq uint64) context.Context {
+	return context.WithValue(ctx, unchangedSinceKey{}, modSeq)
+}
+
+// UnchangedSinceFromContext returns the modification sequence set with
+// WithUnchangedSince, and whether one was set.
+func UnchangedSinceFromContext(ctx context.Context) (modSeq uint64, ok bool) {
+	modSeq, ok = ctx.Value(unchangedSinceKey{}).(uint64)
+	return modSeq, ok
+}
@@ -7,8 +7,8 @@ package msgstore
 type EncryptionInfo struct {
 	// Algorithm identifies the encryption algorithm used.
 	// Example: "x25519-xsalsa20-poly1305" (NaCl box)
-	Algorithm string
+	Algorithm string `json:"algorithm"`
 
 	// Encrypted indicates whether the message content is encrypted.
-	Encrypted bool
+	Encrypted bool `json:"encrypted"`
 }
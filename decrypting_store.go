@@ -61,7 +61,7 @@ func (s *PassthroughDecryptingStore) Delete(ctx context.Context, mailbox string,
 }
 
 // Expunge delegates to the underlying store.
-func (s *PassthroughDecryptingStore) Expunge(ctx context.Context, mailbox string) error {
+func (s *PassthroughDecryptingStore) Expunge(ctx context.Context, mailbox string) ([]string, error) {
 	return s.underlying.Expunge(ctx, mailbox)
 }
 
@@ -31,9 +31,9 @@ func (m *mockStore) Delete(_ context.Context, _ string, _ string) error {
 	return nil
 }
 
-func (m *mockStore) Expunge(_ context.Context, _ string) error {
+func (m *mockStore) Expunge(_ context.Context, _ string) ([]string, error) {
 	m.expungeCalled = true
-	return nil
+	return nil, nil
 }
 
 func (m *mockStore) Stat(_ context.Context, _ string) (int, int64, error) {
@@ -67,7 +67,7 @@ func TestPassthroughDecryptingStore_PassesThrough(t *testing.T) {
 		t.Error("Delete not delegated to underlying store")
 	}
 
-	if err := store.Expunge(ctx, "inbox"); err != nil {
+	if _, err := store.Expunge(ctx, "inbox"); err != nil {
 		t.Fatalf("Expunge: %v", err)
 	}
 	if !mock.expungeCalled {
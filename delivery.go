@@ -50,6 +50,12 @@ type DeliveryAgent interface {
 	Deliver(ctx context.Context, envelope Envelope, message io.Reader) error
 }
 
+// RelayFunc hands a message to an outbound mail transport for delivery to
+// addresses outside the store, such as Sieve redirect and .forward targets.
+// envelope.From is the reverse-path to use and envelope.Recipients are the
+// forward-paths to relay to.
+type RelayFunc func(ctx context.Context, envelope Envelope, message io.Reader) error
+
 // Envelope contains the message envelope information from the SMTP transaction.
 type Envelope struct {
 	// From is the MAIL FROM address (reverse-path).
@@ -67,6 +73,18 @@ type Envelope struct {
 	// ClientHostname is the hostname provided in EHLO/HELO.
 	ClientHostname string
 
+	// AuthenticatedSender is the identity the client authenticated as with
+	// SMTP AUTH. Empty for unauthenticated mail.
+	AuthenticatedSender string
+
+	// TLS describes the session's transport security.
+	// nil indicates the message was received in plaintext.
+	TLS *TLSInfo
+
+	// Authentication carries the SPF, DKIM and DMARC verdicts from the
+	// upstream checks. nil indicates no checks were performed.
+	Authentication *AuthenticationResults
+
 	// Encryption contains metadata about message encryption.
 	// nil indicates plaintext (unencrypted) message.
 	// Note: smtpd encrypts before delivery, msgstore only stores the blob.
@@ -76,17 +94,69 @@ type Envelope struct {
 	// nil indicates no spam check was performed (e.g., authenticated submission).
 	// This is envelope metadata — the message body is never modified.
 	SpamResult *SpamResult
+
+	// IdempotencyKey optionally identifies this delivery attempt's message,
+	// e.g. the queue ID smtpd assigned at DATA. A store that supports it
+	// remembers recent keys per mailbox and treats a repeated delivery with
+	// the same key as already done, so a retry after a timeout does not
+	// store a second copy. Empty disables the check.
+	IdempotencyKey string
+}
+
+// TLSInfo describes the TLS session a message was received over.
+type TLSInfo struct {
+	// Version is the protocol version, e.g. "TLS 1.3" as returned by
+	// tls.VersionName.
+	Version string `json:"version"`
+
+	// Cipher is the cipher suite, e.g. "TLS_AES_128_GCM_SHA256" as
+	// returned by tls.CipherSuiteName.
+	Cipher string `json:"cipher"`
+}
+
+// AuthenticationResults carries sender authentication verdicts as envelope
+// metadata. Each verdict is an RFC 8601 result such as "pass", "fail",
+// "softfail", "neutral", "none", "temperror" or "permerror"; empty means
+// that check was not performed.
+type AuthenticationResults struct {
+	// SPF is the SPF verdict for the MAIL FROM domain (or the HELO name
+	// for a null reverse-path).
+	SPF string `json:"spf,omitempty"`
+
+	// DKIM is the verdict of the best DKIM signature: "pass" if any
+	// signature verified.
+	DKIM string `json:"dkim,omitempty"`
+
+	// DKIMDomains lists the d= domains of the signatures that verified.
+	DKIMDomains []string `json:"dkim_domains,omitempty"`
+
+	// DMARC is the DMARC verdict for the From header domain.
+	DMARC string `json:"dmarc,omitempty"`
+}
+
+// ReceivedProtocol returns the RFC 3848 protocol name for the "with"
+// clause of a Received header: "ESMTP", with "S" appended for TLS and "A"
+// for an authenticated client, e.g. "ESMTPSA".
+func (e Envelope) ReceivedProtocol() string {
+	protocol := "ESMTP"
+	if e.TLS != nil {
+		protocol += "S"
+	}
+	if e.AuthenticatedSender != "" {
+		protocol += "A"
+	}
+	return protocol
 }
 
 // SpamResult carries the outcome of a spam check as envelope metadata.
 // The delivery agent uses this to route flagged messages (e.g., to a Junk folder).
 type SpamResult struct {
 	// Score is the spam score from the checker (higher = more likely spam).
-	Score float64
+	Score float64 `json:"score"`
 
 	// Action is the recommended action: "accept", "flag", "reject", "tempfail".
-	Action string
+	Action string `json:"action"`
 
 	// Checker identifies which spam checker produced this result (e.g., "rspamd").
-	Checker string
+	Checker string `json:"checker"`
 }
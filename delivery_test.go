@@ -114,3 +114,20 @@ func TestEnvelope_SpamResultNil(t *testing.T) {
 		t.Error("SpamResult should be nil when no spam check performed")
 	}
 }
+
+func TestEnvelope_ReceivedProtocol(t *testing.T) {
+	tests := []struct {
+		envelope Envelope
+		want     string
+	}{
+		{Envelope{}, "ESMTP"},
+		{Envelope{TLS: &TLSInfo{Version: "TLS 1.3"}}, "ESMTPS"},
+		{Envelope{AuthenticatedSender: "alice"}, "ESMTPA"},
+		{Envelope{TLS: &TLSInfo{Version: "TLS 1.3"}, AuthenticatedSender: "alice"}, "ESMTPSA"},
+	}
+	for _, tt := range tests {
+		if got := tt.envelope.ReceivedProtocol(); got != tt.want {
+			t.Errorf("ReceivedProtocol(%+v) = %q, want %q", tt.envelope, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+// Package dsn builds delivery status notifications (bounces) in the
+// RFC 3464 multipart/report format.
+//
+// Components that must tell a sender their message was not delivered — Sieve
+// reject, quota rejection, retry expiry — use Build instead of composing
+// bounce text themselves:
+//
+//	bounce, err := dsn.Build(envelope, []dsn.Failure{{
+//	    Recipient: "user@example.com",
+//	    Status:    "5.2.2",
+//	    Reason:    "mailbox full",
+//	}}, dsn.HeaderSection(message), dsn.Options{ReportingMTA: "mail.example.com"})
+//
+// The returned Bounce carries the envelope to relay it with: a null
+// reverse-path and the original sender as the only recipient.
+package dsn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"strings"
+	"time"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+// Action values for Failure.Action (RFC 3464 section 2.3.3).
+const (
+	// ActionFailed reports that the message could not be delivered.
+	ActionFailed = "failed"
+
+	// ActionDelayed reports that delivery is still being retried.
+	ActionDelayed = "delayed"
+)
+
+// Failure describes the delivery outcome for one recipient.
+type Failure struct {
+	// Recipient is the address delivery was attempted to.
+	Recipient string
+
+	// Action is ActionFailed or ActionDelayed. Defaults to ActionFailed.
+	Action string
+
+	// Status is the RFC 3463 enhanced status code (e.g., "5.2.2").
+	// Defaults to "5.0.0" for failures and "4.0.0" for delays.
+	Status string
+
+	// DiagnosticCode is the SMTP reply that caused the failure, if any
+	// (e.g., "552 5.2.2 Mailbox full"). It is reported with type "smtp".
+	DiagnosticCode string
+
+	// Reason is a short human-readable explanation shown to the sender.
+	Reason string
+}
+
+// Options controls the generated notification.
+type Options struct {
+	// ReportingMTA is the DNS name of the host generating the report. Required.
+	ReportingMTA string
+
+	// From is the header sender of the notification.
+	// Defaults to "MAILER-DAEMON@" + ReportingMTA.
+	From string
+
+	// Date is the notification date. Defaults to the current time.
+	Date time.Time
+}
+
+// Bounce is a generated notification ready to be relayed.
+type Bounce struct {
+	// Envelope has a null reverse-path and the original sender as recipient,
+	// so that the notification itself can never bounce.
+	Envelope msgstore.Envelope
+
+	// Message is the complete RFC 5322 notification message.
+	Message []byte
+}
+
+// Build constructs an RFC 3464 multipart/report notification for a message
+// received with original. header is the header section of the original
+// message (see HeaderSection) and is returned to the sender as
+// text/rfc822-headers.
+//
+// Returns ErrNullSender if original has a null reverse-path: notifications
+// are never sent for notifications. Returns ErrNoRecipients if failures is empty.
+func Build(original msgstore.Envelope, failures []Failure, header []byte, opts Options) (*Bounce, error) {
+	if original.From == "" {
+		return nil, errors.ErrNullSender
+	}
+	if len(failures) == 0 {
+		return nil, errors.ErrNoRecipients
+	}
+	if opts.ReportingMTA == "" {
+		return nil, fmt.Errorf("dsn: ReportingMTA is required")
+	}
+	if opts.From == "" {
+		opts.From = "MAILER-DAEMON@" + opts.ReportingMTA
+	}
+	if opts.Date.IsZero() {
+		opts.Date = time.Now()
+	}
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+
+	if err := writeHumanPart(mw, failures, opts); err != nil {
+		return nil, err
+	}
+	if err := writeStatusPart(mw, original, failures, opts); err != nil {
+		return nil, err
+	}
+	if err := writeHeadersPart(mw, header); err != nil {
+		return nil, err
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+
+	subject := "Undelivered Mail Returned to Sender"
+	if allDelayed(failures) {
+		subject = "Delayed Mail (still being retried)"
+	}
+
+	var msg bytes.Buffer
+	writeField(&msg, "From", "Mail Delivery System <"+opts.From+">")
+	writeField(&msg, "To", "<"+original.From+">")
+	writeField(&msg, "Subject", subject)
+	writeField(&msg, "Date", opts.Date.Format(time.RFC1123Z))
+	writeField(&msg, "Message-ID", "<"+randomID()+"@"+opts.ReportingMTA+">")
+	writeField(&msg, "Auto-Submitted", "auto-replied")
+	writeField(&msg, "MIME-Version", "1.0")
+	writeField(&msg, "Content-Type", `multipart/report; report-type=delivery-status; boundary="`+mw.Boundary()+`"`)
+	msg.WriteString("\r\n")
+	msg.Write(body.Bytes())
+
+	return &Bounce{
+		Envelope: msgstore.Envelope{
+			From:         "",
+			Recipients:   []string{original.From},
+			ReceivedTime: opts.Date,
+		},
+		Message: msg.Bytes(),
+	}, nil
+}
+
+// HeaderSection returns the header section of a raw message, including the
+// terminating blank line. If the message has no body, it is returned whole.
+func HeaderSection(message []byte) []byte {
+	if i := bytes.Index(message, []byte("\r\n\r\n")); i >= 0 {
+		return message[:i+4]
+	}
+	if i := bytes.Index(message, []byte("\n\n")); i >= 0 {
+		return message[:i+2]
+	}
+	return message
+}
+
+// writeHumanPart writes the text/plain explanation for the sender.
+func writeHumanPart(mw *multipart.Writer, failures []Failure, opts Options) error {
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", "text/plain; charset=utf-8")
+	h.Set("Content-Transfer-Encoding", "8bit")
+	w, err := mw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	b.WriteString("This is the mail system at host " + opts.ReportingMTA + ".\r\n\r\n")
+	if allDelayed(failures) {
+		b.WriteString("Your message has not yet been delivered to the following recipients.\r\n")
+		b.WriteString("Delivery will be retried; no action is required.\r\n\r\n")
+	} else {
+		b.WriteString("Your message could not be delivered to the following recipients.\r\n\r\n")
+	}
+	for _, f := range failures {
+		reason := sanitize(f.Reason)
+		if reason == "" {
+			reason = "delivery failed"
+		}
+		b.WriteString("<" + sanitize(f.Recipient) + ">: " + reason + "\r\n")
+	}
+	_, err = w.Write([]byte(b.String()))
+	return err
+}
+
+// writeStatusPart writes the machine-readable message/delivery-status part.
+func writeStatusPart(mw *multipart.Writer, original msgstore.Envelope, failures []Failure, opts Options) error {
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", "message/delivery-status")
+	w, err := mw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+
+	var b bytes.Buffer
+	writeField(&b, "Reporting-MTA", "dns; "+opts.ReportingMTA)
+	if !original.ReceivedTime.IsZero() {
+		writeField(&b, "Arrival-Date", original.ReceivedTime.Format(time.RFC1123Z))
+	}
+	for _, f := range failures {
+		action := f.Action
+		if action == "" {
+			action = ActionFailed
+		}
+		status := f.Status
+		if status == "" {
+			status = "5.0.0"
+			if action == ActionDelayed {
+				status = "4.0.0"
+			}
+		}
+		b.WriteString("\r\n")
+		writeField(&b, "Final-Recipient", "rfc822; "+f.Recipient)
+		writeField(&b, "Action", action)
+		writeField(&b, "Status", status)
+		if f.DiagnosticCode != "" {
+			writeField(&b, "Diagnostic-Code", "smtp; "+f.DiagnosticCode)
+		}
+	}
+	_, err = w.Write(b.Bytes())
+	return err
+}
+
+// writeHeadersPart returns the original header section as text/rfc822-headers.
+func writeHeadersPart(mw *multipart.Writer, header []byte) error {
+	h := textproto.MIMEHeader{}
+	h.Set("Content-Type", "text/rfc822-headers")
+	w, err := mw.CreatePart(h)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(header)
+	return err
+}
+
+// writeField writes a single header field, stripping line breaks from the
+// value so caller-supplied text cannot inject additional fields.
+func writeField(b *bytes.Buffer, name, value string) {
+	b.WriteString(name + ": " + sanitize(value) + "\r\n")
+}
+
+// sanitize replaces CR and LF with spaces.
+func sanitize(s string) string {
+	return strings.NewReplacer("\r", " ", "\n", " ").Replace(s)
+}
+
+// allDelayed reports whether every failure is a delay rather than a failure.
+func allDelayed(failures []Failure) bool {
+	for _, f := range failures {
+		if f.Action != ActionDelayed {
+			return false
+		}
+	}
+	return true
+}
+
+// randomID returns a random identifier for the Message-ID header.
+func randomID() string {
+	b := make([]byte, 12)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,156 @@
+package dsn
+
+import (
+	stderrors "errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+const testMessage = "From: sender@example.com\r\n" +
+	"To: user@example.com\r\n" +
+	"Subject: hello\r\n" +
+	"\r\n" +
+	"secret body\r\n"
+
+func TestBuild(t *testing.T) {
+	envelope := msgstore.Envelope{
+		From:         "sender@example.com",
+		Recipients:   []string{"user@example.com"},
+		ReceivedTime: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	bounce, err := Build(envelope, []Failure{{
+		Recipient:      "user@example.com",
+		Status:         "5.2.2",
+		DiagnosticCode: "552 5.2.2 Mailbox full",
+		Reason:         "mailbox full",
+	}}, HeaderSection([]byte(testMessage)), Options{ReportingMTA: "mx.example.com"})
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	if bounce.Envelope.From != "" {
+		t.Errorf("bounce reverse-path = %q, want null", bounce.Envelope.From)
+	}
+	if len(bounce.Envelope.Recipients) != 1 || bounce.Envelope.Recipients[0] != "sender@example.com" {
+		t.Errorf("bounce recipients = %v, want [sender@example.com]", bounce.Envelope.Recipients)
+	}
+
+	msg, err := mail.ReadMessage(strings.NewReader(string(bounce.Message)))
+	if err != nil {
+		t.Fatalf("bounce is not a valid message: %v", err)
+	}
+	if got := msg.Header.Get("From"); got != "Mail Delivery System <MAILER-DAEMON@mx.example.com>" {
+		t.Errorf("From = %q", got)
+	}
+	if got := msg.Header.Get("Auto-Submitted"); got != "auto-replied" {
+		t.Errorf("Auto-Submitted = %q, want auto-replied", got)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("bad Content-Type: %v", err)
+	}
+	if mediaType != "multipart/report" || params["report-type"] != "delivery-status" {
+		t.Fatalf("Content-Type = %s %v", mediaType, params)
+	}
+
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	var types, bodies []string
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("NextPart failed: %v", err)
+		}
+		body, _ := io.ReadAll(part)
+		types = append(types, part.Header.Get("Content-Type"))
+		bodies = append(bodies, string(body))
+	}
+
+	wantTypes := []string{"text/plain; charset=utf-8", "message/delivery-status", "text/rfc822-headers"}
+	if strings.Join(types, "|") != strings.Join(wantTypes, "|") {
+		t.Fatalf("part types = %v, want %v", types, wantTypes)
+	}
+	if !strings.Contains(bodies[0], "<user@example.com>: mailbox full") {
+		t.Errorf("human part missing reason: %q", bodies[0])
+	}
+	for _, want := range []string{
+		"Reporting-MTA: dns; mx.example.com\r\n",
+		"Arrival-Date: Fri, 02 Jan 2026 03:04:05 +0000\r\n",
+		"Final-Recipient: rfc822; user@example.com\r\n",
+		"Action: failed\r\n",
+		"Status: 5.2.2\r\n",
+		"Diagnostic-Code: smtp; 552 5.2.2 Mailbox full\r\n",
+	} {
+		if !strings.Contains(bodies[1], want) {
+			t.Errorf("delivery-status part missing %q:\n%s", want, bodies[1])
+		}
+	}
+	if !strings.Contains(bodies[2], "Subject: hello") || strings.Contains(bodies[2], "secret body") {
+		t.Errorf("headers part should contain only the original headers: %q", bodies[2])
+	}
+}
+
+func TestBuild_Delayed(t *testing.T) {
+	envelope := msgstore.Envelope{From: "sender@example.com"}
+	bounce, err := Build(envelope, []Failure{{Recipient: "user@example.com", Action: ActionDelayed}},
+		nil, Options{ReportingMTA: "mx.example.com"})
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	msg := string(bounce.Message)
+	if !strings.Contains(msg, "Subject: Delayed Mail") || !strings.Contains(msg, "Status: 4.0.0\r\n") {
+		t.Errorf("unexpected delay notification:\n%s", msg)
+	}
+}
+
+func TestBuild_Errors(t *testing.T) {
+	failures := []Failure{{Recipient: "user@example.com"}}
+	opts := Options{ReportingMTA: "mx.example.com"}
+
+	if _, err := Build(msgstore.Envelope{}, failures, nil, opts); !stderrors.Is(err, errors.ErrNullSender) {
+		t.Errorf("expected ErrNullSender, got %v", err)
+	}
+	if _, err := Build(msgstore.Envelope{From: "a@example.com"}, nil, nil, opts); !stderrors.Is(err, errors.ErrNoRecipients) {
+		t.Errorf("expected ErrNoRecipients, got %v", err)
+	}
+	if _, err := Build(msgstore.Envelope{From: "a@example.com"}, failures, nil, Options{}); err == nil {
+		t.Error("expected error without ReportingMTA")
+	}
+}
+
+func TestBuild_NoHeaderInjection(t *testing.T) {
+	envelope := msgstore.Envelope{From: "sender@example.com\r\nBcc: victim@example.net"}
+	bounce, err := Build(envelope, []Failure{{Recipient: "user@example.com"}}, nil, Options{ReportingMTA: "mx.example.com"})
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if strings.Contains(string(bounce.Message), "\r\nBcc:") {
+		t.Error("line break in envelope sender injected a header field")
+	}
+}
+
+func TestHeaderSection(t *testing.T) {
+	tests := []struct {
+		message, want string
+	}{
+		{"A: 1\r\nB: 2\r\n\r\nbody", "A: 1\r\nB: 2\r\n\r\n"},
+		{"A: 1\n\nbody", "A: 1\n\n"},
+		{"A: 1\r\n", "A: 1\r\n"},
+	}
+	for _, tt := range tests {
+		if got := string(HeaderSection([]byte(tt.message))); got != tt.want {
+			t.Errorf("HeaderSection(%q) = %q, want %q", tt.message, got, tt.want)
+		}
+	}
+}
@@ -4,8 +4,13 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"errors"
 	"fmt"
 	"io"
+	"mime"
+	"net/mail"
+	"strings"
+	"sync"
 
 	"github.com/infodancer/auth"
 	"golang.org/x/crypto/nacl/box"
@@ -31,16 +36,92 @@ type EncryptingDeliveryAgent struct {
 
 	// keyProvider provides recipient public keys.
 	keyProvider auth.KeyProvider
+
+	// workers bounds how many recipients' copies are encrypted and
+	// delivered at once.
+	workers int
+
+	// passthroughEncrypted stores messages that are already end-to-end
+	// encrypted as they are.
+	passthroughEncrypted bool
+
+	// streaming encrypts while reading the message instead of buffering
+	// it.
+	streaming bool
+
+	// marker prepends an EncryptionMarker to encrypted copies.
+	marker bool
+
+	// pins, if set, holds the key fingerprints recipients are pinned to;
+	// mismatches are recorded with pinAudit, if set.
+	pins     KeyPinStore
+	pinAudit AuditLogger
+}
+
+// EncryptingOption configures optional EncryptingDeliveryAgent behavior.
+type EncryptingOption func(*EncryptingDeliveryAgent)
+
+// defaultEncryptionWorkers is how many recipients' copies are encrypted
+// and delivered concurrently unless configured with WithEncryptionWorkers.
+const defaultEncryptionWorkers = 4
+
+// WithEncryptionWorkers sets how many recipients' copies of a message are
+// encrypted and delivered concurrently. The underlying DeliveryAgent must
+// be safe for concurrent use. Defaults to 4; 1 delivers serially.
+func WithEncryptionWorkers(n int) EncryptingOption {
+	return func(e *EncryptingDeliveryAgent) {
+		if n > 0 {
+			e.workers = n
+		}
+	}
+}
+
+// WithPassthroughEncrypted stores messages that already carry end-to-end
+// encryption (PGP/MIME, or S/MIME enveloped data) as they are, instead of
+// encrypting them a second time. Such messages are delivered once to all
+// recipients with no Envelope.Encryption, since msgstore did not encrypt
+// them.
+func WithPassthroughEncrypted() EncryptingOption {
+	return func(e *EncryptingDeliveryAgent) {
+		e.passthroughEncrypted = true
+	}
+}
+
+// WithStreamingEncryption makes Deliver stream the message instead of
+// reading it into memory first. The plaintext copy and every recipient's
+// encrypted copy are delivered concurrently as the message is read, each
+// through a pipe, and encrypted copies use StreamEncryptionAlgorithm so
+// they can be encrypted frame by frame. WithEncryptionWorkers does not
+// apply, since every copy must consume the message at once.
+func WithStreamingEncryption() EncryptingOption {
+	return func(e *EncryptingDeliveryAgent) {
+		e.streaming = true
+	}
+}
+
+// WithEncryptionMarker prepends an EncryptionMarker header block, naming
+// the algorithm and the recipient key's fingerprint, to every encrypted
+// copy, so stored ciphertext can be recognised without the envelope.
+// Readers strip it with ReadEncryptionMarker before decrypting.
+func WithEncryptionMarker() EncryptingOption {
+	return func(e *EncryptingDeliveryAgent) {
+		e.marker = true
+	}
 }
 
 // NewEncryptingDeliveryAgent creates a new encrypting delivery agent.
 // underlying is the delivery agent to wrap.
 // keyProvider is used to look up recipient public keys.
-func NewEncryptingDeliveryAgent(underlying DeliveryAgent, keyProvider auth.KeyProvider) *EncryptingDeliveryAgent {
-	return &EncryptingDeliveryAgent{
+func NewEncryptingDeliveryAgent(underlying DeliveryAgent, keyProvider auth.KeyProvider, opts ...EncryptingOption) *EncryptingDeliveryAgent {
+	e := &EncryptingDeliveryAgent{
 		underlying:  underlying,
 		keyProvider: keyProvider,
+		workers:     defaultEncryptionWorkers,
+	}
+	for _, opt := range opts {
+		opt(e)
 	}
+	return e
 }
 
 // Deliver encrypts the message for each recipient and delivers it.
@@ -48,77 +129,129 @@ func NewEncryptingDeliveryAgent(underlying DeliveryAgent, keyProvider auth.KeyPr
 // If a recipient does not have encryption enabled, the message is delivered as plaintext.
 // Note: This implementation delivers a single encrypted copy. For per-recipient encryption
 // with different keys, the envelope is modified to contain a single recipient per delivery.
+// Encrypted copies are prepared and delivered concurrently (see WithEncryptionWorkers).
+// A failed delivery does not stop the others; all failures are returned joined.
 func (e *EncryptingDeliveryAgent) Deliver(ctx context.Context, envelope Envelope, message io.Reader) error {
+	if e.streaming {
+		return e.deliverStreaming(ctx, envelope, message)
+	}
+
 	// Read the full message content
 	messageData, err := io.ReadAll(message)
 	if err != nil {
 		return fmt.Errorf("read message: %w", err)
 	}
 
-	// Group recipients by encryption status
-	var encryptedRecipients []string
-	var plaintextRecipients []string
+	if e.passthroughEncrypted && isEndToEndEncrypted(messageData) {
+		envelope.Encryption = nil
+		return e.underlying.Deliver(ctx, envelope, bytes.NewReader(messageData))
+	}
+
+	plaintextRecipients, encryptedRecipients, recipientKeys, errs := e.groupRecipients(ctx, envelope.Recipients)
+
+	// Deliver plaintext messages
+	if len(plaintextRecipients) > 0 {
+		plaintextEnvelope := envelope
+		plaintextEnvelope.Recipients = plaintextRecipients
+		plaintextEnvelope.Encryption = nil
+
+		if err := e.underlying.Deliver(ctx, plaintextEnvelope, bytes.NewReader(messageData)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	// Deliver encrypted messages (one per recipient with unique ephemeral key)
+	errs = append(errs, e.deliverEncrypted(ctx, envelope, messageData, encryptedRecipients, recipientKeys)...)
+	return errors.Join(errs...)
+}
 
-	recipientKeys := make(map[string][]byte)
+// groupRecipients splits recipients into those receiving plaintext and
+// those with encryption enabled, returning the latter's public keys.
+// Recipients whose status or key cannot be looked up receive plaintext,
+// unless they are pinned. Recipients whose key fails the pin check (see
+// WithKeyPinning) are left out of both, with an error each.
+func (e *EncryptingDeliveryAgent) groupRecipients(ctx context.Context, recipients []string) (plaintextRecipients, encryptedRecipients []string, recipientKeys map[string][]byte, errs []error) {
+	recipientKeys = make(map[string][]byte)
 
-	for _, recipient := range envelope.Recipients {
+	for _, recipient := range recipients {
 		// Parse subaddress and extract the base username for key lookup
 		parsed := ParseRecipient(recipient)
 		username := extractUsername(parsed.Address)
 
-		hasEncryption, err := e.keyProvider.HasEncryption(ctx, username)
+		pubKey, err := resolveKey(ctx, e.keyProvider, username)
 		if err != nil {
-			// If we can't determine encryption status, treat as plaintext
-			plaintextRecipients = append(plaintextRecipients, recipient)
-			continue
+			pubKey = nil
 		}
-
-		if hasEncryption {
-			pubKey, err := e.keyProvider.GetPublicKey(ctx, username)
-			if err != nil {
-				// If we can't get the key, treat as plaintext
-				plaintextRecipients = append(plaintextRecipients, recipient)
+		if e.pins != nil {
+			if err := e.checkKeyPin(ctx, recipient, username, pubKey, err); err != nil {
+				errs = append(errs, err)
 				continue
 			}
-			encryptedRecipients = append(encryptedRecipients, recipient)
-			recipientKeys[recipient] = pubKey
-		} else {
+		}
+		if pubKey == nil {
+			// Without encryption, or if the status or key cannot be
+			// looked up, the recipient gets plaintext
 			plaintextRecipients = append(plaintextRecipients, recipient)
+			continue
 		}
+		encryptedRecipients = append(encryptedRecipients, recipient)
+		recipientKeys[recipient] = pubKey
 	}
+	return plaintextRecipients, encryptedRecipients, recipientKeys, errs
+}
 
-	// Deliver plaintext messages
-	if len(plaintextRecipients) > 0 {
-		plaintextEnvelope := envelope
-		plaintextEnvelope.Recipients = plaintextRecipients
-		plaintextEnvelope.Encryption = nil
-
-		if err := e.underlying.Deliver(ctx, plaintextEnvelope, bytes.NewReader(messageData)); err != nil {
-			return err
-		}
+// deliverEncrypted encrypts and delivers a copy of messageData to each of
+// recipients, using up to e.workers goroutines. A failure for one recipient
+// does not stop the others; the errors are returned in recipient order.
+func (e *EncryptingDeliveryAgent) deliverEncrypted(ctx context.Context, envelope Envelope, messageData []byte, recipients []string, keys map[string][]byte) []error {
+	results := make([]error, len(recipients))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range min(e.workers, len(recipients)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = e.deliverEncryptedTo(ctx, envelope, messageData, recipients[i], keys[recipients[i]])
+			}
+		}()
 	}
+	for i := range recipients {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
 
-	// Deliver encrypted messages (one per recipient with unique ephemeral key)
-	for _, recipient := range encryptedRecipients {
-		pubKey := recipientKeys[recipient]
-
-		encryptedData, err := encryptMessage(messageData, pubKey)
+	var errs []error
+	for _, err := range results {
 		if err != nil {
-			return fmt.Errorf("encrypt for %s: %w", recipient, err)
+			errs = append(errs, err)
 		}
+	}
+	return errs
+}
 
-		encEnvelope := envelope
-		encEnvelope.Recipients = []string{recipient}
-		encEnvelope.Encryption = &EncryptionInfo{
-			Algorithm: EncryptionAlgorithm,
-			Encrypted: true,
-		}
+// deliverEncryptedTo encrypts messageData with pubKey and delivers it to
+// recipient alone.
+func (e *EncryptingDeliveryAgent) deliverEncryptedTo(ctx context.Context, envelope Envelope, messageData []byte, recipient string, pubKey []byte) error {
+	encryptedData, err := encryptMessage(messageData, pubKey)
+	if err != nil {
+		return fmt.Errorf("encrypt for %s: %w", recipient, err)
+	}
+	if e.marker {
+		encryptedData = append([]byte(newEncryptionMarker(EncryptionAlgorithm, pubKey).String()), encryptedData...)
+	}
 
-		if err := e.underlying.Deliver(ctx, encEnvelope, bytes.NewReader(encryptedData)); err != nil {
-			return err
-		}
+	encEnvelope := envelope
+	encEnvelope.Recipients = []string{recipient}
+	encEnvelope.Encryption = &EncryptionInfo{
+		Algorithm: EncryptionAlgorithm,
+		Encrypted: true,
 	}
 
+	if err := e.underlying.Deliver(ctx, encEnvelope, bytes.NewReader(encryptedData)); err != nil {
+		return fmt.Errorf("deliver to %s: %w", recipient, err)
+	}
 	return nil
 }
 
@@ -191,6 +324,31 @@ func DecryptMessage(encryptedData []byte, privateKey []byte) ([]byte, error) {
 	return plaintext, nil
 }
 
+// isEndToEndEncrypted reports whether a message's top-level Content-Type
+// marks it as encrypted by its sender: multipart/encrypted (PGP/MIME, RFC
+// 3156) or S/MIME enveloped data (RFC 8551).
+func isEndToEndEncrypted(message []byte) bool {
+	msg, err := mail.ReadMessage(bytes.NewReader(message))
+	if err != nil {
+		return false
+	}
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	switch mediaType {
+	case "multipart/encrypted":
+		return true
+	case "application/pkcs7-mime", "application/x-pkcs7-mime":
+		switch strings.ToLower(params["smime-type"]) {
+		case "signed-data", "certs-only", "compressed-data":
+			return false
+		}
+		return true
+	}
+	return false
+}
+
 // extractUsername extracts the local part from an email address.
 // Returns the full address if no @ is found.
 func extractUsername(email string) string {
@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"errors"
+	"fmt"
 	"io"
+	"sync"
 	"testing"
 
 	"golang.org/x/crypto/nacl/box"
@@ -12,9 +15,12 @@ import (
 	autherrors "github.com/infodancer/auth/errors"
 )
 
-// mockDeliveryAgent records deliveries for testing.
+// mockDeliveryAgent records deliveries for testing. fail maps recipients
+// to the error their delivery returns.
 type mockDeliveryAgent struct {
+	mu         sync.Mutex
 	deliveries []mockDelivery
+	fail       map[string]error
 }
 
 type mockDelivery struct {
@@ -27,6 +33,11 @@ func (m *mockDeliveryAgent) Deliver(ctx context.Context, envelope Envelope, mess
 	if err != nil {
 		return err
 	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.fail[envelope.Recipients[0]]; err != nil {
+		return err
+	}
 	m.deliveries = append(m.deliveries, mockDelivery{
 		envelope: envelope,
 		message:  data,
@@ -334,3 +345,83 @@ func TestExtractUsername(t *testing.T) {
 		})
 	}
 }
+
+func TestEncryptingDeliveryAgent_PassthroughEncrypted(t *testing.T) {
+	pub, _ := generateTestKeyPair()
+	keyProvider := &mockKeyProvider{keys: map[string][]byte{"alice": pub}}
+	envelope := Envelope{From: "sender@example.com", Recipients: []string{"alice@example.com", "bob@example.com"}}
+	pgpMessage := []byte("Content-Type: multipart/encrypted; protocol=\"application/pgp-encrypted\"; boundary=b\r\n\r\n--b\r\n\r\nVersion: 1\r\n--b--\r\n")
+
+	underlying := &mockDeliveryAgent{}
+	agent := NewEncryptingDeliveryAgent(underlying, keyProvider, WithPassthroughEncrypted())
+	if err := agent.Deliver(context.Background(), envelope, bytes.NewReader(pgpMessage)); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	if len(underlying.deliveries) != 1 {
+		t.Fatalf("expected 1 delivery, got %d", len(underlying.deliveries))
+	}
+	d := underlying.deliveries[0]
+	if !bytes.Equal(d.message, pgpMessage) || d.envelope.Encryption != nil || len(d.envelope.Recipients) != 2 {
+		t.Errorf("PGP/MIME message was not stored as is: %+v", d.envelope)
+	}
+
+	// Without the option the message is encrypted again.
+	underlying = &mockDeliveryAgent{}
+	agent = NewEncryptingDeliveryAgent(underlying, keyProvider)
+	if err := agent.Deliver(context.Background(), envelope, bytes.NewReader(pgpMessage)); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	if len(underlying.deliveries) != 2 {
+		t.Errorf("expected plaintext and encrypted deliveries, got %d", len(underlying.deliveries))
+	}
+}
+
+func TestIsEndToEndEncrypted(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{`multipart/encrypted; protocol="application/pgp-encrypted"; boundary=x`, true},
+		{`application/pkcs7-mime; smime-type=enveloped-data; name=smime.p7m`, true},
+		{`application/x-pkcs7-mime; name=smime.p7m`, true},
+		{`application/pkcs7-mime; smime-type=signed-data`, false},
+		{`multipart/signed; protocol="application/pgp-signature"; boundary=x`, false},
+		{`text/plain; charset=utf-8`, false},
+	}
+	for _, tt := range tests {
+		message := []byte("Content-Type: " + tt.contentType + "\r\n\r\nbody\r\n")
+		if got := isEndToEndEncrypted(message); got != tt.want {
+			t.Errorf("isEndToEndEncrypted(%q) = %v, want %v", tt.contentType, got, tt.want)
+		}
+	}
+}
+
+func TestEncryptingDeliveryAgent_ParallelAggregatesErrors(t *testing.T) {
+	keys := make(map[string][]byte)
+	var recipients []string
+	for i := range 20 {
+		pub, _ := generateTestKeyPair()
+		user := fmt.Sprintf("user%d", i)
+		keys[user] = pub
+		recipients = append(recipients, user+"@example.com")
+	}
+	full := errors.New("mailbox full")
+	underlying := &mockDeliveryAgent{fail: map[string]error{
+		"user3@example.com":  full,
+		"user11@example.com": full,
+	}}
+	agent := NewEncryptingDeliveryAgent(underlying, &mockKeyProvider{keys: keys}, WithEncryptionWorkers(8))
+
+	err := agent.Deliver(context.Background(), Envelope{Recipients: recipients}, bytes.NewReader([]byte("secret")))
+	if !errors.Is(err, full) {
+		t.Fatalf("Deliver error = %v, want the recipients' failures", err)
+	}
+	for _, failed := range []string{"user3@example.com", "user11@example.com"} {
+		if !bytes.Contains([]byte(err.Error()), []byte(failed)) {
+			t.Errorf("error %q does not name %s", err, failed)
+		}
+	}
+	if len(underlying.deliveries) != 18 {
+		t.Errorf("expected the other 18 recipients to be delivered, got %d", len(underlying.deliveries))
+	}
+}
@@ -0,0 +1,113 @@
+package msgstore
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	// EncryptionMarkerHeader names the header block that WithEncryptionMarker
+	// prepends to encrypted messages.
+	EncryptionMarkerHeader = "X-Msgstore-Encryption"
+
+	// encryptionMarkerVersion is the version of the marker format written.
+	encryptionMarkerVersion = 1
+
+	// maxMarkerSize bounds the marker line read by ReadEncryptionMarker.
+	maxMarkerSize = 1024
+)
+
+// EncryptionMarker identifies a stored blob as ciphertext without
+// out-of-band metadata, for DecryptingStore, fsck and migration tools. It
+// is stored as a one-line header block ahead of the ciphertext:
+//
+//	X-Msgstore-Encryption: version=1; algorithm=x25519-xsalsa20-poly1305; fingerprint=sha256:...
+//	<blank line>
+//	<ciphertext>
+type EncryptionMarker struct {
+	Version     int
+	Algorithm   string
+	Fingerprint string // KeyFingerprint of the recipient key
+}
+
+// KeyFingerprint returns the fingerprint of a public key as recorded in
+// encryption markers: "sha256:" followed by the hex SHA-256 of the key.
+func KeyFingerprint(publicKey []byte) string {
+	sum := sha256.Sum256(publicKey)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+// newEncryptionMarker returns the marker for a message encrypted with
+// algorithm to publicKey.
+func newEncryptionMarker(algorithm string, publicKey []byte) EncryptionMarker {
+	return EncryptionMarker{Version: encryptionMarkerVersion, Algorithm: algorithm, Fingerprint: KeyFingerprint(publicKey)}
+}
+
+// String returns the marker's header block, including the blank line that
+// ends it.
+func (m EncryptionMarker) String() string {
+	return fmt.Sprintf("%s: version=%d; algorithm=%s; fingerprint=%s\r\n\r\n", EncryptionMarkerHeader, m.Version, m.Algorithm, m.Fingerprint)
+}
+
+// ReadEncryptionMarker reads the encryption marker at the start of r. If r
+// does not start with one, ok is false and nothing is consumed; otherwise
+// r is left at the start of the ciphertext.
+func ReadEncryptionMarker(r *bufio.Reader) (m EncryptionMarker, ok bool, err error) {
+	prefix := EncryptionMarkerHeader + ":"
+	head, err := r.Peek(len(prefix))
+	if err != nil || !strings.EqualFold(string(head), prefix) {
+		if err == io.EOF || err == bufio.ErrBufferFull {
+			err = nil
+		}
+		return EncryptionMarker{}, false, err
+	}
+
+	line, err := readMarkerLine(r)
+	if err != nil {
+		return EncryptionMarker{}, false, err
+	}
+	if blank, err := readMarkerLine(r); err != nil || blank != "" {
+		return EncryptionMarker{}, false, fmt.Errorf("encryption marker: missing blank line")
+	}
+	for _, param := range strings.Split(line[len(prefix):], ";") {
+		key, value, _ := strings.Cut(strings.TrimSpace(param), "=")
+		switch strings.ToLower(key) {
+		case "version":
+			if m.Version, err = strconv.Atoi(value); err != nil {
+				return EncryptionMarker{}, false, fmt.Errorf("encryption marker: invalid version %q", value)
+			}
+		case "algorithm":
+			m.Algorithm = value
+		case "fingerprint":
+			m.Fingerprint = value
+		}
+	}
+	if m.Version < 1 || m.Algorithm == "" {
+		return EncryptionMarker{}, false, fmt.Errorf("encryption marker: incomplete %q", line)
+	}
+	return m, true, nil
+}
+
+// readMarkerLine reads one CRLF- or LF-terminated line of at most
+// maxMarkerSize bytes, without its terminator.
+func readMarkerLine(r *bufio.Reader) (string, error) {
+	var line []byte
+	for {
+		b, err := r.ReadByte()
+		if err != nil {
+			return "", fmt.Errorf("encryption marker: %w", io.ErrUnexpectedEOF)
+		}
+		if b == '\n' {
+			return strings.TrimSuffix(string(line), "\r"), nil
+		}
+		if len(line) == maxMarkerSize {
+			return "", fmt.Errorf("encryption marker: line too long")
+		}
+		line = append(line, b)
+	}
+}
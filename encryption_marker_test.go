@@ -0,0 +1,82 @@
+package msgstore
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestEncryptingDeliveryAgent_EncryptionMarker(t *testing.T) {
+	pub, priv := generateTestKeyPair()
+	keyProvider := &mockKeyProvider{keys: map[string][]byte{"alice": pub}}
+	message := []byte("Subject: marked\r\n\r\nbody\r\n")
+
+	for _, streaming := range []bool{false, true} {
+		opts := []EncryptingOption{WithEncryptionMarker()}
+		want := EncryptionAlgorithm
+		if streaming {
+			opts = append(opts, WithStreamingEncryption())
+			want = StreamEncryptionAlgorithm
+		}
+		underlying := &mockDeliveryAgent{}
+		agent := NewEncryptingDeliveryAgent(underlying, keyProvider, opts...)
+		if err := agent.Deliver(context.Background(), Envelope{Recipients: []string{"alice@example.com"}}, bytes.NewReader(message)); err != nil {
+			t.Fatalf("Deliver: %v", err)
+		}
+		if len(underlying.deliveries) != 1 {
+			t.Fatalf("expected 1 delivery, got %d", len(underlying.deliveries))
+		}
+
+		r := bufio.NewReader(bytes.NewReader(underlying.deliveries[0].message))
+		marker, ok, err := ReadEncryptionMarker(r)
+		if err != nil || !ok {
+			t.Fatalf("ReadEncryptionMarker = %v, %v", ok, err)
+		}
+		if marker.Version != 1 || marker.Algorithm != want || marker.Fingerprint != KeyFingerprint(pub) {
+			t.Errorf("marker = %+v", marker)
+		}
+
+		var plaintext []byte
+		if streaming {
+			dr, err := DecryptStream(r, priv)
+			if err != nil {
+				t.Fatalf("DecryptStream: %v", err)
+			}
+			plaintext, err = io.ReadAll(dr)
+			if err != nil {
+				t.Fatalf("reading plaintext: %v", err)
+			}
+		} else {
+			ciphertext, _ := io.ReadAll(r)
+			if plaintext, err = DecryptMessage(ciphertext, priv); err != nil {
+				t.Fatalf("DecryptMessage: %v", err)
+			}
+		}
+		if !bytes.Equal(plaintext, message) {
+			t.Errorf("streaming=%v: plaintext mismatch", streaming)
+		}
+	}
+}
+
+func TestReadEncryptionMarker(t *testing.T) {
+	r := bufio.NewReader(strings.NewReader("Subject: plain\r\n\r\n"))
+	if _, ok, err := ReadEncryptionMarker(r); ok || err != nil {
+		t.Fatalf("plain message: ok=%v err=%v", ok, err)
+	}
+	if rest, _ := io.ReadAll(r); string(rest) != "Subject: plain\r\n\r\n" {
+		t.Errorf("plain message was consumed: %q left", rest)
+	}
+
+	for _, bad := range []string{
+		"X-Msgstore-Encryption: version=1; algorithm=x\r\nmore: headers\r\n\r\n",
+		"X-Msgstore-Encryption: algorithm=x\r\n\r\n",
+		"X-Msgstore-Encryption: version=1",
+	} {
+		if _, _, err := ReadEncryptionMarker(bufio.NewReader(strings.NewReader(bad))); err == nil {
+			t.Errorf("ReadEncryptionMarker(%q) accepted a malformed marker", bad)
+		}
+	}
+}
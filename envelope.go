@@ -0,0 +1,117 @@
+package msgstore
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/infodancer/msgstore/errors"
+)
+
+// envelopeFormatVersion is the version written by MarshalEnvelope.
+// UnmarshalEnvelope rejects versions it does not understand.
+const envelopeFormatVersion = 1
+
+// envelopeRecord is the serialized form of an Envelope. Field names are part
+// of the on-disk format shared by the retry spool, deferred Sieve actions and
+// sidecar metadata; do not rename them.
+type envelopeRecord struct {
+	Version             int                    `json:"version"`
+	From                string                 `json:"from"`
+	Recipients          []string               `json:"recipients"`
+	ReceivedTime        string                 `json:"received_time,omitempty"`
+	ClientIP            string                 `json:"client_ip,omitempty"`
+	ClientHostname      string                 `json:"client_hostname,omitempty"`
+	AuthenticatedSender string                 `json:"authenticated_sender,omitempty"`
+	TLS                 *TLSInfo               `json:"tls,omitempty"`
+	Authentication      *AuthenticationResults `json:"authentication,omitempty"`
+	Encryption          *EncryptionInfo        `json:"encryption,omitempty"`
+	SpamResult          *SpamResult            `json:"spam_result,omitempty"`
+	IdempotencyKey      string                 `json:"idempotency_key,omitempty"`
+}
+
+// MarshalEnvelope serializes an envelope in the canonical format used
+// wherever the original MAIL FROM and RCPT TO must outlive the SMTP
+// transaction. The output is a single line of JSON; the empty reverse-path
+// of a bounce is preserved as "from": "".
+func MarshalEnvelope(envelope Envelope) ([]byte, error) {
+	rec := envelopeRecord{
+		Version:             envelopeFormatVersion,
+		From:                envelope.From,
+		Recipients:          envelope.Recipients,
+		ClientHostname:      envelope.ClientHostname,
+		AuthenticatedSender: envelope.AuthenticatedSender,
+		TLS:                 envelope.TLS,
+		Authentication:      envelope.Authentication,
+		Encryption:          envelope.Encryption,
+		SpamResult:          envelope.SpamResult,
+		IdempotencyKey:      envelope.IdempotencyKey,
+	}
+	if rec.Recipients == nil {
+		rec.Recipients = []string{}
+	}
+	if !envelope.ReceivedTime.IsZero() {
+		rec.ReceivedTime = envelope.ReceivedTime.UTC().Format(time.RFC3339Nano)
+	}
+	if envelope.ClientIP != nil {
+		rec.ClientIP = envelope.ClientIP.String()
+	}
+	return json.Marshal(rec)
+}
+
+// MarshalJSON implements json.Marshaler with the MarshalEnvelope format, so
+// envelopes embedded in other JSON documents (webhook payloads, API
+// responses) share the on-disk representation.
+func (e Envelope) MarshalJSON() ([]byte, error) {
+	return MarshalEnvelope(e)
+}
+
+// UnmarshalJSON implements json.Unmarshaler with UnmarshalEnvelope.
+func (e *Envelope) UnmarshalJSON(data []byte) error {
+	envelope, err := UnmarshalEnvelope(data)
+	if err != nil {
+		return err
+	}
+	*e = envelope
+	return nil
+}
+
+// UnmarshalEnvelope parses an envelope written by MarshalEnvelope.
+// Returns ErrInvalidEnvelope if data is malformed or of an unknown version.
+func UnmarshalEnvelope(data []byte) (Envelope, error) {
+	var rec envelopeRecord
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return Envelope{}, fmt.Errorf("%w: %w", errors.ErrInvalidEnvelope, err)
+	}
+	if rec.Version != envelopeFormatVersion {
+		return Envelope{}, fmt.Errorf("%w: unsupported version %d", errors.ErrInvalidEnvelope, rec.Version)
+	}
+
+	envelope := Envelope{
+		From:                rec.From,
+		Recipients:          rec.Recipients,
+		ClientHostname:      rec.ClientHostname,
+		AuthenticatedSender: rec.AuthenticatedSender,
+		TLS:                 rec.TLS,
+		Authentication:      rec.Authentication,
+		Encryption:          rec.Encryption,
+		SpamResult:          rec.SpamResult,
+		IdempotencyKey:      rec.IdempotencyKey,
+	}
+	if rec.ReceivedTime != "" {
+		t, err := time.Parse(time.RFC3339Nano, rec.ReceivedTime)
+		if err != nil {
+			return Envelope{}, fmt.Errorf("%w: received_time: %w", errors.ErrInvalidEnvelope, err)
+		}
+		envelope.ReceivedTime = t
+	}
+	if rec.ClientIP != "" {
+		ip := net.ParseIP(rec.ClientIP)
+		if ip == nil {
+			return Envelope{}, fmt.Errorf("%w: client_ip %q", errors.ErrInvalidEnvelope, rec.ClientIP)
+		}
+		envelope.ClientIP = ip
+	}
+	return envelope, nil
+}
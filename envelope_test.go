@@ -0,0 +1,120 @@
+package msgstore
+
+import (
+	"encoding/json"
+	stderrors "errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/infodancer/msgstore/errors"
+)
+
+func TestMarshalEnvelope_RoundTrip(t *testing.T) {
+	envelopes := []Envelope{
+		{
+			From:                "sender@example.com",
+			Recipients:          []string{"a@example.com", "b+lists@example.com"},
+			ReceivedTime:        time.Date(2026, 3, 4, 5, 6, 7, 890, time.UTC),
+			ClientIP:            net.ParseIP("2001:db8::1"),
+			ClientHostname:      "mail.example.net",
+			AuthenticatedSender: "sender",
+			TLS:                 &TLSInfo{Version: "TLS 1.3", Cipher: "TLS_AES_128_GCM_SHA256"},
+			Authentication: &AuthenticationResults{
+				SPF: "pass", DKIM: "pass", DKIMDomains: []string{"example.com"}, DMARC: "pass",
+			},
+			Encryption:     &EncryptionInfo{Algorithm: "x25519-xsalsa20-poly1305", Encrypted: true},
+			SpamResult:     &SpamResult{Score: 7.5, Action: "flag", Checker: "rspamd"},
+			IdempotencyKey: "4Xk2p1Q9zTz3",
+		},
+		{
+			From:       "",
+			Recipients: []string{"postmaster@example.com"},
+			ClientIP:   net.ParseIP("192.0.2.1"),
+		},
+	}
+	for _, want := range envelopes {
+		data, err := MarshalEnvelope(want)
+		if err != nil {
+			t.Fatalf("MarshalEnvelope failed: %v", err)
+		}
+		got, err := UnmarshalEnvelope(data)
+		if err != nil {
+			t.Fatalf("UnmarshalEnvelope(%s) failed: %v", data, err)
+		}
+		if !got.ClientIP.Equal(want.ClientIP) {
+			t.Errorf("ClientIP = %v, want %v", got.ClientIP, want.ClientIP)
+		}
+		got.ClientIP, want.ClientIP = nil, nil
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("round trip = %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestMarshalEnvelope_Format(t *testing.T) {
+	data, err := MarshalEnvelope(Envelope{From: "", Recipients: nil})
+	if err != nil {
+		t.Fatalf("MarshalEnvelope failed: %v", err)
+	}
+	want := `{"version":1,"from":"","recipients":[]}`
+	if string(data) != want {
+		t.Errorf("MarshalEnvelope = %s, want %s", data, want)
+	}
+}
+
+func TestEnvelope_JSON(t *testing.T) {
+	type payload struct {
+		Envelope Envelope `json:"envelope"`
+	}
+	in := payload{Envelope: Envelope{
+		From:       "sender@example.com",
+		Recipients: []string{"user@example.com"},
+		Encryption: &EncryptionInfo{Algorithm: "x25519-xsalsa20-poly1305", Encrypted: true},
+		SpamResult: &SpamResult{Score: 1.5, Action: "accept", Checker: "rspamd"},
+	}}
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	want := `{"envelope":{"version":1,"from":"sender@example.com","recipients":["user@example.com"],` +
+		`"encryption":{"algorithm":"x25519-xsalsa20-poly1305","encrypted":true},` +
+		`"spam_result":{"score":1.5,"action":"accept","checker":"rspamd"}}}`
+	if string(data) != want {
+		t.Errorf("JSON = %s, want %s", data, want)
+	}
+
+	var out payload
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Errorf("round trip = %+v, want %+v", out, in)
+	}
+	if err := json.Unmarshal([]byte(`{"envelope":{"version":9}}`), &out); !stderrors.Is(err, errors.ErrInvalidEnvelope) {
+		t.Errorf("Unmarshal of unknown version = %v, want ErrInvalidEnvelope", err)
+	}
+
+	// Records written before the fields had JSON names still decode.
+	old, err := UnmarshalEnvelope([]byte(`{"version":1,"from":"","recipients":[],"encryption":{"Algorithm":"a","Encrypted":true}}`))
+	if err != nil || old.Encryption == nil || old.Encryption.Algorithm != "a" || !old.Encryption.Encrypted {
+		t.Errorf("legacy record = %+v, %v", old.Encryption, err)
+	}
+}
+
+func TestUnmarshalEnvelope_Invalid(t *testing.T) {
+	inputs := []string{
+		``,
+		`not json`,
+		`{"version":2,"from":"a@example.com","recipients":[]}`,
+		`{"from":"a@example.com","recipients":[]}`,
+		`{"version":1,"from":"","recipients":[],"received_time":"yesterday"}`,
+		`{"version":1,"from":"","recipients":[],"client_ip":"not-an-ip"}`,
+	}
+	for _, input := range inputs {
+		if _, err := UnmarshalEnvelope([]byte(input)); !stderrors.Is(err, errors.ErrInvalidEnvelope) {
+			t.Errorf("UnmarshalEnvelope(%q): expected ErrInvalidEnvelope, got %v", input, err)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package errors
+
+import (
+	"context"
+	"errors"
+)
+
+// Code is a stable, machine-readable identifier of an error condition.
+// Codes are part of the wire formats of the remote store protocols; do not
+// change their values.
+type Code string
+
+// Codes of conditions that are not store sentinels.
+const (
+	// CodeUnknown is the code of an error that carries none.
+	CodeUnknown Code = "UNKNOWN"
+
+	// CodeCanceled is the code of context.Canceled.
+	CodeCanceled Code = "CANCELED"
+
+	// CodeDeadlineExceeded is the code of context.DeadlineExceeded.
+	CodeDeadlineExceeded Code = "DEADLINE_EXCEEDED"
+)
+
+// Codes of the sentinel errors, named after them.
+const (
+	CodeMailboxNotFound        Code = "NOT_FOUND_MAILBOX"
+	CodeMailboxLocked          Code = "MAILBOX_LOCKED"
+	CodeMessageNotFound        Code = "NOT_FOUND_MESSAGE"
+	CodeMessageDeleted         Code = "DELETED_MESSAGE"
+	CodeNoRecipients           Code = "NO_RECIPIENTS"
+	CodeInvalidAddress         Code = "INVALID_ADDRESS"
+	CodeRecipientNotFound      Code = "NOT_FOUND_RECIPIENT"
+	CodeQuotaExceeded          Code = "QUOTA_EXCEEDED"
+	CodeRateLimited            Code = "RATE_LIMITED"
+	CodeNoRelay                Code = "NO_RELAY"
+	CodeNullSender             Code = "NULL_SENDER"
+	CodeInvalidEnvelope        Code = "INVALID_ENVELOPE"
+	CodeKeyPinMismatch         Code = "KEY_PIN_MISMATCH"
+	CodeAuthenticationFailed   Code = "AUTHENTICATION_FAILED"
+	CodeUserNotFound           Code = "NOT_FOUND_USER"
+	CodeStoreNotRegistered     Code = "STORE_NOT_REGISTERED"
+	CodeStoreConfigInvalid     Code = "INVALID_STORE_CONFIG"
+	CodeFolderNotFound         Code = "NOT_FOUND_FOLDER"
+	CodeFolderExists           Code = "FOLDER_EXISTS"
+	CodeInvalidFolderName      Code = "INVALID_FOLDER_NAME"
+	CodeFolderNotEmpty         Code = "FOLDER_NOT_EMPTY"
+	CodeScriptNotFound         Code = "NOT_FOUND_SCRIPT"
+	CodeScriptActive           Code = "SCRIPT_ACTIVE"
+	CodeInvalidScriptName      Code = "INVALID_SCRIPT_NAME"
+	CodeInvalidScript          Code = "INVALID_SCRIPT"
+	CodePermissionDenied       Code = "PERMISSION_DENIED"
+	CodeInvalidRights          Code = "INVALID_RIGHTS"
+	CodeInvalidMetadataEntry   Code = "INVALID_METADATA_ENTRY"
+	CodeMetadataTooLarge       Code = "METADATA_TOO_LARGE"
+	CodeInvalidAnnotationKey   Code = "INVALID_ANNOTATION_KEY"
+	CodeInvalidSyncToken       Code = "INVALID_SYNC_TOKEN"
+	CodeCannotCalculateChanges Code = "CANNOT_CALCULATE_CHANGES"
+	CodeConflict               Code = "CONFLICT"
+	CodeNotSupported           Code = "NOT_SUPPORTED"
+	CodeInvalidID              Code = "INVALID_ID"
+	CodeMaildirNotFound        Code = "NOT_FOUND_MAILDIR"
+	CodeDeliveryFailed         Code = "DELIVERY_FAILED"
+	CodeInvalidPath            Code = "INVALID_PATH"
+	CodePathTraversal          Code = "PATH_TRAVERSAL"
+	CodeInvalidFilename        Code = "INVALID_FILENAME"
+)
+
+// sentinels maps codes to the sentinel errors defined with newSentinel.
+var sentinels = make(map[Code]error)
+
+// codedError is an error with a code.
+type codedError struct {
+	code Code
+	text string
+}
+
+func (e *codedError) Error() string { return e.text }
+
+// Code returns the error's code.
+func (e *codedError) Code() Code { return e.code }
+
+// newSentinel returns a new error with code and text and registers it as
+// the sentinel of code.
+func newSentinel(code Code, text string) error {
+	err := New(code, text)
+	sentinels[code] = err
+	return err
+}
+
+// New returns an error with the given code and text, for packages that
+// define sentinel errors of their own.
+func New(code Code, text string) error {
+	return &codedError{code: code, text: text}
+}
+
+// codeWrapper attaches a code to an error.
+type codeWrapper struct {
+	err  error
+	code Code
+}
+
+func (e *codeWrapper) Error() string { return e.err.Error() }
+
+func (e *codeWrapper) Unwrap() error { return e.err }
+
+// Code returns the attached code.
+func (e *codeWrapper) Code() Code { return e.code }
+
+// WithCode returns err with code attached; it reports the same text and
+// unwraps to err. Returns nil if err is nil.
+func WithCode(err error, code Code) error {
+	if err == nil {
+		return nil
+	}
+	return &codeWrapper{err: err, code: code}
+}
+
+// CodeOf returns the code of err: that of the outermost error in its chain
+// that carries one, CodeCanceled or CodeDeadlineExceeded for context
+// errors, and CodeUnknown otherwise. Returns "" if err is nil.
+func CodeOf(err error) Code {
+	if err == nil {
+		return ""
+	}
+	var coded interface{ Code() Code }
+	switch {
+	case errors.As(err, &coded):
+		return coded.Code()
+	case errors.Is(err, context.Canceled):
+		return CodeCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return CodeDeadlineExceeded
+	}
+	return CodeUnknown
+}
+
+// Sentinel returns the error code identifies: a sentinel of this package,
+// or context.Canceled or context.DeadlineExceeded. Returns nil for other
+// codes. Remote store clients use it to turn a received code back into an
+// error that errors.Is matches.
+func Sentinel(code Code) error {
+	switch code {
+	case CodeCanceled:
+		return context.Canceled
+	case CodeDeadlineExceeded:
+		return context.DeadlineExceeded
+	}
+	return sentinels[code]
+}
@@ -0,0 +1,62 @@
+package errors
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestSentinelCodes(t *testing.T) {
+	if len(sentinels) == 0 {
+		t.Fatal("no sentinels registered")
+	}
+	for code, sentinel := range sentinels {
+		if got := CodeOf(sentinel); got != code {
+			t.Errorf("CodeOf(%v) = %s, want %s", sentinel, got, code)
+		}
+		if Sentinel(code) != sentinel {
+			t.Errorf("Sentinel(%s) = %v, want %v", code, Sentinel(code), sentinel)
+		}
+	}
+	if len(sentinels) != 40 {
+		t.Errorf("%d sentinels registered, want 40; two sentinels may share a code", len(sentinels))
+	}
+}
+
+func TestCodeOf(t *testing.T) {
+	custom := New("CUSTOM", "custom failure")
+	tests := []struct {
+		name string
+		err  error
+		want Code
+	}{
+		{"nil", nil, ""},
+		{"sentinel", ErrFolderNotFound, CodeFolderNotFound},
+		{"wrapped sentinel", fmt.Errorf("list Work: %w", ErrFolderNotFound), CodeFolderNotFound},
+		{"custom", custom, "CUSTOM"},
+		{"with code", WithCode(errors.New("disk full"), CodeQuotaExceeded), CodeQuotaExceeded},
+		{"outermost code wins", WithCode(ErrDeliveryFailed, CodeRateLimited), CodeRateLimited},
+		{"canceled", fmt.Errorf("deliver: %w", context.Canceled), CodeCanceled},
+		{"deadline", context.DeadlineExceeded, CodeDeadlineExceeded},
+		{"plain", errors.New("boom"), CodeUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := CodeOf(tt.err); got != tt.want {
+				t.Errorf("CodeOf = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	wrapped := WithCode(ErrDeliveryFailed, CodeRateLimited)
+	if !errors.Is(wrapped, ErrDeliveryFailed) || wrapped.Error() != ErrDeliveryFailed.Error() {
+		t.Errorf("WithCode does not preserve the wrapped error: %v", wrapped)
+	}
+	if WithCode(nil, CodeRateLimited) != nil {
+		t.Error("WithCode(nil) is not nil")
+	}
+	if Sentinel(CodeCanceled) != context.Canceled || Sentinel("CUSTOM") != nil {
+		t.Error("Sentinel does not map context codes or rejects unknown codes incorrectly")
+	}
+}
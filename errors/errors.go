@@ -1,75 +1,181 @@
 // Package errors provides centralized error definitions for msgstore.
+//
+// Every sentinel error carries a machine-readable Code, which CodeOf
+// extracts from an error and the errors it wraps, so the gRPC, HTTP and
+// session layers and protocol frontends can map errors to wire status
+// codes without matching error text.
 package errors
 
-import "errors"
-
 // Mailbox errors.
 var (
 	// ErrMailboxNotFound indicates the requested mailbox does not exist.
-	ErrMailboxNotFound = errors.New("mailbox not found")
+	ErrMailboxNotFound = newSentinel(CodeMailboxNotFound, "mailbox not found")
 
 	// ErrMailboxLocked indicates the mailbox is locked by another operation.
-	ErrMailboxLocked = errors.New("mailbox locked")
+	ErrMailboxLocked = newSentinel(CodeMailboxLocked, "mailbox locked")
 )
 
 // Message errors.
 var (
 	// ErrMessageNotFound indicates the requested message does not exist.
-	ErrMessageNotFound = errors.New("message not found")
+	ErrMessageNotFound = newSentinel(CodeMessageNotFound, "message not found")
 
 	// ErrMessageDeleted indicates the message has been marked for deletion.
-	ErrMessageDeleted = errors.New("message deleted")
+	ErrMessageDeleted = newSentinel(CodeMessageDeleted, "message deleted")
 )
 
 // Delivery errors.
 var (
 	// ErrNoRecipients indicates no valid recipients were provided.
-	ErrNoRecipients = errors.New("no recipients")
+	ErrNoRecipients = newSentinel(CodeNoRecipients, "no recipients")
 
 	// ErrInvalidAddress indicates an address is missing a required domain part.
 	// All addresses passed to the store must be fully-qualified (localpart@domain).
-	ErrInvalidAddress = errors.New("address must be fully-qualified (localpart@domain)")
+	ErrInvalidAddress = newSentinel(CodeInvalidAddress, "address must be fully-qualified (localpart@domain)")
 
 	// ErrRecipientNotFound indicates a recipient mailbox does not exist.
-	ErrRecipientNotFound = errors.New("recipient not found")
+	ErrRecipientNotFound = newSentinel(CodeRecipientNotFound, "recipient not found")
 
 	// ErrQuotaExceeded indicates the mailbox quota has been exceeded.
-	ErrQuotaExceeded = errors.New("quota exceeded")
+	ErrQuotaExceeded = newSentinel(CodeQuotaExceeded, "quota exceeded")
+
+	// ErrRateLimited indicates a recipient mailbox has exceeded its delivery
+	// rate. It is a temporary failure: smtpd should answer 450 so the sending
+	// server retries later.
+	ErrRateLimited = newSentinel(CodeRateLimited, "delivery rate limit exceeded")
+
+	// ErrNoRelay indicates a message must leave the store but no relay is configured.
+	ErrNoRelay = newSentinel(CodeNoRelay, "no relay configured")
+
+	// ErrNullSender indicates a bounce was suppressed because the original
+	// message had a null reverse-path.
+	ErrNullSender = newSentinel(CodeNullSender, "null reverse-path, bounce suppressed")
+
+	// ErrInvalidEnvelope indicates serialized envelope data could not be parsed.
+	ErrInvalidEnvelope = newSentinel(CodeInvalidEnvelope, "invalid envelope data")
+
+	// ErrKeyPinMismatch indicates a recipient's public key does not match
+	// the fingerprint they are pinned to, so the message was not encrypted
+	// to it. It is a temporary failure until the key or the pin is fixed.
+	ErrKeyPinMismatch = newSentinel(CodeKeyPinMismatch, "recipient key does not match pinned fingerprint")
+)
+
+// Authentication errors.
+var (
+	// ErrAuthenticationFailed indicates the username or password was rejected.
+	ErrAuthenticationFailed = newSentinel(CodeAuthenticationFailed, "authentication failed")
+
+	// ErrUserNotFound indicates the named user does not exist.
+	ErrUserNotFound = newSentinel(CodeUserNotFound, "user not found")
 )
 
 // Store errors.
 var (
 	// ErrStoreNotRegistered indicates the requested store type is not registered.
-	ErrStoreNotRegistered = errors.New("store type not registered")
+	ErrStoreNotRegistered = newSentinel(CodeStoreNotRegistered, "store type not registered")
 
 	// ErrStoreConfigInvalid indicates the store configuration is invalid.
-	ErrStoreConfigInvalid = errors.New("invalid store configuration")
+	ErrStoreConfigInvalid = newSentinel(CodeStoreConfigInvalid, "invalid store configuration")
 )
 
 // Folder errors.
 var (
 	// ErrFolderNotFound indicates the requested folder does not exist.
-	ErrFolderNotFound = errors.New("folder not found")
+	ErrFolderNotFound = newSentinel(CodeFolderNotFound, "folder not found")
 
 	// ErrFolderExists indicates the folder already exists.
-	ErrFolderExists = errors.New("folder already exists")
+	ErrFolderExists = newSentinel(CodeFolderExists, "folder already exists")
 
 	// ErrInvalidFolderName indicates the folder name contains invalid characters
 	// or conflicts with reserved names.
-	ErrInvalidFolderName = errors.New("invalid folder name")
+	ErrInvalidFolderName = newSentinel(CodeInvalidFolderName, "invalid folder name")
+
+	// ErrFolderNotEmpty indicates a folder still holds messages and was not
+	// deleted.
+	ErrFolderNotEmpty = newSentinel(CodeFolderNotEmpty, "folder not empty")
+)
+
+// Sieve errors.
+var (
+	// ErrScriptNotFound indicates the requested Sieve script does not exist.
+	ErrScriptNotFound = newSentinel(CodeScriptNotFound, "sieve script not found")
+
+	// ErrScriptActive indicates the operation is not permitted on the active script.
+	ErrScriptActive = newSentinel(CodeScriptActive, "sieve script is active")
+
+	// ErrInvalidScriptName indicates the Sieve script name contains invalid characters.
+	ErrInvalidScriptName = newSentinel(CodeInvalidScriptName, "invalid sieve script name")
+
+	// ErrInvalidScript indicates the Sieve script could not be parsed.
+	ErrInvalidScript = newSentinel(CodeInvalidScript, "invalid sieve script")
+)
+
+// Access control errors.
+var (
+	// ErrPermissionDenied indicates the user lacks the ACL rights required
+	// for the operation.
+	ErrPermissionDenied = newSentinel(CodePermissionDenied, "permission denied")
+
+	// ErrInvalidRights indicates an ACL rights string contains characters
+	// that are not RFC 4314 rights.
+	ErrInvalidRights = newSentinel(CodeInvalidRights, "invalid ACL rights")
+)
+
+// Metadata errors.
+var (
+	// ErrInvalidMetadataEntry indicates a metadata entry name is not a valid
+	// RFC 5464 entry under /private or /shared.
+	ErrInvalidMetadataEntry = newSentinel(CodeInvalidMetadataEntry, "invalid metadata entry name")
+
+	// ErrMetadataTooLarge indicates a metadata value or the number of
+	// entries exceeds the store's limits.
+	ErrMetadataTooLarge = newSentinel(CodeMetadataTooLarge, "metadata too large")
+
+	// ErrInvalidAnnotationKey indicates a message annotation key is empty,
+	// too long, or not printable ASCII.
+	ErrInvalidAnnotationKey = newSentinel(CodeInvalidAnnotationKey, "invalid annotation key")
+)
+
+// Synchronization errors.
+var (
+	// ErrInvalidSyncToken indicates a sync token was not issued by the
+	// store.
+	ErrInvalidSyncToken = newSentinel(CodeInvalidSyncToken, "invalid sync token")
+
+	// ErrCannotCalculateChanges indicates a client's state is too old to
+	// compute changes from; the client must fetch everything again.
+	ErrCannotCalculateChanges = newSentinel(CodeCannotCalculateChanges, "cannot calculate changes")
+
+	// ErrConflict indicates a conditional mutation was refused because the
+	// folder changed since the caller observed it.
+	ErrConflict = newSentinel(CodeConflict, "folder changed concurrently")
+)
+
+// Adapter errors.
+var (
+	// ErrNotSupported indicates the underlying store lacks an optional
+	// interface an operation needs.
+	ErrNotSupported = newSentinel(CodeNotSupported, "operation not supported")
+
+	// ErrInvalidID indicates an object ID was not issued by the adapter.
+	ErrInvalidID = newSentinel(CodeInvalidID, "invalid object id")
 )
 
 // Maildir errors.
 var (
 	// ErrMaildirNotFound indicates the maildir directory does not exist.
-	ErrMaildirNotFound = errors.New("maildir not found")
+	ErrMaildirNotFound = newSentinel(CodeMaildirNotFound, "maildir not found")
 
 	// ErrDeliveryFailed indicates message delivery failed.
-	ErrDeliveryFailed = errors.New("delivery failed")
+	ErrDeliveryFailed = newSentinel(CodeDeliveryFailed, "delivery failed")
 
 	// ErrInvalidPath indicates an invalid maildir path.
-	ErrInvalidPath = errors.New("invalid maildir path")
+	ErrInvalidPath = newSentinel(CodeInvalidPath, "invalid maildir path")
 
 	// ErrPathTraversal indicates an attempted path traversal attack.
-	ErrPathTraversal = errors.New("path traversal rejected")
+	ErrPathTraversal = newSentinel(CodePathTraversal, "path traversal rejected")
+
+	// ErrInvalidFilename indicates a file name that does not follow the
+	// maildir naming convention.
+	ErrInvalidFilename = newSentinel(CodeInvalidFilename, "invalid maildir file name")
 )
@@ -0,0 +1,104 @@
+package msgstore
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/infodancer/msgstore/errors"
+)
+
+// Submitter hands a message to an outbound mail transport, typically an
+// SMTP client, for delivery to addresses outside the store.
+// envelope.From is the reverse-path to use and envelope.Recipients are the
+// forward-paths to relay to.
+type Submitter interface {
+	Submit(ctx context.Context, envelope Envelope, message io.Reader) error
+}
+
+// Submit implements Submitter by calling f.
+func (f RelayFunc) Submit(ctx context.Context, envelope Envelope, message io.Reader) error {
+	return f(ctx, envelope, message)
+}
+
+// Forward resends message to the addresses in to through submitter. It is
+// the common path for Sieve redirect, .forward files and alias expansion.
+//
+// envelope is the envelope the message arrived with. Its first recipient
+// is the address doing the forwarding. The forwarded envelope keeps the
+// original reverse-path, so bounces still reach the sender, and has to as
+// its forward-paths. A Resent-Date, Resent-From, Resent-To and
+// Resent-Message-ID block (RFC 5322 section 3.6.6) is prepended to the
+// message; the message itself is streamed unchanged. The forwarding
+// address and every address in to must be a bare addr-spec; anything else,
+// such as an address carrying line breaks or angle brackets, yields
+// errors.ErrInvalidAddress before anything is submitted.
+func Forward(ctx context.Context, submitter Submitter, envelope Envelope, message io.Reader, to []string) error {
+	if len(to) == 0 || len(envelope.Recipients) == 0 {
+		return errors.ErrNoRecipients
+	}
+	resentFrom := envelope.Recipients[0]
+	for _, addr := range append([]string{resentFrom}, to...) {
+		if err := checkForwardAddress(addr); err != nil {
+			return err
+		}
+	}
+	msgID, err := resentMessageID(resentFrom)
+	if err != nil {
+		return err
+	}
+
+	var b strings.Builder
+	b.WriteString("Resent-Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("Resent-From: <" + resentFrom + ">\r\n")
+	b.WriteString("Resent-To: " + formatAddressList(to) + "\r\n")
+	b.WriteString("Resent-Message-ID: " + msgID + "\r\n")
+
+	forwarded := envelope
+	forwarded.Recipients = append([]string(nil), to...)
+	return submitter.Submit(ctx, forwarded, io.MultiReader(strings.NewReader(b.String()), message))
+}
+
+// checkForwardAddress returns an error wrapping errors.ErrInvalidAddress
+// unless addr is a bare RFC 5322 addr-spec, safe to write into a header
+// field and an SMTP forward-path.
+func checkForwardAddress(addr string) error {
+	if strings.ContainsAny(addr, "\r\n<>") {
+		return fmt.Errorf("forward address %q: %w", addr, errors.ErrInvalidAddress)
+	}
+	parsed, err := mail.ParseAddress(addr)
+	if err != nil || parsed.Name != "" || parsed.Address != addr {
+		return fmt.Errorf("forward address %q: %w", addr, errors.ErrInvalidAddress)
+	}
+	return nil
+}
+
+// formatAddressList returns addrs as a header address list.
+func formatAddressList(addrs []string) string {
+	quoted := make([]string, len(addrs))
+	for i, addr := range addrs {
+		quoted[i] = "<" + addr + ">"
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// resentMessageID returns a new message ID in the domain of address.
+func resentMessageID(address string) (string, error) {
+	domain := "localhost"
+	if i := strings.LastIndex(address, "@"); i >= 0 && i < len(address)-1 {
+		domain = address[i+1:]
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "<" + hex.EncodeToString(b) + "@" + domain + ">", nil
+}
+
+// Compile-time interface verification.
+var _ Submitter = RelayFunc(nil)
@@ -0,0 +1,87 @@
+package msgstore
+
+import (
+	"context"
+	stderrors "errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/infodancer/msgstore/errors"
+)
+
+func TestForward(t *testing.T) {
+	var gotEnvelope Envelope
+	var gotMessage string
+	submitter := RelayFunc(func(_ context.Context, envelope Envelope, message io.Reader) error {
+		data, err := io.ReadAll(message)
+		gotEnvelope, gotMessage = envelope, string(data)
+		return err
+	})
+
+	envelope := Envelope{From: "sender@example.org", Recipients: []string{"alias@example.com"}}
+	to := []string{"alice@example.net", "bob@example.net"}
+	if err := Forward(context.Background(), submitter, envelope, strings.NewReader("Subject: hi\r\n\r\nbody"), to); err != nil {
+		t.Fatalf("Forward: %v", err)
+	}
+
+	if gotEnvelope.From != "sender@example.org" || !reflect.DeepEqual(gotEnvelope.Recipients, to) {
+		t.Errorf("envelope = %+v", gotEnvelope)
+	}
+	headers, body, _ := strings.Cut(gotMessage, "Subject: hi")
+	if body != "\r\n\r\nbody" {
+		t.Errorf("message body = %q", body)
+	}
+	for _, want := range []string{
+		"Resent-Date: ",
+		"Resent-From: <alias@example.com>\r\n",
+		"Resent-To: <alice@example.net>, <bob@example.net>\r\n",
+		"@example.com>\r\n",
+	} {
+		if !strings.Contains(headers, want) {
+			t.Errorf("resent headers %q missing %q", headers, want)
+		}
+	}
+	if !strings.Contains(headers, "Resent-Message-ID: <") {
+		t.Errorf("resent headers %q missing Resent-Message-ID", headers)
+	}
+}
+
+func TestForward_InvalidAddress(t *testing.T) {
+	submitter := RelayFunc(func(context.Context, Envelope, io.Reader) error {
+		t.Fatal("submitter called")
+		return nil
+	})
+	ctx := context.Background()
+	envelope := Envelope{From: "sender@example.org", Recipients: []string{"alias@example.com"}}
+	for _, to := range []string{
+		"victim@example.net>\r\nBcc: <attacker@evil.test",
+		"victim@example.net\rRCPT TO:<attacker@evil.test>",
+		"Victim <victim@example.net>",
+		"not an address",
+	} {
+		if err := Forward(ctx, submitter, envelope, strings.NewReader(""), []string{to}); !stderrors.Is(err, errors.ErrInvalidAddress) {
+			t.Errorf("Forward to %q: error = %v, want ErrInvalidAddress", to, err)
+		}
+	}
+	bad := Envelope{Recipients: []string{"alias@example.com\r\nBcc: attacker@evil.test"}}
+	if err := Forward(ctx, submitter, bad, strings.NewReader(""), []string{"a@example.net"}); !stderrors.Is(err, errors.ErrInvalidAddress) {
+		t.Errorf("bad forwarding address: error = %v, want ErrInvalidAddress", err)
+	}
+}
+
+func TestForward_NoRecipients(t *testing.T) {
+	submitter := RelayFunc(func(context.Context, Envelope, io.Reader) error {
+		t.Fatal("submitter called")
+		return nil
+	})
+	ctx := context.Background()
+	envelope := Envelope{Recipients: []string{"alias@example.com"}}
+	if err := Forward(ctx, submitter, envelope, strings.NewReader(""), nil); !stderrors.Is(err, errors.ErrNoRecipients) {
+		t.Errorf("no targets: error = %v, want ErrNoRecipients", err)
+	}
+	if err := Forward(ctx, submitter, Envelope{}, strings.NewReader(""), []string{"a@example.net"}); !stderrors.Is(err, errors.ErrNoRecipients) {
+		t.Errorf("no forwarding address: error = %v, want ErrNoRecipients", err)
+	}
+}
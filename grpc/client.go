@@ -0,0 +1,303 @@
+package grpc
+
+import (
+	"context"
+	"io"
+	"time"
+
+	gogrpc "google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/grpc/msgstorepb"
+)
+
+// Client implements msgstore.MsgStore and msgstore.FolderStore against a
+// remote MsgStore gRPC service.
+type Client struct {
+	rpc msgstorepb.MsgStoreClient
+}
+
+// NewClient creates a Client over conn. The caller owns conn and closes it
+// when done.
+func NewClient(conn gogrpc.ClientConnInterface) *Client {
+	return &Client{rpc: msgstorepb.NewMsgStoreClient(conn)}
+}
+
+// Compile-time interface verification.
+var (
+	_ msgstore.MsgStore    = (*Client)(nil)
+	_ msgstore.FolderStore = (*Client)(nil)
+)
+
+// List implements msgstore.MessageStore.
+func (c *Client) List(ctx context.Context, mailbox string) ([]msgstore.MessageInfo, error) {
+	return c.ListInFolder(ctx, mailbox, "")
+}
+
+// Retrieve implements msgstore.MessageStore.
+func (c *Client) Retrieve(ctx context.Context, mailbox string, uid string) (io.ReadCloser, error) {
+	return c.RetrieveFromFolder(ctx, mailbox, "", uid)
+}
+
+// Delete implements msgstore.MessageStore.
+func (c *Client) Delete(ctx context.Context, mailbox string, uid string) error {
+	return c.DeleteInFolder(ctx, mailbox, "", uid)
+}
+
+// Expunge implements msgstore.MessageStore.
+func (c *Client) Expunge(ctx context.Context, mailbox string) ([]string, error) {
+	return c.ExpungeFolder(ctx, mailbox, "")
+}
+
+// Stat implements msgstore.MessageStore.
+func (c *Client) Stat(ctx context.Context, mailbox string) (int, int64, error) {
+	return c.StatFolder(ctx, mailbox, "")
+}
+
+// Deliver implements msgstore.DeliveryAgent.
+func (c *Client) Deliver(ctx context.Context, envelope msgstore.Envelope, message io.Reader) error {
+	data, err := msgstore.MarshalEnvelope(envelope)
+	if err != nil {
+		return err
+	}
+	stream, err := c.rpc.Deliver(ctx)
+	if err != nil {
+		return fromStatus(err)
+	}
+	if err := sendUpload(stream, &msgstorepb.Upload{Envelope: data}, message); err != nil {
+		return err
+	}
+	_, err = stream.CloseAndRecv()
+	return fromStatus(err)
+}
+
+// ListInFolder implements msgstore.FolderStore.
+func (c *Client) ListInFolder(ctx context.Context, mailbox string, folder string) ([]msgstore.MessageInfo, error) {
+	resp, err := c.rpc.List(ctx, &msgstorepb.MailboxRequest{Mailbox: mailbox, Folder: folder})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	msgs := make([]msgstore.MessageInfo, len(resp.GetMessages()))
+	for i, pm := range resp.GetMessages() {
+		msgs[i] = messageInfoFromProto(pm)
+	}
+	return msgs, nil
+}
+
+// RetrieveFromFolder implements msgstore.FolderStore. The message is
+// streamed as it is read; closing the reader cancels the stream.
+func (c *Client) RetrieveFromFolder(ctx context.Context, mailbox string, folder string, uid string) (io.ReadCloser, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	stream, err := c.rpc.Retrieve(ctx, &msgstorepb.MessageRequest{Mailbox: mailbox, Folder: folder, Uid: uid})
+	if err != nil {
+		cancel()
+		return nil, fromStatus(err)
+	}
+	// Wait for the first chunk so that errors such as a missing message
+	// surface here rather than on the first Read.
+	first, err := stream.Recv()
+	if err != nil && err != io.EOF {
+		cancel()
+		return nil, fromStatus(err)
+	}
+	r := &chunkReader{stream: stream, cancel: cancel}
+	if err == io.EOF {
+		r.err = io.EOF
+	} else {
+		r.buf = first.GetData()
+	}
+	return r, nil
+}
+
+// DeleteInFolder implements msgstore.FolderStore.
+func (c *Client) DeleteInFolder(ctx context.Context, mailbox string, folder string, uid string) error {
+	_, err := c.rpc.Delete(ctx, &msgstorepb.MessageRequest{Mailbox: mailbox, Folder: folder, Uid: uid})
+	return fromStatus(err)
+}
+
+// ExpungeFolder implements msgstore.FolderStore.
+func (c *Client) ExpungeFolder(ctx context.Context, mailbox string, folder string) ([]string, error) {
+	resp, err := c.rpc.Expunge(ctx, &msgstorepb.MailboxRequest{Mailbox: mailbox, Folder: folder})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	return resp.GetRemoved(), nil
+}
+
+// StatFolder implements msgstore.FolderStore.
+func (c *Client) StatFolder(ctx context.Context, mailbox string, folder string) (int, int64, error) {
+	resp, err := c.rpc.Stat(ctx, &msgstorepb.MailboxRequest{Mailbox: mailbox, Folder: folder})
+	if err != nil {
+		return 0, 0, fromStatus(err)
+	}
+	return int(resp.GetCount()), resp.GetTotalBytes(), nil
+}
+
+// DeliverToFolder implements msgstore.FolderStore.
+func (c *Client) DeliverToFolder(ctx context.Context, mailbox string, folder string, message io.Reader) error {
+	stream, err := c.rpc.DeliverToFolder(ctx)
+	if err != nil {
+		return fromStatus(err)
+	}
+	if err := sendUpload(stream, &msgstorepb.Upload{Mailbox: mailbox, Folder: folder}, message); err != nil {
+		return err
+	}
+	_, err = stream.CloseAndRecv()
+	return fromStatus(err)
+}
+
+// AppendToFolder implements msgstore.FolderStore.
+func (c *Client) AppendToFolder(ctx context.Context, mailbox string, folder string, r io.Reader, flags []string, date time.Time) (string, error) {
+	stream, err := c.rpc.AppendToFolder(ctx)
+	if err != nil {
+		return "", fromStatus(err)
+	}
+	first := &msgstorepb.Upload{Mailbox: mailbox, Folder: folder, Flags: flags}
+	if !date.IsZero() {
+		first.Date = timestamppb.New(date)
+	}
+	if err := sendUpload(stream, first, r); err != nil {
+		return "", err
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return "", fromStatus(err)
+	}
+	return resp.GetUid(), nil
+}
+
+// CreateFolder implements msgstore.FolderStore.
+func (c *Client) CreateFolder(ctx context.Context, mailbox string, folder string) error {
+	_, err := c.rpc.CreateFolder(ctx, &msgstorepb.FolderRequest{Mailbox: mailbox, Folder: folder})
+	return fromStatus(err)
+}
+
+// ListFolders implements msgstore.FolderStore.
+func (c *Client) ListFolders(ctx context.Context, mailbox string) ([]string, error) {
+	resp, err := c.rpc.ListFolders(ctx, &msgstorepb.MailboxRequest{Mailbox: mailbox})
+	if err != nil {
+		return nil, fromStatus(err)
+	}
+	return resp.GetFolders(), nil
+}
+
+// DeleteFolder implements msgstore.FolderStore.
+func (c *Client) DeleteFolder(ctx context.Context, mailbox string, folder string, opts ...msgstore.DeleteFolderOption) error {
+	var o msgstore.DeleteFolderOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	_, err := c.rpc.DeleteFolder(ctx, &msgstorepb.FolderRequest{
+		Mailbox:   mailbox,
+		Folder:    folder,
+		Force:     o.Force,
+		Recursive: o.Recursive,
+	})
+	return fromStatus(err)
+}
+
+// RenameFolder implements msgstore.FolderStore.
+func (c *Client) RenameFolder(ctx context.Context, mailbox string, oldName string, newName string) error {
+	_, err := c.rpc.RenameFolder(ctx, &msgstorepb.FolderRequest{Mailbox: mailbox, Folder: oldName, NewName: newName})
+	return fromStatus(err)
+}
+
+// SetFlagsInFolder implements msgstore.FolderStore.
+func (c *Client) SetFlagsInFolder(ctx context.Context, mailbox string, folder string, uid string, mode msgstore.FlagMode, flags []string) error {
+	_, err := c.rpc.SetFlags(ctx, &msgstorepb.SetFlagsRequest{
+		Mailbox: mailbox,
+		Folder:  folder,
+		Uid:     uid,
+		Mode:    msgstorepb.FlagMode(mode),
+		Flags:   flags,
+	})
+	return fromStatus(err)
+}
+
+// CopyMessage implements msgstore.FolderStore.
+func (c *Client) CopyMessage(ctx context.Context, mailbox string, srcFolder string, uid string, destFolder string) (string, error) {
+	resp, err := c.rpc.CopyMessage(ctx, &msgstorepb.CopyRequest{
+		Mailbox:    mailbox,
+		SrcFolder:  srcFolder,
+		Uid:        uid,
+		DestFolder: destFolder,
+	})
+	if err != nil {
+		return "", fromStatus(err)
+	}
+	return resp.GetUid(), nil
+}
+
+// UIDValidity implements msgstore.FolderStore.
+func (c *Client) UIDValidity(ctx context.Context, mailbox string, folder string) (uint32, error) {
+	resp, err := c.rpc.UIDValidity(ctx, &msgstorepb.MailboxRequest{Mailbox: mailbox, Folder: folder})
+	if err != nil {
+		return 0, fromStatus(err)
+	}
+	return resp.GetUidValidity(), nil
+}
+
+// sendUpload streams first followed by the body of r in chunks. The body's
+// first chunk rides along with first.
+func sendUpload[T any](stream gogrpc.ClientStreamingClient[msgstorepb.Upload, T], first *msgstorepb.Upload, r io.Reader) error {
+	buf := make([]byte, chunkSize)
+	msg := first
+	for {
+		n, err := io.ReadFull(r, buf)
+		if n > 0 || msg != nil {
+			if msg == nil {
+				msg = &msgstorepb.Upload{}
+			}
+			msg.Data = buf[:n]
+			if sendErr := stream.Send(msg); sendErr != nil {
+				if sendErr == io.EOF {
+					// The server ended the call; its status says why.
+					_, sendErr = stream.CloseAndRecv()
+				}
+				return fromStatus(sendErr)
+			}
+			msg = nil
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// chunkReader reads a message from a Retrieve stream.
+type chunkReader struct {
+	stream gogrpc.ServerStreamingClient[msgstorepb.Chunk]
+	cancel context.CancelFunc
+	buf    []byte
+	err    error
+}
+
+func (r *chunkReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		chunk, err := r.stream.Recv()
+		if err == io.EOF {
+			r.err = io.EOF
+			continue
+		}
+		if err != nil {
+			r.err = fromStatus(err)
+			continue
+		}
+		r.buf = chunk.GetData()
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func (r *chunkReader) Close() error {
+	r.cancel()
+	return nil
+}
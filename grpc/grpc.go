@@ -0,0 +1,169 @@
+// Package grpc exposes msgstore stores over gRPC, so storage can run on a
+// dedicated host while protocol daemons (smtpd, pop3d, imapd) run elsewhere.
+//
+// Server wraps a msgstore.MsgStore and serves the MsgStore service defined
+// in msgstorepb/msgstore.proto. Client dials that service and implements
+// msgstore.MsgStore and msgstore.FolderStore, so it drops in wherever a
+// local store is used:
+//
+//	srv := grpc.NewServer(store)
+//	gs := gogrpc.NewServer()
+//	msgstorepb.RegisterMsgStoreServer(gs, srv)
+//	go gs.Serve(listener)
+//
+//	conn, err := gogrpc.NewClient(addr, creds)
+//	client := grpc.NewClient(conn)
+//	msgs, err := client.List(ctx, "user@example.com")
+//
+// Message bodies are streamed in chunks in both directions. Store errors
+// travel as gRPC status codes with their errors.Code in an ErrorInfo
+// detail, and are mapped back to the sentinel errors of the errors
+// package, so errors.Is and errors.CodeOf work across the wire. Transport
+// security is the caller's concern and is configured on the gRPC server and
+// connection.
+package grpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative msgstorepb/msgstore.proto
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/infodancer/msgstore/errors"
+)
+
+// chunkSize is the size of the body chunks streamed by Retrieve and the
+// upload calls, well below gRPC's default 4 MiB message limit.
+const chunkSize = 64 * 1024
+
+// errorDomain is the ErrorInfo domain of the error codes attached to
+// status errors.
+const errorDomain = "msgstore"
+
+// errorCodes maps the codes of the store's errors to gRPC status codes.
+// Errors travel with their errors.Code in an ErrorInfo detail; the table
+// only decides the status code. Order matters when decoding the status of
+// a server that sends no ErrorInfo: the first sentinel whose text appears
+// in the status message wins.
+var errorCodes = []struct {
+	code  errors.Code
+	grpcc codes.Code
+}{
+	{errors.CodeMailboxNotFound, codes.NotFound},
+	{errors.CodeMessageNotFound, codes.NotFound},
+	{errors.CodeMessageDeleted, codes.NotFound},
+	{errors.CodeFolderNotFound, codes.NotFound},
+	{errors.CodeMaildirNotFound, codes.NotFound},
+	{errors.CodeRecipientNotFound, codes.NotFound},
+	{errors.CodeUserNotFound, codes.NotFound},
+	{errors.CodeScriptNotFound, codes.NotFound},
+	{errors.CodeFolderExists, codes.AlreadyExists},
+	{errors.CodeFolderNotEmpty, codes.FailedPrecondition},
+	{errors.CodeScriptActive, codes.FailedPrecondition},
+	{errors.CodeCannotCalculateChanges, codes.FailedPrecondition},
+	{errors.CodeConflict, codes.Aborted},
+	{errors.CodeMailboxLocked, codes.Unavailable},
+	{errors.CodeNoRecipients, codes.InvalidArgument},
+	{errors.CodeInvalidAddress, codes.InvalidArgument},
+	{errors.CodeInvalidEnvelope, codes.InvalidArgument},
+	{errors.CodeInvalidFolderName, codes.InvalidArgument},
+	{errors.CodeInvalidPath, codes.InvalidArgument},
+	{errors.CodePathTraversal, codes.InvalidArgument},
+	{errors.CodeInvalidSyncToken, codes.InvalidArgument},
+	{errors.CodeQuotaExceeded, codes.ResourceExhausted},
+	{errors.CodeRateLimited, codes.ResourceExhausted},
+	{errors.CodeMetadataTooLarge, codes.ResourceExhausted},
+	{errors.CodePermissionDenied, codes.PermissionDenied},
+	{errors.CodeAuthenticationFailed, codes.Unauthenticated},
+	{errors.CodeNotSupported, codes.Unimplemented},
+	{errors.CodeDeliveryFailed, codes.Internal},
+}
+
+// toStatus converts a store error into a gRPC status error carrying the
+// error's code. The status message is the full error text, except for
+// errors without a code: those are logged and reported only as "internal
+// error", so paths and other server details do not reach clients.
+func (s *Server) toStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+	code := errors.CodeOf(err)
+	if code == errors.CodeUnknown {
+		s.logger.Error("grpc request failed", slog.String("error", err.Error()))
+		return status.Error(codes.Unknown, "internal error")
+	}
+	grpcc := codes.Unknown
+	switch code {
+	case errors.CodeCanceled:
+		grpcc = codes.Canceled
+	case errors.CodeDeadlineExceeded:
+		grpcc = codes.DeadlineExceeded
+	}
+	for _, m := range errorCodes {
+		if m.code == code {
+			grpcc = m.grpcc
+			break
+		}
+	}
+	st := status.New(grpcc, err.Error())
+	if detailed, derr := st.WithDetails(&errdetails.ErrorInfo{Reason: string(code), Domain: errorDomain}); derr == nil {
+		st = detailed
+	}
+	return st.Err()
+}
+
+// fromStatus converts a gRPC status error back into a store error that
+// carries the server's code and wraps the matching sentinel, keeping the
+// server's message.
+func fromStatus(err error) error {
+	if err == nil {
+		return nil
+	}
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok && info.GetDomain() == errorDomain {
+			code := errors.Code(info.GetReason())
+			if sentinel := errors.Sentinel(code); sentinel != nil {
+				return &remoteError{msg: st.Message(), err: sentinel}
+			}
+			return &remoteError{msg: st.Message(), err: errors.New(code, st.Message())}
+		}
+	}
+
+	// Servers that predate error codes send only the status.
+	switch st.Code() {
+	case codes.Canceled:
+		return &remoteError{msg: st.Message(), err: context.Canceled}
+	case codes.DeadlineExceeded:
+		return &remoteError{msg: st.Message(), err: context.DeadlineExceeded}
+	}
+	for _, m := range errorCodes {
+		sentinel := errors.Sentinel(m.code)
+		if st.Code() == m.grpcc && strings.Contains(st.Message(), sentinel.Error()) {
+			return &remoteError{msg: st.Message(), err: sentinel}
+		}
+	}
+	return err
+}
+
+// remoteError is an error returned by the server, unwrapping to the
+// sentinel it was mapped from.
+type remoteError struct {
+	msg string
+	err error
+}
+
+func (e *remoteError) Error() string { return e.msg }
+
+func (e *remoteError) Unwrap() error { return e.err }
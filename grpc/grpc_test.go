@@ -0,0 +1,191 @@
+package grpc_test
+
+import (
+	"bytes"
+	"context"
+	stderrors "errors"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	gogrpc "google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+	"github.com/infodancer/msgstore/grpc"
+	"github.com/infodancer/msgstore/grpc/msgstorepb"
+	"github.com/infodancer/msgstore/maildir"
+)
+
+// dial serves store over an in-memory listener and returns a client for it.
+func dial(t *testing.T, store msgstore.MsgStore, opts ...grpc.Option) *grpc.Client {
+	t.Helper()
+	lis := bufconn.Listen(1 << 20)
+	gs := gogrpc.NewServer()
+	msgstorepb.RegisterMsgStoreServer(gs, grpc.NewServer(store, opts...))
+	go func() { _ = gs.Serve(lis) }()
+	t.Cleanup(gs.Stop)
+
+	conn, err := gogrpc.NewClient("passthrough:///bufnet",
+		gogrpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		gogrpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("NewClient: %v", err)
+	}
+	t.Cleanup(func() { _ = conn.Close() })
+	return grpc.NewClient(conn)
+}
+
+func TestClient_MessageStore(t *testing.T) {
+	client := dial(t, maildir.NewStore(t.TempDir(), "", ""))
+	ctx := context.Background()
+	mailbox := "user@example.com"
+
+	// Larger than one chunk, so both directions stream several messages.
+	body := "Subject: big\r\n\r\n" + strings.Repeat("0123456789abcdef", 10000)
+	envelope := msgstore.Envelope{From: "sender@example.com", Recipients: []string{mailbox}}
+	if err := client.Deliver(ctx, envelope, strings.NewReader(body)); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+
+	msgs, err := client.List(ctx, mailbox)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("List = %v, %v; want one message", msgs, err)
+	}
+	count, total, err := client.Stat(ctx, mailbox)
+	if err != nil || count != 1 || total != msgs[0].Size {
+		t.Errorf("Stat = %d, %d, %v; want 1, %d", count, total, err, msgs[0].Size)
+	}
+
+	rc, err := client.Retrieve(ctx, mailbox, msgs[0].UID)
+	if err != nil {
+		t.Fatalf("Retrieve: %v", err)
+	}
+	got, err := io.ReadAll(rc)
+	_ = rc.Close()
+	if err != nil || !bytes.Contains(got, []byte(body)) {
+		t.Errorf("Retrieve returned %d bytes, %v; want the delivered message", len(got), err)
+	}
+
+	if err := client.Delete(ctx, mailbox, msgs[0].UID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	removed, err := client.Expunge(ctx, mailbox)
+	if err != nil || len(removed) != 1 || removed[0] != msgs[0].UID {
+		t.Errorf("Expunge = %v, %v; want [%s]", removed, err, msgs[0].UID)
+	}
+
+	if _, err := client.Retrieve(ctx, mailbox, msgs[0].UID); err == nil {
+		t.Error("Retrieve expunged message: want error")
+	}
+}
+
+func TestClient_FolderStore(t *testing.T) {
+	client := dial(t, maildir.NewStore(t.TempDir(), "", ""))
+	ctx := context.Background()
+	mailbox := "user@example.com"
+
+	if err := client.CreateFolder(ctx, mailbox, "Work"); err != nil {
+		t.Fatalf("CreateFolder: %v", err)
+	}
+	if err := client.CreateFolder(ctx, mailbox, "Work"); !stderrors.Is(err, errors.ErrFolderExists) {
+		t.Errorf("CreateFolder twice: err = %v, want ErrFolderExists", err)
+	}
+	folders, err := client.ListFolders(ctx, mailbox)
+	if err != nil || !contains(folders, "Work") {
+		t.Errorf("ListFolders = %v, %v; want Work", folders, err)
+	}
+
+	uid, err := client.AppendToFolder(ctx, mailbox, "Work", strings.NewReader("Subject: hi\r\n\r\n"), []string{"\\Seen"}, time.Now())
+	if err != nil {
+		t.Fatalf("AppendToFolder: %v", err)
+	}
+	if err := client.SetFlagsInFolder(ctx, mailbox, "Work", uid, msgstore.FlagModeAdd, []string{"\\Flagged"}); err != nil {
+		t.Fatalf("SetFlagsInFolder: %v", err)
+	}
+	msgs, err := client.ListInFolder(ctx, mailbox, "Work")
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("ListInFolder = %v, %v; want one message", msgs, err)
+	}
+	if !contains(msgs[0].Flags, "\\Seen") || !contains(msgs[0].Flags, "\\Flagged") {
+		t.Errorf("flags = %v, want \\Seen and \\Flagged", msgs[0].Flags)
+	}
+
+	if err := client.DeliverToFolder(ctx, mailbox, "Work", strings.NewReader("Subject: two\r\n\r\n")); err != nil {
+		t.Fatalf("DeliverToFolder: %v", err)
+	}
+	if _, err := client.CopyMessage(ctx, mailbox, "Work", uid, "INBOX"); err != nil {
+		t.Fatalf("CopyMessage: %v", err)
+	}
+	if count, _, err := client.StatFolder(ctx, mailbox, "Work"); err != nil || count != 2 {
+		t.Errorf("StatFolder = %d, %v; want 2", count, err)
+	}
+	if v, err := client.UIDValidity(ctx, mailbox, "Work"); err != nil || v == 0 {
+		t.Errorf("UIDValidity = %d, %v", v, err)
+	}
+
+	if err := client.DeleteFolder(ctx, mailbox, "Work"); !stderrors.Is(err, errors.ErrFolderNotEmpty) {
+		t.Errorf("DeleteFolder non-empty: err = %v, want ErrFolderNotEmpty", err)
+	}
+	if err := client.RenameFolder(ctx, mailbox, "Work", "Play"); err != nil {
+		t.Fatalf("RenameFolder: %v", err)
+	}
+	if err := client.DeleteFolder(ctx, mailbox, "Play", msgstore.WithForce()); err != nil {
+		t.Fatalf("DeleteFolder forced: %v", err)
+	}
+	if _, err := client.ListInFolder(ctx, mailbox, "Play"); !stderrors.Is(err, errors.ErrFolderNotFound) || errors.CodeOf(err) != errors.CodeFolderNotFound {
+		t.Errorf("ListInFolder deleted folder: err = %v (code %s), want ErrFolderNotFound", err, errors.CodeOf(err))
+	}
+}
+
+// rootOnlyStore is a MsgStore without folder support.
+type rootOnlyStore struct {
+	msgstore.MsgStore
+}
+
+func TestClient_FoldersUnsupported(t *testing.T) {
+	client := dial(t, rootOnlyStore{maildir.NewStore(t.TempDir(), "", "")})
+	if _, err := client.ListFolders(context.Background(), "user@example.com"); !stderrors.Is(err, errors.ErrNotSupported) {
+		t.Errorf("ListFolders: err = %v, want ErrNotSupported", err)
+	}
+}
+
+// failingStore fails listings with an error that has no code.
+type failingStore struct {
+	msgstore.MsgStore
+}
+
+func (failingStore) List(context.Context, string) ([]msgstore.MessageInfo, error) {
+	return nil, stderrors.New("open /var/mail/secret/cur: input/output error")
+}
+
+func TestServer_InternalError(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	client := dial(t, failingStore{maildir.NewStore(t.TempDir(), "", "")}, grpc.WithLogger(logger))
+
+	_, err := client.List(context.Background(), "user@example.com")
+	if err == nil || strings.Contains(err.Error(), "/var/mail") || !strings.Contains(err.Error(), "internal error") {
+		t.Errorf("List: err = %v, want only internal error", err)
+	}
+	if !strings.Contains(logs.String(), "/var/mail/secret") {
+		t.Errorf("log = %q, want the underlying error", logs.String())
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
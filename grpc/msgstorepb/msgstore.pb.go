@@ -0,0 +1,1138 @@
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: msgstorepb/msgstore.proto
+
+// Package infodancer.msgstore.v1 exposes the msgstore MessageStore,
+// FolderStore and DeliveryAgent interfaces as a single gRPC service, so a
+// storage host can serve protocol front ends running elsewhere.
+
+package msgstorepb
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	timestamppb "google.golang.org/protobuf/types/known/timestamppb"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type FlagMode int32
+
+const (
+	FlagMode_FLAG_MODE_SET    FlagMode = 0
+	FlagMode_FLAG_MODE_ADD    FlagMode = 1
+	FlagMode_FLAG_MODE_REMOVE FlagMode = 2
+)
+
+// Enum value maps for FlagMode.
+var (
+	FlagMode_name = map[int32]string{
+		0: "FLAG_MODE_SET",
+		1: "FLAG_MODE_ADD",
+		2: "FLAG_MODE_REMOVE",
+	}
+	FlagMode_value = map[string]int32{
+		"FLAG_MODE_SET":    0,
+		"FLAG_MODE_ADD":    1,
+		"FLAG_MODE_REMOVE": 2,
+	}
+)
+
+func (x FlagMode) Enum() *FlagMode {
+	p := new(FlagMode)
+	*p = x
+	return p
+}
+
+func (x FlagMode) String() string {
+	return protoimpl.X.EnumStringOf(x.Descriptor(), protoreflect.EnumNumber(x))
+}
+
+func (FlagMode) Descriptor() protoreflect.EnumDescriptor {
+	return file_msgstorepb_msgstore_proto_enumTypes[0].Descriptor()
+}
+
+func (FlagMode) Type() protoreflect.EnumType {
+	return &file_msgstorepb_msgstore_proto_enumTypes[0]
+}
+
+func (x FlagMode) Number() protoreflect.EnumNumber {
+	return protoreflect.EnumNumber(x)
+}
+
+// Deprecated: Use FlagMode.Descriptor instead.
+func (FlagMode) EnumDescriptor() ([]byte, []int) {
+	return file_msgstorepb_msgstore_proto_rawDescGZIP(), []int{0}
+}
+
+type Empty struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Empty) Reset() {
+	*x = Empty{}
+	mi := &file_msgstorepb_msgstore_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Empty) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Empty) ProtoMessage() {}
+
+func (x *Empty) ProtoReflect() protoreflect.Message {
+	mi := &file_msgstorepb_msgstore_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Empty.ProtoReflect.Descriptor instead.
+func (*Empty) Descriptor() ([]byte, []int) {
+	return file_msgstorepb_msgstore_proto_rawDescGZIP(), []int{0}
+}
+
+type MailboxRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Mailbox       string                 `protobuf:"bytes,1,opt,name=mailbox,proto3" json:"mailbox,omitempty"`
+	Folder        string                 `protobuf:"bytes,2,opt,name=folder,proto3" json:"folder,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MailboxRequest) Reset() {
+	*x = MailboxRequest{}
+	mi := &file_msgstorepb_msgstore_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MailboxRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MailboxRequest) ProtoMessage() {}
+
+func (x *MailboxRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_msgstorepb_msgstore_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MailboxRequest.ProtoReflect.Descriptor instead.
+func (*MailboxRequest) Descriptor() ([]byte, []int) {
+	return file_msgstorepb_msgstore_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *MailboxRequest) GetMailbox() string {
+	if x != nil {
+		return x.Mailbox
+	}
+	return ""
+}
+
+func (x *MailboxRequest) GetFolder() string {
+	if x != nil {
+		return x.Folder
+	}
+	return ""
+}
+
+type MessageRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Mailbox       string                 `protobuf:"bytes,1,opt,name=mailbox,proto3" json:"mailbox,omitempty"`
+	Folder        string                 `protobuf:"bytes,2,opt,name=folder,proto3" json:"folder,omitempty"`
+	Uid           string                 `protobuf:"bytes,3,opt,name=uid,proto3" json:"uid,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MessageRequest) Reset() {
+	*x = MessageRequest{}
+	mi := &file_msgstorepb_msgstore_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MessageRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MessageRequest) ProtoMessage() {}
+
+func (x *MessageRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_msgstorepb_msgstore_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MessageRequest.ProtoReflect.Descriptor instead.
+func (*MessageRequest) Descriptor() ([]byte, []int) {
+	return file_msgstorepb_msgstore_proto_rawDescGZIP(), []int{2}
+}
+
+func (x *MessageRequest) GetMailbox() string {
+	if x != nil {
+		return x.Mailbox
+	}
+	return ""
+}
+
+func (x *MessageRequest) GetFolder() string {
+	if x != nil {
+		return x.Folder
+	}
+	return ""
+}
+
+func (x *MessageRequest) GetUid() string {
+	if x != nil {
+		return x.Uid
+	}
+	return ""
+}
+
+type MessageInfo struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Uid           string                 `protobuf:"bytes,1,opt,name=uid,proto3" json:"uid,omitempty"`
+	Size          int64                  `protobuf:"varint,2,opt,name=size,proto3" json:"size,omitempty"`
+	Flags         []string               `protobuf:"bytes,3,rep,name=flags,proto3" json:"flags,omitempty"`
+	InternalDate  *timestamppb.Timestamp `protobuf:"bytes,4,opt,name=internal_date,json=internalDate,proto3" json:"internal_date,omitempty"`
+	From          string                 `protobuf:"bytes,5,opt,name=from,proto3" json:"from,omitempty"`
+	Subject       string                 `protobuf:"bytes,6,opt,name=subject,proto3" json:"subject,omitempty"`
+	Date          *timestamppb.Timestamp `protobuf:"bytes,7,opt,name=date,proto3" json:"date,omitempty"`
+	MessageId     string                 `protobuf:"bytes,8,opt,name=message_id,json=messageId,proto3" json:"message_id,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *MessageInfo) Reset() {
+	*x = MessageInfo{}
+	mi := &file_msgstorepb_msgstore_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *MessageInfo) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*MessageInfo) ProtoMessage() {}
+
+func (x *MessageInfo) ProtoReflect() protoreflect.Message {
+	mi := &file_msgstorepb_msgstore_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use MessageInfo.ProtoReflect.Descriptor instead.
+func (*MessageInfo) Descriptor() ([]byte, []int) {
+	return file_msgstorepb_msgstore_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *MessageInfo) GetUid() string {
+	if x != nil {
+		return x.Uid
+	}
+	return ""
+}
+
+func (x *MessageInfo) GetSize() int64 {
+	if x != nil {
+		return x.Size
+	}
+	return 0
+}
+
+func (x *MessageInfo) GetFlags() []string {
+	if x != nil {
+		return x.Flags
+	}
+	return nil
+}
+
+func (x *MessageInfo) GetInternalDate() *timestamppb.Timestamp {
+	if x != nil {
+		return x.InternalDate
+	}
+	return nil
+}
+
+func (x *MessageInfo) GetFrom() string {
+	if x != nil {
+		return x.From
+	}
+	return ""
+}
+
+func (x *MessageInfo) GetSubject() string {
+	if x != nil {
+		return x.Subject
+	}
+	return ""
+}
+
+func (x *MessageInfo) GetDate() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Date
+	}
+	return nil
+}
+
+func (x *MessageInfo) GetMessageId() string {
+	if x != nil {
+		return x.MessageId
+	}
+	return ""
+}
+
+type ListResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Messages      []*MessageInfo         `protobuf:"bytes,1,rep,name=messages,proto3" json:"messages,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ListResponse) Reset() {
+	*x = ListResponse{}
+	mi := &file_msgstorepb_msgstore_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ListResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ListResponse) ProtoMessage() {}
+
+func (x *ListResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_msgstorepb_msgstore_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ListResponse.ProtoReflect.Descriptor instead.
+func (*ListResponse) Descriptor() ([]byte, []int) {
+	return file_msgstorepb_msgstore_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ListResponse) GetMessages() []*MessageInfo {
+	if x != nil {
+		return x.Messages
+	}
+	return nil
+}
+
+type Chunk struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Data          []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Chunk) Reset() {
+	*x = Chunk{}
+	mi := &file_msgstorepb_msgstore_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Chunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Chunk) ProtoMessage() {}
+
+func (x *Chunk) ProtoReflect() protoreflect.Message {
+	mi := &file_msgstorepb_msgstore_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Chunk.ProtoReflect.Descriptor instead.
+func (*Chunk) Descriptor() ([]byte, []int) {
+	return file_msgstorepb_msgstore_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *Chunk) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type ExpungeResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Removed       []string               `protobuf:"bytes,1,rep,name=removed,proto3" json:"removed,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ExpungeResponse) Reset() {
+	*x = ExpungeResponse{}
+	mi := &file_msgstorepb_msgstore_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ExpungeResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ExpungeResponse) ProtoMessage() {}
+
+func (x *ExpungeResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_msgstorepb_msgstore_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ExpungeResponse.ProtoReflect.Descriptor instead.
+func (*ExpungeResponse) Descriptor() ([]byte, []int) {
+	return file_msgstorepb_msgstore_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ExpungeResponse) GetRemoved() []string {
+	if x != nil {
+		return x.Removed
+	}
+	return nil
+}
+
+type StatResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Count         int64                  `protobuf:"varint,1,opt,name=count,proto3" json:"count,omitempty"`
+	TotalBytes    int64                  `protobuf:"varint,2,opt,name=total_bytes,json=totalBytes,proto3" json:"total_bytes,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *StatResponse) Reset() {
+	*x = StatResponse{}
+	mi := &file_msgstorepb_msgstore_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *StatResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*StatResponse) ProtoMessage() {}
+
+func (x *StatResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_msgstorepb_msgstore_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use StatResponse.ProtoReflect.Descriptor instead.
+func (*StatResponse) Descriptor() ([]byte, []int) {
+	return file_msgstorepb_msgstore_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *StatResponse) GetCount() int64 {
+	if x != nil {
+		return x.Count
+	}
+	return 0
+}
+
+func (x *StatResponse) GetTotalBytes() int64 {
+	if x != nil {
+		return x.TotalBytes
+	}
+	return 0
+}
+
+// Upload carries a message to Deliver, DeliverToFolder or AppendToFolder.
+// The first message of the stream sets the metadata; every message may
+// carry body data.
+type Upload struct {
+	state protoimpl.MessageState `protogen:"open.v1"`
+	// envelope is the msgstore JSON encoding of the envelope (Deliver only).
+	Envelope      []byte                 `protobuf:"bytes,1,opt,name=envelope,proto3" json:"envelope,omitempty"`
+	Mailbox       string                 `protobuf:"bytes,2,opt,name=mailbox,proto3" json:"mailbox,omitempty"`
+	Folder        string                 `protobuf:"bytes,3,opt,name=folder,proto3" json:"folder,omitempty"`
+	Flags         []string               `protobuf:"bytes,4,rep,name=flags,proto3" json:"flags,omitempty"`
+	Date          *timestamppb.Timestamp `protobuf:"bytes,5,opt,name=date,proto3" json:"date,omitempty"`
+	Data          []byte                 `protobuf:"bytes,6,opt,name=data,proto3" json:"data,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Upload) Reset() {
+	*x = Upload{}
+	mi := &file_msgstorepb_msgstore_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Upload) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Upload) ProtoMessage() {}
+
+func (x *Upload) ProtoReflect() protoreflect.Message {
+	mi := &file_msgstorepb_msgstore_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Upload.ProtoReflect.Descriptor instead.
+func (*Upload) Descriptor() ([]byte, []int) {
+	return file_msgstorepb_msgstore_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *Upload) GetEnvelope() []byte {
+	if x != nil {
+		return x.Envelope
+	}
+	return nil
+}
+
+func (x *Upload) GetMailbox() string {
+	if x != nil {
+		return x.Mailbox
+	}
+	return ""
+}
+
+func (x *Upload) GetFolder() string {
+	if x != nil {
+		return x.Folder
+	}
+	return ""
+}
+
+func (x *Upload) GetFlags() []string {
+	if x != nil {
+		return x.Flags
+	}
+	return nil
+}
+
+func (x *Upload) GetDate() *timestamppb.Timestamp {
+	if x != nil {
+		return x.Date
+	}
+	return nil
+}
+
+func (x *Upload) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+type UIDResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Uid           string                 `protobuf:"bytes,1,opt,name=uid,proto3" json:"uid,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UIDResponse) Reset() {
+	*x = UIDResponse{}
+	mi := &file_msgstorepb_msgstore_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UIDResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UIDResponse) ProtoMessage() {}
+
+func (x *UIDResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_msgstorepb_msgstore_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UIDResponse.ProtoReflect.Descriptor instead.
+func (*UIDResponse) Descriptor() ([]byte, []int) {
+	return file_msgstorepb_msgstore_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *UIDResponse) GetUid() string {
+	if x != nil {
+		return x.Uid
+	}
+	return ""
+}
+
+type FolderRequest struct {
+	state   protoimpl.MessageState `protogen:"open.v1"`
+	Mailbox string                 `protobuf:"bytes,1,opt,name=mailbox,proto3" json:"mailbox,omitempty"`
+	Folder  string                 `protobuf:"bytes,2,opt,name=folder,proto3" json:"folder,omitempty"`
+	// new_name is the target of RenameFolder.
+	NewName string `protobuf:"bytes,3,opt,name=new_name,json=newName,proto3" json:"new_name,omitempty"`
+	// force and recursive are the DeleteFolder options.
+	Force         bool `protobuf:"varint,4,opt,name=force,proto3" json:"force,omitempty"`
+	Recursive     bool `protobuf:"varint,5,opt,name=recursive,proto3" json:"recursive,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FolderRequest) Reset() {
+	*x = FolderRequest{}
+	mi := &file_msgstorepb_msgstore_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FolderRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FolderRequest) ProtoMessage() {}
+
+func (x *FolderRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_msgstorepb_msgstore_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FolderRequest.ProtoReflect.Descriptor instead.
+func (*FolderRequest) Descriptor() ([]byte, []int) {
+	return file_msgstorepb_msgstore_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *FolderRequest) GetMailbox() string {
+	if x != nil {
+		return x.Mailbox
+	}
+	return ""
+}
+
+func (x *FolderRequest) GetFolder() string {
+	if x != nil {
+		return x.Folder
+	}
+	return ""
+}
+
+func (x *FolderRequest) GetNewName() string {
+	if x != nil {
+		return x.NewName
+	}
+	return ""
+}
+
+func (x *FolderRequest) GetForce() bool {
+	if x != nil {
+		return x.Force
+	}
+	return false
+}
+
+func (x *FolderRequest) GetRecursive() bool {
+	if x != nil {
+		return x.Recursive
+	}
+	return false
+}
+
+type FoldersResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Folders       []string               `protobuf:"bytes,1,rep,name=folders,proto3" json:"folders,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *FoldersResponse) Reset() {
+	*x = FoldersResponse{}
+	mi := &file_msgstorepb_msgstore_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *FoldersResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*FoldersResponse) ProtoMessage() {}
+
+func (x *FoldersResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_msgstorepb_msgstore_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use FoldersResponse.ProtoReflect.Descriptor instead.
+func (*FoldersResponse) Descriptor() ([]byte, []int) {
+	return file_msgstorepb_msgstore_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *FoldersResponse) GetFolders() []string {
+	if x != nil {
+		return x.Folders
+	}
+	return nil
+}
+
+type SetFlagsRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Mailbox       string                 `protobuf:"bytes,1,opt,name=mailbox,proto3" json:"mailbox,omitempty"`
+	Folder        string                 `protobuf:"bytes,2,opt,name=folder,proto3" json:"folder,omitempty"`
+	Uid           string                 `protobuf:"bytes,3,opt,name=uid,proto3" json:"uid,omitempty"`
+	Mode          FlagMode               `protobuf:"varint,4,opt,name=mode,proto3,enum=infodancer.msgstore.v1.FlagMode" json:"mode,omitempty"`
+	Flags         []string               `protobuf:"bytes,5,rep,name=flags,proto3" json:"flags,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *SetFlagsRequest) Reset() {
+	*x = SetFlagsRequest{}
+	mi := &file_msgstorepb_msgstore_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SetFlagsRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SetFlagsRequest) ProtoMessage() {}
+
+func (x *SetFlagsRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_msgstorepb_msgstore_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SetFlagsRequest.ProtoReflect.Descriptor instead.
+func (*SetFlagsRequest) Descriptor() ([]byte, []int) {
+	return file_msgstorepb_msgstore_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *SetFlagsRequest) GetMailbox() string {
+	if x != nil {
+		return x.Mailbox
+	}
+	return ""
+}
+
+func (x *SetFlagsRequest) GetFolder() string {
+	if x != nil {
+		return x.Folder
+	}
+	return ""
+}
+
+func (x *SetFlagsRequest) GetUid() string {
+	if x != nil {
+		return x.Uid
+	}
+	return ""
+}
+
+func (x *SetFlagsRequest) GetMode() FlagMode {
+	if x != nil {
+		return x.Mode
+	}
+	return FlagMode_FLAG_MODE_SET
+}
+
+func (x *SetFlagsRequest) GetFlags() []string {
+	if x != nil {
+		return x.Flags
+	}
+	return nil
+}
+
+type CopyRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Mailbox       string                 `protobuf:"bytes,1,opt,name=mailbox,proto3" json:"mailbox,omitempty"`
+	SrcFolder     string                 `protobuf:"bytes,2,opt,name=src_folder,json=srcFolder,proto3" json:"src_folder,omitempty"`
+	Uid           string                 `protobuf:"bytes,3,opt,name=uid,proto3" json:"uid,omitempty"`
+	DestFolder    string                 `protobuf:"bytes,4,opt,name=dest_folder,json=destFolder,proto3" json:"dest_folder,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *CopyRequest) Reset() {
+	*x = CopyRequest{}
+	mi := &file_msgstorepb_msgstore_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *CopyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*CopyRequest) ProtoMessage() {}
+
+func (x *CopyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_msgstorepb_msgstore_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use CopyRequest.ProtoReflect.Descriptor instead.
+func (*CopyRequest) Descriptor() ([]byte, []int) {
+	return file_msgstorepb_msgstore_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *CopyRequest) GetMailbox() string {
+	if x != nil {
+		return x.Mailbox
+	}
+	return ""
+}
+
+func (x *CopyRequest) GetSrcFolder() string {
+	if x != nil {
+		return x.SrcFolder
+	}
+	return ""
+}
+
+func (x *CopyRequest) GetUid() string {
+	if x != nil {
+		return x.Uid
+	}
+	return ""
+}
+
+func (x *CopyRequest) GetDestFolder() string {
+	if x != nil {
+		return x.DestFolder
+	}
+	return ""
+}
+
+type UIDValidityResponse struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	UidValidity   uint32                 `protobuf:"varint,1,opt,name=uid_validity,json=uidValidity,proto3" json:"uid_validity,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *UIDValidityResponse) Reset() {
+	*x = UIDValidityResponse{}
+	mi := &file_msgstorepb_msgstore_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UIDValidityResponse) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UIDValidityResponse) ProtoMessage() {}
+
+func (x *UIDValidityResponse) ProtoReflect() protoreflect.Message {
+	mi := &file_msgstorepb_msgstore_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UIDValidityResponse.ProtoReflect.Descriptor instead.
+func (*UIDValidityResponse) Descriptor() ([]byte, []int) {
+	return file_msgstorepb_msgstore_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *UIDValidityResponse) GetUidValidity() uint32 {
+	if x != nil {
+		return x.UidValidity
+	}
+	return 0
+}
+
+var File_msgstorepb_msgstore_proto protoreflect.FileDescriptor
+
+const file_msgstorepb_msgstore_proto_rawDesc = "" +
+	"\n" +
+	"\x19msgstorepb/msgstore.proto\x12\x16infodancer.msgstore.v1\x1a\x1fgoogle/protobuf/timestamp.proto\"\a\n" +
+	"\x05Empty\"B\n" +
+	"\x0eMailboxRequest\x12\x18\n" +
+	"\amailbox\x18\x01 \x01(\tR\amailbox\x12\x16\n" +
+	"\x06folder\x18\x02 \x01(\tR\x06folder\"T\n" +
+	"\x0eMessageRequest\x12\x18\n" +
+	"\amailbox\x18\x01 \x01(\tR\amailbox\x12\x16\n" +
+	"\x06folder\x18\x02 \x01(\tR\x06folder\x12\x10\n" +
+	"\x03uid\x18\x03 \x01(\tR\x03uid\"\x87\x02\n" +
+	"\vMessageInfo\x12\x10\n" +
+	"\x03uid\x18\x01 \x01(\tR\x03uid\x12\x12\n" +
+	"\x04size\x18\x02 \x01(\x03R\x04size\x12\x14\n" +
+	"\x05flags\x18\x03 \x03(\tR\x05flags\x12?\n" +
+	"\rinternal_date\x18\x04 \x01(\v2\x1a.google.protobuf.TimestampR\finternalDate\x12\x12\n" +
+	"\x04from\x18\x05 \x01(\tR\x04from\x12\x18\n" +
+	"\asubject\x18\x06 \x01(\tR\asubject\x12.\n" +
+	"\x04date\x18\a \x01(\v2\x1a.google.protobuf.TimestampR\x04date\x12\x1d\n" +
+	"\n" +
+	"message_id\x18\b \x01(\tR\tmessageId\"O\n" +
+	"\fListResponse\x12?\n" +
+	"\bmessages\x18\x01 \x03(\v2#.infodancer.msgstore.v1.MessageInfoR\bmessages\"\x1b\n" +
+	"\x05Chunk\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data\"+\n" +
+	"\x0fExpungeResponse\x12\x18\n" +
+	"\aremoved\x18\x01 \x03(\tR\aremoved\"E\n" +
+	"\fStatResponse\x12\x14\n" +
+	"\x05count\x18\x01 \x01(\x03R\x05count\x12\x1f\n" +
+	"\vtotal_bytes\x18\x02 \x01(\x03R\n" +
+	"totalBytes\"\xb0\x01\n" +
+	"\x06Upload\x12\x1a\n" +
+	"\benvelope\x18\x01 \x01(\fR\benvelope\x12\x18\n" +
+	"\amailbox\x18\x02 \x01(\tR\amailbox\x12\x16\n" +
+	"\x06folder\x18\x03 \x01(\tR\x06folder\x12\x14\n" +
+	"\x05flags\x18\x04 \x03(\tR\x05flags\x12.\n" +
+	"\x04date\x18\x05 \x01(\v2\x1a.google.protobuf.TimestampR\x04date\x12\x12\n" +
+	"\x04data\x18\x06 \x01(\fR\x04data\"\x1f\n" +
+	"\vUIDResponse\x12\x10\n" +
+	"\x03uid\x18\x01 \x01(\tR\x03uid\"\x90\x01\n" +
+	"\rFolderRequest\x12\x18\n" +
+	"\amailbox\x18\x01 \x01(\tR\amailbox\x12\x16\n" +
+	"\x06folder\x18\x02 \x01(\tR\x06folder\x12\x19\n" +
+	"\bnew_name\x18\x03 \x01(\tR\anewName\x12\x14\n" +
+	"\x05force\x18\x04 \x01(\bR\x05force\x12\x1c\n" +
+	"\trecursive\x18\x05 \x01(\bR\trecursive\"+\n" +
+	"\x0fFoldersResponse\x12\x18\n" +
+	"\afolders\x18\x01 \x03(\tR\afolders\"\xa1\x01\n" +
+	"\x0fSetFlagsRequest\x12\x18\n" +
+	"\amailbox\x18\x01 \x01(\tR\amailbox\x12\x16\n" +
+	"\x06folder\x18\x02 \x01(\tR\x06folder\x12\x10\n" +
+	"\x03uid\x18\x03 \x01(\tR\x03uid\x124\n" +
+	"\x04mode\x18\x04 \x01(\x0e2 .infodancer.msgstore.v1.FlagModeR\x04mode\x12\x14\n" +
+	"\x05flags\x18\x05 \x03(\tR\x05flags\"y\n" +
+	"\vCopyRequest\x12\x18\n" +
+	"\amailbox\x18\x01 \x01(\tR\amailbox\x12\x1d\n" +
+	"\n" +
+	"src_folder\x18\x02 \x01(\tR\tsrcFolder\x12\x10\n" +
+	"\x03uid\x18\x03 \x01(\tR\x03uid\x12\x1f\n" +
+	"\vdest_folder\x18\x04 \x01(\tR\n" +
+	"destFolder\"8\n" +
+	"\x13UIDValidityResponse\x12!\n" +
+	"\fuid_validity\x18\x01 \x01(\rR\vuidValidity*F\n" +
+	"\bFlagMode\x12\x11\n" +
+	"\rFLAG_MODE_SET\x10\x00\x12\x11\n" +
+	"\rFLAG_MODE_ADD\x10\x01\x12\x14\n" +
+	"\x10FLAG_MODE_REMOVE\x10\x022\xa4\n" +
+	"\n" +
+	"\bMsgStore\x12T\n" +
+	"\x04List\x12&.infodancer.msgstore.v1.MailboxRequest\x1a$.infodancer.msgstore.v1.ListResponse\x12S\n" +
+	"\bRetrieve\x12&.infodancer.msgstore.v1.MessageRequest\x1a\x1d.infodancer.msgstore.v1.Chunk0\x01\x12O\n" +
+	"\x06Delete\x12&.infodancer.msgstore.v1.MessageRequest\x1a\x1d.infodancer.msgstore.v1.Empty\x12Z\n" +
+	"\aExpunge\x12&.infodancer.msgstore.v1.MailboxRequest\x1a'.infodancer.msgstore.v1.ExpungeResponse\x12T\n" +
+	"\x04Stat\x12&.infodancer.msgstore.v1.MailboxRequest\x1a$.infodancer.msgstore.v1.StatResponse\x12J\n" +
+	"\aDeliver\x12\x1e.infodancer.msgstore.v1.Upload\x1a\x1d.infodancer.msgstore.v1.Empty(\x01\x12R\n" +
+	"\x0fDeliverToFolder\x12\x1e.infodancer.msgstore.v1.Upload\x1a\x1d.infodancer.msgstore.v1.Empty(\x01\x12W\n" +
+	"\x0eAppendToFolder\x12\x1e.infodancer.msgstore.v1.Upload\x1a#.infodancer.msgstore.v1.UIDResponse(\x01\x12T\n" +
+	"\fCreateFolder\x12%.infodancer.msgstore.v1.FolderRequest\x1a\x1d.infodancer.msgstore.v1.Empty\x12^\n" +
+	"\vListFolders\x12&.infodancer.msgstore.v1.MailboxRequest\x1a'.infodancer.msgstore.v1.FoldersResponse\x12T\n" +
+	"\fDeleteFolder\x12%.infodancer.msgstore.v1.FolderRequest\x1a\x1d.infodancer.msgstore.v1.Empty\x12T\n" +
+	"\fRenameFolder\x12%.infodancer.msgstore.v1.FolderRequest\x1a\x1d.infodancer.msgstore.v1.Empty\x12R\n" +
+	"\bSetFlags\x12'.infodancer.msgstore.v1.SetFlagsRequest\x1a\x1d.infodancer.msgstore.v1.Empty\x12W\n" +
+	"\vCopyMessage\x12#.infodancer.msgstore.v1.CopyRequest\x1a#.infodancer.msgstore.v1.UIDResponse\x12b\n" +
+	"\vUIDValidity\x12&.infodancer.msgstore.v1.MailboxRequest\x1a+.infodancer.msgstore.v1.UIDValidityResponseB0Z.github.com/infodancer/msgstore/grpc/msgstorepbb\x06proto3"
+
+var (
+	file_msgstorepb_msgstore_proto_rawDescOnce sync.Once
+	file_msgstorepb_msgstore_proto_rawDescData []byte
+)
+
+func file_msgstorepb_msgstore_proto_rawDescGZIP() []byte {
+	file_msgstorepb_msgstore_proto_rawDescOnce.Do(func() {
+		file_msgstorepb_msgstore_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_msgstorepb_msgstore_proto_rawDesc), len(file_msgstorepb_msgstore_proto_rawDesc)))
+	})
+	return file_msgstorepb_msgstore_proto_rawDescData
+}
+
+var file_msgstorepb_msgstore_proto_enumTypes = make([]protoimpl.EnumInfo, 1)
+var file_msgstorepb_msgstore_proto_msgTypes = make([]protoimpl.MessageInfo, 15)
+var file_msgstorepb_msgstore_proto_goTypes = []any{
+	(FlagMode)(0),                 // 0: infodancer.msgstore.v1.FlagMode
+	(*Empty)(nil),                 // 1: infodancer.msgstore.v1.Empty
+	(*MailboxRequest)(nil),        // 2: infodancer.msgstore.v1.MailboxRequest
+	(*MessageRequest)(nil),        // 3: infodancer.msgstore.v1.MessageRequest
+	(*MessageInfo)(nil),           // 4: infodancer.msgstore.v1.MessageInfo
+	(*ListResponse)(nil),          // 5: infodancer.msgstore.v1.ListResponse
+	(*Chunk)(nil),                 // 6: infodancer.msgstore.v1.Chunk
+	(*ExpungeResponse)(nil),       // 7: infodancer.msgstore.v1.ExpungeResponse
+	(*StatResponse)(nil),          // 8: infodancer.msgstore.v1.StatResponse
+	(*Upload)(nil),                // 9: infodancer.msgstore.v1.Upload
+	(*UIDResponse)(nil),           // 10: infodancer.msgstore.v1.UIDResponse
+	(*FolderRequest)(nil),         // 11: infodancer.msgstore.v1.FolderRequest
+	(*FoldersResponse)(nil),       // 12: infodancer.msgstore.v1.FoldersResponse
+	(*SetFlagsRequest)(nil),       // 13: infodancer.msgstore.v1.SetFlagsRequest
+	(*CopyRequest)(nil),           // 14: infodancer.msgstore.v1.CopyRequest
+	(*UIDValidityResponse)(nil),   // 15: infodancer.msgstore.v1.UIDValidityResponse
+	(*timestamppb.Timestamp)(nil), // 16: google.protobuf.Timestamp
+}
+var file_msgstorepb_msgstore_proto_depIdxs = []int32{
+	16, // 0: infodancer.msgstore.v1.MessageInfo.internal_date:type_name -> google.protobuf.Timestamp
+	16, // 1: infodancer.msgstore.v1.MessageInfo.date:type_name -> google.protobuf.Timestamp
+	4,  // 2: infodancer.msgstore.v1.ListResponse.messages:type_name -> infodancer.msgstore.v1.MessageInfo
+	16, // 3: infodancer.msgstore.v1.Upload.date:type_name -> google.protobuf.Timestamp
+	0,  // 4: infodancer.msgstore.v1.SetFlagsRequest.mode:type_name -> infodancer.msgstore.v1.FlagMode
+	2,  // 5: infodancer.msgstore.v1.MsgStore.List:input_type -> infodancer.msgstore.v1.MailboxRequest
+	3,  // 6: infodancer.msgstore.v1.MsgStore.Retrieve:input_type -> infodancer.msgstore.v1.MessageRequest
+	3,  // 7: infodancer.msgstore.v1.MsgStore.Delete:input_type -> infodancer.msgstore.v1.MessageRequest
+	2,  // 8: infodancer.msgstore.v1.MsgStore.Expunge:input_type -> infodancer.msgstore.v1.MailboxRequest
+	2,  // 9: infodancer.msgstore.v1.MsgStore.Stat:input_type -> infodancer.msgstore.v1.MailboxRequest
+	9,  // 10: infodancer.msgstore.v1.MsgStore.Deliver:input_type -> infodancer.msgstore.v1.Upload
+	9,  // 11: infodancer.msgstore.v1.MsgStore.DeliverToFolder:input_type -> infodancer.msgstore.v1.Upload
+	9,  // 12: infodancer.msgstore.v1.MsgStore.AppendToFolder:input_type -> infodancer.msgstore.v1.Upload
+	11, // 13: infodancer.msgstore.v1.MsgStore.CreateFolder:input_type -> infodancer.msgstore.v1.FolderRequest
+	2,  // 14: infodancer.msgstore.v1.MsgStore.ListFolders:input_type -> infodancer.msgstore.v1.MailboxRequest
+	11, // 15: infodancer.msgstore.v1.MsgStore.DeleteFolder:input_type -> infodancer.msgstore.v1.FolderRequest
+	11, // 16: infodancer.msgstore.v1.MsgStore.RenameFolder:input_type -> infodancer.msgstore.v1.FolderRequest
+	13, // 17: infodancer.msgstore.v1.MsgStore.SetFlags:input_type -> infodancer.msgstore.v1.SetFlagsRequest
+	14, // 18: infodancer.msgstore.v1.MsgStore.CopyMessage:input_type -> infodancer.msgstore.v1.CopyRequest
+	2,  // 19: infodancer.msgstore.v1.MsgStore.UIDValidity:input_type -> infodancer.msgstore.v1.MailboxRequest
+	5,  // 20: infodancer.msgstore.v1.MsgStore.List:output_type -> infodancer.msgstore.v1.ListResponse
+	6,  // 21: infodancer.msgstore.v1.MsgStore.Retrieve:output_type -> infodancer.msgstore.v1.Chunk
+	1,  // 22: infodancer.msgstore.v1.MsgStore.Delete:output_type -> infodancer.msgstore.v1.Empty
+	7,  // 23: infodancer.msgstore.v1.MsgStore.Expunge:output_type -> infodancer.msgstore.v1.ExpungeResponse
+	8,  // 24: infodancer.msgstore.v1.MsgStore.Stat:output_type -> infodancer.msgstore.v1.StatResponse
+	1,  // 25: infodancer.msgstore.v1.MsgStore.Deliver:output_type -> infodancer.msgstore.v1.Empty
+	1,  // 26: infodancer.msgstore.v1.MsgStore.DeliverToFolder:output_type -> infodancer.msgstore.v1.Empty
+	10, // 27: infodancer.msgstore.v1.MsgStore.AppendToFolder:output_type -> infodancer.msgstore.v1.UIDResponse
+	1,  // 28: infodancer.msgstore.v1.MsgStore.CreateFolder:output_type -> infodancer.msgstore.v1.Empty
+	12, // 29: infodancer.msgstore.v1.MsgStore.ListFolders:output_type -> infodancer.msgstore.v1.FoldersResponse
+	1,  // 30: infodancer.msgstore.v1.MsgStore.DeleteFolder:output_type -> infodancer.msgstore.v1.Empty
+	1,  // 31: infodancer.msgstore.v1.MsgStore.RenameFolder:output_type -> infodancer.msgstore.v1.Empty
+	1,  // 32: infodancer.msgstore.v1.MsgStore.SetFlags:output_type -> infodancer.msgstore.v1.Empty
+	10, // 33: infodancer.msgstore.v1.MsgStore.CopyMessage:output_type -> infodancer.msgstore.v1.UIDResponse
+	15, // 34: infodancer.msgstore.v1.MsgStore.UIDValidity:output_type -> infodancer.msgstore.v1.UIDValidityResponse
+	20, // [20:35] is the sub-list for method output_type
+	5,  // [5:20] is the sub-list for method input_type
+	5,  // [5:5] is the sub-list for extension type_name
+	5,  // [5:5] is the sub-list for extension extendee
+	0,  // [0:5] is the sub-list for field type_name
+}
+
+func init() { file_msgstorepb_msgstore_proto_init() }
+func file_msgstorepb_msgstore_proto_init() {
+	if File_msgstorepb_msgstore_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_msgstorepb_msgstore_proto_rawDesc), len(file_msgstorepb_msgstore_proto_rawDesc)),
+			NumEnums:      1,
+			NumMessages:   15,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_msgstorepb_msgstore_proto_goTypes,
+		DependencyIndexes: file_msgstorepb_msgstore_proto_depIdxs,
+		EnumInfos:         file_msgstorepb_msgstore_proto_enumTypes,
+		MessageInfos:      file_msgstorepb_msgstore_proto_msgTypes,
+	}.Build()
+	File_msgstorepb_msgstore_proto = out.File
+	file_msgstorepb_msgstore_proto_goTypes = nil
+	file_msgstorepb_msgstore_proto_depIdxs = nil
+}
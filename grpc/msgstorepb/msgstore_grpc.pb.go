@@ -0,0 +1,648 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.6.2
+// - protoc             (unknown)
+// source: msgstorepb/msgstore.proto
+
+// Package infodancer.msgstore.v1 exposes the msgstore MessageStore,
+// FolderStore and DeliveryAgent interfaces as a single gRPC service, so a
+// storage host can serve protocol front ends running elsewhere.
+
+package msgstorepb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	MsgStore_List_FullMethodName            = "/infodancer.msgstore.v1.MsgStore/List"
+	MsgStore_Retrieve_FullMethodName        = "/infodancer.msgstore.v1.MsgStore/Retrieve"
+	MsgStore_Delete_FullMethodName          = "/infodancer.msgstore.v1.MsgStore/Delete"
+	MsgStore_Expunge_FullMethodName         = "/infodancer.msgstore.v1.MsgStore/Expunge"
+	MsgStore_Stat_FullMethodName            = "/infodancer.msgstore.v1.MsgStore/Stat"
+	MsgStore_Deliver_FullMethodName         = "/infodancer.msgstore.v1.MsgStore/Deliver"
+	MsgStore_DeliverToFolder_FullMethodName = "/infodancer.msgstore.v1.MsgStore/DeliverToFolder"
+	MsgStore_AppendToFolder_FullMethodName  = "/infodancer.msgstore.v1.MsgStore/AppendToFolder"
+	MsgStore_CreateFolder_FullMethodName    = "/infodancer.msgstore.v1.MsgStore/CreateFolder"
+	MsgStore_ListFolders_FullMethodName     = "/infodancer.msgstore.v1.MsgStore/ListFolders"
+	MsgStore_DeleteFolder_FullMethodName    = "/infodancer.msgstore.v1.MsgStore/DeleteFolder"
+	MsgStore_RenameFolder_FullMethodName    = "/infodancer.msgstore.v1.MsgStore/RenameFolder"
+	MsgStore_SetFlags_FullMethodName        = "/infodancer.msgstore.v1.MsgStore/SetFlags"
+	MsgStore_CopyMessage_FullMethodName     = "/infodancer.msgstore.v1.MsgStore/CopyMessage"
+	MsgStore_UIDValidity_FullMethodName     = "/infodancer.msgstore.v1.MsgStore/UIDValidity"
+)
+
+// MsgStoreClient is the client API for MsgStore service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// MsgStore mirrors the Go interfaces method for method. An empty folder
+// addresses the mailbox root (MessageStore); a non-empty folder addresses a
+// folder (FolderStore). Message bodies are streamed in chunks.
+type MsgStoreClient interface {
+	List(ctx context.Context, in *MailboxRequest, opts ...grpc.CallOption) (*ListResponse, error)
+	Retrieve(ctx context.Context, in *MessageRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Chunk], error)
+	Delete(ctx context.Context, in *MessageRequest, opts ...grpc.CallOption) (*Empty, error)
+	Expunge(ctx context.Context, in *MailboxRequest, opts ...grpc.CallOption) (*ExpungeResponse, error)
+	Stat(ctx context.Context, in *MailboxRequest, opts ...grpc.CallOption) (*StatResponse, error)
+	Deliver(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[Upload, Empty], error)
+	DeliverToFolder(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[Upload, Empty], error)
+	AppendToFolder(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[Upload, UIDResponse], error)
+	CreateFolder(ctx context.Context, in *FolderRequest, opts ...grpc.CallOption) (*Empty, error)
+	ListFolders(ctx context.Context, in *MailboxRequest, opts ...grpc.CallOption) (*FoldersResponse, error)
+	DeleteFolder(ctx context.Context, in *FolderRequest, opts ...grpc.CallOption) (*Empty, error)
+	RenameFolder(ctx context.Context, in *FolderRequest, opts ...grpc.CallOption) (*Empty, error)
+	SetFlags(ctx context.Context, in *SetFlagsRequest, opts ...grpc.CallOption) (*Empty, error)
+	CopyMessage(ctx context.Context, in *CopyRequest, opts ...grpc.CallOption) (*UIDResponse, error)
+	UIDValidity(ctx context.Context, in *MailboxRequest, opts ...grpc.CallOption) (*UIDValidityResponse, error)
+}
+
+type msgStoreClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewMsgStoreClient(cc grpc.ClientConnInterface) MsgStoreClient {
+	return &msgStoreClient{cc}
+}
+
+func (c *msgStoreClient) List(ctx context.Context, in *MailboxRequest, opts ...grpc.CallOption) (*ListResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListResponse)
+	err := c.cc.Invoke(ctx, MsgStore_List_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *msgStoreClient) Retrieve(ctx context.Context, in *MessageRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[Chunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MsgStore_ServiceDesc.Streams[0], MsgStore_Retrieve_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[MessageRequest, Chunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MsgStore_RetrieveClient = grpc.ServerStreamingClient[Chunk]
+
+func (c *msgStoreClient) Delete(ctx context.Context, in *MessageRequest, opts ...grpc.CallOption) (*Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, MsgStore_Delete_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *msgStoreClient) Expunge(ctx context.Context, in *MailboxRequest, opts ...grpc.CallOption) (*ExpungeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ExpungeResponse)
+	err := c.cc.Invoke(ctx, MsgStore_Expunge_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *msgStoreClient) Stat(ctx context.Context, in *MailboxRequest, opts ...grpc.CallOption) (*StatResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(StatResponse)
+	err := c.cc.Invoke(ctx, MsgStore_Stat_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *msgStoreClient) Deliver(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[Upload, Empty], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MsgStore_ServiceDesc.Streams[1], MsgStore_Deliver_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[Upload, Empty]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MsgStore_DeliverClient = grpc.ClientStreamingClient[Upload, Empty]
+
+func (c *msgStoreClient) DeliverToFolder(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[Upload, Empty], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MsgStore_ServiceDesc.Streams[2], MsgStore_DeliverToFolder_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[Upload, Empty]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MsgStore_DeliverToFolderClient = grpc.ClientStreamingClient[Upload, Empty]
+
+func (c *msgStoreClient) AppendToFolder(ctx context.Context, opts ...grpc.CallOption) (grpc.ClientStreamingClient[Upload, UIDResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &MsgStore_ServiceDesc.Streams[3], MsgStore_AppendToFolder_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[Upload, UIDResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MsgStore_AppendToFolderClient = grpc.ClientStreamingClient[Upload, UIDResponse]
+
+func (c *msgStoreClient) CreateFolder(ctx context.Context, in *FolderRequest, opts ...grpc.CallOption) (*Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, MsgStore_CreateFolder_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *msgStoreClient) ListFolders(ctx context.Context, in *MailboxRequest, opts ...grpc.CallOption) (*FoldersResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(FoldersResponse)
+	err := c.cc.Invoke(ctx, MsgStore_ListFolders_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *msgStoreClient) DeleteFolder(ctx context.Context, in *FolderRequest, opts ...grpc.CallOption) (*Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, MsgStore_DeleteFolder_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *msgStoreClient) RenameFolder(ctx context.Context, in *FolderRequest, opts ...grpc.CallOption) (*Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, MsgStore_RenameFolder_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *msgStoreClient) SetFlags(ctx context.Context, in *SetFlagsRequest, opts ...grpc.CallOption) (*Empty, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Empty)
+	err := c.cc.Invoke(ctx, MsgStore_SetFlags_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *msgStoreClient) CopyMessage(ctx context.Context, in *CopyRequest, opts ...grpc.CallOption) (*UIDResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UIDResponse)
+	err := c.cc.Invoke(ctx, MsgStore_CopyMessage_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *msgStoreClient) UIDValidity(ctx context.Context, in *MailboxRequest, opts ...grpc.CallOption) (*UIDValidityResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(UIDValidityResponse)
+	err := c.cc.Invoke(ctx, MsgStore_UIDValidity_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// MsgStoreServer is the server API for MsgStore service.
+// All implementations must embed UnimplementedMsgStoreServer
+// for forward compatibility.
+//
+// MsgStore mirrors the Go interfaces method for method. An empty folder
+// addresses the mailbox root (MessageStore); a non-empty folder addresses a
+// folder (FolderStore). Message bodies are streamed in chunks.
+type MsgStoreServer interface {
+	List(context.Context, *MailboxRequest) (*ListResponse, error)
+	Retrieve(*MessageRequest, grpc.ServerStreamingServer[Chunk]) error
+	Delete(context.Context, *MessageRequest) (*Empty, error)
+	Expunge(context.Context, *MailboxRequest) (*ExpungeResponse, error)
+	Stat(context.Context, *MailboxRequest) (*StatResponse, error)
+	Deliver(grpc.ClientStreamingServer[Upload, Empty]) error
+	DeliverToFolder(grpc.ClientStreamingServer[Upload, Empty]) error
+	AppendToFolder(grpc.ClientStreamingServer[Upload, UIDResponse]) error
+	CreateFolder(context.Context, *FolderRequest) (*Empty, error)
+	ListFolders(context.Context, *MailboxRequest) (*FoldersResponse, error)
+	DeleteFolder(context.Context, *FolderRequest) (*Empty, error)
+	RenameFolder(context.Context, *FolderRequest) (*Empty, error)
+	SetFlags(context.Context, *SetFlagsRequest) (*Empty, error)
+	CopyMessage(context.Context, *CopyRequest) (*UIDResponse, error)
+	UIDValidity(context.Context, *MailboxRequest) (*UIDValidityResponse, error)
+	mustEmbedUnimplementedMsgStoreServer()
+}
+
+// UnimplementedMsgStoreServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedMsgStoreServer struct{}
+
+func (UnimplementedMsgStoreServer) List(context.Context, *MailboxRequest) (*ListResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedMsgStoreServer) Retrieve(*MessageRequest, grpc.ServerStreamingServer[Chunk]) error {
+	return status.Error(codes.Unimplemented, "method Retrieve not implemented")
+}
+func (UnimplementedMsgStoreServer) Delete(context.Context, *MessageRequest) (*Empty, error) {
+	return nil, status.Error(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedMsgStoreServer) Expunge(context.Context, *MailboxRequest) (*ExpungeResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Expunge not implemented")
+}
+func (UnimplementedMsgStoreServer) Stat(context.Context, *MailboxRequest) (*StatResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method Stat not implemented")
+}
+func (UnimplementedMsgStoreServer) Deliver(grpc.ClientStreamingServer[Upload, Empty]) error {
+	return status.Error(codes.Unimplemented, "method Deliver not implemented")
+}
+func (UnimplementedMsgStoreServer) DeliverToFolder(grpc.ClientStreamingServer[Upload, Empty]) error {
+	return status.Error(codes.Unimplemented, "method DeliverToFolder not implemented")
+}
+func (UnimplementedMsgStoreServer) AppendToFolder(grpc.ClientStreamingServer[Upload, UIDResponse]) error {
+	return status.Error(codes.Unimplemented, "method AppendToFolder not implemented")
+}
+func (UnimplementedMsgStoreServer) CreateFolder(context.Context, *FolderRequest) (*Empty, error) {
+	return nil, status.Error(codes.Unimplemented, "method CreateFolder not implemented")
+}
+func (UnimplementedMsgStoreServer) ListFolders(context.Context, *MailboxRequest) (*FoldersResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method ListFolders not implemented")
+}
+func (UnimplementedMsgStoreServer) DeleteFolder(context.Context, *FolderRequest) (*Empty, error) {
+	return nil, status.Error(codes.Unimplemented, "method DeleteFolder not implemented")
+}
+func (UnimplementedMsgStoreServer) RenameFolder(context.Context, *FolderRequest) (*Empty, error) {
+	return nil, status.Error(codes.Unimplemented, "method RenameFolder not implemented")
+}
+func (UnimplementedMsgStoreServer) SetFlags(context.Context, *SetFlagsRequest) (*Empty, error) {
+	return nil, status.Error(codes.Unimplemented, "method SetFlags not implemented")
+}
+func (UnimplementedMsgStoreServer) CopyMessage(context.Context, *CopyRequest) (*UIDResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method CopyMessage not implemented")
+}
+func (UnimplementedMsgStoreServer) UIDValidity(context.Context, *MailboxRequest) (*UIDValidityResponse, error) {
+	return nil, status.Error(codes.Unimplemented, "method UIDValidity not implemented")
+}
+func (UnimplementedMsgStoreServer) mustEmbedUnimplementedMsgStoreServer() {}
+func (UnimplementedMsgStoreServer) testEmbeddedByValue()                  {}
+
+// UnsafeMsgStoreServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to MsgStoreServer will
+// result in compilation errors.
+type UnsafeMsgStoreServer interface {
+	mustEmbedUnimplementedMsgStoreServer()
+}
+
+func RegisterMsgStoreServer(s grpc.ServiceRegistrar, srv MsgStoreServer) {
+	// If the following call panics, it indicates UnimplementedMsgStoreServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&MsgStore_ServiceDesc, srv)
+}
+
+func _MsgStore_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MailboxRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MsgStoreServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MsgStore_List_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MsgStoreServer).List(ctx, req.(*MailboxRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MsgStore_Retrieve_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(MessageRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(MsgStoreServer).Retrieve(m, &grpc.GenericServerStream[MessageRequest, Chunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MsgStore_RetrieveServer = grpc.ServerStreamingServer[Chunk]
+
+func _MsgStore_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MessageRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MsgStoreServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MsgStore_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MsgStoreServer).Delete(ctx, req.(*MessageRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MsgStore_Expunge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MailboxRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MsgStoreServer).Expunge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MsgStore_Expunge_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MsgStoreServer).Expunge(ctx, req.(*MailboxRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MsgStore_Stat_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MailboxRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MsgStoreServer).Stat(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MsgStore_Stat_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MsgStoreServer).Stat(ctx, req.(*MailboxRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MsgStore_Deliver_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MsgStoreServer).Deliver(&grpc.GenericServerStream[Upload, Empty]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MsgStore_DeliverServer = grpc.ClientStreamingServer[Upload, Empty]
+
+func _MsgStore_DeliverToFolder_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MsgStoreServer).DeliverToFolder(&grpc.GenericServerStream[Upload, Empty]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MsgStore_DeliverToFolderServer = grpc.ClientStreamingServer[Upload, Empty]
+
+func _MsgStore_AppendToFolder_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(MsgStoreServer).AppendToFolder(&grpc.GenericServerStream[Upload, UIDResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type MsgStore_AppendToFolderServer = grpc.ClientStreamingServer[Upload, UIDResponse]
+
+func _MsgStore_CreateFolder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FolderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MsgStoreServer).CreateFolder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MsgStore_CreateFolder_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MsgStoreServer).CreateFolder(ctx, req.(*FolderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MsgStore_ListFolders_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MailboxRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MsgStoreServer).ListFolders(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MsgStore_ListFolders_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MsgStoreServer).ListFolders(ctx, req.(*MailboxRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MsgStore_DeleteFolder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FolderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MsgStoreServer).DeleteFolder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MsgStore_DeleteFolder_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MsgStoreServer).DeleteFolder(ctx, req.(*FolderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MsgStore_RenameFolder_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(FolderRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MsgStoreServer).RenameFolder(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MsgStore_RenameFolder_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MsgStoreServer).RenameFolder(ctx, req.(*FolderRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MsgStore_SetFlags_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetFlagsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MsgStoreServer).SetFlags(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MsgStore_SetFlags_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MsgStoreServer).SetFlags(ctx, req.(*SetFlagsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MsgStore_CopyMessage_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CopyRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MsgStoreServer).CopyMessage(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MsgStore_CopyMessage_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MsgStoreServer).CopyMessage(ctx, req.(*CopyRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _MsgStore_UIDValidity_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(MailboxRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(MsgStoreServer).UIDValidity(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: MsgStore_UIDValidity_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(MsgStoreServer).UIDValidity(ctx, req.(*MailboxRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// MsgStore_ServiceDesc is the grpc.ServiceDesc for MsgStore service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var MsgStore_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "infodancer.msgstore.v1.MsgStore",
+	HandlerType: (*MsgStoreServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "List",
+			Handler:    _MsgStore_List_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _MsgStore_Delete_Handler,
+		},
+		{
+			MethodName: "Expunge",
+			Handler:    _MsgStore_Expunge_Handler,
+		},
+		{
+			MethodName: "Stat",
+			Handler:    _MsgStore_Stat_Handler,
+		},
+		{
+			MethodName: "CreateFolder",
+			Handler:    _MsgStore_CreateFolder_Handler,
+		},
+		{
+			MethodName: "ListFolders",
+			Handler:    _MsgStore_ListFolders_Handler,
+		},
+		{
+			MethodName: "DeleteFolder",
+			Handler:    _MsgStore_DeleteFolder_Handler,
+		},
+		{
+			MethodName: "RenameFolder",
+			Handler:    _MsgStore_RenameFolder_Handler,
+		},
+		{
+			MethodName: "SetFlags",
+			Handler:    _MsgStore_SetFlags_Handler,
+		},
+		{
+			MethodName: "CopyMessage",
+			Handler:    _MsgStore_CopyMessage_Handler,
+		},
+		{
+			MethodName: "UIDValidity",
+			Handler:    _MsgStore_UIDValidity_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Retrieve",
+			Handler:       _MsgStore_Retrieve_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Deliver",
+			Handler:       _MsgStore_Deliver_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "DeliverToFolder",
+			Handler:       _MsgStore_DeliverToFolder_Handler,
+			ClientStreams: true,
+		},
+		{
+			StreamName:    "AppendToFolder",
+			Handler:       _MsgStore_AppendToFolder_Handler,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "msgstorepb/msgstore.proto",
+}
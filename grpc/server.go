@@ -0,0 +1,396 @@
+package grpc
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"time"
+
+	gogrpc "google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+	"github.com/infodancer/msgstore/grpc/msgstorepb"
+)
+
+// Server serves a msgstore.MsgStore as the MsgStore gRPC service. Folder
+// calls are served when the store also implements msgstore.FolderStore and
+// fail with codes.Unimplemented otherwise.
+type Server struct {
+	msgstorepb.UnimplementedMsgStoreServer
+
+	store   msgstore.MsgStore
+	folders msgstore.FolderStore
+	logger  *slog.Logger
+}
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithLogger sets the logger for internal errors. The default is
+// slog.Default().
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// NewServer creates a Server backed by store. Register it with
+// msgstorepb.RegisterMsgStoreServer.
+func NewServer(store msgstore.MsgStore, opts ...Option) *Server {
+	s := &Server{store: store, logger: slog.Default()}
+	s.folders, _ = store.(msgstore.FolderStore)
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Compile-time interface verification.
+var _ msgstorepb.MsgStoreServer = (*Server)(nil)
+
+// folderStore returns the FolderStore, or an error when the store has none.
+func (s *Server) folderStore() (msgstore.FolderStore, error) {
+	if s.folders == nil {
+		return nil, s.toStatus(errors.ErrNotSupported)
+	}
+	return s.folders, nil
+}
+
+// List implements msgstorepb.MsgStoreServer.
+func (s *Server) List(ctx context.Context, req *msgstorepb.MailboxRequest) (*msgstorepb.ListResponse, error) {
+	var msgs []msgstore.MessageInfo
+	var err error
+	if req.GetFolder() == "" {
+		msgs, err = s.store.List(ctx, req.GetMailbox())
+	} else {
+		var fs msgstore.FolderStore
+		if fs, err = s.folderStore(); err != nil {
+			return nil, err
+		}
+		msgs, err = fs.ListInFolder(ctx, req.GetMailbox(), req.GetFolder())
+	}
+	if err != nil {
+		return nil, s.toStatus(err)
+	}
+	resp := &msgstorepb.ListResponse{Messages: make([]*msgstorepb.MessageInfo, len(msgs))}
+	for i, m := range msgs {
+		resp.Messages[i] = messageInfoToProto(m)
+	}
+	return resp, nil
+}
+
+// Retrieve implements msgstorepb.MsgStoreServer.
+func (s *Server) Retrieve(req *msgstorepb.MessageRequest, stream gogrpc.ServerStreamingServer[msgstorepb.Chunk]) error {
+	ctx := stream.Context()
+	var rc io.ReadCloser
+	var err error
+	if req.GetFolder() == "" {
+		rc, err = s.store.Retrieve(ctx, req.GetMailbox(), req.GetUid())
+	} else {
+		var fs msgstore.FolderStore
+		if fs, err = s.folderStore(); err != nil {
+			return err
+		}
+		rc, err = fs.RetrieveFromFolder(ctx, req.GetMailbox(), req.GetFolder(), req.GetUid())
+	}
+	if err != nil {
+		return s.toStatus(err)
+	}
+	defer func() { _ = rc.Close() }()
+
+	buf := make([]byte, chunkSize)
+	for {
+		n, err := rc.Read(buf)
+		if n > 0 {
+			if sendErr := stream.Send(&msgstorepb.Chunk{Data: buf[:n]}); sendErr != nil {
+				return sendErr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return s.toStatus(err)
+		}
+	}
+}
+
+// Delete implements msgstorepb.MsgStoreServer.
+func (s *Server) Delete(ctx context.Context, req *msgstorepb.MessageRequest) (*msgstorepb.Empty, error) {
+	var err error
+	if req.GetFolder() == "" {
+		err = s.store.Delete(ctx, req.GetMailbox(), req.GetUid())
+	} else {
+		var fs msgstore.FolderStore
+		if fs, err = s.folderStore(); err != nil {
+			return nil, err
+		}
+		err = fs.DeleteInFolder(ctx, req.GetMailbox(), req.GetFolder(), req.GetUid())
+	}
+	if err != nil {
+		return nil, s.toStatus(err)
+	}
+	return &msgstorepb.Empty{}, nil
+}
+
+// Expunge implements msgstorepb.MsgStoreServer.
+func (s *Server) Expunge(ctx context.Context, req *msgstorepb.MailboxRequest) (*msgstorepb.ExpungeResponse, error) {
+	var removed []string
+	var err error
+	if req.GetFolder() == "" {
+		removed, err = s.store.Expunge(ctx, req.GetMailbox())
+	} else {
+		var fs msgstore.FolderStore
+		if fs, err = s.folderStore(); err != nil {
+			return nil, err
+		}
+		removed, err = fs.ExpungeFolder(ctx, req.GetMailbox(), req.GetFolder())
+	}
+	if err != nil {
+		return nil, s.toStatus(err)
+	}
+	return &msgstorepb.ExpungeResponse{Removed: removed}, nil
+}
+
+// Stat implements msgstorepb.MsgStoreServer.
+func (s *Server) Stat(ctx context.Context, req *msgstorepb.MailboxRequest) (*msgstorepb.StatResponse, error) {
+	var count int
+	var total int64
+	var err error
+	if req.GetFolder() == "" {
+		count, total, err = s.store.Stat(ctx, req.GetMailbox())
+	} else {
+		var fs msgstore.FolderStore
+		if fs, err = s.folderStore(); err != nil {
+			return nil, err
+		}
+		count, total, err = fs.StatFolder(ctx, req.GetMailbox(), req.GetFolder())
+	}
+	if err != nil {
+		return nil, s.toStatus(err)
+	}
+	return &msgstorepb.StatResponse{Count: int64(count), TotalBytes: total}, nil
+}
+
+// Deliver implements msgstorepb.MsgStoreServer.
+func (s *Server) Deliver(stream gogrpc.ClientStreamingServer[msgstorepb.Upload, msgstorepb.Empty]) error {
+	first, body, err := receiveUpload(stream)
+	if err != nil {
+		return s.toStatus(err)
+	}
+	envelope, err := msgstore.UnmarshalEnvelope(first.GetEnvelope())
+	if err != nil {
+		return s.toStatus(err)
+	}
+	if err := s.store.Deliver(stream.Context(), envelope, body); err != nil {
+		return s.toStatus(err)
+	}
+	return stream.SendAndClose(&msgstorepb.Empty{})
+}
+
+// DeliverToFolder implements msgstorepb.MsgStoreServer.
+func (s *Server) DeliverToFolder(stream gogrpc.ClientStreamingServer[msgstorepb.Upload, msgstorepb.Empty]) error {
+	fs, err := s.folderStore()
+	if err != nil {
+		return err
+	}
+	first, body, err := receiveUpload(stream)
+	if err != nil {
+		return s.toStatus(err)
+	}
+	if err := fs.DeliverToFolder(stream.Context(), first.GetMailbox(), first.GetFolder(), body); err != nil {
+		return s.toStatus(err)
+	}
+	return stream.SendAndClose(&msgstorepb.Empty{})
+}
+
+// AppendToFolder implements msgstorepb.MsgStoreServer.
+func (s *Server) AppendToFolder(stream gogrpc.ClientStreamingServer[msgstorepb.Upload, msgstorepb.UIDResponse]) error {
+	fs, err := s.folderStore()
+	if err != nil {
+		return err
+	}
+	first, body, err := receiveUpload(stream)
+	if err != nil {
+		return s.toStatus(err)
+	}
+	var date time.Time
+	if first.GetDate() != nil {
+		date = first.GetDate().AsTime()
+	}
+	uid, err := fs.AppendToFolder(stream.Context(), first.GetMailbox(), first.GetFolder(), body, first.GetFlags(), date)
+	if err != nil {
+		return s.toStatus(err)
+	}
+	return stream.SendAndClose(&msgstorepb.UIDResponse{Uid: uid})
+}
+
+// CreateFolder implements msgstorepb.MsgStoreServer.
+func (s *Server) CreateFolder(ctx context.Context, req *msgstorepb.FolderRequest) (*msgstorepb.Empty, error) {
+	fs, err := s.folderStore()
+	if err != nil {
+		return nil, err
+	}
+	if err := fs.CreateFolder(ctx, req.GetMailbox(), req.GetFolder()); err != nil {
+		return nil, s.toStatus(err)
+	}
+	return &msgstorepb.Empty{}, nil
+}
+
+// ListFolders implements msgstorepb.MsgStoreServer.
+func (s *Server) ListFolders(ctx context.Context, req *msgstorepb.MailboxRequest) (*msgstorepb.FoldersResponse, error) {
+	fs, err := s.folderStore()
+	if err != nil {
+		return nil, err
+	}
+	folders, err := fs.ListFolders(ctx, req.GetMailbox())
+	if err != nil {
+		return nil, s.toStatus(err)
+	}
+	return &msgstorepb.FoldersResponse{Folders: folders}, nil
+}
+
+// DeleteFolder implements msgstorepb.MsgStoreServer.
+func (s *Server) DeleteFolder(ctx context.Context, req *msgstorepb.FolderRequest) (*msgstorepb.Empty, error) {
+	fs, err := s.folderStore()
+	if err != nil {
+		return nil, err
+	}
+	var opts []msgstore.DeleteFolderOption
+	if req.GetForce() {
+		opts = append(opts, msgstore.WithForce())
+	}
+	if req.GetRecursive() {
+		opts = append(opts, msgstore.WithRecursive())
+	}
+	if err := fs.DeleteFolder(ctx, req.GetMailbox(), req.GetFolder(), opts...); err != nil {
+		return nil, s.toStatus(err)
+	}
+	return &msgstorepb.Empty{}, nil
+}
+
+// RenameFolder implements msgstorepb.MsgStoreServer.
+func (s *Server) RenameFolder(ctx context.Context, req *msgstorepb.FolderRequest) (*msgstorepb.Empty, error) {
+	fs, err := s.folderStore()
+	if err != nil {
+		return nil, err
+	}
+	if err := fs.RenameFolder(ctx, req.GetMailbox(), req.GetFolder(), req.GetNewName()); err != nil {
+		return nil, s.toStatus(err)
+	}
+	return &msgstorepb.Empty{}, nil
+}
+
+// SetFlags implements msgstorepb.MsgStoreServer.
+func (s *Server) SetFlags(ctx context.Context, req *msgstorepb.SetFlagsRequest) (*msgstorepb.Empty, error) {
+	fs, err := s.folderStore()
+	if err != nil {
+		return nil, err
+	}
+	mode := msgstore.FlagMode(req.GetMode())
+	if err := fs.SetFlagsInFolder(ctx, req.GetMailbox(), req.GetFolder(), req.GetUid(), mode, req.GetFlags()); err != nil {
+		return nil, s.toStatus(err)
+	}
+	return &msgstorepb.Empty{}, nil
+}
+
+// CopyMessage implements msgstorepb.MsgStoreServer.
+func (s *Server) CopyMessage(ctx context.Context, req *msgstorepb.CopyRequest) (*msgstorepb.UIDResponse, error) {
+	fs, err := s.folderStore()
+	if err != nil {
+		return nil, err
+	}
+	uid, err := fs.CopyMessage(ctx, req.GetMailbox(), req.GetSrcFolder(), req.GetUid(), req.GetDestFolder())
+	if err != nil {
+		return nil, s.toStatus(err)
+	}
+	return &msgstorepb.UIDResponse{Uid: uid}, nil
+}
+
+// UIDValidity implements msgstorepb.MsgStoreServer.
+func (s *Server) UIDValidity(ctx context.Context, req *msgstorepb.MailboxRequest) (*msgstorepb.UIDValidityResponse, error) {
+	fs, err := s.folderStore()
+	if err != nil {
+		return nil, err
+	}
+	v, err := fs.UIDValidity(ctx, req.GetMailbox(), req.GetFolder())
+	if err != nil {
+		return nil, s.toStatus(err)
+	}
+	return &msgstorepb.UIDValidityResponse{UidValidity: v}, nil
+}
+
+// receiveUpload reads the first message of an upload stream and returns it
+// with a reader over the whole message body.
+func receiveUpload[T any](stream gogrpc.ClientStreamingServer[msgstorepb.Upload, T]) (*msgstorepb.Upload, io.Reader, error) {
+	first, err := stream.Recv()
+	if err == io.EOF {
+		return nil, nil, errors.ErrInvalidEnvelope
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return first, &uploadReader{buf: first.GetData(), recv: stream.Recv}, nil
+}
+
+// uploadReader presents the data of an upload stream as an io.Reader.
+type uploadReader struct {
+	buf  []byte
+	recv func() (*msgstorepb.Upload, error)
+	err  error
+}
+
+func (r *uploadReader) Read(p []byte) (int, error) {
+	for len(r.buf) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		msg, err := r.recv()
+		if err != nil {
+			r.err = err
+			continue
+		}
+		r.buf = msg.GetData()
+	}
+	n := copy(p, r.buf)
+	r.buf = r.buf[n:]
+	return n, nil
+}
+
+func messageInfoToProto(m msgstore.MessageInfo) *msgstorepb.MessageInfo {
+	pm := &msgstorepb.MessageInfo{
+		Uid:       m.UID,
+		Size:      m.Size,
+		Flags:     m.Flags,
+		From:      m.From,
+		Subject:   m.Subject,
+		MessageId: m.MessageID,
+	}
+	if !m.InternalDate.IsZero() {
+		pm.InternalDate = timestamppb.New(m.InternalDate)
+	}
+	if !m.Date.IsZero() {
+		pm.Date = timestamppb.New(m.Date)
+	}
+	return pm
+}
+
+func messageInfoFromProto(pm *msgstorepb.MessageInfo) msgstore.MessageInfo {
+	m := msgstore.MessageInfo{
+		UID:       pm.GetUid(),
+		Size:      pm.GetSize(),
+		Flags:     pm.GetFlags(),
+		From:      pm.GetFrom(),
+		Subject:   pm.GetSubject(),
+		MessageID: pm.GetMessageId(),
+	}
+	if pm.GetInternalDate() != nil {
+		m.InternalDate = pm.GetInternalDate().AsTime()
+	}
+	if pm.GetDate() != nil {
+		m.Date = pm.GetDate().AsTime()
+	}
+	return m
+}
@@ -0,0 +1,504 @@
+// Package httpadmin serves store administration over authenticated
+// HTTP+JSON, so operators and web UIs can manage mailboxes without
+// filesystem access to the store host.
+//
+//	h := httpadmin.NewHandler(store, httpadmin.StaticToken(token),
+//		httpadmin.WithUserManager(users),
+//		httpadmin.WithQuota(quotaFor))
+//	http.ListenAndServeTLS(":8443", cert, key, h)
+//
+// Routes:
+//
+//	GET    /mailboxes/{mailbox}/messages          list or search messages
+//	GET    /mailboxes/{mailbox}/stat              message count and size
+//	GET    /mailboxes/{mailbox}/quota             usage against the quota
+//	GET    /mailboxes/{mailbox}/folders           list folders
+//	POST   /mailboxes/{mailbox}/folders           create a folder
+//	PATCH  /mailboxes/{mailbox}/folders/{folder}  rename a folder
+//	DELETE /mailboxes/{mailbox}/folders/{folder}  delete a folder
+//	GET    /domains/{domain}/mailboxes            list a domain's mailboxes
+//	GET    /users                                 list users
+//	POST   /users                                 create a user
+//	PUT    /users/{user}/password                 set a user's password
+//	DELETE /users/{user}                          delete a user
+//
+// The messages, stat and quota routes take an optional folder query
+// parameter. Message search uses the query parameters has_flag, lacks_flag
+// (both repeatable), since, before (RFC 3339) and min_size, max_size
+// (bytes). Errors are returned as {"error": "...", "code": "..."} with a
+// status code derived from the error's errors.Code, which is also the
+// "code" member.
+package httpadmin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+// Authenticator authenticates an admin request and returns the principal
+// making it. The principal is recorded as the audit actor of the operations
+// the request performs.
+type Authenticator func(r *http.Request) (principal string, err error)
+
+// StaticToken returns an Authenticator accepting requests that carry token
+// as a bearer token ("Authorization: Bearer <token>").
+func StaticToken(token string) Authenticator {
+	return func(r *http.Request) (string, error) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			return "", errors.ErrPermissionDenied
+		}
+		return "admin", nil
+	}
+}
+
+// UserManager manages the accounts that own mailboxes. Account storage
+// belongs to the authentication backend, which implements this interface
+// to expose user management through the admin API.
+type UserManager interface {
+	// ListUsers returns all usernames.
+	ListUsers(ctx context.Context) ([]string, error)
+
+	// CreateUser creates a user with an initial password.
+	CreateUser(ctx context.Context, username string, password string) error
+
+	// DeleteUser removes a user. Mail in the user's mailbox is not deleted.
+	DeleteUser(ctx context.Context, username string) error
+
+	// SetPassword replaces a user's password.
+	SetPassword(ctx context.Context, username string, password string) error
+}
+
+// QuotaFunc returns the storage limit in bytes for a mailbox, or 0 for
+// unlimited.
+type QuotaFunc func(ctx context.Context, mailbox string) (limit int64, err error)
+
+// Option configures a Handler.
+type Option func(*Handler)
+
+// WithUserManager enables the /users routes.
+func WithUserManager(m UserManager) Option {
+	return func(h *Handler) {
+		h.users = m
+	}
+}
+
+// WithQuota sets the source of quota limits reported by the quota route.
+// Without it, every mailbox is reported as unlimited.
+func WithQuota(fn QuotaFunc) Option {
+	return func(h *Handler) {
+		h.quota = fn
+	}
+}
+
+// WithLogger sets the logger for request failures. The default is
+// slog.Default().
+func WithLogger(logger *slog.Logger) Option {
+	return func(h *Handler) {
+		h.logger = logger
+	}
+}
+
+// Handler is the admin API http.Handler.
+type Handler struct {
+	store   msgstore.MessageStore
+	folders msgstore.FolderStore
+	lister  msgstore.MessageLister
+	domains msgstore.DomainLister
+	authn   Authenticator
+	users   UserManager
+	quota   QuotaFunc
+	logger  *slog.Logger
+	mux     *http.ServeMux
+}
+
+// NewHandler creates an admin API over store. Every request must pass
+// authn. Folder routes require store to implement msgstore.FolderStore,
+// and the domain route msgstore.DomainLister.
+func NewHandler(store msgstore.MessageStore, authn Authenticator, opts ...Option) *Handler {
+	h := &Handler{
+		store:  store,
+		authn:  authn,
+		logger: slog.Default(),
+		mux:    http.NewServeMux(),
+	}
+	h.folders, _ = store.(msgstore.FolderStore)
+	h.lister, _ = store.(msgstore.MessageLister)
+	h.domains, _ = store.(msgstore.DomainLister)
+	for _, opt := range opts {
+		opt(h)
+	}
+
+	h.mux.HandleFunc("GET /mailboxes/{mailbox}/messages", h.listMessages)
+	h.mux.HandleFunc("GET /mailboxes/{mailbox}/stat", h.stat)
+	h.mux.HandleFunc("GET /mailboxes/{mailbox}/quota", h.quotaUsage)
+	h.mux.HandleFunc("GET /mailboxes/{mailbox}/folders", h.listFolders)
+	h.mux.HandleFunc("POST /mailboxes/{mailbox}/folders", h.createFolder)
+	h.mux.HandleFunc("PATCH /mailboxes/{mailbox}/folders/{folder...}", h.renameFolder)
+	h.mux.HandleFunc("DELETE /mailboxes/{mailbox}/folders/{folder...}", h.deleteFolder)
+	h.mux.HandleFunc("GET /domains/{domain}/mailboxes", h.listDomainMailboxes)
+	h.mux.HandleFunc("GET /users", h.listUsers)
+	h.mux.HandleFunc("POST /users", h.createUser)
+	h.mux.HandleFunc("PUT /users/{user}/password", h.setPassword)
+	h.mux.HandleFunc("DELETE /users/{user}", h.deleteUser)
+	return h
+}
+
+// ServeHTTP implements http.Handler.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	principal, err := h.authn(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="msgstore"`)
+		writeJSON(w, http.StatusUnauthorized, errorBody{Error: "unauthorized"})
+		return
+	}
+	ctx := msgstore.WithActor(r.Context(), "httpadmin:"+principal)
+	h.mux.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// Stat is the body of the stat route.
+type Stat struct {
+	Count      int   `json:"count"`
+	TotalBytes int64 `json:"total_bytes"`
+}
+
+// Quota is the body of the quota route. Limit is 0 when unlimited.
+type Quota struct {
+	Used     int64 `json:"used"`
+	Limit    int64 `json:"limit"`
+	Messages int   `json:"messages"`
+}
+
+type errorBody struct {
+	Error string `json:"error"`
+	Code  string `json:"code,omitempty"`
+}
+
+type messagesBody struct {
+	Messages []msgstore.MessageInfo `json:"messages"`
+}
+
+type foldersBody struct {
+	Folders []string `json:"folders"`
+}
+
+type mailboxesBody struct {
+	Mailboxes []string `json:"mailboxes"`
+}
+
+type folderRequest struct {
+	Name string `json:"name"`
+}
+
+type userRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type usersBody struct {
+	Users []string `json:"users"`
+}
+
+func (h *Handler) listMessages(w http.ResponseWriter, r *http.Request) {
+	mailbox, folder := r.PathValue("mailbox"), r.URL.Query().Get("folder")
+	filter, filtered, err := parseFilter(r)
+	if err != nil {
+		h.fail(w, r, err)
+		return
+	}
+
+	var msgs []msgstore.MessageInfo
+	switch {
+	case filtered && h.lister != nil:
+		msgs, err = h.lister.ListWithFilter(r.Context(), mailbox, folder, filter)
+	case folder == "":
+		msgs, err = h.store.List(r.Context(), mailbox)
+	case h.folders == nil:
+		err = errors.ErrNotSupported
+	default:
+		msgs, err = h.folders.ListInFolder(r.Context(), mailbox, folder)
+	}
+	if err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	if filtered && h.lister == nil {
+		matched := msgs[:0]
+		for _, m := range msgs {
+			if filter.Matches(m) {
+				matched = append(matched, m)
+			}
+		}
+		msgs = matched
+	}
+	if msgs == nil {
+		msgs = []msgstore.MessageInfo{}
+	}
+	writeJSON(w, http.StatusOK, messagesBody{Messages: msgs})
+}
+
+func (h *Handler) stat(w http.ResponseWriter, r *http.Request) {
+	count, total, err := h.statFolder(r)
+	if err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, Stat{Count: count, TotalBytes: total})
+}
+
+func (h *Handler) quotaUsage(w http.ResponseWriter, r *http.Request) {
+	count, total, err := h.statFolder(r)
+	if err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	q := Quota{Used: total, Messages: count}
+	if h.quota != nil {
+		if q.Limit, err = h.quota(r.Context(), r.PathValue("mailbox")); err != nil {
+			h.fail(w, r, err)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, q)
+}
+
+func (h *Handler) statFolder(r *http.Request) (int, int64, error) {
+	mailbox, folder := r.PathValue("mailbox"), r.URL.Query().Get("folder")
+	if folder == "" {
+		return h.store.Stat(r.Context(), mailbox)
+	}
+	if h.folders == nil {
+		return 0, 0, errors.ErrNotSupported
+	}
+	return h.folders.StatFolder(r.Context(), mailbox, folder)
+}
+
+func (h *Handler) listFolders(w http.ResponseWriter, r *http.Request) {
+	if h.folders == nil {
+		h.fail(w, r, errors.ErrNotSupported)
+		return
+	}
+	folders, err := h.folders.ListFolders(r.Context(), r.PathValue("mailbox"))
+	if err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, foldersBody{Folders: folders})
+}
+
+func (h *Handler) createFolder(w http.ResponseWriter, r *http.Request) {
+	var req folderRequest
+	if err := decodeJSON(r, &req); err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	if h.folders == nil {
+		h.fail(w, r, errors.ErrNotSupported)
+		return
+	}
+	if err := h.folders.CreateFolder(r.Context(), r.PathValue("mailbox"), req.Name); err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (h *Handler) renameFolder(w http.ResponseWriter, r *http.Request) {
+	var req folderRequest
+	if err := decodeJSON(r, &req); err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	if h.folders == nil {
+		h.fail(w, r, errors.ErrNotSupported)
+		return
+	}
+	if err := h.folders.RenameFolder(r.Context(), r.PathValue("mailbox"), r.PathValue("folder"), req.Name); err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) deleteFolder(w http.ResponseWriter, r *http.Request) {
+	if h.folders == nil {
+		h.fail(w, r, errors.ErrNotSupported)
+		return
+	}
+	var opts []msgstore.DeleteFolderOption
+	if r.URL.Query().Get("force") == "true" {
+		opts = append(opts, msgstore.WithForce())
+	}
+	if r.URL.Query().Get("recursive") == "true" {
+		opts = append(opts, msgstore.WithRecursive())
+	}
+	if err := h.folders.DeleteFolder(r.Context(), r.PathValue("mailbox"), r.PathValue("folder"), opts...); err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) listDomainMailboxes(w http.ResponseWriter, r *http.Request) {
+	if h.domains == nil {
+		h.fail(w, r, errors.ErrNotSupported)
+		return
+	}
+	mailboxes, err := h.domains.ListMailboxesByDomain(r.Context(), r.PathValue("domain"))
+	if err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, mailboxesBody{Mailboxes: mailboxes})
+}
+
+func (h *Handler) listUsers(w http.ResponseWriter, r *http.Request) {
+	if h.users == nil {
+		h.fail(w, r, errors.ErrNotSupported)
+		return
+	}
+	users, err := h.users.ListUsers(r.Context())
+	if err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, usersBody{Users: users})
+}
+
+func (h *Handler) createUser(w http.ResponseWriter, r *http.Request) {
+	var req userRequest
+	if err := decodeJSON(r, &req); err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	if h.users == nil {
+		h.fail(w, r, errors.ErrNotSupported)
+		return
+	}
+	if err := h.users.CreateUser(r.Context(), req.Username, req.Password); err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (h *Handler) setPassword(w http.ResponseWriter, r *http.Request) {
+	var req userRequest
+	if err := decodeJSON(r, &req); err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	if h.users == nil {
+		h.fail(w, r, errors.ErrNotSupported)
+		return
+	}
+	if err := h.users.SetPassword(r.Context(), r.PathValue("user"), req.Password); err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) deleteUser(w http.ResponseWriter, r *http.Request) {
+	if h.users == nil {
+		h.fail(w, r, errors.ErrNotSupported)
+		return
+	}
+	if err := h.users.DeleteUser(r.Context(), r.PathValue("user")); err != nil {
+		h.fail(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// codeBadRequest is the code of errBadRequest.
+const codeBadRequest errors.Code = "BAD_REQUEST"
+
+// errBadRequest marks malformed request bodies and query parameters.
+var errBadRequest = errors.New(codeBadRequest, "bad request")
+
+// parseFilter builds a ListFilter from the search query parameters and
+// reports whether any were given.
+func parseFilter(r *http.Request) (msgstore.ListFilter, bool, error) {
+	q := r.URL.Query()
+	f := msgstore.ListFilter{HasFlags: q["has_flag"], LacksFlags: q["lacks_flag"]}
+	var err error
+	for name, t := range map[string]*time.Time{"since": &f.Since, "before": &f.Before} {
+		if v := q.Get(name); v != "" {
+			if *t, err = time.Parse(time.RFC3339, v); err != nil {
+				return f, false, fmt.Errorf("%w: %s: %v", errBadRequest, name, err)
+			}
+		}
+	}
+	for name, n := range map[string]*int64{"min_size": &f.MinSize, "max_size": &f.MaxSize} {
+		if v := q.Get(name); v != "" {
+			if *n, err = strconv.ParseInt(v, 10, 64); err != nil {
+				return f, false, fmt.Errorf("%w: %s: %v", errBadRequest, name, err)
+			}
+		}
+	}
+	filtered := len(f.HasFlags) > 0 || len(f.LacksFlags) > 0 || !f.Since.IsZero() ||
+		!f.Before.IsZero() || f.MinSize > 0 || f.MaxSize > 0
+	return f, filtered, nil
+}
+
+func decodeJSON(r *http.Request, v any) error {
+	dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("%w: %v", errBadRequest, err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// statusCodes maps error codes to HTTP status codes.
+var statusCodes = map[errors.Code]int{
+	codeBadRequest:               http.StatusBadRequest,
+	errors.CodeMailboxNotFound:   http.StatusNotFound,
+	errors.CodeMessageNotFound:   http.StatusNotFound,
+	errors.CodeFolderNotFound:    http.StatusNotFound,
+	errors.CodeMaildirNotFound:   http.StatusNotFound,
+	errors.CodeRecipientNotFound: http.StatusNotFound,
+	errors.CodeUserNotFound:      http.StatusNotFound,
+	errors.CodeFolderExists:      http.StatusConflict,
+	errors.CodeFolderNotEmpty:    http.StatusConflict,
+	errors.CodeMailboxLocked:     http.StatusConflict,
+	errors.CodeInvalidFolderName: http.StatusBadRequest,
+	errors.CodeInvalidAddress:    http.StatusBadRequest,
+	errors.CodeInvalidPath:       http.StatusBadRequest,
+	errors.CodePathTraversal:     http.StatusBadRequest,
+	errors.CodePermissionDenied:  http.StatusForbidden,
+	errors.CodeNotSupported:      http.StatusNotImplemented,
+}
+
+// fail writes err as a JSON error with its code. Errors without a mapping
+// are logged and reported as 500 without their text, which may reveal
+// filesystem paths.
+func (h *Handler) fail(w http.ResponseWriter, r *http.Request, err error) {
+	code := errors.CodeOf(err)
+	if status, ok := statusCodes[code]; ok {
+		writeJSON(w, status, errorBody{Error: err.Error(), Code: string(code)})
+		return
+	}
+	h.logger.Error("admin request failed",
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.Path),
+		slog.String("error", err.Error()))
+	writeJSON(w, http.StatusInternalServerError, errorBody{Error: "internal error"})
+}
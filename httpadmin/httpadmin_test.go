@@ -0,0 +1,198 @@
+package httpadmin_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/httpadmin"
+	"github.com/infodancer/msgstore/maildir"
+)
+
+const token = "secret"
+
+// memUsers is an in-memory UserManager.
+type memUsers map[string]string
+
+func (m memUsers) ListUsers(context.Context) ([]string, error) {
+	var users []string
+	for u := range m {
+		users = append(users, u)
+	}
+	sort.Strings(users)
+	return users, nil
+}
+
+func (m memUsers) CreateUser(_ context.Context, username, password string) error {
+	m[username] = password
+	return nil
+}
+
+func (m memUsers) DeleteUser(_ context.Context, username string) error {
+	delete(m, username)
+	return nil
+}
+
+func (m memUsers) SetPassword(_ context.Context, username, password string) error {
+	m[username] = password
+	return nil
+}
+
+// do sends an authenticated request and decodes a JSON response into out.
+func do(t *testing.T, h http.Handler, method, path, body string, out any) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if out != nil && rec.Code < 300 {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: decoding %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+func TestHandler_Unauthorized(t *testing.T) {
+	h := httpadmin.NewHandler(maildir.NewStore(t.TempDir(), "", ""), httpadmin.StaticToken(token))
+	req := httptest.NewRequest(http.MethodGet, "/mailboxes/user@example.com/stat", nil)
+	req.Header.Set("Authorization", "Bearer wrong")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want 401", rec.Code)
+	}
+}
+
+func TestHandler_Mailbox(t *testing.T) {
+	store := maildir.NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+	mailbox := "user@example.com"
+	if _, err := store.AppendMultiple(ctx, mailbox, "INBOX", []msgstore.AppendItem{
+		{Message: strings.NewReader("Subject: read\r\n\r\n"), Flags: []string{"\\Seen"}},
+		{Message: strings.NewReader("Subject: unread\r\n\r\n")},
+	}); err != nil {
+		t.Fatalf("AppendMultiple: %v", err)
+	}
+	h := httpadmin.NewHandler(store, httpadmin.StaticToken(token),
+		httpadmin.WithQuota(func(context.Context, string) (int64, error) { return 1000, nil }))
+
+	var list struct {
+		Messages []msgstore.MessageInfo `json:"messages"`
+	}
+	if code := do(t, h, "GET", "/mailboxes/user@example.com/messages", "", &list); code != 200 || len(list.Messages) != 2 {
+		t.Errorf("list: status %d, %d messages; want 200, 2", code, len(list.Messages))
+	}
+	if code := do(t, h, "GET", "/mailboxes/user@example.com/messages?lacks_flag=%5CSeen", "", &list); code != 200 || len(list.Messages) != 1 {
+		t.Errorf("search: status %d, %d messages; want 200, 1", code, len(list.Messages))
+	}
+	if code := do(t, h, "GET", "/mailboxes/user@example.com/messages?since=yesterday", "", nil); code != http.StatusBadRequest {
+		t.Errorf("bad search: status %d, want 400", code)
+	}
+
+	var stat httpadmin.Stat
+	if code := do(t, h, "GET", "/mailboxes/user@example.com/stat", "", &stat); code != 200 || stat.Count != 2 {
+		t.Errorf("stat: status %d, %+v", code, stat)
+	}
+	var quota httpadmin.Quota
+	if code := do(t, h, "GET", "/mailboxes/user@example.com/quota", "", &quota); code != 200 || quota.Limit != 1000 || quota.Used != stat.TotalBytes {
+		t.Errorf("quota: status %d, %+v; want limit 1000, used %d", code, quota, stat.TotalBytes)
+	}
+}
+
+func TestHandler_Folders(t *testing.T) {
+	h := httpadmin.NewHandler(maildir.NewStore(t.TempDir(), "", "", maildir.WithHierarchyDelimiter("/")), httpadmin.StaticToken(token))
+	base := "/mailboxes/user@example.com/folders"
+
+	if code := do(t, h, "POST", base, `{"name":"Work"}`, nil); code != http.StatusCreated {
+		t.Fatalf("create: status %d", code)
+	}
+	if code := do(t, h, "POST", base, `{"name":"Work"}`, nil); code != http.StatusConflict {
+		t.Errorf("create twice: status %d, want 409", code)
+	}
+	if code := do(t, h, "POST", base, `{"name":"Work/2024"}`, nil); code != http.StatusCreated {
+		t.Fatalf("create nested: status %d", code)
+	}
+	if code := do(t, h, "PATCH", base+"/Work/2024", `{"name":"Work/Archive"}`, nil); code != http.StatusNoContent {
+		t.Errorf("rename: status %d", code)
+	}
+	var folders struct {
+		Folders []string `json:"folders"`
+	}
+	if code := do(t, h, "GET", base, "", &folders); code != 200 || !contains(folders.Folders, "Work/Archive") {
+		t.Errorf("list: status %d, %v; want Work/Archive", code, folders.Folders)
+	}
+	if code := do(t, h, "DELETE", base+"/Missing", "", nil); code != http.StatusNotFound {
+		t.Errorf("delete missing: status %d, want 404", code)
+	}
+	if code := do(t, h, "DELETE", base+"/Work?recursive=true", "", nil); code != http.StatusNoContent {
+		t.Errorf("delete: status %d", code)
+	}
+}
+
+func TestHandler_DomainMailboxes(t *testing.T) {
+	store := maildir.NewStore(t.TempDir(), "", "{domain}/{localpart}")
+	envelope := msgstore.Envelope{Recipients: []string{"bob@example.com", "alice@example.com", "carol@example.org"}}
+	if err := store.Deliver(context.Background(), envelope, strings.NewReader("Subject: hi\r\n\r\n")); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	h := httpadmin.NewHandler(store, httpadmin.StaticToken(token))
+
+	var body struct {
+		Mailboxes []string `json:"mailboxes"`
+	}
+	if code := do(t, h, "GET", "/domains/example.com/mailboxes", "", &body); code != 200 || strings.Join(body.Mailboxes, ",") != "alice@example.com,bob@example.com" {
+		t.Errorf("list: status %d, %v", code, body.Mailboxes)
+	}
+
+	h = httpadmin.NewHandler(maildir.NewStore(t.TempDir(), "", ""), httpadmin.StaticToken(token))
+	req := httptest.NewRequest("GET", "/domains/example.com/mailboxes", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	var failure struct {
+		Code string `json:"code"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &failure); err != nil || rec.Code != http.StatusNotImplemented || failure.Code != "NOT_SUPPORTED" {
+		t.Errorf("default layout: status %d, body %s; want 501 with code NOT_SUPPORTED", rec.Code, rec.Body)
+	}
+}
+
+func TestHandler_Users(t *testing.T) {
+	store := maildir.NewStore(t.TempDir(), "", "")
+	if code := do(t, httpadmin.NewHandler(store, httpadmin.StaticToken(token)), "GET", "/users", "", nil); code != http.StatusNotImplemented {
+		t.Errorf("without UserManager: status %d, want 501", code)
+	}
+
+	users := memUsers{}
+	h := httpadmin.NewHandler(store, httpadmin.StaticToken(token), httpadmin.WithUserManager(users))
+	if code := do(t, h, "POST", "/users", `{"username":"alice@example.com","password":"pw"}`, nil); code != http.StatusCreated {
+		t.Fatalf("create: status %d", code)
+	}
+	if code := do(t, h, "PUT", "/users/alice@example.com/password", `{"password":"new"}`, nil); code != http.StatusNoContent || users["alice@example.com"] != "new" {
+		t.Errorf("set password: status %d, password %q", code, users["alice@example.com"])
+	}
+	var list struct {
+		Users []string `json:"users"`
+	}
+	if code := do(t, h, "GET", "/users", "", &list); code != 200 || len(list.Users) != 1 {
+		t.Errorf("list: status %d, %v", code, list.Users)
+	}
+	if code := do(t, h, "DELETE", "/users/alice@example.com", "", nil); code != http.StatusNoContent || len(users) != 0 {
+		t.Errorf("delete: status %d, users %v", code, users)
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package msgstore
+
+import (
+	"context"
+	"time"
+)
+
+// ImportOptions turns a delivery into an import of an existing message,
+// such as an archive being migrated or a copy of a sent message saved by a
+// client. An imported message is stored as already seen by the store
+// rather than as new mail: it carries Flags and has Date as its internal
+// date, and it is never \Recent.
+type ImportOptions struct {
+	// Flags are the IMAP flags and keywords the message is stored with,
+	// e.g. "\\Seen".
+	Flags []string
+
+	// Date is the message's internal date. The zero time means the time
+	// of delivery.
+	Date time.Time
+}
+
+// importKey is the context key for import options.
+type importKey struct{}
+
+// WithImport returns a context under which DeliveryAgent.Deliver and
+// FolderStore.DeliverToFolder import messages as described by opts. Stores
+// that do not support imports deliver the message as usual.
+func WithImport(ctx context.Context, opts ImportOptions) context.Context {
+	return context.WithValue(ctx, importKey{}, opts)
+}
+
+// ImportFromContext returns the import options set with WithImport, and
+// whether the delivery is an import.
+func ImportFromContext(ctx context.Context) (opts ImportOptions, ok bool) {
+	opts, ok = ctx.Value(importKey{}).(ImportOptions)
+	return opts, ok
+}
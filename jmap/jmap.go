@@ -0,0 +1,320 @@
+// Package jmap maps msgstore folders and messages onto the JMAP Mail data
+// model (RFC 8621), so that a JMAP server can be layered on this module.
+//
+// An Adapter serves one store. JMAP accounts are msgstore mailboxes, JMAP
+// Mailbox objects are folders (with INBOX as the inbox role), and Email
+// objects are messages:
+//
+//	adapter, err := jmap.NewAdapter(store)
+//	mailboxes, err := adapter.Mailboxes(ctx, "user@example.com")
+//	emails, state, err := adapter.Emails(ctx, "user@example.com", mailboxes[0].ID)
+//	changes, err := adapter.EmailChanges(ctx, "user@example.com", mailboxes[0].ID, state)
+//
+// IDs are opaque URL-safe strings derived from folder names and message
+// UIDs. Email ids are therefore scoped to their folder rather than
+// immutable as RFC 8620 recommends: moving a message to another Mailbox
+// destroys its Email and creates one with a new id. States are msgstore sync tokens, so Email/changes is built on
+// msgstore.SyncStore and is tracked per Mailbox. The adapter only maps
+// data; JMAP request handling, blobs and submission belong to the server.
+package jmap
+
+import (
+	"context"
+	"encoding/base64"
+	"net/mail"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+// Mailbox is a JMAP Mailbox object (RFC 8621 section 2).
+type Mailbox struct {
+	ID           string  `json:"id"`
+	Name         string  `json:"name"`
+	ParentID     *string `json:"parentId"`
+	Role         *string `json:"role"`
+	SortOrder    int     `json:"sortOrder"`
+	TotalEmails  int     `json:"totalEmails"`
+	UnreadEmails int     `json:"unreadEmails"`
+}
+
+// EmailAddress is a JMAP EmailAddress (RFC 8621 section 4.1.2.3).
+type EmailAddress struct {
+	Name  string `json:"name,omitempty"`
+	Email string `json:"email"`
+}
+
+// Email is a JMAP Email object (RFC 8621 section 4) with the metadata and
+// header properties the store can supply without parsing bodies.
+type Email struct {
+	ID         string          `json:"id"`
+	BlobID     string          `json:"blobId"`
+	ThreadID   string          `json:"threadId"`
+	MailboxIDs map[string]bool `json:"mailboxIds"`
+	Keywords   map[string]bool `json:"keywords"`
+	Size       int64           `json:"size"`
+	ReceivedAt time.Time       `json:"receivedAt"`
+	MessageID  []string        `json:"messageId,omitempty"`
+	From       []EmailAddress  `json:"from,omitempty"`
+	Subject    string          `json:"subject,omitempty"`
+	SentAt     *time.Time      `json:"sentAt,omitempty"`
+}
+
+// EmailSubmission is a JMAP EmailSubmission object (RFC 8621 section 7).
+// The adapter does not send mail; the type is provided for servers that
+// implement submission themselves.
+type EmailSubmission struct {
+	ID         string `json:"id"`
+	IdentityID string `json:"identityId"`
+	EmailID    string `json:"emailId"`
+	UndoStatus string `json:"undoStatus"`
+}
+
+// Changes is the result of Email/changes (RFC 8620 section 5.2).
+type Changes struct {
+	OldState  string   `json:"oldState"`
+	NewState  string   `json:"newState"`
+	Created   []string `json:"created"`
+	Updated   []string `json:"updated"`
+	Destroyed []string `json:"destroyed"`
+}
+
+// keywords maps IMAP system flags to JMAP keywords (RFC 8621 section 4.1.1).
+// Other system flags have no keyword; IMAP keywords are passed through,
+// lowercased.
+var keywords = map[string]string{
+	"\\Seen":     "$seen",
+	"\\Flagged":  "$flagged",
+	"\\Answered": "$answered",
+	"\\Draft":    "$draft",
+}
+
+// Adapter serves JMAP objects from a store.
+type Adapter struct {
+	folders   msgstore.FolderStore
+	sync      msgstore.SyncStore
+	delimiter string
+}
+
+// NewAdapter returns an adapter for store, which must implement
+// msgstore.FolderStore and msgstore.SyncStore. Returns ErrNotSupported
+// otherwise.
+func NewAdapter(store msgstore.MessageStore) (*Adapter, error) {
+	folders, ok := store.(msgstore.FolderStore)
+	if !ok {
+		return nil, errors.ErrNotSupported
+	}
+	sync, ok := store.(msgstore.SyncStore)
+	if !ok {
+		return nil, errors.ErrNotSupported
+	}
+	a := &Adapter{folders: folders, sync: sync, delimiter: "."}
+	if cs, ok := store.(msgstore.CapabilityStore); ok {
+		a.delimiter = cs.Capabilities().HierarchyDelimiter
+	}
+	return a, nil
+}
+
+// MailboxID returns the JMAP id of folder ("INBOX" for the inbox).
+func MailboxID(folder string) string {
+	return "M" + base64.RawURLEncoding.EncodeToString([]byte(folder))
+}
+
+// ParseMailboxID returns the folder a MailboxID names.
+func ParseMailboxID(id string) (folder string, err error) {
+	rest, ok := strings.CutPrefix(id, "M")
+	if !ok {
+		return "", errors.ErrInvalidID
+	}
+	b, err := base64.RawURLEncoding.DecodeString(rest)
+	if err != nil || len(b) == 0 {
+		return "", errors.ErrInvalidID
+	}
+	return string(b), nil
+}
+
+// EmailID returns the JMAP id of the message uid in folder. The blob id of
+// the message is the same with a "B" prefix instead of "E".
+func EmailID(folder, uid string) string {
+	return "E" + base64.RawURLEncoding.EncodeToString([]byte(folder+"\x00"+uid))
+}
+
+// ParseEmailID returns the folder and UID an EmailID or blob id names.
+func ParseEmailID(id string) (folder, uid string, err error) {
+	if id == "" || (id[0] != 'E' && id[0] != 'B') {
+		return "", "", errors.ErrInvalidID
+	}
+	b, err := base64.RawURLEncoding.DecodeString(id[1:])
+	if err != nil {
+		return "", "", errors.ErrInvalidID
+	}
+	folder, uid, ok := strings.Cut(string(b), "\x00")
+	if !ok || folder == "" || uid == "" {
+		return "", "", errors.ErrInvalidID
+	}
+	return folder, uid, nil
+}
+
+// Mailboxes returns the Mailbox objects of account: INBOX first, then the
+// folders in name order.
+func (a *Adapter) Mailboxes(ctx context.Context, account string) ([]Mailbox, error) {
+	folders, err := a.folders.ListFolders(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(folders)
+	known := map[string]bool{"INBOX": true}
+	for _, f := range folders {
+		known[f] = true
+	}
+
+	mailboxes := make([]Mailbox, 0, len(folders)+1)
+	for i, folder := range append([]string{"INBOX"}, folders...) {
+		m := Mailbox{ID: MailboxID(folder), Name: folder, SortOrder: i}
+		if parent, name, ok := a.splitParent(folder); ok && known[parent] {
+			id := MailboxID(parent)
+			m.ParentID, m.Name = &id, name
+		}
+		if role := roleFor(folder); role != "" {
+			m.Role = &role
+		}
+		if err := a.count(ctx, account, folder, &m); err != nil {
+			return nil, err
+		}
+		mailboxes = append(mailboxes, m)
+	}
+	return mailboxes, nil
+}
+
+// splitParent splits folder at its last hierarchy delimiter.
+func (a *Adapter) splitParent(folder string) (parent, name string, ok bool) {
+	i := strings.LastIndex(folder, a.delimiter)
+	if i <= 0 {
+		return "", "", false
+	}
+	return folder[:i], folder[i+len(a.delimiter):], true
+}
+
+// roleFor returns the JMAP role of folder, from its SPECIAL-USE attribute.
+func roleFor(folder string) string {
+	if folder == "INBOX" {
+		return "inbox"
+	}
+	return strings.ToLower(strings.TrimPrefix(msgstore.SpecialUseFor(folder), "\\"))
+}
+
+// count fills in the message counters of m.
+func (a *Adapter) count(ctx context.Context, account, folder string, m *Mailbox) error {
+	if ss, ok := a.folders.(msgstore.StatusStore); ok {
+		status, err := ss.Status(ctx, account, folder)
+		if err != nil {
+			return err
+		}
+		m.TotalEmails, m.UnreadEmails = status.Messages, status.Unseen
+		return nil
+	}
+	messages, err := a.folders.ListInFolder(ctx, account, folder)
+	if err != nil {
+		return err
+	}
+	m.TotalEmails = len(messages)
+	for _, msg := range messages {
+		if !emailFrom(folder, msg).Keywords["$seen"] {
+			m.UnreadEmails++
+		}
+	}
+	return nil
+}
+
+// Emails returns the Email objects in a Mailbox, together with the state to
+// pass to EmailChanges later.
+func (a *Adapter) Emails(ctx context.Context, account string, mailboxID string) ([]Email, string, error) {
+	folder, err := ParseMailboxID(mailboxID)
+	if err != nil {
+		return nil, "", err
+	}
+	changes, err := a.sync.ChangesSince(ctx, account, folder, "")
+	if err != nil {
+		return nil, "", err
+	}
+	emails := make([]Email, 0, len(changes.Added))
+	for _, msg := range changes.Added {
+		emails = append(emails, emailFrom(folder, msg))
+	}
+	return emails, changes.Token, nil
+}
+
+// EmailChanges returns the ids of Email objects in a Mailbox created,
+// updated or destroyed since state. Returns ErrCannotCalculateChanges if
+// state is too old, in which case the client calls Emails again.
+func (a *Adapter) EmailChanges(ctx context.Context, account string, mailboxID string, state string) (Changes, error) {
+	folder, err := ParseMailboxID(mailboxID)
+	if err != nil {
+		return Changes{}, err
+	}
+	if state == "" {
+		return Changes{}, errors.ErrInvalidSyncToken
+	}
+	delta, err := a.sync.ChangesSince(ctx, account, folder, state)
+	if err != nil {
+		return Changes{}, err
+	}
+	if delta.Reset {
+		return Changes{}, errors.ErrCannotCalculateChanges
+	}
+	changes := Changes{OldState: state, NewState: delta.Token, Created: []string{}, Updated: []string{}, Destroyed: []string{}}
+	for _, msg := range delta.Added {
+		changes.Created = append(changes.Created, EmailID(folder, msg.UID))
+	}
+	for _, msg := range delta.Updated {
+		changes.Updated = append(changes.Updated, EmailID(folder, msg.UID))
+	}
+	for _, uid := range delta.Removed {
+		changes.Destroyed = append(changes.Destroyed, EmailID(folder, uid))
+	}
+	return changes, nil
+}
+
+// SubmitEmail is the EmailSubmission/set stub: the adapter does not send
+// mail and always returns ErrNotSupported.
+func (a *Adapter) SubmitEmail(ctx context.Context, account string, submission EmailSubmission) (EmailSubmission, error) {
+	return EmailSubmission{}, errors.ErrNotSupported
+}
+
+// emailFrom builds the Email object for a message in folder.
+func emailFrom(folder string, msg msgstore.MessageInfo) Email {
+	id := EmailID(folder, msg.UID)
+	e := Email{
+		ID:         id,
+		BlobID:     "B" + id[1:],
+		ThreadID:   "T" + id[1:], // no threading: each message is its own thread
+		MailboxIDs: map[string]bool{MailboxID(folder): true},
+		Keywords:   make(map[string]bool),
+		Size:       msg.Size,
+		ReceivedAt: msg.InternalDate.UTC(),
+		Subject:    msg.Subject,
+	}
+	for _, flag := range msg.Flags {
+		if kw, ok := keywords[flag]; ok {
+			e.Keywords[kw] = true
+		} else if !strings.HasPrefix(flag, "\\") {
+			e.Keywords[strings.ToLower(flag)] = true
+		}
+	}
+	if msg.MessageID != "" {
+		e.MessageID = []string{strings.Trim(msg.MessageID, "<>")}
+	}
+	if !msg.Date.IsZero() {
+		sent := msg.Date.UTC()
+		e.SentAt = &sent
+	}
+	if addrs, err := mail.ParseAddressList(msg.From); err == nil {
+		for _, addr := range addrs {
+			e.From = append(e.From, EmailAddress{Name: addr.Name, Email: addr.Address})
+		}
+	}
+	return e
+}
@@ -0,0 +1,113 @@
+package jmap_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+	"github.com/infodancer/msgstore/jmap"
+	"github.com/infodancer/msgstore/maildir"
+)
+
+func TestIDs(t *testing.T) {
+	folder, err := jmap.ParseMailboxID(jmap.MailboxID("Work/Projects"))
+	if err != nil || folder != "Work/Projects" {
+		t.Errorf("ParseMailboxID = %q, %v", folder, err)
+	}
+	folder, uid, err := jmap.ParseEmailID(jmap.EmailID("INBOX", "1700000000.M1P2.host,S=10"))
+	if err != nil || folder != "INBOX" || uid != "1700000000.M1P2.host,S=10" {
+		t.Errorf("ParseEmailID = %q, %q, %v", folder, uid, err)
+	}
+	for _, id := range []string{"", "X", "M!!", jmap.MailboxID("INBOX")} {
+		if _, _, err := jmap.ParseEmailID(id); err != errors.ErrInvalidID {
+			t.Errorf("ParseEmailID(%q) = %v, want ErrInvalidID", id, err)
+		}
+	}
+}
+
+func TestAdapter(t *testing.T) {
+	store := maildir.NewStore(t.TempDir(), "", "", maildir.WithHierarchyDelimiter("/"))
+	ctx := context.Background()
+	account := "user@example.com"
+
+	if err := store.EnsureDefaultFolders(ctx, account); err != nil {
+		t.Fatalf("EnsureDefaultFolders: %v", err)
+	}
+	for _, folder := range []string{"Work", "Work/Projects"} {
+		if err := store.CreateFolder(ctx, account, folder); err != nil {
+			t.Fatalf("CreateFolder: %v", err)
+		}
+	}
+	uids, err := store.AppendMultiple(ctx, account, "INBOX", []msgstore.AppendItem{
+		{Message: strings.NewReader("From: Alice <alice@example.com>\r\nSubject: Hello\r\nMessage-ID: <1@example.com>\r\n\r\nhi"), Flags: []string{"\\Seen", "$Forwarded", "Project-X"}},
+		{Message: strings.NewReader("Subject: Unread\r\n\r\n")},
+	})
+	if err != nil {
+		t.Fatalf("AppendMultiple: %v", err)
+	}
+
+	adapter, err := jmap.NewAdapter(store)
+	if err != nil {
+		t.Fatalf("NewAdapter: %v", err)
+	}
+
+	mailboxes, err := adapter.Mailboxes(ctx, account)
+	if err != nil {
+		t.Fatalf("Mailboxes: %v", err)
+	}
+	byName := make(map[string]jmap.Mailbox)
+	for _, m := range mailboxes {
+		byName[m.Name] = m
+	}
+	inbox := mailboxes[0]
+	if inbox.Name != "INBOX" || inbox.Role == nil || *inbox.Role != "inbox" || inbox.TotalEmails != 2 || inbox.UnreadEmails != 1 {
+		t.Errorf("inbox = %+v", inbox)
+	}
+	if trash := byName["Trash"]; trash.Role == nil || *trash.Role != "trash" {
+		t.Errorf("Trash role = %v", trash.Role)
+	}
+	projects, ok := byName["Projects"]
+	if !ok || projects.ParentID == nil || *projects.ParentID != jmap.MailboxID("Work") {
+		t.Errorf("Projects = %+v, want child of Work", projects)
+	}
+
+	emails, state, err := adapter.Emails(ctx, account, inbox.ID)
+	if err != nil {
+		t.Fatalf("Emails: %v", err)
+	}
+	if len(emails) != 2 || state == "" {
+		t.Fatalf("Emails = %v, %q", emails, state)
+	}
+	var hello jmap.Email
+	for _, e := range emails {
+		if e.Subject == "Hello" {
+			hello = e
+		}
+	}
+	if !hello.Keywords["$seen"] || len(hello.From) != 1 || hello.From[0].Email != "alice@example.com" || len(hello.MessageID) != 1 || hello.MessageID[0] != "1@example.com" {
+		t.Errorf("hello = %+v", hello)
+	}
+	if len(hello.Keywords) != 3 || !hello.Keywords["$forwarded"] || !hello.Keywords["project-x"] {
+		t.Errorf("keywords = %v, want $seen, $forwarded and project-x", hello.Keywords)
+	}
+	if !hello.MailboxIDs[inbox.ID] {
+		t.Errorf("mailboxIds = %v", hello.MailboxIDs)
+	}
+
+	if err := store.SetFlagsInFolder(ctx, account, "INBOX", uids[1], msgstore.FlagModeAdd, []string{"\\Seen"}); err != nil {
+		t.Fatalf("SetFlagsInFolder: %v", err)
+	}
+	changes, err := adapter.EmailChanges(ctx, account, inbox.ID, state)
+	if err != nil {
+		t.Fatalf("EmailChanges: %v", err)
+	}
+	if len(changes.Updated) != 1 || changes.Updated[0] != jmap.EmailID("INBOX", uids[1]) || len(changes.Created) != 0 || changes.NewState == state {
+		t.Errorf("EmailChanges = %+v", changes)
+	}
+
+	if _, err := adapter.SubmitEmail(ctx, account, jmap.EmailSubmission{}); err != errors.ErrNotSupported {
+		t.Errorf("SubmitEmail = %v, want ErrNotSupported", err)
+	}
+}
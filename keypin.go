@@ -0,0 +1,167 @@
+package msgstore
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/infodancer/msgstore/errors"
+)
+
+// KeyPinStore records the key fingerprint (see KeyFingerprint) each
+// recipient is pinned to, so that EncryptingDeliveryAgent can detect a
+// recipient's key being silently replaced. Implementations must be safe
+// for concurrent use.
+type KeyPinStore interface {
+	// PinnedFingerprint returns the fingerprint username is pinned to, or
+	// "" if they are not pinned.
+	PinnedFingerprint(ctx context.Context, username string) (string, error)
+
+	// PinFingerprint pins username to fingerprint, replacing any previous
+	// pin.
+	PinFingerprint(ctx context.Context, username, fingerprint string) error
+}
+
+// keyPinFileSuffix is the extension of the pin files of FileKeyPinStore.
+const keyPinFileSuffix = ".pin"
+
+// FileKeyPinStore keeps each user's pin in a file named <username>.pin in
+// one directory, such as the directory holding users' key files. A pin
+// file contains the fingerprint on a single line; deleting it re-pins the
+// user on their next delivery.
+type FileKeyPinStore struct {
+	dir string
+}
+
+// NewFileKeyPinStore creates a pin store in dir, which must exist.
+func NewFileKeyPinStore(dir string) *FileKeyPinStore {
+	return &FileKeyPinStore{dir: dir}
+}
+
+// pinPath returns the pin file of username, rejecting names that would
+// escape the directory.
+func (s *FileKeyPinStore) pinPath(username string) (string, error) {
+	if username == "" || username == "." || username == ".." || strings.ContainsAny(username, `/\`) {
+		return "", fmt.Errorf("key pin: invalid username %q", username)
+	}
+	return filepath.Join(s.dir, username+keyPinFileSuffix), nil
+}
+
+// PinnedFingerprint implements KeyPinStore.
+func (s *FileKeyPinStore) PinnedFingerprint(ctx context.Context, username string) (string, error) {
+	path, err := s.pinPath(username)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// PinFingerprint implements KeyPinStore. The pin file is replaced
+// atomically.
+func (s *FileKeyPinStore) PinFingerprint(ctx context.Context, username, fingerprint string) error {
+	path, err := s.pinPath(username)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(s.dir, ".pin-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.WriteString(fingerprint + "\n")
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// WithKeyPinning checks every recipient key against pins before encrypting
+// to it. A recipient seen for the first time is pinned to their current
+// key (trust on first use). If a key's fingerprint differs from the pin,
+// the copy for that recipient is not delivered: Deliver reports an error
+// wrapping errors.ErrKeyPinMismatch and, if auditLogger is not nil, an
+// AuditKeyMismatch event is recorded. The same happens when a pinned
+// recipient's key cannot be found or looked up, rather than falling back
+// to plaintext. To accept a legitimate key change, update the pin with
+// PinFingerprint.
+func WithKeyPinning(pins KeyPinStore, auditLogger AuditLogger) EncryptingOption {
+	return func(e *EncryptingDeliveryAgent) {
+		e.pins = pins
+		e.pinAudit = auditLogger
+	}
+}
+
+// checkKeyPin verifies key against the pin of username, pinning it if
+// username has none. A nil key, with lookupErr if the lookup failed, is
+// accepted only for a user without a pin. Pin store failures also refuse
+// the key, since an unchecked key is what pinning guards against.
+func (e *EncryptingDeliveryAgent) checkKeyPin(ctx context.Context, recipient, username string, key []byte, lookupErr error) error {
+	pinned, err := e.pins.PinnedFingerprint(ctx, username)
+	if err != nil {
+		return fmt.Errorf("deliver to %s: reading key pin: %w", recipient, err)
+	}
+	var fingerprint, offered string
+	switch {
+	case key != nil:
+		fingerprint = KeyFingerprint(key)
+		offered = "offered " + fingerprint
+	case pinned == "":
+		return nil
+	case lookupErr != nil:
+		offered = "key lookup failed: " + lookupErr.Error()
+	default:
+		offered = "no key offered"
+	}
+	if pinned == "" {
+		if err := e.pins.PinFingerprint(ctx, username, fingerprint); err != nil {
+			return fmt.Errorf("deliver to %s: pinning key: %w", recipient, err)
+		}
+		return nil
+	}
+	if pinned == fingerprint {
+		return nil
+	}
+
+	err = fmt.Errorf("deliver to %s: %w", recipient, errors.ErrKeyPinMismatch)
+	slog.Warn("recipient key does not match pin",
+		slog.String("recipient", recipient),
+		slog.String("pinned", pinned),
+		slog.String("offered", offered),
+	)
+	if e.pinAudit != nil {
+		event := AuditEvent{
+			Time:    time.Now().UTC(),
+			Op:      AuditKeyMismatch,
+			Actor:   ActorFromContext(ctx),
+			Mailbox: recipient,
+			Detail:  "pinned " + pinned + ", " + offered,
+			Result:  err.Error(),
+		}
+		if aerr := e.pinAudit.Audit(ctx, event); aerr != nil {
+			slog.Warn("audit log write failed",
+				slog.String("op", string(event.Op)),
+				slog.String("error", aerr.Error()),
+			)
+		}
+	}
+	return err
+}
+
+// Compile-time interface verification.
+var _ KeyPinStore = (*FileKeyPinStore)(nil)
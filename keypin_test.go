@@ -0,0 +1,132 @@
+package msgstore
+
+import (
+	"context"
+	stderrors "errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/infodancer/msgstore/errors"
+)
+
+// recordingAuditLogger keeps the events it receives.
+type recordingAuditLogger struct {
+	mu     sync.Mutex
+	events []AuditEvent
+}
+
+func (r *recordingAuditLogger) Audit(ctx context.Context, event AuditEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+	return nil
+}
+
+func TestEncryptingDeliveryAgent_KeyPinning(t *testing.T) {
+	for _, streaming := range []bool{false, true} {
+		name := "buffered"
+		if streaming {
+			name = "streaming"
+		}
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			alicePub, _ := generateTestKeyPair()
+			bobPub, _ := generateTestKeyPair()
+			keys := &mockKeyProvider{keys: map[string][]byte{"alice": alicePub, "bob": bobPub}}
+			underlying := &mockDeliveryAgent{}
+			audit := &recordingAuditLogger{}
+			opts := []EncryptingOption{WithKeyPinning(NewFileKeyPinStore(dir), audit)}
+			if streaming {
+				opts = append(opts, WithStreamingEncryption())
+			}
+			agent := NewEncryptingDeliveryAgent(underlying, keys, opts...)
+			ctx := WithActor(context.Background(), "smtpd")
+			envelope := Envelope{
+				From:       "sender@example.com",
+				Recipients: []string{"alice@example.com", "bob@example.com", "carol@example.com"},
+			}
+
+			// The first delivery pins both keys.
+			if err := agent.Deliver(ctx, envelope, strings.NewReader("Subject: one\r\n\r\n")); err != nil {
+				t.Fatalf("first Deliver: %v", err)
+			}
+			data, err := os.ReadFile(filepath.Join(dir, "alice.pin"))
+			if err != nil || strings.TrimSpace(string(data)) != KeyFingerprint(alicePub) {
+				t.Fatalf("alice.pin = %q, %v; want %s", data, err, KeyFingerprint(alicePub))
+			}
+
+			// Alice's key is replaced: her copy is refused, the others go out.
+			mallory, _ := generateTestKeyPair()
+			keys.keys["alice"] = mallory
+			underlying.deliveries = nil
+			err = agent.Deliver(ctx, envelope, strings.NewReader("Subject: two\r\n\r\n"))
+			if !stderrors.Is(err, errors.ErrKeyPinMismatch) || !strings.Contains(err.Error(), "alice@example.com") {
+				t.Fatalf("Deliver error = %v, want a pin mismatch for alice", err)
+			}
+			var delivered []string
+			for _, d := range underlying.deliveries {
+				delivered = append(delivered, d.envelope.Recipients...)
+			}
+			if strings.Contains(strings.Join(delivered, ","), "alice") || len(delivered) != 2 {
+				t.Errorf("delivered to %v, want bob and carol only", delivered)
+			}
+			if len(audit.events) != 1 {
+				t.Fatalf("audit events = %+v, want one", audit.events)
+			}
+			event := audit.events[0]
+			if event.Op != AuditKeyMismatch || event.Mailbox != "alice@example.com" || event.Actor != "smtpd" ||
+				!strings.Contains(event.Detail, KeyFingerprint(mallory)) || event.Result == "ok" {
+				t.Errorf("audit event = %+v", event)
+			}
+
+			// Re-pinning accepts the new key.
+			if err := NewFileKeyPinStore(dir).PinFingerprint(ctx, "alice", KeyFingerprint(mallory)); err != nil {
+				t.Fatalf("PinFingerprint: %v", err)
+			}
+			if err := agent.Deliver(ctx, envelope, strings.NewReader("Subject: three\r\n\r\n")); err != nil {
+				t.Errorf("Deliver after re-pinning: %v", err)
+			}
+
+			// A pinned recipient whose key disappears gets no plaintext
+			// copy either; unpinned carol still does.
+			delete(keys.keys, "alice")
+			underlying.deliveries = nil
+			err = agent.Deliver(ctx, envelope, strings.NewReader("Subject: four\r\n\r\n"))
+			if !stderrors.Is(err, errors.ErrKeyPinMismatch) || !strings.Contains(err.Error(), "alice@example.com") {
+				t.Fatalf("Deliver error = %v, want a pin mismatch for alice", err)
+			}
+			delivered = nil
+			for _, d := range underlying.deliveries {
+				delivered = append(delivered, d.envelope.Recipients...)
+			}
+			if strings.Contains(strings.Join(delivered, ","), "alice") || len(delivered) != 2 {
+				t.Errorf("delivered to %v, want bob and carol only", delivered)
+			}
+			if len(audit.events) != 2 || audit.events[1].Op != AuditKeyMismatch || !strings.Contains(audit.events[1].Detail, "no key") {
+				t.Errorf("audit events = %+v, want a second key mismatch", audit.events)
+			}
+		})
+	}
+}
+
+func TestFileKeyPinStore(t *testing.T) {
+	ctx := context.Background()
+	pins := NewFileKeyPinStore(t.TempDir())
+	if fp, err := pins.PinnedFingerprint(ctx, "alice"); err != nil || fp != "" {
+		t.Errorf("PinnedFingerprint of an unpinned user = %q, %v", fp, err)
+	}
+	if err := pins.PinFingerprint(ctx, "alice", "sha256:00"); err != nil {
+		t.Fatalf("PinFingerprint: %v", err)
+	}
+	if fp, err := pins.PinnedFingerprint(ctx, "alice"); err != nil || fp != "sha256:00" {
+		t.Errorf("PinnedFingerprint = %q, %v", fp, err)
+	}
+	for _, name := range []string{"", "..", "../alice", `a\b`} {
+		if err := pins.PinFingerprint(ctx, name, "sha256:00"); err == nil {
+			t.Errorf("PinFingerprint(%q) succeeded", name)
+		}
+	}
+}
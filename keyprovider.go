@@ -0,0 +1,392 @@
+package msgstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/infodancer/auth"
+	autherrors "github.com/infodancer/auth/errors"
+)
+
+// KeyResolver is an optional interface for key providers that can answer
+// both HasEncryption and GetPublicKey with a single backend lookup, such as
+// directory or network providers where a user has encryption exactly when
+// a key is published for them. ResolveKey returns the user's key, or nil
+// and no error if they do not have encryption. EncryptingDeliveryAgent,
+// ChainedKeyProvider and CachingKeyProvider use it to make one lookup per
+// recipient. Consumers that need it should type-assert to KeyResolver.
+type KeyResolver interface {
+	ResolveKey(ctx context.Context, username string) ([]byte, error)
+}
+
+// resolveKey returns the key of username from kp, or nil if they do not
+// have encryption, with a single call if kp is a KeyResolver.
+func resolveKey(ctx context.Context, kp auth.KeyProvider, username string) ([]byte, error) {
+	if r, ok := kp.(KeyResolver); ok {
+		return r.ResolveKey(ctx, username)
+	}
+	has, err := kp.HasEncryption(ctx, username)
+	if err != nil || !has {
+		return nil, err
+	}
+	return kp.GetPublicKey(ctx, username)
+}
+
+// ChainedKeyProvider consults several key providers in order, so mixed
+// account populations (e.g., LDAP for migrated users, a passwd file for
+// the rest) can coexist during a migration. A user has encryption if any
+// provider says so, and their key comes from the first provider that has
+// one.
+type ChainedKeyProvider struct {
+	providers []auth.KeyProvider
+}
+
+// NewChainedKeyProvider creates a key provider that tries providers in
+// order.
+func NewChainedKeyProvider(providers ...auth.KeyProvider) *ChainedKeyProvider {
+	return &ChainedKeyProvider{providers: providers}
+}
+
+// GetPublicKey returns the key of the first provider that has one for
+// username. If none does, it returns the first provider's error.
+func (c *ChainedKeyProvider) GetPublicKey(ctx context.Context, username string) ([]byte, error) {
+	var firstErr error
+	for _, p := range c.providers {
+		key, err := p.GetPublicKey(ctx, username)
+		if err == nil {
+			return key, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	return nil, firstErr
+}
+
+// HasEncryption reports whether any provider has encryption enabled for
+// username. Errors are returned only if no provider answered.
+func (c *ChainedKeyProvider) HasEncryption(ctx context.Context, username string) (bool, error) {
+	var firstErr error
+	answered := false
+	for _, p := range c.providers {
+		has, err := p.HasEncryption(ctx, username)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if has {
+			return true, nil
+		}
+		answered = true
+	}
+	if answered {
+		return false, nil
+	}
+	return false, firstErr
+}
+
+// ResolveKey implements KeyResolver: it returns the key of the first
+// provider that has encryption enabled for username and a key for them.
+// Errors are returned only if no provider answered.
+func (c *ChainedKeyProvider) ResolveKey(ctx context.Context, username string) ([]byte, error) {
+	var firstErr error
+	answered := false
+	for _, p := range c.providers {
+		key, err := resolveKey(ctx, p, username)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			continue
+		}
+		if key != nil {
+			return key, nil
+		}
+		answered = true
+	}
+	if answered {
+		return nil, nil
+	}
+	return nil, firstErr
+}
+
+// CachingKeyProvider caches the answers of another key provider, to absorb
+// the per-recipient lookups of EncryptingDeliveryAgent under load. Keys and
+// encryption status are cached for a TTL; users without a key
+// (autherrors.ErrKeyNotFound) are cached for a separate negative TTL, and
+// other errors are not cached. Concurrent lookups of the same user share
+// one backend call, and if the underlying provider is a KeyResolver a
+// single call answers both HasEncryption and GetPublicKey. Expired answers
+// are dropped when read, and all of them whenever the cache has doubled in
+// size, so users looked up once do not stay in memory.
+type CachingKeyProvider struct {
+	underlying  auth.KeyProvider
+	ttl         time.Duration
+	negativeTTL time.Duration
+
+	// now returns the current time; replaced in tests.
+	now func() time.Time
+
+	lookups lookupGroup
+
+	mu      sync.Mutex
+	keys    map[string]cachedKey
+	enabled map[string]cachedEncryption
+
+	// sweepAt is the number of cached answers at which the next store
+	// drops every expired one.
+	sweepAt int
+}
+
+// minCacheSweep is the smallest cache size that triggers a sweep of
+// expired answers.
+const minCacheSweep = 1024
+
+// cachedKey is a cached GetPublicKey result.
+type cachedKey struct {
+	key     []byte
+	err     error
+	expires time.Time
+}
+
+// cachedEncryption is a cached HasEncryption result.
+type cachedEncryption struct {
+	has     bool
+	expires time.Time
+}
+
+// NewCachingKeyProvider wraps underlying in a cache. ttl bounds how long a
+// key change takes to be seen; negativeTTL does the same for a newly
+// created key. A zero negativeTTL disables negative caching.
+func NewCachingKeyProvider(underlying auth.KeyProvider, ttl, negativeTTL time.Duration) *CachingKeyProvider {
+	return &CachingKeyProvider{
+		underlying:  underlying,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
+		now:         time.Now,
+		keys:        make(map[string]cachedKey),
+		enabled:     make(map[string]cachedEncryption),
+		sweepAt:     minCacheSweep,
+	}
+}
+
+// GetPublicKey implements auth.KeyProvider.
+func (c *CachingKeyProvider) GetPublicKey(ctx context.Context, username string) ([]byte, error) {
+	now := c.now()
+	c.mu.Lock()
+	entry, ok := c.cachedKey(username, now)
+	c.mu.Unlock()
+	if ok {
+		return entry.key, entry.err
+	}
+
+	if _, ok := c.underlying.(KeyResolver); ok {
+		key, err := c.ResolveKey(ctx, username)
+		if err == nil && key == nil {
+			err = fmt.Errorf("%s: %w", username, autherrors.ErrKeyNotFound)
+		}
+		return key, err
+	}
+	key, _, err := c.lookups.do(ctx, "key\x00"+username, func() ([]byte, bool, error) {
+		key, err := c.underlying.GetPublicKey(ctx, username)
+		c.storeKey(username, now, key, err)
+		return key, false, err
+	})
+	return key, err
+}
+
+// HasEncryption implements auth.KeyProvider.
+func (c *CachingKeyProvider) HasEncryption(ctx context.Context, username string) (bool, error) {
+	now := c.now()
+	c.mu.Lock()
+	entry, ok := c.cachedEncryption(username, now)
+	c.mu.Unlock()
+	if ok {
+		return entry.has, nil
+	}
+
+	if _, ok := c.underlying.(KeyResolver); ok {
+		key, err := c.ResolveKey(ctx, username)
+		return key != nil, err
+	}
+	_, has, err := c.lookups.do(ctx, "has\x00"+username, func() ([]byte, bool, error) {
+		has, err := c.underlying.HasEncryption(ctx, username)
+		if err == nil {
+			c.storeEncryption(username, now, has)
+		}
+		return nil, has, err
+	})
+	return has, err
+}
+
+// ResolveKey implements KeyResolver. It answers from the cache where it
+// can, and otherwise makes one lookup whose result fills both caches.
+func (c *CachingKeyProvider) ResolveKey(ctx context.Context, username string) ([]byte, error) {
+	now := c.now()
+	c.mu.Lock()
+	enabled, enabledOK := c.cachedEncryption(username, now)
+	entry, keyOK := c.cachedKey(username, now)
+	c.mu.Unlock()
+	if enabledOK {
+		if !enabled.has {
+			return nil, nil
+		}
+		if keyOK && entry.err == nil {
+			return entry.key, nil
+		}
+	}
+
+	key, _, err := c.lookups.do(ctx, "resolve\x00"+username, func() ([]byte, bool, error) {
+		key, err := resolveKey(ctx, c.underlying, username)
+		if err != nil {
+			return nil, false, err
+		}
+		c.storeEncryption(username, now, key != nil)
+		if key != nil {
+			c.storeKey(username, now, key, nil)
+		}
+		return key, key != nil, nil
+	})
+	return key, err
+}
+
+// storeKey caches a GetPublicKey result looked up at now. Errors other
+// than autherrors.ErrKeyNotFound are not cached.
+func (c *CachingKeyProvider) storeKey(username string, now time.Time, key []byte, err error) {
+	var entry cachedKey
+	switch {
+	case err == nil:
+		entry = cachedKey{key: key, expires: now.Add(c.ttl)}
+	case errors.Is(err, autherrors.ErrKeyNotFound) && c.negativeTTL > 0:
+		entry = cachedKey{err: err, expires: now.Add(c.negativeTTL)}
+	default:
+		return
+	}
+	c.mu.Lock()
+	c.keys[username] = entry
+	c.sweep(now)
+	c.mu.Unlock()
+}
+
+// storeEncryption caches a HasEncryption result looked up at now.
+func (c *CachingKeyProvider) storeEncryption(username string, now time.Time, has bool) {
+	ttl := c.ttl
+	if !has {
+		ttl = c.negativeTTL
+	}
+	if ttl <= 0 {
+		return
+	}
+	c.mu.Lock()
+	c.enabled[username] = cachedEncryption{has: has, expires: now.Add(ttl)}
+	c.sweep(now)
+	c.mu.Unlock()
+}
+
+// cachedKey returns the cached GetPublicKey result for username if it has
+// not expired at now, dropping an expired one. The caller holds c.mu.
+func (c *CachingKeyProvider) cachedKey(username string, now time.Time) (cachedKey, bool) {
+	entry, ok := c.keys[username]
+	if ok && !now.Before(entry.expires) {
+		delete(c.keys, username)
+		return cachedKey{}, false
+	}
+	return entry, ok
+}
+
+// cachedEncryption returns the cached HasEncryption result for username if
+// it has not expired at now, dropping an expired one. The caller holds c.mu.
+func (c *CachingKeyProvider) cachedEncryption(username string, now time.Time) (cachedEncryption, bool) {
+	entry, ok := c.enabled[username]
+	if ok && !now.Before(entry.expires) {
+		delete(c.enabled, username)
+		return cachedEncryption{}, false
+	}
+	return entry, ok
+}
+
+// sweep drops every answer expired at now once the cache has reached
+// sweepAt, and doubles the threshold from what is left. The caller holds
+// c.mu.
+func (c *CachingKeyProvider) sweep(now time.Time) {
+	if len(c.keys)+len(c.enabled) < c.sweepAt {
+		return
+	}
+	for username, entry := range c.keys {
+		if !now.Before(entry.expires) {
+			delete(c.keys, username)
+		}
+	}
+	for username, entry := range c.enabled {
+		if !now.Before(entry.expires) {
+			delete(c.enabled, username)
+		}
+	}
+	c.sweepAt = max(2*(len(c.keys)+len(c.enabled)), minCacheSweep)
+}
+
+// Invalidate drops the cached answers for username, for callers that know
+// its key just changed.
+func (c *CachingKeyProvider) Invalidate(username string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.keys, username)
+	delete(c.enabled, username)
+}
+
+// lookupGroup coalesces concurrent lookups under the same name, so a burst
+// of deliveries to one recipient makes a single backend call.
+type lookupGroup struct {
+	mu    sync.Mutex
+	calls map[string]*lookupCall
+}
+
+// lookupCall is a lookup in progress; done is closed once its result is
+// set.
+type lookupCall struct {
+	done chan struct{}
+	key  []byte
+	has  bool
+	err  error
+}
+
+// do runs fn unless a lookup under name is already running, in which case
+// it waits for and returns that lookup's result.
+func (g *lookupGroup) do(ctx context.Context, name string, fn func() ([]byte, bool, error)) ([]byte, bool, error) {
+	g.mu.Lock()
+	if call, ok := g.calls[name]; ok {
+		g.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.key, call.has, call.err
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+	}
+	if g.calls == nil {
+		g.calls = make(map[string]*lookupCall)
+	}
+	call := &lookupCall{done: make(chan struct{})}
+	g.calls[name] = call
+	g.mu.Unlock()
+
+	call.key, call.has, call.err = fn()
+	g.mu.Lock()
+	delete(g.calls, name)
+	g.mu.Unlock()
+	close(call.done)
+	return call.key, call.has, call.err
+}
+
+// Compile-time interface verification.
+var (
+	_ auth.KeyProvider = (*ChainedKeyProvider)(nil)
+	_ auth.KeyProvider = (*CachingKeyProvider)(nil)
+	_ KeyResolver      = (*ChainedKeyProvider)(nil)
+	_ KeyResolver      = (*CachingKeyProvider)(nil)
+)
@@ -0,0 +1,271 @@
+package msgstore
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	autherrors "github.com/infodancer/auth/errors"
+)
+
+// mapKeyProvider serves keys from a map; users mapped to nil have no key.
+type mapKeyProvider struct {
+	keys  map[string][]byte
+	err   error
+	calls int
+}
+
+func (m *mapKeyProvider) GetPublicKey(ctx context.Context, username string) ([]byte, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+	if key := m.keys[username]; key != nil {
+		return key, nil
+	}
+	return nil, autherrors.ErrKeyNotFound
+}
+
+func (m *mapKeyProvider) HasEncryption(ctx context.Context, username string) (bool, error) {
+	m.calls++
+	if m.err != nil {
+		return false, m.err
+	}
+	return m.keys[username] != nil, nil
+}
+
+func TestChainedKeyProvider(t *testing.T) {
+	ctx := context.Background()
+	ldap := &mapKeyProvider{keys: map[string][]byte{"alice": []byte("ldap-key")}}
+	passwd := &mapKeyProvider{keys: map[string][]byte{"alice": []byte("old-key"), "bob": []byte("bob-key")}}
+	chain := NewChainedKeyProvider(ldap, passwd)
+
+	if key, err := chain.GetPublicKey(ctx, "alice"); err != nil || string(key) != "ldap-key" {
+		t.Errorf("GetPublicKey(alice) = %q, %v; want the first provider's key", key, err)
+	}
+	if key, err := chain.GetPublicKey(ctx, "bob"); err != nil || string(key) != "bob-key" {
+		t.Errorf("GetPublicKey(bob) = %q, %v; want the fallback key", key, err)
+	}
+	if _, err := chain.GetPublicKey(ctx, "carol"); !stderrors.Is(err, autherrors.ErrKeyNotFound) {
+		t.Errorf("GetPublicKey(carol) error = %v, want ErrKeyNotFound", err)
+	}
+	if has, err := chain.HasEncryption(ctx, "bob"); err != nil || !has {
+		t.Errorf("HasEncryption(bob) = %v, %v; want true", has, err)
+	}
+	if has, err := chain.HasEncryption(ctx, "carol"); err != nil || has {
+		t.Errorf("HasEncryption(carol) = %v, %v; want false", has, err)
+	}
+
+	down := stderrors.New("ldap unreachable")
+	chain = NewChainedKeyProvider(&mapKeyProvider{err: down}, passwd)
+	if has, err := chain.HasEncryption(ctx, "carol"); err != nil || has {
+		t.Errorf("HasEncryption with one provider down = %v, %v; want false", has, err)
+	}
+	chain = NewChainedKeyProvider(&mapKeyProvider{err: down})
+	if _, err := chain.HasEncryption(ctx, "carol"); !stderrors.Is(err, down) {
+		t.Errorf("HasEncryption with every provider down error = %v", err)
+	}
+}
+
+func TestCachingKeyProvider(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	backend := &mapKeyProvider{keys: map[string][]byte{"alice": []byte("key-1")}}
+	cache := NewCachingKeyProvider(backend, time.Minute, 10*time.Second)
+	cache.now = func() time.Time { return now }
+
+	for range 3 {
+		if key, err := cache.GetPublicKey(ctx, "alice"); err != nil || string(key) != "key-1" {
+			t.Fatalf("GetPublicKey = %q, %v", key, err)
+		}
+		if has, err := cache.HasEncryption(ctx, "alice"); err != nil || !has {
+			t.Fatalf("HasEncryption = %v, %v", has, err)
+		}
+		if _, err := cache.GetPublicKey(ctx, "bob"); !stderrors.Is(err, autherrors.ErrKeyNotFound) {
+			t.Fatalf("GetPublicKey(bob) error = %v", err)
+		}
+	}
+	if backend.calls != 3 {
+		t.Fatalf("backend called %d times, want 3", backend.calls)
+	}
+
+	// Negative entries expire first.
+	backend.keys["bob"] = []byte("bob-key")
+	backend.keys["alice"] = []byte("key-2")
+	now = now.Add(30 * time.Second)
+	if key, err := cache.GetPublicKey(ctx, "bob"); err != nil || string(key) != "bob-key" {
+		t.Errorf("GetPublicKey(bob) after negative TTL = %q, %v", key, err)
+	}
+	if key, _ := cache.GetPublicKey(ctx, "alice"); string(key) != "key-1" {
+		t.Errorf("GetPublicKey(alice) within TTL = %q, want the cached key", key)
+	}
+	cache.Invalidate("alice")
+	if key, _ := cache.GetPublicKey(ctx, "alice"); string(key) != "key-2" {
+		t.Errorf("GetPublicKey(alice) after Invalidate = %q, want key-2", key)
+	}
+
+	// Transient errors are not cached.
+	backend.err = stderrors.New("backend down")
+	if _, err := cache.GetPublicKey(ctx, "carol"); err == nil {
+		t.Fatal("expected the backend error")
+	}
+	backend.err = nil
+	calls := backend.calls
+	if _, err := cache.GetPublicKey(ctx, "carol"); !stderrors.Is(err, autherrors.ErrKeyNotFound) || backend.calls != calls+1 {
+		t.Errorf("GetPublicKey after a transient error = %v, backend calls %d", err, backend.calls-calls)
+	}
+}
+
+func TestCachingKeyProvider_DropsExpiredEntries(t *testing.T) {
+	ctx := context.Background()
+	now := time.Unix(1700000000, 0)
+	backend := &mapKeyProvider{keys: map[string][]byte{}}
+	cache := NewCachingKeyProvider(backend, time.Minute, 10*time.Second)
+	cache.now = func() time.Time { return now }
+
+	for i := range minCacheSweep - 1 {
+		_, _ = cache.GetPublicKey(ctx, fmt.Sprintf("probe%d", i))
+	}
+	now = now.Add(time.Minute)
+
+	// Reading an expired answer drops it even when the lookup fails.
+	backend.err = stderrors.New("backend down")
+	_, _ = cache.GetPublicKey(ctx, "probe0")
+	if _, ok := cache.keys["probe0"]; ok {
+		t.Error("expired answer kept after it was read")
+	}
+	backend.err = nil
+
+	// Filling the cache sweeps out everything expired.
+	_, _ = cache.GetPublicKey(ctx, "newcomer")
+	_, _ = cache.GetPublicKey(ctx, "another")
+	if len(cache.keys) != 2 {
+		t.Errorf("cache holds %d answers after the sweep, want 2", len(cache.keys))
+	}
+}
+
+// resolvingKeyProvider is a mapKeyProvider that also implements
+// KeyResolver.
+type resolvingKeyProvider struct {
+	mapKeyProvider
+}
+
+func (r *resolvingKeyProvider) ResolveKey(ctx context.Context, username string) ([]byte, error) {
+	r.calls++
+	if r.err != nil {
+		return nil, r.err
+	}
+	return r.keys[username], nil
+}
+
+func TestCachingKeyProvider_OneLookupPerRecipient(t *testing.T) {
+	ctx := context.Background()
+	backend := &resolvingKeyProvider{mapKeyProvider{keys: map[string][]byte{"alice": []byte("key")}}}
+	cache := NewCachingKeyProvider(backend, time.Minute, time.Minute)
+
+	for range 2 {
+		if has, err := cache.HasEncryption(ctx, "alice"); err != nil || !has {
+			t.Fatalf("HasEncryption(alice) = %v, %v", has, err)
+		}
+		if key, err := cache.GetPublicKey(ctx, "alice"); err != nil || string(key) != "key" {
+			t.Fatalf("GetPublicKey(alice) = %q, %v", key, err)
+		}
+		if has, err := cache.HasEncryption(ctx, "bob"); err != nil || has {
+			t.Fatalf("HasEncryption(bob) = %v, %v", has, err)
+		}
+		if key, err := cache.ResolveKey(ctx, "bob"); err != nil || key != nil {
+			t.Fatalf("ResolveKey(bob) = %q, %v", key, err)
+		}
+	}
+	if backend.calls != 2 {
+		t.Errorf("backend called %d times, want one lookup per user", backend.calls)
+	}
+	if _, err := cache.GetPublicKey(ctx, "bob"); !stderrors.Is(err, autherrors.ErrKeyNotFound) {
+		t.Errorf("GetPublicKey(bob) error = %v, want ErrKeyNotFound", err)
+	}
+
+	// Without a KeyResolver underneath, ResolveKey still fills both caches.
+	plain := &mapKeyProvider{keys: map[string][]byte{"alice": []byte("key")}}
+	cache = NewCachingKeyProvider(plain, time.Minute, time.Minute)
+	if key, err := cache.ResolveKey(ctx, "alice"); err != nil || string(key) != "key" {
+		t.Fatalf("ResolveKey(alice) = %q, %v", key, err)
+	}
+	calls := plain.calls
+	_, _ = cache.HasEncryption(ctx, "alice")
+	_, _ = cache.GetPublicKey(ctx, "alice")
+	if plain.calls != calls {
+		t.Errorf("cached lookups called the backend %d more times", plain.calls-calls)
+	}
+}
+
+// blockingKeyProvider counts lookups and holds each until release is
+// closed.
+type blockingKeyProvider struct {
+	release chan struct{}
+	calls   atomic.Int32
+}
+
+func (b *blockingKeyProvider) GetPublicKey(ctx context.Context, username string) ([]byte, error) {
+	b.calls.Add(1)
+	<-b.release
+	return []byte("key"), nil
+}
+
+func (b *blockingKeyProvider) HasEncryption(ctx context.Context, username string) (bool, error) {
+	b.calls.Add(1)
+	<-b.release
+	return true, nil
+}
+
+func TestCachingKeyProvider_CoalescesConcurrentLookups(t *testing.T) {
+	backend := &blockingKeyProvider{release: make(chan struct{})}
+	cache := NewCachingKeyProvider(backend, time.Minute, 0)
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Go(func() {
+			if key, err := cache.GetPublicKey(context.Background(), "alice"); err != nil || string(key) != "key" {
+				t.Errorf("GetPublicKey = %q, %v", key, err)
+			}
+		})
+	}
+	for backend.calls.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(backend.release)
+	wg.Wait()
+	if n := backend.calls.Load(); n != 1 {
+		t.Errorf("backend called %d times, want 1", n)
+	}
+}
+
+func TestChainedKeyProvider_ResolveKey(t *testing.T) {
+	ctx := context.Background()
+	down := stderrors.New("ldap unreachable")
+	fs := &mapKeyProvider{keys: map[string][]byte{"alice": []byte("fs-key")}}
+	ldap := &resolvingKeyProvider{mapKeyProvider{keys: map[string][]byte{"alice": []byte("ldap-key"), "bob": []byte("bob-key")}}}
+	chain := NewChainedKeyProvider(fs, ldap)
+
+	if key, err := chain.ResolveKey(ctx, "alice"); err != nil || string(key) != "fs-key" {
+		t.Errorf("ResolveKey(alice) = %q, %v; want the first provider's key", key, err)
+	}
+	if key, err := chain.ResolveKey(ctx, "bob"); err != nil || string(key) != "bob-key" {
+		t.Errorf("ResolveKey(bob) = %q, %v; want the fallback key", key, err)
+	}
+	if key, err := chain.ResolveKey(ctx, "carol"); err != nil || key != nil {
+		t.Errorf("ResolveKey(carol) = %q, %v; want no key", key, err)
+	}
+	chain = NewChainedKeyProvider(&mapKeyProvider{err: down}, fs)
+	if key, err := chain.ResolveKey(ctx, "carol"); err != nil || key != nil {
+		t.Errorf("ResolveKey with one provider down = %q, %v; want no key", key, err)
+	}
+	chain = NewChainedKeyProvider(&mapKeyProvider{err: down})
+	if _, err := chain.ResolveKey(ctx, "carol"); !stderrors.Is(err, down) {
+		t.Errorf("ResolveKey with every provider down error = %v", err)
+	}
+}
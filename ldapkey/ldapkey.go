@@ -0,0 +1,216 @@
+// Package ldapkey looks up recipient encryption keys in an LDAP directory,
+// so organizations that manage credentials in LDAP can keep users' keys in
+// the same entries.
+//
+// The KeyProvider searches for the user's entry and reads the key from one
+// attribute, by default userCertificate;binary:
+//
+//	keys, err := ldapkey.NewKeyProvider(ldapkey.Config{
+//	    URL:          "ldaps://ldap.example.com",
+//	    BindDN:       "cn=msgstore,ou=services,dc=example,dc=com",
+//	    BindPassword: secret,
+//	    BaseDN:       "ou=people,dc=example,dc=com",
+//	})
+//	agent := msgstore.NewEncryptingDeliveryAgent(store,
+//	    msgstore.NewCachingKeyProvider(keys, time.Hour, 10*time.Minute))
+//
+// Each lookup opens its own connection, so the provider should be wrapped
+// in a msgstore.CachingKeyProvider as above.
+package ldapkey
+
+import (
+	"context"
+	"crypto/ecdh"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/infodancer/auth"
+	autherrors "github.com/infodancer/auth/errors"
+	"github.com/infodancer/msgstore"
+	storeerrors "github.com/infodancer/msgstore/errors"
+)
+
+// Defaults for unset Config fields.
+const (
+	DefaultFilter    = "(uid=%s)"
+	DefaultAttribute = "userCertificate;binary"
+	DefaultTimeout   = 10 * time.Second
+)
+
+// Config describes the directory and where keys live in it.
+type Config struct {
+	// URL is the directory server, an ldap:// or ldaps:// URL.
+	URL string
+
+	// BindDN and BindPassword authenticate the lookups. If BindDN is empty
+	// the directory is searched anonymously.
+	BindDN       string
+	BindPassword string
+
+	// StartTLS upgrades an ldap:// connection before binding.
+	StartTLS bool
+
+	// TLSConfig is used for ldaps:// and StartTLS. Nil uses the defaults.
+	TLSConfig *tls.Config
+
+	// BaseDN is where the search for user entries starts. Required.
+	BaseDN string
+
+	// Filter selects a user's entry, with %s replaced by the escaped
+	// username. Defaults to DefaultFilter.
+	Filter string
+
+	// Attribute holds the key. Defaults to DefaultAttribute. Its values may
+	// be DER X.509 certificates with an X25519 public key, raw 32-byte
+	// X25519 keys, or the base64 encoding of one.
+	Attribute string
+
+	// Timeout bounds each lookup. Defaults to DefaultTimeout.
+	Timeout time.Duration
+}
+
+// KeyProvider reads X25519 public keys from LDAP. It implements
+// auth.KeyProvider and is safe for concurrent use.
+type KeyProvider struct {
+	cfg Config
+
+	// search returns the key attribute values of the entry matched by
+	// filter, nil if there is none. Replaced in tests.
+	search func(ctx context.Context, filter string) ([][]byte, error)
+}
+
+// NewKeyProvider creates a provider for cfg. A config without URL or
+// BaseDN yields an error wrapping errors.ErrStoreConfigInvalid.
+func NewKeyProvider(cfg Config) (*KeyProvider, error) {
+	if cfg.URL == "" || cfg.BaseDN == "" {
+		return nil, fmt.Errorf("ldapkey: URL and BaseDN are required: %w", storeerrors.ErrStoreConfigInvalid)
+	}
+	if cfg.Filter == "" {
+		cfg.Filter = DefaultFilter
+	}
+	if cfg.Attribute == "" {
+		cfg.Attribute = DefaultAttribute
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	p := &KeyProvider{cfg: cfg}
+	p.search = p.searchDirectory
+	return p, nil
+}
+
+// GetPublicKey implements auth.KeyProvider. A user without an entry, or
+// whose entry has no usable key, yields autherrors.ErrKeyNotFound.
+func (p *KeyProvider) GetPublicKey(ctx context.Context, username string) ([]byte, error) {
+	filter := strings.ReplaceAll(p.cfg.Filter, "%s", ldap.EscapeFilter(username))
+	values, err := p.search(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("ldapkey: looking up %s: %w", username, err)
+	}
+	now := time.Now()
+	for _, value := range values {
+		if key := decodeKey(value, now); key != nil {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("ldapkey: %s: %w", username, autherrors.ErrKeyNotFound)
+}
+
+// HasEncryption implements auth.KeyProvider: a user has encryption if
+// their entry holds a usable key.
+func (p *KeyProvider) HasEncryption(ctx context.Context, username string) (bool, error) {
+	key, err := p.ResolveKey(ctx, username)
+	return key != nil, err
+}
+
+// ResolveKey implements msgstore.KeyResolver, so wrappers answer both
+// HasEncryption and GetPublicKey with one lookup.
+func (p *KeyProvider) ResolveKey(ctx context.Context, username string) ([]byte, error) {
+	key, err := p.GetPublicKey(ctx, username)
+	if errors.Is(err, autherrors.ErrKeyNotFound) {
+		return nil, nil
+	}
+	return key, err
+}
+
+// searchDirectory connects, binds and searches for the one entry matched
+// by filter. Cancelling ctx closes the connection.
+func (p *KeyProvider) searchDirectory(ctx context.Context, filter string) ([][]byte, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	conn, err := ldap.DialURL(p.cfg.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: p.cfg.Timeout}),
+		ldap.DialWithTLSConfig(p.cfg.TLSConfig))
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	defer context.AfterFunc(ctx, func() { conn.Close() })()
+	conn.SetTimeout(p.cfg.Timeout)
+
+	if p.cfg.StartTLS {
+		if err := conn.StartTLS(p.cfg.TLSConfig); err != nil {
+			return nil, err
+		}
+	}
+	if p.cfg.BindDN != "" {
+		if err := conn.Bind(p.cfg.BindDN, p.cfg.BindPassword); err != nil {
+			return nil, err
+		}
+	}
+
+	req := ldap.NewSearchRequest(p.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(p.cfg.Timeout/time.Second), false, filter, []string{p.cfg.Attribute}, nil)
+	res, err := conn.Search(req)
+	switch {
+	case ldap.IsErrorWithCode(err, ldap.LDAPResultNoSuchObject):
+		return nil, nil
+	case err != nil:
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return nil, ctxErr
+		}
+		return nil, err
+	case len(res.Entries) > 1:
+		return nil, fmt.Errorf("filter %s matches %d entries", filter, len(res.Entries))
+	case len(res.Entries) == 0:
+		return nil, nil
+	}
+	return res.Entries[0].GetEqualFoldRawAttributeValues(p.cfg.Attribute), nil
+}
+
+// decodeKey returns the X25519 public key held in an attribute value, or
+// nil if it holds none. Certificates are only used within their validity
+// period.
+func decodeKey(value []byte, now time.Time) []byte {
+	if len(value) == 32 {
+		return append([]byte(nil), value...)
+	}
+	if cert, err := x509.ParseCertificate(value); err == nil {
+		// Certificate parsing leaves X25519 keys unset, so the subject key
+		// is parsed on its own.
+		pub, err := x509.ParsePKIXPublicKey(cert.RawSubjectPublicKeyInfo)
+		key, ok := pub.(*ecdh.PublicKey)
+		if err != nil || !ok || key.Curve() != ecdh.X25519() || now.Before(cert.NotBefore) || now.After(cert.NotAfter) {
+			return nil
+		}
+		return key.Bytes()
+	}
+	if raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(value))); err == nil && len(raw) == 32 {
+		return raw
+	}
+	return nil
+}
+
+// Compile-time interface verification.
+var (
+	_ auth.KeyProvider     = (*KeyProvider)(nil)
+	_ msgstore.KeyResolver = (*KeyProvider)(nil)
+)
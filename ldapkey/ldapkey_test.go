@@ -0,0 +1,146 @@
+package ldapkey
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdh"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	autherrors "github.com/infodancer/auth/errors"
+	storeerrors "github.com/infodancer/msgstore/errors"
+)
+
+// x25519Certificate returns a DER certificate for key valid from notBefore
+// to notAfter. The x509 package cannot issue certificates for X25519 keys,
+// so an Ed25519 certificate has its subject key swapped; the signature is
+// then invalid, which the provider does not check.
+func x25519Certificate(t *testing.T, key *ecdh.PublicKey, notBefore, notAfter time.Time) []byte {
+	t.Helper()
+	pub, signer, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "user@example.com"},
+		NotBefore:    notBefore,
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageKeyAgreement,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, pub, signer)
+	if err != nil {
+		t.Fatalf("CreateCertificate: %v", err)
+	}
+	// SubjectPublicKeyInfo: algorithm OID 1.3.101.112 (Ed25519) or
+	// 1.3.101.110 (X25519), then the key as a BIT STRING.
+	ed25519Info := append([]byte{0x06, 0x03, 0x2B, 0x65, 0x70, 0x03, 0x21, 0x00}, pub...)
+	x25519Info := append([]byte{0x06, 0x03, 0x2B, 0x65, 0x6E, 0x03, 0x21, 0x00}, key.Bytes()...)
+	if !bytes.Contains(der, ed25519Info) {
+		t.Fatal("subject key not found in certificate")
+	}
+	return bytes.Replace(der, ed25519Info, x25519Info, 1)
+}
+
+func newTestProvider(t *testing.T, entries map[string][][]byte) *KeyProvider {
+	t.Helper()
+	p, err := NewKeyProvider(Config{URL: "ldap://ldap.example.com", BaseDN: "dc=example,dc=com"})
+	if err != nil {
+		t.Fatalf("NewKeyProvider: %v", err)
+	}
+	p.search = func(ctx context.Context, filter string) ([][]byte, error) {
+		return entries[filter], nil
+	}
+	return p
+}
+
+func TestNewKeyProvider_Invalid(t *testing.T) {
+	for _, cfg := range []Config{{}, {URL: "ldap://ldap.example.com"}, {BaseDN: "dc=example,dc=com"}} {
+		if _, err := NewKeyProvider(cfg); !errors.Is(err, storeerrors.ErrStoreConfigInvalid) {
+			t.Errorf("NewKeyProvider(%+v) error = %v, want ErrStoreConfigInvalid", cfg, err)
+		}
+	}
+}
+
+func TestKeyProvider_Encodings(t *testing.T) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := priv.PublicKey().Bytes()
+	now := time.Now()
+	p := newTestProvider(t, map[string][][]byte{
+		"(uid=cert)":   {x25519Certificate(t, priv.PublicKey(), now.Add(-time.Hour), now.Add(time.Hour))},
+		"(uid=raw)":    {key},
+		"(uid=base64)": {[]byte(base64.StdEncoding.EncodeToString(key) + "\n")},
+		"(uid=mixed)": {
+			x25519Certificate(t, priv.PublicKey(), now.Add(-2*time.Hour), now.Add(-time.Hour)),
+			[]byte("not a key"),
+			key,
+		},
+	})
+	for _, user := range []string{"cert", "raw", "base64", "mixed"} {
+		got, err := p.GetPublicKey(context.Background(), user)
+		if err != nil {
+			t.Errorf("%s: GetPublicKey: %v", user, err)
+			continue
+		}
+		if !bytes.Equal(got, key) {
+			t.Errorf("%s: key = %x, want %x", user, got, key)
+		}
+	}
+}
+
+func TestKeyProvider_NotFound(t *testing.T) {
+	priv, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	p := newTestProvider(t, map[string][][]byte{
+		"(uid=expired)": {x25519Certificate(t, priv.PublicKey(), now.Add(-2*time.Hour), now.Add(-time.Hour))},
+		"(uid=garbage)": {[]byte("garbage")},
+	})
+	for _, user := range []string{"nobody", "expired", "garbage"} {
+		if _, err := p.GetPublicKey(context.Background(), user); !errors.Is(err, autherrors.ErrKeyNotFound) {
+			t.Errorf("%s: GetPublicKey error = %v, want ErrKeyNotFound", user, err)
+		}
+		if ok, err := p.HasEncryption(context.Background(), user); ok || err != nil {
+			t.Errorf("%s: HasEncryption = %v, %v; want false, nil", user, ok, err)
+		}
+	}
+}
+
+func TestKeyProvider_EscapesUsername(t *testing.T) {
+	p := newTestProvider(t, nil)
+	var filters []string
+	p.search = func(ctx context.Context, filter string) ([][]byte, error) {
+		filters = append(filters, filter)
+		return nil, nil
+	}
+	_, _ = p.GetPublicKey(context.Background(), "x)(uid=*")
+	if len(filters) != 1 || filters[0] != `(uid=x\29\28uid=\2a)` {
+		t.Errorf("filters = %q", filters)
+	}
+}
+
+func TestKeyProvider_SearchError(t *testing.T) {
+	p := newTestProvider(t, nil)
+	failure := errors.New("connection refused")
+	p.search = func(ctx context.Context, filter string) ([][]byte, error) {
+		return nil, failure
+	}
+	if _, err := p.GetPublicKey(context.Background(), "user"); !errors.Is(err, failure) {
+		t.Errorf("GetPublicKey error = %v, want %v", err, failure)
+	}
+	if ok, err := p.HasEncryption(context.Background(), "user"); ok || !errors.Is(err, failure) {
+		t.Errorf("HasEncryption = %v, %v; want the search error", ok, err)
+	}
+}
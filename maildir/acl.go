@@ -0,0 +1,81 @@
+package maildir
+
+import (
+	"context"
+	"path/filepath"
+
+	"github.com/infodancer/msgstore"
+)
+
+// aclFile holds a folder's ACL inside its maildir, so it moves with
+// RenameFolder and disappears with DeleteFolder.
+const aclFile = "acl.json"
+
+// aclPath returns the sidecar file holding the ACL of a folder or "INBOX".
+func (s *MaildirStore) aclPath(mailbox, folder string) (string, error) {
+	path, _, err := s.folderDir(mailbox, folder)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(path, aclFile), nil
+}
+
+// GetACL implements msgstore.ACLStore.
+func (s *MaildirStore) GetACL(ctx context.Context, mailbox string, folder string) (map[string]msgstore.Rights, error) {
+	path, err := s.aclPath(mailbox, folder)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := readSidecar(s.fs, path)
+	if err != nil {
+		return nil, err
+	}
+	acl := make(map[string]msgstore.Rights, len(stored))
+	for identifier, rights := range stored {
+		acl[identifier] = msgstore.Rights(rights)
+	}
+	return acl, nil
+}
+
+// SetACL implements msgstore.ACLStore.
+func (s *MaildirStore) SetACL(ctx context.Context, mailbox string, folder string, identifier string, rights msgstore.Rights) error {
+	if err := rights.Validate(); err != nil {
+		return err
+	}
+	path, err := s.aclPath(mailbox, folder)
+	if err != nil {
+		return err
+	}
+	defer s.lockMailbox(mailbox)()
+
+	stored, err := readSidecar(s.fs, path)
+	if err != nil {
+		return err
+	}
+	if rights == "" {
+		delete(stored, identifier)
+	} else {
+		// Union with nothing puts the rights in canonical order.
+		stored[identifier] = string(rights.Union(""))
+	}
+	if err := writeSidecar(s.fs, path, stored); err != nil {
+		return err
+	}
+	return s.indexShared(mailbox, folder, len(stored) > 0)
+}
+
+// MyRights implements msgstore.ACLStore.
+func (s *MaildirStore) MyRights(ctx context.Context, mailbox string, folder string, identifier string) (msgstore.Rights, error) {
+	acl, err := s.GetACL(ctx, mailbox, folder)
+	if err != nil {
+		return "", err
+	}
+	rights := msgstore.EffectiveRights(acl, mailbox, identifier)
+	if s.isPublic(mailbox) {
+		rights = rights.Union(s.publicRights)
+	}
+	return rights, nil
+}
+
+// Compile-time interface verification.
+var _ msgstore.ACLStore = (*MaildirStore)(nil)
@@ -0,0 +1,188 @@
+package maildir
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+const (
+	// annotationsFile is the per-folder index of message annotations,
+	// kept inside the maildir next to cur/. Entries are keyed by
+	// uid + "/" + key; maildir keys never contain "/".
+	annotationsFile = "annotations.json"
+
+	// maxAnnotationKey is the longest annotation key accepted.
+	maxAnnotationKey = 256
+
+	// maxMessageAnnotations is the most annotations kept per message.
+	maxMessageAnnotations = 100
+)
+
+// validateAnnotationKey checks that key is non-empty printable ASCII.
+func validateAnnotationKey(key string) error {
+	if key == "" || len(key) > maxAnnotationKey {
+		return errors.ErrInvalidAnnotationKey
+	}
+	for _, r := range key {
+		if r < 0x21 || r > 0x7e {
+			return errors.ErrInvalidAnnotationKey
+		}
+	}
+	return nil
+}
+
+// annotationEntry returns the index entry name for key on uid.
+func annotationEntry(uid, key string) string {
+	return uid + "/" + key
+}
+
+// SetAnnotation implements msgstore.AnnotationStore.
+// Entries of messages that no longer exist are dropped from the index on
+// every write.
+func (s *MaildirStore) SetAnnotation(ctx context.Context, mailbox string, folder string, uid string, key string, value string) error {
+	if err := validateAnnotationKey(key); err != nil {
+		return err
+	}
+	if len(value) > maxMetadataValue {
+		return errors.ErrMetadataTooLarge
+	}
+	path, err := s.folderOrInboxPath(mailbox, folder)
+	if err != nil {
+		return err
+	}
+	defer s.lockMailbox(mailbox)()
+
+	files, err := scanMessages(s.fs, path)
+	if os.IsNotExist(err) {
+		return errors.ErrFolderNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if _, ok := files[uid]; !ok {
+		return errors.ErrMessageNotFound
+	}
+
+	index := filepath.Join(path, annotationsFile)
+	entries, err := readSidecar(s.fs, index)
+	if err != nil {
+		return err
+	}
+	count := 0
+	for name := range entries {
+		owner, _, _ := strings.Cut(name, "/")
+		if _, ok := files[owner]; !ok {
+			delete(entries, name)
+		} else if owner == uid {
+			count++
+		}
+	}
+
+	entry := annotationEntry(uid, key)
+	if value == "" {
+		delete(entries, entry)
+	} else {
+		if _, ok := entries[entry]; !ok && count >= maxMessageAnnotations {
+			return errors.ErrMetadataTooLarge
+		}
+		entries[entry] = value
+	}
+	return writeSidecar(s.fs, index, entries)
+}
+
+// GetAnnotations implements msgstore.AnnotationStore.
+func (s *MaildirStore) GetAnnotations(ctx context.Context, mailbox string, folder string, uid string) (map[string]string, error) {
+	path, err := s.folderOrInboxPath(mailbox, folder)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := readSidecar(s.fs, filepath.Join(path, annotationsFile))
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]string)
+	for name, value := range entries {
+		if key, ok := strings.CutPrefix(name, uid+"/"); ok {
+			result[key] = value
+		}
+	}
+	return result, nil
+}
+
+// carryAnnotations copies the annotations of transferred messages from the
+// index at srcPath to the one at destPath under their new UIDs, removing
+// them from the source if move is set. The caller holds the mailbox lock.
+// The messages have already been transferred, so failures are only logged.
+func (s *MaildirStore) carryAnnotations(srcPath, destPath string, transferred map[string]string, move bool) {
+	if len(transferred) == 0 {
+		return
+	}
+	srcIndex := filepath.Join(srcPath, annotationsFile)
+	src, err := readSidecar(s.fs, srcIndex)
+	if err != nil || len(src) == 0 {
+		return
+	}
+	destIndex := filepath.Join(destPath, annotationsFile)
+	dest, err := readSidecar(s.fs, destIndex)
+	if err != nil {
+		slog.Error("reading annotations", "path", destIndex, "error", err)
+		return
+	}
+
+	carried := false
+	for name, value := range src {
+		uid, key, _ := strings.Cut(name, "/")
+		newUID, ok := transferred[uid]
+		if !ok {
+			continue
+		}
+		dest[annotationEntry(newUID, key)] = value
+		if move {
+			delete(src, name)
+		}
+		carried = true
+	}
+	if !carried {
+		return
+	}
+	if err := writeSidecar(s.fs, destIndex, dest); err != nil {
+		slog.Error("writing annotations", "path", destIndex, "error", err)
+		return
+	}
+	if move {
+		if err := writeSidecar(s.fs, srcIndex, src); err != nil {
+			slog.Error("writing annotations", "path", srcIndex, "error", err)
+		}
+	}
+}
+
+// dropAnnotations removes the annotations of uids from the index at path.
+// The caller holds the mailbox lock; failures are only logged.
+func (s *MaildirStore) dropAnnotations(path string, uids []string) {
+	index := filepath.Join(path, annotationsFile)
+	entries, err := readSidecar(s.fs, index)
+	if err != nil || len(entries) == 0 {
+		return
+	}
+	gone := make(map[string]bool, len(uids))
+	for _, uid := range uids {
+		gone[uid] = true
+	}
+	for name := range entries {
+		if uid, _, _ := strings.Cut(name, "/"); gone[uid] {
+			delete(entries, name)
+		}
+	}
+	if err := writeSidecar(s.fs, index, entries); err != nil {
+		slog.Error("writing annotations", "path", index, "error", err)
+	}
+}
+
+// Compile-time interface verification.
+var _ msgstore.AnnotationStore = (*MaildirStore)(nil)
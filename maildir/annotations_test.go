@@ -0,0 +1,71 @@
+package maildir
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+func TestMaildirStore_Annotations(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+	mailbox := "user@example.com"
+
+	uids, err := store.AppendMultiple(ctx, mailbox, "INBOX", []msgstore.AppendItem{
+		{Message: strings.NewReader("Subject: a\r\n\r\na")},
+		{Message: strings.NewReader("Subject: b\r\n\r\nb")},
+	})
+	if err != nil {
+		t.Fatalf("AppendMultiple: %v", err)
+	}
+
+	if err := store.SetAnnotation(ctx, mailbox, "INBOX", uids[0], "note", "call back"); err != nil {
+		t.Fatalf("SetAnnotation: %v", err)
+	}
+	if err := store.SetAnnotation(ctx, mailbox, "INBOX", uids[0], "pinned", "1"); err != nil {
+		t.Fatalf("SetAnnotation: %v", err)
+	}
+	got, err := store.GetAnnotations(ctx, mailbox, "INBOX", uids[0])
+	if err != nil {
+		t.Fatalf("GetAnnotations: %v", err)
+	}
+	if want := map[string]string{"note": "call back", "pinned": "1"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GetAnnotations = %v, want %v", got, want)
+	}
+	if got, _ := store.GetAnnotations(ctx, mailbox, "INBOX", uids[1]); len(got) != 0 {
+		t.Errorf("unannotated message has %v", got)
+	}
+
+	if err := store.SetAnnotation(ctx, mailbox, "INBOX", uids[0], "pinned", ""); err != nil {
+		t.Fatalf("SetAnnotation remove: %v", err)
+	}
+	if err := store.SetAnnotation(ctx, mailbox, "INBOX", "missing", "note", "x"); err != errors.ErrMessageNotFound {
+		t.Errorf("SetAnnotation on missing message = %v, want ErrMessageNotFound", err)
+	}
+	if err := store.SetAnnotation(ctx, mailbox, "INBOX", uids[0], "bad key", "x"); err != errors.ErrInvalidAnnotationKey {
+		t.Errorf("SetAnnotation with bad key = %v, want ErrInvalidAnnotationKey", err)
+	}
+
+	// Annotations travel with moved messages.
+	if err := store.CreateFolder(ctx, mailbox, "Work"); err != nil {
+		t.Fatalf("CreateFolder: %v", err)
+	}
+	moved, err := store.MoveMessages(ctx, mailbox, "INBOX", uids[:1], "Work")
+	if err != nil {
+		t.Fatalf("MoveMessages: %v", err)
+	}
+	got, err = store.GetAnnotations(ctx, mailbox, "Work", moved[uids[0]])
+	if err != nil {
+		t.Fatalf("GetAnnotations after move: %v", err)
+	}
+	if want := map[string]string{"note": "call back"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after move = %v, want %v", got, want)
+	}
+	if got, _ := store.GetAnnotations(ctx, mailbox, "INBOX", uids[0]); len(got) != 0 {
+		t.Errorf("source still has %v", got)
+	}
+}
@@ -0,0 +1,131 @@
+package maildir
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"time"
+
+	"github.com/emersion/go-maildir"
+	"github.com/infodancer/msgstore"
+)
+
+// AppendMultiple implements msgstore.MultiAppender.
+//
+// Every message is written to tmp/ first; the mailbox lock is then taken
+// once and the messages are renamed into cur/. If any step fails, the
+// messages already placed are removed again.
+func (s *MaildirStore) AppendMultiple(ctx context.Context, mailbox string, folder string, items []msgstore.AppendItem) (uids []string, err error) {
+	defer func() {
+		for _, uid := range uids {
+			s.audit(ctx, msgstore.AuditEvent{Op: msgstore.AuditAppend, Mailbox: mailbox, Folder: folder, UID: uid}, nil)
+		}
+		if err != nil {
+			s.audit(ctx, msgstore.AuditEvent{Op: msgstore.AuditAppend, Mailbox: mailbox, Folder: folder}, err)
+		}
+	}()
+
+	path, err := s.folderOrInboxPath(mailbox, folder)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.createMaildir(mailbox, path); err != nil {
+		return nil, err
+	}
+
+	itemFlags := make([][]maildir.Flag, len(items))
+	for i, item := range items {
+		if itemFlags[i], err = s.flagsFromIMAP(path, item.Flags, true); err != nil {
+			return nil, err
+		}
+	}
+
+	prepare, err := s.prepareFile(mailbox)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpFiles := make([]string, 0, len(items))
+	defer func() {
+		for _, tmp := range tmpFiles {
+			_ = s.fs.Remove(tmp) // no-op once renamed into cur/
+		}
+	}()
+	for _, item := range items {
+		tmp, err := writeTemp(s.fs, path, item.Message, s.fsync)
+		if err != nil {
+			return nil, err
+		}
+		tmpFiles = append(tmpFiles, tmp)
+		if prepare != nil {
+			if err := prepare(tmp); err != nil {
+				return nil, err
+			}
+		}
+		date := item.Date
+		if date.IsZero() {
+			date = time.Now()
+		}
+		if err := s.fs.Chtimes(tmp, date, date); err != nil {
+			return nil, err
+		}
+	}
+
+	defer s.lockMailbox(mailbox)()
+
+	placed := make([]string, 0, len(items))
+	keys := make([]string, 0, len(items))
+	for i := range items {
+		key, err := newKeyLike(s.fs, tmpFiles[i])
+		if err == nil {
+			dst := filepath.Join(path, "cur", key+":"+infoFromFlags(applyFlagMode(nil, itemFlags[i], msgstore.FlagModeSet)))
+			if err = s.fs.Rename(tmpFiles[i], dst); err == nil {
+				placed = append(placed, dst)
+				keys = append(keys, key)
+				continue
+			}
+		}
+		for _, p := range placed {
+			_ = s.fs.Remove(p)
+		}
+		return nil, err
+	}
+	if s.fsync {
+		if err := syncDir(s.fs, filepath.Join(path, "cur")); err != nil {
+			for _, p := range placed {
+				_ = s.fs.Remove(p)
+			}
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+// writeTemp writes r to a new file in the maildir's tmp/ and returns its
+// path. If durable is set, the file is synced before it is closed.
+func writeTemp(fsys FS, path string, r io.Reader, durable bool) (string, error) {
+	f, err := fsys.CreateTemp(filepath.Join(path, "tmp"), "append")
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		_ = f.Close()
+		_ = fsys.Remove(f.Name())
+		return "", err
+	}
+	if durable {
+		if err := syncFile(f); err != nil {
+			_ = f.Close()
+			_ = fsys.Remove(f.Name())
+			return "", err
+		}
+	}
+	if err := f.Close(); err != nil {
+		_ = fsys.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// Compile-time interface verification.
+var _ msgstore.MultiAppender = (*MaildirStore)(nil)
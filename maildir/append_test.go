@@ -0,0 +1,77 @@
+package maildir
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/infodancer/msgstore"
+)
+
+// failingReader returns an error after its content.
+type failingReader struct{ r *strings.Reader }
+
+func (f failingReader) Read(p []byte) (int, error) {
+	if f.r.Len() == 0 {
+		return 0, errors.New("connection lost")
+	}
+	return f.r.Read(p)
+}
+
+func TestMaildirStore_AppendMultiple(t *testing.T) {
+	basePath := t.TempDir()
+	store := NewStore(basePath, "", "")
+	ctx := context.Background()
+	mailbox := "user@example.com"
+	date := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	uids, err := store.AppendMultiple(ctx, mailbox, "Archive", []msgstore.AppendItem{
+		{Message: strings.NewReader("Subject: one\r\n\r\n1"), Flags: []string{"\\Seen"}, Date: date},
+		{Message: strings.NewReader("Subject: two\r\n\r\n2")},
+	})
+	if err != nil {
+		t.Fatalf("AppendMultiple: %v", err)
+	}
+	if len(uids) != 2 || uids[0] == uids[1] {
+		t.Fatalf("uids = %v, want 2 distinct", uids)
+	}
+
+	msgs, err := store.ListInFolder(ctx, mailbox, "Archive")
+	if err != nil {
+		t.Fatalf("ListInFolder: %v", err)
+	}
+	byUID := make(map[string]msgstore.MessageInfo)
+	for _, m := range msgs {
+		byUID[m.UID] = m
+	}
+	first, ok := byUID[uids[0]]
+	if !ok || len(byUID) != 2 {
+		t.Fatalf("listing %v does not match uids %v", msgs, uids)
+	}
+	if len(first.Flags) != 1 || first.Flags[0] != "\\Seen" {
+		t.Errorf("flags = %v, want [\\Seen]", first.Flags)
+	}
+	if !first.InternalDate.Equal(date) {
+		t.Errorf("InternalDate = %v, want %v", first.InternalDate, date)
+	}
+
+	// A failure part-way appends nothing and leaves nothing in tmp/.
+	_, err = store.AppendMultiple(ctx, mailbox, "Archive", []msgstore.AppendItem{
+		{Message: strings.NewReader("Subject: three\r\n\r\n3")},
+		{Message: failingReader{strings.NewReader("Subject: four\r\n")}},
+	})
+	if err == nil {
+		t.Fatal("expected error from failing reader")
+	}
+	if count, _, err := store.StatFolder(ctx, mailbox, "Archive"); err != nil || count != 2 {
+		t.Errorf("StatFolder = %d, %v; want 2 messages", count, err)
+	}
+	tmp, err := os.ReadDir(filepath.Join(basePath, "user", ".Archive", "tmp"))
+	if err != nil || len(tmp) != 0 {
+		t.Errorf("tmp/ = %v, %v; want empty", tmp, err)
+	}
+}
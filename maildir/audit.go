@@ -0,0 +1,41 @@
+package maildir
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/infodancer/msgstore"
+)
+
+// audit records a mutating operation with the configured audit logger.
+// The actor comes from ctx; the result from err.
+func (s *MaildirStore) audit(ctx context.Context, event msgstore.AuditEvent, err error) {
+	if s.auditLogger == nil {
+		return
+	}
+	event.Time = time.Now().UTC()
+	event.Actor = msgstore.ActorFromContext(ctx)
+	event.Result = "ok"
+	if err != nil {
+		event.Result = err.Error()
+	}
+	if aerr := s.auditLogger.Audit(ctx, event); aerr != nil {
+		slog.Warn("audit log write failed",
+			slog.String("op", string(event.Op)),
+			slog.String("error", aerr.Error()),
+		)
+	}
+}
+
+// auditExpunge records one expunge event per removed message, so the log
+// shows which messages were permanently deleted, plus one event without a
+// UID if the expunge failed.
+func (s *MaildirStore) auditExpunge(ctx context.Context, mailbox, folder string, removed []string, err error) {
+	for _, uid := range removed {
+		s.audit(ctx, msgstore.AuditEvent{Op: msgstore.AuditExpunge, Mailbox: mailbox, Folder: folder, UID: uid}, nil)
+	}
+	if err != nil {
+		s.audit(ctx, msgstore.AuditEvent{Op: msgstore.AuditExpunge, Mailbox: mailbox, Folder: folder}, err)
+	}
+}
@@ -0,0 +1,95 @@
+package maildir
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+// recordingAuditLogger captures audit events for inspection.
+type recordingAuditLogger struct {
+	mu     sync.Mutex
+	events []msgstore.AuditEvent
+}
+
+func (l *recordingAuditLogger) Audit(ctx context.Context, event msgstore.AuditEvent) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.events = append(l.events, event)
+	return nil
+}
+
+func TestMaildirStore_AuditLog(t *testing.T) {
+	logger := &recordingAuditLogger{}
+	store := NewStore(t.TempDir(), "", "", WithAuditLogger(logger))
+	ctx := msgstore.WithActor(context.Background(), "imapd:user@example.com")
+	mailbox := "user@example.com"
+
+	deliverTestMessage(t, store, "Subject: hi\r\n\r\nhello")
+	if err := store.CreateFolder(ctx, mailbox, "Work"); err != nil {
+		t.Fatalf("CreateFolder failed: %v", err)
+	}
+	uid, err := store.AppendToFolder(ctx, mailbox, "Work", strings.NewReader("Subject: x\r\n\r\ny"), nil, time.Now())
+	if err != nil {
+		t.Fatalf("AppendToFolder failed: %v", err)
+	}
+	if err := store.SetFlagsInFolder(ctx, mailbox, "Work", uid, msgstore.FlagModeSet, []string{"\\Seen"}); err != nil {
+		t.Fatalf("SetFlagsInFolder failed: %v", err)
+	}
+	if err := store.DeleteInFolder(ctx, mailbox, "Work", uid); err != nil {
+		t.Fatalf("DeleteInFolder failed: %v", err)
+	}
+	if _, err := store.ExpungeFolder(ctx, mailbox, "Work"); err != nil {
+		t.Fatalf("ExpungeFolder failed: %v", err)
+	}
+	if err := store.RenameFolder(ctx, mailbox, "Work", "Archive"); err != nil {
+		t.Fatalf("RenameFolder failed: %v", err)
+	}
+	if err := store.DeleteFolder(ctx, mailbox, "Missing"); err != errors.ErrFolderNotFound {
+		t.Fatalf("DeleteFolder = %v, want ErrFolderNotFound", err)
+	}
+
+	want := []msgstore.AuditEvent{
+		{Op: msgstore.AuditDeliver, Mailbox: mailbox, Result: "ok"},
+		{Op: msgstore.AuditCreateFolder, Mailbox: mailbox, Folder: "Work", Result: "ok"},
+		{Op: msgstore.AuditAppend, Mailbox: mailbox, Folder: "Work", UID: uid, Result: "ok"},
+		{Op: msgstore.AuditSetFlags, Mailbox: mailbox, Folder: "Work", UID: uid, Detail: "\\Seen", Result: "ok"},
+		{Op: msgstore.AuditDelete, Mailbox: mailbox, Folder: "Work", UID: uid, Result: "ok"},
+		{Op: msgstore.AuditExpunge, Mailbox: mailbox, Folder: "Work", UID: uid, Result: "ok"},
+		{Op: msgstore.AuditRenameFolder, Mailbox: mailbox, Folder: "Work", Detail: "Archive", Result: "ok"},
+		{Op: msgstore.AuditDeleteFolder, Mailbox: mailbox, Folder: "Missing", Result: errors.ErrFolderNotFound.Error()},
+	}
+	// The first delivery also creates the default folders; those are
+	// audited too but are not what this test is about.
+	var events []msgstore.AuditEvent
+	for _, event := range logger.events {
+		if event.Op == msgstore.AuditCreateFolder && event.Actor == "" {
+			continue
+		}
+		events = append(events, event)
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i, got := range events {
+		if got.Time.IsZero() {
+			t.Errorf("event %d has no time", i)
+		}
+		wantActor := "imapd:user@example.com"
+		if got.Op == msgstore.AuditDeliver {
+			wantActor = "" // delivered without an actor in the context
+		}
+		if got.Actor != wantActor {
+			t.Errorf("event %d actor = %q, want %q", i, got.Actor, wantActor)
+		}
+		got.Time, got.Actor = time.Time{}, ""
+		if got != want[i] {
+			t.Errorf("event %d = %+v, want %+v", i, got, want[i])
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package maildir
+
+import "github.com/infodancer/msgstore"
+
+// Capabilities implements msgstore.CapabilityStore.
+func (s *MaildirStore) Capabilities() msgstore.Capabilities {
+	c := msgstore.Capabilities{
+		HierarchyDelimiter: s.delimiter,
+		OtherUsersPrefix:   s.otherUsersPrefix(),
+	}
+	if s.publicMailbox != "" {
+		c.PublicPrefix = s.publicPrefix()
+	}
+	return c
+}
+
+// Compile-time interface verification.
+var _ msgstore.CapabilityStore = (*MaildirStore)(nil)
@@ -0,0 +1,58 @@
+package maildir
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/infodancer/msgstore/errors"
+)
+
+func TestMaildirStore_HierarchyDelimiter(t *testing.T) {
+	if got := NewStore(t.TempDir(), "", "").Capabilities().HierarchyDelimiter; got != "." {
+		t.Errorf("default delimiter = %q, want %q", got, ".")
+	}
+	for _, bad := range []string{"", "//", "a", "-"} {
+		if got := NewStore(t.TempDir(), "", "", WithHierarchyDelimiter(bad)).Capabilities().HierarchyDelimiter; got != "." {
+			t.Errorf("WithHierarchyDelimiter(%q): delimiter = %q, want default", bad, got)
+		}
+	}
+
+	basePath := t.TempDir()
+	store := NewStore(basePath, "", "", WithHierarchyDelimiter("/"))
+	ctx := context.Background()
+	if got := store.Capabilities().HierarchyDelimiter; got != "/" {
+		t.Fatalf("delimiter = %q, want %q", got, "/")
+	}
+
+	for _, folder := range []string{"Work", "Work/Projects"} {
+		if err := store.CreateFolder(ctx, "user@example.com", folder); err != nil {
+			t.Fatalf("CreateFolder(%q): %v", folder, err)
+		}
+	}
+	// Nested folders use Maildir++ dot separators on disk.
+	if _, err := os.Stat(filepath.Join(basePath, "user", ".Work.Projects", "cur")); err != nil {
+		t.Errorf("nested folder not stored as .Work.Projects: %v", err)
+	}
+	if err := store.CreateFolder(ctx, "user@example.com", "Work.Projects"); err != errors.ErrInvalidFolderName {
+		t.Errorf("CreateFolder with on-disk separator: got %v, want ErrInvalidFolderName", err)
+	}
+
+	folders, err := store.ListFolders(ctx, "user@example.com")
+	if err != nil {
+		t.Fatalf("ListFolders: %v", err)
+	}
+	var nested []string
+	for _, f := range folders {
+		if f == "Work" || f == "Work/Projects" {
+			nested = append(nested, f)
+		}
+	}
+	sort.Strings(nested)
+	if want := []string{"Work", "Work/Projects"}; !reflect.DeepEqual(nested, want) {
+		t.Errorf("ListFolders = %v, want to include %v", folders, want)
+	}
+}
@@ -0,0 +1,353 @@
+package maildir
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"time"
+
+	"github.com/infodancer/msgstore"
+)
+
+const (
+	// changesFile is a folder's change log inside its maildir: the
+	// folder's highest modification sequence, the modification sequence of
+	// each message and the folder's recent tombstones.
+	changesFile = "changes.json"
+
+	// changesLockFile is the dot-lock held while updating the change log,
+	// so that processes sharing the maildir never lose each other's
+	// tombstones or hand out one modification sequence twice.
+	changesLockFile = changesFile + ".lock"
+
+	// maxTombstones is how many tombstones a folder keeps. Older ones are
+	// dropped, and clients asking about that range must resync.
+	maxTombstones = 10000
+)
+
+// changeLog is the on-disk form of changesFile.
+type changeLog struct {
+	// Incarnation is chosen at random when the folder is created or
+	// renamed and folded into its UIDVALIDITY, so that a folder deleted
+	// and created again under the same name never passes for the old one.
+	// Folders created before it was recorded have none.
+	Incarnation uint32 `json:"incarnation,omitempty"`
+
+	// HighestModSeq is the last modification sequence assigned.
+	HighestModSeq uint64 `json:"highest_modseq"`
+
+	// Floor is the highest modification sequence of a dropped tombstone;
+	// the log is complete only for clients that have seen it.
+	Floor uint64 `json:"floor,omitempty"`
+
+	// Modified maps each known message to the modification sequence of
+	// its arrival or last flag change. Messages that arrive without going
+	// through the store are assigned one when the folder is next resynced.
+	Modified map[string]uint64 `json:"modified,omitempty"`
+
+	// Arrived maps each known message to the modification sequence at
+	// which the log first saw it.
+	Arrived map[string]uint64 `json:"arrived,omitempty"`
+
+	Expunged []tombstoneRecord `json:"expunged,omitempty"`
+}
+
+// tombstoneRecord is the on-disk form of msgstore.Tombstone.
+type tombstoneRecord struct {
+	UID    string    `json:"uid"`
+	ModSeq uint64    `json:"modseq"`
+	At     time.Time `json:"at"`
+}
+
+// readChangeLog loads the change log of the maildir at path; a missing
+// file means an empty log.
+func readChangeLog(fsys FS, path string) (changeLog, error) {
+	var log changeLog
+	data, err := fsys.ReadFile(filepath.Join(path, changesFile))
+	if os.IsNotExist(err) {
+		return log, nil
+	}
+	if err != nil {
+		return log, err
+	}
+	err = json.Unmarshal(data, &log)
+	return log, err
+}
+
+// writeChangeLog atomically replaces the change log of the maildir at path.
+func writeChangeLog(fsys FS, path string, log changeLog) error {
+	data, err := json.Marshal(log)
+	if err != nil {
+		return err
+	}
+	tmp, err := writeTemp(fsys, path, bytes.NewReader(data), false)
+	if err != nil {
+		return err
+	}
+	if err := fsys.Rename(tmp, filepath.Join(path, changesFile)); err != nil {
+		_ = fsys.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// newIncarnation returns a random, nonzero folder incarnation.
+func newIncarnation() uint32 {
+	for {
+		if n := rand.Uint32(); n != 0 {
+			return n
+		}
+	}
+}
+
+// readIncarnation returns the incarnation recorded in the change log of the
+// maildir at path, or 0 if there is none.
+func readIncarnation(fsys FS, path string) (uint32, error) {
+	var log struct {
+		Incarnation uint32 `json:"incarnation"`
+	}
+	data, err := fsys.ReadFile(filepath.Join(path, changesFile))
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	err = json.Unmarshal(data, &log)
+	return log.Incarnation, err
+}
+
+// startIncarnation records a new incarnation for the maildir at path. If
+// keep is set, an incarnation already recorded is left alone.
+func (s *MaildirStore) startIncarnation(path string, keep bool) error {
+	_, err := s.updateChangeLog(path, func(log *changeLog) bool {
+		if keep && log.Incarnation != 0 {
+			return false
+		}
+		log.Incarnation = newIncarnation()
+		return true
+	})
+	return err
+}
+
+// updateChangeLog applies update to the change log of the maildir at path
+// while holding its dot-lock, and writes the log back if update reports a
+// change. It returns the log as updated.
+func (s *MaildirStore) updateChangeLog(path string, update func(log *changeLog) bool) (changeLog, error) {
+	unlock, err := dotLock(s.fs, filepath.Join(path, changesLockFile))
+	if err != nil {
+		return changeLog{}, err
+	}
+	defer unlock()
+	log, err := readChangeLog(s.fs, path)
+	if err != nil {
+		return changeLog{}, err
+	}
+	if !update(&log) {
+		return log, nil
+	}
+	return log, writeChangeLog(s.fs, path, log)
+}
+
+// addTombstones records uids as expunged under one new modification
+// sequence.
+func (log *changeLog) addTombstones(uids []string, now time.Time) {
+	log.HighestModSeq++
+	for _, uid := range uids {
+		delete(log.Modified, uid)
+		delete(log.Arrived, uid)
+		log.Expunged = append(log.Expunged, tombstoneRecord{UID: uid, ModSeq: log.HighestModSeq, At: now})
+	}
+	if drop := len(log.Expunged) - maxTombstones; drop > 0 {
+		log.Floor = log.Expunged[drop-1].ModSeq
+		log.Expunged = append([]tombstoneRecord(nil), log.Expunged[drop:]...)
+	}
+}
+
+// recordExpunged adds tombstones for uids, just removed from the maildir
+// at path, under one new modification sequence. The caller holds the
+// mailbox lock. The messages are already gone, so failures are only logged.
+func (s *MaildirStore) recordExpunged(path string, uids []string) {
+	if len(uids) == 0 {
+		return
+	}
+	now := time.Now().UTC()
+	_, err := s.updateChangeLog(path, func(log *changeLog) bool {
+		log.addTombstones(uids, now)
+		return true
+	})
+	if err != nil {
+		slog.Error("updating change log", "path", path, "error", err)
+	}
+}
+
+// recordModified assigns a new modification sequence to uids, whose flags
+// just changed in the maildir at path. The caller holds the mailbox lock.
+// The change is already made, so failures are only logged.
+func (s *MaildirStore) recordModified(path string, uids []string) {
+	_, err := s.updateChangeLog(path, func(log *changeLog) bool {
+		log.HighestModSeq++
+		if log.Modified == nil {
+			log.Modified = make(map[string]uint64)
+		}
+		for _, uid := range uids {
+			log.Modified[uid] = log.HighestModSeq
+		}
+		return true
+	})
+	if err != nil {
+		slog.Error("updating change log", "path", path, "error", err)
+	}
+}
+
+// scanChanges lists the inbox (folder "" or "INBOX") or a folder and loads
+// its change log, first assigning a modification sequence to messages the
+// log does not know yet: they arrived since the last scan. Messages the log
+// knows that are no longer on disk were removed without going through the
+// store and get tombstones. The caller holds the mailbox lock.
+func (s *MaildirStore) scanChanges(mailbox, folder string) ([]msgstore.MessageInfo, string, changeLog, error) {
+	messages, path, err := s.listFolder(mailbox, folder, "", nil)
+	if err != nil {
+		return nil, "", changeLog{}, err
+	}
+	if err := s.finishExpunge(path); err != nil {
+		return nil, "", changeLog{}, err
+	}
+	files, err := scanMessages(s.fs, path)
+	if err != nil {
+		return nil, "", changeLog{}, err
+	}
+	var scanErr error
+	log, err := s.updateChangeLog(path, func(log *changeLog) bool {
+		var vanished []string
+		for uid := range log.Modified {
+			if _, ok := files[uid]; !ok {
+				vanished = append(vanished, uid)
+			}
+		}
+		if len(vanished) > 0 {
+			// Scan again before trusting the absence: another process may
+			// have been moving the message from new/ to cur/.
+			if files, scanErr = scanMessages(s.fs, path); scanErr != nil {
+				return false
+			}
+			vanished = slices.DeleteFunc(vanished, func(uid string) bool {
+				_, ok := files[uid]
+				return ok
+			})
+		}
+		var arrived []string
+		for _, m := range messages {
+			if _, ok := log.Modified[m.UID]; !ok {
+				arrived = append(arrived, m.UID)
+			}
+		}
+		if len(vanished) == 0 && len(arrived) == 0 {
+			return false
+		}
+		if len(vanished) > 0 {
+			sort.Strings(vanished)
+			log.addTombstones(vanished, time.Now())
+		}
+		if len(arrived) == 0 {
+			return true
+		}
+		log.HighestModSeq++
+		if log.Modified == nil {
+			log.Modified = make(map[string]uint64)
+		}
+		if log.Arrived == nil {
+			log.Arrived = make(map[string]uint64)
+		}
+		for _, uid := range arrived {
+			log.Modified[uid] = log.HighestModSeq
+			log.Arrived[uid] = log.HighestModSeq
+		}
+		return true
+	})
+	if err == nil {
+		err = scanErr
+	}
+	if err != nil {
+		return nil, "", changeLog{}, err
+	}
+	return messages, path, log, nil
+}
+
+// Resync implements msgstore.QResyncStore.
+func (s *MaildirStore) Resync(ctx context.Context, mailbox string, folder string, uidValidity uint32, since uint64) (msgstore.ResyncResult, error) {
+	defer s.lockMailbox(mailbox)()
+
+	messages, _, log, err := s.scanChanges(mailbox, folder)
+	if err != nil {
+		return msgstore.ResyncResult{}, err
+	}
+	current, err := s.UIDValidity(ctx, mailbox, canonicalFolder(folder))
+	if err != nil {
+		return msgstore.ResyncResult{}, err
+	}
+
+	result := msgstore.ResyncResult{UIDValidity: current, HighestModSeq: log.HighestModSeq}
+	// A modification sequence the log never handed out comes from another
+	// incarnation of the folder or another server.
+	if uidValidity != current || since < log.Floor || since > log.HighestModSeq {
+		return result, nil
+	}
+	result.Complete = true
+	for _, m := range messages {
+		if modSeq := log.Modified[m.UID]; modSeq > since {
+			result.Changed = append(result.Changed, msgstore.FlagChange{UID: m.UID, Flags: m.Flags, ModSeq: modSeq})
+		}
+	}
+	sort.Slice(result.Changed, func(i, j int) bool {
+		if result.Changed[i].ModSeq != result.Changed[j].ModSeq {
+			return result.Changed[i].ModSeq < result.Changed[j].ModSeq
+		}
+		return result.Changed[i].UID < result.Changed[j].UID
+	})
+	for _, t := range log.Expunged {
+		if t.ModSeq > since {
+			result.Vanished = append(result.Vanished, t.UID)
+		}
+	}
+	return result, nil
+}
+
+// ExpungedSince implements msgstore.TombstoneStore.
+func (s *MaildirStore) ExpungedSince(ctx context.Context, mailbox string, folder string, since uint64) ([]msgstore.Tombstone, uint64, bool, error) {
+	path, _, err := s.folderDir(mailbox, folder)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	log, err := readChangeLog(s.fs, path)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	var tombstones []msgstore.Tombstone
+	for _, t := range log.Expunged {
+		if t.ModSeq > since {
+			tombstones = append(tombstones, msgstore.Tombstone{UID: t.UID, ModSeq: t.ModSeq, ExpungedAt: t.At})
+		}
+	}
+	return tombstones, log.HighestModSeq, since >= log.Floor, nil
+}
+
+// sortedKeys returns the keys of m in order.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Compile-time interface verification.
+var _ msgstore.TombstoneStore = (*MaildirStore)(nil)
+var _ msgstore.QResyncStore = (*MaildirStore)(nil)
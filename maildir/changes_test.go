@@ -0,0 +1,277 @@
+package maildir
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/infodancer/msgstore"
+)
+
+func TestMaildirStore_ExpungedSince(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+	mailbox := "user@example.com"
+
+	if err := store.CreateFolder(ctx, mailbox, "Work"); err != nil {
+		t.Fatalf("CreateFolder: %v", err)
+	}
+	uids, err := store.AppendMultiple(ctx, mailbox, "INBOX", []msgstore.AppendItem{
+		{Message: strings.NewReader("Subject: a\r\n\r\na")},
+		{Message: strings.NewReader("Subject: b\r\n\r\nb")},
+	})
+	if err != nil {
+		t.Fatalf("AppendMultiple: %v", err)
+	}
+
+	tombstones, highest, complete, err := store.ExpungedSince(ctx, mailbox, "INBOX", 0)
+	if err != nil || len(tombstones) != 0 || highest != 0 || !complete {
+		t.Fatalf("ExpungedSince on fresh folder = %v, %d, %v, %v", tombstones, highest, complete, err)
+	}
+
+	if err := store.Delete(ctx, mailbox, uids[0]); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Expunge(ctx, mailbox); err != nil {
+		t.Fatalf("Expunge: %v", err)
+	}
+	if _, err := store.MoveMessages(ctx, mailbox, "INBOX", uids[1:], "Work"); err != nil {
+		t.Fatalf("MoveMessages: %v", err)
+	}
+
+	tombstones, highest, complete, err = store.ExpungedSince(ctx, mailbox, "INBOX", 0)
+	if err != nil {
+		t.Fatalf("ExpungedSince: %v", err)
+	}
+	if len(tombstones) != 2 || tombstones[0].UID != uids[0] || tombstones[1].UID != uids[1] || highest != 2 || !complete {
+		t.Fatalf("ExpungedSince(0) = %v, %d, %v", tombstones, highest, complete)
+	}
+	if tombstones[0].ExpungedAt.IsZero() {
+		t.Error("tombstone without time")
+	}
+	tombstones, _, _, _ = store.ExpungedSince(ctx, mailbox, "INBOX", 1)
+	if len(tombstones) != 1 || tombstones[0].UID != uids[1] || tombstones[0].ModSeq != 2 {
+		t.Errorf("ExpungedSince(1) = %v", tombstones)
+	}
+}
+
+func TestRecordExpunged_Bounded(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	path, _, err := store.folderDir("user@example.com", "INBOX")
+	if err != nil {
+		t.Fatalf("folderDir: %v", err)
+	}
+	full := changeLog{HighestModSeq: maxTombstones}
+	for i := 1; i <= maxTombstones; i++ {
+		full.Expunged = append(full.Expunged, tombstoneRecord{UID: "uid", ModSeq: uint64(i)})
+	}
+	if err := writeChangeLog(OSFS{}, path, full); err != nil {
+		t.Fatalf("writeChangeLog: %v", err)
+	}
+	store.recordExpunged(path, []string{"uid"})
+	tombstones, highest, complete, err := store.ExpungedSince(context.Background(), "user@example.com", "INBOX", 0)
+	if err != nil {
+		t.Fatalf("ExpungedSince: %v", err)
+	}
+	if len(tombstones) != maxTombstones || highest != maxTombstones+1 || complete {
+		t.Errorf("got %d tombstones, highest %d, complete %v", len(tombstones), highest, complete)
+	}
+	if _, _, complete, _ := store.ExpungedSince(context.Background(), "user@example.com", "INBOX", 1); !complete {
+		t.Error("log incomplete for a client that saw the dropped tombstone")
+	}
+}
+
+func TestRecordModified_SharedAcrossStores(t *testing.T) {
+	// Two stores stand in for two processes: they share the maildir but
+	// not their in-process mailbox locks.
+	basePath := t.TempDir()
+	stores := []*MaildirStore{NewStore(basePath, "", ""), NewStore(basePath, "", "")}
+	path, _, err := stores[0].folderDir("user@example.com", "INBOX")
+	if err != nil {
+		t.Fatalf("folderDir: %v", err)
+	}
+	if err := os.MkdirAll(path, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	const updates = 50
+	var wg sync.WaitGroup
+	for _, store := range stores {
+		wg.Go(func() {
+			for i := 0; i < updates; i++ {
+				store.recordModified(path, []string{"uid"})
+			}
+		})
+	}
+	wg.Wait()
+
+	log, err := readChangeLog(OSFS{}, path)
+	if err != nil {
+		t.Fatalf("readChangeLog: %v", err)
+	}
+	if log.HighestModSeq != 2*updates {
+		t.Errorf("HighestModSeq = %d, want %d: updates were lost", log.HighestModSeq, 2*updates)
+	}
+	if _, err := os.Stat(filepath.Join(path, changesLockFile)); !os.IsNotExist(err) {
+		t.Errorf("lock file left behind: %v", err)
+	}
+}
+
+func TestMaildirStore_Resync(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+	mailbox := "user@example.com"
+
+	uids, err := store.AppendMultiple(ctx, mailbox, "INBOX", []msgstore.AppendItem{
+		{Message: strings.NewReader("Subject: a\r\n\r\na")},
+		{Message: strings.NewReader("Subject: b\r\n\r\nb")},
+		{Message: strings.NewReader("Subject: c\r\n\r\nc")},
+	})
+	if err != nil {
+		t.Fatalf("AppendMultiple: %v", err)
+	}
+	validity, err := store.UIDValidity(ctx, mailbox, "INBOX")
+	if err != nil {
+		t.Fatalf("UIDValidity: %v", err)
+	}
+
+	first, err := store.Resync(ctx, mailbox, "INBOX", validity, 0)
+	if err != nil {
+		t.Fatalf("Resync: %v", err)
+	}
+	if !first.Complete || len(first.Changed) != 3 || first.HighestModSeq == 0 {
+		t.Fatalf("initial Resync = %+v", first)
+	}
+
+	if err := store.SetFlagsInFolder(ctx, mailbox, "INBOX", uids[0], msgstore.FlagModeAdd, []string{"\\Seen"}); err != nil {
+		t.Fatalf("SetFlagsInFolder: %v", err)
+	}
+	if err := store.Delete(ctx, mailbox, uids[1]); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Expunge(ctx, mailbox); err != nil {
+		t.Fatalf("Expunge: %v", err)
+	}
+
+	got, err := store.Resync(ctx, mailbox, "INBOX", validity, first.HighestModSeq)
+	if err != nil {
+		t.Fatalf("Resync: %v", err)
+	}
+	if !got.Complete || got.HighestModSeq <= first.HighestModSeq {
+		t.Fatalf("Resync = %+v", got)
+	}
+	if len(got.Changed) != 1 || got.Changed[0].UID != uids[0] || !hasFlag(got.Changed[0].Flags, "\\Seen") {
+		t.Errorf("Changed = %+v, want the flagged message", got.Changed)
+	}
+	if len(got.Vanished) != 1 || got.Vanished[0] != uids[1] {
+		t.Errorf("Vanished = %v, want %s", got.Vanished, uids[1])
+	}
+
+	if stale, _ := store.Resync(ctx, mailbox, "INBOX", validity+1, first.HighestModSeq); stale.Complete || len(stale.Changed) != 0 {
+		t.Errorf("Resync with stale UIDVALIDITY = %+v", stale)
+	}
+}
+
+func TestMaildirStore_ResyncRecreatedFolder(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+	mailbox := "user@example.com"
+
+	appendThree := func() {
+		t.Helper()
+		if _, err := store.AppendMultiple(ctx, mailbox, "Work", []msgstore.AppendItem{
+			{Message: strings.NewReader("Subject: a\r\n\r\na")},
+			{Message: strings.NewReader("Subject: b\r\n\r\nb")},
+			{Message: strings.NewReader("Subject: c\r\n\r\nc")},
+		}); err != nil {
+			t.Fatalf("AppendMultiple: %v", err)
+		}
+	}
+	if err := store.CreateFolder(ctx, mailbox, "Work"); err != nil {
+		t.Fatalf("CreateFolder: %v", err)
+	}
+	appendThree()
+	old, err := store.UIDValidity(ctx, mailbox, "Work")
+	if err != nil {
+		t.Fatalf("UIDValidity: %v", err)
+	}
+	first, err := store.Resync(ctx, mailbox, "Work", old, 0)
+	if err != nil || !first.Complete {
+		t.Fatalf("Resync = %+v, %v", first, err)
+	}
+	if beyond, _ := store.Resync(ctx, mailbox, "Work", old, first.HighestModSeq+100); beyond.Complete {
+		t.Errorf("Resync past the highest modification sequence = %+v, want incomplete", beyond)
+	}
+
+	if err := store.DeleteFolder(ctx, mailbox, "Work", msgstore.WithForce()); err != nil {
+		t.Fatalf("DeleteFolder: %v", err)
+	}
+	if err := store.CreateFolder(ctx, mailbox, "Work"); err != nil {
+		t.Fatalf("CreateFolder: %v", err)
+	}
+	appendThree()
+	recreated, err := store.UIDValidity(ctx, mailbox, "Work")
+	if err != nil {
+		t.Fatalf("UIDValidity: %v", err)
+	}
+	if recreated == old {
+		t.Errorf("recreated folder kept UIDVALIDITY %d", old)
+	}
+	if got, _ := store.Resync(ctx, mailbox, "Work", old, first.HighestModSeq); got.Complete || got.UIDValidity != recreated {
+		t.Errorf("Resync with the old UIDVALIDITY = %+v, want incomplete", got)
+	}
+
+	// Renaming a folder away and back starts a new incarnation too.
+	for _, names := range [][2]string{{"Work", "Other"}, {"Other", "Work"}} {
+		if err := store.RenameFolder(ctx, mailbox, names[0], names[1]); err != nil {
+			t.Fatalf("RenameFolder: %v", err)
+		}
+	}
+	if renamed, _ := store.UIDValidity(ctx, mailbox, "Work"); renamed == recreated {
+		t.Errorf("folder renamed back kept UIDVALIDITY %d", recreated)
+	}
+}
+
+func TestMaildirStore_ResyncRemovedBehindStore(t *testing.T) {
+	basePath := t.TempDir()
+	store := NewStore(basePath, "", "")
+	ctx := context.Background()
+	mailbox := "user@example.com"
+
+	uids, err := store.AppendMultiple(ctx, mailbox, "INBOX", []msgstore.AppendItem{
+		{Message: strings.NewReader("Subject: a\r\n\r\na")},
+		{Message: strings.NewReader("Subject: b\r\n\r\nb")},
+	})
+	if err != nil {
+		t.Fatalf("AppendMultiple: %v", err)
+	}
+	validity, err := store.UIDValidity(ctx, mailbox, "INBOX")
+	if err != nil {
+		t.Fatalf("UIDValidity: %v", err)
+	}
+	first, err := store.Resync(ctx, mailbox, "INBOX", validity, 0)
+	if err != nil {
+		t.Fatalf("Resync: %v", err)
+	}
+
+	// Another mail client removes a message directly.
+	path := filepath.Join(basePath, "user")
+	files, err := scanMessages(store.fs, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(path, files[uids[0]])); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.Resync(ctx, mailbox, "INBOX", validity, first.HighestModSeq)
+	if err != nil {
+		t.Fatalf("Resync: %v", err)
+	}
+	if !got.Complete || len(got.Vanished) != 1 || got.Vanished[0] != uids[0] || len(got.Changed) != 0 {
+		t.Errorf("Resync = %+v, want %s vanished", got, uids[0])
+	}
+}
@@ -0,0 +1,41 @@
+package maildir
+
+import (
+	"context"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+// HighestModSeq implements msgstore.ConditionalStore.
+func (s *MaildirStore) HighestModSeq(ctx context.Context, mailbox string, folder string) (uint64, error) {
+	defer s.lockMailbox(mailbox)()
+	_, _, log, err := s.scanChanges(mailbox, folder)
+	if err != nil {
+		return 0, err
+	}
+	return log.HighestModSeq, nil
+}
+
+// checkUnchanged enforces the precondition set on ctx with
+// msgstore.WithUnchangedSince, returning errors.ErrConflict if folder (""
+// or "INBOX" for the inbox) has changed since. Messages that arrived
+// without going through the store count as changes, so the folder is
+// scanned first. The caller holds the mailbox lock.
+func (s *MaildirStore) checkUnchanged(ctx context.Context, mailbox, folder string) error {
+	modSeq, ok := msgstore.UnchangedSinceFromContext(ctx)
+	if !ok {
+		return nil
+	}
+	_, _, log, err := s.scanChanges(mailbox, folder)
+	if err != nil {
+		return err
+	}
+	if log.HighestModSeq != modSeq {
+		return errors.ErrConflict
+	}
+	return nil
+}
+
+// Compile-time interface verification.
+var _ msgstore.ConditionalStore = (*MaildirStore)(nil)
@@ -0,0 +1,85 @@
+package maildir
+
+import (
+	"context"
+	stderrors "errors"
+	"strings"
+	"testing"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+func TestMaildirStore_UnchangedSince(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+	mailbox := "user@example.com"
+
+	uids, err := store.AppendMultiple(ctx, mailbox, "INBOX", []msgstore.AppendItem{
+		{Message: strings.NewReader("Subject: a\r\n\r\na")},
+		{Message: strings.NewReader("Subject: b\r\n\r\nb")},
+	})
+	if err != nil {
+		t.Fatalf("AppendMultiple: %v", err)
+	}
+	modSeq, err := store.HighestModSeq(ctx, mailbox, "INBOX")
+	if err != nil {
+		t.Fatalf("HighestModSeq: %v", err)
+	}
+
+	// A conditional change against the current state succeeds.
+	cond := msgstore.WithUnchangedSince(ctx, modSeq)
+	if err := store.SetFlagsInFolder(cond, mailbox, "INBOX", uids[0], msgstore.FlagModeAdd, []string{"\\Seen"}); err != nil {
+		t.Fatalf("SetFlagsInFolder: %v", err)
+	}
+
+	// The same token is now stale: the flag change bumped the folder.
+	if err := store.SetFlagsInFolder(cond, mailbox, "INBOX", uids[1], msgstore.FlagModeAdd, []string{"\\Flagged"}); !stderrors.Is(err, errors.ErrConflict) {
+		t.Fatalf("stale SetFlagsInFolder error = %v, want ErrConflict", err)
+	}
+	if err := store.Delete(cond, mailbox, uids[1]); !stderrors.Is(err, errors.ErrConflict) {
+		t.Fatalf("stale Delete error = %v, want ErrConflict", err)
+	}
+	if _, err := store.MoveMessages(cond, mailbox, "INBOX", uids[1:], "Archive"); !stderrors.Is(err, errors.ErrConflict) {
+		t.Fatalf("stale MoveMessages error = %v, want ErrConflict", err)
+	}
+	msgs, err := store.List(ctx, mailbox)
+	if err != nil || len(msgs) != 2 {
+		t.Fatalf("List = %v, %v", msgs, err)
+	}
+	for _, m := range msgs {
+		if m.UID == uids[1] && len(m.Flags) != 0 {
+			t.Errorf("refused change was applied: flags %v", m.Flags)
+		}
+	}
+
+	// Refreshing the token lets the caller retry.
+	if modSeq, err = store.HighestModSeq(ctx, mailbox, "INBOX"); err != nil {
+		t.Fatalf("HighestModSeq: %v", err)
+	}
+	if err := store.Delete(msgstore.WithUnchangedSince(ctx, modSeq), mailbox, uids[1]); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	removed, err := store.Expunge(msgstore.WithUnchangedSince(ctx, modSeq), mailbox)
+	if err != nil || len(removed) != 1 {
+		t.Fatalf("Expunge = %v, %v", removed, err)
+	}
+}
+
+func TestMaildirStore_UnchangedSinceExternalArrival(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+	mailbox := "user@example.com"
+
+	modSeq, err := store.HighestModSeq(ctx, mailbox, "INBOX")
+	if err != nil {
+		t.Fatalf("HighestModSeq: %v", err)
+	}
+	envelope := msgstore.Envelope{Recipients: []string{mailbox}}
+	if err := store.Deliver(ctx, envelope, strings.NewReader("Subject: new\r\n\r\n")); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	if _, err := store.ExpungeFolder(msgstore.WithUnchangedSince(ctx, modSeq), mailbox, "INBOX"); !stderrors.Is(err, errors.ErrConflict) {
+		t.Errorf("ExpungeFolder after a delivery error = %v, want ErrConflict", err)
+	}
+}
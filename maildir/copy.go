@@ -0,0 +1,156 @@
+package maildir
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+// scanMessages reads new/ and cur/ of a maildir once and maps each message
+// key to its file name relative to the maildir (e.g. "cur/<key>:2,S").
+func scanMessages(fsys FS, path string) (map[string]string, error) {
+	files := make(map[string]string)
+	for _, sub := range []string{"new", "cur"} {
+		entries, err := fsys.ReadDir(filepath.Join(path, sub))
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if !entry.Type().IsRegular() || strings.HasPrefix(name, ".") {
+				continue
+			}
+			key, _, _ := strings.Cut(name, ":")
+			files[key] = filepath.Join(sub, name)
+		}
+	}
+	return files, nil
+}
+
+// destinationName returns the file name relative to the maildir for a
+// message stored under name, renamed to key. Messages in new/ have no info
+// suffix; messages in cur/ keep theirs, and so their flags.
+func destinationName(name, key string) string {
+	sub, base := filepath.Split(name)
+	if _, info, ok := strings.Cut(base, ":"); ok {
+		return filepath.Join(sub, key+":"+info)
+	}
+	return filepath.Join(sub, key)
+}
+
+// copyFile copies the message file src to dst within destPath, as a hard
+// link if possible and through tmp/ otherwise, so dst never appears partially
+// written. It returns os.ErrExist if dst already exists. prepare, if not
+// nil, is applied to a copy made through tmp/ before it is moved into place.
+func copyFile(fsys FS, src, destPath, dst string, prepare func(name string) error) error {
+	err := fsys.Link(src, dst)
+	if err == nil || os.IsExist(err) {
+		return err
+	}
+
+	// Hard links fail across filesystems and on some network filesystems.
+	in, err := fsys.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+	tmp, err := writeTemp(fsys, destPath, in, false)
+	if err != nil {
+		return err
+	}
+	if prepare != nil {
+		if err := prepare(tmp); err != nil {
+			_ = fsys.Remove(tmp)
+			return err
+		}
+	}
+	if _, err := fsys.Stat(dst); err == nil {
+		_ = fsys.Remove(tmp)
+		return os.ErrExist
+	}
+	return fsys.Rename(tmp, dst)
+}
+
+// CopyMessages implements msgstore.MessageCopier.
+func (s *MaildirStore) CopyMessages(ctx context.Context, mailbox string, srcFolder string, uids []string, destFolder string) (copied map[string]string, err error) {
+	copied = make(map[string]string)
+	defer func() {
+		for _, uid := range uids {
+			if newUID, ok := copied[uid]; ok {
+				s.audit(ctx, msgstore.AuditEvent{Op: msgstore.AuditCopy, Mailbox: mailbox, Folder: srcFolder, UID: uid, Detail: destFolder + "/" + newUID}, nil)
+			}
+		}
+		if err != nil {
+			s.audit(ctx, msgstore.AuditEvent{Op: msgstore.AuditCopy, Mailbox: mailbox, Folder: srcFolder, Detail: destFolder}, err)
+		}
+	}()
+	defer s.lockMailbox(mailbox)()
+
+	srcPath, destPath, err := s.transferPaths(mailbox, srcFolder, destFolder)
+	if err != nil {
+		return copied, err
+	}
+	defer func() { s.carryAnnotations(srcPath, destPath, copied, false) }()
+	remap := s.keywordRemapper(srcPath, destPath)
+	prepare, err := s.prepareFile(mailbox)
+	if err != nil {
+		return copied, err
+	}
+	files, err := scanMessages(s.fs, srcPath)
+	if os.IsNotExist(err) {
+		return copied, errors.ErrFolderNotFound
+	}
+	if err != nil {
+		return copied, err
+	}
+
+	for _, uid := range uids {
+		name, ok := files[uid]
+		if !ok {
+			continue // already gone; IMAP ignores UIDs that do not exist
+		}
+		if _, done := copied[uid]; done {
+			continue
+		}
+		for {
+			key, err := newKeyLike(s.fs, filepath.Join(srcPath, name))
+			if err != nil {
+				return copied, err
+			}
+			err = copyFile(s.fs, filepath.Join(srcPath, name), destPath, filepath.Join(destPath, destinationName(remap(name), key)), prepare)
+			if os.IsExist(err) {
+				continue
+			}
+			if err != nil {
+				return copied, err
+			}
+			copied[uid] = key
+			break
+		}
+	}
+	return copied, nil
+}
+
+// transferPaths resolves and checks the source of a copy or move and makes
+// sure the destination maildir exists. Either folder may be "INBOX".
+func (s *MaildirStore) transferPaths(mailbox, srcFolder, destFolder string) (srcPath, destPath string, err error) {
+	srcPath, err = s.folderOrInboxPath(mailbox, srcFolder)
+	if err != nil {
+		return "", "", err
+	}
+	destPath, err = s.folderOrInboxPath(mailbox, destFolder)
+	if err != nil {
+		return "", "", err
+	}
+	if err := s.createMaildir(mailbox, destPath); err != nil {
+		return "", "", err
+	}
+	return srcPath, destPath, nil
+}
+
+// Compile-time interface verification.
+var _ msgstore.MessageCopier = (*MaildirStore)(nil)
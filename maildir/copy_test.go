@@ -0,0 +1,81 @@
+package maildir
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/infodancer/msgstore/errors"
+)
+
+func TestMaildirStore_CopyMessages(t *testing.T) {
+	basePath := t.TempDir()
+	store := NewStore(basePath, "", "")
+	ctx := context.Background()
+	mailbox := "user@example.com"
+
+	// One message still in new/ and one in cur/ with flags.
+	deliverTestMessage(t, store, "Subject: new\r\n\r\nfresh")
+	entries, err := os.ReadDir(filepath.Join(basePath, "user", "new"))
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("expected one message in new/: %v", err)
+	}
+	newUID := entries[0].Name()
+	seenUID, err := store.AppendToFolder(ctx, mailbox, "INBOX", strings.NewReader("Subject: seen\r\n\r\nold"), []string{"\\Seen"}, time.Now())
+	if err != nil {
+		t.Fatalf("AppendToFolder: %v", err)
+	}
+
+	copied, err := store.CopyMessages(ctx, mailbox, "INBOX", []string{newUID, seenUID, "missing"}, "Archive")
+	if err != nil {
+		t.Fatalf("CopyMessages: %v", err)
+	}
+	if len(copied) != 2 || copied[newUID] == "" || copied[seenUID] == "" {
+		t.Fatalf("copied = %v, want entries for %s and %s", copied, newUID, seenUID)
+	}
+	if copied[newUID] == newUID || copied[newUID] == copied[seenUID] {
+		t.Errorf("copies need fresh, distinct UIDs: %v", copied)
+	}
+
+	msgs, err := store.ListInFolder(ctx, mailbox, "Archive")
+	if err != nil {
+		t.Fatalf("ListInFolder: %v", err)
+	}
+	if len(msgs) != 2 {
+		t.Fatalf("expected 2 messages in Archive, got %d", len(msgs))
+	}
+	for _, m := range msgs {
+		seen := false
+		for _, f := range m.Flags {
+			seen = seen || f == "\\Seen"
+		}
+		if want := m.UID == copied[seenUID]; seen != want {
+			t.Errorf("message %s: \\Seen = %v, want %v", m.UID, seen, want)
+		}
+	}
+
+	rc, err := store.RetrieveFromFolder(ctx, mailbox, "Archive", copied[seenUID])
+	if err != nil {
+		t.Fatalf("RetrieveFromFolder: %v", err)
+	}
+	body, _ := io.ReadAll(rc)
+	_ = rc.Close()
+	if string(body) != "Subject: seen\r\n\r\nold" {
+		t.Errorf("copy content = %q", body)
+	}
+
+	// The source is untouched.
+	if rc, err := store.Retrieve(ctx, mailbox, seenUID); err != nil {
+		t.Errorf("source message missing after copy: %v", err)
+	} else {
+		_ = rc.Close()
+	}
+
+	if _, err := store.CopyMessages(ctx, mailbox, "Nowhere", []string{seenUID}, "Archive"); err != errors.ErrFolderNotFound {
+		t.Errorf("expected ErrFolderNotFound, got %v", err)
+	}
+}
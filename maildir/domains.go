@@ -0,0 +1,252 @@
+package maildir
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+	"golang.org/x/text/unicode/norm"
+)
+
+// DomainPath places the mailboxes of one domain, for example on a volume of
+// its own. Empty fields fall back to the store's base path and path
+// template.
+type DomainPath struct {
+	// BasePath is the directory holding the domain's mailboxes.
+	BasePath string
+
+	// PathTemplate builds a mailbox's path under BasePath from {domain},
+	// {localpart} and {email}, as the pathTemplate of NewStore does.
+	PathTemplate string
+}
+
+// WithDomainPaths places the mailboxes of the given domains by their
+// DomainPath instead of the store's base path and path template. Domains
+// are matched case-insensitively; mailboxes of other domains, and those
+// without a domain, keep the store's layout. A mailbox resolver (see
+// WithMailboxResolver) takes precedence over the mapping.
+func WithDomainPaths(paths map[string]DomainPath) Option {
+	return func(s *MaildirStore) {
+		if s.domainPaths == nil {
+			s.domainPaths = make(map[string]DomainPath, len(paths))
+		}
+		for domain, p := range paths {
+			s.domainPaths[domainKey(domain)] = p
+		}
+	}
+}
+
+// mailboxLayout returns the base path and path template mailbox is placed
+// by.
+func (s *MaildirStore) mailboxLayout(mailbox string) (basePath, pathTemplate string) {
+	basePath, pathTemplate = s.basePath, s.pathTemplate
+	if len(s.domainPaths) == 0 {
+		return basePath, pathTemplate
+	}
+	_, domain := splitEmail(mailbox)
+	p, ok := s.domainPaths[domainKey(domain)]
+	if !ok {
+		return basePath, pathTemplate
+	}
+	if p.BasePath != "" {
+		basePath = p.BasePath
+	}
+	if p.PathTemplate != "" {
+		pathTemplate = p.PathTemplate
+	}
+	return basePath, pathTemplate
+}
+
+// domainKey is the key of domain in the domain path map: NFC-normalized
+// and lower-cased, so that every spelling of a domain finds its entry.
+func domainKey(domain string) string {
+	return strings.ToLower(norm.NFC.String(domain))
+}
+
+// mailboxKey identifies mailbox for the store's per-mailbox locks. It is
+// the mailbox's location, so that mailboxes of different domains that
+// expand to the same relative path do not share a lock.
+//
+// A failing path resolver leaves the key to the path template; the
+// operation taking the lock then fails resolving the same path.
+func (s *MaildirStore) mailboxKey(mailbox string) string {
+	basePath, _ := s.mailboxLayout(mailbox)
+	path, err := s.relativeMailboxPath(mailbox)
+	if err != nil {
+		path = s.expandMailbox(mailbox)
+	}
+	return filepath.Join(basePath, path)
+}
+
+// parseDomainOption parses a store option of comma-separated
+// domain=value pairs, such as "example.com=/vol1/mail,example.org=/vol2/mail".
+func parseDomainOption(name, value string) (map[string]string, error) {
+	result := make(map[string]string)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		domain, v, ok := strings.Cut(pair, "=")
+		domain, v = strings.TrimSpace(domain), strings.TrimSpace(v)
+		if !ok || domain == "" || v == "" {
+			return nil, fmt.Errorf("%w: %s: malformed entry %q", errors.ErrStoreConfigInvalid, name, pair)
+		}
+		result[domain] = v
+	}
+	return result, nil
+}
+
+// ListMailboxesByDomain implements msgstore.DomainLister.
+//
+// The domain's path template is inverted: the directories under its base
+// path that the template could have produced for some local part are
+// mailboxes if they hold a maildir. This needs a template that records the
+// local part and, unless the domain has a base path of its own (see
+// WithDomainPaths), the domain; other layouts yield errors.ErrNotSupported.
+// Mailboxes placed by a mailbox or path resolver, and those whose local
+// part was too long for a directory name (see shortenComponents), are not
+// found.
+func (s *MaildirStore) ListMailboxesByDomain(ctx context.Context, domain string) ([]string, error) {
+	if domain == "" || strings.ContainsAny(domain, "@/\\") {
+		return nil, errors.ErrInvalidPath
+	}
+	if s.pathResolver != nil {
+		return nil, fmt.Errorf("listing mailboxes of %s: custom path resolver: %w", domain, errors.ErrNotSupported)
+	}
+	probe := "x@" + domain
+	basePath, pathTemplate := s.mailboxLayout(probe)
+	if pathTemplate == "" {
+		pathTemplate = "{localpart}"
+	}
+	ownBase := s.domainPaths[domainKey(domain)].BasePath != ""
+	if !ownBase && !strings.Contains(pathTemplate, "{domain") && !strings.Contains(pathTemplate, "{email") {
+		return nil, fmt.Errorf("listing mailboxes of %s: path template %q does not record domains: %w", domain, pathTemplate, errors.ErrNotSupported)
+	}
+	if !strings.Contains(pathTemplate, "{localpart") && !strings.Contains(pathTemplate, "{email") {
+		return nil, fmt.Errorf("listing mailboxes of %s: path template %q does not record local parts: %w", domain, pathTemplate, errors.ErrNotSupported)
+	}
+	_, _, expanded := s.templateVars(probe)
+	patterns, err := templatePatterns(pathTemplate, expanded)
+	if err != nil {
+		return nil, err
+	}
+
+	found := make(map[string]bool)
+	var walk func(dir string, depth int, captured map[string]string) error
+	walk = func(dir string, depth int, captured map[string]string) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if depth == len(patterns) {
+			// Confirm the template maps the address back to dir, which
+			// also checks {hash} and modifiers, and that it is a maildir.
+			mailboxDomain := captured["domain"]
+			if mailboxDomain == "" {
+				mailboxDomain = domainKey(domain)
+			}
+			mailbox := captured["localpart"] + "@" + mailboxDomain
+			if root, err := s.mailboxRootPath(mailbox); err != nil || root != filepath.Clean(dir) {
+				return nil
+			}
+			if path, err := s.mailboxPath(mailbox); err == nil {
+				if _, err := s.fs.Stat(filepath.Join(path, "cur")); err == nil {
+					found[mailbox] = true
+				}
+			}
+			return nil
+		}
+		entries, err := s.fs.ReadDir(dir)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if !e.IsDir() || strings.HasPrefix(e.Name(), ".") || isShortened(e.Name()) {
+				continue
+			}
+			m := patterns[depth].FindStringSubmatch(e.Name())
+			if m == nil {
+				continue
+			}
+			next, consistent := maps.Clone(captured), true
+			for k, name := range patterns[depth].SubexpNames() {
+				if name == "" {
+					continue
+				}
+				if prev, ok := next[name]; ok && prev != m[k] {
+					consistent = false
+				}
+				next[name] = m[k]
+			}
+			if !consistent {
+				continue
+			}
+			if err := walk(filepath.Join(dir, e.Name()), depth+1, next); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := walk(basePath, 0, map[string]string{}); err != nil {
+		return nil, err
+	}
+
+	mailboxes := make([]string, 0, len(found))
+	for mailbox := range found {
+		mailboxes = append(mailboxes, mailbox)
+	}
+	sort.Strings(mailboxes)
+	return mailboxes, nil
+}
+
+// templatePatterns returns one regular expression per path component of
+// template, matching the directory names it expands to for domain. Local
+// parts and domains, which match case-insensitively, are captured as the
+// "localpart" and "domain" groups; {hash} matches any two hex digits.
+func templatePatterns(template, domain string) ([]*regexp.Regexp, error) {
+	var patterns []*regexp.Regexp
+	for _, component := range strings.Split(filepath.Clean(template), string(filepath.Separator)) {
+		var expr strings.Builder
+		expr.WriteString("^")
+		last := 0
+		for _, loc := range templateVar.FindAllStringSubmatchIndex(component, -1) {
+			expr.WriteString(regexp.QuoteMeta(component[last:loc[0]]))
+			last = loc[1]
+			name, modifiers := component[loc[2]:loc[3]], component[loc[4]:loc[5]]
+			modified, ok := applyModifiers(domain, modifiers)
+			switch {
+			case !ok:
+				expr.WriteString(regexp.QuoteMeta(component[loc[0]:loc[1]]))
+			case name == "domain":
+				expr.WriteString(`(?P<domain>(?i:` + regexp.QuoteMeta(modified) + `))`)
+			case name == "localpart":
+				expr.WriteString(`(?P<localpart>[^@]+)`)
+			case name == "email":
+				expr.WriteString(`(?P<localpart>[^@]+)@(?P<domain>(?i:` + regexp.QuoteMeta(modified) + `))`)
+			case name == "hash":
+				expr.WriteString(`[0-9a-f]{2}`)
+			}
+		}
+		expr.WriteString(regexp.QuoteMeta(component[last:]))
+		expr.WriteString("$")
+		re, err := regexp.Compile(expr.String())
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns, nil
+}
+
+// Compile-time interface verification.
+var _ msgstore.DomainLister = (*MaildirStore)(nil)
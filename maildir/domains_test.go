@@ -0,0 +1,156 @@
+package maildir
+
+import (
+	"context"
+	stderrors "errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+func TestMaildirStore_DomainPaths(t *testing.T) {
+	basePath := t.TempDir()
+	volume1 := t.TempDir()
+	volume2 := t.TempDir()
+	store := NewStore(basePath, "", "", WithDomainPaths(map[string]DomainPath{
+		"Example.COM": {BasePath: volume1},
+		"example.org": {BasePath: volume2, PathTemplate: "{domain}/{localpart}"},
+	}))
+	ctx := context.Background()
+
+	envelope := msgstore.Envelope{
+		Recipients:   []string{"alice@example.com", "alice@example.org", "alice@example.net"},
+		ReceivedTime: time.Now(),
+	}
+	if err := store.Deliver(ctx, envelope, strings.NewReader("Subject: hi\r\n\r\n")); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	for _, dir := range []string{
+		filepath.Join(volume1, "alice", "new"),
+		filepath.Join(volume2, "example.org", "alice", "new"),
+		filepath.Join(basePath, "alice", "new"),
+	} {
+		entries, err := os.ReadDir(dir)
+		if err != nil || len(entries) != 1 {
+			t.Errorf("%s: %d entries, %v; want 1", dir, len(entries), err)
+		}
+	}
+	for _, mailbox := range []string{"alice@EXAMPLE.com", "alice@example.org"} {
+		if msgs, err := store.List(ctx, mailbox); err != nil || len(msgs) != 1 {
+			t.Errorf("List(%s) = %v, %v", mailbox, msgs, err)
+		}
+	}
+
+	if store.mailboxKey("alice@example.com") == store.mailboxKey("alice@example.net") {
+		t.Error("mailboxes on different volumes share a lock key")
+	}
+}
+
+func TestMaildirStore_DomainPathsTraversal(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "", WithDomainPaths(map[string]DomainPath{
+		"example.com": {BasePath: t.TempDir()},
+	}))
+	if _, err := store.mailboxPath("../escape@example.com"); !stderrors.Is(err, errors.ErrPathTraversal) {
+		t.Errorf("mailboxPath error = %v, want ErrPathTraversal", err)
+	}
+}
+
+func TestRegister_DomainPathOptions(t *testing.T) {
+	volume := t.TempDir()
+	store, err := msgstore.Open(msgstore.StoreConfig{
+		Type:     "maildir",
+		BasePath: t.TempDir(),
+		Options: map[string]string{
+			"domain_paths":          "example.com=" + volume,
+			"domain_path_templates": "example.com={domain}/{localpart}",
+		},
+	})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	envelope := msgstore.Envelope{Recipients: []string{"bob@example.com"}, ReceivedTime: time.Now()}
+	if err := store.Deliver(context.Background(), envelope, strings.NewReader("Subject: hi\r\n\r\n")); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(volume, "example.com", "bob", "new")); err != nil {
+		t.Errorf("mailbox not placed by the domain options: %v", err)
+	}
+
+	_, err = msgstore.Open(msgstore.StoreConfig{
+		Type:     "maildir",
+		BasePath: t.TempDir(),
+		Options:  map[string]string{"domain_paths": "example.com"},
+	})
+	if !stderrors.Is(err, errors.ErrStoreConfigInvalid) {
+		t.Errorf("Open with a malformed domain_paths error = %v, want ErrStoreConfigInvalid", err)
+	}
+}
+
+func TestMaildirStore_ListMailboxesByDomain(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		domains  map[string]DomainPath
+	}{
+		{name: "domain template", template: "{domain}/{localpart}"},
+		{name: "hash and lower", template: "{domain|lower}/{hash}/{localpart}"},
+		{name: "email template", template: "users/{email}"},
+		{name: "own base path", domains: map[string]DomainPath{"example.com": {BasePath: "volume"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			basePath := t.TempDir()
+			var opts []Option
+			if tt.domains != nil {
+				for domain, dp := range tt.domains {
+					dp.BasePath = filepath.Join(basePath, dp.BasePath)
+					tt.domains[domain] = dp
+				}
+				opts = append(opts, WithDomainPaths(tt.domains))
+			}
+			store := NewStore(basePath, "", tt.template, opts...)
+			ctx := context.Background()
+
+			envelope := msgstore.Envelope{
+				Recipients:   []string{"bob@example.com", "alice@example.com", "carol@example.org"},
+				ReceivedTime: time.Now(),
+			}
+			if err := store.Deliver(ctx, envelope, strings.NewReader("Subject: hi\r\n\r\n")); err != nil {
+				t.Fatalf("Deliver: %v", err)
+			}
+
+			got, err := store.ListMailboxesByDomain(ctx, "Example.COM")
+			if err != nil {
+				t.Fatalf("ListMailboxesByDomain: %v", err)
+			}
+			want := []string{"alice@example.com", "bob@example.com"}
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("ListMailboxesByDomain = %v, want %v", got, want)
+			}
+
+			if tt.domains == nil {
+				got, err = store.ListMailboxesByDomain(ctx, "example.net")
+				if err != nil || len(got) != 0 {
+					t.Errorf("ListMailboxesByDomain(example.net) = %v, %v; want none", got, err)
+				}
+			}
+		})
+	}
+}
+
+func TestMaildirStore_ListMailboxesByDomainUnsupported(t *testing.T) {
+	ctx := context.Background()
+	store := NewStore(t.TempDir(), "", "")
+	if _, err := store.ListMailboxesByDomain(ctx, "example.com"); !stderrors.Is(err, errors.ErrNotSupported) {
+		t.Errorf("default layout error = %v, want ErrNotSupported", err)
+	}
+	store = NewStore(t.TempDir(), "", "{domain}/{localpart}")
+	if _, err := store.ListMailboxesByDomain(ctx, "../etc"); !stderrors.Is(err, errors.ErrInvalidPath) {
+		t.Errorf("invalid domain error = %v, want ErrInvalidPath", err)
+	}
+}
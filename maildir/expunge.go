@@ -0,0 +1,109 @@
+package maildir
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/infodancer/msgstore"
+)
+
+// expungeStagingDir is the directory inside a maildir, next to cur/, that
+// messages being expunged are renamed into before they are unlinked. An
+// expunge moves every message there, records their tombstones, and only
+// then unlinks them, so a crash part way leaves the remaining messages
+// either untouched or staged. Staged messages are finished by
+// finishExpunge on the next expunge or change scan of the maildir.
+const expungeStagingDir = "expunging"
+
+// finishExpunge completes an expunge that was interrupted in the maildir
+// at path: it records tombstones for staged messages the change log does
+// not list as expunged yet, then unlinks them. The caller holds the
+// mailbox lock.
+func (s *MaildirStore) finishExpunge(path string) error {
+	staging := filepath.Join(path, expungeStagingDir)
+	entries, err := s.fs.ReadDir(staging)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	log, err := readChangeLog(s.fs, path)
+	if err != nil {
+		return err
+	}
+	var unrecorded []string
+	for _, entry := range entries {
+		uid, _, _ := strings.Cut(entry.Name(), ":")
+		if !slices.ContainsFunc(log.Expunged, func(t tombstoneRecord) bool { return t.UID == uid }) {
+			unrecorded = append(unrecorded, uid)
+		}
+	}
+	slog.Warn("finishing interrupted expunge", "path", path, "messages", len(entries))
+	slices.Sort(unrecorded)
+	s.recordExpunged(path, unrecorded)
+	for _, entry := range entries {
+		if err := s.fs.Remove(filepath.Join(staging, entry.Name())); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// ExpungeUIDs implements msgstore.UIDExpunger.
+func (s *MaildirStore) ExpungeUIDs(ctx context.Context, mailbox string, folder string, uids []string) ([]string, error) {
+	if strings.EqualFold(folder, "INBOX") {
+		folder = ""
+	}
+	removed, err := s.expungeUIDs(ctx, mailbox, folder, uids)
+	s.auditExpunge(ctx, mailbox, folder, removed, err)
+	s.hooks.expunge(ctx, mailbox, folder, removed)
+	return removed, err
+}
+
+// expungeUIDs removes the messages in uids that are marked for deletion,
+// holding the mailbox lock. Only the selected UIDs are cleared from the
+// soft-delete state; the rest stay marked for a later expunge.
+func (s *MaildirStore) expungeUIDs(ctx context.Context, mailbox, folder string, uids []string) ([]string, error) {
+	path, key, err := s.folderDir(mailbox, folder)
+	if err != nil {
+		return nil, err
+	}
+
+	defer s.lockMailbox(mailbox)()
+	if err := s.checkUnchanged(ctx, mailbox, folder); err != nil {
+		return nil, err
+	}
+
+	selected := make(map[string]bool)
+	s.deletedMu.Lock()
+	if deleted := s.deleted[key]; deleted != nil {
+		for _, uid := range uids {
+			if deleted[uid] {
+				selected[uid] = true
+				delete(deleted, uid)
+			}
+		}
+		if len(deleted) == 0 {
+			delete(s.deleted, key)
+		}
+	}
+	s.deletedMu.Unlock()
+
+	if len(selected) == 0 {
+		return nil, nil
+	}
+	removed, err := s.discardMessages(mailbox, folder, path, selected)
+	s.recent.forget(s.fs, path, removed)
+	return removed, err
+}
+
+var _ msgstore.UIDExpunger = (*MaildirStore)(nil)
@@ -0,0 +1,149 @@
+package maildir
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestMaildirStore_ExpungeUIDs(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+	mailbox := "user@example.com"
+
+	for i := 0; i < 4; i++ {
+		deliverTestMessage(t, store, "Subject: hi\r\n\r\nhello")
+	}
+	msgs, err := store.List(ctx, mailbox)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	uids := make([]string, len(msgs))
+	for i, m := range msgs {
+		uids[i] = m.UID
+	}
+	sort.Strings(uids)
+
+	for _, uid := range uids[:3] {
+		if err := store.Delete(ctx, mailbox, uid); err != nil {
+			t.Fatalf("Delete failed: %v", err)
+		}
+	}
+
+	// Only deleted messages in the set are removed; uids[3] is not deleted.
+	removed, err := store.ExpungeUIDs(ctx, mailbox, "INBOX", []string{uids[1], uids[0], uids[3]})
+	if err != nil {
+		t.Fatalf("ExpungeUIDs failed: %v", err)
+	}
+	if want := uids[:2]; !reflect.DeepEqual(removed, want) {
+		t.Errorf("removed = %v, want %v", removed, want)
+	}
+
+	// uids[2] stays marked and is removed by a full expunge.
+	if _, err := store.Retrieve(ctx, mailbox, uids[3]); err != nil {
+		t.Errorf("undeleted message was removed: %v", err)
+	}
+	removed, err = store.Expunge(ctx, mailbox)
+	if err != nil {
+		t.Fatalf("Expunge failed: %v", err)
+	}
+	if want := []string{uids[2]}; !reflect.DeepEqual(removed, want) {
+		t.Errorf("removed = %v, want %v", removed, want)
+	}
+
+	if _, err := store.ExpungeUIDs(ctx, mailbox, "Nowhere", uids); err == nil {
+		t.Error("expected error for missing folder")
+	}
+}
+
+func TestMaildirStore_ExpungeStagesThenUnlinks(t *testing.T) {
+	basePath := t.TempDir()
+	store := NewStore(basePath, "", "")
+	ctx := context.Background()
+	mailbox := "user@example.com"
+	path := filepath.Join(basePath, "user")
+
+	deliverTestMessage(t, store, "Subject: one\r\n\r\n")
+	msgs, err := store.List(ctx, mailbox)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("List = %v, %v", msgs, err)
+	}
+	if err := store.Delete(ctx, mailbox, msgs[0].UID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Expunge(ctx, mailbox); err != nil {
+		t.Fatalf("Expunge: %v", err)
+	}
+	if entries, err := os.ReadDir(filepath.Join(path, expungeStagingDir)); err != nil || len(entries) != 0 {
+		t.Errorf("staging directory = %v, %v; want empty", entries, err)
+	}
+	tombstones, _, _, err := store.ExpungedSince(ctx, mailbox, "", 0)
+	if err != nil || len(tombstones) != 1 || tombstones[0].UID != msgs[0].UID {
+		t.Errorf("ExpungedSince = %+v, %v", tombstones, err)
+	}
+}
+
+func TestMaildirStore_ResumesInterruptedExpunge(t *testing.T) {
+	basePath := t.TempDir()
+	store := NewStore(basePath, "", "")
+	ctx := context.Background()
+	mailbox := "user@example.com"
+	path := filepath.Join(basePath, "user")
+
+	for range 3 {
+		deliverTestMessage(t, store, "Subject: hi\r\n\r\n")
+	}
+	msgs, err := store.List(ctx, mailbox)
+	if err != nil || len(msgs) != 3 {
+		t.Fatalf("List = %v, %v", msgs, err)
+	}
+	if _, err := store.HighestModSeq(ctx, mailbox, ""); err != nil {
+		t.Fatalf("HighestModSeq: %v", err)
+	}
+
+	// Simulate a crash part way through an expunge: one message was staged
+	// and journaled, another only staged.
+	staging := filepath.Join(path, expungeStagingDir)
+	if err := os.Mkdir(staging, 0700); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range msgs[:2] {
+		msg, err := messageByKey(OSFS{}, path, m.UID)
+		if err != nil {
+			t.Fatalf("messageByKey: %v", err)
+		}
+		if err := os.Rename(msg.filename, filepath.Join(staging, filepath.Base(msg.filename))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	store.recordExpunged(path, []string{msgs[0].UID})
+
+	// A fresh store finishes the expunge on its next change scan.
+	fresh := NewStore(basePath, "", "")
+	if _, err := fresh.HighestModSeq(ctx, mailbox, ""); err != nil {
+		t.Fatalf("HighestModSeq: %v", err)
+	}
+	if entries, err := os.ReadDir(staging); err != nil || len(entries) != 0 {
+		t.Errorf("staging directory = %v, %v; want empty", entries, err)
+	}
+	tombstones, _, _, err := fresh.ExpungedSince(ctx, mailbox, "", 0)
+	if err != nil {
+		t.Fatalf("ExpungedSince: %v", err)
+	}
+	var got []string
+	for _, ts := range tombstones {
+		got = append(got, ts.UID)
+	}
+	want := []string{msgs[0].UID, msgs[1].UID}
+	sort.Strings(got)
+	sort.Strings(want)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tombstones = %v, want %v, each once", got, want)
+	}
+	if remaining, err := fresh.List(ctx, mailbox); err != nil || len(remaining) != 1 || remaining[0].UID != msgs[2].UID {
+		t.Errorf("List = %v, %v; want only the untouched message", remaining, err)
+	}
+}
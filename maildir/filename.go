@@ -0,0 +1,223 @@
+package maildir
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/emersion/go-maildir"
+	"github.com/infodancer/msgstore/errors"
+)
+
+// Filename is a parsed maildir file name:
+//
+//	<seconds>.<unique>.<host>[,<attr>=<value>...][:2,<flags>]
+//
+// The attributes follow the Courier and Dovecot extensions: S= records the
+// file size and W= the size with CRLF line endings.
+type Filename struct {
+	// Time is the delivery time taken from the leading seconds, refined by
+	// an M<microseconds> component of Unique when present.
+	Time time.Time
+
+	// Unique is the part between the first two dots (e.g. "M20P1Q3R4f2a").
+	Unique string
+
+	// Host is the host part as stored, with "/" and ":" still escaped.
+	Host string
+
+	// Size is the S= attribute, or -1 if absent.
+	Size int64
+
+	// VirtualSize is the W= attribute, or -1 if absent.
+	VirtualSize int64
+
+	// Attrs holds the other ",<attr>=<value>" attributes, in order and
+	// without the comma, so they survive a round trip.
+	Attrs []string
+
+	// HasInfo reports whether the name has a ":2," info suffix, as the
+	// names of messages in cur/ do.
+	HasInfo bool
+
+	// Flags are the flags from the info suffix.
+	Flags []maildir.Flag
+}
+
+// ParseFilename parses a maildir file name. It returns ErrInvalidFilename
+// for names that do not follow the maildir convention.
+func ParseFilename(name string) (Filename, error) {
+	invalid := fmt.Errorf("%w: %q", errors.ErrInvalidFilename, name)
+	key, info, hasInfo := strings.Cut(name, ":")
+	f := Filename{Size: -1, VirtualSize: -1, HasInfo: hasInfo}
+	if hasInfo {
+		flags, ok := strings.CutPrefix(info, "2,")
+		if !ok {
+			return Filename{}, invalid
+		}
+		f.Flags = []maildir.Flag(flags)
+	}
+
+	secs, rest, ok := strings.Cut(key, ".")
+	if !ok {
+		return Filename{}, invalid
+	}
+	f.Unique, rest, ok = strings.Cut(rest, ".")
+	if !ok || f.Unique == "" {
+		return Filename{}, invalid
+	}
+	sec, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil || sec < 0 {
+		return Filename{}, invalid
+	}
+	f.Time = time.Unix(sec, uniqueMicros(f.Unique)*1000)
+
+	host, attrs, _ := strings.Cut(rest, ",")
+	if host == "" {
+		return Filename{}, invalid
+	}
+	f.Host = host
+	if attrs == "" {
+		return f, nil
+	}
+	for _, attr := range strings.Split(attrs, ",") {
+		var target *int64
+		switch {
+		case strings.HasPrefix(attr, "S="):
+			target = &f.Size
+		case strings.HasPrefix(attr, "W="):
+			target = &f.VirtualSize
+		default:
+			f.Attrs = append(f.Attrs, attr)
+			continue
+		}
+		n, err := strconv.ParseInt(attr[2:], 10, 64)
+		if err != nil || n < 0 {
+			return Filename{}, invalid
+		}
+		*target = n
+	}
+	return f, nil
+}
+
+// uniqueMicros returns the M<microseconds> component of a unique part, or 0.
+func uniqueMicros(unique string) int64 {
+	i := strings.IndexByte(unique, 'M')
+	if i < 0 {
+		return 0
+	}
+	end := i + 1
+	for end < len(unique) && unique[end] >= '0' && unique[end] <= '9' {
+		end++
+	}
+	n, err := strconv.ParseInt(unique[i+1:end], 10, 64)
+	if err != nil || n >= 1e6 {
+		return 0
+	}
+	return n
+}
+
+// Key returns the name without its info suffix. The key identifies the
+// message and is its UID in this store.
+func (f Filename) Key() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d.%s.%s", f.Time.Unix(), f.Unique, f.Host)
+	if f.Size >= 0 {
+		fmt.Fprintf(&b, ",S=%d", f.Size)
+	}
+	if f.VirtualSize >= 0 {
+		fmt.Fprintf(&b, ",W=%d", f.VirtualSize)
+	}
+	for _, attr := range f.Attrs {
+		b.WriteString("," + attr)
+	}
+	return b.String()
+}
+
+// String formats f as a file name, the inverse of ParseFilename.
+func (f Filename) String() string {
+	if !f.HasInfo {
+		return f.Key()
+	}
+	return f.Key() + ":" + infoFromFlags(f.Flags)
+}
+
+// keyCounter distinguishes names generated in the same microsecond.
+var keyCounter atomic.Uint64
+
+// Formatter generates names for new messages.
+type Formatter struct {
+	// Host is the host part of generated names. Empty means os.Hostname.
+	Host string
+}
+
+// New returns a unique name for a message delivered at t, with the S=
+// attribute set to size unless size is negative. The unique part follows
+// the maildir convention: microseconds, pid, counter and random bytes.
+func (fm Formatter) New(t time.Time, size int64) (Filename, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return Filename{}, err
+	}
+	host := fm.Host
+	if host == "" {
+		var err error
+		if host, err = os.Hostname(); err != nil {
+			return Filename{}, err
+		}
+	}
+	host = strings.NewReplacer("/", `\057`, ":", `\072`, ",", `\054`).Replace(host)
+	return Filename{
+		Time:        time.Unix(t.Unix(), int64(t.Nanosecond()/1000*1000)),
+		Unique:      fmt.Sprintf("M%dP%dQ%dR%s", t.Nanosecond()/1000, os.Getpid(), keyCounter.Add(1), hex.EncodeToString(b)),
+		Host:        host,
+		Size:        size,
+		VirtualSize: -1,
+	}, nil
+}
+
+// newMessageKey returns a new unique maildir key.
+func newMessageKey() (string, error) {
+	f, err := Formatter{}.New(time.Now(), -1)
+	if err != nil {
+		return "", err
+	}
+	return f.Key(), nil
+}
+
+// newKeyLike returns a new unique key for a copy of the message file src,
+// carrying its size and internal date (see messageAttrs). The size is left
+// out if src cannot be read.
+func newKeyLike(fsys FS, src string) (string, error) {
+	size, date, err := messageAttrs(fsys, src)
+	if err != nil {
+		size, date = -1, time.Now()
+	}
+	f, err := Formatter{}.New(date, size)
+	if err != nil {
+		return "", err
+	}
+	return f.Key(), nil
+}
+
+// messageAttrs returns the size and internal date of the message file
+// filename. Names with an S= attribute, as this store writes them, carry
+// both: the size in S= and the internal date in the leading timestamp, so
+// no stat is needed. Other names fall back to the file's size and
+// modification time.
+func messageAttrs(fsys FS, filename string) (size int64, date time.Time, err error) {
+	if f, err := ParseFilename(filepath.Base(filename)); err == nil && f.Size >= 0 {
+		return f.Size, f.Time, nil
+	}
+	fi, err := fsys.Stat(filename)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+	return fi.Size(), fi.ModTime(), nil
+}
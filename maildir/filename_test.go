@@ -0,0 +1,235 @@
+package maildir
+
+import (
+	"context"
+	stderrors "errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-maildir"
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+func TestParseFilename(t *testing.T) {
+	tests := []struct {
+		name string
+		want Filename
+	}{
+		{
+			name: "1700000000.M123456P42Q1R0a1b.mail.example.com",
+			want: Filename{
+				Time:        time.Unix(1700000000, 123456000),
+				Unique:      "M123456P42Q1R0a1b",
+				Host:        "mail.example.com",
+				Size:        -1,
+				VirtualSize: -1,
+			},
+		},
+		{
+			name: "1700000000.P42Q1.host,S=1024,W=1050:2,FS",
+			want: Filename{
+				Time:        time.Unix(1700000000, 0),
+				Unique:      "P42Q1",
+				Host:        "host",
+				Size:        1024,
+				VirtualSize: 1050,
+				HasInfo:     true,
+				Flags:       []maildir.Flag("FS"),
+			},
+		},
+		{
+			name: "1700000000.12345_1.host,X=abc,S=7:2,",
+			want: Filename{
+				Time:        time.Unix(1700000000, 0),
+				Unique:      "12345_1",
+				Host:        "host",
+				Size:        7,
+				VirtualSize: -1,
+				Attrs:       []string{"X=abc"},
+				HasInfo:     true,
+				Flags:       []maildir.Flag(""),
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFilename(tt.name)
+			if err != nil {
+				t.Fatalf("ParseFilename: %v", err)
+			}
+			if !got.Time.Equal(tt.want.Time) {
+				t.Errorf("Time = %v, want %v", got.Time, tt.want.Time)
+			}
+			got.Time, tt.want.Time = time.Time{}, time.Time{}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseFilename = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseFilename_Invalid(t *testing.T) {
+	for _, name := range []string{
+		"",
+		"nodots",
+		"1700000000.unique",
+		"notanumber.unique.host",
+		"1700000000..host",
+		"1700000000.unique.host,S=big",
+		"1700000000.unique.host:1,experimental",
+	} {
+		if _, err := ParseFilename(name); !stderrors.Is(err, errors.ErrInvalidFilename) {
+			t.Errorf("ParseFilename(%q) error = %v, want ErrInvalidFilename", name, err)
+		}
+	}
+}
+
+func TestFilename_RoundTrip(t *testing.T) {
+	for _, name := range []string{
+		"1700000000.M5P42Q1R0a1b.host",
+		"1700000000.P42Q1.host,S=1024,W=1050:2,FS",
+		"1700000000.12345_1.host,S=7,X=abc:2,",
+	} {
+		f, err := ParseFilename(name)
+		if err != nil {
+			t.Fatalf("ParseFilename(%q): %v", name, err)
+		}
+		if got := f.String(); got != name {
+			t.Errorf("String() = %q, want %q", got, name)
+		}
+	}
+}
+
+func TestFormatter_New(t *testing.T) {
+	now := time.Unix(1700000000, 987654321)
+	f, err := Formatter{Host: "mx:1/a,b"}.New(now, 512)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	parsed, err := ParseFilename(f.String())
+	if err != nil {
+		t.Fatalf("ParseFilename(%q): %v", f.String(), err)
+	}
+	if !parsed.Time.Equal(time.Unix(1700000000, 987654000)) {
+		t.Errorf("Time = %v", parsed.Time)
+	}
+	if parsed.Size != 512 || parsed.Host != `mx\0721\057a\054b` {
+		t.Errorf("parsed = %+v", parsed)
+	}
+
+	other, err := Formatter{Host: "mx"}.New(now, -1)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	if other.Unique == f.Unique {
+		t.Error("New returned the same unique part twice")
+	}
+}
+
+func TestMaildirStore_SizeInFilename(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+	mailbox := "user@example.com"
+	body := "Subject: sized\r\n\r\nHello.\r\n"
+
+	envelope := msgstore.Envelope{Recipients: []string{mailbox}, ReceivedTime: time.Now()}
+	if err := store.Deliver(ctx, envelope, strings.NewReader(body)); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	if err := store.CreateFolder(ctx, mailbox, "Archive"); err != nil {
+		t.Fatalf("CreateFolder: %v", err)
+	}
+	appended, err := store.AppendToFolder(ctx, mailbox, "Archive", strings.NewReader(body), []string{"\\Seen"}, time.Now())
+	if err != nil {
+		t.Fatalf("AppendToFolder: %v", err)
+	}
+	msgs, err := store.List(ctx, mailbox)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("List = %v, %v", msgs, err)
+	}
+	copied, err := store.CopyMessage(ctx, mailbox, "INBOX", msgs[0].UID, "Archive")
+	if err != nil {
+		t.Fatalf("CopyMessage: %v", err)
+	}
+
+	for _, uid := range []string{msgs[0].UID, appended, copied} {
+		f, err := ParseFilename(uid)
+		if err != nil {
+			t.Fatalf("ParseFilename(%q): %v", uid, err)
+		}
+		if f.Size != int64(len(body)) {
+			t.Errorf("%s: S= %d, want %d", uid, f.Size, len(body))
+		}
+	}
+}
+
+func TestMaildirStore_AttributesFromFilename(t *testing.T) {
+	basePath := t.TempDir()
+	store := NewStore(basePath, "", "")
+	ctx := context.Background()
+	mailbox := "user@example.com"
+	if _, err := store.ensureMaildir(mailbox); err != nil {
+		t.Fatalf("ensureMaildir: %v", err)
+	}
+	cur := filepath.Join(basePath, "user", "cur")
+
+	// A name with S= is trusted over the file itself.
+	named := "1700000000.M5P1Q1.host,S=999:2,S"
+	if err := os.WriteFile(filepath.Join(cur, named), []byte("short"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	// A legacy name falls back to the file's size and mtime.
+	legacy := "legacy-message:2,"
+	mtime := time.Unix(1600000000, 0)
+	if err := os.WriteFile(filepath.Join(cur, legacy), []byte("twelve bytes"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(cur, legacy), mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, err := store.List(ctx, mailbox)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	got := make(map[string]msgstore.MessageInfo)
+	for _, m := range msgs {
+		got[m.UID] = m
+	}
+	if m := got["1700000000.M5P1Q1.host,S=999"]; m.Size != 999 || !m.InternalDate.Equal(time.Unix(1700000000, 5000)) {
+		t.Errorf("named message = %+v", m)
+	}
+	if m := got["legacy-message"]; m.Size != 12 || !m.InternalDate.Equal(mtime) {
+		t.Errorf("legacy message = %+v", m)
+	}
+	if count, total, err := store.Stat(ctx, mailbox); err != nil || count != 2 || total != 1011 {
+		t.Errorf("Stat = %d, %d, %v; want 2, 1011", count, total, err)
+	}
+	status, err := store.Status(ctx, mailbox, "")
+	if err != nil || status.Size != 1011 {
+		t.Errorf("Status = %+v, %v; want size 1011", status, err)
+	}
+}
+
+func TestMaildirStore_AppendToFolderDate(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+	date := time.Date(2020, 5, 17, 8, 30, 0, 0, time.UTC)
+
+	uid, err := store.AppendToFolder(ctx, "user@example.com", "INBOX", strings.NewReader("Subject: old\r\n\r\n"), nil, date)
+	if err != nil {
+		t.Fatalf("AppendToFolder: %v", err)
+	}
+	msgs, err := store.List(ctx, "user@example.com")
+	if err != nil || len(msgs) != 1 || msgs[0].UID != uid {
+		t.Fatalf("List = %v, %v", msgs, err)
+	}
+	if !msgs[0].InternalDate.Equal(date) {
+		t.Errorf("InternalDate = %v, want %v", msgs[0].InternalDate, date)
+	}
+}
@@ -0,0 +1,93 @@
+package maildir
+
+import (
+	"bufio"
+	"bytes"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// forwardFileName is the per-mailbox forwarding file, kept in the mailbox
+// root next to the .sieve script.
+const forwardFileName = ".forward"
+
+// forwardEntries is the parsed content of a .forward file.
+type forwardEntries struct {
+	// addresses are the targets the message is relayed to.
+	addresses []string
+
+	// keepLocal is set by a "\user" entry: a copy stays in the mailbox.
+	keepLocal bool
+}
+
+// parseForwardFile parses a .forward file. Entries are separated by newlines
+// or commas; lines starting with '#' are comments. An entry of the form
+// "\user" keeps a local copy, as does an entry naming the mailbox itself.
+// Pipe ("|cmd"), file ("/path") and ":include:" entries are not supported
+// and are skipped with a warning.
+func parseForwardFile(data []byte, mailbox string) forwardEntries {
+	var result forwardEntries
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		for _, entry := range strings.Split(line, ",") {
+			entry = strings.Trim(strings.TrimSpace(entry), `"`)
+			entry = strings.TrimSuffix(strings.TrimPrefix(entry, "<"), ">")
+			switch {
+			case entry == "":
+			case strings.HasPrefix(entry, `\`), strings.EqualFold(entry, mailbox):
+				result.keepLocal = true
+			case strings.HasPrefix(entry, "|"), strings.HasPrefix(entry, "/"), strings.HasPrefix(entry, ":include:"):
+				slog.Warn("unsupported .forward entry skipped",
+					slog.String("mailbox", mailbox),
+					slog.String("entry", entry),
+				)
+			default:
+				result.addresses = append(result.addresses, entry)
+			}
+		}
+	}
+	return result
+}
+
+// sieveScript translates the entries into an equivalent Sieve script, so that
+// .forward files are applied by the same delivery path as Sieve redirect.
+func (f forwardEntries) sieveScript() []byte {
+	var b strings.Builder
+	for _, addr := range f.addresses {
+		b.WriteString("redirect " + sieveQuote(addr) + ";\n")
+	}
+	if f.keepLocal || len(f.addresses) == 0 {
+		b.WriteString("keep;\n")
+	}
+	return []byte(b.String())
+}
+
+// sieveQuote returns s as a Sieve quoted string.
+func sieveQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// loadForwardScript reads the mailbox's .forward file and returns it as a
+// Sieve script. Returns (nil, nil) if the mailbox has no .forward file.
+func (s *MaildirStore) loadForwardScript(mailbox string) ([]byte, error) {
+	root, err := s.mailboxRootPath(mailbox)
+	if err != nil {
+		return nil, err
+	}
+	data, err := s.fs.ReadFile(filepath.Join(root, forwardFileName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseForwardFile(data, mailbox).sieveScript(), nil
+}
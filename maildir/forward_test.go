@@ -0,0 +1,132 @@
+package maildir
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/infodancer/msgstore"
+)
+
+// recordingRelay captures relayed messages for inspection.
+type recordingRelay struct {
+	envelopes []msgstore.Envelope
+	messages  []string
+}
+
+func (r *recordingRelay) relay(ctx context.Context, envelope msgstore.Envelope, message io.Reader) error {
+	data, err := io.ReadAll(message)
+	if err != nil {
+		return err
+	}
+	r.envelopes = append(r.envelopes, envelope)
+	r.messages = append(r.messages, string(data))
+	return nil
+}
+
+func TestParseForwardFile(t *testing.T) {
+	data := []byte(`# forward everything
+alice@example.net, "bob@example.org"
+<carol@example.com>
+|/usr/bin/procmail
+\user
+`)
+	got := parseForwardFile(data, "user@example.com")
+	want := []string{"alice@example.net", "bob@example.org", "carol@example.com"}
+	if !reflect.DeepEqual(got.addresses, want) {
+		t.Errorf("addresses = %v, want %v", got.addresses, want)
+	}
+	if !got.keepLocal {
+		t.Error("expected keepLocal for \\user entry")
+	}
+
+	self := parseForwardFile([]byte("USER@example.com\n"), "user@example.com")
+	if !self.keepLocal || len(self.addresses) != 0 {
+		t.Errorf("self-forward should keep locally, got %+v", self)
+	}
+}
+
+func writeForwardFile(t *testing.T, basePath, content string) {
+	t.Helper()
+	root := filepath.Join(basePath, "user")
+	if err := os.MkdirAll(root, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, forwardFileName), []byte(content), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDeliver_ForwardFile(t *testing.T) {
+	basePath := t.TempDir()
+	relay := &recordingRelay{}
+	store := NewStore(basePath, "", "", WithRelay(relay.relay))
+	writeForwardFile(t, basePath, "alice@example.net\n")
+
+	deliverTestMessage(t, store, "Subject: fwd\r\n\r\nhello")
+
+	if len(relay.envelopes) != 1 {
+		t.Fatalf("expected 1 relayed message, got %d", len(relay.envelopes))
+	}
+	env := relay.envelopes[0]
+	if env.From != "sender@example.com" || !reflect.DeepEqual(env.Recipients, []string{"alice@example.net"}) {
+		t.Errorf("relay envelope = %+v", env)
+	}
+	if !strings.HasPrefix(relay.messages[0], "Resent-Date: ") ||
+		!strings.Contains(relay.messages[0], "Resent-From: <user@example.com>\r\nResent-To: <alice@example.net>\r\n") ||
+		!strings.HasSuffix(relay.messages[0], "\r\nSubject: fwd\r\n\r\nhello") {
+		t.Errorf("relayed message = %q", relay.messages[0])
+	}
+	if n := countMessages(t, store, "INBOX"); n != 0 {
+		t.Errorf("INBOX has %d messages, want 0", n)
+	}
+}
+
+func TestDeliver_ForwardFileKeepLocal(t *testing.T) {
+	basePath := t.TempDir()
+	relay := &recordingRelay{}
+	store := NewStore(basePath, "", "", WithRelay(relay.relay))
+	writeForwardFile(t, basePath, "alice@example.net, \\user\n")
+
+	deliverTestMessage(t, store, "Subject: fwd\r\n\r\nhello")
+
+	if len(relay.envelopes) != 1 {
+		t.Errorf("expected 1 relayed message, got %d", len(relay.envelopes))
+	}
+	if n := countMessages(t, store, "INBOX"); n != 1 {
+		t.Errorf("INBOX has %d messages, want 1", n)
+	}
+}
+
+func TestDeliver_ForwardWithoutRelayKeeps(t *testing.T) {
+	basePath := t.TempDir()
+	store := NewStore(basePath, "", "")
+	writeForwardFile(t, basePath, "alice@example.net\n")
+
+	deliverTestMessage(t, store, "Subject: fwd\r\n\r\nhello")
+
+	if n := countMessages(t, store, "INBOX"); n != 1 {
+		t.Errorf("INBOX has %d messages, want 1", n)
+	}
+}
+
+func TestDeliver_SieveTakesPrecedenceOverForward(t *testing.T) {
+	basePath := t.TempDir()
+	relay := &recordingRelay{}
+	store := NewStore(basePath, "", "", WithRelay(relay.relay))
+	writeForwardFile(t, basePath, "alice@example.net\n")
+	activateTestScript(t, store, `keep;`)
+
+	deliverTestMessage(t, store, "Subject: fwd\r\n\r\nhello")
+
+	if len(relay.envelopes) != 0 {
+		t.Errorf("expected no relayed messages, got %d", len(relay.envelopes))
+	}
+	if n := countMessages(t, store, "INBOX"); n != 1 {
+		t.Errorf("INBOX has %d messages, want 1", n)
+	}
+}
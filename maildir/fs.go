@@ -0,0 +1,143 @@
+package maildir
+
+import (
+	"io"
+	"io/fs"
+	"os"
+	"time"
+)
+
+// FS is the filesystem through which a MaildirStore performs all of its
+// I/O. Names are host paths built from the store's base path, as with the
+// os package, rather than the slash-separated relative names of io/fs; the
+// read side returns io/fs types, and the write side adds the operations a
+// maildir needs (atomic rename, hard links, the Sieve symlink).
+//
+// The default, OSFS, uses the local filesystem. Substitute another
+// implementation with WithFS, for example to inject faults (ENOSPC, EIO) in
+// tests or to keep maildirs on a remote filesystem. Implementations must be
+// safe for concurrent use, and Rename must replace newname atomically, since
+// maildir delivery relies on it. With WithFsync, files that also implement
+// Syncer are flushed to stable storage; files that do not are assumed to be
+// durable once closed.
+type FS interface {
+	// Open opens a file for reading.
+	Open(name string) (File, error)
+
+	// OpenFile opens a file with os.OpenFile flags, e.g., os.O_CREATE|os.O_EXCL.
+	OpenFile(name string, flag int, perm fs.FileMode) (File, error)
+
+	// CreateTemp creates a new file in dir whose name is pattern with a
+	// random string substituted for its last "*", as os.CreateTemp does.
+	CreateTemp(dir string, pattern string) (File, error)
+
+	Stat(name string) (fs.FileInfo, error)
+	Lstat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	ReadFile(name string) ([]byte, error)
+	Mkdir(name string, perm fs.FileMode) error
+	MkdirAll(name string, perm fs.FileMode) error
+	Remove(name string) error
+	RemoveAll(name string) error
+	Rename(oldname string, newname string) error
+	Link(oldname string, newname string) error
+	Symlink(oldname string, newname string) error
+	Readlink(name string) (string, error)
+	Chtimes(name string, atime time.Time, mtime time.Time) error
+}
+
+// File is an open file of an FS.
+type File interface {
+	io.Reader
+	io.Writer
+	io.Closer
+	Name() string
+	Stat() (fs.FileInfo, error)
+}
+
+// Syncer is implemented by files that can be flushed to stable storage, as
+// *os.File can. Directories opened with Open are synced the same way, to
+// persist the names of files renamed into them.
+type Syncer interface {
+	Sync() error
+}
+
+// syncFile flushes f to stable storage if it implements Syncer.
+func syncFile(f File) error {
+	if s, ok := f.(Syncer); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+// syncDir flushes the directory dir, so that entries created or renamed
+// into it survive a crash.
+func syncDir(fsys FS, dir string) error {
+	d, err := fsys.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = syncFile(d)
+	if cerr := d.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// OSFS is the FS backed by the os package.
+type OSFS struct{}
+
+// Compile-time interface verification.
+var _ FS = OSFS{}
+
+// Open implements FS.
+func (OSFS) Open(name string) (File, error) { return os.Open(name) }
+
+// OpenFile implements FS.
+func (OSFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	return os.OpenFile(name, flag, perm)
+}
+
+// CreateTemp implements FS.
+func (OSFS) CreateTemp(dir string, pattern string) (File, error) { return os.CreateTemp(dir, pattern) }
+
+// Stat implements FS.
+func (OSFS) Stat(name string) (fs.FileInfo, error) { return os.Stat(name) }
+
+// Lstat implements FS.
+func (OSFS) Lstat(name string) (fs.FileInfo, error) { return os.Lstat(name) }
+
+// ReadDir implements FS.
+func (OSFS) ReadDir(name string) ([]fs.DirEntry, error) { return os.ReadDir(name) }
+
+// ReadFile implements FS.
+func (OSFS) ReadFile(name string) ([]byte, error) { return os.ReadFile(name) }
+
+// Mkdir implements FS.
+func (OSFS) Mkdir(name string, perm fs.FileMode) error { return os.Mkdir(name, perm) }
+
+// MkdirAll implements FS.
+func (OSFS) MkdirAll(name string, perm fs.FileMode) error { return os.MkdirAll(name, perm) }
+
+// Remove implements FS.
+func (OSFS) Remove(name string) error { return os.Remove(name) }
+
+// RemoveAll implements FS.
+func (OSFS) RemoveAll(name string) error { return os.RemoveAll(name) }
+
+// Rename implements FS.
+func (OSFS) Rename(oldname string, newname string) error { return os.Rename(oldname, newname) }
+
+// Link implements FS.
+func (OSFS) Link(oldname string, newname string) error { return os.Link(oldname, newname) }
+
+// Symlink implements FS.
+func (OSFS) Symlink(oldname string, newname string) error { return os.Symlink(oldname, newname) }
+
+// Readlink implements FS.
+func (OSFS) Readlink(name string) (string, error) { return os.Readlink(name) }
+
+// Chtimes implements FS.
+func (OSFS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	return os.Chtimes(name, atime, mtime)
+}
@@ -0,0 +1,458 @@
+package maildir
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/infodancer/msgstore"
+)
+
+// memFS is a minimal in-memory FS for tests that should not touch disk.
+type memFS struct {
+	mu    sync.Mutex
+	nodes map[string]*memNode
+	seq   int
+}
+
+type memNode struct {
+	dir     bool
+	link    string
+	data    []byte
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func newMemFS() *memFS {
+	return &memFS{nodes: map[string]*memNode{"/": {dir: true, mode: fs.ModeDir | 0755}}}
+}
+
+func memErr(op, name string, err error) error {
+	return &fs.PathError{Op: op, Path: name, Err: err}
+}
+
+// resolve follows symlinks at name. The caller holds m.mu.
+func (m *memFS) resolve(name string) (string, *memNode) {
+	name = path.Clean(name)
+	for i := 0; i < 8; i++ {
+		n, ok := m.nodes[name]
+		if !ok || n.link == "" {
+			return name, n
+		}
+		target := n.link
+		if !path.IsAbs(target) {
+			target = path.Join(path.Dir(name), target)
+		}
+		name = path.Clean(target)
+	}
+	return name, nil
+}
+
+// parentDir reports whether the parent of name exists and is a directory.
+// The caller holds m.mu.
+func (m *memFS) parentDir(name string) bool {
+	_, p := m.resolve(path.Dir(name))
+	return p != nil && p.dir
+}
+
+func (m *memFS) Open(name string) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, n := m.resolve(name)
+	if n == nil {
+		return nil, memErr("open", name, fs.ErrNotExist)
+	}
+	return &memFile{fsys: m, name: path.Clean(name), node: n, r: bytes.NewReader(n.data)}, nil
+}
+
+func (m *memFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = path.Clean(name)
+	n, ok := m.nodes[name]
+	switch {
+	case ok && flag&syscall.O_EXCL != 0:
+		return nil, memErr("open", name, fs.ErrExist)
+	case !ok && flag&syscall.O_CREAT == 0:
+		return nil, memErr("open", name, fs.ErrNotExist)
+	case !ok:
+		if !m.parentDir(name) {
+			return nil, memErr("open", name, fs.ErrNotExist)
+		}
+		n = &memNode{mode: perm, modTime: time.Now()}
+		m.nodes[name] = n
+	}
+	if flag&syscall.O_TRUNC != 0 {
+		n.data = nil
+	}
+	return &memFile{fsys: m, name: name, node: n, r: bytes.NewReader(n.data)}, nil
+}
+
+func (m *memFS) CreateTemp(dir string, pattern string) (File, error) {
+	m.mu.Lock()
+	m.seq++
+	seq := m.seq
+	m.mu.Unlock()
+	base := pattern + fmt.Sprint(seq)
+	if prefix, suffix, ok := strings.Cut(pattern, "*"); ok {
+		base = prefix + fmt.Sprint(seq) + suffix
+	}
+	return m.OpenFile(path.Join(dir, base), syscall.O_RDWR|syscall.O_CREAT|syscall.O_EXCL, 0600)
+}
+
+func (m *memFS) Stat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, n := m.resolve(name)
+	if n == nil {
+		return nil, memErr("stat", name, fs.ErrNotExist)
+	}
+	return memInfo{name: path.Base(name), node: n}, nil
+}
+
+func (m *memFS) Lstat(name string) (fs.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, ok := m.nodes[path.Clean(name)]
+	if !ok {
+		return nil, memErr("lstat", name, fs.ErrNotExist)
+	}
+	return memInfo{name: path.Base(name), node: n}, nil
+}
+
+func (m *memFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	dir, n := m.resolve(name)
+	if n == nil {
+		return nil, memErr("readdir", name, fs.ErrNotExist)
+	}
+	if !n.dir {
+		return nil, memErr("readdir", name, syscall.ENOTDIR)
+	}
+	var entries []fs.DirEntry
+	for p, child := range m.nodes {
+		if p != "/" && path.Dir(p) == dir {
+			entries = append(entries, fs.FileInfoToDirEntry(memInfo{name: path.Base(p), node: child}))
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
+
+func (m *memFS) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, n := m.resolve(name)
+	if n == nil {
+		return nil, memErr("open", name, fs.ErrNotExist)
+	}
+	if n.dir {
+		return nil, memErr("read", name, syscall.EISDIR)
+	}
+	return bytes.Clone(n.data), nil
+}
+
+func (m *memFS) Mkdir(name string, perm fs.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = path.Clean(name)
+	if _, ok := m.nodes[name]; ok {
+		return memErr("mkdir", name, fs.ErrExist)
+	}
+	if !m.parentDir(name) {
+		return memErr("mkdir", name, fs.ErrNotExist)
+	}
+	m.nodes[name] = &memNode{dir: true, mode: fs.ModeDir | perm, modTime: time.Now()}
+	return nil
+}
+
+func (m *memFS) MkdirAll(name string, perm fs.FileMode) error {
+	name = path.Clean(name)
+	if name == "/" || name == "." {
+		return nil
+	}
+	if err := m.MkdirAll(path.Dir(name), perm); err != nil {
+		return err
+	}
+	if err := m.Mkdir(name, perm); err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	return nil
+}
+
+func (m *memFS) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = path.Clean(name)
+	n, ok := m.nodes[name]
+	if !ok {
+		return memErr("remove", name, fs.ErrNotExist)
+	}
+	if n.dir {
+		for p := range m.nodes {
+			if path.Dir(p) == name && p != name {
+				return memErr("remove", name, syscall.ENOTEMPTY)
+			}
+		}
+	}
+	delete(m.nodes, name)
+	return nil
+}
+
+func (m *memFS) RemoveAll(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	name = path.Clean(name)
+	for p := range m.nodes {
+		if p == name || strings.HasPrefix(p, name+"/") {
+			delete(m.nodes, p)
+		}
+	}
+	return nil
+}
+
+func (m *memFS) Rename(oldname string, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	oldname, newname = path.Clean(oldname), path.Clean(newname)
+	n, ok := m.nodes[oldname]
+	if !ok {
+		return memErr("rename", oldname, fs.ErrNotExist)
+	}
+	if !m.parentDir(newname) {
+		return memErr("rename", newname, fs.ErrNotExist)
+	}
+	if dst, ok := m.nodes[newname]; ok && dst.dir {
+		for p := range m.nodes {
+			if strings.HasPrefix(p, newname+"/") {
+				return memErr("rename", newname, syscall.ENOTEMPTY)
+			}
+		}
+	}
+	if n.dir {
+		for p, child := range m.nodes {
+			if strings.HasPrefix(p, oldname+"/") {
+				delete(m.nodes, p)
+				m.nodes[newname+strings.TrimPrefix(p, oldname)] = child
+			}
+		}
+	}
+	delete(m.nodes, oldname)
+	m.nodes[newname] = n
+	return nil
+}
+
+func (m *memFS) Link(oldname string, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	oldname, newname = path.Clean(oldname), path.Clean(newname)
+	n, ok := m.nodes[oldname]
+	if !ok {
+		return memErr("link", oldname, fs.ErrNotExist)
+	}
+	if _, ok := m.nodes[newname]; ok {
+		return memErr("link", newname, fs.ErrExist)
+	}
+	m.nodes[newname] = n
+	return nil
+}
+
+func (m *memFS) Symlink(oldname string, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	newname = path.Clean(newname)
+	if _, ok := m.nodes[newname]; ok {
+		return memErr("symlink", newname, fs.ErrExist)
+	}
+	m.nodes[newname] = &memNode{link: oldname, mode: fs.ModeSymlink | 0777, modTime: time.Now()}
+	return nil
+}
+
+func (m *memFS) Readlink(name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	n, ok := m.nodes[path.Clean(name)]
+	if !ok || n.link == "" {
+		return "", memErr("readlink", name, fs.ErrInvalid)
+	}
+	return n.link, nil
+}
+
+func (m *memFS) Chtimes(name string, atime time.Time, mtime time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	_, n := m.resolve(name)
+	if n == nil {
+		return memErr("chtimes", name, fs.ErrNotExist)
+	}
+	n.modTime = mtime
+	return nil
+}
+
+type memFile struct {
+	fsys *memFS
+	name string
+	node *memNode
+	r    *bytes.Reader
+}
+
+func (f *memFile) Read(p []byte) (int, error) { return f.r.Read(p) }
+
+func (f *memFile) Write(p []byte) (int, error) {
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+	f.node.data = append(f.node.data, p...)
+	return len(p), nil
+}
+
+func (f *memFile) Close() error { return nil }
+func (f *memFile) Name() string { return f.name }
+
+func (f *memFile) Stat() (fs.FileInfo, error) {
+	f.fsys.mu.Lock()
+	defer f.fsys.mu.Unlock()
+	return memInfo{name: path.Base(f.name), node: f.node}, nil
+}
+
+type memInfo struct {
+	name string
+	node *memNode
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return int64(len(i.node.data)) }
+func (i memInfo) Mode() fs.FileMode  { return i.node.mode }
+func (i memInfo) ModTime() time.Time { return i.node.modTime }
+func (i memInfo) IsDir() bool        { return i.node.dir }
+func (i memInfo) Sys() any           { return nil }
+
+// faultFS wraps an FS and fails writes to files under tmp/ with err.
+type faultFS struct {
+	FS
+	err error
+}
+
+func (f faultFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	file, err := f.FS.OpenFile(name, flag, perm)
+	if err != nil || path.Base(path.Dir(name)) != "tmp" {
+		return file, err
+	}
+	return faultFile{File: file, err: f.err}, nil
+}
+
+func (f faultFS) CreateTemp(dir string, pattern string) (File, error) {
+	file, err := f.FS.CreateTemp(dir, pattern)
+	if err != nil || path.Base(dir) != "tmp" {
+		return file, err
+	}
+	return faultFile{File: file, err: f.err}, nil
+}
+
+type faultFile struct {
+	File
+	err error
+}
+
+func (f faultFile) Write([]byte) (int, error) { return 0, f.err }
+
+// Compile-time interface verification.
+var (
+	_ FS = (*memFS)(nil)
+	_ FS = faultFS{}
+)
+
+func TestMaildirStore_MemFS(t *testing.T) {
+	fsys := newMemFS()
+	store := NewStore("/mail", "", "", WithFS(fsys))
+	ctx := context.Background()
+
+	envelope := msgstore.Envelope{
+		From:         "sender@example.com",
+		Recipients:   []string{"user@example.com"},
+		ReceivedTime: time.Now(),
+	}
+	content := "Subject: In memory\r\n\r\nNo disk involved.\r\n"
+	if err := store.Deliver(ctx, envelope, strings.NewReader(content)); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+
+	msgs, err := store.List(ctx, "user@example.com")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("List returned %d messages, want 1", len(msgs))
+	}
+	rc, err := store.Retrieve(ctx, "user@example.com", msgs[0].UID)
+	if err != nil {
+		t.Fatalf("Retrieve: %v", err)
+	}
+	data, err := io.ReadAll(rc)
+	_ = rc.Close()
+	if err != nil {
+		t.Fatalf("ReadAll: %v", err)
+	}
+	if string(data) != content {
+		t.Errorf("Retrieve = %q, want %q", data, content)
+	}
+
+	if err := store.CreateFolder(ctx, "user@example.com", "Archive"); err != nil {
+		t.Fatalf("CreateFolder: %v", err)
+	}
+	if _, err := store.AppendToFolder(ctx, "user@example.com", "Archive", strings.NewReader(content), []string{"\\Seen"}, time.Now()); err != nil {
+		t.Fatalf("AppendToFolder: %v", err)
+	}
+	archived, err := store.ListInFolder(ctx, "user@example.com", "Archive")
+	if err != nil {
+		t.Fatalf("ListInFolder: %v", err)
+	}
+	if len(archived) != 1 {
+		t.Fatalf("ListInFolder returned %d messages, want 1", len(archived))
+	}
+
+	if _, err := fsys.Stat("/mail/user/cur"); err != nil {
+		t.Errorf("maildir not created in memory: %v", err)
+	}
+}
+
+func TestMaildirStore_DeliverWriteFailure(t *testing.T) {
+	fsys := faultFS{FS: newMemFS(), err: syscall.ENOSPC}
+	store := NewStore("/mail", "", "", WithFS(fsys))
+	ctx := context.Background()
+
+	envelope := msgstore.Envelope{
+		From:         "sender@example.com",
+		Recipients:   []string{"user@example.com"},
+		ReceivedTime: time.Now(),
+	}
+	err := store.Deliver(ctx, envelope, strings.NewReader("Subject: Full\r\n\r\nDisk is full.\r\n"))
+	if !errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("Deliver error = %v, want ENOSPC", err)
+	}
+
+	msgs, err := store.List(ctx, "user@example.com")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(msgs) != 0 {
+		t.Errorf("List returned %d messages after failed delivery, want 0", len(msgs))
+	}
+	entries, err := fsys.ReadDir("/mail/user/tmp")
+	if err != nil {
+		t.Fatalf("ReadDir tmp: %v", err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("tmp/ holds %d files after failed delivery, want 0", len(entries))
+	}
+}
@@ -0,0 +1,106 @@
+package maildir
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/infodancer/msgstore"
+)
+
+// syncRecordingFS is an OSFS recording the names of the files and
+// directories that are synced.
+type syncRecordingFS struct {
+	OSFS
+	mu     sync.Mutex
+	synced []string
+}
+
+type syncRecordingFile struct {
+	*os.File
+	fsys *syncRecordingFS
+}
+
+func (f syncRecordingFile) Sync() error {
+	f.fsys.mu.Lock()
+	f.fsys.synced = append(f.fsys.synced, f.Name())
+	f.fsys.mu.Unlock()
+	return f.File.Sync()
+}
+
+func (r *syncRecordingFS) wrap(f *os.File, err error) (File, error) {
+	if err != nil {
+		return nil, err
+	}
+	return syncRecordingFile{File: f, fsys: r}, nil
+}
+
+func (r *syncRecordingFS) Open(name string) (File, error) { return r.wrap(os.Open(name)) }
+
+func (r *syncRecordingFS) OpenFile(name string, flag int, perm fs.FileMode) (File, error) {
+	return r.wrap(os.OpenFile(name, flag, perm))
+}
+
+func (r *syncRecordingFS) CreateTemp(dir string, pattern string) (File, error) {
+	return r.wrap(os.CreateTemp(dir, pattern))
+}
+
+// syncedIn returns how many syncs were of files in dir and of dir itself.
+func (r *syncRecordingFS) syncedIn(dir string) (files, dirs int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, name := range r.synced {
+		switch {
+		case name == dir:
+			dirs++
+		case filepath.Dir(name) == filepath.Join(filepath.Dir(dir), "tmp"):
+			files++
+		}
+	}
+	return files, dirs
+}
+
+func TestMaildirStore_Fsync(t *testing.T) {
+	ctx := context.Background()
+	mailbox := "user@example.com"
+	envelope := msgstore.Envelope{Recipients: []string{mailbox}}
+
+	for _, durable := range []bool{false, true} {
+		basePath := t.TempDir()
+		fsys := &syncRecordingFS{}
+		opts := []Option{WithFS(fsys)}
+		if durable {
+			opts = append(opts, WithFsync())
+		}
+		store := NewStore(basePath, "", "", opts...)
+		path := filepath.Join(basePath, "user")
+
+		if err := store.Deliver(ctx, envelope, strings.NewReader("Subject: a\r\n\r\n")); err != nil {
+			t.Fatalf("Deliver: %v", err)
+		}
+		if _, err := store.AppendToFolder(ctx, mailbox, "INBOX", strings.NewReader("Subject: b\r\n\r\n"), []string{"\\Seen"}, time.Now()); err != nil {
+			t.Fatalf("AppendToFolder: %v", err)
+		}
+		if _, err := store.AppendMultiple(ctx, mailbox, "INBOX", []msgstore.AppendItem{{Message: strings.NewReader("Subject: c\r\n\r\n")}}); err != nil {
+			t.Fatalf("AppendMultiple: %v", err)
+		}
+
+		newFiles, newDirs := fsys.syncedIn(filepath.Join(path, "new"))
+		_, curDirs := fsys.syncedIn(filepath.Join(path, "cur"))
+		if !durable {
+			if newFiles+newDirs+curDirs != 0 {
+				t.Errorf("default store synced %v", fsys.synced)
+			}
+			continue
+		}
+		if newFiles != 3 || newDirs != 1 || curDirs != 2 {
+			t.Errorf("synced %d message files, new/ %d times, cur/ %d times; want 3, 1, 2: %v",
+				newFiles, newDirs, curDirs, fsys.synced)
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package maildir
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+const (
+	// deletedFolderPrefix starts the name DeleteFolder renames a folder to
+	// before removing its files, flagging it for deletion. "~" is not
+	// valid in folder names, so flagged folders never collide with real
+	// ones, and ListFolders skips them. CollectGarbage prunes folders that
+	// a crash left flagged.
+	deletedFolderPrefix = ".~Deleted-"
+
+	// defaultGarbageMinAge is how long a mailbox or stale folder must go
+	// unchanged before CollectGarbage removes it.
+	defaultGarbageMinAge = 7 * 24 * time.Hour
+)
+
+// garbageIgnored names the files that do not make a mailbox used: state
+// the store derives from the messages and rebuilds when missing. Every new
+// maildir has a change log; a mailbox created again starts a new
+// incarnation, so clients resync it.
+var garbageIgnored = map[string]bool{
+	keywordsFile:     true,
+	keywordsLockFile: true,
+	changesFile:      true,
+	changesLockFile:  true,
+	recentFile:       true,
+	recentLockFile:   true,
+	indexFile:        true,
+}
+
+// flagForDeletion renames the folder at path under deletedFolderPrefix and
+// returns its new path.
+func flagForDeletion(fsys FS, path string, now time.Time) (string, error) {
+	dir, name := filepath.Split(path)
+	flagged := filepath.Join(dir, deletedFolderPrefix+strconv.FormatInt(now.UnixNano(), 10)+name)
+	if err := fsys.Rename(path, flagged); err != nil {
+		return "", err
+	}
+	return flagged, nil
+}
+
+// CollectGarbage implements msgstore.GarbageCollector.
+//
+// It walks the base path and the base paths of WithDomainPaths for
+// mailboxes. A mailbox is removed when it holds no files besides derived
+// state such as dovecot-keywords, has no folders besides the defaults, and
+// nothing in it has changed for the period set with WithGarbageMinAge.
+// These are typically mailboxes List created for usernames that were only
+// probed; a real user's mailbox is created again on first use. Parent
+// directories left empty are removed too. In the mailboxes that are kept,
+// folders flagged for deletion by an interrupted DeleteFolder are removed,
+// as are unchanged, empty directories that look like folders but lack
+// cur/. Stores with a mailbox resolver return errors.ErrNotSupported.
+func (s *MaildirStore) CollectGarbage(ctx context.Context) (msgstore.GarbageReport, error) {
+	return s.collectGarbage(ctx, time.Now())
+}
+
+// collectGarbage runs a garbage collection at now.
+func (s *MaildirStore) collectGarbage(ctx context.Context, now time.Time) (msgstore.GarbageReport, error) {
+	var report msgstore.GarbageReport
+	if s.resolver != nil {
+		return report, fmt.Errorf("collecting garbage: custom mailbox resolver: %w", errors.ErrNotSupported)
+	}
+	bases := []string{s.basePath}
+	for _, p := range s.domainPaths {
+		if p.BasePath != "" && !containsPath(bases, p.BasePath) {
+			bases = append(bases, p.BasePath)
+		}
+	}
+	cutoff := now.Add(-s.garbageMinAge)
+	for _, base := range bases {
+		if err := s.collectDir(ctx, filepath.Clean(base), filepath.Clean(base), cutoff, &report); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// containsPath reports whether paths holds path.
+func containsPath(paths []string, path string) bool {
+	for _, p := range paths {
+		if filepath.Clean(p) == filepath.Clean(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// collectDir collects garbage in the mailboxes found at or below dir, a
+// directory under base.
+func (s *MaildirStore) collectDir(ctx context.Context, base, dir string, cutoff time.Time, report *msgstore.GarbageReport) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if info, err := s.fs.Stat(filepath.Join(dir, s.maildirSubdir, "cur")); err == nil && info.IsDir() && dir != base {
+		return s.collectMailbox(base, dir, cutoff, report)
+	}
+	entries, err := s.fs.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		// Dot directories hold store-wide state, such as the greylist and
+		// the schedule spool, not mailboxes.
+		if !e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		if err := s.collectDir(ctx, base, filepath.Join(dir, e.Name()), cutoff, report); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// collectMailbox collects garbage in the mailbox whose root is root,
+// holding its lock.
+func (s *MaildirStore) collectMailbox(base, root string, cutoff time.Time, report *msgstore.GarbageReport) error {
+	defer s.mailboxLocks.Lock(root)()
+	path := filepath.Join(root, s.maildirSubdir)
+
+	defaults := map[string]bool{holdDir: true}
+	for _, spec := range msgstore.DefaultFolders {
+		defaults["."+strings.ReplaceAll(spec.Name, s.delimiter, ".")] = true
+	}
+	onlyDefaults := true
+	entries, err := s.fs.ReadDir(path)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() || !strings.HasPrefix(name, ".") {
+			continue
+		}
+		folder := filepath.Join(path, name)
+		if strings.HasPrefix(name, deletedFolderPrefix) {
+			// Finish the interrupted deletion.
+			_, size, err := s.unusedTree(folder, time.Time{})
+			if err != nil {
+				return err
+			}
+			if err := s.fs.RemoveAll(folder); err != nil {
+				return err
+			}
+			report.Folders++
+			report.Bytes += size
+			continue
+		}
+		if _, err := s.fs.Stat(filepath.Join(folder, "cur")); os.IsNotExist(err) {
+			unused, size, err := s.unusedTree(folder, cutoff)
+			if err != nil {
+				return err
+			}
+			if unused {
+				if err := s.fs.RemoveAll(folder); err != nil {
+					return err
+				}
+				report.Folders++
+				report.Bytes += size
+				continue
+			}
+		}
+		if !defaults[name] {
+			onlyDefaults = false
+		}
+	}
+	if !onlyDefaults {
+		return nil
+	}
+
+	unused, size, err := s.unusedTree(root, cutoff)
+	if err != nil || !unused {
+		return err
+	}
+	if err := s.fs.RemoveAll(root); err != nil {
+		return err
+	}
+	report.Mailboxes++
+	report.Bytes += size
+
+	// Remove the directories the path template created above the mailbox,
+	// such as its domain, once they are empty.
+	for dir := filepath.Dir(root); dir != base && strings.HasPrefix(dir, base+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		info, err := s.fs.Stat(dir)
+		if err != nil || s.fs.Remove(dir) != nil {
+			break
+		}
+		report.Bytes += info.Size()
+	}
+	return nil
+}
+
+// unusedTree reports whether the tree at root holds no files besides
+// garbageIgnored ones and nothing in it changed after cutoff, and returns
+// the total size of its files and directories.
+func (s *MaildirStore) unusedTree(root string, cutoff time.Time) (unused bool, size int64, err error) {
+	info, err := s.fs.Lstat(root)
+	if err != nil {
+		return false, 0, err
+	}
+	unused = !info.ModTime().After(cutoff)
+	size = info.Size()
+	if !info.IsDir() {
+		return false, size, nil
+	}
+	entries, err := s.fs.ReadDir(root)
+	if err != nil {
+		return false, 0, err
+	}
+	for _, e := range entries {
+		child := filepath.Join(root, e.Name())
+		if e.IsDir() {
+			u, n, err := s.unusedTree(child, cutoff)
+			if err != nil {
+				return false, 0, err
+			}
+			unused = unused && u
+			size += n
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			return false, 0, err
+		}
+		unused = unused && garbageIgnored[e.Name()] && e.Type()&fs.ModeType == 0 && !info.ModTime().After(cutoff)
+		size += info.Size()
+	}
+	return unused, size, nil
+}
+
+// Compile-time interface verification.
+var _ msgstore.GarbageCollector = (*MaildirStore)(nil)
@@ -0,0 +1,192 @@
+package maildir
+
+import (
+	"context"
+	stderrors "errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+// gcLater is a collection time past the default minimum age.
+var gcLater = time.Now().Add(defaultGarbageMinAge + time.Hour)
+
+func TestMaildirStore_CollectGarbageRemovesProbedMailboxes(t *testing.T) {
+	ctx := context.Background()
+	basePath := t.TempDir()
+	store := NewStore(basePath, "", "{domain}/{localpart}")
+	if _, err := store.List(ctx, "probe@example.org"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.List(ctx, "other@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	envelope := msgstore.Envelope{From: "sender@example.net", Recipients: []string{"user@example.com"}}
+	if err := store.Deliver(ctx, envelope, strings.NewReader("Subject: hi\r\n\r\nbody\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	// Derived state does not make a mailbox used.
+	if err := os.WriteFile(filepath.Join(basePath, "example.com", "other", keywordsFile), []byte("0 $Junk\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	greylist := filepath.Join(greylistDir, "ab", "cd")
+	if err := os.MkdirAll(filepath.Join(basePath, greylist), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	// Nothing is old enough yet.
+	report, err := store.CollectGarbage(ctx)
+	if err != nil {
+		t.Fatalf("CollectGarbage: %v", err)
+	}
+	if report != (msgstore.GarbageReport{}) {
+		t.Errorf("report of early run = %+v, want nothing removed", report)
+	}
+
+	report, err = store.collectGarbage(ctx, gcLater)
+	if err != nil {
+		t.Fatalf("collectGarbage: %v", err)
+	}
+	if report.Mailboxes != 2 || report.Folders != 0 || report.Bytes <= 0 {
+		t.Errorf("report = %+v, want 2 mailboxes and reclaimed bytes", report)
+	}
+	for _, gone := range []string{"example.org", filepath.Join("example.com", "other")} {
+		if _, err := os.Stat(filepath.Join(basePath, gone)); !os.IsNotExist(err) {
+			t.Errorf("%s still present: %v", gone, err)
+		}
+	}
+	for _, kept := range []string{filepath.Join("example.com", "user", "cur"), greylist} {
+		if _, err := os.Stat(filepath.Join(basePath, kept)); err != nil {
+			t.Errorf("%s removed: %v", kept, err)
+		}
+	}
+
+	// A removed mailbox is created again on first use.
+	if _, err := store.List(ctx, "probe@example.org"); err != nil {
+		t.Errorf("List after collection: %v", err)
+	}
+}
+
+func TestMaildirStore_CollectGarbageKeepsUsedMailboxes(t *testing.T) {
+	ctx := context.Background()
+	basePath := t.TempDir()
+	store := NewStore(basePath, "Maildir", "")
+	for _, mailbox := range []string{"folders@example.com", "sieve@example.com", "expunged@example.com"} {
+		if _, err := store.List(ctx, mailbox); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.CreateFolder(ctx, "folders@example.com", "Projects"); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(basePath, "sieve", ".sieve"), []byte("keep;\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	staged := filepath.Join(basePath, "expunged", "Maildir", expungeStagingDir)
+	if err := os.MkdirAll(staged, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(staged, "1.msg"), []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := store.collectGarbage(ctx, gcLater)
+	if err != nil {
+		t.Fatalf("collectGarbage: %v", err)
+	}
+	if report != (msgstore.GarbageReport{}) {
+		t.Errorf("report = %+v, want nothing removed", report)
+	}
+	for _, mailbox := range []string{"folders", "sieve", "expunged"} {
+		if _, err := os.Stat(filepath.Join(basePath, mailbox, "Maildir", "cur")); err != nil {
+			t.Errorf("mailbox %s removed: %v", mailbox, err)
+		}
+	}
+}
+
+func TestMaildirStore_CollectGarbagePrunesFolders(t *testing.T) {
+	ctx := context.Background()
+	basePath := t.TempDir()
+	store := NewStore(basePath, "", "")
+	deliverTestMessage(t, store, "Subject: hi\r\n\r\nbody\r\n")
+	path := filepath.Join(basePath, "user")
+
+	// A deletion interrupted after flagging the folder, and a folder
+	// whose creation stopped before cur/.
+	flagged := filepath.Join(path, deletedFolderPrefix+"1.Old")
+	if err := os.MkdirAll(filepath.Join(flagged, "cur"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(flagged, "cur", "1.msg"), []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	stale := filepath.Join(path, ".Half")
+	if err := os.MkdirAll(filepath.Join(stale, "tmp"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if folders, err := store.ListFolders(ctx, "user@example.com"); err != nil || len(folders) != len(msgstore.DefaultFolders) {
+		t.Errorf("ListFolders = %v, %v; want only the default folders", folders, err)
+	}
+
+	report, err := store.CollectGarbage(ctx)
+	if err != nil {
+		t.Fatalf("CollectGarbage: %v", err)
+	}
+	if report.Mailboxes != 0 || report.Folders != 1 {
+		t.Errorf("report = %+v, want the flagged folder only", report)
+	}
+	if _, err := os.Stat(flagged); !os.IsNotExist(err) {
+		t.Errorf("flagged folder still present: %v", err)
+	}
+
+	report, err = store.collectGarbage(ctx, gcLater)
+	if err != nil {
+		t.Fatalf("collectGarbage: %v", err)
+	}
+	if report.Mailboxes != 0 || report.Folders != 1 {
+		t.Errorf("report = %+v, want the stale folder only", report)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale folder still present: %v", err)
+	}
+}
+
+func TestMaildirStore_DeleteFolderLeavesNothingFlagged(t *testing.T) {
+	ctx := context.Background()
+	basePath := t.TempDir()
+	store := NewStore(basePath, "", "")
+	if _, err := store.List(ctx, "user@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	for _, folder := range []string{"Work", "Work.Projects"} {
+		if err := store.CreateFolder(ctx, "user@example.com", folder); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.DeleteFolder(ctx, "user@example.com", "Work", msgstore.WithRecursive()); err != nil {
+		t.Fatalf("DeleteFolder: %v", err)
+	}
+	entries, err := os.ReadDir(filepath.Join(basePath, "user"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), deletedFolderPrefix) || strings.HasPrefix(e.Name(), ".Work") {
+			t.Errorf("%s left behind", e.Name())
+		}
+	}
+}
+
+func TestMaildirStore_CollectGarbageWithResolver(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "", WithMailboxResolver(func(mailbox string) (string, error) {
+		return "", nil
+	}))
+	if _, err := store.CollectGarbage(context.Background()); !stderrors.Is(err, errors.ErrNotSupported) {
+		t.Errorf("CollectGarbage = %v, want ErrNotSupported", err)
+	}
+}
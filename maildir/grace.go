@@ -0,0 +1,245 @@
+package maildir
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+const (
+	// holdDir is the maildir under the mailbox root holding expunged
+	// messages during the grace period. "~" is not valid in folder names,
+	// so it never collides with a folder, and ListFolders skips it.
+	holdDir = ".~Expunged"
+
+	// heldFile indexes the held messages: uid + "/folder" names the folder
+	// a message came from and uid + "/at" when it was expunged (RFC 3339).
+	heldFile = "held.json"
+)
+
+// holdPath returns the holding maildir of a mailbox.
+func (s *MaildirStore) holdPath(mailbox string) (string, error) {
+	path, err := s.mailboxPath(mailbox)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(path, holdDir), nil
+}
+
+// discardMessages removes expunged messages from the maildir at path, the
+// inbox (folder "") or a folder of mailbox. With a grace period configured
+// they are moved to the holding area instead of being unlinked. The caller
+// holds the mailbox lock. It returns the UIDs removed from path, sorted.
+func (s *MaildirStore) discardMessages(mailbox, folder, path string, uids map[string]bool) ([]string, error) {
+	if s.expungeGrace <= 0 {
+		return s.removeMessages(mailbox, path, uids)
+	}
+	hold, err := s.holdPath(mailbox)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.createMaildir(mailbox, hold); err != nil {
+		return nil, err
+	}
+	files, err := scanMessages(s.fs, path)
+	if err != nil {
+		return nil, err
+	}
+
+	held := make(map[string]string)
+	remap := s.keywordRemapper(path, hold)
+	var lastErr error
+	for uid := range uids {
+		name, ok := files[uid]
+		if !ok {
+			continue
+		}
+		key, err := renameUnique(s.fs, filepath.Join(path, name), hold, remap(name), uid)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		held[uid] = key
+	}
+	if len(held) == 0 {
+		return nil, lastErr
+	}
+
+	index := filepath.Join(hold, heldFile)
+	entries, err := readSidecar(s.fs, index)
+	if err != nil {
+		return nil, err
+	}
+	at := time.Now().UTC().Format(time.RFC3339)
+	removed := make([]string, 0, len(held))
+	for uid, key := range held {
+		entries[annotationEntry(key, "folder")] = canonicalFolder(folder)
+		entries[annotationEntry(key, "at")] = at
+		removed = append(removed, uid)
+	}
+	sort.Strings(removed)
+	s.recordExpunged(path, removed)
+	if err := writeSidecar(s.fs, index, entries); err != nil {
+		return removed, err
+	}
+	s.carryAnnotations(path, hold, held, true)
+	return removed, lastErr
+}
+
+// renameUnique moves the message file src, named name relative to its
+// maildir, into the maildir destPath, keeping key unless a message with
+// that key already exists there. It returns the key used.
+func renameUnique(fsys FS, src, destPath, name, key string) (string, error) {
+	for {
+		dst := filepath.Join(destPath, destinationName(name, key))
+		if _, err := fsys.Stat(dst); os.IsNotExist(err) {
+			return key, fsys.Rename(src, dst)
+		}
+		var err error
+		if key, err = newKeyLike(fsys, src); err != nil {
+			return "", err
+		}
+	}
+}
+
+// ListExpunged implements msgstore.ExpungeRecoverer.
+func (s *MaildirStore) ListExpunged(ctx context.Context, mailbox string) ([]msgstore.ExpungedMessage, error) {
+	hold, err := s.holdPath(mailbox)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := readSidecar(s.fs, filepath.Join(hold, heldFile))
+	if err != nil {
+		return nil, err
+	}
+	files, err := scanMessages(s.fs, hold)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var held []msgstore.ExpungedMessage
+	for uid, name := range files {
+		folder, ok := entries[annotationEntry(uid, "folder")]
+		if !ok {
+			continue
+		}
+		at, _ := time.Parse(time.RFC3339, entries[annotationEntry(uid, "at")])
+		m := msgstore.ExpungedMessage{UID: uid, Folder: folder, ExpungedAt: at}
+		if fi, err := s.fs.Stat(filepath.Join(hold, name)); err == nil {
+			m.Size = fi.Size()
+		}
+		held = append(held, m)
+	}
+	sort.Slice(held, func(i, j int) bool {
+		if !held[i].ExpungedAt.Equal(held[j].ExpungedAt) {
+			return held[i].ExpungedAt.Before(held[j].ExpungedAt)
+		}
+		return held[i].UID < held[j].UID
+	})
+	return held, nil
+}
+
+// Restore implements msgstore.ExpungeRecoverer.
+func (s *MaildirStore) Restore(ctx context.Context, mailbox string, uid string) (folder string, newUID string, err error) {
+	defer func() {
+		s.audit(ctx, msgstore.AuditEvent{Op: msgstore.AuditRestore, Mailbox: mailbox, Folder: folder, UID: uid, Detail: newUID}, err)
+	}()
+	hold, err := s.holdPath(mailbox)
+	if err != nil {
+		return "", "", err
+	}
+	defer s.lockMailbox(mailbox)()
+
+	index := filepath.Join(hold, heldFile)
+	entries, err := readSidecar(s.fs, index)
+	if err != nil {
+		return "", "", err
+	}
+	folder, ok := entries[annotationEntry(uid, "folder")]
+	files, err := scanMessages(s.fs, hold)
+	if err != nil && !os.IsNotExist(err) {
+		return "", "", err
+	}
+	name, found := files[uid]
+	if !ok || !found {
+		return "", "", errors.ErrMessageNotFound
+	}
+
+	path, _, err := s.folderDir(mailbox, folder)
+	if err == errors.ErrFolderNotFound || err == errors.ErrInvalidFolderName {
+		folder = "INBOX"
+		path, _, err = s.folderDir(mailbox, folder)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	if newUID, err = renameUnique(s.fs, filepath.Join(hold, name), path, s.keywordRemapper(hold, path)(name), uid); err != nil {
+		return "", "", err
+	}
+
+	delete(entries, annotationEntry(uid, "folder"))
+	delete(entries, annotationEntry(uid, "at"))
+	if err := writeSidecar(s.fs, index, entries); err != nil {
+		return folder, newUID, err
+	}
+	s.carryAnnotations(hold, path, map[string]string{uid: newUID}, true)
+	return folder, newUID, nil
+}
+
+// purgeExpunged unlinks the held messages of mailbox whose grace period
+// has passed at now.
+func (s *MaildirStore) purgeExpunged(mailbox string, now time.Time) error {
+	hold, err := s.holdPath(mailbox)
+	if err != nil {
+		return err
+	}
+	index := filepath.Join(hold, heldFile)
+	if _, err := s.fs.Stat(index); os.IsNotExist(err) {
+		return nil
+	}
+	defer s.lockMailbox(mailbox)()
+
+	entries, err := readSidecar(s.fs, index)
+	if err != nil {
+		return err
+	}
+	expired := make(map[string]bool)
+	for name, value := range entries {
+		uid, field, _ := strings.Cut(name, "/")
+		if field != "at" {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, value)
+		if err != nil || !at.Add(s.expungeGrace).After(now) {
+			expired[uid] = true
+		}
+	}
+	if len(expired) == 0 {
+		return nil
+	}
+
+	removed, err := s.removeMessages(mailbox, hold, expired)
+	for uid := range expired {
+		delete(entries, annotationEntry(uid, "folder"))
+		delete(entries, annotationEntry(uid, "at"))
+	}
+	if werr := writeSidecar(s.fs, index, entries); werr != nil {
+		return werr
+	}
+	if len(removed) > 0 {
+		s.dropAnnotations(hold, removed)
+	}
+	return err
+}
+
+// Compile-time interface verification.
+var _ msgstore.ExpungeRecoverer = (*MaildirStore)(nil)
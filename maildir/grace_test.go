@@ -0,0 +1,92 @@
+package maildir
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+func TestMaildirStore_ExpungeGrace(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "", WithExpungeGrace(time.Hour))
+	ctx := context.Background()
+	mailbox := "user@example.com"
+
+	if err := store.CreateFolder(ctx, mailbox, "Work"); err != nil {
+		t.Fatalf("CreateFolder: %v", err)
+	}
+	uids, err := store.AppendMultiple(ctx, mailbox, "Work", []msgstore.AppendItem{
+		{Message: strings.NewReader("Subject: a\r\n\r\na")},
+		{Message: strings.NewReader("Subject: b\r\n\r\nb")},
+	})
+	if err != nil {
+		t.Fatalf("AppendMultiple: %v", err)
+	}
+	if err := store.SetAnnotation(ctx, mailbox, "Work", uids[0], "note", "keep me"); err != nil {
+		t.Fatalf("SetAnnotation: %v", err)
+	}
+	for _, uid := range uids {
+		if err := store.DeleteInFolder(ctx, mailbox, "Work", uid); err != nil {
+			t.Fatalf("DeleteInFolder: %v", err)
+		}
+	}
+	removed, err := store.ExpungeFolder(ctx, mailbox, "Work")
+	if err != nil || len(removed) != 2 {
+		t.Fatalf("ExpungeFolder = %v, %v", removed, err)
+	}
+	if msgs, _ := store.ListInFolder(ctx, mailbox, "Work"); len(msgs) != 0 {
+		t.Fatalf("Work still lists %v", msgs)
+	}
+	folders, err := store.ListFolders(ctx, mailbox)
+	if err != nil {
+		t.Fatalf("ListFolders: %v", err)
+	}
+	for _, f := range folders {
+		if strings.Contains(f, "Expunged") {
+			t.Errorf("holding area listed as folder %q", f)
+		}
+	}
+
+	held, err := store.ListExpunged(ctx, mailbox)
+	if err != nil || len(held) != 2 {
+		t.Fatalf("ListExpunged = %v, %v", held, err)
+	}
+	if held[0].Folder != "Work" || held[0].Size == 0 || held[0].ExpungedAt.IsZero() {
+		t.Errorf("held = %+v", held[0])
+	}
+
+	folder, newUID, err := store.Restore(ctx, mailbox, uids[0])
+	if err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	if folder != "Work" || newUID != uids[0] {
+		t.Errorf("Restore = %q, %q", folder, newUID)
+	}
+	if notes, _ := store.GetAnnotations(ctx, mailbox, "Work", newUID); notes["note"] != "keep me" {
+		t.Errorf("annotations after restore = %v", notes)
+	}
+	if _, _, err := store.Restore(ctx, mailbox, uids[0]); err != errors.ErrMessageNotFound {
+		t.Errorf("second Restore = %v, want ErrMessageNotFound", err)
+	}
+
+	// Within the grace period maintenance keeps the other message; past it,
+	// the message is gone for good.
+	if err := store.Maintain(ctx, mailbox); err != nil {
+		t.Fatalf("Maintain: %v", err)
+	}
+	if held, _ := store.ListExpunged(ctx, mailbox); len(held) != 1 {
+		t.Fatalf("held after Maintain = %v", held)
+	}
+	if err := store.purgeExpunged(mailbox, time.Now().Add(2*time.Hour)); err != nil {
+		t.Fatalf("purgeExpunged: %v", err)
+	}
+	if held, _ := store.ListExpunged(ctx, mailbox); len(held) != 0 {
+		t.Errorf("held after grace = %v", held)
+	}
+	if _, _, err := store.Restore(ctx, mailbox, uids[1]); err != errors.ErrMessageNotFound {
+		t.Errorf("Restore after grace = %v, want ErrMessageNotFound", err)
+	}
+}
@@ -0,0 +1,178 @@
+package maildir
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/infodancer/msgstore"
+)
+
+const (
+	// greylistDir holds greylisting triplets under the base path, one
+	// sidecar file per triplet named by its hash and fanned out by the
+	// hash's first two digits.
+	greylistDir = ".greylist"
+
+	defaultGreylistDelay       = 5 * time.Minute
+	defaultGreylistRetryWindow = 48 * time.Hour
+	defaultGreylistLifetime    = 36 * 24 * time.Hour
+)
+
+// GreylistPolicy configures greylisting. A zero field takes its default.
+type GreylistPolicy struct {
+	// Delay is how long a sender must wait before a retry is accepted.
+	// Defaults to 5 minutes.
+	Delay time.Duration
+
+	// RetryWindow is how long after the first attempt a retry is still
+	// accepted. A triplet not retried in time starts over. Defaults to
+	// 48 hours.
+	RetryWindow time.Duration
+
+	// Lifetime is how long a triplet that passed is remembered after it
+	// was last seen. Defaults to 36 days.
+	Lifetime time.Duration
+}
+
+// withDefaults returns p with zero fields set to their defaults.
+func (p GreylistPolicy) withDefaults() GreylistPolicy {
+	if p.Delay <= 0 {
+		p.Delay = defaultGreylistDelay
+	}
+	if p.RetryWindow <= 0 {
+		p.RetryWindow = defaultGreylistRetryWindow
+	}
+	if p.Lifetime <= 0 {
+		p.Lifetime = defaultGreylistLifetime
+	}
+	return p
+}
+
+// greylistKey returns the hash identifying a triplet. IPv4 clients are
+// grouped by /24 and IPv6 clients by /64, so senders retrying from
+// another host of the same pool are not deferred again.
+func greylistKey(clientIP net.IP, sender, recipient string) string {
+	network := clientIP.String()
+	if ip4 := clientIP.To4(); ip4 != nil {
+		network = ip4.Mask(net.CIDRMask(24, 32)).String()
+	} else if clientIP != nil {
+		network = clientIP.Mask(net.CIDRMask(64, 128)).String()
+	}
+	sum := sha256.Sum256([]byte(network + "\x00" + strings.ToLower(sender) + "\x00" + strings.ToLower(recipient)))
+	return hex.EncodeToString(sum[:])
+}
+
+// greylistPath returns the sidecar file of the triplet with key.
+func (s *MaildirStore) greylistPath(key string) string {
+	return filepath.Join(s.basePath, greylistDir, key[:2], key)
+}
+
+// ShouldGreylist implements msgstore.Greylister.
+func (s *MaildirStore) ShouldGreylist(ctx context.Context, clientIP net.IP, sender, recipient string) (bool, error) {
+	return s.shouldGreylist(greylistKey(clientIP, sender, recipient), time.Now())
+}
+
+// shouldGreylist records an attempt of the triplet with key at now and
+// reports whether it is deferred.
+func (s *MaildirStore) shouldGreylist(key string, now time.Time) (bool, error) {
+	defer s.greylistLocks.Lock(key)()
+	path := s.greylistPath(key)
+	entries, err := readSidecar(s.fs, path)
+	if err != nil {
+		return false, err
+	}
+
+	first, err := time.Parse(time.RFC3339Nano, entries["first_seen"])
+	passed := entries["passed"] == "true"
+	switch {
+	case err != nil, !passed && now.Sub(first) > s.greylist.RetryWindow:
+		// New, or not retried in time: start over.
+		first, passed = now, false
+	case !passed && now.Sub(first) >= s.greylist.Delay:
+		passed = true
+	}
+	entries = map[string]string{
+		"first_seen": first.UTC().Format(time.RFC3339Nano),
+		"last_seen":  now.UTC().Format(time.RFC3339Nano),
+	}
+	if passed {
+		entries["passed"] = "true"
+	}
+	if err := writeSidecar(s.fs, path, entries); err != nil {
+		return false, err
+	}
+	return !passed, nil
+}
+
+// PurgeGreylist implements msgstore.Greylister.
+func (s *MaildirStore) PurgeGreylist(ctx context.Context) error {
+	return s.purgeGreylist(ctx, time.Now())
+}
+
+// purgeGreylist removes the triplets that have expired at now: those
+// never passed whose retry window has closed, and passed ones not seen
+// within their lifetime. Unreadable records are removed too.
+func (s *MaildirStore) purgeGreylist(ctx context.Context, now time.Time) error {
+	root := filepath.Join(s.basePath, greylistDir)
+	buckets, err := s.fs.ReadDir(root)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, bucket := range buckets {
+		if !bucket.IsDir() {
+			continue
+		}
+		entries, err := s.fs.ReadDir(filepath.Join(root, bucket.Name()))
+		if err != nil {
+			return err
+		}
+		for _, e := range entries {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+				continue
+			}
+			if err := s.purgeTriplet(e.Name(), now); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// purgeTriplet removes the triplet with key if it has expired at now.
+func (s *MaildirStore) purgeTriplet(key string, now time.Time) error {
+	defer s.greylistLocks.Lock(key)()
+	path := s.greylistPath(key)
+	entries, err := readSidecar(s.fs, path)
+	if err == nil && len(entries) == 0 {
+		return nil
+	}
+	if err == nil {
+		first, ferr := time.Parse(time.RFC3339Nano, entries["first_seen"])
+		last, lerr := time.Parse(time.RFC3339Nano, entries["last_seen"])
+		if ferr == nil && lerr == nil {
+			if entries["passed"] == "true" && now.Sub(last) <= s.greylist.Lifetime ||
+				entries["passed"] != "true" && now.Sub(first) <= s.greylist.RetryWindow {
+				return nil
+			}
+		}
+	}
+	if err := s.fs.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Compile-time interface verification.
+var _ msgstore.Greylister = (*MaildirStore)(nil)
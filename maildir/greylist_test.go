@@ -0,0 +1,110 @@
+package maildir
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMaildirStore_ShouldGreylist(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "", WithGreylistPolicy(GreylistPolicy{Delay: time.Minute, RetryWindow: time.Hour}))
+	key := greylistKey(net.ParseIP("192.0.2.10"), "sender@example.org", "user@example.com")
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	steps := []struct {
+		after time.Duration
+		want  bool
+	}{
+		{0, true},                    // first attempt
+		{30 * time.Second, true},     // retried too soon
+		{2 * time.Minute, false},     // retried after the delay
+		{30 * 24 * time.Hour, false}, // passed triplets stay passed
+	}
+	for _, step := range steps {
+		got, err := store.shouldGreylist(key, start.Add(step.after))
+		if err != nil {
+			t.Fatalf("shouldGreylist at %v: %v", step.after, err)
+		}
+		if got != step.want {
+			t.Errorf("shouldGreylist at %v = %v, want %v", step.after, got, step.want)
+		}
+	}
+
+	other := greylistKey(net.ParseIP("198.51.100.1"), "sender@example.org", "user@example.com")
+	if got, _ := store.shouldGreylist(other, start); !got {
+		t.Error("new triplet was not greylisted")
+	}
+	if got, _ := store.shouldGreylist(other, start.Add(2*time.Hour)); !got {
+		t.Error("retry after the retry window was not greylisted")
+	}
+}
+
+func TestGreylistKey(t *testing.T) {
+	a := greylistKey(net.ParseIP("192.0.2.10"), "Sender@example.org", "user@example.com")
+	if b := greylistKey(net.ParseIP("192.0.2.99"), "sender@example.org", "USER@example.com"); a != b {
+		t.Error("clients in one /24 with differently cased addresses have different keys")
+	}
+	if b := greylistKey(net.ParseIP("192.0.3.10"), "sender@example.org", "user@example.com"); a == b {
+		t.Error("clients in different /24 networks share a key")
+	}
+	v6 := greylistKey(net.ParseIP("2001:db8::1"), "sender@example.org", "user@example.com")
+	if b := greylistKey(net.ParseIP("2001:db8::ffff:1"), "sender@example.org", "user@example.com"); v6 != b {
+		t.Error("clients in one /64 have different keys")
+	}
+}
+
+func TestMaildirStore_PurgeGreylist(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "", WithGreylistPolicy(GreylistPolicy{Delay: time.Minute, RetryWindow: time.Hour, Lifetime: 24 * time.Hour}))
+	ctx := context.Background()
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	pending := greylistKey(net.ParseIP("192.0.2.1"), "a@example.org", "user@example.com")
+	passed := greylistKey(net.ParseIP("192.0.2.1"), "b@example.org", "user@example.com")
+	for _, at := range []time.Time{start, start.Add(2 * time.Minute)} {
+		if _, err := store.shouldGreylist(passed, at); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.shouldGreylist(pending, start); err != nil {
+		t.Fatal(err)
+	}
+
+	exists := func(key string) bool {
+		_, err := os.Stat(store.greylistPath(key))
+		return err == nil
+	}
+	if err := store.purgeGreylist(ctx, start.Add(30*time.Minute)); err != nil {
+		t.Fatalf("purgeGreylist: %v", err)
+	}
+	if !exists(pending) || !exists(passed) {
+		t.Fatal("purge removed live triplets")
+	}
+	if err := store.purgeGreylist(ctx, start.Add(2*time.Hour)); err != nil {
+		t.Fatalf("purgeGreylist: %v", err)
+	}
+	if exists(pending) || !exists(passed) {
+		t.Errorf("after the retry window: pending kept %v, passed kept %v; want false, true", exists(pending), exists(passed))
+	}
+	if err := store.purgeGreylist(ctx, start.Add(48*time.Hour)); err != nil {
+		t.Fatalf("purgeGreylist: %v", err)
+	}
+	if exists(passed) {
+		t.Error("passed triplet kept past its lifetime")
+	}
+
+	garbage := filepath.Join(store.basePath, greylistDir, "ab", "abcd")
+	if err := os.MkdirAll(filepath.Dir(garbage), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(garbage, []byte("not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.PurgeGreylist(ctx); err != nil {
+		t.Fatalf("PurgeGreylist: %v", err)
+	}
+	if _, err := os.Stat(garbage); !os.IsNotExist(err) {
+		t.Error("unreadable triplet was not removed")
+	}
+}
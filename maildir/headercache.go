@@ -0,0 +1,129 @@
+package maildir
+
+import (
+	"bufio"
+	"container/list"
+	"io"
+	"mime"
+	"net/mail"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultHeaderCacheSize is the number of header summaries kept in memory.
+	defaultHeaderCacheSize = 10000
+
+	// maxSummaryHeaderBytes bounds how much of a message is read looking for
+	// the end of its header section.
+	maxSummaryHeaderBytes = 256 * 1024
+)
+
+// headerSummary holds the header fields reported by WithHeaderSummary.
+type headerSummary struct {
+	from      string
+	subject   string
+	date      time.Time
+	messageID string
+}
+
+// headerCache is a fixed-size LRU cache of header summaries. Maildir message
+// content never changes for a given key (only its flags, which are not part
+// of the key), so entries never need invalidation; they only age out.
+type headerCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List // front is most recently used
+	entries map[string]*list.Element
+}
+
+// headerCacheEntry is the value stored in headerCache.order.
+type headerCacheEntry struct {
+	key     string
+	summary headerSummary
+}
+
+// newHeaderCache creates a cache holding up to size summaries.
+func newHeaderCache(size int) *headerCache {
+	return &headerCache{
+		size:    size,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+	}
+}
+
+// get returns the cached summary for key.
+func (c *headerCache) get(key string) (headerSummary, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	el, ok := c.entries[key]
+	if !ok {
+		return headerSummary{}, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*headerCacheEntry).summary, true
+}
+
+// put stores a summary, evicting the least recently used entry if full.
+func (c *headerCache) put(key string, summary headerSummary) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[key]; ok {
+		el.Value.(*headerCacheEntry).summary = summary
+		c.order.MoveToFront(el)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&headerCacheEntry{key: key, summary: summary})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*headerCacheEntry).key)
+	}
+}
+
+// parseHeaderSummary reads the header section of a message and extracts the
+// summary fields. Unreadable headers yield an empty summary.
+func parseHeaderSummary(r io.Reader) headerSummary {
+	msg, err := mail.ReadMessage(bufio.NewReader(io.LimitReader(r, maxSummaryHeaderBytes)))
+	if err != nil {
+		return headerSummary{}
+	}
+	dec := new(mime.WordDecoder)
+	decode := func(raw string) string {
+		if decoded, err := dec.DecodeHeader(raw); err == nil {
+			return decoded
+		}
+		return raw
+	}
+	summary := headerSummary{
+		from:      decode(msg.Header.Get("From")),
+		subject:   decode(msg.Header.Get("Subject")),
+		messageID: strings.TrimSpace(msg.Header.Get("Message-Id")),
+	}
+	if date, err := msg.Header.Date(); err == nil {
+		summary.date = date
+	}
+	return summary
+}
+
+// headerSummaryFor returns the header summary of the message uid in the
+// maildir at path, from the cache if possible.
+func (s *MaildirStore) headerSummaryFor(path, uid string) headerSummary {
+	cacheKey := path + "\x00" + uid
+	if summary, ok := s.headerCache.get(cacheKey); ok {
+		return summary
+	}
+	msg, err := messageByKey(s.fs, path, uid)
+	if err != nil {
+		return headerSummary{}
+	}
+	rc, err := s.fs.Open(msg.filename)
+	if err != nil {
+		return headerSummary{}
+	}
+	defer func() { _ = rc.Close() }()
+	summary := parseHeaderSummary(rc)
+	s.headerCache.put(cacheKey, summary)
+	return summary
+}
@@ -0,0 +1,90 @@
+package maildir
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/infodancer/msgstore"
+)
+
+func TestMaildirStore_ListWithHeaderSummary(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+
+	deliverTestMessage(t, store, "From: Alice <alice@example.com>\r\n"+
+		"Subject: =?UTF-8?Q?Caf=C3=A9?=\r\n"+
+		"Date: Fri, 02 Jan 2026 03:04:05 +0000\r\n"+
+		"Message-ID: <abc@example.com>\r\n"+
+		"\r\n"+
+		"body\r\n")
+
+	plain, err := store.ListWithOptions(ctx, "user@example.com", "INBOX")
+	if err != nil {
+		t.Fatalf("ListWithOptions failed: %v", err)
+	}
+	if len(plain) != 1 || plain[0].Subject != "" {
+		t.Fatalf("header fields populated without WithHeaderSummary: %+v", plain)
+	}
+
+	msgs, err := store.ListWithOptions(ctx, "user@example.com", "", msgstore.WithHeaderSummary())
+	if err != nil {
+		t.Fatalf("ListWithOptions failed: %v", err)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("got %d messages, want 1", len(msgs))
+	}
+	got := msgs[0]
+	if got.From != "Alice <alice@example.com>" || got.Subject != "Café" || got.MessageID != "<abc@example.com>" {
+		t.Errorf("unexpected summary: %+v", got)
+	}
+	if !got.Date.Equal(time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("Date = %v", got.Date)
+	}
+
+	// A flag change renames the file but the cached summary still applies.
+	if err := store.SetFlagsInFolder(ctx, "user@example.com", "INBOX", got.UID, msgstore.FlagModeSet, []string{"\\Seen"}); err != nil {
+		t.Fatalf("SetFlagsInFolder failed: %v", err)
+	}
+	msgs, err = store.ListWithOptions(ctx, "user@example.com", "INBOX", msgstore.WithHeaderSummary())
+	if err != nil || len(msgs) != 1 || msgs[0].Subject != "Café" {
+		t.Fatalf("summary after flag change = %+v, %v", msgs, err)
+	}
+}
+
+func TestMaildirStore_ListWithHeaderSummaryFolder(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+	if err := store.DeliverToFolder(ctx, "user@example.com", "Work", strings.NewReader("Subject: report\r\n\r\nx")); err != nil {
+		t.Fatalf("DeliverToFolder failed: %v", err)
+	}
+	msgs, err := store.ListWithOptions(ctx, "user@example.com", "Work", msgstore.WithHeaderSummary())
+	if err != nil || len(msgs) != 1 || msgs[0].Subject != "report" {
+		t.Fatalf("ListWithOptions = %+v, %v", msgs, err)
+	}
+}
+
+func TestHeaderCache_Eviction(t *testing.T) {
+	c := newHeaderCache(2)
+	c.put("a", headerSummary{subject: "a"})
+	c.put("b", headerSummary{subject: "b"})
+	if _, ok := c.get("a"); !ok {
+		t.Fatal("a missing")
+	}
+	c.put("c", headerSummary{subject: "c"})
+	if _, ok := c.get("b"); ok {
+		t.Error("least recently used entry b was not evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.get(key); !ok {
+			t.Errorf("%s evicted, want kept", key)
+		}
+	}
+}
+
+func TestParseHeaderSummary_Unreadable(t *testing.T) {
+	if summary := parseHeaderSummary(strings.NewReader("\x00\x01binary")); summary != (headerSummary{}) {
+		t.Errorf("summary of unreadable message = %+v, want empty", summary)
+	}
+}
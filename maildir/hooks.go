@@ -0,0 +1,119 @@
+package maildir
+
+import (
+	"context"
+	"sync"
+
+	"github.com/infodancer/msgstore"
+)
+
+// DeliverInfo describes a message stored by Deliver or DeliverToFolder.
+type DeliverInfo struct {
+	// Mailbox is the canonical mailbox the message was stored in.
+	Mailbox string
+
+	// Folder is the folder the message was stored in; "" for the inbox.
+	Folder string
+
+	// Size is the message size in bytes.
+	Size int64
+
+	// Envelope is the delivery envelope, narrowed to this recipient.
+	// It is empty for DeliverToFolder, which has no envelope.
+	Envelope msgstore.Envelope
+}
+
+// RetrieveInfo describes a message opened by Retrieve or RetrieveFromFolder.
+type RetrieveInfo struct {
+	Mailbox string
+	Folder  string // "" for the inbox
+	UID     string
+}
+
+// ExpungeInfo describes messages permanently removed by Expunge or ExpungeFolder.
+type ExpungeInfo struct {
+	Mailbox string
+	Folder  string   // "" for the inbox
+	UIDs    []string // sorted
+}
+
+// DeliverHook is called after a message has been stored.
+type DeliverHook func(ctx context.Context, info DeliverInfo)
+
+// RetrieveHook is called after a message has been opened for reading.
+type RetrieveHook func(ctx context.Context, info RetrieveInfo)
+
+// ExpungeHook is called after deleted messages have been removed. It is also
+// called for the messages that were removed by an expunge that then failed.
+type ExpungeHook func(ctx context.Context, info ExpungeInfo)
+
+// hooks holds the callbacks registered on a MaildirStore.
+type hooks struct {
+	mu         sync.RWMutex
+	onDeliver  []DeliverHook
+	onRetrieve []RetrieveHook
+	onExpunge  []ExpungeHook
+}
+
+// OnDeliver registers a hook called after each successful delivery, once per
+// stored copy (a Sieve script filing into two folders produces two calls).
+//
+// Hooks run synchronously on the calling goroutine after the operation has
+// succeeded, in registration order, and are never called for failed
+// operations. They must be fast and safe for concurrent use; hand anything
+// slow (replication, remote calls) off to another goroutine.
+func (s *MaildirStore) OnDeliver(hook DeliverHook) {
+	s.hooks.mu.Lock()
+	defer s.hooks.mu.Unlock()
+	s.hooks.onDeliver = append(s.hooks.onDeliver, hook)
+}
+
+// OnRetrieve registers a hook called after each successful Retrieve or
+// RetrieveFromFolder. See OnDeliver for how hooks are run.
+func (s *MaildirStore) OnRetrieve(hook RetrieveHook) {
+	s.hooks.mu.Lock()
+	defer s.hooks.mu.Unlock()
+	s.hooks.onRetrieve = append(s.hooks.onRetrieve, hook)
+}
+
+// OnExpunge registers a hook called after each Expunge or ExpungeFolder that
+// removed at least one message. See OnDeliver for how hooks are run.
+func (s *MaildirStore) OnExpunge(hook ExpungeHook) {
+	s.hooks.mu.Lock()
+	defer s.hooks.mu.Unlock()
+	s.hooks.onExpunge = append(s.hooks.onExpunge, hook)
+}
+
+// deliver runs the registered deliver hooks.
+func (h *hooks) deliver(ctx context.Context, info DeliverInfo) {
+	h.mu.RLock()
+	fns := h.onDeliver
+	h.mu.RUnlock()
+	for _, fn := range fns {
+		fn(ctx, info)
+	}
+}
+
+// retrieve runs the registered retrieve hooks.
+func (h *hooks) retrieve(ctx context.Context, info RetrieveInfo) {
+	h.mu.RLock()
+	fns := h.onRetrieve
+	h.mu.RUnlock()
+	for _, fn := range fns {
+		fn(ctx, info)
+	}
+}
+
+// expunge runs the registered expunge hooks with the removed UIDs.
+func (h *hooks) expunge(ctx context.Context, mailbox, folder string, removed []string) {
+	h.mu.RLock()
+	fns := h.onExpunge
+	h.mu.RUnlock()
+	if len(removed) == 0 {
+		return
+	}
+	info := ExpungeInfo{Mailbox: mailbox, Folder: folder, UIDs: removed}
+	for _, fn := range fns {
+		fn(ctx, info)
+	}
+}
@@ -0,0 +1,93 @@
+package maildir
+
+import (
+	"context"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestMaildirStore_Hooks(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+
+	var delivered []DeliverInfo
+	var retrieved []RetrieveInfo
+	var expunged []ExpungeInfo
+	store.OnDeliver(func(ctx context.Context, info DeliverInfo) { delivered = append(delivered, info) })
+	store.OnRetrieve(func(ctx context.Context, info RetrieveInfo) { retrieved = append(retrieved, info) })
+	store.OnExpunge(func(ctx context.Context, info ExpungeInfo) { expunged = append(expunged, info) })
+
+	const msg = "Subject: hi\r\n\r\nhello"
+	deliverTestMessage(t, store, msg)
+	if err := store.DeliverToFolder(ctx, "user@example.com", "Work", strings.NewReader(msg)); err != nil {
+		t.Fatalf("DeliverToFolder failed: %v", err)
+	}
+
+	if len(delivered) != 2 {
+		t.Fatalf("got %d deliver hooks, want 2", len(delivered))
+	}
+	if delivered[0].Mailbox != "user@example.com" || delivered[0].Folder != "" || delivered[0].Size != int64(len(msg)) {
+		t.Errorf("unexpected deliver info: %+v", delivered[0])
+	}
+	if delivered[0].Envelope.From != "sender@example.com" {
+		t.Errorf("deliver info envelope = %+v", delivered[0].Envelope)
+	}
+	if delivered[1].Folder != "Work" {
+		t.Errorf("DeliverToFolder hook folder = %q, want Work", delivered[1].Folder)
+	}
+
+	msgs, err := store.List(ctx, "user@example.com")
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("List = %d messages, %v", len(msgs), err)
+	}
+	uid := msgs[0].UID
+
+	if _, err := store.Retrieve(ctx, "user@example.com", "missing"); err == nil {
+		t.Fatal("expected Retrieve of missing message to fail")
+	}
+	rc, err := store.Retrieve(ctx, "user@example.com", uid)
+	if err != nil {
+		t.Fatalf("Retrieve failed: %v", err)
+	}
+	_, _ = io.Copy(io.Discard, rc)
+	_ = rc.Close()
+
+	wantRetrieved := []RetrieveInfo{{Mailbox: "user@example.com", UID: uid}}
+	if !reflect.DeepEqual(retrieved, wantRetrieved) {
+		t.Errorf("retrieve hooks = %+v, want %+v", retrieved, wantRetrieved)
+	}
+
+	// Expunge with nothing deleted does not fire the hook.
+	if _, err := store.Expunge(ctx, "user@example.com"); err != nil {
+		t.Fatalf("Expunge failed: %v", err)
+	}
+	if err := store.Delete(ctx, "user@example.com", uid); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if _, err := store.Expunge(ctx, "user@example.com"); err != nil {
+		t.Fatalf("Expunge failed: %v", err)
+	}
+	wantExpunged := []ExpungeInfo{{Mailbox: "user@example.com", UIDs: []string{uid}}}
+	if !reflect.DeepEqual(expunged, wantExpunged) {
+		t.Errorf("expunge hooks = %+v, want %+v", expunged, wantExpunged)
+	}
+}
+
+func TestMaildirStore_DeliverHookPerSieveCopy(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	if err := store.CreateFolder(context.Background(), "user@example.com", "Work"); err != nil {
+		t.Fatalf("CreateFolder failed: %v", err)
+	}
+	activateTestScript(t, store, `require ["fileinto", "copy"]; fileinto :copy "Work";`)
+
+	var folders []string
+	store.OnDeliver(func(ctx context.Context, info DeliverInfo) { folders = append(folders, info.Folder) })
+
+	deliverTestMessage(t, store, "Subject: hi\r\n\r\nhello")
+
+	if want := []string{"Work", ""}; !reflect.DeepEqual(folders, want) {
+		t.Errorf("deliver hook folders = %q, want %q", folders, want)
+	}
+}
@@ -0,0 +1,77 @@
+package maildir
+
+import (
+	"log/slog"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// deliveriesFile records the idempotency keys of recent deliveries in
+	// the mailbox root, mapping each key to when it was delivered.
+	deliveriesFile = "deliveries.json"
+
+	// defaultIdempotencyWindow is how long delivery idempotency keys are
+	// remembered unless configured with WithIdempotencyWindow.
+	defaultIdempotencyWindow = 24 * time.Hour
+)
+
+// deliveriesPath returns the idempotency key record of mailbox.
+func (s *MaildirStore) deliveriesPath(mailbox string) (string, error) {
+	root, err := s.mailboxRootPath(mailbox)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, deliveriesFile), nil
+}
+
+// lockDelivery serializes deliveries of the same idempotency key to the
+// same mailbox, so a retry racing the original attempt waits for its
+// outcome instead of storing a second copy.
+func (s *MaildirStore) lockDelivery(mailbox, key string) (unlock func()) {
+	return s.idempotencyLocks.Lock(s.mailboxKey(mailbox) + "\x00" + key)
+}
+
+// alreadyDelivered reports whether a message with idempotency key was
+// delivered to mailbox within the idempotency window. Errors reading the
+// record are logged and treated as not delivered, so mail is never lost to
+// a damaged record.
+func (s *MaildirStore) alreadyDelivered(mailbox, key string) bool {
+	path, err := s.deliveriesPath(mailbox)
+	if err != nil {
+		return false
+	}
+	entries, err := readSidecar(s.fs, path)
+	if err != nil {
+		slog.Warn("reading delivery record", "path", path, "error", err)
+		return false
+	}
+	at, err := time.Parse(time.RFC3339Nano, entries[key])
+	return err == nil && time.Since(at) < s.idempotencyWindow
+}
+
+// recordDelivery remembers that a message with idempotency key was
+// delivered to mailbox, dropping keys older than the idempotency window.
+// The message is already stored, so failures are only logged.
+func (s *MaildirStore) recordDelivery(mailbox, key string) {
+	defer s.lockMailbox(mailbox)()
+	path, err := s.deliveriesPath(mailbox)
+	if err != nil {
+		return
+	}
+	entries, err := readSidecar(s.fs, path)
+	if err != nil {
+		slog.Warn("reading delivery record", "path", path, "error", err)
+		entries = make(map[string]string)
+	}
+	now := time.Now()
+	for k, v := range entries {
+		if at, err := time.Parse(time.RFC3339Nano, v); err != nil || now.Sub(at) >= s.idempotencyWindow {
+			delete(entries, k)
+		}
+	}
+	entries[key] = now.UTC().Format(time.RFC3339Nano)
+	if err := writeSidecar(s.fs, path, entries); err != nil {
+		slog.Error("writing delivery record", "path", path, "error", err)
+	}
+}
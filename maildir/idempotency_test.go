@@ -0,0 +1,86 @@
+package maildir
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/infodancer/msgstore"
+)
+
+func TestMaildirStore_DeliverIdempotencyKey(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+
+	envelope := msgstore.Envelope{
+		From:           "sender@example.com",
+		Recipients:     []string{"a@example.com", "b+lists@example.com"},
+		ReceivedTime:   time.Now(),
+		IdempotencyKey: "queue-1",
+	}
+	for i := 0; i < 3; i++ {
+		if err := store.Deliver(ctx, envelope, strings.NewReader("Subject: once\r\n\r\n")); err != nil {
+			t.Fatalf("Deliver #%d: %v", i+1, err)
+		}
+	}
+	for _, mailbox := range []string{"a@example.com", "b@example.com"} {
+		if count, _, err := store.Stat(ctx, mailbox); err != nil || count != 1 {
+			t.Errorf("Stat(%s) = %d, %v; want 1 message", mailbox, count, err)
+		}
+	}
+
+	envelope.IdempotencyKey = "queue-2"
+	if err := store.Deliver(ctx, envelope, strings.NewReader("Subject: other\r\n\r\n")); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	envelope.IdempotencyKey = ""
+	if err := store.Deliver(ctx, envelope, strings.NewReader("Subject: unkeyed\r\n\r\n")); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	if err := store.Deliver(ctx, envelope, strings.NewReader("Subject: unkeyed\r\n\r\n")); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	if count, _, _ := store.Stat(ctx, "a@example.com"); count != 4 {
+		t.Errorf("Stat count = %d, want 4", count)
+	}
+}
+
+func TestMaildirStore_DeliverIdempotencyConcurrent(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+	envelope := msgstore.Envelope{Recipients: []string{"a@example.com"}, IdempotencyKey: "queue-1"}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := store.Deliver(ctx, envelope, strings.NewReader("Subject: race\r\n\r\n")); err != nil {
+				t.Errorf("Deliver: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if count, _, _ := store.Stat(ctx, "a@example.com"); count != 1 {
+		t.Errorf("Stat count = %d, want 1", count)
+	}
+}
+
+func TestMaildirStore_DeliverIdempotencyWindow(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "", WithIdempotencyWindow(time.Millisecond))
+	ctx := context.Background()
+	envelope := msgstore.Envelope{Recipients: []string{"a@example.com"}, IdempotencyKey: "queue-1"}
+
+	if err := store.Deliver(ctx, envelope, strings.NewReader("Subject: x\r\n\r\n")); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err := store.Deliver(ctx, envelope, strings.NewReader("Subject: x\r\n\r\n")); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	if count, _, _ := store.Stat(ctx, "a@example.com"); count != 2 {
+		t.Errorf("Stat count = %d, want 2 once the key expired", count)
+	}
+}
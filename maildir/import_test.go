@@ -0,0 +1,71 @@
+package maildir
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/infodancer/msgstore"
+)
+
+func TestMaildirStore_DeliverImport(t *testing.T) {
+	basePath := t.TempDir()
+	store := NewStore(basePath, "", "")
+	mailbox := "user@example.com"
+	date := time.Date(2019, 3, 4, 5, 6, 7, 0, time.UTC)
+	ctx := msgstore.WithImport(context.Background(), msgstore.ImportOptions{
+		Flags: []string{"\\Seen", "$Archived"},
+		Date:  date,
+	})
+
+	envelope := msgstore.Envelope{Recipients: []string{mailbox}}
+	if err := store.Deliver(ctx, envelope, strings.NewReader("Subject: old\r\n\r\n")); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	if entries, err := os.ReadDir(filepath.Join(basePath, "user", "new")); err != nil || len(entries) != 0 {
+		t.Errorf("new/ = %v, %v; want empty", entries, err)
+	}
+	if got := recentCount(t, store); got != 0 {
+		t.Errorf("%d recent messages, want an import not to be recent", got)
+	}
+	msgs, err := store.List(context.Background(), mailbox)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("List = %v, %v", msgs, err)
+	}
+	if !msgs[0].InternalDate.Equal(date) {
+		t.Errorf("InternalDate = %v, want %v", msgs[0].InternalDate, date)
+	}
+	if want := []string{"\\Seen", "$Archived"}; !reflect.DeepEqual(msgs[0].Flags, want) {
+		t.Errorf("Flags = %v, want %v", msgs[0].Flags, want)
+	}
+}
+
+func TestMaildirStore_DeliverToFolderImport(t *testing.T) {
+	basePath := t.TempDir()
+	store := NewStore(basePath, "", "")
+	mailbox := "user@example.com"
+	if err := store.CreateFolder(context.Background(), mailbox, "Sent"); err != nil {
+		t.Fatalf("CreateFolder: %v", err)
+	}
+
+	// Without flags an import still bypasses new/.
+	ctx := msgstore.WithImport(context.Background(), msgstore.ImportOptions{})
+	if err := store.DeliverToFolder(ctx, mailbox, "Sent", strings.NewReader("Subject: sent\r\n\r\n")); err != nil {
+		t.Fatalf("DeliverToFolder: %v", err)
+	}
+	path, err := store.folderPath(mailbox, "Sent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries, err := os.ReadDir(filepath.Join(path, "new")); err != nil || len(entries) != 0 {
+		t.Errorf("new/ = %v, %v; want empty", entries, err)
+	}
+	msgs, err := store.ListInFolder(context.Background(), mailbox, "Sent")
+	if err != nil || len(msgs) != 1 || len(msgs[0].Flags) != 0 {
+		t.Errorf("ListInFolder = %+v, %v; want one message without flags", msgs, err)
+	}
+}
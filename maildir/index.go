@@ -0,0 +1,231 @@
+package maildir
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// indexFile is the per-folder message index inside the maildir, next to
+	// cur/, kept when WithMessageIndex is set. It caches what a listing
+	// needs per message so listings read one file instead of stat-ing and
+	// opening every message.
+	indexFile = "index.json"
+
+	// indexVersion is the version of the indexFile format. An index of
+	// another version is discarded and rebuilt.
+	indexVersion = 1
+)
+
+// messageIndex is the on-disk form of indexFile.
+type messageIndex struct {
+	Version int `json:"version"`
+
+	// Messages maps each message key (its UID) in cur/ to its entry.
+	Messages map[string]indexEntry `json:"messages"`
+}
+
+// indexEntry is what the index knows about one message.
+type indexEntry struct {
+	// Flags are the maildir flag letters of the message's file name. An
+	// entry whose flags differ from the file name is out of date.
+	Flags string `json:"flags"`
+
+	Size int64     `json:"size"`
+	Date time.Time `json:"date"`
+
+	// Summary is the header summary, once a listing has asked for it.
+	Summary *indexSummary `json:"summary,omitempty"`
+}
+
+// indexSummary is the on-disk form of headerSummary.
+type indexSummary struct {
+	From      string    `json:"from,omitempty"`
+	Subject   string    `json:"subject,omitempty"`
+	Date      time.Time `json:"date,omitzero"`
+	MessageID string    `json:"message_id,omitempty"`
+}
+
+// messageIndexes keeps each folder's index in memory as last read or
+// written, so it is decoded again only when another process changed it.
+type messageIndexes struct {
+	locks keyedMutex // serializes updates per maildir path
+
+	mu     sync.Mutex
+	loaded map[string]*loadedIndex // maildir path -> index
+}
+
+// loadedIndex is an index with the size and mtime its file had when it was
+// read or written.
+type loadedIndex struct {
+	index   messageIndex
+	size    int64
+	modTime time.Time
+}
+
+func newMessageIndexes() *messageIndexes {
+	return &messageIndexes{loaded: make(map[string]*loadedIndex)}
+}
+
+// load returns the index of the maildir at path, decoding the file only if
+// it changed since it was last seen. A missing, unreadable or outdated
+// index yields an empty one, which the caller then rebuilds. The caller
+// holds the path's lock.
+func (x *messageIndexes) load(fsys FS, path string) messageIndex {
+	file := filepath.Join(path, indexFile)
+	fi, err := fsys.Stat(file)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			slog.Warn("rebuilding message index", "path", file, "error", err)
+		}
+		return messageIndex{Version: indexVersion, Messages: make(map[string]indexEntry)}
+	}
+
+	x.mu.Lock()
+	cached, ok := x.loaded[path]
+	x.mu.Unlock()
+	if ok && cached.size == fi.Size() && cached.modTime.Equal(fi.ModTime()) {
+		return cached.index
+	}
+
+	var index messageIndex
+	data, err := fsys.ReadFile(file)
+	if err == nil {
+		err = json.Unmarshal(data, &index)
+	}
+	if err != nil || index.Version != indexVersion || index.Messages == nil {
+		slog.Warn("rebuilding message index", "path", file, "version", index.Version, "error", err)
+		return messageIndex{Version: indexVersion, Messages: make(map[string]indexEntry)}
+	}
+	x.remember(path, index, fi)
+	return index
+}
+
+// save atomically replaces the index file of the maildir at path. The
+// caller holds the path's lock. The index is only a cache, so failures
+// are logged and the next listing tries again.
+func (x *messageIndexes) save(fsys FS, path string, index messageIndex) {
+	file := filepath.Join(path, indexFile)
+	data, err := json.Marshal(index)
+	if err == nil {
+		var tmp string
+		if tmp, err = writeTemp(fsys, path, bytes.NewReader(data), false); err == nil {
+			if err = fsys.Rename(tmp, file); err != nil {
+				_ = fsys.Remove(tmp)
+			}
+		}
+	}
+	if err != nil {
+		slog.Error("writing message index", "path", file, "error", err)
+		x.forget(path)
+		return
+	}
+	fi, err := fsys.Stat(file)
+	if err != nil {
+		x.forget(path)
+		return
+	}
+	x.remember(path, index, fi)
+}
+
+func (x *messageIndexes) remember(path string, index messageIndex, fi os.FileInfo) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.loaded[path] = &loadedIndex{index: index, size: fi.Size(), modTime: fi.ModTime()}
+}
+
+func (x *messageIndexes) forget(path string) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	delete(x.loaded, path)
+}
+
+// reconcile brings the index of the maildir at path in line with msgs, the
+// messages now in its cur/, and returns a copy of its entries. Only the
+// differences are worked on: entries are added for new messages, have
+// their flags updated for renamed ones and are dropped for removed ones.
+// The index is written back only if something changed.
+func (x *messageIndexes) reconcile(fsys FS, path string, msgs []*message) map[string]indexEntry {
+	defer x.locks.Lock(path)()
+	index := x.load(fsys, path)
+
+	changed := false
+	present := make(map[string]bool, len(msgs))
+	for _, msg := range msgs {
+		present[msg.key] = true
+		flags := string(msg.flags)
+		entry, ok := index.Messages[msg.key]
+		if ok && entry.Flags == flags {
+			continue
+		}
+		if !ok {
+			size, date, err := messageAttrs(fsys, msg.filename)
+			if err != nil {
+				continue // removed concurrently
+			}
+			entry = indexEntry{Size: size, Date: date}
+		}
+		entry.Flags = flags
+		index.Messages[msg.key] = entry
+		changed = true
+	}
+	for key := range index.Messages {
+		if !present[key] {
+			delete(index.Messages, key)
+			changed = true
+		}
+	}
+	if changed {
+		x.save(fsys, path, index)
+	}
+
+	entries := make(map[string]indexEntry, len(index.Messages))
+	for key, entry := range index.Messages {
+		entries[key] = entry
+	}
+	return entries
+}
+
+// summaries returns the header summaries of uids in the maildir at path,
+// from the index where it has them and from parse otherwise. Newly parsed
+// summaries are added to the index in a single write.
+func (x *messageIndexes) summaries(fsys FS, path string, uids []string, parse func(uid string) headerSummary) map[string]headerSummary {
+	defer x.locks.Lock(path)()
+	index := x.load(fsys, path)
+
+	result := make(map[string]headerSummary, len(uids))
+	changed := false
+	for _, uid := range uids {
+		entry, ok := index.Messages[uid]
+		if ok && entry.Summary != nil {
+			result[uid] = headerSummary{
+				from:      entry.Summary.From,
+				subject:   entry.Summary.Subject,
+				date:      entry.Summary.Date,
+				messageID: entry.Summary.MessageID,
+			}
+			continue
+		}
+		summary := parse(uid)
+		result[uid] = summary
+		if ok {
+			entry.Summary = &indexSummary{
+				From:      summary.from,
+				Subject:   summary.subject,
+				Date:      summary.date,
+				MessageID: summary.messageID,
+			}
+			index.Messages[uid] = entry
+			changed = true
+		}
+	}
+	if changed {
+		x.save(fsys, path, index)
+	}
+	return result
+}
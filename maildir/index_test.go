@@ -0,0 +1,132 @@
+package maildir
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/infodancer/msgstore"
+)
+
+func readIndex(t *testing.T, path string) messageIndex {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(path, indexFile))
+	if err != nil {
+		t.Fatalf("reading index: %v", err)
+	}
+	var index messageIndex
+	if err := json.Unmarshal(data, &index); err != nil {
+		t.Fatalf("decoding index: %v", err)
+	}
+	return index
+}
+
+func TestMessageIndex_Incremental(t *testing.T) {
+	basePath := t.TempDir()
+	store := NewStore(basePath, "", "", WithMessageIndex())
+	ctx := context.Background()
+	mailbox := "user@example.com"
+	path := filepath.Join(basePath, "user")
+
+	envelope := msgstore.Envelope{Recipients: []string{mailbox}, ReceivedTime: time.Now()}
+	for _, subject := range []string{"one", "two"} {
+		if err := store.Deliver(ctx, envelope, strings.NewReader("Subject: "+subject+"\r\n\r\nbody\r\n")); err != nil {
+			t.Fatalf("Deliver: %v", err)
+		}
+	}
+	msgs, err := store.List(ctx, mailbox)
+	if err != nil || len(msgs) != 2 {
+		t.Fatalf("List = %v, %v", msgs, err)
+	}
+	index := readIndex(t, path)
+	if len(index.Messages) != 2 {
+		t.Fatalf("index has %d messages, want 2", len(index.Messages))
+	}
+	if e := index.Messages[msgs[0].UID]; e.Size != msgs[0].Size || !e.Date.Equal(msgs[0].InternalDate) {
+		t.Errorf("index entry = %+v, want size %d date %v", e, msgs[0].Size, msgs[0].InternalDate)
+	}
+
+	if err := store.SetFlagsInFolder(ctx, mailbox, "INBOX", msgs[0].UID, msgstore.FlagModeAdd, []string{"\\Seen"}); err != nil {
+		t.Fatalf("SetFlagsInFolder: %v", err)
+	}
+	if err := store.Delete(ctx, mailbox, msgs[1].UID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Expunge(ctx, mailbox); err != nil {
+		t.Fatalf("Expunge: %v", err)
+	}
+	if _, err := store.List(ctx, mailbox); err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	index = readIndex(t, path)
+	if len(index.Messages) != 1 || index.Messages[msgs[0].UID].Flags != "S" {
+		t.Errorf("index after flag change and expunge = %+v", index.Messages)
+	}
+}
+
+func TestMessageIndex_RebuildsCorruptIndex(t *testing.T) {
+	basePath := t.TempDir()
+	store := NewStore(basePath, "", "", WithMessageIndex())
+	ctx := context.Background()
+	mailbox := "user@example.com"
+	path := filepath.Join(basePath, "user")
+
+	envelope := msgstore.Envelope{Recipients: []string{mailbox}, ReceivedTime: time.Now()}
+	if err := store.Deliver(ctx, envelope, strings.NewReader("Subject: x\r\n\r\n")); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	if _, err := store.List(ctx, mailbox); err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(path, indexFile), []byte("{not json"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	msgs, err := store.List(ctx, mailbox)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("List with corrupt index = %v, %v", msgs, err)
+	}
+	if index := readIndex(t, path); index.Version != indexVersion || len(index.Messages) != 1 {
+		t.Errorf("rebuilt index = %+v", index)
+	}
+}
+
+func TestMessageIndex_PersistsHeaderSummaries(t *testing.T) {
+	basePath := t.TempDir()
+	ctx := context.Background()
+	mailbox := "user@example.com"
+
+	store := NewStore(basePath, "", "", WithMessageIndex())
+	envelope := msgstore.Envelope{Recipients: []string{mailbox}, ReceivedTime: time.Now()}
+	if err := store.Deliver(ctx, envelope, strings.NewReader("Subject: Indexed\r\nFrom: a@example.com\r\n\r\n")); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	msgs, err := store.ListWithOptions(ctx, mailbox, "", msgstore.WithHeaderSummary())
+	if err != nil || len(msgs) != 1 || msgs[0].Subject != "Indexed" {
+		t.Fatalf("ListWithOptions = %+v, %v", msgs, err)
+	}
+
+	// Rewrite the message behind the store's back; a fresh store must
+	// still answer from the index rather than reparse the file.
+	cur := filepath.Join(basePath, "user", "cur")
+	entries, err := os.ReadDir(cur)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("ReadDir(cur) = %v, %v", entries, err)
+	}
+	if err := os.WriteFile(filepath.Join(cur, entries[0].Name()), []byte("Subject: Changed\r\n\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	fresh := NewStore(basePath, "", "", WithMessageIndex())
+	msgs, err = fresh.ListWithOptions(ctx, mailbox, "", msgstore.WithHeaderSummary())
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("ListWithOptions = %+v, %v", msgs, err)
+	}
+	if msgs[0].Subject != "Indexed" || msgs[0].From != "a@example.com" {
+		t.Errorf("summary = %q from %q, want it from the index", msgs[0].Subject, msgs[0].From)
+	}
+}
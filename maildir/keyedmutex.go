@@ -0,0 +1,42 @@
+package maildir
+
+import "sync"
+
+// keyedMutex provides one mutex per key, created on first use and released
+// when no goroutine holds or waits for it. The zero value is ready to use.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+// keyedLock is a mutex with a count of goroutines holding or waiting for it.
+type keyedLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// Lock acquires the mutex for key and returns the function that releases it.
+func (k *keyedMutex) Lock(key string) (unlock func()) {
+	k.mu.Lock()
+	if k.locks == nil {
+		k.locks = make(map[string]*keyedLock)
+	}
+	l := k.locks[key]
+	if l == nil {
+		l = &keyedLock{}
+		k.locks[key] = l
+	}
+	l.refs++
+	k.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		k.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(k.locks, key)
+		}
+		k.mu.Unlock()
+	}
+}
@@ -0,0 +1,49 @@
+package maildir
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestKeyedMutex_SerializesSameKey(t *testing.T) {
+	var k keyedMutex
+	var wg sync.WaitGroup
+	counter := 0
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			unlock := k.Lock("a")
+			defer unlock()
+			v := counter
+			time.Sleep(time.Microsecond)
+			counter = v + 1
+		}()
+	}
+	wg.Wait()
+	if counter != 50 {
+		t.Errorf("counter = %d, want 50 (lost updates under the same key)", counter)
+	}
+	if len(k.locks) != 0 {
+		t.Errorf("%d locks left after all were released", len(k.locks))
+	}
+}
+
+func TestKeyedMutex_IndependentKeys(t *testing.T) {
+	var k keyedMutex
+	unlockA := k.Lock("a")
+	defer unlockA()
+
+	done := make(chan struct{})
+	go func() {
+		unlock := k.Lock("b")
+		unlock()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("lock on key b blocked behind key a")
+	}
+}
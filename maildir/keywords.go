@@ -0,0 +1,341 @@
+package maildir
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/emersion/go-maildir"
+	"github.com/infodancer/msgstore/errors"
+)
+
+const (
+	// keywordsFile maps the keyword letters of a maildir's file names to
+	// IMAP keywords, in Dovecot's format: one "<index> <keyword>" line per
+	// keyword, where index 0 is the letter 'a'. Each folder's maildir has
+	// its own, next to cur/.
+	keywordsFile = "dovecot-keywords"
+
+	// keywordsLockFile is the dot-lock held while adding keywords, so that
+	// processes sharing the maildir never hand out one letter twice.
+	keywordsLockFile = keywordsFile + ".lock"
+
+	// maxKeywords is the number of keyword letters, 'a' to 'z'.
+	maxKeywords = 26
+
+	// dotLockTimeout bounds the wait for another process's dot-lock;
+	// dotLockStale is the age after which a dot-lock is assumed to have
+	// been left behind by a crashed process and is broken.
+	dotLockTimeout = 10 * time.Second
+	dotLockStale   = 2 * time.Minute
+)
+
+// keywordTable holds the keyword of each letter, "" for unused letters.
+type keywordTable [maxKeywords]string
+
+// letter returns the letter of keyword, compared case-insensitively as IMAP
+// keywords are.
+func (t *keywordTable) letter(keyword string) (maildir.Flag, bool) {
+	for i, name := range t {
+		if name != "" && strings.EqualFold(name, keyword) {
+			return maildir.Flag('a' + i), true
+		}
+	}
+	return 0, false
+}
+
+// keyword returns the keyword of letter f, or "" if f is not a keyword
+// letter or is unused.
+func (t *keywordTable) keyword(f maildir.Flag) string {
+	if f < 'a' || f > 'z' {
+		return ""
+	}
+	return t[f-'a']
+}
+
+// parseKeywords decodes a keywords file. Malformed lines are skipped.
+func parseKeywords(data []byte) keywordTable {
+	var t keywordTable
+	for _, line := range strings.Split(string(data), "\n") {
+		index, name, ok := strings.Cut(strings.TrimRight(line, "\r"), " ")
+		n, err := strconv.Atoi(index)
+		if !ok || err != nil || n < 0 || n >= maxKeywords || !validKeyword(name) {
+			continue
+		}
+		t[n] = name
+	}
+	return t
+}
+
+// format encodes t as a keywords file.
+func (t *keywordTable) format() []byte {
+	var buf bytes.Buffer
+	for i, name := range t {
+		if name != "" {
+			fmt.Fprintf(&buf, "%d %s\n", i, name)
+		}
+	}
+	return buf.Bytes()
+}
+
+// validKeyword reports whether name is an IMAP keyword: a non-empty atom
+// that is not a system flag.
+func validKeyword(name string) bool {
+	if name == "" || strings.HasPrefix(name, "\\") {
+		return false
+	}
+	for _, r := range name {
+		if r <= ' ' || r >= 0x7f || strings.ContainsRune(`(){%*"]`, r) {
+			return false
+		}
+	}
+	return true
+}
+
+// keywordTables keeps each folder's keyword table in memory as last read,
+// so the keywords file is read again only when it changed.
+type keywordTables struct {
+	mu     sync.Mutex
+	loaded map[string]*loadedKeywords // maildir path -> table
+}
+
+// loadedKeywords is a keyword table with the size and mtime its file had
+// when it was read.
+type loadedKeywords struct {
+	table   keywordTable
+	size    int64
+	modTime time.Time
+}
+
+// get returns the keyword table of the maildir at path. A missing file
+// yields an empty table.
+func (k *keywordTables) get(fsys FS, path string) (keywordTable, error) {
+	file := filepath.Join(path, keywordsFile)
+	fi, err := fsys.Stat(file)
+	if os.IsNotExist(err) {
+		return keywordTable{}, nil
+	}
+	if err != nil {
+		return keywordTable{}, err
+	}
+
+	k.mu.Lock()
+	cached, ok := k.loaded[path]
+	k.mu.Unlock()
+	if ok && cached.size == fi.Size() && cached.modTime.Equal(fi.ModTime()) {
+		return cached.table, nil
+	}
+
+	data, err := fsys.ReadFile(file)
+	if err != nil {
+		return keywordTable{}, err
+	}
+	table := parseKeywords(data)
+	k.mu.Lock()
+	if k.loaded == nil {
+		k.loaded = make(map[string]*loadedKeywords)
+	}
+	k.loaded[path] = &loadedKeywords{table: table, size: fi.Size(), modTime: fi.ModTime()}
+	k.mu.Unlock()
+	return table, nil
+}
+
+// lockKeywords takes the dot-lock of the keywords file of the maildir at
+// path.
+func lockKeywords(fsys FS, path string) (unlock func(), err error) {
+	return dotLock(fsys, filepath.Join(path, keywordsLockFile))
+}
+
+// dotLock creates the lock file lock, which other processes sharing the
+// maildir also honour, breaking it if it is stale. It gives up with an
+// error wrapping errors.ErrMailboxLocked after dotLockTimeout.
+func dotLock(fsys FS, lock string) (unlock func(), err error) {
+	deadline := time.Now().Add(dotLockTimeout)
+	for {
+		f, err := fsys.OpenFile(lock, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_, _ = fmt.Fprintf(f, "%d\n", os.Getpid())
+			_ = f.Close()
+			return func() { _ = fsys.Remove(lock) }, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+		if fi, err := fsys.Stat(lock); err == nil && time.Since(fi.ModTime()) > dotLockStale {
+			slog.Warn("breaking stale dot-lock", "path", lock, "age", time.Since(fi.ModTime()))
+			_ = fsys.Remove(lock)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("%s: %w", lock, errors.ErrMailboxLocked)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// keywordFlags returns the letters of keywords in the maildir at path. If
+// assign is set, keywords the folder does not know yet are given free
+// letters and added to its keywords file; otherwise they are left out.
+// Keywords that do not fit in the 26 letters are dropped with a warning.
+func (s *MaildirStore) keywordFlags(path string, keywords []string, assign bool) ([]maildir.Flag, error) {
+	if len(keywords) == 0 {
+		return nil, nil
+	}
+	table, err := s.keywords.get(s.fs, path)
+	if err != nil {
+		return nil, err
+	}
+	var letters []maildir.Flag
+	var missing []string
+	for _, kw := range keywords {
+		if f, ok := table.letter(kw); ok {
+			letters = append(letters, f)
+		} else {
+			missing = append(missing, kw)
+		}
+	}
+	if len(missing) == 0 || !assign {
+		return letters, nil
+	}
+
+	unlock, err := lockKeywords(s.fs, path)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	// Another process may have added keywords since the table was read.
+	file := filepath.Join(path, keywordsFile)
+	data, err := s.fs.ReadFile(file)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	table = parseKeywords(data)
+	changed := false
+	for _, kw := range missing {
+		if f, ok := table.letter(kw); ok {
+			letters = append(letters, f)
+			continue
+		}
+		free := -1
+		for i, name := range table {
+			if name == "" {
+				free = i
+				break
+			}
+		}
+		if free < 0 {
+			slog.Warn("no keyword letter left", "path", path, "keyword", kw)
+			continue
+		}
+		table[free] = kw
+		letters = append(letters, maildir.Flag('a'+free))
+		changed = true
+	}
+	if changed {
+		if err := writeKeywords(s.fs, path, table); err != nil {
+			return nil, err
+		}
+	}
+	return letters, nil
+}
+
+// writeKeywords atomically replaces the keywords file of the maildir at
+// path. The caller holds its dot-lock.
+func writeKeywords(fsys FS, path string, table keywordTable) error {
+	tmp, err := fsys.CreateTemp(path, ".tmp-keywords-*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(table.format())
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = fsys.Rename(tmp.Name(), filepath.Join(path, keywordsFile))
+	}
+	if err != nil {
+		_ = fsys.Remove(tmp.Name())
+	}
+	return err
+}
+
+// flagsFromIMAP converts IMAP flags to maildir flags for the maildir at
+// path: system flags as convertFlagsFromIMAP does, keywords as letters (see
+// keywordFlags).
+func (s *MaildirStore) flagsFromIMAP(path string, flags []string, assign bool) ([]maildir.Flag, error) {
+	var keywords []string
+	for _, f := range flags {
+		if validKeyword(f) {
+			keywords = append(keywords, f)
+		}
+	}
+	letters, err := s.keywordFlags(path, keywords, assign)
+	if err != nil {
+		return nil, err
+	}
+	return append(convertFlagsFromIMAP(flags), letters...), nil
+}
+
+// keywordNames returns a function converting the keyword letters of
+// messages in the maildir at path to IMAP keywords. The keywords file is
+// read on the first letter seen, so folders without keywords never read
+// it. Letters the file does not name are skipped.
+func (s *MaildirStore) keywordNames(path string) func(flags []maildir.Flag) []string {
+	var table *keywordTable
+	return func(flags []maildir.Flag) []string {
+		var names []string
+		for _, f := range flags {
+			if f < 'a' || f > 'z' {
+				continue
+			}
+			if table == nil {
+				t, err := s.keywords.get(s.fs, path)
+				if err != nil {
+					slog.Warn("reading keywords", "path", path, "error", err)
+				}
+				table = &t
+			}
+			if name := table.keyword(f); name != "" {
+				names = append(names, name)
+			}
+		}
+		return names
+	}
+}
+
+// keywordRemapper returns a function translating the keyword letters of a
+// message file name in the maildir srcPath into those of destPath, for
+// copies and moves between folders with different keywords files.
+// Keywords destPath lacks are added to it. A keyword that cannot be
+// carried over is dropped with a warning rather than failing the transfer.
+func (s *MaildirStore) keywordRemapper(srcPath, destPath string) func(name string) string {
+	names := s.keywordNames(srcPath)
+	return func(name string) string {
+		if srcPath == destPath {
+			return name
+		}
+		dir, base := filepath.Split(name)
+		key, info, ok := strings.Cut(base, ":")
+		flagChars, isV2 := strings.CutPrefix(info, "2,")
+		if !ok || !isV2 || !strings.ContainsAny(flagChars, "abcdefghijklmnopqrstuvwxyz") {
+			return name
+		}
+		var flags []maildir.Flag
+		for _, f := range []maildir.Flag(flagChars) {
+			if f < 'a' || f > 'z' {
+				flags = append(flags, f)
+			}
+		}
+		letters, err := s.keywordFlags(destPath, names([]maildir.Flag(flagChars)), true)
+		if err != nil {
+			slog.Warn("carrying keywords over", "path", destPath, "error", err)
+		}
+		return filepath.Join(dir, key+":"+infoFromFlags(append(flags, letters...)))
+	}
+}
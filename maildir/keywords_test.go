@@ -0,0 +1,213 @@
+package maildir
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/infodancer/msgstore"
+)
+
+// flagsOf returns the flags of the message uid in folder.
+func flagsOf(t *testing.T, store *MaildirStore, mailbox, folder, uid string) []string {
+	t.Helper()
+	list := func() ([]msgstore.MessageInfo, error) {
+		return store.ListInFolder(context.Background(), mailbox, folder)
+	}
+	if folder == "INBOX" {
+		list = func() ([]msgstore.MessageInfo, error) { return store.List(context.Background(), mailbox) }
+	}
+	msgs, err := list()
+	if err != nil {
+		t.Fatalf("ListInFolder(%s): %v", folder, err)
+	}
+	for _, m := range msgs {
+		if m.UID == uid {
+			return m.Flags
+		}
+	}
+	t.Fatalf("message %s not in %s", uid, folder)
+	return nil
+}
+
+func TestKeywords_Persisted(t *testing.T) {
+	basePath := t.TempDir()
+	store := NewStore(basePath, "", "")
+	ctx := context.Background()
+	mailbox := "user@example.com"
+
+	uid, err := store.AppendToFolder(ctx, mailbox, "INBOX", strings.NewReader("Subject: x\r\n\r\n"), []string{"\\Seen", "$Forwarded", "Junk"}, time.Now())
+	if err != nil {
+		t.Fatalf("AppendToFolder: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(basePath, "user", keywordsFile))
+	if err != nil || string(data) != "0 $Forwarded\n1 Junk\n" {
+		t.Fatalf("%s = %q, %v", keywordsFile, data, err)
+	}
+	if err := store.SetFlagsInFolder(ctx, mailbox, "INBOX", uid, msgstore.FlagModeAdd, []string{"$label1", "junk"}); err != nil {
+		t.Fatalf("SetFlagsInFolder: %v", err)
+	}
+	if err := store.SetFlagsInFolder(ctx, mailbox, "INBOX", uid, msgstore.FlagModeRemove, []string{"$Forwarded", "NeverSeen"}); err != nil {
+		t.Fatalf("SetFlagsInFolder: %v", err)
+	}
+
+	// A fresh store, as after a restart, reads the same mapping.
+	fresh := NewStore(basePath, "", "")
+	flags := flagsOf(t, fresh, mailbox, "INBOX", uid)
+	slices.Sort(flags)
+	if want := []string{"$label1", "Junk", "\\Seen"}; !slices.Equal(flags, want) {
+		t.Errorf("flags = %v, want %v", flags, want)
+	}
+	data, _ = os.ReadFile(filepath.Join(basePath, "user", keywordsFile))
+	if strings.Contains(string(data), "NeverSeen") {
+		t.Errorf("removing an unknown keyword added it: %q", data)
+	}
+}
+
+func TestKeywords_ExistingDovecotFile(t *testing.T) {
+	basePath := t.TempDir()
+	store := NewStore(basePath, "", "")
+	ctx := context.Background()
+	mailbox := "user@example.com"
+	path := filepath.Join(basePath, "user")
+	if _, err := store.ensureMaildir(mailbox); err != nil {
+		t.Fatalf("ensureMaildir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(path, keywordsFile), []byte("0 $Junk\n3 Work\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(path, "cur", "1700000000.M1P1Q1.host:2,Sad"), []byte("Subject: x\r\n\r\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	flags := flagsOf(t, store, mailbox, "INBOX", "1700000000.M1P1Q1.host")
+	slices.Sort(flags)
+	if want := []string{"$Junk", "Work", "\\Seen"}; !slices.Equal(flags, want) {
+		t.Errorf("flags = %v, want %v", flags, want)
+	}
+
+	// A new keyword takes the first free letter.
+	uid, err := store.AppendToFolder(ctx, mailbox, "INBOX", strings.NewReader("Subject: y\r\n\r\n"), []string{"Later"}, time.Now())
+	if err != nil {
+		t.Fatalf("AppendToFolder: %v", err)
+	}
+	if !strings.HasSuffix(messageFile(t, path, uid), ":2,b") {
+		t.Errorf("file %s, want the letter b", messageFile(t, path, uid))
+	}
+}
+
+// messageFile returns the name of message uid in cur/ of the maildir path.
+func messageFile(t *testing.T, path, uid string) string {
+	t.Helper()
+	msg, err := messageByKey(OSFS{}, path, uid)
+	if err != nil {
+		t.Fatalf("messageByKey: %v", err)
+	}
+	return filepath.Base(msg.filename)
+}
+
+func TestKeywords_ConcurrentAdditions(t *testing.T) {
+	basePath := t.TempDir()
+	ctx := context.Background()
+	mailbox := "user@example.com"
+	if _, err := NewStore(basePath, "", "").ensureMaildir(mailbox); err != nil {
+		t.Fatalf("ensureMaildir: %v", err)
+	}
+
+	// Separate stores stand in for separate processes.
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Go(func() {
+			store := NewStore(basePath, "", "")
+			kw := fmt.Sprintf("kw%d", i)
+			if _, err := store.AppendToFolder(ctx, mailbox, "INBOX", strings.NewReader("Subject: x\r\n\r\n"), []string{kw}, time.Now()); err != nil {
+				t.Errorf("AppendToFolder(%s): %v", kw, err)
+			}
+		})
+	}
+	wg.Wait()
+
+	msgs, err := NewStore(basePath, "", "").List(ctx, mailbox)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	seen := make(map[string]bool)
+	for _, m := range msgs {
+		if len(m.Flags) != 1 {
+			t.Errorf("message %s has flags %v, want one keyword", m.UID, m.Flags)
+			continue
+		}
+		seen[m.Flags[0]] = true
+	}
+	if len(seen) != 8 {
+		t.Errorf("keywords seen = %v, want 8 distinct", seen)
+	}
+}
+
+func TestKeywords_CarriedAcrossFolders(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+	mailbox := "user@example.com"
+	for _, folder := range []string{"Archive", "Other"} {
+		if err := store.CreateFolder(ctx, mailbox, folder); err != nil {
+			t.Fatalf("CreateFolder: %v", err)
+		}
+	}
+	// Archive already uses the letter a for another keyword.
+	if _, err := store.AppendToFolder(ctx, mailbox, "Archive", strings.NewReader("Subject: a\r\n\r\n"), []string{"Old"}, time.Now()); err != nil {
+		t.Fatalf("AppendToFolder: %v", err)
+	}
+	uid, err := store.AppendToFolder(ctx, mailbox, "INBOX", strings.NewReader("Subject: x\r\n\r\n"), []string{"Important", "\\Flagged"}, time.Now())
+	if err != nil {
+		t.Fatalf("AppendToFolder: %v", err)
+	}
+
+	copied, err := store.CopyMessage(ctx, mailbox, "INBOX", uid, "Archive")
+	if err != nil {
+		t.Fatalf("CopyMessage: %v", err)
+	}
+	if flags := flagsOf(t, store, mailbox, "Archive", copied); !slices.Contains(flags, "Important") || slices.Contains(flags, "Old") {
+		t.Errorf("copied flags = %v", flags)
+	}
+
+	moved, err := store.MoveMessages(ctx, mailbox, "INBOX", []string{uid}, "Archive")
+	if err != nil || len(moved) != 1 {
+		t.Fatalf("MoveMessages = %v, %v", moved, err)
+	}
+	if flags := flagsOf(t, store, mailbox, "Archive", moved[uid]); !slices.Contains(flags, "Important") || !slices.Contains(flags, "\\Flagged") || slices.Contains(flags, "Old") {
+		t.Errorf("moved flags = %v", flags)
+	}
+
+	bulk, err := store.CopyMessages(ctx, mailbox, "Archive", []string{moved[uid]}, "Other")
+	if err != nil || len(bulk) != 1 {
+		t.Fatalf("CopyMessages = %v, %v", bulk, err)
+	}
+	if flags := flagsOf(t, store, mailbox, "Other", bulk[moved[uid]]); !slices.Equal(flags, []string{"\\Flagged", "Important"}) {
+		t.Errorf("bulk copied flags = %v", flags)
+	}
+}
+
+func TestLockKeywords_BreaksStaleLock(t *testing.T) {
+	path := t.TempDir()
+	lock := filepath.Join(path, keywordsLockFile)
+	if err := os.WriteFile(lock, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * dotLockStale)
+	if err := os.Chtimes(lock, old, old); err != nil {
+		t.Fatal(err)
+	}
+	unlock, err := lockKeywords(OSFS{}, path)
+	if err != nil {
+		t.Fatalf("lockKeywords: %v", err)
+	}
+	unlock()
+	if _, err := os.Stat(lock); !os.IsNotExist(err) {
+		t.Errorf("lock file left after unlock: %v", err)
+	}
+}
@@ -0,0 +1,93 @@
+package maildir
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+// folderDir resolves the inbox (folder "" or "INBOX") or a folder to its
+// maildir path and soft-delete tracking key. The inbox is created on first
+// use, like List; a missing folder returns ErrFolderNotFound.
+func (s *MaildirStore) folderDir(mailbox, folder string) (path, deletionKey string, err error) {
+	if folder == "" || strings.EqualFold(folder, "INBOX") {
+		path, err := s.mailboxPath(mailbox)
+		if err != nil {
+			return "", "", err
+		}
+		if _, err := s.ensureMaildir(mailbox); err != nil {
+			return "", "", err
+		}
+		return path, mailbox, nil
+	}
+
+	path, err = s.folderPath(mailbox, folder)
+	if err != nil {
+		return "", "", err
+	}
+	if _, err := s.fs.Stat(filepath.Join(path, "cur")); os.IsNotExist(err) {
+		return "", "", errors.ErrFolderNotFound
+	}
+	return path, folderDeletionKey(mailbox, folder), nil
+}
+
+// listFolder lists the inbox or a folder for session, keeping only messages
+// accepted by match (all if nil). It also returns the maildir path.
+func (s *MaildirStore) listFolder(mailbox, folder, session string, match func(msgstore.MessageInfo) bool) ([]msgstore.MessageInfo, string, error) {
+	path, deletionKey, err := s.folderDir(mailbox, folder)
+	if err != nil {
+		return nil, "", err
+	}
+	messages, err := s.listDir(path, deletionKey, session, match)
+	return messages, path, err
+}
+
+// ListWithOptions implements msgstore.MessageLister.
+func (s *MaildirStore) ListWithOptions(ctx context.Context, mailbox string, folder string, opts ...msgstore.ListOption) ([]msgstore.MessageInfo, error) {
+	var o msgstore.ListOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	messages, path, err := s.listFolder(mailbox, folder, o.Session, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if o.HeaderSummary {
+		var indexed map[string]headerSummary
+		if s.index != nil {
+			uids := make([]string, len(messages))
+			for i, m := range messages {
+				uids[i] = m.UID
+			}
+			indexed = s.index.summaries(s.fs, path, uids, func(uid string) headerSummary {
+				return s.headerSummaryFor(path, uid)
+			})
+		}
+		for i := range messages {
+			summary, ok := indexed[messages[i].UID]
+			if !ok {
+				summary = s.headerSummaryFor(path, messages[i].UID)
+			}
+			messages[i].From = summary.from
+			messages[i].Subject = summary.subject
+			messages[i].Date = summary.date
+			messages[i].MessageID = summary.messageID
+		}
+	}
+	return messages, nil
+}
+
+// ListWithFilter implements msgstore.MessageLister.
+func (s *MaildirStore) ListWithFilter(ctx context.Context, mailbox string, folder string, filter msgstore.ListFilter) ([]msgstore.MessageInfo, error) {
+	messages, _, err := s.listFolder(mailbox, folder, "", filter.Matches)
+	return messages, err
+}
+
+// Compile-time interface verification.
+var _ msgstore.MessageLister = (*MaildirStore)(nil)
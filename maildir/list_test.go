@@ -0,0 +1,49 @@
+package maildir
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+func TestMaildirStore_ListWithFilter(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+	mailbox := "user@example.com"
+
+	for _, body := range []string{"short", strings.Repeat("x", 500)} {
+		deliverTestMessage(t, store, "Subject: s\r\n\r\n"+body)
+	}
+	msgs, err := store.List(ctx, mailbox)
+	if err != nil || len(msgs) != 2 {
+		t.Fatalf("List = %d messages, %v", len(msgs), err)
+	}
+	small := msgs[0]
+	if small.Size > msgs[1].Size {
+		small = msgs[1]
+	}
+	if err := store.SetFlagsInFolder(ctx, mailbox, "INBOX", small.UID, msgstore.FlagModeSet, []string{"\\Seen"}); err != nil {
+		t.Fatalf("SetFlagsInFolder failed: %v", err)
+	}
+
+	unseen, err := store.ListWithFilter(ctx, mailbox, "INBOX", msgstore.ListFilter{LacksFlags: []string{"\\Seen"}})
+	if err != nil {
+		t.Fatalf("ListWithFilter failed: %v", err)
+	}
+	if len(unseen) != 1 || unseen[0].UID == small.UID {
+		t.Errorf("unseen = %+v, want only the large message", unseen)
+	}
+
+	large, err := store.ListWithFilter(ctx, mailbox, "", msgstore.ListFilter{MinSize: 200, Since: time.Now().Add(-time.Hour)})
+	if err != nil || len(large) != 1 || large[0].UID == small.UID {
+		t.Errorf("large = %+v, %v", large, err)
+	}
+
+	if _, err := store.ListWithFilter(ctx, mailbox, "Nowhere", msgstore.ListFilter{}); err != errors.ErrFolderNotFound {
+		t.Errorf("expected ErrFolderNotFound, got %v", err)
+	}
+}
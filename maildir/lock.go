@@ -0,0 +1,46 @@
+package maildir
+
+import (
+	"context"
+	"sync"
+
+	"github.com/infodancer/msgstore"
+)
+
+// mailboxUnlocker releases a lock taken with LockMailbox.
+type mailboxUnlocker struct {
+	once   sync.Once
+	unlock func()
+}
+
+// Unlock implements msgstore.Unlocker.
+func (u *mailboxUnlocker) Unlock() error {
+	u.once.Do(u.unlock)
+	return nil
+}
+
+// LockMailbox implements msgstore.MailboxLocker.
+//
+// The lock is the one every operation of this store takes, so it quiesces
+// the mailbox for callers sharing the store, such as the admin API and the
+// session server. It does not reach stores opened by other processes.
+// Operations from the goroutine holding the lock would deadlock until it is
+// released.
+func (s *MaildirStore) LockMailbox(ctx context.Context, mailbox string) (msgstore.Unlocker, error) {
+	if _, err := s.mailboxRootPath(mailbox); err != nil {
+		return nil, err
+	}
+	acquired := make(chan func(), 1)
+	go func() { acquired <- s.lockMailbox(mailbox) }()
+	select {
+	case unlock := <-acquired:
+		return &mailboxUnlocker{unlock: unlock}, nil
+	case <-ctx.Done():
+		// Release the lock once the abandoned attempt gets it.
+		go func() { (<-acquired)() }()
+		return nil, ctx.Err()
+	}
+}
+
+// Compile-time interface verification.
+var _ msgstore.MailboxLocker = (*MaildirStore)(nil)
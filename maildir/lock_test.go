@@ -0,0 +1,57 @@
+package maildir
+
+import (
+	"context"
+	stderrors "errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/infodancer/msgstore"
+)
+
+func TestMaildirStore_LockMailbox(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+	mailbox := "user@example.com"
+
+	lock, err := store.LockMailbox(ctx, mailbox)
+	if err != nil {
+		t.Fatalf("LockMailbox: %v", err)
+	}
+
+	delivered := make(chan error, 1)
+	go func() {
+		envelope := msgstore.Envelope{Recipients: []string{mailbox}}
+		delivered <- store.Deliver(ctx, envelope, strings.NewReader("Subject: x\r\n\r\n"))
+	}()
+	select {
+	case err := <-delivered:
+		t.Fatalf("Deliver finished while the mailbox was locked: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// A second locker gives up when its context ends.
+	short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := store.LockMailbox(short, mailbox); !stderrors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("contended LockMailbox error = %v, want DeadlineExceeded", err)
+	}
+
+	if err := lock.Unlock(); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	if err := lock.Unlock(); err != nil {
+		t.Fatalf("second Unlock: %v", err)
+	}
+	if err := <-delivered; err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+
+	// The abandoned attempt released the lock again.
+	lock, err = store.LockMailbox(ctx, mailbox)
+	if err != nil {
+		t.Fatalf("LockMailbox after release: %v", err)
+	}
+	_ = lock.Unlock()
+}
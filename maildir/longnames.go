@@ -0,0 +1,62 @@
+package maildir
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// maxNameLen is the longest path component the store creates: NAME_MAX
+	// on common Unix filesystems.
+	maxNameLen = 255
+
+	// nameHashLen is the number of hex digits of the hash that replaces
+	// the tail of an overlong component.
+	nameHashLen = 16
+)
+
+// shortenComponents returns path with each component longer than
+// maxNameLen bytes truncated and suffixed with "~" and a hash of the whole
+// component. The result is deterministic, so an overlong local part always
+// maps to the same directory, and distinct components sharing a prefix stay
+// distinct. Truncation never splits a UTF-8 sequence.
+func shortenComponents(path string) string {
+	if len(path) <= maxNameLen {
+		return path
+	}
+	components := strings.Split(path, "/")
+	for i, c := range components {
+		components[i] = shortenName(c)
+	}
+	return strings.Join(components, "/")
+}
+
+// shortenName shortens one path component as described for
+// shortenComponents.
+func shortenName(name string) string {
+	if len(name) <= maxNameLen {
+		return name
+	}
+	sum := sha256.Sum256([]byte(name))
+	cut := maxNameLen - 1 - nameHashLen
+	for cut > 0 && !utf8.RuneStart(name[cut]) {
+		cut--
+	}
+	return name[:cut] + "~" + hex.EncodeToString(sum[:])[:nameHashLen]
+}
+
+// isShortened reports whether name looks like the output of shortenName
+// for an overlong component, whose original cannot be recovered.
+func isShortened(name string) bool {
+	if len(name) < maxNameLen-utf8.UTFMax || len(name) > maxNameLen {
+		return false
+	}
+	tail := name[len(name)-nameHashLen-1:]
+	if tail[0] != '~' {
+		return false
+	}
+	_, err := hex.DecodeString(tail[1:])
+	return err == nil
+}
@@ -0,0 +1,86 @@
+package maildir
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/infodancer/msgstore"
+)
+
+func TestShortenName(t *testing.T) {
+	long := strings.Repeat("a", 300)
+	got := shortenName(long)
+	if len(got) > maxNameLen {
+		t.Errorf("len(shortenName) = %d, want <= %d", len(got), maxNameLen)
+	}
+	if got != shortenName(long) {
+		t.Error("shortenName is not deterministic")
+	}
+	if other := shortenName(long[:299] + "b"); other == got {
+		t.Error("names sharing a long prefix collide")
+	}
+	if !isShortened(got) || isShortened(long[:maxNameLen]) {
+		t.Error("isShortened does not recognise shortened names")
+	}
+	if short := strings.Repeat("a", maxNameLen); shortenName(short) != short {
+		t.Error("name of exactly maxNameLen bytes was changed")
+	}
+
+	// A 3-byte rune straddling the cut must not be split.
+	multibyte := strings.Repeat("€", 100)
+	if got := shortenName(multibyte); !strings.HasPrefix(got, strings.Repeat("€", 79)+"~") {
+		t.Errorf("shortenName(multibyte) = %q", got)
+	}
+}
+
+func TestMaildirStore_LongLocalparts(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+	}{
+		{name: "default"},
+		{name: "deep template", template: "{domain}/{hash}/{localpart}/{email}/mail"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			basePath := t.TempDir()
+			store := NewStore(basePath, "", tt.template)
+			ctx := context.Background()
+
+			alice := strings.Repeat("a", 300) + "@example.com"
+			bob := strings.Repeat("a", 299) + "b@example.com"
+			envelope := msgstore.Envelope{Recipients: []string{alice, bob}, ReceivedTime: time.Now()}
+			if err := store.Deliver(ctx, envelope, strings.NewReader("Subject: hi\r\n\r\n")); err != nil {
+				t.Fatalf("Deliver: %v", err)
+			}
+			for _, mailbox := range []string{alice, bob} {
+				if msgs, err := store.List(ctx, mailbox); err != nil || len(msgs) != 1 {
+					t.Errorf("List(%.8s...) = %d messages, %v; want 1", mailbox, len(msgs), err)
+				}
+			}
+
+			if tt.template != "" {
+				if got, err := store.ListMailboxesByDomain(ctx, "example.com"); err != nil || len(got) != 0 {
+					t.Errorf("ListMailboxesByDomain = %v, %v; want no mailboxes", got, err)
+				}
+			}
+
+			err := filepath.WalkDir(basePath, func(path string, d os.DirEntry, err error) error {
+				if err != nil {
+					return err
+				}
+				if len(d.Name()) > maxNameLen {
+					t.Errorf("%s: component of %d bytes", path, len(d.Name()))
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatalf("walk: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,253 @@
+package maildir
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+// defaultArchiveRoot is the archive folder prefix used when
+// ArchivePolicy.Root is empty.
+const defaultArchiveRoot = "Archive"
+
+// ArchivePolicy moves messages out of a folder into one archive folder per
+// year of their internal date (e.g., "Archive.2024" with the default
+// delimiter). Archive folders are created on demand.
+type ArchivePolicy struct {
+	// Folder is the folder to archive from; "" or "INBOX" for the inbox.
+	Folder string
+
+	// Root is the parent name of the yearly folders; defaults to "Archive".
+	Root string
+
+	// MinAge is how old a message must be before it is archived. Zero
+	// archives every message, so new mail is routed on the next run.
+	MinAge time.Duration
+}
+
+// ExpungePolicy permanently removes messages from a folder once they are
+// older than MaxAge, or once the folder holds more than MaxMessages, oldest
+// first. A zero limit is not enforced. Messages marked for deletion count
+// toward both limits.
+type ExpungePolicy struct {
+	// Folder is the folder to expunge, e.g., "Junk" or "Trash".
+	Folder string
+
+	// MaxAge is how long a message is kept, by internal date.
+	MaxAge time.Duration
+
+	// MaxMessages is how many messages the folder keeps.
+	MaxMessages int
+}
+
+// Maintain implements msgstore.Maintainer.
+// Expunged messages past their grace period are removed and due snoozed
+// messages are woken first, then archive and expunge policies run in that
+// order.
+func (s *MaildirStore) Maintain(ctx context.Context, mailbox string) error {
+	now := time.Now()
+	if err := s.purgeExpunged(mailbox, now); err != nil {
+		return err
+	}
+	if err := s.wakeSnoozed(ctx, mailbox, now); err != nil {
+		return err
+	}
+	for _, p := range s.archivePolicies {
+		if err := s.archive(ctx, mailbox, p, now); err != nil {
+			return err
+		}
+	}
+	for _, p := range s.expungePolicies {
+		if err := s.autoExpunge(ctx, mailbox, p, now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RunMaintenance delivers due scheduled messages, purges expired
+// greylisting triplets, collects garbage (except with a mailbox resolver)
+// and calls Maintain for every mailbox returned by mailboxes, once per
+// interval, until ctx is done.
+// Failures are logged and do not stop the worker.
+func (s *MaildirStore) RunMaintenance(ctx context.Context, interval time.Duration, mailboxes func(context.Context) ([]string, error)) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := s.DeliverDue(ctx); err != nil {
+			slog.Error("maintenance: delivering scheduled messages", "error", err)
+		}
+		if err := s.PurgeGreylist(ctx); err != nil {
+			slog.Error("maintenance: purging greylist", "error", err)
+		}
+		if s.resolver == nil {
+			report, err := s.CollectGarbage(ctx)
+			if err != nil {
+				slog.Error("maintenance: collecting garbage", "error", err)
+			}
+			if report.Mailboxes > 0 || report.Folders > 0 {
+				slog.Info("maintenance: collected garbage",
+					"mailboxes", report.Mailboxes, "folders", report.Folders, "bytes", report.Bytes)
+			}
+		}
+		names, err := mailboxes(ctx)
+		if err != nil {
+			slog.Error("maintenance: listing mailboxes", "error", err)
+		}
+		for _, mailbox := range names {
+			if ctx.Err() != nil {
+				return
+			}
+			if err := s.Maintain(ctx, mailbox); err != nil {
+				slog.Error("maintenance failed", "mailbox", mailbox, "error", err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// archive applies p to mailbox, archiving messages received before
+// now-p.MinAge. A missing source folder is skipped.
+func (s *MaildirStore) archive(ctx context.Context, mailbox string, p ArchivePolicy, now time.Time) error {
+	if p.Folder == "" {
+		p.Folder = "INBOX"
+	}
+	messages, _, err := s.listFolder(mailbox, p.Folder, "", nil)
+	if err == errors.ErrFolderNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	cutoff := now.Add(-p.MinAge)
+	byYear := make(map[int][]string)
+	for _, m := range messages {
+		if m.InternalDate.After(cutoff) {
+			continue
+		}
+		year := m.InternalDate.Year()
+		byYear[year] = append(byYear[year], m.UID)
+	}
+	years := make([]int, 0, len(byYear))
+	for year := range byYear {
+		years = append(years, year)
+	}
+	sort.Ints(years)
+
+	root := p.Root
+	if root == "" {
+		root = defaultArchiveRoot
+	}
+	for _, year := range years {
+		folder := root + s.delimiter + strconv.Itoa(year)
+		if err := s.CreateFolder(ctx, mailbox, folder); err != nil && err != errors.ErrFolderExists {
+			return err
+		}
+		if _, err := s.MoveMessages(ctx, mailbox, p.Folder, byYear[year], folder); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// autoExpunge applies p to mailbox. Removals are audited and reported to
+// expunge hooks like client expunges. A missing folder is skipped.
+func (s *MaildirStore) autoExpunge(ctx context.Context, mailbox string, p ExpungePolicy, now time.Time) error {
+	folder := p.Folder
+	if strings.EqualFold(folder, "INBOX") {
+		folder = ""
+	}
+	// Listing delivers new mail into cur/ first, so that it counts.
+	_, path, err := s.listFolder(mailbox, folder, "", nil)
+	if err == errors.ErrFolderNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	messages, err := messageDates(s.fs, path)
+	if err != nil {
+		return err
+	}
+
+	selected := make(map[string]bool)
+	if p.MaxAge > 0 {
+		cutoff := now.Add(-p.MaxAge)
+		for _, m := range messages {
+			if m.date.Before(cutoff) {
+				selected[m.uid] = true
+			}
+		}
+	}
+	if p.MaxMessages > 0 && len(messages) > p.MaxMessages {
+		for _, m := range messages[:len(messages)-p.MaxMessages] {
+			selected[m.uid] = true
+		}
+	}
+	if len(selected) == 0 {
+		return nil
+	}
+
+	removed, err := s.purge(mailbox, path, s.deletionKeyFor(mailbox, folder), selected)
+	s.auditExpunge(ctx, mailbox, folder, removed, err)
+	s.hooks.expunge(ctx, mailbox, folder, removed)
+	return err
+}
+
+// datedMessage is a message UID with its internal date.
+type datedMessage struct {
+	uid  string
+	date time.Time
+}
+
+// messageDates returns every message in cur/ of the maildir at path,
+// including those marked for deletion, oldest first.
+func messageDates(fsys FS, path string) ([]datedMessage, error) {
+	msgs, err := curMessages(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	dated := make([]datedMessage, 0, len(msgs))
+	for _, msg := range msgs {
+		_, date, err := messageAttrs(fsys, msg.filename)
+		if err != nil {
+			continue // removed concurrently
+		}
+		dated = append(dated, datedMessage{uid: msg.key, date: date})
+	}
+	sort.SliceStable(dated, func(i, j int) bool { return dated[i].date.Before(dated[j].date) })
+	return dated, nil
+}
+
+// purge permanently removes uids from the maildir at path, whether or not
+// they are marked for deletion, holding the mailbox lock.
+func (s *MaildirStore) purge(mailbox, path, key string, uids map[string]bool) ([]string, error) {
+	defer s.lockMailbox(mailbox)()
+	s.statusCache.invalidate(key)
+
+	removed, err := s.removeMessages(mailbox, path, uids)
+	s.deletedMu.Lock()
+	for _, uid := range removed {
+		delete(s.deleted[key], uid)
+	}
+	if len(s.deleted[key]) == 0 {
+		delete(s.deleted, key)
+	}
+	s.deletedMu.Unlock()
+	s.recent.forget(s.fs, path, removed)
+	return removed, err
+}
+
+// Compile-time interface verification.
+var _ msgstore.Maintainer = (*MaildirStore)(nil)
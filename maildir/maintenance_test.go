@@ -0,0 +1,141 @@
+package maildir
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/infodancer/msgstore"
+)
+
+func TestMaildirStore_Maintain_Archive(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "", WithArchivePolicy(ArchivePolicy{Folder: "INBOX", MinAge: 30 * 24 * time.Hour}))
+	ctx := context.Background()
+	mailbox := "user@example.com"
+
+	uids, err := store.AppendMultiple(ctx, mailbox, "INBOX", []msgstore.AppendItem{
+		{Message: strings.NewReader("Subject: a\r\n\r\na"), Date: time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{Message: strings.NewReader("Subject: b\r\n\r\nb"), Date: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)},
+		{Message: strings.NewReader("Subject: c\r\n\r\nc"), Date: time.Now()},
+	})
+	if err != nil {
+		t.Fatalf("AppendMultiple: %v", err)
+	}
+
+	if err := store.Maintain(ctx, mailbox); err != nil {
+		t.Fatalf("Maintain: %v", err)
+	}
+
+	for folder, want := range map[string]string{"Archive.2023": uids[0], "Archive.2024": uids[1]} {
+		msgs, err := store.ListInFolder(ctx, mailbox, folder)
+		if err != nil {
+			t.Fatalf("ListInFolder %s: %v", folder, err)
+		}
+		if len(msgs) != 1 || msgs[0].UID != want {
+			t.Errorf("%s = %v, want %s", folder, msgs, want)
+		}
+	}
+	inbox, err := store.List(ctx, mailbox)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(inbox) != 1 || inbox[0].UID != uids[2] {
+		t.Errorf("INBOX = %v, want only the recent message", inbox)
+	}
+
+	// A second run finds nothing to do.
+	if err := store.Maintain(ctx, mailbox); err != nil {
+		t.Fatalf("second Maintain: %v", err)
+	}
+}
+
+func TestMaildirStore_RunMaintenance(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "", WithArchivePolicy(ArchivePolicy{Root: "Old"}))
+	ctx, cancel := context.WithCancel(context.Background())
+	mailbox := "user@example.com"
+
+	if _, err := store.AppendMultiple(ctx, mailbox, "INBOX", []msgstore.AppendItem{
+		{Message: strings.NewReader("Subject: a\r\n\r\na"), Date: time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)},
+	}); err != nil {
+		t.Fatalf("AppendMultiple: %v", err)
+	}
+
+	// The worker runs immediately, then once per tick; stop it on its
+	// second pass.
+	runs := 0
+	store.RunMaintenance(ctx, time.Millisecond, func(context.Context) ([]string, error) {
+		if runs++; runs > 1 {
+			cancel()
+		}
+		return []string{mailbox}, nil
+	})
+
+	msgs, err := store.ListInFolder(context.Background(), mailbox, "Old.2022")
+	if err != nil || len(msgs) != 1 {
+		t.Errorf("Old.2022 = %v, %v; want the archived message", msgs, err)
+	}
+}
+
+func TestMaildirStore_Maintain_Expunge(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "",
+		WithExpungePolicy(ExpungePolicy{Folder: "Trash", MaxAge: 7 * 24 * time.Hour}),
+		WithExpungePolicy(ExpungePolicy{Folder: "Junk", MaxMessages: 2}))
+	ctx := context.Background()
+	mailbox := "user@example.com"
+	now := time.Now()
+
+	var expunged []string
+	store.OnExpunge(func(ctx context.Context, info ExpungeInfo) {
+		expunged = append(expunged, info.Folder)
+	})
+
+	trash, err := store.AppendMultiple(ctx, mailbox, "Trash", []msgstore.AppendItem{
+		{Message: strings.NewReader("Subject: old\r\n\r\n"), Date: now.Add(-10 * 24 * time.Hour)},
+		{Message: strings.NewReader("Subject: new\r\n\r\n"), Date: now.Add(-time.Hour)},
+	})
+	if err != nil {
+		t.Fatalf("AppendMultiple Trash: %v", err)
+	}
+	junk, err := store.AppendMultiple(ctx, mailbox, "Junk", []msgstore.AppendItem{
+		{Message: strings.NewReader("Subject: 1\r\n\r\n"), Date: now.Add(-3 * time.Hour)},
+		{Message: strings.NewReader("Subject: 2\r\n\r\n"), Date: now.Add(-2 * time.Hour)},
+		{Message: strings.NewReader("Subject: 3\r\n\r\n"), Date: now.Add(-time.Hour)},
+	})
+	if err != nil {
+		t.Fatalf("AppendMultiple Junk: %v", err)
+	}
+	if err := store.DeleteInFolder(ctx, mailbox, "Junk", junk[0]); err != nil {
+		t.Fatalf("DeleteInFolder: %v", err)
+	}
+
+	if err := store.Maintain(ctx, mailbox); err != nil {
+		t.Fatalf("Maintain: %v", err)
+	}
+
+	for folder, want := range map[string][]string{"Trash": trash[1:], "Junk": junk[1:]} {
+		msgs, err := store.ListInFolder(ctx, mailbox, folder)
+		if err != nil {
+			t.Fatalf("ListInFolder %s: %v", folder, err)
+		}
+		got := make([]string, 0, len(msgs))
+		for _, m := range msgs {
+			got = append(got, m.UID)
+		}
+		sort.Strings(got)
+		sort.Strings(want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %v, want %v", folder, got, want)
+		}
+	}
+	if len(expunged) != 2 {
+		t.Errorf("expunge hooks = %v, want Trash and Junk", expunged)
+	}
+	store.deletedMu.Lock()
+	defer store.deletedMu.Unlock()
+	if len(store.deleted) != 0 {
+		t.Errorf("deletion marks left: %v", store.deleted)
+	}
+}
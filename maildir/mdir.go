@@ -0,0 +1,261 @@
+package maildir
+
+import (
+	stderrors "errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-maildir"
+	"github.com/infodancer/msgstore/errors"
+)
+
+// Low-level maildir operations (https://cr.yp.to/proto/maildir.html),
+// performed through an FS. A message is delivered to tmp/ and renamed into
+// new/; listing moves it on to cur/, where its file name carries its flags
+// after the ":2," info separator.
+
+// message is a message file in a maildir's cur/.
+type message struct {
+	filename string
+	key      string
+	flags    []maildir.Flag
+}
+
+// parseMessage parses the name of a file in cur/ of the maildir dir.
+func parseMessage(dir, name string) (*message, error) {
+	key, info, ok := strings.Cut(name, ":")
+	if !ok || key == "" || !strings.HasPrefix(info, "2,") {
+		return nil, &fs.PathError{Op: "parse", Path: filepath.Join(dir, name), Err: fs.ErrInvalid}
+	}
+	return &message{
+		filename: filepath.Join(dir, name),
+		key:      key,
+		flags:    []maildir.Flag(strings.TrimPrefix(info, "2,")),
+	}, nil
+}
+
+// unseenMessages moves the messages in new/ to cur/ and returns them.
+func unseenMessages(fsys FS, path string) ([]*message, error) {
+	entries, err := fsys.ReadDir(filepath.Join(path, "new"))
+	if err != nil {
+		return nil, err
+	}
+	cur := filepath.Join(path, "cur")
+	var msgs []*message
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		// Messages in new/ should have no info, but some clients add one;
+		// it is discarded.
+		key, _, _ := strings.Cut(e.Name(), ":")
+		name := key + ":2,"
+		if err := fsys.Rename(filepath.Join(path, "new", e.Name()), filepath.Join(cur, name)); err != nil {
+			return msgs, err
+		}
+		msgs = append(msgs, &message{filename: filepath.Join(cur, name), key: key})
+	}
+	return msgs, nil
+}
+
+// curMessages returns the messages in cur/. Malformed file names are
+// reported in the error, after the well-formed messages are collected.
+func curMessages(fsys FS, path string) ([]*message, error) {
+	cur := filepath.Join(path, "cur")
+	entries, err := fsys.ReadDir(cur)
+	if err != nil {
+		return nil, err
+	}
+	var msgs []*message
+	var formatErrs []error
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		msg, err := parseMessage(cur, e.Name())
+		if err != nil {
+			formatErrs = append(formatErrs, err)
+			continue
+		}
+		msgs = append(msgs, msg)
+	}
+	return msgs, stderrors.Join(formatErrs...)
+}
+
+// messageByKey finds the message with key in cur/.
+func messageByKey(fsys FS, path string, key string) (*message, error) {
+	cur := filepath.Join(path, "cur")
+	// Most messages have no flags or are only seen; try those before
+	// reading the directory.
+	for _, name := range []string{key + ":2,", key + ":2,S"} {
+		if _, err := fsys.Stat(filepath.Join(cur, name)); err == nil {
+			return parseMessage(cur, name)
+		}
+	}
+	entries, err := fsys.ReadDir(cur)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), key+":") {
+			return parseMessage(cur, e.Name())
+		}
+	}
+	return nil, errors.ErrMessageNotFound
+}
+
+// setFlags renames msg to record flags.
+func (msg *message) setFlags(fsys FS, flags []maildir.Flag) error {
+	filename := filepath.Join(filepath.Dir(msg.filename), msg.key+":"+infoFromFlags(flags))
+	if err := fsys.Rename(msg.filename, filename); err != nil {
+		return err
+	}
+	parsed, err := parseMessage(filepath.Split(filename))
+	if err != nil {
+		return err
+	}
+	*msg = *parsed
+	return nil
+}
+
+// copyTo copies msg into cur/ of the maildir destPath under a new key,
+// keeping its flags and internal date. prepare, if not nil, is applied to
+// the copy before it is moved into place.
+func (msg *message) copyTo(fsys FS, destPath string, prepare func(name string) error) (*message, error) {
+	_, date, err := messageAttrs(fsys, msg.filename)
+	if err != nil {
+		return nil, err
+	}
+	src, err := fsys.Open(msg.filename)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = src.Close() }()
+
+	d, err := newDelivery(fsys, destPath, date)
+	if err != nil {
+		return nil, err
+	}
+	d.prepare = prepare
+	if _, err := io.Copy(d, src); err != nil {
+		_ = d.abort()
+		return nil, err
+	}
+	if err := d.closeToCur(msg.flags); err != nil {
+		return nil, err
+	}
+	return parseMessage(filepath.Join(destPath, "cur"), d.key+":"+infoFromFlags(msg.flags))
+}
+
+// delivery is a message being written to a maildir's tmp/. Close moves it
+// to new/, making it visible; abort discards it.
+type delivery struct {
+	fsys FS
+	file File
+	path string
+	name Filename
+	size int64
+
+	// dated is set when the internal date was given rather than taken
+	// from the clock; the file's modification time is then set to match.
+	dated bool
+
+	// durable makes finishing the delivery sync the message file and the
+	// directory it is renamed into.
+	durable bool
+
+	// prepare, if set, is applied to the message file before it is moved
+	// into place, to give it its mode and owner.
+	prepare func(name string) error
+
+	// key is the message's key, set once the delivery is closed. It carries
+	// the size of the message as an S= attribute.
+	key string
+}
+
+// newDelivery starts a delivery to the maildir path under a new name.
+// A non-zero date becomes the message's internal date; otherwise it is the
+// time of delivery.
+func newDelivery(fsys FS, path string, date time.Time) (*delivery, error) {
+	dated := !date.IsZero()
+	if !dated {
+		date = time.Now()
+	}
+	name, err := Formatter{}.New(date, -1)
+	if err != nil {
+		return nil, err
+	}
+	f, err := fsys.OpenFile(filepath.Join(path, "tmp", name.Key()), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0666)
+	if err != nil {
+		return nil, err
+	}
+	return &delivery{fsys: fsys, file: f, path: path, name: name, dated: dated}, nil
+}
+
+// Write implements io.Writer.
+func (d *delivery) Write(p []byte) (int, error) {
+	n, err := d.file.Write(p)
+	d.size += int64(n)
+	return n, err
+}
+
+// Close moves the message to new/.
+func (d *delivery) Close() error {
+	return d.finish("new", "")
+}
+
+// closeToCur moves the message to cur/ with flags, bypassing new/.
+func (d *delivery) closeToCur(flags []maildir.Flag) error {
+	return d.finish("cur", ":"+infoFromFlags(flags))
+}
+
+// finish names the message after its final size and moves it to the
+// subdirectory sub with info appended to its name.
+func (d *delivery) finish(sub, info string) error {
+	if d.durable {
+		if err := syncFile(d.file); err != nil {
+			_ = d.file.Close()
+			_ = d.fsys.Remove(d.file.Name())
+			return err
+		}
+	}
+	if err := d.file.Close(); err != nil {
+		_ = d.fsys.Remove(d.file.Name())
+		return err
+	}
+	d.name.Size = d.size
+	key := d.name.Key()
+	if d.dated {
+		if err := d.fsys.Chtimes(d.file.Name(), d.name.Time, d.name.Time); err != nil {
+			_ = d.fsys.Remove(d.file.Name())
+			return err
+		}
+	}
+	if d.prepare != nil {
+		if err := d.prepare(d.file.Name()); err != nil {
+			_ = d.fsys.Remove(d.file.Name())
+			return err
+		}
+	}
+	if err := d.fsys.Rename(d.file.Name(), filepath.Join(d.path, sub, key+info)); err != nil {
+		_ = d.fsys.Remove(d.file.Name())
+		return err
+	}
+	if d.durable {
+		if err := syncDir(d.fsys, filepath.Join(d.path, sub)); err != nil {
+			return err
+		}
+	}
+	d.key = key
+	return nil
+}
+
+// abort discards the message.
+func (d *delivery) abort() error {
+	_ = d.file.Close()
+	return d.fsys.Remove(d.file.Name())
+}
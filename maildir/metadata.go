@@ -0,0 +1,174 @@
+package maildir
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+const (
+	// mailboxMetadataFile holds mailbox-level annotations in the mailbox root.
+	mailboxMetadataFile = "mailbox-metadata.json"
+
+	// folderMetadataFile holds a folder's annotations inside its maildir, so
+	// they move with RenameFolder and disappear with DeleteFolder.
+	folderMetadataFile = "metadata.json"
+
+	// maxMetadataValue is the largest value accepted for one entry.
+	maxMetadataValue = 64 * 1024
+
+	// maxMetadataEntries is the most entries kept per mailbox or folder.
+	maxMetadataEntries = 1000
+)
+
+// validateMetadataEntry checks an RFC 5464 entry name: it must be below
+// /private or /shared, made of non-empty printable ASCII components, and
+// must not contain the LIST wildcards.
+func validateMetadataEntry(name string) error {
+	if !strings.HasPrefix(name, "/private/") && !strings.HasPrefix(name, "/shared/") {
+		return errors.ErrInvalidMetadataEntry
+	}
+	if strings.HasSuffix(name, "/") || strings.Contains(name, "//") || len(name) > 1024 {
+		return errors.ErrInvalidMetadataEntry
+	}
+	for _, r := range name {
+		if r < 0x21 || r > 0x7e || r == '*' || r == '%' {
+			return errors.ErrInvalidMetadataEntry
+		}
+	}
+	return nil
+}
+
+// metadataPath returns the sidecar file holding annotations for a folder,
+// or for the mailbox itself if folder is "".
+func (s *MaildirStore) metadataPath(mailbox, folder string) (string, error) {
+	if folder == "" {
+		root, err := s.mailboxRootPath(mailbox)
+		if err != nil {
+			return "", err
+		}
+		return filepath.Join(root, mailboxMetadataFile), nil
+	}
+	path, _, err := s.folderDir(mailbox, folder)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(path, folderMetadataFile), nil
+}
+
+// readSidecar loads a JSON sidecar file holding a string map; a missing file
+// means no entries.
+func readSidecar(fsys FS, path string) (map[string]string, error) {
+	data, err := fsys.ReadFile(path)
+	if os.IsNotExist(err) {
+		return make(map[string]string), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]string)
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// writeSidecar atomically replaces a sidecar file, removing it when no
+// entries are left.
+func writeSidecar(fsys FS, path string, entries map[string]string) error {
+	if len(entries) == 0 {
+		if err := fsys.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	if err := fsys.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp, err := fsys.CreateTemp(filepath.Dir(path), ".tmp-sidecar-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = fsys.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = fsys.Remove(tmp.Name())
+		return err
+	}
+	if err := fsys.Rename(tmp.Name(), path); err != nil {
+		_ = fsys.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// GetMetadata implements msgstore.MetadataStore.
+func (s *MaildirStore) GetMetadata(ctx context.Context, mailbox string, folder string, entries []string) (map[string]string, error) {
+	path, err := s.metadataPath(mailbox, folder)
+	if err != nil {
+		return nil, err
+	}
+	stored, err := readSidecar(s.fs, path)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return stored, nil
+	}
+	result := make(map[string]string)
+	for _, name := range entries {
+		if value, ok := stored[name]; ok {
+			result[name] = value
+		}
+	}
+	return result, nil
+}
+
+// SetMetadata implements msgstore.MetadataStore.
+func (s *MaildirStore) SetMetadata(ctx context.Context, mailbox string, folder string, entries map[string]string) error {
+	for name, value := range entries {
+		if err := validateMetadataEntry(name); err != nil {
+			return err
+		}
+		if len(value) > maxMetadataValue {
+			return errors.ErrMetadataTooLarge
+		}
+	}
+
+	path, err := s.metadataPath(mailbox, folder)
+	if err != nil {
+		return err
+	}
+	defer s.lockMailbox(mailbox)()
+
+	stored, err := readSidecar(s.fs, path)
+	if err != nil {
+		return err
+	}
+	for name, value := range entries {
+		if value == "" {
+			delete(stored, name)
+		} else {
+			stored[name] = value
+		}
+	}
+	if len(stored) > maxMetadataEntries {
+		return errors.ErrMetadataTooLarge
+	}
+	return writeSidecar(s.fs, path, stored)
+}
+
+// Compile-time interface verification.
+var _ msgstore.MetadataStore = (*MaildirStore)(nil)
@@ -0,0 +1,76 @@
+package maildir
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/infodancer/msgstore/errors"
+)
+
+func TestMaildirStore_Metadata(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+	mailbox := "user@example.com"
+	if err := store.CreateFolder(ctx, mailbox, "Work"); err != nil {
+		t.Fatalf("CreateFolder: %v", err)
+	}
+
+	if err := store.SetMetadata(ctx, mailbox, "", map[string]string{"/private/vendor/client/theme": "dark"}); err != nil {
+		t.Fatalf("SetMetadata mailbox: %v", err)
+	}
+	if err := store.SetMetadata(ctx, mailbox, "Work", map[string]string{
+		"/private/comment": "current projects",
+		"/shared/comment":  "team folder",
+	}); err != nil {
+		t.Fatalf("SetMetadata folder: %v", err)
+	}
+
+	// Mailbox, folder and inbox annotations are separate.
+	got, err := store.GetMetadata(ctx, mailbox, "", nil)
+	if err != nil {
+		t.Fatalf("GetMetadata mailbox: %v", err)
+	}
+	if want := map[string]string{"/private/vendor/client/theme": "dark"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("mailbox metadata = %v, want %v", got, want)
+	}
+	got, err = store.GetMetadata(ctx, mailbox, "Work", []string{"/private/comment", "/private/missing"})
+	if err != nil {
+		t.Fatalf("GetMetadata folder: %v", err)
+	}
+	if want := map[string]string{"/private/comment": "current projects"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("folder metadata = %v, want %v", got, want)
+	}
+	if got, err := store.GetMetadata(ctx, mailbox, "INBOX", nil); err != nil || len(got) != 0 {
+		t.Errorf("INBOX metadata = %v, %v; want empty", got, err)
+	}
+
+	// Annotations follow a renamed folder; an empty value removes an entry.
+	if err := store.RenameFolder(ctx, mailbox, "Work", "Projects"); err != nil {
+		t.Fatalf("RenameFolder: %v", err)
+	}
+	if err := store.SetMetadata(ctx, mailbox, "Projects", map[string]string{"/shared/comment": ""}); err != nil {
+		t.Fatalf("SetMetadata remove: %v", err)
+	}
+	got, err = store.GetMetadata(ctx, mailbox, "Projects", nil)
+	if err != nil {
+		t.Fatalf("GetMetadata renamed: %v", err)
+	}
+	if want := map[string]string{"/private/comment": "current projects"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("renamed folder metadata = %v, want %v", got, want)
+	}
+
+	for _, bad := range []string{"/comment", "/private/", "/private//x", "/private/a*", "/shared/a b"} {
+		if err := store.SetMetadata(ctx, mailbox, "", map[string]string{bad: "x"}); err != errors.ErrInvalidMetadataEntry {
+			t.Errorf("SetMetadata(%q) = %v, want ErrInvalidMetadataEntry", bad, err)
+		}
+	}
+	big := strings.Repeat("x", maxMetadataValue+1)
+	if err := store.SetMetadata(ctx, mailbox, "", map[string]string{"/private/big": big}); err != errors.ErrMetadataTooLarge {
+		t.Errorf("oversized value: got %v, want ErrMetadataTooLarge", err)
+	}
+	if _, err := store.GetMetadata(ctx, mailbox, "Nowhere", nil); err != errors.ErrFolderNotFound {
+		t.Errorf("missing folder: got %v, want ErrFolderNotFound", err)
+	}
+}
@@ -0,0 +1,113 @@
+package maildir
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+// MoveMessages implements msgstore.MessageMover.
+//
+// Messages keep their key, so the new UID equals the old one unless a
+// message with that key already exists in the destination.
+func (s *MaildirStore) MoveMessages(ctx context.Context, mailbox string, srcFolder string, uids []string, destFolder string) (moved map[string]string, err error) {
+	moved = make(map[string]string)
+	defer func() {
+		for _, uid := range uids {
+			if newUID, ok := moved[uid]; ok {
+				s.audit(ctx, msgstore.AuditEvent{Op: msgstore.AuditMove, Mailbox: mailbox, Folder: srcFolder, UID: uid, Detail: destFolder + "/" + newUID}, nil)
+			}
+		}
+		if err != nil {
+			s.audit(ctx, msgstore.AuditEvent{Op: msgstore.AuditMove, Mailbox: mailbox, Folder: srcFolder, Detail: destFolder}, err)
+		}
+	}()
+	defer s.lockMailbox(mailbox)()
+	if err := s.checkUnchanged(ctx, mailbox, srcFolder); err != nil {
+		return moved, err
+	}
+
+	srcPath, destPath, err := s.transferPaths(mailbox, srcFolder, destFolder)
+	if err != nil {
+		return moved, err
+	}
+	srcKey, destKey := s.deletionKeyFor(mailbox, srcFolder), s.deletionKeyFor(mailbox, destFolder)
+	defer func() { s.transferTracking(srcPath, srcKey, destKey, moved) }()
+	if srcPath == destPath {
+		return moved, nil
+	}
+	defer func() {
+		s.carryAnnotations(srcPath, destPath, moved, true)
+		s.recordExpunged(srcPath, sortedKeys(moved))
+	}()
+
+	files, err := scanMessages(s.fs, srcPath)
+	if os.IsNotExist(err) {
+		return moved, errors.ErrFolderNotFound
+	}
+	if err != nil {
+		return moved, err
+	}
+	remap := s.keywordRemapper(srcPath, destPath)
+
+	for _, uid := range uids {
+		name, ok := files[uid]
+		if !ok {
+			continue // already gone; IMAP ignores UIDs that do not exist
+		}
+		if _, done := moved[uid]; done {
+			continue
+		}
+		key, err := renameUnique(s.fs, filepath.Join(srcPath, name), destPath, remap(name), uid)
+		if err != nil {
+			return moved, err
+		}
+		moved[uid] = key
+	}
+	return moved, nil
+}
+
+// deletionKeyFor returns the soft-delete tracking key for a folder, which
+// may be "INBOX".
+func (s *MaildirStore) deletionKeyFor(mailbox, folder string) string {
+	if folder == "" || strings.EqualFold(folder, "INBOX") {
+		return mailbox
+	}
+	return folderDeletionKey(mailbox, folder)
+}
+
+// transferTracking carries the deletion marks of moved messages over to the
+// destination and drops their recency in the source.
+func (s *MaildirStore) transferTracking(srcPath, srcKey, destKey string, moved map[string]string) {
+	if len(moved) == 0 {
+		return
+	}
+	uids := make([]string, 0, len(moved))
+	for uid := range moved {
+		uids = append(uids, uid)
+	}
+	s.recent.forget(s.fs, srcPath, uids)
+
+	s.deletedMu.Lock()
+	defer s.deletedMu.Unlock()
+	for _, uid := range uids {
+		if !s.deleted[srcKey][uid] {
+			continue
+		}
+		delete(s.deleted[srcKey], uid)
+		if s.deleted[destKey] == nil {
+			s.deleted[destKey] = make(map[string]bool)
+		}
+		s.deleted[destKey][moved[uid]] = true
+	}
+	if len(s.deleted[srcKey]) == 0 {
+		delete(s.deleted, srcKey)
+	}
+}
+
+// Compile-time interface verification.
+var _ msgstore.MessageMover = (*MaildirStore)(nil)
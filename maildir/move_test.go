@@ -0,0 +1,68 @@
+package maildir
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/infodancer/msgstore/errors"
+)
+
+func TestMaildirStore_MoveMessages(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+	mailbox := "user@example.com"
+
+	var uids []string
+	for _, flags := range [][]string{{"\\Seen"}, nil, nil} {
+		uid, err := store.AppendToFolder(ctx, mailbox, "INBOX", strings.NewReader("Subject: move\r\n\r\nbody"), flags, time.Now())
+		if err != nil {
+			t.Fatalf("AppendToFolder: %v", err)
+		}
+		uids = append(uids, uid)
+	}
+	if err := store.Delete(ctx, mailbox, uids[1]); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+
+	moved, err := store.MoveMessages(ctx, mailbox, "INBOX", []string{uids[0], uids[1], "missing"}, "Archive")
+	if err != nil {
+		t.Fatalf("MoveMessages: %v", err)
+	}
+	if len(moved) != 2 || moved[uids[0]] == "" || moved[uids[1]] == "" {
+		t.Fatalf("moved = %v, want entries for %s and %s", moved, uids[0], uids[1])
+	}
+
+	inbox, err := store.List(ctx, mailbox)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(inbox) != 1 || inbox[0].UID != uids[2] {
+		t.Fatalf("inbox = %v, want only %s", inbox, uids[2])
+	}
+
+	// The deletion mark travels with the message, so only the seen message
+	// is listed in Archive, still \Seen.
+	archive, err := store.ListInFolder(ctx, mailbox, "Archive")
+	if err != nil {
+		t.Fatalf("ListInFolder: %v", err)
+	}
+	if len(archive) != 1 || archive[0].UID != moved[uids[0]] {
+		t.Fatalf("archive = %v, want only %s", archive, moved[uids[0]])
+	}
+	if len(archive[0].Flags) != 1 || archive[0].Flags[0] != "\\Seen" {
+		t.Errorf("flags = %v, want [\\Seen]", archive[0].Flags)
+	}
+	removed, err := store.ExpungeFolder(ctx, mailbox, "Archive")
+	if err != nil {
+		t.Fatalf("ExpungeFolder: %v", err)
+	}
+	if len(removed) != 1 || removed[0] != moved[uids[1]] {
+		t.Errorf("removed = %v, want [%s]", removed, moved[uids[1]])
+	}
+
+	if _, err := store.MoveMessages(ctx, mailbox, "Nowhere", uids, "Archive"); err != errors.ErrFolderNotFound {
+		t.Errorf("expected ErrFolderNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,258 @@
+package maildir
+
+import (
+	"time"
+
+	"github.com/infodancer/msgstore"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Option configures optional MaildirStore behavior.
+// Options are passed to NewStore after the required arguments.
+type Option func(*MaildirStore)
+
+// WithSieveGlobalDir sets the directory holding administrator-managed Sieve
+// scripts available to users through include :global (RFC 6609).
+// Scripts are looked up as {dir}/{name}.sieve.
+func WithSieveGlobalDir(dir string) Option {
+	return func(s *MaildirStore) {
+		s.sieveGlobalDir = dir
+	}
+}
+
+// WithSieveSystemScript sets the path of an administrator-controlled Sieve
+// script evaluated before each recipient's own script on every delivery
+// (e.g., mandatory junk filing). The file is re-read for each delivery.
+func WithSieveSystemScript(path string) Option {
+	return func(s *MaildirStore) {
+		s.sieveSystemScript = path
+	}
+}
+
+// WithSieveDir sets where users' Sieve scripts live when they are kept
+// outside the mailboxes, for central script storage or a separate
+// ManageSieve service. The template takes the same {domain}, {localpart}
+// and {email} variables as the path template, e.g.
+// "/var/lib/sieve/{domain}/{localpart}"; each user's directory holds the
+// .sieve active script link and the sieve/ script directory. Defaults to
+// the mailbox root.
+func WithSieveDir(template string) Option {
+	return func(s *MaildirStore) {
+		s.sieveDirTemplate = template
+	}
+}
+
+// WithRelay sets the callback used to send messages to addresses outside the
+// store, for Sieve redirect and .forward files. Without a relay, such
+// messages are kept in the recipient's inbox instead.
+func WithRelay(relay msgstore.RelayFunc) Option {
+	return func(s *MaildirStore) {
+		s.relay = relay
+	}
+}
+
+// WithAuthenticationResults stamps delivered messages with an
+// Authentication-Results header built from the envelope's SPF, DKIM and
+// DMARC verdicts, naming authservID as the host that checked them (see
+// msgstore.StampAuthenticationResults). Encrypted messages are stored
+// unchanged.
+func WithAuthenticationResults(authservID string) Option {
+	return func(s *MaildirStore) {
+		s.authservID = authservID
+	}
+}
+
+// WithHostname sets the host name reported in bounces generated at delivery
+// (e.g., for Sieve reject). Defaults to the system host name.
+func WithHostname(name string) Option {
+	return func(s *MaildirStore) {
+		s.hostname = name
+	}
+}
+
+// WithTracerProvider sets the OpenTelemetry tracer provider used for spans
+// around Deliver, List, Retrieve and Expunge. Defaults to the global provider.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(s *MaildirStore) {
+		s.tracerProvider = tp
+	}
+}
+
+// WithAuditLogger sets a logger that receives an event for every mutating
+// operation: deliveries, appends, copies, deletions, expunges, flag changes
+// and folder creation, deletion and rename.
+func WithAuditLogger(logger msgstore.AuditLogger) Option {
+	return func(s *MaildirStore) {
+		s.auditLogger = logger
+	}
+}
+
+// WithHierarchyDelimiter sets the folder hierarchy delimiter used in folder
+// names, as advertised by imapd in LIST responses (e.g., "/" to name nested
+// folders "Work/Projects"). Defaults to ".". On disk, levels are always
+// separated by "." as Maildir++ requires. A delimiter that is not a single
+// character, or that is valid within a folder name, is ignored.
+func WithHierarchyDelimiter(delim string) Option {
+	return func(s *MaildirStore) {
+		if r := []rune(delim); len(r) == 1 && !isValidFolderChar(r[0]) && r[0] != 0 {
+			s.delimiter = delim
+		}
+	}
+}
+
+// WithPublicFolders enables the Public/ namespace. The folders of mailbox
+// (e.g., "public@example.com") become public folders, and every user holds
+// defaultRights on them (e.g., "lr") in addition to what the folder ACLs
+// grant, so ACLs only need to name posters and moderators.
+func WithPublicFolders(mailbox string, defaultRights msgstore.Rights) Option {
+	return func(s *MaildirStore) {
+		s.publicMailbox = mailbox
+		s.publicRights = defaultRights
+	}
+}
+
+// WithArchivePolicy adds a policy that Maintain applies to every mailbox,
+// moving old messages into yearly archive folders. It may be given more
+// than once, e.g., for INBOX and Sent.
+func WithArchivePolicy(p ArchivePolicy) Option {
+	return func(s *MaildirStore) {
+		s.archivePolicies = append(s.archivePolicies, p)
+	}
+}
+
+// WithExpungePolicy adds a policy that Maintain applies to every mailbox,
+// permanently removing old or excess messages from a folder such as Junk or
+// Trash, whatever clients do about EXPUNGE. It may be given more than once.
+func WithExpungePolicy(p ExpungePolicy) Option {
+	return func(s *MaildirStore) {
+		s.expungePolicies = append(s.expungePolicies, p)
+	}
+}
+
+// WithExpungeGrace makes expunges recoverable for the given period:
+// instead of being unlinked, expunged messages are held in a hidden area of
+// the mailbox, from which Restore can bring them back, until Maintain
+// removes them once the period has passed. Expunge policies still remove
+// messages immediately.
+func WithExpungeGrace(d time.Duration) Option {
+	return func(s *MaildirStore) {
+		s.expungeGrace = d
+	}
+}
+
+// WithHeaderCacheSize sets how many message header summaries are cached in
+// memory for listings with msgstore.WithHeaderSummary. Defaults to 10000.
+func WithHeaderCacheSize(n int) Option {
+	return func(s *MaildirStore) {
+		if n > 0 {
+			s.headerCache = newHeaderCache(n)
+		}
+	}
+}
+
+// WithIdempotencyWindow sets how long Deliver remembers the idempotency
+// keys of delivered messages (see msgstore.Envelope.IdempotencyKey).
+// Defaults to 24 hours.
+func WithIdempotencyWindow(d time.Duration) Option {
+	return func(s *MaildirStore) {
+		if d > 0 {
+			s.idempotencyWindow = d
+		}
+	}
+}
+
+// WithGreylistPolicy sets the delays of ShouldGreylist. Zero fields of p
+// keep their defaults.
+func WithGreylistPolicy(p GreylistPolicy) Option {
+	return func(s *MaildirStore) {
+		s.greylist = p.withDefaults()
+	}
+}
+
+// WithGarbageMinAge sets how long a mailbox, or a directory that looks like
+// a folder but lacks cur/, must go unchanged before CollectGarbage removes
+// it. Defaults to 7 days.
+func WithGarbageMinAge(d time.Duration) Option {
+	return func(s *MaildirStore) {
+		if d > 0 {
+			s.garbageMinAge = d
+		}
+	}
+}
+
+// WithTmpCleanup sets the policy for files that crashed deliveries leave in
+// a maildir's tmp/: before a delivery, files older than maxAge are removed,
+// scanning each maildir at most once per interval. Defaults to 36 hours and
+// one hour; a maxAge of zero or less disables the cleanup.
+func WithTmpCleanup(maxAge, interval time.Duration) Option {
+	return func(s *MaildirStore) {
+		s.tmpCleaner.maxAge = maxAge
+		s.tmpCleaner.interval = interval
+	}
+}
+
+// WithFsync makes deliveries and appends durable: the message file and the
+// directory it is placed in are synced to stable storage before Deliver,
+// DeliverToFolder, AppendToFolder or AppendMultiple return, so a message
+// acknowledged to the sender survives a power failure. This costs two
+// fsyncs per message, so it is off by default.
+func WithFsync() Option {
+	return func(s *MaildirStore) {
+		s.fsync = true
+	}
+}
+
+// WithPunycodeDomains expands {domain} in path templates, and the domain
+// part of {email}, in its ASCII (punycode) form, so that an
+// internationalized domain gets the same directory whether mail arrives for
+// its Unicode or its ASCII spelling. The conversion follows IDNA lookup
+// rules, which also lower-case the domain; domains it rejects are left in
+// their Unicode form.
+func WithPunycodeDomains() Option {
+	return func(s *MaildirStore) {
+		s.punycode = true
+	}
+}
+
+// WithMessageIndex keeps a persistent index of each folder's messages in
+// an index.json file inside its maildir. The index caches each message's
+// flags, size, internal date and, once requested, header summary, so
+// listings avoid a stat per message and header summaries survive restarts.
+// It is updated incrementally as listings find messages added, re-flagged
+// or removed, and rebuilt from the directory if it is missing or corrupt.
+func WithMessageIndex() Option {
+	return func(s *MaildirStore) {
+		s.index = newMessageIndexes()
+	}
+}
+
+// WithMailboxResolver sets a callback that locates mailboxes whose root
+// directory does not follow the store's path template, such as maildirs in
+// users' home directories as recorded in their passwd entries. It is
+// consulted on every operation, so it should answer from memory or a
+// cache.
+func WithMailboxResolver(resolver MailboxResolver) Option {
+	return func(s *MaildirStore) {
+		s.resolver = resolver
+	}
+}
+
+// WithPathResolver sets a callback that computes the location of
+// mailboxes under the base path, in place of the path template. Paths
+// escaping the base path are rejected with errors.ErrPathTraversal. Like a
+// mailbox resolver, it is consulted on every operation.
+func WithPathResolver(resolver PathResolver) Option {
+	return func(s *MaildirStore) {
+		s.pathResolver = resolver
+	}
+}
+
+// WithFS sets the filesystem the store performs its I/O through.
+// Defaults to OSFS.
+func WithFS(fsys FS) Option {
+	return func(s *MaildirStore) {
+		if fsys != nil {
+			s.fs = fsys
+		}
+	}
+}
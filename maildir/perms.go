@@ -0,0 +1,194 @@
+package maildir
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/infodancer/msgstore/errors"
+)
+
+const (
+	// defaultDirMode is the mode of directories the store creates unless
+	// configured with WithPermissions.
+	defaultDirMode fs.FileMode = 0700
+)
+
+// OwnerResolver returns the numeric user and group IDs that should own
+// mailbox's directories and message files, typically from the uid and gid
+// fields of the user's passwd entry. -1 leaves an ID unchanged.
+type OwnerResolver func(mailbox string) (uid, gid int, err error)
+
+// ChmodChowner is implemented by filesystems that can change the mode and
+// ownership of files, as OSFS can. The modes of WithPermissions and the
+// owners of WithOwnerResolver are applied only through filesystems that
+// implement it; others create files with their own defaults.
+type ChmodChowner interface {
+	Chmod(name string, mode fs.FileMode) error
+	Chown(name string, uid, gid int) error
+}
+
+// Chmod implements ChmodChowner.
+func (OSFS) Chmod(name string, mode fs.FileMode) error { return os.Chmod(name, mode) }
+
+// Chown implements ChmodChowner.
+func (OSFS) Chown(name string, uid, gid int) error { return os.Chown(name, uid, gid) }
+
+// WithPermissions sets the permission bits of the directories and message
+// files created in mailboxes, for setups where other accounts, such as a
+// mail group, need to read maildirs. The bits are applied exactly, whatever
+// the process umask. By default directories are created with 0700 and
+// messages with 0666 less the umask; a zero mode keeps the default.
+func WithPermissions(dirMode, fileMode fs.FileMode) Option {
+	return func(s *MaildirStore) {
+		if dirMode != 0 {
+			s.dirMode = dirMode.Perm()
+		}
+		s.fileMode = fileMode.Perm()
+	}
+}
+
+// parseMode parses the octal file mode of store option name; "" is zero.
+func parseMode(name, value string) (fs.FileMode, error) {
+	if value == "" {
+		return 0, nil
+	}
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || fs.FileMode(mode)&^fs.ModePerm != 0 {
+		return 0, fmt.Errorf("%w: %s: invalid mode %q", errors.ErrStoreConfigInvalid, name, value)
+	}
+	return fs.FileMode(mode), nil
+}
+
+// WithOwnerResolver makes a store running as root hand the directories and
+// message files it creates in a mailbox to the owner resolver returns for
+// it. Without root privileges, ownership is left alone.
+func WithOwnerResolver(resolver OwnerResolver) Option {
+	return func(s *MaildirStore) {
+		s.owner = resolver
+	}
+}
+
+// fileAttrs are the mode and owner given to files created in a mailbox.
+type fileAttrs struct {
+	fsys     ChmodChowner
+	mode     fs.FileMode // 0 leaves the mode alone
+	chown    bool
+	uid, gid int
+}
+
+// mailboxAttrs returns the attributes of new files in mailbox, or nil if
+// none are configured or the filesystem cannot apply them.
+func (s *MaildirStore) mailboxAttrs(mailbox string, mode fs.FileMode) (*fileAttrs, error) {
+	fsys, ok := s.fs.(ChmodChowner)
+	chown := s.owner != nil && s.geteuid() == 0
+	if !ok || (mode == 0 && !chown) {
+		return nil, nil
+	}
+	attrs := &fileAttrs{fsys: fsys, mode: mode, chown: chown}
+	if chown {
+		var err error
+		if attrs.uid, attrs.gid, err = s.owner(mailbox); err != nil {
+			return nil, err
+		}
+	}
+	return attrs, nil
+}
+
+// apply gives the file name the attributes. A nil receiver does nothing.
+func (a *fileAttrs) apply(name string) error {
+	if a == nil {
+		return nil
+	}
+	if a.mode != 0 {
+		if err := a.fsys.Chmod(name, a.mode); err != nil {
+			return err
+		}
+	}
+	if a.chown {
+		return a.fsys.Chown(name, a.uid, a.gid)
+	}
+	return nil
+}
+
+// prepareFile returns the function that gives a new message file of
+// mailbox its configured mode and owner before it is moved into place, or
+// nil if there is nothing to do.
+func (s *MaildirStore) prepareFile(mailbox string) (func(name string) error, error) {
+	attrs, err := s.mailboxAttrs(mailbox, s.fileMode)
+	if err != nil || attrs == nil {
+		return nil, err
+	}
+	return attrs.apply, nil
+}
+
+// mkdirAll creates the directory path of mailbox with any missing parents.
+// Directories created inside the mailbox's root are given the configured
+// mode and owner; parents above the root, such as a domain directory, are
+// left to the process.
+func (s *MaildirStore) mkdirAll(mailbox, path string) error {
+	path = filepath.Clean(path)
+	var missing []string
+	for dir := path; ; dir = filepath.Dir(dir) {
+		if _, err := s.fs.Stat(dir); err == nil {
+			break
+		}
+		missing = append(missing, dir)
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	if err := s.fs.MkdirAll(path, s.dirMode); err != nil {
+		return err
+	}
+
+	var mode fs.FileMode
+	if s.dirMode != defaultDirMode {
+		mode = s.dirMode
+	}
+	attrs, err := s.mailboxAttrs(mailbox, mode)
+	if err != nil || attrs == nil {
+		return err
+	}
+	root, err := s.mailboxRootPath(mailbox)
+	if err != nil {
+		return err
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		dir := missing[i]
+		if dir != root && !strings.HasPrefix(dir, root+string(filepath.Separator)) {
+			continue
+		}
+		if err := attrs.apply(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createMaildir creates the maildir path of mailbox with its tmp/, new/ and
+// cur/ subdirectories, keeping any that already exist. A maildir that did
+// not exist yet starts a new incarnation.
+func (s *MaildirStore) createMaildir(mailbox, path string) error {
+	_, err := s.fs.Stat(filepath.Join(path, "cur"))
+	created := os.IsNotExist(err)
+	for _, dir := range []string{path, filepath.Join(path, "tmp"), filepath.Join(path, "new"), filepath.Join(path, "cur")} {
+		if err := s.mkdirAll(mailbox, dir); err != nil {
+			return err
+		}
+	}
+	if !created {
+		return nil
+	}
+	// Keep an incarnation a concurrent creation recorded first.
+	return s.startIncarnation(path, true)
+}
+
+// Compile-time interface verification.
+var _ ChmodChowner = OSFS{}
@@ -0,0 +1,143 @@
+package maildir
+
+import (
+	"context"
+	stderrors "errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+func TestMaildirStore_Permissions(t *testing.T) {
+	basePath := t.TempDir()
+	store := NewStore(basePath, "Maildir", "", WithPermissions(0750, 0640))
+	ctx := context.Background()
+	mailbox := "user@example.com"
+
+	deliverTestMessage(t, store, "Subject: delivered\r\n\r\n")
+	if _, err := store.AppendToFolder(ctx, mailbox, "Archive", strings.NewReader("Subject: appended\r\n\r\n"), nil, time.Time{}); err != nil {
+		t.Fatalf("AppendToFolder: %v", err)
+	}
+
+	root := filepath.Join(basePath, "user")
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir() && info.Mode().Perm() != 0750:
+			t.Errorf("%s: mode %v, want 0750", path, info.Mode().Perm())
+		case !d.IsDir() && filepath.Base(filepath.Dir(path)) == "new" && info.Mode().Perm() != 0640:
+			t.Errorf("%s: mode %v, want 0640", path, info.Mode().Perm())
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(basePath); err != nil || info.Mode().Perm() == 0750 {
+		t.Errorf("base path mode changed: %v, %v", info.Mode(), err)
+	}
+}
+
+// chownRecordingFS is an OSFS that records ownership changes instead of
+// making them.
+type chownRecordingFS struct {
+	OSFS
+	mu     sync.Mutex
+	chowns map[string][2]int
+}
+
+func (r *chownRecordingFS) Chown(name string, uid, gid int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.chowns[name] = [2]int{uid, gid}
+	return nil
+}
+
+func TestMaildirStore_OwnerResolver(t *testing.T) {
+	basePath := t.TempDir()
+	fsys := &chownRecordingFS{chowns: make(map[string][2]int)}
+	store := NewStore(basePath, "", "{domain}/{localpart}", WithFS(fsys), WithOwnerResolver(func(mailbox string) (int, int, error) {
+		return 1001, 2002, nil
+	}))
+	store.geteuid = func() int { return 0 }
+
+	envelope := msgstore.Envelope{Recipients: []string{"user@example.com"}, ReceivedTime: time.Now()}
+	if err := store.Deliver(context.Background(), envelope, strings.NewReader("Subject: hi\r\n\r\n")); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+
+	root := filepath.Join(basePath, "example.com", "user")
+	want := [2]int{1001, 2002}
+	for _, name := range []string{root, filepath.Join(root, "cur"), filepath.Join(root, ".Sent", "cur")} {
+		if got, ok := fsys.chowns[name]; !ok || got != want {
+			t.Errorf("%s: owner %v, %v; want %v", name, got, ok, want)
+		}
+	}
+	// The message was chowned in tmp/ before it was moved into new/.
+	messages := 0
+	for name, got := range fsys.chowns {
+		if filepath.Dir(name) == filepath.Join(root, "tmp") {
+			messages++
+			if got != want {
+				t.Errorf("message owner %v, want %v", got, want)
+			}
+		}
+	}
+	if messages != 1 {
+		t.Errorf("%d message files chowned, want 1", messages)
+	}
+	if _, ok := fsys.chowns[filepath.Join(basePath, "example.com")]; ok {
+		t.Error("domain directory above the mailbox root was chowned")
+	}
+
+	// Without root privileges ownership is left alone.
+	fsys = &chownRecordingFS{chowns: make(map[string][2]int)}
+	store = NewStore(t.TempDir(), "", "", WithFS(fsys), WithOwnerResolver(func(mailbox string) (int, int, error) {
+		return 1001, 2002, nil
+	}))
+	store.geteuid = func() int { return 1000 }
+	if err := store.Deliver(context.Background(), envelope, strings.NewReader("Subject: hi\r\n\r\n")); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	if len(fsys.chowns) != 0 {
+		t.Errorf("unprivileged store changed owners: %v", fsys.chowns)
+	}
+}
+
+func TestRegister_ModeOptions(t *testing.T) {
+	store, err := msgstore.Open(msgstore.StoreConfig{
+		Type:     "maildir",
+		BasePath: t.TempDir(),
+		Options:  map[string]string{"dir_mode": "0750", "file_mode": "640"},
+	})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if ms := store.(*MaildirStore); ms.dirMode != 0750 || ms.fileMode != 0640 {
+		t.Errorf("modes = %v, %v; want 0750, 0640", ms.dirMode, ms.fileMode)
+	}
+
+	for _, mode := range []string{"rwx", "17777", "0800"} {
+		_, err := msgstore.Open(msgstore.StoreConfig{
+			Type:     "maildir",
+			BasePath: t.TempDir(),
+			Options:  map[string]string{"dir_mode": mode},
+		})
+		if !stderrors.Is(err, errors.ErrStoreConfigInvalid) {
+			t.Errorf("Open with dir_mode %q error = %v, want ErrStoreConfigInvalid", mode, err)
+		}
+	}
+}
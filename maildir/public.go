@@ -0,0 +1,65 @@
+package maildir
+
+import (
+	"context"
+	"strings"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+// isPublic reports whether mailbox holds the public folders.
+func (s *MaildirStore) isPublic(mailbox string) bool {
+	return s.publicMailbox != "" && strings.EqualFold(mailbox, s.publicMailbox)
+}
+
+// publicPrefix returns the namespace prefix for public folders.
+func (s *MaildirStore) publicPrefix() string {
+	return msgstore.PublicNamespace + s.delimiter
+}
+
+// PublicFolders implements msgstore.PublicStore.
+// Returns nil if public folders are not configured.
+func (s *MaildirStore) PublicFolders(ctx context.Context, user string) ([]string, error) {
+	if s.publicMailbox == "" {
+		return nil, nil
+	}
+	folders, err := s.ListFolders(ctx, s.publicMailbox)
+	if err == errors.ErrMailboxNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, folder := range folders {
+		rights, err := s.MyRights(ctx, s.publicMailbox, folder, user)
+		if err != nil || !rights.Has(msgstore.RightLookup) {
+			continue
+		}
+		names = append(names, s.publicPrefix()+folder)
+	}
+	return names, nil
+}
+
+// ResolvePublic implements msgstore.PublicStore.
+func (s *MaildirStore) ResolvePublic(ctx context.Context, user string, name string) (string, string, msgstore.Rights, error) {
+	folder, ok := strings.CutPrefix(name, s.publicPrefix())
+	if s.publicMailbox == "" || !ok || strings.EqualFold(folder, "INBOX") {
+		return "", "", "", errors.ErrFolderNotFound
+	}
+	rights, err := s.MyRights(ctx, s.publicMailbox, folder, user)
+	if err == errors.ErrInvalidFolderName {
+		return "", "", "", errors.ErrFolderNotFound
+	}
+	if err != nil {
+		return "", "", "", err
+	}
+	if !rights.Has(msgstore.RightLookup) {
+		return "", "", "", errors.ErrFolderNotFound
+	}
+	return s.publicMailbox, folder, rights, nil
+}
+
+// Compile-time interface verification.
+var _ msgstore.PublicStore = (*MaildirStore)(nil)
@@ -0,0 +1,73 @@
+package maildir
+
+import (
+	"context"
+	"testing"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+func TestMaildirStore_PublicFolders(t *testing.T) {
+	const public = "public@example.com"
+	store := NewStore(t.TempDir(), "", "", WithHierarchyDelimiter("/"), WithPublicFolders(public, "lr"))
+	ctx := context.Background()
+
+	for _, folder := range []string{"News", "Staff"} {
+		if err := store.CreateFolder(ctx, public, folder); err != nil {
+			t.Fatalf("CreateFolder %s: %v", folder, err)
+		}
+	}
+	if err := store.SetACL(ctx, public, "News", "editor@example.com", "lrswi"); err != nil {
+		t.Fatalf("SetACL: %v", err)
+	}
+
+	if got := store.Capabilities().PublicPrefix; got != "Public/" {
+		t.Errorf("PublicPrefix = %q", got)
+	}
+
+	names, err := store.PublicFolders(ctx, "bob@example.com")
+	if err != nil {
+		t.Fatalf("PublicFolders: %v", err)
+	}
+	seen := map[string]bool{}
+	for _, name := range names {
+		seen[name] = true
+	}
+	if !seen["Public/News"] || !seen["Public/Staff"] {
+		t.Errorf("PublicFolders = %v, want News and Staff", names)
+	}
+
+	mailbox, folder, rights, err := store.ResolvePublic(ctx, "bob@example.com", "Public/News")
+	if err != nil {
+		t.Fatalf("ResolvePublic: %v", err)
+	}
+	if mailbox != public || folder != "News" || rights != "lr" {
+		t.Errorf("ResolvePublic(bob) = %q, %q, %q", mailbox, folder, rights)
+	}
+	if _, _, rights, _ := store.ResolvePublic(ctx, "editor@example.com", "Public/News"); !rights.Has(msgstore.RightInsert) {
+		t.Errorf("editor rights = %q, want insert", rights)
+	}
+	for _, name := range []string{"Public/Missing", "Other/News", "Public/INBOX"} {
+		if _, _, _, err := store.ResolvePublic(ctx, "bob@example.com", name); err != errors.ErrFolderNotFound {
+			t.Errorf("ResolvePublic(%q) = %v, want ErrFolderNotFound", name, err)
+		}
+	}
+
+	// Public folders are not also listed under Other Users.
+	if shared, _ := store.SharedFolders(ctx, "bob@example.com"); len(shared) != 0 {
+		t.Errorf("SharedFolders = %v, want none", shared)
+	}
+}
+
+func TestMaildirStore_PublicFolders_Disabled(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+
+	if names, err := store.PublicFolders(ctx, "bob@example.com"); err != nil || names != nil {
+		t.Errorf("PublicFolders = %v, %v", names, err)
+	}
+	if store.Capabilities().PublicPrefix != "" {
+		t.Error("PublicPrefix set without public folders")
+	}
+}
@@ -0,0 +1,242 @@
+package maildir
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/infodancer/msgstore"
+)
+
+const (
+	// recentFile records, inside a folder's maildir, which session each
+	// recent message belongs to, so that every process sharing the
+	// maildir agrees on it and it survives a restart.
+	recentFile = "recent.json"
+
+	// recentLockFile is the dot-lock held while updating recentFile.
+	recentLockFile = recentFile + ".lock"
+)
+
+// recentTracker records which session each recent message belongs to.
+//
+// A message is recent from the moment a listing moves it out of new/ until
+// a session claims it (RFC 3501 section 2.3.2); it then stays recent for
+// that session only, and for nobody once the session ends. Listings without
+// a session see unclaimed messages as recent but do not claim them, so
+// pop3d, webmail or a STATUS check cannot steal recency from imapd, even
+// from another process. The claims are kept in each folder's recentFile,
+// mapping UID to claiming session ("" for unclaimed).
+type recentTracker struct {
+	mu sync.Mutex
+	// claimed maps each session to the maildirs it claimed messages in
+	// through this process, for release.
+	claimed map[string]map[string]bool
+}
+
+// readRecent loads the recency claims of the maildir at path; a missing
+// file means none.
+func readRecent(fsys FS, path string) (map[string]string, error) {
+	entries := make(map[string]string)
+	data, err := fsys.ReadFile(filepath.Join(path, recentFile))
+	if os.IsNotExist(err) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// updateRecent applies update to the recency claims of the maildir at path
+// while holding its dot-lock, and writes them back if update reports a
+// change. It returns the claims as updated.
+func updateRecent(fsys FS, path string, update func(entries map[string]string) bool) (map[string]string, error) {
+	unlock, err := dotLock(fsys, filepath.Join(path, recentLockFile))
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	entries, err := readRecent(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	if !update(entries) {
+		return entries, nil
+	}
+	if len(entries) == 0 {
+		if err := fsys.Remove(filepath.Join(path, recentFile)); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		return entries, nil
+	}
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return nil, err
+	}
+	tmp, err := writeTemp(fsys, path, bytes.NewReader(data), false)
+	if err != nil {
+		return nil, err
+	}
+	if err := fsys.Rename(tmp, filepath.Join(path, recentFile)); err != nil {
+		_ = fsys.Remove(tmp)
+		return nil, err
+	}
+	return entries, nil
+}
+
+// add records messages just moved out of new/ of the maildir at path as
+// unclaimed.
+func (t *recentTracker) add(fsys FS, path string, uids []string) error {
+	if len(uids) == 0 {
+		return nil
+	}
+	_, err := updateRecent(fsys, path, func(entries map[string]string) bool {
+		changed := false
+		for _, uid := range uids {
+			if _, ok := entries[uid]; !ok {
+				entries[uid] = ""
+				changed = true
+			}
+		}
+		return changed
+	})
+	return err
+}
+
+// claim returns the UIDs of the maildir at path that are recent for
+// session, assigning unclaimed ones to it if session is not empty. Entries
+// for UIDs not in present are dropped.
+func (t *recentTracker) claim(fsys FS, path, session string, present map[string]bool) (map[string]bool, error) {
+	// Most listings change nothing; only those that do take the lock.
+	stale := func(entries map[string]string) bool {
+		for uid, owner := range entries {
+			if !present[uid] || owner == "" && session != "" {
+				return true
+			}
+		}
+		return false
+	}
+	entries, err := readRecent(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	if stale(entries) {
+		entries, err = updateRecent(fsys, path, func(entries map[string]string) bool {
+			if !stale(entries) {
+				return false
+			}
+			for uid, owner := range entries {
+				switch {
+				case !present[uid]:
+					delete(entries, uid)
+				case owner == "" && session != "":
+					entries[uid] = session
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	recent := make(map[string]bool)
+	for uid, owner := range entries {
+		if owner == session {
+			recent[uid] = true
+		}
+	}
+	if session != "" && len(recent) > 0 {
+		t.mu.Lock()
+		if t.claimed == nil {
+			t.claimed = make(map[string]map[string]bool)
+		}
+		if t.claimed[session] == nil {
+			t.claimed[session] = make(map[string]bool)
+		}
+		t.claimed[session][path] = true
+		t.mu.Unlock()
+	}
+	return recent, nil
+}
+
+// unclaimed returns the UIDs of the maildir at path not yet claimed by any
+// session.
+func (t *recentTracker) unclaimed(fsys FS, path string) ([]string, error) {
+	entries, err := readRecent(fsys, path)
+	if err != nil {
+		return nil, err
+	}
+	var uids []string
+	for uid, owner := range entries {
+		if owner == "" {
+			uids = append(uids, uid)
+		}
+	}
+	return uids, nil
+}
+
+// forget drops the entries for messages removed from the maildir at path.
+func (t *recentTracker) forget(fsys FS, path string, uids []string) {
+	if len(uids) == 0 {
+		return
+	}
+	_, err := updateRecent(fsys, path, func(entries map[string]string) bool {
+		changed := false
+		for _, uid := range uids {
+			if _, ok := entries[uid]; ok {
+				delete(entries, uid)
+				changed = true
+			}
+		}
+		return changed
+	})
+	if err != nil {
+		slog.Warn("updating recent messages", "path", path, "error", err)
+	}
+}
+
+// release drops every message claimed by session: once the session ends,
+// its recent messages are recent to nobody. Claims made through another
+// process, or before a restart, stay behind; they belong to a session
+// that no longer lists anything, so they are recent to nobody as well.
+func (t *recentTracker) release(fsys FS, session string) {
+	t.mu.Lock()
+	paths := t.claimed[session]
+	delete(t.claimed, session)
+	t.mu.Unlock()
+	for path := range paths {
+		_, err := updateRecent(fsys, path, func(entries map[string]string) bool {
+			changed := false
+			for uid, owner := range entries {
+				if owner == session {
+					delete(entries, uid)
+					changed = true
+				}
+			}
+			return changed
+		})
+		if err != nil {
+			slog.Warn("releasing recent messages", "path", path, "session", session, "error", err)
+		}
+	}
+}
+
+// EndSession implements msgstore.SessionStore.
+func (s *MaildirStore) EndSession(ctx context.Context, session string) error {
+	if session != "" {
+		s.recent.release(s.fs, session)
+	}
+	return nil
+}
+
+// Compile-time interface verification.
+var _ msgstore.SessionStore = (*MaildirStore)(nil)
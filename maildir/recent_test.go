@@ -0,0 +1,112 @@
+package maildir
+
+import (
+	"context"
+	"testing"
+
+	"github.com/infodancer/msgstore"
+)
+
+// recentCount lists the inbox with opts and counts \Recent messages.
+func recentCount(t *testing.T, store *MaildirStore, opts ...msgstore.ListOption) int {
+	t.Helper()
+	msgs, err := store.ListWithOptions(context.Background(), "user@example.com", "INBOX", opts...)
+	if err != nil {
+		t.Fatalf("ListWithOptions failed: %v", err)
+	}
+	n := 0
+	for _, m := range msgs {
+		for _, f := range m.Flags {
+			if f == "\\Recent" {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+func TestMaildirStore_RecentPerSession(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+
+	deliverTestMessage(t, store, "Subject: one\r\n\r\nhello")
+	deliverTestMessage(t, store, "Subject: two\r\n\r\nhello")
+
+	// A listing without a session sees recency but does not claim it.
+	if got := recentCount(t, store); got != 2 {
+		t.Fatalf("sessionless listing: %d recent, want 2", got)
+	}
+
+	// The first session claims both and keeps them across listings.
+	a := msgstore.WithSession("a")
+	for i := 0; i < 2; i++ {
+		if got := recentCount(t, store, a); got != 2 {
+			t.Fatalf("session a listing %d: %d recent, want 2", i, got)
+		}
+	}
+
+	// Later arrivals go to the next session that lists them.
+	deliverTestMessage(t, store, "Subject: three\r\n\r\nhello")
+	b := msgstore.WithSession("b")
+	if got := recentCount(t, store, b); got != 1 {
+		t.Fatalf("session b: %d recent, want 1", got)
+	}
+	if got := recentCount(t, store, a); got != 2 {
+		t.Fatalf("session a after b: %d recent, want 2", got)
+	}
+	status, err := store.Status(ctx, "user@example.com", "INBOX")
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	if status.Recent != 0 {
+		t.Errorf("Status.Recent = %d, want 0 with all messages claimed", status.Recent)
+	}
+
+	// Ending a session ends its recency for everyone.
+	if err := store.EndSession(ctx, "a"); err != nil {
+		t.Fatalf("EndSession failed: %v", err)
+	}
+	if got := recentCount(t, store, msgstore.WithSession("c")); got != 0 {
+		t.Errorf("session c: %d recent, want 0", got)
+	}
+	if got := recentCount(t, store, b); got != 1 {
+		t.Errorf("session b after a ended: %d recent, want 1", got)
+	}
+}
+
+func TestMaildirStore_RecentAcrossProcesses(t *testing.T) {
+	basePath := t.TempDir()
+	pop3d := NewStore(basePath, "", "")
+	imapd := NewStore(basePath, "", "")
+	ctx := context.Background()
+
+	deliverTestMessage(t, pop3d, "Subject: one\r\n\r\nhello")
+	deliverTestMessage(t, pop3d, "Subject: two\r\n\r\nhello")
+
+	// pop3d lists first, moving the messages out of new/ without claiming.
+	if got := recentCount(t, pop3d); got != 2 {
+		t.Fatalf("pop3d listing: %d recent, want 2", got)
+	}
+	session := msgstore.WithSession("imap-1")
+	if got := recentCount(t, imapd, session); got != 2 {
+		t.Fatalf("imapd session after pop3d: %d recent, want 2", got)
+	}
+	if got := recentCount(t, pop3d); got != 0 {
+		t.Errorf("pop3d listing after imapd claimed: %d recent, want 0", got)
+	}
+	if status, err := pop3d.Status(ctx, "user@example.com", "INBOX"); err != nil || status.Recent != 0 {
+		t.Errorf("pop3d Status = %+v, %v; want no recent messages", status, err)
+	}
+
+	// The claim survives a restart of imapd.
+	restarted := NewStore(basePath, "", "")
+	if got := recentCount(t, restarted, session); got != 2 {
+		t.Errorf("imapd session after restart: %d recent, want 2", got)
+	}
+	if err := imapd.EndSession(ctx, "imap-1"); err != nil {
+		t.Fatalf("EndSession: %v", err)
+	}
+	if got := recentCount(t, restarted, msgstore.WithSession("imap-2")); got != 0 {
+		t.Errorf("next session: %d recent, want 0", got)
+	}
+}
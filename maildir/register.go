@@ -1,20 +1,100 @@
 package maildir
 
 import (
+	"fmt"
+	"strconv"
+
 	"github.com/infodancer/msgstore"
 	"github.com/infodancer/msgstore/errors"
 )
 
 func init() {
-	msgstore.Register("maildir", func(config msgstore.StoreConfig) (msgstore.MsgStore, error) {
+	msgstore.RegisterWithSchema("maildir", func(config msgstore.StoreConfig) (msgstore.MsgStore, error) {
 		if config.BasePath == "" {
 			return nil, errors.ErrStoreConfigInvalid
 		}
 		// maildir_subdir specifies the subdirectory under each user (e.g., "Maildir")
 		maildirSubdir := config.Options["maildir_subdir"]
-		// path_template transforms mailbox names using {domain}, {localpart}, {email}
+		// path_template transforms mailbox names using {domain}, {localpart}, {email}, {hash}
 		// e.g., "{domain}/users/{localpart}" transforms user@example.com to example.com/users/user
 		pathTemplate := config.Options["path_template"]
-		return NewStore(config.BasePath, maildirSubdir, pathTemplate), nil
+
+		var opts []Option
+		// sieve_global_dir holds administrator scripts for include :global
+		if dir := config.Options["sieve_global_dir"]; dir != "" {
+			opts = append(opts, WithSieveGlobalDir(dir))
+		}
+		// sieve_system_script is evaluated before each user's own script
+		if path := config.Options["sieve_system_script"]; path != "" {
+			opts = append(opts, WithSieveSystemScript(path))
+		}
+		// sieve_dir moves users' scripts out of their mailboxes
+		if template := config.Options["sieve_dir"]; template != "" {
+			opts = append(opts, WithSieveDir(template))
+		}
+		// domain_paths and domain_path_templates place domains' mailboxes
+		// elsewhere, as comma-separated domain=value pairs
+		if config.Options["domain_paths"] != "" || config.Options["domain_path_templates"] != "" {
+			bases, err := parseDomainOption("domain_paths", config.Options["domain_paths"])
+			if err != nil {
+				return nil, err
+			}
+			templates, err := parseDomainOption("domain_path_templates", config.Options["domain_path_templates"])
+			if err != nil {
+				return nil, err
+			}
+			paths := make(map[string]DomainPath)
+			for domain, base := range bases {
+				p := paths[domain]
+				p.BasePath = base
+				paths[domain] = p
+			}
+			for domain, template := range templates {
+				p := paths[domain]
+				p.PathTemplate = template
+				paths[domain] = p
+			}
+			opts = append(opts, WithDomainPaths(paths))
+		}
+		// authserv_id stamps Authentication-Results headers in its name
+		if id := config.Options["authserv_id"]; id != "" {
+			opts = append(opts, WithAuthenticationResults(id))
+		}
+		// punycode_domains expands {domain} in its ASCII form
+		if v := config.Options["punycode_domains"]; v != "" {
+			punycode, err := strconv.ParseBool(v)
+			if err != nil {
+				return nil, fmt.Errorf("%w: punycode_domains: %v", errors.ErrStoreConfigInvalid, err)
+			}
+			if punycode {
+				opts = append(opts, WithPunycodeDomains())
+			}
+		}
+		// dir_mode and file_mode set the octal permissions of mailbox
+		// directories and message files
+		if config.Options["dir_mode"] != "" || config.Options["file_mode"] != "" {
+			dirMode, err := parseMode("dir_mode", config.Options["dir_mode"])
+			if err != nil {
+				return nil, err
+			}
+			fileMode, err := parseMode("file_mode", config.Options["file_mode"])
+			if err != nil {
+				return nil, err
+			}
+			opts = append(opts, WithPermissions(dirMode, fileMode))
+		}
+		return NewStore(config.BasePath, maildirSubdir, pathTemplate, opts...), nil
+	}, msgstore.OptionSchema{
+		{Name: "maildir_subdir", Description: "subdirectory under each user holding the maildir, e.g. Maildir"},
+		{Name: "path_template", Description: "mailbox path built from {domain}, {localpart}, {email} and {hash}, optionally with |lower; default is the local part"},
+		{Name: "sieve_global_dir", Description: "directory of administrator scripts for include :global"},
+		{Name: "sieve_system_script", Description: "script evaluated before each user's own script"},
+		{Name: "sieve_dir", Description: "per-user script directory from {domain}, {localpart} and {email}; default is the mailbox root"},
+		{Name: "domain_paths", Description: "per-domain base paths as domain=path pairs separated by commas"},
+		{Name: "domain_path_templates", Description: "per-domain path templates as domain=template pairs separated by commas"},
+		{Name: "authserv_id", Description: "host name stamped in Authentication-Results headers of delivered messages; unset disables them"},
+		{Name: "punycode_domains", Description: "expand {domain} in its ASCII (punycode) form: true or false", Default: "false"},
+		{Name: "dir_mode", Description: "octal permissions of mailbox directories; default 0700"},
+		{Name: "file_mode", Description: "octal permissions of message files; default 0666 less the umask"},
 	})
 }
@@ -0,0 +1,60 @@
+package maildir
+
+import (
+	"fmt"
+	"path/filepath"
+
+	"github.com/infodancer/msgstore/errors"
+)
+
+// MailboxResolver returns the root directory of mailbox, the directory
+// holding its maildir (or the maildirSubdir holding it) and its Sieve
+// scripts. It returns "" for mailboxes that follow the store's path
+// template. Resolved roots must be absolute and may lie outside the
+// store's base path.
+type MailboxResolver func(mailbox string) (root string, err error)
+
+// PathResolver returns the path of mailbox's root directory relative to
+// the store's base path (or its domain's, see WithDomainPaths), replacing
+// the path template for layouts it cannot express, such as hashed
+// directories ("a/al/alice") or legacy structures. It returns "" for
+// mailboxes that follow the template. Unlike a MailboxResolver, it cannot
+// place mailboxes outside the base path.
+type PathResolver func(mailbox string) (path string, err error)
+
+// resolveMailbox asks the mailbox resolver for the root of mailbox. ok is
+// false if there is no resolver or it left the mailbox to the template.
+func (s *MaildirStore) resolveMailbox(mailbox string) (root string, ok bool, err error) {
+	if s.resolver == nil {
+		return "", false, nil
+	}
+	root, err = s.resolver(mailbox)
+	if err != nil {
+		return "", false, err
+	}
+	if root == "" {
+		return "", false, nil
+	}
+	if !filepath.IsAbs(root) {
+		return "", false, fmt.Errorf("%w: resolved root %q of %s is not absolute", errors.ErrStoreConfigInvalid, root, mailbox)
+	}
+	return filepath.Clean(root), true, nil
+}
+
+// relativeMailboxPath returns the path of mailbox's root relative to its
+// base path: the path resolver's answer, or else the path template's.
+func (s *MaildirStore) relativeMailboxPath(mailbox string) (string, error) {
+	if s.pathResolver != nil {
+		path, err := s.pathResolver(mailbox)
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(path) {
+			return "", fmt.Errorf("%w: resolved path %q of %s is not relative", errors.ErrStoreConfigInvalid, path, mailbox)
+		}
+		if path != "" {
+			return path, nil
+		}
+	}
+	return s.expandMailbox(mailbox), nil
+}
@@ -0,0 +1,93 @@
+package maildir
+
+import (
+	"context"
+	stderrors "errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+func TestMaildirStore_MailboxResolver(t *testing.T) {
+	basePath := t.TempDir()
+	home := filepath.Join(t.TempDir(), "home", "alice")
+	store := NewStore(basePath, "Maildir", "", WithMailboxResolver(func(mailbox string) (string, error) {
+		switch mailbox {
+		case "alice@example.com":
+			return home, nil
+		case "broken@example.com":
+			return "relative/dir", nil
+		}
+		return "", nil
+	}))
+	ctx := context.Background()
+
+	envelope := msgstore.Envelope{Recipients: []string{"alice@example.com", "bob@example.com"}, ReceivedTime: time.Now()}
+	if err := store.Deliver(ctx, envelope, strings.NewReader("Subject: hi\r\n\r\n")); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	for _, dir := range []string{filepath.Join(home, "Maildir", "new"), filepath.Join(basePath, "bob", "Maildir", "new")} {
+		entries, err := os.ReadDir(dir)
+		if err != nil || len(entries) != 1 {
+			t.Errorf("%s: %d entries, %v; want 1", dir, len(entries), err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(basePath, "alice")); !os.IsNotExist(err) {
+		t.Errorf("resolved mailbox also created under the base path: %v", err)
+	}
+	if msgs, err := store.List(ctx, "alice@example.com"); err != nil || len(msgs) != 1 {
+		t.Errorf("List = %v, %v", msgs, err)
+	}
+
+	if _, err := store.List(ctx, "broken@example.com"); !stderrors.Is(err, errors.ErrStoreConfigInvalid) {
+		t.Errorf("List with a relative resolved root error = %v, want ErrStoreConfigInvalid", err)
+	}
+}
+
+func TestMaildirStore_PathResolver(t *testing.T) {
+	basePath := t.TempDir()
+	store := NewStore(basePath, "", "", WithPathResolver(func(mailbox string) (string, error) {
+		localpart, _ := splitEmail(mailbox)
+		switch localpart {
+		case "alice":
+			return filepath.Join("a", "al", "alice"), nil
+		case "escape":
+			return filepath.Join("..", "outside"), nil
+		case "absolute":
+			return "/var/mail/absolute", nil
+		case "failing":
+			return "", stderrors.New("directory service unavailable")
+		}
+		return "", nil
+	}))
+	ctx := context.Background()
+
+	envelope := msgstore.Envelope{Recipients: []string{"alice@example.com", "bob@example.com"}, ReceivedTime: time.Now()}
+	if err := store.Deliver(ctx, envelope, strings.NewReader("Subject: hi\r\n\r\n")); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	for _, dir := range []string{filepath.Join(basePath, "a", "al", "alice", "new"), filepath.Join(basePath, "bob", "new")} {
+		entries, err := os.ReadDir(dir)
+		if err != nil || len(entries) != 1 {
+			t.Errorf("%s: %d entries, %v; want 1", dir, len(entries), err)
+		}
+	}
+	if msgs, err := store.List(ctx, "alice@example.com"); err != nil || len(msgs) != 1 {
+		t.Errorf("List = %v, %v", msgs, err)
+	}
+
+	if _, err := store.List(ctx, "escape@example.com"); !stderrors.Is(err, errors.ErrPathTraversal) {
+		t.Errorf("List escaping the base path error = %v, want ErrPathTraversal", err)
+	}
+	if _, err := store.List(ctx, "absolute@example.com"); !stderrors.Is(err, errors.ErrStoreConfigInvalid) {
+		t.Errorf("List with an absolute resolved path error = %v, want ErrStoreConfigInvalid", err)
+	}
+	if _, err := store.List(ctx, "failing@example.com"); err == nil {
+		t.Error("List succeeded although the path resolver failed")
+	}
+}
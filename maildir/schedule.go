@@ -0,0 +1,177 @@
+package maildir
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+// scheduleDir is the spool of scheduled deliveries under the base path.
+// Each entry is a message file named by its ID in queue/, plus an
+// ID + ".json" record written after it; messages are staged in tmp/.
+const scheduleDir = ".scheduled"
+
+// scheduledRecord is the on-disk record of a scheduled delivery.
+type scheduledRecord struct {
+	At       time.Time       `json:"at"`
+	Envelope json.RawMessage `json:"envelope"`
+}
+
+// queuePath returns the directory holding scheduled messages.
+func (s *MaildirStore) queuePath() string {
+	return filepath.Join(s.basePath, scheduleDir, "queue")
+}
+
+// ScheduleDeliver implements msgstore.ScheduledDeliverer.
+func (s *MaildirStore) ScheduleDeliver(ctx context.Context, envelope msgstore.Envelope, message io.Reader, at time.Time) (string, error) {
+	if len(envelope.Recipients) == 0 {
+		return "", errors.ErrNoRecipients
+	}
+	env, err := msgstore.MarshalEnvelope(envelope)
+	if err != nil {
+		return "", err
+	}
+	record, err := json.Marshal(scheduledRecord{At: at.UTC(), Envelope: env})
+	if err != nil {
+		return "", err
+	}
+
+	spool := filepath.Join(s.basePath, scheduleDir)
+	for _, dir := range []string{"tmp", "queue"} {
+		if err := s.fs.MkdirAll(filepath.Join(spool, dir), 0700); err != nil {
+			return "", err
+		}
+	}
+	id, err := newMessageKey()
+	if err != nil {
+		return "", err
+	}
+	msgTmp, err := writeTemp(s.fs, spool, message, false)
+	if err != nil {
+		return "", err
+	}
+	recTmp, err := writeTemp(s.fs, spool, bytes.NewReader(record), false)
+	if err != nil {
+		_ = s.fs.Remove(msgTmp)
+		return "", err
+	}
+
+	// The record goes in last, so a message is never picked up half-written.
+	queue := s.queuePath()
+	if err := s.fs.Rename(msgTmp, filepath.Join(queue, id)); err != nil {
+		_ = s.fs.Remove(msgTmp)
+		_ = s.fs.Remove(recTmp)
+		return "", err
+	}
+	if err := s.fs.Rename(recTmp, filepath.Join(queue, id+".json")); err != nil {
+		_ = s.fs.Remove(filepath.Join(queue, id))
+		_ = s.fs.Remove(recTmp)
+		return "", err
+	}
+	return id, nil
+}
+
+// CancelScheduled implements msgstore.ScheduledDeliverer.
+func (s *MaildirStore) CancelScheduled(ctx context.Context, id string) error {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return errors.ErrMessageNotFound
+	}
+	s.scheduleMu.Lock()
+	defer s.scheduleMu.Unlock()
+
+	queue := s.queuePath()
+	if err := s.fs.Remove(filepath.Join(queue, id+".json")); os.IsNotExist(err) {
+		return errors.ErrMessageNotFound
+	} else if err != nil {
+		return err
+	}
+	return s.fs.Remove(filepath.Join(queue, id))
+}
+
+// DeliverDue implements msgstore.ScheduledDeliverer.
+// Messages are delivered in order of their scheduled time. A message whose
+// delivery fails stays spooled and is retried on the next run.
+func (s *MaildirStore) DeliverDue(ctx context.Context) error {
+	s.scheduleMu.Lock()
+	defer s.scheduleMu.Unlock()
+
+	queue := s.queuePath()
+	entries, err := s.fs.ReadDir(queue)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	type due struct {
+		id     string
+		record scheduledRecord
+	}
+	now := time.Now()
+	var ready []due
+	for _, e := range entries {
+		id, ok := strings.CutSuffix(e.Name(), ".json")
+		if !ok {
+			continue
+		}
+		data, err := s.fs.ReadFile(filepath.Join(queue, e.Name()))
+		if err != nil {
+			return err
+		}
+		var rec scheduledRecord
+		if err := json.Unmarshal(data, &rec); err != nil {
+			slog.Error("skipping unreadable scheduled delivery", "id", id, "error", err)
+			continue
+		}
+		if !rec.At.After(now) {
+			ready = append(ready, due{id: id, record: rec})
+		}
+	}
+	sort.Slice(ready, func(i, j int) bool { return ready[i].record.At.Before(ready[j].record.At) })
+
+	for _, d := range ready {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		envelope, err := msgstore.UnmarshalEnvelope(d.record.Envelope)
+		if err != nil {
+			slog.Error("skipping unreadable scheduled delivery", "id", d.id, "error", err)
+			continue
+		}
+		if err := s.deliverSpooled(ctx, envelope, filepath.Join(queue, d.id)); err != nil {
+			slog.Error("scheduled delivery failed", "id", d.id, "error", err)
+			continue
+		}
+		if err := s.fs.Remove(filepath.Join(queue, d.id+".json")); err != nil {
+			return err
+		}
+		if err := s.fs.Remove(filepath.Join(queue, d.id)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deliverSpooled delivers the message file at path.
+func (s *MaildirStore) deliverSpooled(ctx context.Context, envelope msgstore.Envelope, path string) error {
+	f, err := s.fs.Open(path)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = f.Close() }()
+	return s.Deliver(ctx, envelope, f)
+}
+
+// Compile-time interface verification.
+var _ msgstore.ScheduledDeliverer = (*MaildirStore)(nil)
@@ -0,0 +1,64 @@
+package maildir
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+func TestMaildirStore_ScheduleDeliver(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+	envelope := msgstore.Envelope{From: "sender@example.com", Recipients: []string{"user@example.com"}}
+
+	if _, err := store.ScheduleDeliver(ctx, envelope, strings.NewReader("Subject: now\r\n\r\n"), time.Now().Add(-time.Second)); err != nil {
+		t.Fatalf("ScheduleDeliver: %v", err)
+	}
+	later, err := store.ScheduleDeliver(ctx, envelope, strings.NewReader("Subject: later\r\n\r\n"), time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("ScheduleDeliver: %v", err)
+	}
+	cancelled, err := store.ScheduleDeliver(ctx, envelope, strings.NewReader("Subject: cancelled\r\n\r\n"), time.Now().Add(-time.Second))
+	if err != nil {
+		t.Fatalf("ScheduleDeliver: %v", err)
+	}
+	if err := store.CancelScheduled(ctx, cancelled); err != nil {
+		t.Fatalf("CancelScheduled: %v", err)
+	}
+	if err := store.CancelScheduled(ctx, cancelled); err != errors.ErrMessageNotFound {
+		t.Errorf("second CancelScheduled = %v, want ErrMessageNotFound", err)
+	}
+
+	if msgs, _ := store.List(ctx, "user@example.com"); len(msgs) != 0 {
+		t.Fatalf("delivered before DeliverDue: %v", msgs)
+	}
+	if err := store.DeliverDue(ctx); err != nil {
+		t.Fatalf("DeliverDue: %v", err)
+	}
+	msgs, err := store.ListWithOptions(ctx, "user@example.com", "INBOX", msgstore.WithHeaderSummary())
+	if err != nil {
+		t.Fatalf("ListWithOptions: %v", err)
+	}
+	if len(msgs) != 1 || msgs[0].Subject != "now" {
+		t.Fatalf("INBOX = %v, want only the due message", msgs)
+	}
+
+	// A second run does not deliver again, and the later message can
+	// still be cancelled.
+	if err := store.DeliverDue(ctx); err != nil {
+		t.Fatalf("second DeliverDue: %v", err)
+	}
+	if msgs, _ := store.List(ctx, "user@example.com"); len(msgs) != 1 {
+		t.Errorf("INBOX after second run = %v", msgs)
+	}
+	if err := store.CancelScheduled(ctx, later); err != nil {
+		t.Errorf("CancelScheduled(later): %v", err)
+	}
+	if err := store.CancelScheduled(ctx, "../escape"); err != errors.ErrMessageNotFound {
+		t.Errorf("CancelScheduled(../escape) = %v", err)
+	}
+}
@@ -0,0 +1,207 @@
+package maildir
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+// sharedIndexFile lists, in the store base directory, the folders that have
+// an ACL, so SharedFolders does not have to walk every mailbox.
+const sharedIndexFile = ".shared-index.json"
+
+// sharedEntry is a folder with a non-empty ACL.
+type sharedEntry struct {
+	Mailbox string `json:"mailbox"`
+	Folder  string `json:"folder"`
+}
+
+// sharedIndex guards the shared index file, which spans mailboxes and so
+// cannot rely on the per-mailbox lock.
+type sharedIndex struct {
+	mu sync.Mutex
+}
+
+// sharedIndexPath returns the path of the shared index file.
+func (s *MaildirStore) sharedIndexPath() string {
+	return filepath.Join(s.basePath, sharedIndexFile)
+}
+
+// readSharedIndex loads the shared index; a missing file means no entries.
+func (s *MaildirStore) readSharedIndex() ([]sharedEntry, error) {
+	data, err := s.fs.ReadFile(s.sharedIndexPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []sharedEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// updateSharedIndex rewrites the shared index with the entries returned by
+// update, which receives the current ones.
+func (s *MaildirStore) updateSharedIndex(update func([]sharedEntry) []sharedEntry) error {
+	s.shared.mu.Lock()
+	defer s.shared.mu.Unlock()
+	entries, err := s.readSharedIndex()
+	if err != nil {
+		return err
+	}
+	entries = update(entries)
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Mailbox != entries[j].Mailbox {
+			return entries[i].Mailbox < entries[j].Mailbox
+		}
+		return entries[i].Folder < entries[j].Folder
+	})
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	if err := s.fs.MkdirAll(s.basePath, 0700); err != nil {
+		return err
+	}
+	tmp, err := s.fs.CreateTemp(s.basePath, ".tmp-shared-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = s.fs.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = s.fs.Remove(tmp.Name())
+		return err
+	}
+	if err := s.fs.Rename(tmp.Name(), s.sharedIndexPath()); err != nil {
+		_ = s.fs.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// indexShared records whether a folder has an ACL.
+func (s *MaildirStore) indexShared(mailbox, folder string, shared bool) error {
+	folder = canonicalFolder(folder)
+	return s.updateSharedIndex(func(entries []sharedEntry) []sharedEntry {
+		kept := entries[:0]
+		for _, e := range entries {
+			if e.Mailbox != mailbox || e.Folder != folder {
+				kept = append(kept, e)
+			}
+		}
+		if shared {
+			kept = append(kept, sharedEntry{Mailbox: mailbox, Folder: folder})
+		}
+		return kept
+	})
+}
+
+// renameShared follows a folder rename in the shared index, including the
+// folders nested below it.
+func (s *MaildirStore) renameShared(mailbox, oldName, newName string) error {
+	return s.updateSharedIndex(func(entries []sharedEntry) []sharedEntry {
+		for i, e := range entries {
+			if e.Mailbox != mailbox {
+				continue
+			}
+			if e.Folder == oldName {
+				entries[i].Folder = newName
+			} else if rest, ok := strings.CutPrefix(e.Folder, oldName+s.delimiter); ok {
+				entries[i].Folder = newName + s.delimiter + rest
+			}
+		}
+		return entries
+	})
+}
+
+// canonicalFolder spells the inbox "INBOX".
+func canonicalFolder(folder string) string {
+	if folder == "" || strings.EqualFold(folder, "INBOX") {
+		return "INBOX"
+	}
+	return folder
+}
+
+// otherUsersPrefix returns the namespace prefix for shared folders.
+func (s *MaildirStore) otherUsersPrefix() string {
+	return msgstore.OtherUsersNamespace + s.delimiter
+}
+
+// sharedName returns the name of a shared folder in the Other Users namespace.
+func (s *MaildirStore) sharedName(e sharedEntry) string {
+	return s.otherUsersPrefix() + e.Mailbox + s.delimiter + e.Folder
+}
+
+// visibleShared returns the index entries of other mailboxes that user may
+// look up, with user's rights on each. Entries for folders that no longer
+// exist are skipped.
+func (s *MaildirStore) visibleShared(ctx context.Context, user string) ([]sharedEntry, []msgstore.Rights, error) {
+	entries, err := s.readSharedIndex()
+	if err != nil {
+		return nil, nil, err
+	}
+	var visible []sharedEntry
+	var rights []msgstore.Rights
+	for _, e := range entries {
+		if strings.EqualFold(e.Mailbox, user) || s.isPublic(e.Mailbox) {
+			continue
+		}
+		r, err := s.MyRights(ctx, e.Mailbox, e.Folder, user)
+		if err != nil || !r.Has(msgstore.RightLookup) {
+			continue
+		}
+		visible = append(visible, e)
+		rights = append(rights, r)
+	}
+	return visible, rights, nil
+}
+
+// SharedFolders implements msgstore.SharedStore.
+func (s *MaildirStore) SharedFolders(ctx context.Context, user string) ([]string, error) {
+	entries, _, err := s.visibleShared(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = s.sharedName(e)
+	}
+	return names, nil
+}
+
+// ResolveShared implements msgstore.SharedStore.
+//
+// Names are matched against the shared index rather than parsed, because
+// mailbox names may contain the hierarchy delimiter.
+func (s *MaildirStore) ResolveShared(ctx context.Context, user string, name string) (string, string, msgstore.Rights, error) {
+	if !strings.HasPrefix(name, s.otherUsersPrefix()) {
+		return "", "", "", errors.ErrFolderNotFound
+	}
+	entries, rights, err := s.visibleShared(ctx, user)
+	if err != nil {
+		return "", "", "", err
+	}
+	for i, e := range entries {
+		if s.sharedName(e) == name {
+			return e.Mailbox, e.Folder, rights[i], nil
+		}
+	}
+	return "", "", "", errors.ErrFolderNotFound
+}
+
+// Compile-time interface verification.
+var _ msgstore.SharedStore = (*MaildirStore)(nil)
@@ -0,0 +1,71 @@
+package maildir
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+func TestMaildirStore_SharedFolders(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "", WithHierarchyDelimiter("/"))
+	ctx := context.Background()
+	const owner = "support@example.com"
+
+	if err := store.CreateFolder(ctx, owner, "Tickets"); err != nil {
+		t.Fatalf("CreateFolder: %v", err)
+	}
+	if err := store.SetACL(ctx, owner, "INBOX", "bob@example.com", "lrs"); err != nil {
+		t.Fatalf("SetACL INBOX: %v", err)
+	}
+	if err := store.SetACL(ctx, owner, "Tickets", msgstore.IdentifierAnyone, "lrswite"); err != nil {
+		t.Fatalf("SetACL Tickets: %v", err)
+	}
+
+	if got := store.Capabilities().OtherUsersPrefix; got != "Other Users/" {
+		t.Errorf("OtherUsersPrefix = %q", got)
+	}
+
+	names, err := store.SharedFolders(ctx, "bob@example.com")
+	if err != nil {
+		t.Fatalf("SharedFolders: %v", err)
+	}
+	want := []string{"Other Users/support@example.com/INBOX", "Other Users/support@example.com/Tickets"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("SharedFolders(bob) = %v, want %v", names, want)
+	}
+	if names, _ := store.SharedFolders(ctx, "carol@example.com"); len(names) != 1 {
+		t.Errorf("SharedFolders(carol) = %v, want only Tickets", names)
+	}
+	if names, _ := store.SharedFolders(ctx, owner); len(names) != 0 {
+		t.Errorf("owner sees own folders as shared: %v", names)
+	}
+
+	mailbox, folder, rights, err := store.ResolveShared(ctx, "bob@example.com", "Other Users/support@example.com/INBOX")
+	if err != nil {
+		t.Fatalf("ResolveShared: %v", err)
+	}
+	if mailbox != owner || folder != "INBOX" || rights != "lrs" {
+		t.Errorf("ResolveShared = %q, %q, %q", mailbox, folder, rights)
+	}
+	if _, _, _, err := store.ResolveShared(ctx, "carol@example.com", "Other Users/support@example.com/INBOX"); err != errors.ErrFolderNotFound {
+		t.Errorf("ResolveShared without lookup right = %v, want ErrFolderNotFound", err)
+	}
+
+	// Shares follow renames and disappear with the ACL.
+	if err := store.RenameFolder(ctx, owner, "Tickets", "Queue"); err != nil {
+		t.Fatalf("RenameFolder: %v", err)
+	}
+	if _, folder, _, err := store.ResolveShared(ctx, "carol@example.com", "Other Users/support@example.com/Queue"); err != nil || folder != "Queue" {
+		t.Errorf("ResolveShared after rename = %q, %v", folder, err)
+	}
+	if err := store.SetACL(ctx, owner, "INBOX", "bob@example.com", ""); err != nil {
+		t.Fatalf("SetACL remove: %v", err)
+	}
+	names, _ = store.SharedFolders(ctx, "bob@example.com")
+	if want := []string{"Other Users/support@example.com/Queue"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("SharedFolders(bob) after revoke = %v, want %v", names, want)
+	}
+}
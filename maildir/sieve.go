@@ -1,57 +1,166 @@
 package maildir
 
 import (
+	"bytes"
 	"errors"
 	"log/slog"
 	"os"
 	"path/filepath"
 	"strings"
 
-	gosieve "git.sr.ht/~emersion/go-sieve"
+	"github.com/infodancer/msgstore"
 	mserrors "github.com/infodancer/msgstore/errors"
 )
 
-// sieveScriptPath returns the filesystem path for a user's Sieve script.
-// The script is expected at {basePath}/{expandedMailbox}/.sieve — adjacent
-// to the Maildir directory, in the user's mailbox root.
-func (s *MaildirStore) sieveScriptPath(mailbox string) (string, error) {
-	expandedMailbox := s.expandMailbox(mailbox)
-	candidate := filepath.Join(s.basePath, expandedMailbox, ".sieve")
+// mailboxRootPath returns the filesystem path of a mailbox's root directory:
+// {basePath}/{expandedMailbox} (with the base path of the mailbox's domain,
+// see WithDomainPaths), or the directory returned by the mailbox
+// resolver, without any maildirSubdir. Per-user configuration such as Sieve
+// scripts lives here, next to the Maildir.
+func (s *MaildirStore) mailboxRootPath(mailbox string) (string, error) {
+	if root, ok, err := s.resolveMailbox(mailbox); ok || err != nil {
+		return root, err
+	}
+	expandedMailbox, err := s.relativeMailboxPath(mailbox)
+	if err != nil {
+		return "", err
+	}
+	basePath, _ := s.mailboxLayout(mailbox)
+	candidate := filepath.Join(basePath, expandedMailbox)
 
-	cleanBase := filepath.Clean(s.basePath)
+	cleanBase := filepath.Clean(basePath)
 	cleanCandidate := filepath.Clean(candidate)
 	if !strings.HasPrefix(cleanCandidate+string(filepath.Separator), cleanBase+string(filepath.Separator)) {
 		return "", mserrors.ErrPathTraversal
 	}
+	if err := s.checkContained(cleanBase, cleanCandidate); err != nil {
+		return "", err
+	}
 
 	return cleanCandidate, nil
 }
 
-// loadSieveScript loads and parses the Sieve script for a mailbox.
+// sieveRoot returns the directory holding a user's Sieve scripts: the
+// active script link .sieve and the sieve/ script directory. It is the
+// mailbox root unless WithSieveDir moved scripts elsewhere.
+func (s *MaildirStore) sieveRoot(mailbox string) (string, error) {
+	if s.sieveDirTemplate == "" {
+		return s.mailboxRootPath(mailbox)
+	}
+	email, localpart, domain := s.templateVars(mailbox)
+	candidate := filepath.Clean(expandTemplate(s.sieveDirTemplate, email, localpart, domain))
+
+	// The expanded directory must stay under the template's fixed prefix.
+	base, _, _ := strings.Cut(s.sieveDirTemplate, "{")
+	cleanBase := filepath.Clean(base)
+	if candidate != cleanBase && !strings.HasPrefix(candidate, cleanBase+string(filepath.Separator)) {
+		return "", mserrors.ErrPathTraversal
+	}
+	return candidate, nil
+}
+
+// sieveScriptPath returns the filesystem path for a user's Sieve script.
+// The script is expected at {basePath}/{expandedMailbox}/.sieve — adjacent
+// to the Maildir directory, in the user's mailbox root — or in the
+// directory configured with WithSieveDir.
+func (s *MaildirStore) sieveScriptPath(mailbox string) (string, error) {
+	root, err := s.sieveRoot(mailbox)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(root, ".sieve"), nil
+}
+
+// loadSieveScript loads the active Sieve script for a mailbox. A mailbox
+// without a Sieve script but with a .forward file gets the equivalent script.
 //
 // Returns (nil, nil) if no script exists — delivery continues normally.
-// Returns (nil, err) if the script exists but fails to parse — the error
-// is logged and delivery falls through to default behavior (fail-safe).
-func (s *MaildirStore) loadSieveScript(mailbox string) ([]gosieve.Command, error) {
+func (s *MaildirStore) loadSieveScript(mailbox string) ([]byte, error) {
 	path, err := s.sieveScriptPath(mailbox)
 	if err != nil {
 		return nil, err
 	}
 
-	f, err := os.Open(path)
+	script, err := s.fs.ReadFile(path)
 	if errors.Is(err, os.ErrNotExist) {
-		return nil, nil
+		return s.loadForwardScript(mailbox)
 	}
 	if err != nil {
 		return nil, err
 	}
-	defer func() { _ = f.Close() }()
 
-	cmds, err := gosieve.Parse(f)
+	slog.Debug("loaded sieve script", slog.String("mailbox", mailbox), slog.Int("bytes", len(script)))
+	return script, nil
+}
+
+// loadSystemSieveScript loads the system-wide script configured with
+// WithSieveSystemScript. Returns nil if none is configured or it cannot be
+// read; a missing system script never blocks delivery.
+func (s *MaildirStore) loadSystemSieveScript() []byte {
+	if s.sieveSystemScript == "" {
+		return nil
+	}
+	script, err := s.fs.ReadFile(s.sieveSystemScript)
 	if err != nil {
-		return nil, err
+		slog.Warn("system sieve script unavailable",
+			slog.String("path", s.sieveSystemScript),
+			slog.String("error", err.Error()),
+		)
+		return nil
+	}
+	return script
+}
+
+// sieveActions evaluates the system-wide and per-user Sieve scripts for a
+// mailbox and returns the resulting actions.
+//
+// Returns nil if no script applies or evaluation fails — the error is logged
+// and delivery falls through to default behavior (fail-safe). A broken user
+// script does not disable the system script: it is retried on its own.
+func (s *MaildirStore) sieveActions(mailbox string, envelope msgstore.Envelope, data []byte) []msgstore.SieveAction {
+	userScript, err := s.loadSieveScript(mailbox)
+	if err != nil {
+		slog.Debug("sieve script error, falling through to default delivery",
+			slog.String("mailbox", mailbox),
+			slog.String("error", err.Error()),
+		)
+		userScript = nil
 	}
 
-	slog.Debug("loaded sieve script", slog.String("mailbox", mailbox), slog.Int("commands", len(cmds)))
-	return cmds, nil
+	ev := s.SieveEvaluator(mailbox)
+	if userScript == nil && ev.SystemScript == nil {
+		return nil
+	}
+
+	actions, err := ev.Evaluate(userScript, envelope, bytes.NewReader(data))
+	if err != nil && userScript != nil && ev.SystemScript != nil {
+		slog.Warn("user sieve script failed, evaluating system script only",
+			slog.String("mailbox", mailbox),
+			slog.String("error", err.Error()),
+		)
+		actions, err = ev.Evaluate(nil, envelope, bytes.NewReader(data))
+	}
+	if err != nil {
+		slog.Warn("sieve evaluation failed, falling through to default delivery",
+			slog.String("mailbox", mailbox),
+			slog.String("error", err.Error()),
+		)
+		return nil
+	}
+
+	for _, action := range actions {
+		attrs := []any{
+			slog.String("mailbox", mailbox),
+			slog.String("action", string(action.Type)),
+			slog.String("folder", action.Mailbox),
+			slog.String("address", action.Address),
+			slog.Bool("implicit", action.Implicit),
+		}
+		if action.System {
+			slog.Info("system sieve action", attrs...)
+		} else {
+			slog.Debug("sieve action", attrs...)
+		}
+	}
+	return actions
 }
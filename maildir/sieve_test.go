@@ -0,0 +1,220 @@
+package maildir
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/infodancer/msgstore"
+)
+
+// deliverTestMessage delivers msg to user@example.com and fails the test on error.
+func deliverTestMessage(t *testing.T, store *MaildirStore, msg string) {
+	t.Helper()
+	envelope := msgstore.Envelope{
+		From:       "sender@example.com",
+		Recipients: []string{"user@example.com"},
+	}
+	if err := store.Deliver(context.Background(), envelope, strings.NewReader(msg)); err != nil {
+		t.Fatalf("Deliver failed: %v", err)
+	}
+}
+
+// activateTestScript stores and activates a Sieve script for user@example.com.
+func activateTestScript(t *testing.T, store *MaildirStore, script string) {
+	t.Helper()
+	ctx := context.Background()
+	if err := store.PutScript(ctx, "user@example.com", "main", []byte(script)); err != nil {
+		t.Fatalf("PutScript failed: %v", err)
+	}
+	if err := store.SetActive(ctx, "user@example.com", "main"); err != nil {
+		t.Fatalf("SetActive failed: %v", err)
+	}
+}
+
+// countMessages returns the number of messages in a folder ("INBOX" for the inbox).
+func countMessages(t *testing.T, store *MaildirStore, folder string) int {
+	t.Helper()
+	ctx := context.Background()
+	var msgs []msgstore.MessageInfo
+	var err error
+	if folder == "INBOX" {
+		msgs, err = store.List(ctx, "user@example.com")
+	} else {
+		msgs, err = store.ListInFolder(ctx, "user@example.com", folder)
+	}
+	if err != nil {
+		t.Fatalf("list %s failed: %v", folder, err)
+	}
+	return len(msgs)
+}
+
+func TestDeliver_SieveFileInto(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	activateTestScript(t, store, `require "fileinto"; if header :contains "Subject" "invoice" { fileinto "Work"; }`)
+	if err := store.CreateFolder(context.Background(), "user@example.com", "Work"); err != nil {
+		t.Fatalf("CreateFolder failed: %v", err)
+	}
+
+	deliverTestMessage(t, store, "Subject: invoice 12\r\n\r\npay")
+	deliverTestMessage(t, store, "Subject: hello\r\n\r\nhi")
+
+	if n := countMessages(t, store, "Work"); n != 1 {
+		t.Errorf("Work has %d messages, want 1", n)
+	}
+	if n := countMessages(t, store, "INBOX"); n != 1 {
+		t.Errorf("INBOX has %d messages, want 1", n)
+	}
+}
+
+func TestDeliver_SieveFileIntoMissingFolderKeeps(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	activateTestScript(t, store, `require "fileinto"; fileinto "Nowhere";`)
+
+	deliverTestMessage(t, store, "Subject: hello\r\n\r\nhi")
+
+	if n := countMessages(t, store, "INBOX"); n != 1 {
+		t.Errorf("INBOX has %d messages, want 1", n)
+	}
+}
+
+func TestDeliver_SieveDiscardAndFlags(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	activateTestScript(t, store, `require "imap4flags";
+if header :is "Subject" "drop" { discard; stop; }
+keep :flags "\\Seen";`)
+
+	deliverTestMessage(t, store, "Subject: drop\r\n\r\nbye")
+	deliverTestMessage(t, store, "Subject: keep\r\n\r\nhi")
+
+	msgs, err := store.List(context.Background(), "user@example.com")
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(msgs) != 1 {
+		t.Fatalf("expected 1 message, got %d", len(msgs))
+	}
+	if len(msgs[0].Flags) != 1 || msgs[0].Flags[0] != "\\Seen" {
+		t.Errorf("flags = %v, want [\\Seen]", msgs[0].Flags)
+	}
+}
+
+func TestDeliver_SieveSystemScript(t *testing.T) {
+	systemPath := filepath.Join(t.TempDir(), "before.sieve")
+	system := `require "fileinto"; if exists "X-Spam-Flag" { fileinto "Junk"; stop; }`
+	if err := os.WriteFile(systemPath, []byte(system), 0600); err != nil {
+		t.Fatal(err)
+	}
+	store := NewStore(t.TempDir(), "", "", WithSieveSystemScript(systemPath))
+	if err := store.EnsureDefaultFolders(context.Background(), "user@example.com"); err != nil {
+		t.Fatalf("EnsureDefaultFolders failed: %v", err)
+	}
+	activateTestScript(t, store, `require "fileinto"; fileinto "Sent";`)
+
+	deliverTestMessage(t, store, "X-Spam-Flag: YES\r\nSubject: win\r\n\r\nmoney")
+	deliverTestMessage(t, store, "Subject: hello\r\n\r\nhi")
+
+	if n := countMessages(t, store, "Junk"); n != 1 {
+		t.Errorf("Junk has %d messages, want 1", n)
+	}
+	if n := countMessages(t, store, "Sent"); n != 1 {
+		t.Errorf("Sent has %d messages, want 1", n)
+	}
+}
+
+func TestDeliver_SieveSystemScriptSurvivesBrokenUserScript(t *testing.T) {
+	systemPath := filepath.Join(t.TempDir(), "before.sieve")
+	system := `require "fileinto"; if exists "X-Spam-Flag" { fileinto "Junk"; }`
+	if err := os.WriteFile(systemPath, []byte(system), 0600); err != nil {
+		t.Fatal(err)
+	}
+	basePath := t.TempDir()
+	store := NewStore(basePath, "", "", WithSieveSystemScript(systemPath))
+	if err := store.EnsureDefaultFolders(context.Background(), "user@example.com"); err != nil {
+		t.Fatalf("EnsureDefaultFolders failed: %v", err)
+	}
+	// A script that parses but fails evaluation (fileinto without require).
+	if err := os.WriteFile(filepath.Join(basePath, "user", ".sieve"), []byte(`fileinto "Sent";`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	deliverTestMessage(t, store, "X-Spam-Flag: YES\r\nSubject: win\r\n\r\nmoney")
+
+	if n := countMessages(t, store, "Junk"); n != 1 {
+		t.Errorf("Junk has %d messages, want 1", n)
+	}
+}
+
+func TestDeliver_SieveRedirect(t *testing.T) {
+	relay := &recordingRelay{}
+	store := NewStore(t.TempDir(), "", "", WithRelay(relay.relay))
+	activateTestScript(t, store, `redirect "archive@example.net";`)
+
+	deliverTestMessage(t, store, "Subject: hello\r\n\r\nhi")
+
+	if len(relay.envelopes) != 1 || relay.envelopes[0].Recipients[0] != "archive@example.net" {
+		t.Fatalf("unexpected relayed envelopes: %+v", relay.envelopes)
+	}
+	if n := countMessages(t, store, "INBOX"); n != 0 {
+		t.Errorf("INBOX has %d messages, want 0", n)
+	}
+}
+
+func TestDeliver_SieveRejectBounces(t *testing.T) {
+	relay := &recordingRelay{}
+	store := NewStore(t.TempDir(), "", "", WithRelay(relay.relay), WithHostname("mx.example.com"))
+	activateTestScript(t, store, `require "reject"; reject "not wanted";`)
+
+	deliverTestMessage(t, store, "Subject: hello\r\n\r\nhi")
+
+	if len(relay.envelopes) != 1 {
+		t.Fatalf("expected 1 relayed bounce, got %d", len(relay.envelopes))
+	}
+	env := relay.envelopes[0]
+	if env.From != "" || len(env.Recipients) != 1 || env.Recipients[0] != "sender@example.com" {
+		t.Errorf("unexpected bounce envelope: %+v", env)
+	}
+	if n := countMessages(t, store, "INBOX"); n != 0 {
+		t.Errorf("INBOX has %d messages, want 0", n)
+	}
+}
+
+func TestDeliver_SieveRejectWithoutRelayKeeps(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	activateTestScript(t, store, `require "reject"; reject "not wanted";`)
+
+	deliverTestMessage(t, store, "Subject: hello\r\n\r\nhi")
+
+	if n := countMessages(t, store, "INBOX"); n != 1 {
+		t.Errorf("INBOX has %d messages, want 1", n)
+	}
+}
+
+func TestMaildirStore_SieveDir(t *testing.T) {
+	basePath := t.TempDir()
+	sieveBase := t.TempDir()
+	store := NewStore(basePath, "", "", WithSieveDir(filepath.Join(sieveBase, "{domain}", "{localpart}")))
+	ctx := context.Background()
+
+	if err := store.CreateFolder(ctx, "user@example.com", "Work"); err != nil {
+		t.Fatalf("CreateFolder: %v", err)
+	}
+	activateTestScript(t, store, `require "fileinto"; fileinto "Work";`)
+	if _, err := os.Lstat(filepath.Join(sieveBase, "example.com", "user", ".sieve")); err != nil {
+		t.Fatalf("active script not in the sieve directory: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(basePath, "user", ".sieve")); !os.IsNotExist(err) {
+		t.Errorf("active script also in the mailbox root: %v", err)
+	}
+
+	deliverTestMessage(t, store, "Subject: filed\r\n\r\nbody\r\n")
+	if n := countMessages(t, store, "Work"); n != 1 {
+		t.Errorf("Work has %d messages, want 1", n)
+	}
+
+	if _, err := store.ListScripts(ctx, "../../etc@example.com"); err == nil {
+		t.Error("ListScripts accepted a mailbox escaping the sieve directory")
+	}
+}
@@ -0,0 +1,312 @@
+package maildir
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	gosieve "git.sr.ht/~emersion/go-sieve"
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+const (
+	// sieveScriptDir is the directory, relative to the mailbox root, holding
+	// the named scripts managed through msgstore.SieveStore.
+	sieveScriptDir = "sieve"
+
+	// sieveScriptExt is the filename extension of stored scripts.
+	sieveScriptExt = ".sieve"
+
+	// legacyScriptName is the name given to a plain .sieve file that predates
+	// script management when it is moved into the script directory.
+	legacyScriptName = "legacy"
+)
+
+// validateScriptName checks that a script name is safe to use as a filename.
+// ManageSieve allows almost any UTF-8 string; we reject only what cannot be
+// stored safely: path separators, leading dots and control characters.
+func validateScriptName(name string) error {
+	if name == "" || len(name) > 200 {
+		return errors.ErrInvalidScriptName
+	}
+	if strings.HasPrefix(name, ".") || strings.ContainsRune(name, '/') {
+		return errors.ErrInvalidScriptName
+	}
+	for _, r := range name {
+		if unicode.IsControl(r) || r == unicode.ReplacementChar {
+			return errors.ErrInvalidScriptName
+		}
+	}
+	return nil
+}
+
+// scriptRoot resolves the Sieve root for script operations and migrates a
+// legacy .sieve file into the script directory if one is present.
+func (s *MaildirStore) scriptRoot(mailbox string) (string, error) {
+	root, err := s.sieveRoot(mailbox)
+	if err != nil {
+		return "", err
+	}
+	if err := migrateLegacySieve(s.fs, root); err != nil {
+		return "", err
+	}
+	return root, nil
+}
+
+// migrateLegacySieve moves a plain .sieve file written before script
+// management existed into the script directory and re-activates it through
+// a symlink, so that activating another script never discards it.
+func migrateLegacySieve(fsys FS, root string) error {
+	activePath := filepath.Join(root, ".sieve")
+	fi, err := fsys.Lstat(activePath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !fi.Mode().IsRegular() {
+		return nil
+	}
+
+	if err := fsys.MkdirAll(filepath.Join(root, sieveScriptDir), 0700); err != nil {
+		return err
+	}
+	name := legacyScriptName
+	for i := 1; ; i++ {
+		if _, err := fsys.Lstat(scriptFile(root, name)); os.IsNotExist(err) {
+			break
+		}
+		name = legacyScriptName + "-" + strconv.Itoa(i)
+	}
+	if err := fsys.Rename(activePath, scriptFile(root, name)); err != nil {
+		return err
+	}
+	return activateScript(fsys, root, name)
+}
+
+// scriptFile returns the path of a named script under root.
+func scriptFile(root, name string) string {
+	return filepath.Join(root, sieveScriptDir, name+sieveScriptExt)
+}
+
+// activeScriptName returns the name of the active script, or "" if none is active.
+func activeScriptName(fsys FS, root string) (string, error) {
+	target, err := fsys.Readlink(filepath.Join(root, ".sieve"))
+	if os.IsNotExist(err) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if filepath.Dir(target) != sieveScriptDir || !strings.HasSuffix(target, sieveScriptExt) {
+		return "", nil
+	}
+	return strings.TrimSuffix(filepath.Base(target), sieveScriptExt), nil
+}
+
+// activateScript atomically points the .sieve symlink at the named script.
+func activateScript(fsys FS, root, name string) error {
+	activePath := filepath.Join(root, ".sieve")
+	tmpPath := activePath + ".tmp"
+	_ = fsys.Remove(tmpPath)
+	target := filepath.Join(sieveScriptDir, name+sieveScriptExt)
+	if err := fsys.Symlink(target, tmpPath); err != nil {
+		return err
+	}
+	if err := fsys.Rename(tmpPath, activePath); err != nil {
+		_ = fsys.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// ListScripts implements msgstore.SieveStore.
+func (s *MaildirStore) ListScripts(ctx context.Context, mailbox string) ([]msgstore.SieveScriptInfo, error) {
+	root, err := s.scriptRoot(mailbox)
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := s.fs.ReadDir(filepath.Join(root, sieveScriptDir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	active, err := activeScriptName(s.fs, root)
+	if err != nil {
+		return nil, err
+	}
+
+	var scripts []msgstore.SieveScriptInfo
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !strings.HasSuffix(name, sieveScriptExt) {
+			continue
+		}
+		name = strings.TrimSuffix(name, sieveScriptExt)
+		if validateScriptName(name) != nil {
+			continue
+		}
+		scripts = append(scripts, msgstore.SieveScriptInfo{Name: name, Active: name == active})
+	}
+	sort.Slice(scripts, func(i, j int) bool { return scripts[i].Name < scripts[j].Name })
+	return scripts, nil
+}
+
+// GetScript implements msgstore.SieveStore.
+func (s *MaildirStore) GetScript(ctx context.Context, mailbox string, name string) ([]byte, error) {
+	if err := validateScriptName(name); err != nil {
+		return nil, err
+	}
+	root, err := s.scriptRoot(mailbox)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := s.fs.ReadFile(scriptFile(root, name))
+	if os.IsNotExist(err) {
+		return nil, errors.ErrScriptNotFound
+	}
+	return data, err
+}
+
+// PutScript implements msgstore.SieveStore.
+// The script is written to a temporary file and renamed into place, so an
+// active script is never observed half-written by a concurrent delivery.
+func (s *MaildirStore) PutScript(ctx context.Context, mailbox string, name string, script []byte) error {
+	if err := validateScriptName(name); err != nil {
+		return err
+	}
+	if err := s.CheckScript(ctx, script); err != nil {
+		return err
+	}
+	root, err := s.scriptRoot(mailbox)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(root, sieveScriptDir)
+	if err := s.fs.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	tmp, err := s.fs.CreateTemp(dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(script); err != nil {
+		_ = tmp.Close()
+		_ = s.fs.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = s.fs.Remove(tmp.Name())
+		return err
+	}
+	if err := s.fs.Rename(tmp.Name(), scriptFile(root, name)); err != nil {
+		_ = s.fs.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// SetActive implements msgstore.SieveStore.
+func (s *MaildirStore) SetActive(ctx context.Context, mailbox string, name string) error {
+	root, err := s.scriptRoot(mailbox)
+	if err != nil {
+		return err
+	}
+
+	if name == "" {
+		err := s.fs.Remove(filepath.Join(root, ".sieve"))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	if err := validateScriptName(name); err != nil {
+		return err
+	}
+	if _, err := s.fs.Stat(scriptFile(root, name)); os.IsNotExist(err) {
+		return errors.ErrScriptNotFound
+	}
+	return activateScript(s.fs, root, name)
+}
+
+// DeleteScript implements msgstore.SieveStore.
+func (s *MaildirStore) DeleteScript(ctx context.Context, mailbox string, name string) error {
+	if err := validateScriptName(name); err != nil {
+		return err
+	}
+	root, err := s.scriptRoot(mailbox)
+	if err != nil {
+		return err
+	}
+
+	active, err := activeScriptName(s.fs, root)
+	if err != nil {
+		return err
+	}
+	if active == name {
+		return errors.ErrScriptActive
+	}
+
+	err = s.fs.Remove(scriptFile(root, name))
+	if os.IsNotExist(err) {
+		return errors.ErrScriptNotFound
+	}
+	return err
+}
+
+// CheckScript implements msgstore.SieveStore.
+func (s *MaildirStore) CheckScript(ctx context.Context, script []byte) error {
+	if _, err := gosieve.Parse(bytes.NewReader(script)); err != nil {
+		return fmt.Errorf("%w: %w", errors.ErrInvalidScript, err)
+	}
+	return nil
+}
+
+// SieveEvaluator returns an evaluator configured as at delivery time for
+// mailbox: include :personal resolves against the mailbox's stored scripts,
+// include :global against the directory configured with WithSieveGlobalDir,
+// and the script configured with WithSieveSystemScript runs first.
+func (s *MaildirStore) SieveEvaluator(mailbox string) msgstore.SieveEvaluator {
+	return msgstore.SieveEvaluator{
+		Include: func(name string, global bool) ([]byte, error) {
+			return s.includeScript(mailbox, name, global)
+		},
+		SystemScript: s.loadSystemSieveScript(),
+	}
+}
+
+// includeScript loads a script referenced by an include command.
+func (s *MaildirStore) includeScript(mailbox, name string, global bool) ([]byte, error) {
+	if err := validateScriptName(name); err != nil {
+		return nil, err
+	}
+	if !global {
+		return s.GetScript(context.Background(), mailbox, name)
+	}
+	if s.sieveGlobalDir == "" {
+		return nil, errors.ErrScriptNotFound
+	}
+	data, err := s.fs.ReadFile(filepath.Join(s.sieveGlobalDir, name+sieveScriptExt))
+	if os.IsNotExist(err) {
+		return nil, errors.ErrScriptNotFound
+	}
+	return data, err
+}
+
+// Compile-time interface verification.
+var _ msgstore.SieveStore = (*MaildirStore)(nil)
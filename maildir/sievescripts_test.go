@@ -0,0 +1,197 @@
+package maildir
+
+import (
+	"context"
+	stderrors "errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+const testScript = `require "fileinto";
+if header :contains "Subject" "invoice" { fileinto "Work"; }
+`
+
+func TestMaildirStore_PutAndGetScript(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+
+	if err := store.PutScript(ctx, "user@example.com", "main", []byte(testScript)); err != nil {
+		t.Fatalf("PutScript failed: %v", err)
+	}
+
+	got, err := store.GetScript(ctx, "user@example.com", "main")
+	if err != nil {
+		t.Fatalf("GetScript failed: %v", err)
+	}
+	if string(got) != testScript {
+		t.Errorf("GetScript = %q, want %q", got, testScript)
+	}
+
+	if _, err := store.GetScript(ctx, "user@example.com", "missing"); err != errors.ErrScriptNotFound {
+		t.Errorf("expected ErrScriptNotFound, got %v", err)
+	}
+}
+
+func TestMaildirStore_PutScriptInvalid(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+
+	err := store.PutScript(ctx, "user@example.com", "broken", []byte(`keep; }`))
+	if !stderrors.Is(err, errors.ErrInvalidScript) {
+		t.Fatalf("expected ErrInvalidScript, got %v", err)
+	}
+
+	scripts, err := store.ListScripts(ctx, "user@example.com")
+	if err != nil {
+		t.Fatalf("ListScripts failed: %v", err)
+	}
+	if len(scripts) != 0 {
+		t.Errorf("invalid script was stored: %v", scripts)
+	}
+}
+
+func TestMaildirStore_ScriptNameValidation(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+
+	for _, name := range []string{"", ".hidden", "../escape", "a/b", "tab\there"} {
+		if err := store.PutScript(ctx, "user@example.com", name, []byte(testScript)); err != errors.ErrInvalidScriptName {
+			t.Errorf("PutScript(%q): expected ErrInvalidScriptName, got %v", name, err)
+		}
+	}
+}
+
+func TestMaildirStore_SetActive(t *testing.T) {
+	basePath := t.TempDir()
+	store := NewStore(basePath, "", "")
+	ctx := context.Background()
+	mailbox := "user@example.com"
+
+	for _, name := range []string{"one", "two"} {
+		if err := store.PutScript(ctx, mailbox, name, []byte(testScript)); err != nil {
+			t.Fatalf("PutScript(%s) failed: %v", name, err)
+		}
+	}
+	if err := store.SetActive(ctx, mailbox, "two"); err != nil {
+		t.Fatalf("SetActive failed: %v", err)
+	}
+
+	scripts, err := store.ListScripts(ctx, mailbox)
+	if err != nil {
+		t.Fatalf("ListScripts failed: %v", err)
+	}
+	if len(scripts) != 2 || scripts[0].Name != "one" || scripts[0].Active || scripts[1].Name != "two" || !scripts[1].Active {
+		t.Fatalf("unexpected script list: %+v", scripts)
+	}
+
+	// The active script is what delivery loads.
+	script, err := store.loadSieveScript(mailbox)
+	if err != nil || string(script) != testScript {
+		t.Fatalf("loadSieveScript after SetActive: script=%q err=%v", script, err)
+	}
+
+	if err := store.SetActive(ctx, mailbox, "missing"); err != errors.ErrScriptNotFound {
+		t.Errorf("expected ErrScriptNotFound, got %v", err)
+	}
+
+	if err := store.SetActive(ctx, mailbox, ""); err != nil {
+		t.Fatalf("SetActive(\"\") failed: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(basePath, "user", ".sieve")); !os.IsNotExist(err) {
+		t.Errorf("expected .sieve to be removed after deactivation, got %v", err)
+	}
+}
+
+func TestMaildirStore_DeleteScript(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+	mailbox := "user@example.com"
+
+	if err := store.PutScript(ctx, mailbox, "main", []byte(testScript)); err != nil {
+		t.Fatalf("PutScript failed: %v", err)
+	}
+	if err := store.SetActive(ctx, mailbox, "main"); err != nil {
+		t.Fatalf("SetActive failed: %v", err)
+	}
+
+	if err := store.DeleteScript(ctx, mailbox, "main"); err != errors.ErrScriptActive {
+		t.Errorf("expected ErrScriptActive, got %v", err)
+	}
+	if err := store.SetActive(ctx, mailbox, ""); err != nil {
+		t.Fatalf("SetActive(\"\") failed: %v", err)
+	}
+	if err := store.DeleteScript(ctx, mailbox, "main"); err != nil {
+		t.Fatalf("DeleteScript failed: %v", err)
+	}
+	if err := store.DeleteScript(ctx, mailbox, "main"); err != errors.ErrScriptNotFound {
+		t.Errorf("expected ErrScriptNotFound, got %v", err)
+	}
+}
+
+func TestMaildirStore_LegacySieveMigrated(t *testing.T) {
+	basePath := t.TempDir()
+	store := NewStore(basePath, "", "")
+	ctx := context.Background()
+	mailbox := "user@example.com"
+
+	root := filepath.Join(basePath, "user")
+	if err := os.MkdirAll(root, 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, ".sieve"), []byte(testScript), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	scripts, err := store.ListScripts(ctx, mailbox)
+	if err != nil {
+		t.Fatalf("ListScripts failed: %v", err)
+	}
+	if len(scripts) != 1 || scripts[0].Name != legacyScriptName || !scripts[0].Active {
+		t.Fatalf("expected active legacy script, got %+v", scripts)
+	}
+
+	got, err := store.GetScript(ctx, mailbox, legacyScriptName)
+	if err != nil || string(got) != testScript {
+		t.Errorf("legacy script content = %q, err %v", got, err)
+	}
+}
+
+func TestMaildirStore_SieveEvaluatorIncludes(t *testing.T) {
+	globalDir := t.TempDir()
+	store := NewStore(t.TempDir(), "", "", WithSieveGlobalDir(globalDir))
+	ctx := context.Background()
+	mailbox := "user@example.com"
+
+	global := `require "fileinto"; if header :contains "Subject" "viagra" { fileinto "Junk"; stop; }`
+	if err := os.WriteFile(filepath.Join(globalDir, "spam.sieve"), []byte(global), 0600); err != nil {
+		t.Fatal(err)
+	}
+	personal := `require "fileinto"; if header :contains "Subject" "invoice" { fileinto "Work"; }`
+	if err := store.PutScript(ctx, mailbox, "work", []byte(personal)); err != nil {
+		t.Fatalf("PutScript failed: %v", err)
+	}
+
+	script := []byte(`require "include"; include :global "spam"; include :personal "work";`)
+	ev := store.SieveEvaluator(mailbox)
+
+	actions, err := ev.Evaluate(script, msgstore.Envelope{}, strings.NewReader("Subject: cheap viagra\r\n\r\nbody"))
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	if len(actions) != 1 || actions[0].Mailbox != "Junk" {
+		t.Errorf("expected fileinto Junk, got %+v", actions)
+	}
+
+	actions, err = ev.Evaluate(script, msgstore.Envelope{}, strings.NewReader("Subject: invoice 7\r\n\r\nbody"))
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	if len(actions) != 1 || actions[0].Mailbox != "Work" {
+		t.Errorf("expected fileinto Work, got %+v", actions)
+	}
+}
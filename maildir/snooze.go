@@ -0,0 +1,108 @@
+package maildir
+
+import (
+	"context"
+	"log/slog"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+// Annotations recording why a message sits in msgstore.SnoozedFolder.
+const (
+	snoozeUntilKey  = "snooze.until"  // wake time, RFC 3339
+	snoozeFolderKey = "snooze.folder" // folder to return to
+)
+
+// Snooze implements msgstore.Snoozer.
+// The wake time and origin folder are kept as annotations on the snoozed
+// message, so they survive restarts.
+func (s *MaildirStore) Snooze(ctx context.Context, mailbox string, folder string, uids []string, until time.Time) (map[string]string, error) {
+	if folder == "" {
+		folder = "INBOX"
+	}
+	if strings.EqualFold(folder, msgstore.SnoozedFolder) {
+		return nil, errors.ErrInvalidFolderName
+	}
+	if err := s.CreateFolder(ctx, mailbox, msgstore.SnoozedFolder); err != nil && err != errors.ErrFolderExists {
+		return nil, err
+	}
+	snoozed, err := s.MoveMessages(ctx, mailbox, folder, uids, msgstore.SnoozedFolder)
+	if err != nil {
+		return snoozed, err
+	}
+	wake := until.UTC().Format(time.RFC3339)
+	for _, uid := range snoozed {
+		if err := s.SetAnnotation(ctx, mailbox, msgstore.SnoozedFolder, uid, snoozeUntilKey, wake); err != nil {
+			return snoozed, err
+		}
+		if err := s.SetAnnotation(ctx, mailbox, msgstore.SnoozedFolder, uid, snoozeFolderKey, folder); err != nil {
+			return snoozed, err
+		}
+	}
+	return snoozed, nil
+}
+
+// wakeSnoozed moves the snoozed messages of mailbox that are due at now
+// back to their folder, or to the inbox if that folder is gone, and marks
+// them recent. Messages without a readable wake time wake immediately.
+func (s *MaildirStore) wakeSnoozed(ctx context.Context, mailbox string, now time.Time) error {
+	messages, _, err := s.listFolder(mailbox, msgstore.SnoozedFolder, "", nil)
+	if err == errors.ErrFolderNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	due := make(map[string][]string) // origin folder -> uids
+	for _, m := range messages {
+		notes, err := s.GetAnnotations(ctx, mailbox, msgstore.SnoozedFolder, m.UID)
+		if err != nil {
+			return err
+		}
+		if until, err := time.Parse(time.RFC3339, notes[snoozeUntilKey]); err == nil && until.After(now) {
+			continue
+		}
+		folder := notes[snoozeFolderKey]
+		if _, _, err := s.folderDir(mailbox, folder); folder == "" || err != nil {
+			folder = "INBOX"
+		}
+		due[folder] = append(due[folder], m.UID)
+	}
+	folders := make([]string, 0, len(due))
+	for folder := range due {
+		folders = append(folders, folder)
+	}
+	sort.Strings(folders)
+
+	for _, folder := range folders {
+		woken, err := s.MoveMessages(ctx, mailbox, msgstore.SnoozedFolder, due[folder], folder)
+		if err != nil {
+			return err
+		}
+		uids := make([]string, 0, len(woken))
+		for _, uid := range woken {
+			uids = append(uids, uid)
+			for _, key := range []string{snoozeUntilKey, snoozeFolderKey} {
+				if err := s.SetAnnotation(ctx, mailbox, folder, uid, key, ""); err != nil {
+					slog.Error("clearing snooze annotation", "mailbox", mailbox, "folder", folder, "uid", uid, "error", err)
+				}
+			}
+		}
+		path, _, err := s.folderDir(mailbox, folder)
+		if err != nil {
+			return err
+		}
+		if err := s.recent.add(s.fs, path, uids); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Compile-time interface verification.
+var _ msgstore.Snoozer = (*MaildirStore)(nil)
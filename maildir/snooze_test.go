@@ -0,0 +1,68 @@
+package maildir
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/infodancer/msgstore"
+)
+
+func TestMaildirStore_Snooze(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+	mailbox := "user@example.com"
+
+	if err := store.CreateFolder(ctx, mailbox, "Work"); err != nil {
+		t.Fatalf("CreateFolder: %v", err)
+	}
+	uids, err := store.AppendMultiple(ctx, mailbox, "Work", []msgstore.AppendItem{
+		{Message: strings.NewReader("Subject: soon\r\n\r\n"), Flags: []string{"\\Seen"}},
+		{Message: strings.NewReader("Subject: later\r\n\r\n"), Flags: []string{"\\Seen"}},
+	})
+	if err != nil {
+		t.Fatalf("AppendMultiple: %v", err)
+	}
+
+	soon, err := store.Snooze(ctx, mailbox, "Work", uids[:1], time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("Snooze: %v", err)
+	}
+	if _, err := store.Snooze(ctx, mailbox, "Work", uids[1:], time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Snooze: %v", err)
+	}
+	if msgs, _ := store.ListInFolder(ctx, mailbox, "Work"); len(msgs) != 0 {
+		t.Fatalf("Work still lists %v", msgs)
+	}
+
+	if err := store.Maintain(ctx, mailbox); err != nil {
+		t.Fatalf("Maintain: %v", err)
+	}
+
+	msgs, err := store.ListWithOptions(ctx, mailbox, "Work", msgstore.WithSession("s1"))
+	if err != nil {
+		t.Fatalf("ListWithOptions: %v", err)
+	}
+	if len(msgs) != 1 || msgs[0].UID != soon[uids[0]] {
+		t.Fatalf("Work = %v, want the woken message", msgs)
+	}
+	if !hasFlag(msgs[0].Flags, "\\Recent") {
+		t.Errorf("woken message flags = %v, want \\Recent", msgs[0].Flags)
+	}
+	if notes, _ := store.GetAnnotations(ctx, mailbox, "Work", msgs[0].UID); len(notes) != 0 {
+		t.Errorf("woken message keeps annotations %v", notes)
+	}
+	if snoozed, _ := store.ListInFolder(ctx, mailbox, msgstore.SnoozedFolder); len(snoozed) != 1 {
+		t.Errorf("Snoozed = %v, want the later message", snoozed)
+	}
+}
+
+func hasFlag(flags []string, flag string) bool {
+	for _, f := range flags {
+		if f == flag {
+			return true
+		}
+	}
+	return false
+}
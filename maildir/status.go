@@ -0,0 +1,163 @@
+package maildir
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/infodancer/msgstore"
+)
+
+// statusRacyWindow is how recently a directory may have changed for its
+// cached status to be distrusted: a change within the same mtime tick as
+// the scan would otherwise go unnoticed.
+const statusRacyWindow = time.Second
+
+// statusCache caches folder counters keyed by soft-delete tracking key.
+// An entry is valid while the mtimes of new/ and cur/ are unchanged; any
+// delivery, flag change or removal renames a file in one of them.
+type statusCache struct {
+	mu      sync.Mutex
+	entries map[string]statusCacheEntry
+}
+
+// statusCacheEntry is a cached scan result.
+type statusCacheEntry struct {
+	path   string
+	newMod time.Time
+	curMod time.Time
+	status msgstore.FolderStatus
+}
+
+// get returns the cached status for key if it is still valid.
+func (c *statusCache) get(key, path string, newMod, curMod time.Time) (msgstore.FolderStatus, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok || e.path != path || !e.newMod.Equal(newMod) || !e.curMod.Equal(curMod) {
+		return msgstore.FolderStatus{}, false
+	}
+	return e.status, true
+}
+
+// put caches a status for key.
+func (c *statusCache) put(key string, e statusCacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[string]statusCacheEntry)
+	}
+	c.entries[key] = e
+}
+
+// invalidate drops the cached status for key, for changes that do not touch
+// the filesystem (marking messages for deletion).
+func (c *statusCache) invalidate(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+}
+
+// Status implements msgstore.StatusStore.
+func (s *MaildirStore) Status(ctx context.Context, mailbox string, folder string) (msgstore.FolderStatus, error) {
+	path, deletionKey, err := s.folderDir(mailbox, folder)
+	if err != nil {
+		return msgstore.FolderStatus{}, err
+	}
+	if folder == "" {
+		folder = "INBOX"
+	}
+	uidValidity, err := s.UIDValidity(ctx, mailbox, folder)
+	if err != nil {
+		return msgstore.FolderStatus{}, err
+	}
+
+	newInfo, err := s.fs.Stat(filepath.Join(path, "new"))
+	if err != nil {
+		return msgstore.FolderStatus{}, err
+	}
+	curInfo, err := s.fs.Stat(filepath.Join(path, "cur"))
+	if err != nil {
+		return msgstore.FolderStatus{}, err
+	}
+	newMod, curMod := newInfo.ModTime(), curInfo.ModTime()
+
+	status, ok := s.statusCache.get(deletionKey, path, newMod, curMod)
+	if !ok {
+		status, err = s.scanStatus(path, deletionKey)
+		if err != nil {
+			return msgstore.FolderStatus{}, err
+		}
+		if now := time.Now(); now.Sub(newMod) > statusRacyWindow && now.Sub(curMod) > statusRacyWindow {
+			s.statusCache.put(deletionKey, statusCacheEntry{path: path, newMod: newMod, curMod: curMod, status: status})
+		}
+	}
+
+	// Messages already moved out of new/ stay recent until a session claims
+	// them. Claiming renames nothing, so this is never cached.
+	unclaimed, err := s.recent.unclaimed(s.fs, path)
+	if err != nil {
+		return msgstore.FolderStatus{}, err
+	}
+	for _, uid := range unclaimed {
+		if !s.isDeleted(deletionKey, uid) {
+			status.Recent++
+		}
+	}
+	status.UIDValidity = uidValidity
+	return status, nil
+}
+
+// scanStatus counts the messages in a maildir without moving anything out
+// of new/: messages still in new/ are both recent and unseen. Recent
+// messages already in cur/ are counted by the caller.
+func (s *MaildirStore) scanStatus(path, deletionKey string) (msgstore.FolderStatus, error) {
+	var status msgstore.FolderStatus
+	for _, sub := range []string{"new", "cur"} {
+		entries, err := s.fs.ReadDir(filepath.Join(path, sub))
+		if err != nil {
+			return msgstore.FolderStatus{}, err
+		}
+		for _, entry := range entries {
+			if !entry.Type().IsRegular() {
+				continue
+			}
+			key, info, _ := strings.Cut(entry.Name(), ":")
+			if s.isDeleted(deletionKey, key) {
+				continue
+			}
+			size, err := entrySize(entry)
+			if err != nil {
+				continue // removed since ReadDir
+			}
+			status.Messages++
+			status.Size += size
+			if sub == "new" {
+				status.Recent++
+				status.Unseen++
+			} else if !strings.HasPrefix(info, "2,") || !strings.Contains(info[2:], "S") {
+				status.Unseen++
+			}
+		}
+	}
+	return status, nil
+}
+
+// entrySize returns the size of a message from the S= attribute of its
+// name, or from the file if the name has none.
+func entrySize(entry fs.DirEntry) (int64, error) {
+	if f, err := ParseFilename(entry.Name()); err == nil && f.Size >= 0 {
+		return f.Size, nil
+	}
+	fi, err := entry.Info()
+	if err != nil {
+		return 0, err
+	}
+	return fi.Size(), nil
+}
+
+// Compile-time interface verification.
+var _ msgstore.StatusStore = (*MaildirStore)(nil)
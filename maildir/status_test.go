@@ -0,0 +1,101 @@
+package maildir
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/infodancer/msgstore"
+)
+
+func TestMaildirStore_Status(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+	mailbox := "user@example.com"
+
+	const msg = "Subject: hi\r\n\r\nhello"
+	for i := 0; i < 3; i++ {
+		deliverTestMessage(t, store, msg)
+	}
+
+	status, err := store.Status(ctx, mailbox, "INBOX")
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	uidValidity, _ := store.UIDValidity(ctx, mailbox, "INBOX")
+	want := msgstore.FolderStatus{Messages: 3, Unseen: 3, Recent: 3, Size: 3 * int64(len(msg)), UIDValidity: uidValidity}
+	if status != want {
+		t.Errorf("Status = %+v, want %+v", status, want)
+	}
+
+	// Listing moves messages out of new/ but, without a session, claims no
+	// recency; marking one seen and another deleted is reflected in the
+	// counters.
+	msgs, err := store.List(ctx, mailbox)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if err := store.SetFlagsInFolder(ctx, mailbox, "INBOX", msgs[0].UID, msgstore.FlagModeSet, []string{"\\Seen"}); err != nil {
+		t.Fatalf("SetFlagsInFolder failed: %v", err)
+	}
+	if err := store.Delete(ctx, mailbox, msgs[1].UID); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	status, err = store.Status(ctx, mailbox, "")
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	want = msgstore.FolderStatus{Messages: 2, Unseen: 1, Recent: 2, Size: 2 * int64(len(msg)), UIDValidity: uidValidity}
+	if status != want {
+		t.Errorf("Status = %+v, want %+v", status, want)
+	}
+
+	if _, err := store.Status(ctx, mailbox, "Nowhere"); err == nil {
+		t.Error("expected error for missing folder")
+	}
+}
+
+func TestMaildirStore_StatusCached(t *testing.T) {
+	basePath := t.TempDir()
+	store := NewStore(basePath, "", "")
+	ctx := context.Background()
+	deliverTestMessage(t, store, "Subject: hi\r\n\r\nhello")
+
+	// Age the directories past the racy window so the scan is cached.
+	path := filepath.Join(basePath, "user")
+	old := time.Now().Add(-time.Hour)
+	for _, sub := range []string{"new", "cur"} {
+		if err := os.Chtimes(filepath.Join(path, sub), old, old); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first, err := store.Status(ctx, "user@example.com", "INBOX")
+	if err != nil || first.Messages != 1 {
+		t.Fatalf("Status = %+v, %v", first, err)
+	}
+
+	// A file added behind the store's back, with the mtime restored, is
+	// not noticed: proof the counters came from the cache.
+	if err := os.WriteFile(filepath.Join(path, "new", "1.extra.host"), []byte("x"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(filepath.Join(path, "new"), old, old); err != nil {
+		t.Fatal(err)
+	}
+	cached, err := store.Status(ctx, "user@example.com", "INBOX")
+	if err != nil || cached != first {
+		t.Fatalf("Status = %+v, %v; want cached %+v", cached, err, first)
+	}
+
+	// Any real change to the directory invalidates the entry.
+	now := time.Now()
+	if err := os.Chtimes(filepath.Join(path, "new"), now, now); err != nil {
+		t.Fatal(err)
+	}
+	fresh, err := store.Status(ctx, "user@example.com", "INBOX")
+	if err != nil || fresh.Messages != 2 {
+		t.Fatalf("Status after change = %+v, %v; want 2 messages", fresh, err)
+	}
+}
@@ -3,11 +3,16 @@ package maildir
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"hash/fnv"
 	"io"
+	"io/fs"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"regexp"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
@@ -15,18 +20,82 @@ import (
 
 	"github.com/emersion/go-maildir"
 	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/dsn"
 	"github.com/infodancer/msgstore/errors"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/net/idna"
+	"golang.org/x/text/unicode/norm"
 )
 
 // MaildirStore implements msgstore.MsgStore using the Maildir format.
-// It uses emersion/go-maildir for low-level maildir operations.
+// All I/O goes through an FS (see WithFS); emersion/go-maildir supplies the
+// flag definitions.
 type MaildirStore struct {
+	fs            FS // filesystem for all I/O
 	basePath      string
-	maildirSubdir string // optional subdirectory under each mailbox (e.g., "Maildir")
-	pathTemplate  string // optional path template for domain-aware storage
+	maildirSubdir string                // optional subdirectory under each mailbox (e.g., "Maildir")
+	pathTemplate  string                // optional path template for domain-aware storage
+	resolver      MailboxResolver       // optional per-mailbox root override
+	pathResolver  PathResolver          // optional per-mailbox path under the base
+	delimiter     string                // folder hierarchy delimiter in folder names
+	domainPaths   map[string]DomainPath // optional per-domain layouts
+
+	publicMailbox string          // optional mailbox holding the public folders
+	publicRights  msgstore.Rights // rights every user holds on public folders
+
+	archivePolicies []ArchivePolicy // applied by Maintain
+	expungePolicies []ExpungePolicy // applied by Maintain
+	expungeGrace    time.Duration   // how long expunged messages are held
+
+	sieveGlobalDir    string // optional directory of include :global scripts
+	sieveSystemScript string // optional script evaluated before every user script
+	sieveDirTemplate  string // optional per-user script directory outside the mailbox
+
+	relay    msgstore.RelayFunc // optional outbound transport for redirects and bounces
+	hostname string             // reporting host name for generated bounces
+
+	authservID string // optional authserv-id of stamped Authentication-Results
+
+	tracerProvider trace.TracerProvider // optional; defaults to the global provider
+	auditLogger    msgstore.AuditLogger // optional record of mutating operations
+	hooks          hooks                // callbacks registered with OnDeliver etc.
+
+	headerCache *headerCache    // header summaries for ListWithOptions
+	index       *messageIndexes // optional persistent per-folder index
+	keywords    keywordTables   // per-folder keyword letters
+	fsync       bool            // sync stored messages before returning
+	punycode    bool            // expand {domain} in its ASCII form
+	dirMode     fs.FileMode     // mode of created directories
+	fileMode    fs.FileMode     // mode of message files; 0 keeps the default
+	owner       OwnerResolver   // optional owner of mailbox files when root
+	geteuid     func() int      // effective user ID, replaced in tests
+	tmpCleaner  tmpCleaner      // removes stale files from tmp/
+	statusCache statusCache     // folder counters for Status
+	recent      recentTracker   // per-session \Recent state
+	shared      sharedIndex     // guards the index of folders with ACLs
+	scheduleMu  sync.Mutex      // serializes runs of DeliverDue
+
+	// mailboxLocks serializes mutating operations per mailbox, so that
+	// operations on different mailboxes proceed concurrently.
+	mailboxLocks keyedMutex
+
+	// idempotencyLocks serializes deliveries sharing an idempotency key per
+	// mailbox; idempotencyWindow is how long those keys are remembered.
+	idempotencyLocks  keyedMutex
+	idempotencyWindow time.Duration
+
+	// greylistLocks serializes updates of one greylisting triplet.
+	greylistLocks keyedMutex
+	greylist      GreylistPolicy
+
+	// garbageMinAge is how long a mailbox or stale folder must go
+	// unchanged before CollectGarbage removes it.
+	garbageMinAge time.Duration
 
 	// deleted tracks messages marked for deletion.
 	// Keys are mailbox names for INBOX, or composite keys for folders.
+	// deletedMu guards only the map itself; callers changing or consuming a
+	// mailbox's entries hold that mailbox's lock first.
 	deletedMu sync.Mutex
 	deleted   map[string]map[string]bool // key -> uid -> deleted
 }
@@ -36,13 +105,30 @@ type MaildirStore struct {
 // (e.g., "Maildir" for paths like users/testuser/Maildir/).
 // The optional pathTemplate transforms mailbox names using variables:
 // {domain}, {localpart}, {email} (e.g., "{domain}/users/{localpart}").
-func NewStore(basePath string, maildirSubdir string, pathTemplate string) *MaildirStore {
-	return &MaildirStore{
-		basePath:      basePath,
-		maildirSubdir: maildirSubdir,
-		pathTemplate:  pathTemplate,
-		deleted:       make(map[string]map[string]bool),
-	}
+// Further behavior is configured with Option values.
+func NewStore(basePath string, maildirSubdir string, pathTemplate string, opts ...Option) *MaildirStore {
+	s := &MaildirStore{
+		fs:                OSFS{},
+		basePath:          basePath,
+		maildirSubdir:     maildirSubdir,
+		pathTemplate:      pathTemplate,
+		delimiter:         defaultDelimiter,
+		headerCache:       newHeaderCache(defaultHeaderCacheSize),
+		deleted:           make(map[string]map[string]bool),
+		idempotencyWindow: defaultIdempotencyWindow,
+		greylist:          GreylistPolicy{}.withDefaults(),
+		garbageMinAge:     defaultGarbageMinAge,
+		dirMode:           defaultDirMode,
+		geteuid:           os.Geteuid,
+		tmpCleaner: tmpCleaner{
+			maxAge:   defaultTmpMaxAge,
+			interval: defaultTmpCleanInterval,
+		},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
 }
 
 // splitEmail splits an email address into localpart and domain.
@@ -54,6 +140,23 @@ func splitEmail(email string) (localpart, domain string) {
 	return email, ""
 }
 
+// templateVars returns the values of {email}, {localpart} and {domain} for
+// mailbox. They are NFC-normalized, so that differently composed spellings
+// of an internationalized address share one directory; with
+// WithPunycodeDomains the domain is also converted to its ASCII form.
+func (s *MaildirStore) templateVars(mailbox string) (email, localpart, domain string) {
+	localpart, domain = splitEmail(norm.NFC.String(mailbox))
+	if s.punycode && domain != "" {
+		if ascii, err := idna.Lookup.ToASCII(domain); err == nil {
+			domain = ascii
+		}
+	}
+	if strings.Contains(mailbox, "@") {
+		return localpart + "@" + domain, localpart, domain
+	}
+	return localpart, localpart, domain
+}
+
 // expandMailbox resolves a mailbox identifier to a relative filesystem path.
 //
 // By default (no template), the domain part is stripped: "alice@example.com"
@@ -66,35 +169,106 @@ func splitEmail(email string) (localpart, domain string) {
 //   - {localpart}  — same as default; domain stripped
 //   - {domain}     — use domain only
 //   - {email}      — use the full address as-is
+//   - {hash}       — two hex digits spreading local parts over 256
+//     directories, e.g. "{hash}/{localpart}" (see localpartHash)
+//   - {localpart|lower} etc. — a variable with modifiers (see expandTemplate)
 //   - arbitrary combinations, e.g. "{domain}/users/{localpart}"
+//
+// Domains configured with WithDomainPaths use their own template. Path
+// components longer than NAME_MAX are shortened (see shortenComponents).
 func (s *MaildirStore) expandMailbox(mailbox string) string {
-	localpart, domain := splitEmail(mailbox)
-	if s.pathTemplate == "" {
-		return localpart
-	}
-	result := s.pathTemplate
-	result = strings.ReplaceAll(result, "{domain}", domain)
-	result = strings.ReplaceAll(result, "{localpart}", localpart)
-	result = strings.ReplaceAll(result, "{email}", mailbox)
-	return result
+	email, localpart, domain := s.templateVars(mailbox)
+	_, pathTemplate := s.mailboxLayout(mailbox)
+	if pathTemplate == "" {
+		return shortenName(localpart)
+	}
+	return expandTemplate(pathTemplate, email, localpart, domain)
+}
+
+// localpartHash returns the {hash} template variable of localpart: the
+// first two hex digits of the SHA-256 of the local part, so administrators
+// can find a mailbox with
+//
+//	printf %s alice | sha256sum | cut -c1-2
+func localpartHash(localpart string) string {
+	sum := sha256.Sum256([]byte(localpart))
+	return hex.EncodeToString(sum[:1])
+}
+
+// applyModifiers applies the modifiers of a template variable, such as
+// "|lower", to value. ok is false if a modifier is unknown.
+func applyModifiers(value, modifiers string) (_ string, ok bool) {
+	for _, modifier := range strings.Split(modifiers, "|")[1:] {
+		switch modifier {
+		case "lower":
+			value = strings.ToLower(value)
+		default:
+			return "", false
+		}
+	}
+	return value, true
+}
+
+// templateVar matches a template variable with its modifiers, such as
+// {localpart} or {domain|lower}.
+var templateVar = regexp.MustCompile(`\{(domain|localpart|email|hash)((?:\|[a-z]+)*)\}`)
+
+// expandTemplate substitutes {domain}, {localpart}, {email} and {hash} in
+// template. A variable may carry modifiers, applied in order: |lower
+// lower-cases its value. For {hash} they apply to the local part before it
+// is hashed, so {hash|lower} agrees with {localpart|lower}. Variables with
+// unknown modifiers are left as they are. Overlong components of the
+// result are shortened with shortenComponents.
+func expandTemplate(template, email, localpart, domain string) string {
+	return shortenComponents(templateVar.ReplaceAllStringFunc(template, func(token string) string {
+		m := templateVar.FindStringSubmatch(token)
+		var value string
+		switch m[1] {
+		case "domain":
+			value = domain
+		case "localpart", "hash":
+			value = localpart
+		case "email":
+			value = email
+		}
+		value, ok := applyModifiers(value, m[2])
+		if !ok {
+			return token
+		}
+		if m[1] == "hash" {
+			return localpartHash(value)
+		}
+		return value
+	}))
 }
 
 // mailboxPath returns the filesystem path for a mailbox.
-// Returns an error if the resulting path would escape the base directory.
+// Returns an error if the resulting path would escape the base directory,
+// lexically or through a symbolic link.
 func (s *MaildirStore) mailboxPath(mailbox string) (string, error) {
-	// Apply path template transformation (strips domain by default)
-	expandedMailbox := s.expandMailbox(mailbox)
+	if root, ok, err := s.resolveMailbox(mailbox); err != nil {
+		return "", err
+	} else if ok {
+		return filepath.Join(root, s.maildirSubdir), nil
+	}
+
+	// Apply the path resolver or template (strips domain by default)
+	expandedMailbox, err := s.relativeMailboxPath(mailbox)
+	if err != nil {
+		return "", err
+	}
+	basePath, _ := s.mailboxLayout(mailbox)
 
 	// Build the candidate path
 	var candidate string
 	if s.maildirSubdir != "" {
-		candidate = filepath.Join(s.basePath, expandedMailbox, s.maildirSubdir)
+		candidate = filepath.Join(basePath, expandedMailbox, s.maildirSubdir)
 	} else {
-		candidate = filepath.Join(s.basePath, expandedMailbox)
+		candidate = filepath.Join(basePath, expandedMailbox)
 	}
 
 	// Clean both paths to normalize them
-	cleanBase := filepath.Clean(s.basePath)
+	cleanBase := filepath.Clean(basePath)
 	cleanCandidate := filepath.Clean(candidate)
 
 	// Verify the candidate is under the base path
@@ -102,26 +276,37 @@ func (s *MaildirStore) mailboxPath(mailbox string) (string, error) {
 	if !strings.HasPrefix(cleanCandidate+string(filepath.Separator), cleanBase+string(filepath.Separator)) {
 		return "", errors.ErrPathTraversal
 	}
+	// Nor may a symbolic link inside the base path lead out of it.
+	if err := s.checkContained(cleanBase, cleanCandidate); err != nil {
+		return "", err
+	}
 
 	return cleanCandidate, nil
 }
 
+// lockMailbox acquires the per-mailbox operation lock and returns the
+// function that releases it. Folders share their mailbox's lock.
+//
+// The lock is not reentrant: methods holding it must not call other locking
+// methods, and it is never held while running hooks or Sieve actions.
+// CreateFolder does not take it, since creating a mailbox on first use
+// creates its default folders from within other operations.
+func (s *MaildirStore) lockMailbox(mailbox string) (unlock func()) {
+	return s.mailboxLocks.Lock(s.mailboxKey(mailbox))
+}
+
 // ensureMaildir ensures the maildir exists, creating it if necessary.
-func (s *MaildirStore) ensureMaildir(mailbox string) (maildir.Dir, error) {
+func (s *MaildirStore) ensureMaildir(mailbox string) (string, error) {
 	path, err := s.mailboxPath(mailbox)
 	if err != nil {
 		return "", err
 	}
-	dir := maildir.Dir(path)
 
 	// Check if maildir exists by checking for cur/ directory
 	curPath := filepath.Join(path, "cur")
-	if _, err := os.Stat(curPath); os.IsNotExist(err) {
-		// Ensure parent directories exist (needed when maildirSubdir is set)
-		if err := os.MkdirAll(path, 0700); err != nil {
-			return "", err
-		}
-		if err := dir.Init(); err != nil {
+	if _, err := s.fs.Stat(curPath); os.IsNotExist(err) {
+		// Parent directories are created too (needed when maildirSubdir is set)
+		if err := s.createMaildir(mailbox, path); err != nil {
 			return "", err
 		}
 		// Create default folders for newly provisioned mailboxes.
@@ -133,7 +318,7 @@ func (s *MaildirStore) ensureMaildir(mailbox string) (maildir.Dir, error) {
 		}
 	}
 
-	return dir, nil
+	return path, nil
 }
 
 // EnsureDefaultFolders creates all default folders for a mailbox.
@@ -154,54 +339,75 @@ func (s *MaildirStore) EnsureDefaultFolders(ctx context.Context, mailbox string)
 
 // listDir returns message metadata for all non-deleted messages in the given maildir path.
 // deletionKey identifies which set of soft-deleted messages to filter out.
-func (s *MaildirStore) listDir(path string, deletionKey string) ([]msgstore.MessageInfo, error) {
-	dir := maildir.Dir(path)
-
-	// Track which messages were in new/ (recent messages)
-	recentKeys := make(map[string]bool)
-
-	// Unseen() moves messages from new/ to cur/ and returns them
-	// These messages are considered "recent"
-	unseenMsgs, err := dir.Unseen()
+// session selects which recent messages are flagged \Recent (see recentTracker).
+// If match is non-nil, only messages it accepts are returned.
+func (s *MaildirStore) listDir(path string, deletionKey string, session string, match func(msgstore.MessageInfo) bool) ([]msgstore.MessageInfo, error) {
+	// unseenMessages moves messages from new/ to cur/ and returns them.
+	// These messages are recent until a session claims them.
+	unseenMsgs, err := unseenMessages(s.fs, path)
 	if err != nil {
 		return nil, err
 	}
-	for _, msg := range unseenMsgs {
-		recentKeys[msg.Key()] = true
+	unseenKeys := make([]string, len(unseenMsgs))
+	for i, msg := range unseenMsgs {
+		unseenKeys[i] = msg.key
+	}
+	if err := s.recent.add(s.fs, path, unseenKeys); err != nil {
+		return nil, err
 	}
 
-	// Now get all messages (which are all in cur/ after Unseen())
-	allMsgs, err := dir.Messages()
+	// Now get all messages (which are all in cur/ after unseenMessages)
+	allMsgs, err := curMessages(s.fs, path)
 	if err != nil {
 		return nil, err
 	}
+	present := make(map[string]bool, len(allMsgs))
+	for _, msg := range allMsgs {
+		present[msg.key] = true
+	}
+	recentKeys, err := s.recent.claim(s.fs, path, session, present)
+	if err != nil {
+		return nil, err
+	}
+
+	var indexed map[string]indexEntry
+	if s.index != nil {
+		indexed = s.index.reconcile(s.fs, path, allMsgs)
+	}
 
+	keywords := s.keywordNames(path)
 	var messages []msgstore.MessageInfo
 	for _, msg := range allMsgs {
-		key := msg.Key()
+		key := msg.key
 		if s.isDeleted(deletionKey, key) {
 			continue
 		}
 
-		filename := msg.Filename()
-		fi, err := os.Stat(filename)
-		if err != nil {
+		var size int64
+		var date time.Time
+		if entry, ok := indexed[key]; ok {
+			size, date = entry.Size, entry.Date
+		} else if size, date, err = messageAttrs(s.fs, msg.filename); err != nil {
 			continue // Skip on error
 		}
 
-		flags := msg.Flags()
 		var flagStrings []string
 		if recentKeys[key] {
 			flagStrings = append(flagStrings, "\\Recent")
 		}
-		flagStrings = append(flagStrings, convertFlags(flags)...)
+		flagStrings = append(flagStrings, convertFlags(msg.flags)...)
+		flagStrings = append(flagStrings, keywords(msg.flags)...)
 
-		messages = append(messages, msgstore.MessageInfo{
+		info := msgstore.MessageInfo{
 			UID:          key,
-			Size:         fi.Size(),
+			Size:         size,
 			Flags:        flagStrings,
-			InternalDate: fi.ModTime(),
-		})
+			InternalDate: date,
+		}
+		if match != nil && !match(info) {
+			continue
+		}
+		messages = append(messages, info)
 	}
 
 	return messages, nil
@@ -209,29 +415,52 @@ func (s *MaildirStore) listDir(path string, deletionKey string) ([]msgstore.Mess
 
 // retrieveFromDir retrieves a single message from the given maildir path.
 func (s *MaildirStore) retrieveFromDir(path string, uid string) (io.ReadCloser, error) {
-	dir := maildir.Dir(path)
-	msg, err := dir.MessageByKey(uid)
+	msg, err := messageByKey(s.fs, path, uid)
 	if err != nil {
 		return nil, err
 	}
-	return msg.Open()
+	return s.fs.Open(msg.filename)
 }
 
-// removeMessages permanently removes the specified messages from a maildir.
-func (s *MaildirStore) removeMessages(path string, uids map[string]bool) error {
-	dir := maildir.Dir(path)
+// removeMessages permanently removes the specified messages from a maildir
+// in two phases (see expungeStagingDir) and records their tombstones. The
+// caller holds the mailbox lock. It returns the UIDs actually removed,
+// sorted, along with the last error.
+func (s *MaildirStore) removeMessages(mailbox, path string, uids map[string]bool) ([]string, error) {
+	if err := s.finishExpunge(path); err != nil {
+		return nil, err
+	}
+	staging := filepath.Join(path, expungeStagingDir)
+	if err := s.mkdirAll(mailbox, staging); err != nil {
+		return nil, err
+	}
+
+	var removed, staged []string
 	var lastErr error
 	for uid := range uids {
-		msg, err := dir.MessageByKey(uid)
+		msg, err := messageByKey(s.fs, path, uid)
 		if err != nil {
 			// Message might not exist, skip
 			continue
 		}
-		if err := msg.Remove(); err != nil && !os.IsNotExist(err) {
+		dst := filepath.Join(staging, filepath.Base(msg.filename))
+		if err := s.fs.Rename(msg.filename, dst); err != nil {
+			if !os.IsNotExist(err) {
+				lastErr = err
+			}
+			continue
+		}
+		removed = append(removed, uid)
+		staged = append(staged, dst)
+	}
+	sort.Strings(removed)
+	s.recordExpunged(path, removed)
+	for _, file := range staged {
+		if err := s.fs.Remove(file); err != nil && !os.IsNotExist(err) {
 			lastErr = err
 		}
 	}
-	return lastErr
+	return removed, lastErr
 }
 
 // convertFlags converts go-maildir flags to IMAP flag strings.
@@ -267,7 +496,10 @@ func (s *MaildirStore) isDeleted(key, uid string) bool {
 // --- MsgStore interface ---
 
 // Deliver implements msgstore.DeliveryAgent.
-func (s *MaildirStore) Deliver(ctx context.Context, envelope msgstore.Envelope, message io.Reader) error {
+func (s *MaildirStore) Deliver(ctx context.Context, envelope msgstore.Envelope, message io.Reader) (err error) {
+	ctx, span := s.startSpan(ctx, "Deliver", "", attrRecipients.Int(len(envelope.Recipients)))
+	defer func() { endSpan(span, err) }()
+
 	if len(envelope.Recipients) == 0 {
 		return errors.ErrNoRecipients
 	}
@@ -277,76 +509,251 @@ func (s *MaildirStore) Deliver(ctx context.Context, envelope msgstore.Envelope,
 	if err != nil {
 		return err
 	}
+	if s.authservID != "" && envelope.Encryption == nil {
+		data = msgstore.StampAuthenticationResults(data, s.authservID, envelope)
+	}
+	span.SetAttributes(attrMessageSize.Int(len(data)))
 
 	var lastErr error
 	delivered := 0
 
 	for _, recipient := range envelope.Recipients {
-		parsed := msgstore.ParseRecipient(recipient)
+		if err := s.deliverOnce(ctx, envelope, recipient, data); err != nil {
+			lastErr = err
+			continue
+		}
+		delivered++
+	}
+
+	if delivered == 0 && lastErr != nil {
+		return lastErr
+	}
+	return nil
+}
+
+// deliverOnce delivers to recipient unless the envelope's idempotency key
+// shows the message was already delivered there.
+func (s *MaildirStore) deliverOnce(ctx context.Context, envelope msgstore.Envelope, recipient string, data []byte) error {
+	key := envelope.IdempotencyKey
+	if key == "" {
+		return s.deliverToRecipient(ctx, envelope, recipient, data)
+	}
+	mailbox := msgstore.ParseRecipient(recipient).Address
+	defer s.lockDelivery(mailbox, key)()
+	if s.alreadyDelivered(mailbox, key) {
+		slog.Info("skipping repeated delivery",
+			slog.String("mailbox", mailbox),
+			slog.String("idempotency_key", key),
+		)
+		return nil
+	}
+	if err := s.deliverToRecipient(ctx, envelope, recipient, data); err != nil {
+		return err
+	}
+	s.recordDelivery(mailbox, key)
+	return nil
+}
 
-		// Load and parse the user's Sieve script (if any).
-		// TODO(msgstore#14): evaluate the parsed script against this message.
-		// See git.sr.ht/~emersion/go-sieve for the parser; interpreter is not yet implemented.
-		if sieveCmds, err := s.loadSieveScript(parsed.Address); err != nil {
-			slog.Debug("sieve script error, falling through to default delivery",
+// deliverToRecipient stores one copy of a message for a single recipient,
+// applying the actions of the recipient's Sieve scripts. Without scripts,
+// or if evaluation fails, the message is kept at the default target.
+func (s *MaildirStore) deliverToRecipient(ctx context.Context, envelope msgstore.Envelope, recipient string, data []byte) (err error) {
+	parsed := msgstore.ParseRecipient(recipient)
+	ctx, span := s.startSpan(ctx, "DeliverToRecipient", parsed.Address)
+	defer func() { endSpan(span, err) }()
+	defer func() {
+		s.audit(ctx, msgstore.AuditEvent{Op: msgstore.AuditDeliver, Mailbox: parsed.Address, Folder: parsed.Extension}, err)
+	}()
+
+	recipientEnvelope := envelope
+	recipientEnvelope.Recipients = []string{recipient}
+
+	// store writes one copy of the message and notifies OnDeliver hooks.
+	store := func(folder string, dir string, flags []string) error {
+		unlock := s.lockMailbox(parsed.Address)
+		err := s.deliverToDir(ctx, parsed.Address, dir, data, flags)
+		unlock()
+		if err != nil {
+			return err
+		}
+		s.hooks.deliver(ctx, DeliverInfo{
+			Mailbox:  parsed.Address,
+			Folder:   folder,
+			Size:     int64(len(data)),
+			Envelope: recipientEnvelope,
+		})
+		return nil
+	}
+
+	// kept guards against storing a second inbox copy when an action
+	// falls back to keep after an explicit keep has already run.
+	kept := false
+	keep := func(flags []string) error {
+		if kept {
+			return nil
+		}
+		kept = true
+		folder, dir, err := s.keepTarget(parsed)
+		if err != nil {
+			return err
+		}
+		return store(folder, dir, flags)
+	}
+
+	actions := s.sieveActions(parsed.Address, recipientEnvelope, data)
+	if actions == nil {
+		return keep(nil)
+	}
+
+	var firstErr error
+	for _, action := range actions {
+		var err error
+		switch action.Type {
+		case msgstore.SieveKeep:
+			err = keep(action.Flags)
+		case msgstore.SieveFileInto:
+			folder := msgstore.ResolveFolder(action.Mailbox)
+			if strings.EqualFold(folder, "INBOX") {
+				err = keep(action.Flags)
+			} else if dir, ok := s.folderIfExists(parsed.Address, folder); ok {
+				err = store(folder, dir, action.Flags)
+			} else {
+				slog.Warn("sieve fileinto target does not exist, keeping in inbox",
+					slog.String("mailbox", parsed.Address),
+					slog.String("folder", action.Mailbox),
+				)
+				err = keep(action.Flags)
+			}
+		case msgstore.SieveRedirect:
+			if rerr := s.redirect(ctx, envelope, parsed.Address, action.Address, data); rerr != nil {
+				slog.Warn("sieve redirect failed, keeping in inbox",
+					slog.String("mailbox", parsed.Address),
+					slog.String("address", action.Address),
+					slog.String("error", rerr.Error()),
+				)
+				err = keep(nil)
+			}
+		case msgstore.SieveDiscard:
+		case msgstore.SieveReject:
+			if rerr := s.reject(ctx, envelope, parsed.Address, action.Reason, data); rerr != nil {
+				slog.Warn("sieve reject failed, keeping in inbox",
+					slog.String("mailbox", parsed.Address),
+					slog.String("error", rerr.Error()),
+				)
+				err = keep(nil)
+			}
+		default:
+			slog.Warn("sieve action not supported at delivery, keeping in inbox",
 				slog.String("mailbox", parsed.Address),
-				slog.String("error", err.Error()),
+				slog.String("action", string(action.Type)),
 			)
-		} else {
-			_ = sieveCmds // TODO(msgstore#14): interpret
-		}
-
-		// Resolve delivery target. If the recipient has a +extension, deliver
-		// to the matching Maildir++ folder — but only if it already exists.
-		// The user controls which folders accept subaddressed mail: if the
-		// folder does not exist, fall back to the inbox silently.
-		var dir maildir.Dir
-		if parsed.Extension != "" {
-			if folderDir, ok := s.folderIfExists(parsed.Address, parsed.Extension); ok {
-				dir = folderDir
-			}
+			err = keep(nil)
 		}
-		if dir == "" {
-			// Deliver to inbox, creating it on first delivery.
-			var err error
-			dir, err = s.ensureMaildir(parsed.Address)
-			if err != nil {
-				lastErr = err
-				continue
-			}
+		if err != nil && firstErr == nil {
+			firstErr = err
 		}
+	}
+	return firstErr
+}
 
-		// NewDelivery takes the directory path as a string
-		delivery, err := maildir.NewDelivery(string(dir))
-		if err != nil {
-			lastErr = err
-			continue
-		}
+// redirect forwards a message for recipient to address with msgstore.Forward,
+// preserving the original reverse-path.
+func (s *MaildirStore) redirect(ctx context.Context, envelope msgstore.Envelope, recipient, address string, data []byte) error {
+	if s.relay == nil {
+		return errors.ErrNoRelay
+	}
+	forwardEnvelope := envelope
+	forwardEnvelope.Recipients = []string{recipient}
+	return msgstore.Forward(ctx, s.relay, forwardEnvelope, bytes.NewReader(data), []string{address})
+}
 
-		if _, err := io.Copy(delivery, bytes.NewReader(data)); err != nil {
-			_ = delivery.Abort()
-			lastErr = err
-			continue
-		}
+// reject returns a message to its sender as an RFC 3464 bounce. The SMTP
+// transaction has already ended by the time Sieve runs, so the rejection
+// is carried out by relaying a bounce rather than with an SMTP reply.
+func (s *MaildirStore) reject(ctx context.Context, envelope msgstore.Envelope, recipient, reason string, data []byte) error {
+	if s.relay == nil {
+		return errors.ErrNoRelay
+	}
+	if reason == "" {
+		reason = "message rejected by recipient's filter"
+	}
+	hostname := s.hostname
+	if hostname == "" {
+		hostname, _ = os.Hostname()
+	}
+	bounce, err := dsn.Build(envelope, []dsn.Failure{{
+		Recipient:      recipient,
+		Status:         "5.7.1",
+		DiagnosticCode: "550 5.7.1 " + reason,
+		Reason:         reason,
+	}}, dsn.HeaderSection(data), dsn.Options{ReportingMTA: hostname})
+	if err != nil {
+		return err
+	}
+	return s.relay(ctx, bounce.Envelope, bytes.NewReader(bounce.Message))
+}
 
-		if err := delivery.Close(); err != nil {
-			lastErr = err
-			continue
+// keepTarget returns the recipient's default delivery target and its folder
+// name ("" for the inbox). If the recipient has a +extension, the message
+// goes to the matching Maildir++ folder — but only if it already exists. The
+// user controls which folders accept subaddressed mail: if the folder does
+// not exist, fall back to the inbox silently.
+func (s *MaildirStore) keepTarget(parsed msgstore.Recipient) (string, string, error) {
+	if parsed.Extension != "" {
+		if folderDir, ok := s.folderIfExists(parsed.Address, parsed.Extension); ok {
+			return parsed.Extension, folderDir, nil
 		}
-
-		delivered++
 	}
+	// Deliver to inbox, creating it on first delivery.
+	dir, err := s.ensureMaildir(parsed.Address)
+	if err != nil {
+		return "", "", err
+	}
+	return "", dir, nil
+}
 
-	if delivered == 0 && lastErr != nil {
-		return lastErr
+// deliverToDir writes a message into a maildir of mailbox. Messages without flags are
+// delivered to new/ as usual; messages with flags (from Sieve imap4flags) go
+// directly to cur/ so the flags are recorded in the filename. Imports (see
+// msgstore.WithImport) also go to cur/, with their own flags added and
+// their internal date.
+func (s *MaildirStore) deliverToDir(ctx context.Context, mailbox, dir string, data []byte, flags []string) error {
+	imp, importing := msgstore.ImportFromContext(ctx)
+	mdFlags, err := s.flagsFromIMAP(dir, slices.Concat(flags, imp.Flags), true)
+	if err != nil {
+		return err
 	}
-	return nil
+	prepare, err := s.prepareFile(mailbox)
+	if err != nil {
+		return err
+	}
+	s.cleanTmp(dir)
+	delivery, err := newDelivery(s.fs, dir, imp.Date)
+	if err != nil {
+		return err
+	}
+	delivery.durable = s.fsync
+	delivery.prepare = prepare
+	if _, err := io.Copy(delivery, bytes.NewReader(data)); err != nil {
+		_ = delivery.abort()
+		return err
+	}
+	if importing || len(mdFlags) > 0 {
+		return delivery.closeToCur(applyFlagMode(nil, mdFlags, msgstore.FlagModeSet))
+	}
+	return delivery.Close()
 }
 
 // List implements msgstore.MessageStore.
 // If the maildir does not yet exist it is created automatically, so that a
 // newly-provisioned user can log in before any mail has been delivered.
-func (s *MaildirStore) List(ctx context.Context, mailbox string) ([]msgstore.MessageInfo, error) {
+func (s *MaildirStore) List(ctx context.Context, mailbox string) (messages []msgstore.MessageInfo, err error) {
+	_, span := s.startSpan(ctx, "List", mailbox)
+	defer func() {
+		span.SetAttributes(attrMessages.Int(len(messages)))
+		endSpan(span, err)
+	}()
+
 	path, err := s.mailboxPath(mailbox)
 	if err != nil {
 		return nil, err
@@ -356,11 +763,14 @@ func (s *MaildirStore) List(ctx context.Context, mailbox string) ([]msgstore.Mes
 		return nil, err
 	}
 
-	return s.listDir(path, mailbox)
+	return s.listDir(path, mailbox, "", nil)
 }
 
 // Retrieve implements msgstore.MessageStore.
-func (s *MaildirStore) Retrieve(ctx context.Context, mailbox string, uid string) (io.ReadCloser, error) {
+func (s *MaildirStore) Retrieve(ctx context.Context, mailbox string, uid string) (_ io.ReadCloser, err error) {
+	_, span := s.startSpan(ctx, "Retrieve", mailbox)
+	defer func() { endSpan(span, err) }()
+
 	if s.isDeleted(mailbox, uid) {
 		return nil, errors.ErrMessageDeleted
 	}
@@ -372,15 +782,29 @@ func (s *MaildirStore) Retrieve(ctx context.Context, mailbox string, uid string)
 
 	// Check if maildir exists
 	curPath := filepath.Join(path, "cur")
-	if _, err := os.Stat(curPath); os.IsNotExist(err) {
+	if _, err := s.fs.Stat(curPath); os.IsNotExist(err) {
 		return nil, errors.ErrMailboxNotFound
 	}
 
-	return s.retrieveFromDir(path, uid)
+	rc, err := s.retrieveFromDir(path, uid)
+	if err != nil {
+		return nil, err
+	}
+	s.hooks.retrieve(ctx, RetrieveInfo{Mailbox: mailbox, UID: uid})
+	return rc, nil
 }
 
 // Delete implements msgstore.MessageStore.
-func (s *MaildirStore) Delete(ctx context.Context, mailbox string, uid string) error {
+func (s *MaildirStore) Delete(ctx context.Context, mailbox string, uid string) (err error) {
+	defer func() {
+		s.audit(ctx, msgstore.AuditEvent{Op: msgstore.AuditDelete, Mailbox: mailbox, UID: uid}, err)
+	}()
+	defer s.lockMailbox(mailbox)()
+	if err := s.checkUnchanged(ctx, mailbox, ""); err != nil {
+		return err
+	}
+	s.statusCache.invalidate(mailbox)
+
 	s.deletedMu.Lock()
 	defer s.deletedMu.Unlock()
 
@@ -392,28 +816,54 @@ func (s *MaildirStore) Delete(ctx context.Context, mailbox string, uid string) e
 }
 
 // Expunge implements msgstore.MessageStore.
-func (s *MaildirStore) Expunge(ctx context.Context, mailbox string) error {
+func (s *MaildirStore) Expunge(ctx context.Context, mailbox string) (removed []string, err error) {
+	_, span := s.startSpan(ctx, "Expunge", mailbox)
+	defer func() { endSpan(span, err) }()
+
+	removed, err = s.expunge(ctx, mailbox, "", mailbox)
+	span.SetAttributes(attrMessages.Int(len(removed)))
+	s.auditExpunge(ctx, mailbox, "", removed, err)
+	s.hooks.expunge(ctx, mailbox, "", removed)
+	return removed, err
+}
+
+// expunge permanently removes the messages marked for deletion under key
+// from the inbox (folder "") or a folder, holding the mailbox lock. It
+// returns the UIDs actually removed, even if removing others failed.
+func (s *MaildirStore) expunge(ctx context.Context, mailbox, folder, key string) ([]string, error) {
+	defer s.lockMailbox(mailbox)()
+	if err := s.checkUnchanged(ctx, mailbox, folder); err != nil {
+		return nil, err
+	}
+
 	s.deletedMu.Lock()
-	deletedUIDs := s.deleted[mailbox]
-	delete(s.deleted, mailbox)
+	deletedUIDs := s.deleted[key]
+	delete(s.deleted, key)
 	s.deletedMu.Unlock()
 
 	if len(deletedUIDs) == 0 {
-		return nil
+		return nil, nil
 	}
 
 	path, err := s.mailboxPath(mailbox)
+	notFound := errors.ErrMailboxNotFound
+	if folder != "" {
+		path, err = s.folderPath(mailbox, folder)
+		notFound = errors.ErrFolderNotFound
+	}
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	// Check if maildir exists
 	curPath := filepath.Join(path, "cur")
-	if _, err := os.Stat(curPath); os.IsNotExist(err) {
-		return errors.ErrMailboxNotFound
+	if _, err := s.fs.Stat(curPath); os.IsNotExist(err) {
+		return nil, notFound
 	}
 
-	return s.removeMessages(path, deletedUIDs)
+	removed, err := s.discardMessages(mailbox, folder, path, deletedUIDs)
+	s.recent.forget(s.fs, path, removed)
+	return removed, err
 }
 
 // Stat implements msgstore.MessageStore.
@@ -438,6 +888,10 @@ func folderDeletionKey(mailbox, folder string) string {
 	return mailbox + "\x00" + folder
 }
 
+// defaultDelimiter is the folder hierarchy delimiter unless configured with
+// WithHierarchyDelimiter. It matches the Maildir++ on-disk separator.
+const defaultDelimiter = "."
+
 // validateFolderName checks that a folder name is valid for Maildir++ storage.
 // Names must be non-empty, contain only alphanumeric characters, hyphens,
 // and underscores, and must not conflict with Maildir directory names.
@@ -465,6 +919,20 @@ func validateFolderName(folder string) error {
 	return nil
 }
 
+// validateFolder checks a possibly nested folder name: each part between
+// hierarchy delimiters must be a valid folder name.
+func (s *MaildirStore) validateFolder(folder string) error {
+	if len(folder) > 255 {
+		return errors.ErrInvalidFolderName
+	}
+	for _, part := range strings.Split(folder, s.delimiter) {
+		if err := validateFolderName(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // isValidFolderChar returns true if the rune is allowed in a folder name.
 func isValidFolderChar(r rune) bool {
 	return (r >= 'a' && r <= 'z') ||
@@ -474,9 +942,11 @@ func isValidFolderChar(r rune) bool {
 }
 
 // folderPath resolves a folder name to its Maildir++ filesystem path.
-// The folder becomes a .foldername subdirectory under the mailbox path.
+// The folder becomes a .foldername subdirectory under the mailbox path;
+// nested folders use "." between levels on disk (.Work.Projects) whatever
+// the hierarchy delimiter.
 func (s *MaildirStore) folderPath(mailbox, folder string) (string, error) {
-	if err := validateFolderName(folder); err != nil {
+	if err := s.validateFolder(folder); err != nil {
 		return "", err
 	}
 
@@ -486,7 +956,7 @@ func (s *MaildirStore) folderPath(mailbox, folder string) (string, error) {
 	}
 
 	// Maildir++ convention: folders are .foldername subdirectories
-	candidate := filepath.Join(basePath, "."+folder)
+	candidate := filepath.Join(basePath, "."+strings.ReplaceAll(folder, s.delimiter, "."))
 
 	// Path traversal check (belt-and-suspenders with validateFolderName)
 	cleanBase := filepath.Clean(basePath)
@@ -494,26 +964,29 @@ func (s *MaildirStore) folderPath(mailbox, folder string) (string, error) {
 	if !strings.HasPrefix(cleanCandidate+string(filepath.Separator), cleanBase+string(filepath.Separator)) {
 		return "", errors.ErrPathTraversal
 	}
+	if err := s.checkContained(cleanBase, cleanCandidate); err != nil {
+		return "", err
+	}
 
 	return cleanCandidate, nil
 }
 
-// folderIfExists returns the maildir.Dir for a folder if it already exists, without
+// folderIfExists returns the maildir path of a folder if it already exists, without
 // creating it. Returns ("", false) if the folder does not exist or the name is invalid.
-func (s *MaildirStore) folderIfExists(mailbox, folder string) (maildir.Dir, bool) {
+func (s *MaildirStore) folderIfExists(mailbox, folder string) (string, bool) {
 	path, err := s.folderPath(mailbox, folder)
 	if err != nil {
 		return "", false
 	}
-	if _, err := os.Stat(filepath.Join(path, "cur")); err != nil {
+	if _, err := s.fs.Stat(filepath.Join(path, "cur")); err != nil {
 		return "", false
 	}
-	return maildir.Dir(path), true
+	return path, true
 }
 
 // ensureFolderMaildir ensures the folder's maildir structure exists, creating it if necessary.
 // Also ensures the parent mailbox exists.
-func (s *MaildirStore) ensureFolderMaildir(mailbox, folder string) (maildir.Dir, error) {
+func (s *MaildirStore) ensureFolderMaildir(mailbox, folder string) (string, error) {
 	// Ensure parent mailbox exists
 	if _, err := s.ensureMaildir(mailbox); err != nil {
 		return "", err
@@ -523,23 +996,23 @@ func (s *MaildirStore) ensureFolderMaildir(mailbox, folder string) (maildir.Dir,
 	if err != nil {
 		return "", err
 	}
-	dir := maildir.Dir(path)
 
 	curPath := filepath.Join(path, "cur")
-	if _, err := os.Stat(curPath); os.IsNotExist(err) {
-		if err := os.MkdirAll(path, 0700); err != nil {
-			return "", err
-		}
-		if err := dir.Init(); err != nil {
+	if _, err := s.fs.Stat(curPath); os.IsNotExist(err) {
+		if err := s.createMaildir(mailbox, path); err != nil {
 			return "", err
 		}
 	}
 
-	return dir, nil
+	return path, nil
 }
 
 // CreateFolder implements msgstore.FolderStore.
-func (s *MaildirStore) CreateFolder(ctx context.Context, mailbox string, folder string) error {
+func (s *MaildirStore) CreateFolder(ctx context.Context, mailbox string, folder string) (err error) {
+	defer func() {
+		s.audit(ctx, msgstore.AuditEvent{Op: msgstore.AuditCreateFolder, Mailbox: mailbox, Folder: folder}, err)
+	}()
+
 	path, err := s.folderPath(mailbox, folder)
 	if err != nil {
 		return err
@@ -547,7 +1020,7 @@ func (s *MaildirStore) CreateFolder(ctx context.Context, mailbox string, folder
 
 	// Check if folder already exists
 	curPath := filepath.Join(path, "cur")
-	if _, err := os.Stat(curPath); err == nil {
+	if _, err := s.fs.Stat(curPath); err == nil {
 		return errors.ErrFolderExists
 	}
 
@@ -557,11 +1030,7 @@ func (s *MaildirStore) CreateFolder(ctx context.Context, mailbox string, folder
 	}
 
 	// Create the folder maildir structure
-	if err := os.MkdirAll(path, 0700); err != nil {
-		return err
-	}
-	dir := maildir.Dir(path)
-	return dir.Init()
+	return s.createMaildir(mailbox, path)
 }
 
 // ListFolders implements msgstore.FolderStore.
@@ -573,11 +1042,11 @@ func (s *MaildirStore) ListFolders(ctx context.Context, mailbox string) ([]strin
 
 	// Check if mailbox exists
 	curPath := filepath.Join(basePath, "cur")
-	if _, err := os.Stat(curPath); os.IsNotExist(err) {
+	if _, err := s.fs.Stat(curPath); os.IsNotExist(err) {
 		return nil, errors.ErrMailboxNotFound
 	}
 
-	entries, err := os.ReadDir(basePath)
+	entries, err := s.fs.ReadDir(basePath)
 	if err != nil {
 		return nil, err
 	}
@@ -588,20 +1057,32 @@ func (s *MaildirStore) ListFolders(ctx context.Context, mailbox string) ([]strin
 		if !entry.IsDir() || !strings.HasPrefix(name, ".") {
 			continue
 		}
+		if name == holdDir || strings.HasPrefix(name, deletedFolderPrefix) {
+			continue
+		}
 		// Verify it has valid maildir structure (contains cur/)
 		folderCur := filepath.Join(basePath, name, "cur")
-		if _, err := os.Stat(folderCur); os.IsNotExist(err) {
+		if _, err := s.fs.Stat(folderCur); os.IsNotExist(err) {
 			continue
 		}
 		// Strip the leading dot to get the folder name
-		folders = append(folders, name[1:])
+		folders = append(folders, strings.ReplaceAll(name[1:], ".", s.delimiter))
 	}
 
 	return folders, nil
 }
 
 // DeleteFolder implements msgstore.FolderStore.
-func (s *MaildirStore) DeleteFolder(ctx context.Context, mailbox string, folder string) error {
+func (s *MaildirStore) DeleteFolder(ctx context.Context, mailbox string, folder string, opts ...msgstore.DeleteFolderOption) (err error) {
+	var o msgstore.DeleteFolderOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	defer func() {
+		s.audit(ctx, msgstore.AuditEvent{Op: msgstore.AuditDeleteFolder, Mailbox: mailbox, Folder: folder}, err)
+	}()
+	defer s.lockMailbox(mailbox)()
+
 	path, err := s.folderPath(mailbox, folder)
 	if err != nil {
 		return err
@@ -609,17 +1090,77 @@ func (s *MaildirStore) DeleteFolder(ctx context.Context, mailbox string, folder
 
 	// Check if folder exists
 	curPath := filepath.Join(path, "cur")
-	if _, err := os.Stat(curPath); os.IsNotExist(err) {
+	if _, err := s.fs.Stat(curPath); os.IsNotExist(err) {
 		return errors.ErrFolderNotFound
 	}
 
-	// Clear any deletion tracking for this folder
-	key := folderDeletionKey(mailbox, folder)
+	paths := []string{path}
+	if o.Recursive {
+		children, err := folderChildren(s.fs, path)
+		if err != nil {
+			return err
+		}
+		for _, suffix := range children {
+			paths = append(paths, path+suffix)
+		}
+	}
+	if !o.Force {
+		for _, p := range paths {
+			empty, err := maildirEmpty(s.fs, p)
+			if err != nil {
+				return err
+			}
+			if !empty {
+				return errors.ErrFolderNotEmpty
+			}
+		}
+	}
+
+	// Clear any deletion tracking for the deleted folders
 	s.deletedMu.Lock()
-	delete(s.deleted, key)
+	for key := range s.deleted {
+		if key == folderDeletionKey(mailbox, folder) || (o.Recursive && strings.HasPrefix(key, folderDeletionKey(mailbox, folder+s.delimiter))) {
+			delete(s.deleted, key)
+		}
+	}
 	s.deletedMu.Unlock()
 
-	return os.RemoveAll(path)
+	// Flag every folder before removing any files, so a crash part way
+	// leaves folders either untouched or flagged for CollectGarbage.
+	now := time.Now()
+	flagged := make([]string, 0, len(paths))
+	for _, p := range paths {
+		f, err := flagForDeletion(s.fs, p, now)
+		if err != nil {
+			return err
+		}
+		flagged = append(flagged, f)
+	}
+	for _, f := range flagged {
+		if err := s.fs.RemoveAll(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// maildirEmpty reports whether a maildir holds no messages in new/ or cur/.
+func maildirEmpty(fsys FS, path string) (bool, error) {
+	for _, sub := range []string{"new", "cur"} {
+		entries, err := fsys.ReadDir(filepath.Join(path, sub))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() && !strings.HasPrefix(entry.Name(), ".") {
+				return false, nil
+			}
+		}
+	}
+	return true, nil
 }
 
 // ListInFolder implements msgstore.FolderStore.
@@ -630,11 +1171,11 @@ func (s *MaildirStore) ListInFolder(ctx context.Context, mailbox string, folder
 	}
 
 	curPath := filepath.Join(path, "cur")
-	if _, err := os.Stat(curPath); os.IsNotExist(err) {
+	if _, err := s.fs.Stat(curPath); os.IsNotExist(err) {
 		return nil, errors.ErrFolderNotFound
 	}
 
-	return s.listDir(path, folderDeletionKey(mailbox, folder))
+	return s.listDir(path, folderDeletionKey(mailbox, folder), "", nil)
 }
 
 // StatFolder implements msgstore.FolderStore.
@@ -664,20 +1205,34 @@ func (s *MaildirStore) RetrieveFromFolder(ctx context.Context, mailbox string, f
 	}
 
 	curPath := filepath.Join(path, "cur")
-	if _, err := os.Stat(curPath); os.IsNotExist(err) {
+	if _, err := s.fs.Stat(curPath); os.IsNotExist(err) {
 		return nil, errors.ErrFolderNotFound
 	}
 
-	return s.retrieveFromDir(path, uid)
+	rc, err := s.retrieveFromDir(path, uid)
+	if err != nil {
+		return nil, err
+	}
+	s.hooks.retrieve(ctx, RetrieveInfo{Mailbox: mailbox, Folder: folder, UID: uid})
+	return rc, nil
 }
 
 // DeleteInFolder implements msgstore.FolderStore.
-func (s *MaildirStore) DeleteInFolder(ctx context.Context, mailbox string, folder string, uid string) error {
-	if err := validateFolderName(folder); err != nil {
+func (s *MaildirStore) DeleteInFolder(ctx context.Context, mailbox string, folder string, uid string) (err error) {
+	defer func() {
+		s.audit(ctx, msgstore.AuditEvent{Op: msgstore.AuditDelete, Mailbox: mailbox, Folder: folder, UID: uid}, err)
+	}()
+
+	if err := s.validateFolder(folder); err != nil {
 		return err
 	}
 
 	key := folderDeletionKey(mailbox, folder)
+	defer s.lockMailbox(mailbox)()
+	if err := s.checkUnchanged(ctx, mailbox, folder); err != nil {
+		return err
+	}
+	s.statusCache.invalidate(key)
 	s.deletedMu.Lock()
 	defer s.deletedMu.Unlock()
 
@@ -689,49 +1244,66 @@ func (s *MaildirStore) DeleteInFolder(ctx context.Context, mailbox string, folde
 }
 
 // ExpungeFolder implements msgstore.FolderStore.
-func (s *MaildirStore) ExpungeFolder(ctx context.Context, mailbox string, folder string) error {
-	key := folderDeletionKey(mailbox, folder)
-
-	s.deletedMu.Lock()
-	deletedUIDs := s.deleted[key]
-	delete(s.deleted, key)
-	s.deletedMu.Unlock()
+func (s *MaildirStore) ExpungeFolder(ctx context.Context, mailbox string, folder string) ([]string, error) {
+	removed, err := s.expunge(ctx, mailbox, folder, folderDeletionKey(mailbox, folder))
+	s.auditExpunge(ctx, mailbox, folder, removed, err)
+	s.hooks.expunge(ctx, mailbox, folder, removed)
+	return removed, err
+}
 
-	if len(deletedUIDs) == 0 {
-		return nil
-	}
+// DeliverToFolder implements msgstore.FolderStore.
+func (s *MaildirStore) DeliverToFolder(ctx context.Context, mailbox string, folder string, message io.Reader) (err error) {
+	defer func() {
+		s.audit(ctx, msgstore.AuditEvent{Op: msgstore.AuditDeliver, Mailbox: mailbox, Folder: folder}, err)
+	}()
 
-	path, err := s.folderPath(mailbox, folder)
+	dir, err := s.ensureFolderMaildir(mailbox, folder)
 	if err != nil {
 		return err
 	}
 
-	curPath := filepath.Join(path, "cur")
-	if _, err := os.Stat(curPath); os.IsNotExist(err) {
-		return errors.ErrFolderNotFound
+	imp, importing := msgstore.ImportFromContext(ctx)
+	var mdFlags []maildir.Flag
+	if importing {
+		if mdFlags, err = s.flagsFromIMAP(dir, imp.Flags, true); err != nil {
+			return err
+		}
 	}
 
-	return s.removeMessages(path, deletedUIDs)
-}
-
-// DeliverToFolder implements msgstore.FolderStore.
-func (s *MaildirStore) DeliverToFolder(ctx context.Context, mailbox string, folder string, message io.Reader) error {
-	dir, err := s.ensureFolderMaildir(mailbox, folder)
+	prepare, err := s.prepareFile(mailbox)
 	if err != nil {
 		return err
 	}
 
-	delivery, err := maildir.NewDelivery(string(dir))
+	s.cleanTmp(dir)
+	delivery, err := newDelivery(s.fs, dir, imp.Date)
 	if err != nil {
 		return err
 	}
+	delivery.durable = s.fsync
+	delivery.prepare = prepare
 
-	if _, err := io.Copy(delivery, message); err != nil {
-		_ = delivery.Abort()
+	size, err := io.Copy(delivery, message)
+	if err != nil {
+		_ = delivery.abort()
+		return err
+	}
+	// The message is written to tmp/ unlocked; only the rename into new/
+	// (cur/ for imports) that makes it visible is serialized with other
+	// operations.
+	unlock := s.lockMailbox(mailbox)
+	if importing {
+		err = delivery.closeToCur(applyFlagMode(nil, mdFlags, msgstore.FlagModeSet))
+	} else {
+		err = delivery.Close()
+	}
+	unlock()
+	if err != nil {
 		return err
 	}
 
-	return delivery.Close()
+	s.hooks.deliver(ctx, DeliverInfo{Mailbox: mailbox, Folder: folder, Size: size})
+	return nil
 }
 
 // folderOrInboxPath returns the filesystem path for a folder or INBOX.
@@ -743,8 +1315,9 @@ func (s *MaildirStore) folderOrInboxPath(mailbox, folder string) (string, error)
 	return s.folderPath(mailbox, folder)
 }
 
-// convertFlagsFromIMAP converts IMAP flag strings to go-maildir flags.
-// Unknown flag strings are silently ignored.
+// convertFlagsFromIMAP converts IMAP system flag strings to go-maildir
+// flags. Other flag strings are silently ignored; keywords need the
+// folder's keywords file (see flagsFromIMAP).
 func convertFlagsFromIMAP(flags []string) []maildir.Flag {
 	var result []maildir.Flag
 	for _, f := range flags {
@@ -764,8 +1337,35 @@ func convertFlagsFromIMAP(flags []string) []maildir.Flag {
 	return result
 }
 
+// applyFlagMode returns the flags resulting from applying flags to current
+// as selected by mode, without duplicates.
+func applyFlagMode(current, flags []maildir.Flag, mode msgstore.FlagMode) []maildir.Flag {
+	set := make(map[maildir.Flag]bool)
+	if mode != msgstore.FlagModeSet {
+		for _, f := range current {
+			set[f] = true
+		}
+	}
+	for _, f := range flags {
+		set[f] = mode != msgstore.FlagModeRemove
+	}
+	var result []maildir.Flag
+	for f, ok := range set {
+		if ok {
+			result = append(result, f)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i] < result[j] })
+	return result
+}
+
 // RenameFolder implements msgstore.FolderStore.
-func (s *MaildirStore) RenameFolder(ctx context.Context, mailbox string, oldName string, newName string) error {
+func (s *MaildirStore) RenameFolder(ctx context.Context, mailbox string, oldName string, newName string) (err error) {
+	defer func() {
+		s.audit(ctx, msgstore.AuditEvent{Op: msgstore.AuditRenameFolder, Mailbox: mailbox, Folder: oldName, Detail: newName}, err)
+	}()
+	defer s.lockMailbox(mailbox)()
+
 	oldPath, err := s.folderPath(mailbox, oldName)
 	if err != nil {
 		return err
@@ -775,20 +1375,77 @@ func (s *MaildirStore) RenameFolder(ctx context.Context, mailbox string, oldName
 		return err
 	}
 
-	if _, err := os.Stat(filepath.Join(oldPath, "cur")); os.IsNotExist(err) {
+	if _, err := s.fs.Stat(filepath.Join(oldPath, "cur")); os.IsNotExist(err) {
 		return errors.ErrFolderNotFound
 	}
-	if _, err := os.Stat(filepath.Join(newPath, "cur")); err == nil {
-		return errors.ErrFolderExists
+	// A folder cannot become its own descendant.
+	if strings.HasPrefix(newName, oldName+s.delimiter) {
+		return errors.ErrInvalidFolderName
 	}
 
-	// Clear deletion tracking for the old name.
-	key := folderDeletionKey(mailbox, oldName)
+	// Rename the folder together with its descendants (.Work.Projects moves
+	// with .Work), checking every target before touching anything.
+	children, err := folderChildren(s.fs, oldPath)
+	if err != nil {
+		return err
+	}
+	renames := [][2]string{{oldPath, newPath}}
+	for _, suffix := range children {
+		renames = append(renames, [2]string{oldPath + suffix, newPath + suffix})
+	}
+	for _, r := range renames {
+		if _, err := s.fs.Lstat(r[1]); err == nil {
+			return errors.ErrFolderExists
+		}
+	}
+
+	// Clear deletion tracking for the old names.
 	s.deletedMu.Lock()
-	delete(s.deleted, key)
+	for key := range s.deleted {
+		if key == folderDeletionKey(mailbox, oldName) || strings.HasPrefix(key, folderDeletionKey(mailbox, oldName+s.delimiter)) {
+			delete(s.deleted, key)
+		}
+	}
 	s.deletedMu.Unlock()
 
-	return os.Rename(oldPath, newPath)
+	for i, r := range renames {
+		if err := s.fs.Rename(r[0], r[1]); err != nil {
+			// Roll back so the family is never split between two names.
+			for j := i - 1; j >= 0; j-- {
+				if rbErr := s.fs.Rename(renames[j][1], renames[j][0]); rbErr != nil {
+					slog.Error("folder rename rollback failed", "mailbox", mailbox, "from", renames[j][1], "to", renames[j][0], "error", rbErr)
+				}
+			}
+			return err
+		}
+	}
+	// Renamed folders start a new incarnation, so that renaming one back
+	// does not restore its old UIDVALIDITY.
+	for _, r := range renames {
+		if err := s.startIncarnation(r[1], false); err != nil {
+			slog.Error("starting folder incarnation", "mailbox", mailbox, "path", r[1], "error", err)
+		}
+	}
+	// ACLs moved with the folders; keep the shared index pointing at them.
+	return s.renameShared(mailbox, oldName, newName)
+}
+
+// folderChildren returns the on-disk name suffixes (e.g. ".Projects") of
+// the Maildir++ descendants of the folder at path, sorted.
+func folderChildren(fsys FS, path string) ([]string, error) {
+	parent, base := filepath.Split(path)
+	entries, err := fsys.ReadDir(parent)
+	if err != nil {
+		return nil, err
+	}
+	var children []string
+	for _, entry := range entries {
+		if entry.IsDir() && strings.HasPrefix(entry.Name(), base+".") {
+			children = append(children, entry.Name()[len(base):])
+		}
+	}
+	sort.Strings(children)
+	return children, nil
 }
 
 // infoFromFlags formats the maildir info field from a list of flags.
@@ -804,121 +1461,101 @@ func infoFromFlags(flags []maildir.Flag) string {
 
 // moveNewToCurWithFlags moves a message from new/ to cur/ with the given flags.
 // Used to make an appended or flag-modified message visible in cur/ immediately.
-func moveNewToCurWithFlags(dirPath string, key string, flags []maildir.Flag) error {
+func moveNewToCurWithFlags(fsys FS, dirPath string, key string, flags []maildir.Flag) error {
 	srcPath := filepath.Join(dirPath, "new", key)
 	// ':' is the maildir info separator on POSIX systems (see maildir spec).
 	dstBasename := key + ":" + infoFromFlags(flags)
 	dstPath := filepath.Join(dirPath, "cur", dstBasename)
-	return os.Rename(srcPath, dstPath)
+	return fsys.Rename(srcPath, dstPath)
 }
 
 // AppendToFolder implements msgstore.FolderStore.
-func (s *MaildirStore) AppendToFolder(ctx context.Context, mailbox string, folder string, r io.Reader, flags []string, date time.Time) (string, error) {
+func (s *MaildirStore) AppendToFolder(ctx context.Context, mailbox string, folder string, r io.Reader, flags []string, date time.Time) (key string, err error) {
+	defer func() {
+		s.audit(ctx, msgstore.AuditEvent{Op: msgstore.AuditAppend, Mailbox: mailbox, Folder: folder, UID: key}, err)
+	}()
+
 	path, err := s.folderOrInboxPath(mailbox, folder)
 	if err != nil {
 		return "", err
 	}
 
-	dir := maildir.Dir(path)
-	if err := os.MkdirAll(path, 0700); err != nil {
+	if err := s.createMaildir(mailbox, path); err != nil {
 		return "", err
 	}
-	if err := dir.Init(); err != nil && !os.IsExist(err) {
+	mdFlags, err := s.flagsFromIMAP(path, flags, true)
+	if err != nil {
 		return "", err
 	}
 
-	// Snapshot new/ before delivery to identify the resulting key.
-	newDir := filepath.Join(path, "new")
-	beforeKeys, err := maildirNewKeys(newDir)
+	prepare, err := s.prepareFile(mailbox)
 	if err != nil {
 		return "", err
 	}
-
-	delivery, err := maildir.NewDelivery(path)
+	delivery, err := newDelivery(s.fs, path, date)
 	if err != nil {
 		return "", err
 	}
+	delivery.durable = s.fsync
+	delivery.prepare = prepare
 	if _, err := io.Copy(delivery, r); err != nil {
-		_ = delivery.Abort()
-		return "", err
-	}
-	if err := delivery.Close(); err != nil {
-		return "", err
-	}
-
-	// Find the newly added key in new/.
-	key, err := maildirNewKey(newDir, beforeKeys)
-	if err != nil {
+		_ = delivery.abort()
 		return "", err
 	}
 
-	// Move from new/ to cur/ with the requested flags. IMAP APPEND messages
-	// are explicitly placed by the client and must be immediately accessible.
-	if err := moveNewToCurWithFlags(path, key, convertFlagsFromIMAP(flags)); err != nil {
+	// Move from tmp/ straight to cur/ with the requested flags. IMAP APPEND
+	// messages are explicitly placed by the client and must be immediately
+	// accessible.
+	defer s.lockMailbox(mailbox)()
+	if err := delivery.closeToCur(mdFlags); err != nil {
 		return "", err
 	}
-
-	return key, nil
+	return delivery.key, nil
 }
 
-// maildirNewKeys returns the set of filenames currently in the new/ directory.
-func maildirNewKeys(newDir string) (map[string]bool, error) {
-	entries, err := os.ReadDir(newDir)
-	if os.IsNotExist(err) {
-		return make(map[string]bool), nil
-	}
-	if err != nil {
-		return nil, err
-	}
-	keys := make(map[string]bool, len(entries))
-	for _, e := range entries {
-		if !e.IsDir() {
-			keys[e.Name()] = true
-		}
+// SetFlagsInFolder implements msgstore.FolderStore.
+func (s *MaildirStore) SetFlagsInFolder(ctx context.Context, mailbox string, folder string, uid string, mode msgstore.FlagMode, flags []string) (err error) {
+	defer func() {
+		s.audit(ctx, msgstore.AuditEvent{Op: msgstore.AuditSetFlags, Mailbox: mailbox, Folder: folder, UID: uid, Detail: strings.Join(flags, " ")}, err)
+	}()
+	defer s.lockMailbox(mailbox)()
+	if err := s.checkUnchanged(ctx, mailbox, folder); err != nil {
+		return err
 	}
-	return keys, nil
-}
 
-// maildirNewKey finds the single new entry in new/ not present in beforeKeys.
-func maildirNewKey(newDir string, beforeKeys map[string]bool) (string, error) {
-	entries, err := os.ReadDir(newDir)
+	path, err := s.folderOrInboxPath(mailbox, folder)
 	if err != nil {
-		return "", err
-	}
-	for _, e := range entries {
-		if !e.IsDir() && !beforeKeys[e.Name()] {
-			return e.Name(), nil
-		}
+		return err
 	}
-	return "", errors.ErrMessageNotFound
-}
-
-// SetFlagsInFolder implements msgstore.FolderStore.
-func (s *MaildirStore) SetFlagsInFolder(ctx context.Context, mailbox string, folder string, uid string, flags []string) error {
-	path, err := s.folderOrInboxPath(mailbox, folder)
+	mdFlags, err := s.flagsFromIMAP(path, flags, mode != msgstore.FlagModeRemove)
 	if err != nil {
 		return err
 	}
-	mdFlags := convertFlagsFromIMAP(flags)
-	dir := maildir.Dir(path)
 
-	// Try cur/ first (most messages live here).
-	msg, err := dir.MessageByKey(uid)
+	// Try cur/ first (most messages live here). The new flag set is
+	// computed up front so the change is a single rename.
+	msg, err := messageByKey(s.fs, path, uid)
 	if err == nil {
-		return msg.SetFlags(mdFlags)
+		err = msg.setFlags(s.fs, applyFlagMode(msg.flags, mdFlags, mode))
+	} else if _, statErr := s.fs.Stat(filepath.Join(path, "new", uid)); statErr == nil {
+		// Fall back to new/: move to cur/ with the requested flags.
+		err = moveNewToCurWithFlags(s.fs, path, uid, applyFlagMode(nil, mdFlags, mode))
+	} else {
+		return errors.ErrMessageNotFound
 	}
-
-	// Fall back to new/: move to cur/ with the requested flags.
-	newPath := filepath.Join(path, "new", uid)
-	if _, statErr := os.Stat(newPath); statErr == nil {
-		return moveNewToCurWithFlags(path, uid, mdFlags)
+	if err == nil {
+		s.recordModified(path, []string{uid})
 	}
-
-	return errors.ErrMessageNotFound
+	return err
 }
 
 // CopyMessage implements msgstore.FolderStore.
-func (s *MaildirStore) CopyMessage(ctx context.Context, mailbox string, srcFolder string, uid string, destFolder string) (string, error) {
+func (s *MaildirStore) CopyMessage(ctx context.Context, mailbox string, srcFolder string, uid string, destFolder string) (newUID string, err error) {
+	defer func() {
+		s.audit(ctx, msgstore.AuditEvent{Op: msgstore.AuditCopy, Mailbox: mailbox, Folder: srcFolder, UID: uid, Detail: destFolder + "/" + newUID}, err)
+	}()
+	defer s.lockMailbox(mailbox)()
+
 	srcPath, err := s.folderOrInboxPath(mailbox, srcFolder)
 	if err != nil {
 		return "", err
@@ -929,81 +1566,86 @@ func (s *MaildirStore) CopyMessage(ctx context.Context, mailbox string, srcFolde
 	}
 
 	// Ensure destination exists.
-	destDir := maildir.Dir(destPath)
-	if err := os.MkdirAll(destPath, 0700); err != nil {
+	if err := s.createMaildir(mailbox, destPath); err != nil {
 		return "", err
 	}
-	if err := destDir.Init(); err != nil && !os.IsExist(err) {
+	prepare, err := s.prepareFile(mailbox)
+	if err != nil {
 		return "", err
 	}
 
-	srcDir := maildir.Dir(srcPath)
-
-	// Try cur/ first. CopyTo places the copy in cur/ and returns the new Message.
-	msg, err := srcDir.MessageByKey(uid)
+	// Try cur/ first. copyTo places the copy in cur/ with the same flags.
+	msg, err := messageByKey(s.fs, srcPath, uid)
 	if err == nil {
-		newMsg, err := msg.CopyTo(destDir)
+		remapped, err := parseMessage(filepath.Split(s.keywordRemapper(srcPath, destPath)(msg.filename)))
+		if err != nil {
+			return "", err
+		}
+		msg.flags = remapped.flags
+		newMsg, err := msg.copyTo(s.fs, destPath, prepare)
 		if err != nil {
 			return "", err
 		}
-		return newMsg.Key(), nil
+		return newMsg.key, nil
 	}
 
 	// Fall back: source is in new/. Read and deliver to destination's new/.
 	newSrcPath := filepath.Join(srcPath, "new", uid)
-	if _, statErr := os.Stat(newSrcPath); statErr != nil {
+	_, date, statErr := messageAttrs(s.fs, newSrcPath)
+	if statErr != nil {
 		return "", errors.ErrMessageNotFound
 	}
 
-	srcFile, err := os.Open(newSrcPath)
+	srcFile, err := s.fs.Open(newSrcPath)
 	if err != nil {
 		return "", err
 	}
 	defer func() { _ = srcFile.Close() }()
 
-	// Snapshot new/ in destination before delivery.
-	destNewDir := filepath.Join(destPath, "new")
-	beforeKeys, err := maildirNewKeys(destNewDir)
-	if err != nil {
-		return "", err
-	}
-
-	delivery, err := maildir.NewDelivery(destPath)
+	delivery, err := newDelivery(s.fs, destPath, date)
 	if err != nil {
 		return "", err
 	}
+	delivery.prepare = prepare
 	if _, err := io.Copy(delivery, srcFile); err != nil {
-		_ = delivery.Abort()
+		_ = delivery.abort()
 		return "", err
 	}
 	if err := delivery.Close(); err != nil {
 		return "", err
 	}
-
-	return maildirNewKey(destNewDir, beforeKeys)
+	return delivery.key, nil
 }
 
 // UIDValidity implements msgstore.FolderStore.
-// Returns a stable hash of the folder's base name. For a persistent
-// implementation, see issue #9.
+// Returns a hash of the folder's base name combined with the incarnation in
+// its change log, which changes when the folder is created again or
+// renamed.
 func (s *MaildirStore) UIDValidity(ctx context.Context, mailbox string, folder string) (uint32, error) {
-	var name string
+	var name, path string
+	var err error
 	if strings.EqualFold(folder, "INBOX") {
-		path, err := s.mailboxPath(mailbox)
-		if err != nil {
+		if path, err = s.ensureMaildir(mailbox); err != nil {
 			return 0, err
 		}
 		name = filepath.Base(path)
 	} else {
+		if path, err = s.folderPath(mailbox, folder); err != nil {
+			return 0, err
+		}
 		name = folder
 	}
+	incarnation, err := readIncarnation(s.fs, path)
+	if err != nil {
+		return 0, err
+	}
 	// Strip any maildir++ flag suffix if present.
 	if i := strings.IndexByte(name, ':'); i >= 0 {
 		name = name[:i]
 	}
 	h := fnv.New32a()
 	h.Write([]byte(name))
-	v := h.Sum32()
+	v := h.Sum32() ^ incarnation
 	if v == 0 {
 		return 1, nil
 	}
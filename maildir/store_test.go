@@ -5,7 +5,10 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"reflect"
+	"sort"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -62,6 +65,44 @@ func TestMaildirStore_DeliverNoRecipients(t *testing.T) {
 	}
 }
 
+func TestMaildirStore_DeliverAuthenticationResults(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "", WithAuthenticationResults("mx.example.com"))
+	ctx := context.Background()
+
+	for _, envelope := range []msgstore.Envelope{
+		{From: "sender@example.org", Recipients: []string{"user@example.com"}, Authentication: &msgstore.AuthenticationResults{DMARC: "pass"}},
+		{From: "sender@example.org", Recipients: []string{"user@example.com"}, Encryption: &msgstore.EncryptionInfo{Encrypted: true}},
+	} {
+		if err := store.Deliver(ctx, envelope, strings.NewReader("Subject: Test\r\n\r\nbody")); err != nil {
+			t.Fatalf("Deliver failed: %v", err)
+		}
+	}
+
+	messages, err := store.List(ctx, "user@example.com")
+	if err != nil || len(messages) != 2 {
+		t.Fatalf("List = %d messages, %v; want 2", len(messages), err)
+	}
+	var stamped int
+	for _, m := range messages {
+		rc, err := store.Retrieve(ctx, "user@example.com", m.UID)
+		if err != nil {
+			t.Fatalf("Retrieve failed: %v", err)
+		}
+		data, _ := io.ReadAll(rc)
+		_ = rc.Close()
+		switch string(data) {
+		case "Authentication-Results: mx.example.com;\r\n\tdmarc=pass\r\nSubject: Test\r\n\r\nbody":
+			stamped++
+		case "Subject: Test\r\n\r\nbody":
+		default:
+			t.Errorf("stored message = %q", data)
+		}
+	}
+	if stamped != 1 {
+		t.Errorf("%d messages stamped, want 1", stamped)
+	}
+}
+
 func TestMaildirStore_List(t *testing.T) {
 	basePath := t.TempDir()
 	store := NewStore(basePath, "", "")
@@ -206,9 +247,22 @@ func TestMaildirStore_Expunge(t *testing.T) {
 	if err := store.Delete(ctx, "user@example.com", uid); err != nil {
 		t.Fatalf("Delete failed: %v", err)
 	}
-	if err := store.Expunge(ctx, "user@example.com"); err != nil {
+	removed, err := store.Expunge(ctx, "user@example.com")
+	if err != nil {
 		t.Fatalf("Expunge failed: %v", err)
 	}
+	if len(removed) != 1 || removed[0] != uid {
+		t.Fatalf("expected removed [%s], got %v", uid, removed)
+	}
+
+	// A second expunge has nothing left to remove
+	removed, err = store.Expunge(ctx, "user@example.com")
+	if err != nil {
+		t.Fatalf("second Expunge failed: %v", err)
+	}
+	if len(removed) != 0 {
+		t.Fatalf("expected nothing removed, got %v", removed)
+	}
 
 	// Retrieve should fail after expunge
 	_, err = store.Retrieve(ctx, "user@example.com", uid)
@@ -600,6 +654,7 @@ func TestMaildirStore_ExpandMailbox(t *testing.T) {
 	tests := []struct {
 		name         string
 		pathTemplate string
+		punycode     bool
 		mailbox      string
 		want         string
 	}{
@@ -645,11 +700,77 @@ func TestMaildirStore_ExpandMailbox(t *testing.T) {
 			mailbox:      "user@example.com",
 			want:         "example.com/user/user@example.com",
 		},
+		{
+			name:         "hash template",
+			pathTemplate: "{hash}/{localpart}",
+			mailbox:      "alice@example.com",
+			want:         "2b/alice",
+		},
+		{
+			name:         "hash with domain",
+			pathTemplate: "{domain}/{hash}/{localpart}",
+			mailbox:      "bob@example.com",
+			want:         "example.com/81/bob",
+		},
+		{
+			name:         "lower-cased variables",
+			pathTemplate: "{domain|lower}/{localpart|lower}",
+			mailbox:      "Alice@Example.COM",
+			want:         "example.com/alice",
+		},
+		{
+			name:         "lower-cased email and hash",
+			pathTemplate: "{hash|lower}/{email|lower}",
+			mailbox:      "ALICE@example.com",
+			want:         "2b/alice@example.com",
+		},
+		{
+			name:         "unknown modifier kept literally",
+			pathTemplate: "{localpart|shout}",
+			mailbox:      "alice@example.com",
+			want:         "{localpart|shout}",
+		},
+		{
+			name:         "decomposed localpart is composed",
+			pathTemplate: "{localpart}",
+			mailbox:      "jose\u0301@example.com",
+			want:         "jos\u00e9",
+		},
+		{
+			name:         "decomposed domain is composed",
+			pathTemplate: "{domain}/{email}",
+			mailbox:      "user@cafe\u0301.example",
+			want:         "caf\u00e9.example/user@caf\u00e9.example",
+		},
+		{
+			name:         "unicode domain kept without punycode",
+			pathTemplate: "{domain}",
+			mailbox:      "user@b\u00fccher.example",
+			want:         "b\u00fccher.example",
+		},
+		{
+			name:         "punycode domain",
+			pathTemplate: "{domain}/{localpart}",
+			punycode:     true,
+			mailbox:      "user@bu\u0308cher.example",
+			want:         "xn--bcher-kva.example/user",
+		},
+		{
+			name:         "punycode email",
+			pathTemplate: "{email}",
+			punycode:     true,
+			mailbox:      "j\u00f6rg@b\u00fccher.example",
+			want:         "j\u00f6rg@xn--bcher-kva.example",
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			store := NewStore("/tmp", "", tt.pathTemplate)
+			var opts []Option
+			if tt.punycode {
+				opts = append(opts, WithPunycodeDomains())
+			}
+			store := NewStore("/tmp", "", tt.pathTemplate, opts...)
 			got := store.expandMailbox(tt.mailbox)
 			if got != tt.want {
 				t.Errorf("expandMailbox(%q) = %q, want %q", tt.mailbox, got, tt.want)
@@ -803,7 +924,11 @@ func TestMaildirStore_CreateFolderInvalidNames(t *testing.T) {
 		"NEW",
 		"Cur",
 		"has space",
-		"has.dot",
+		// "." is the default hierarchy delimiter, so it may only separate
+		// valid names.
+		"trailing.",
+		"empty..part",
+		"nested.new",
 		string([]byte{0x00}),
 		strings.Repeat("a", 256),
 	}
@@ -911,6 +1036,55 @@ func TestMaildirStore_DeleteFolder(t *testing.T) {
 	}
 }
 
+func TestMaildirStore_DeleteFolder_Options(t *testing.T) {
+	basePath := t.TempDir()
+	store := NewStore(basePath, "", "", WithHierarchyDelimiter("/"))
+	ctx := context.Background()
+
+	for _, name := range []string{"Work", "Work/Projects", "Work/Empty", "Workshop"} {
+		if err := store.CreateFolder(ctx, "user@example.com", name); err != nil {
+			t.Fatalf("CreateFolder %s: %v", name, err)
+		}
+	}
+	if _, err := store.AppendToFolder(ctx, "user@example.com", "Work/Projects", strings.NewReader("Subject: x\r\n\r\nbody"), nil, time.Now()); err != nil {
+		t.Fatalf("AppendToFolder: %v", err)
+	}
+	exists := func(name string) bool {
+		_, err := os.Stat(filepath.Join(basePath, "user", name))
+		return err == nil
+	}
+
+	// Non-recursive deletion of an empty parent keeps its children.
+	if err := store.DeleteFolder(ctx, "user@example.com", "Work/Empty"); err != nil {
+		t.Fatalf("DeleteFolder empty: %v", err)
+	}
+	if exists(".Work.Empty") {
+		t.Error("empty folder not deleted")
+	}
+
+	// A non-empty descendant blocks a recursive delete unless forced, and
+	// nothing is deleted.
+	if err := store.DeleteFolder(ctx, "user@example.com", "Work", msgstore.WithRecursive()); err != errors.ErrFolderNotEmpty {
+		t.Fatalf("expected ErrFolderNotEmpty, got %v", err)
+	}
+	if !exists(".Work") || !exists(".Work.Projects") {
+		t.Fatal("refused delete removed folders")
+	}
+	if err := store.DeleteFolder(ctx, "user@example.com", "Work/Projects"); err != errors.ErrFolderNotEmpty {
+		t.Fatalf("expected ErrFolderNotEmpty, got %v", err)
+	}
+
+	if err := store.DeleteFolder(ctx, "user@example.com", "Work", msgstore.WithRecursive(), msgstore.WithForce()); err != nil {
+		t.Fatalf("DeleteFolder recursive force: %v", err)
+	}
+	if exists(".Work") || exists(".Work.Projects") {
+		t.Error("recursive delete left folders behind")
+	}
+	if !exists(".Workshop") {
+		t.Error("recursive delete removed a sibling with a common prefix")
+	}
+}
+
 func TestMaildirStore_DeleteFolderNonexistent(t *testing.T) {
 	basePath := t.TempDir()
 	store := NewStore(basePath, "", "")
@@ -1105,7 +1279,7 @@ func TestMaildirStore_DeleteInFolderAndExpunge(t *testing.T) {
 	}
 
 	// Expunge
-	if err := store.ExpungeFolder(ctx, "user@example.com", "work"); err != nil {
+	if _, err := store.ExpungeFolder(ctx, "user@example.com", "work"); err != nil {
 		t.Fatalf("ExpungeFolder failed: %v", err)
 	}
 
@@ -1251,6 +1425,64 @@ func TestMaildirStore_RenameFolder_DestExists(t *testing.T) {
 	}
 }
 
+func TestMaildirStore_RenameFolder_Hierarchy(t *testing.T) {
+	basePath := t.TempDir()
+	store := NewStore(basePath, "", "", WithHierarchyDelimiter("/"))
+	ctx := context.Background()
+
+	for _, name := range []string{"Work", "Work/Projects", "Work/Projects/Q3", "Workshop", "Other", "Other/Projects"} {
+		if err := store.CreateFolder(ctx, "user@example.com", name); err != nil {
+			t.Fatalf("CreateFolder %s: %v", name, err)
+		}
+	}
+	if _, err := store.AppendToFolder(ctx, "user@example.com", "Work/Projects", strings.NewReader("Subject: x\r\n\r\nbody"), nil, time.Now()); err != nil {
+		t.Fatalf("AppendToFolder: %v", err)
+	}
+
+	folderSet := func() map[string]bool {
+		t.Helper()
+		folders, err := store.ListFolders(ctx, "user@example.com")
+		if err != nil {
+			t.Fatalf("ListFolders: %v", err)
+		}
+		set := make(map[string]bool)
+		for _, f := range folders {
+			set[f] = true
+		}
+		return set
+	}
+
+	// A conflicting descendant aborts the rename before anything moves.
+	if err := store.RenameFolder(ctx, "user@example.com", "Work", "Other"); err != errors.ErrFolderExists {
+		t.Fatalf("expected ErrFolderExists, got %v", err)
+	}
+	if !folderSet()["Work/Projects"] {
+		t.Fatal("failed rename moved a descendant")
+	}
+
+	if err := store.RenameFolder(ctx, "user@example.com", "Work", "Work/Inner"); err != errors.ErrInvalidFolderName {
+		t.Fatalf("expected ErrInvalidFolderName renaming into a descendant, got %v", err)
+	}
+
+	if err := store.RenameFolder(ctx, "user@example.com", "Work", "Archive"); err != nil {
+		t.Fatalf("RenameFolder: %v", err)
+	}
+	folders := folderSet()
+	for _, want := range []string{"Archive", "Archive/Projects", "Archive/Projects/Q3", "Workshop"} {
+		if !folders[want] {
+			t.Errorf("missing %s after rename: %v", want, folders)
+		}
+	}
+	for _, gone := range []string{"Work", "Work/Projects", "Work/Projects/Q3"} {
+		if folders[gone] {
+			t.Errorf("%s still present after rename", gone)
+		}
+	}
+	if count, _, err := store.StatFolder(ctx, "user@example.com", "Archive/Projects"); err != nil || count != 1 {
+		t.Errorf("StatFolder(Archive/Projects) = %d, %v; want 1 message", count, err)
+	}
+}
+
 func TestMaildirStore_AppendToFolder(t *testing.T) {
 	basePath := t.TempDir()
 	store := NewStore(basePath, "", "")
@@ -1317,7 +1549,7 @@ func TestMaildirStore_SetFlagsInFolder(t *testing.T) {
 		t.Fatalf("AppendToFolder: %v", err)
 	}
 
-	if err := store.SetFlagsInFolder(ctx, "user@example.com", "work", uid, []string{"\\Seen", "\\Flagged"}); err != nil {
+	if err := store.SetFlagsInFolder(ctx, "user@example.com", "work", uid, msgstore.FlagModeSet, []string{"\\Seen", "\\Flagged"}); err != nil {
 		t.Fatalf("SetFlagsInFolder: %v", err)
 	}
 
@@ -1341,6 +1573,45 @@ func TestMaildirStore_SetFlagsInFolder(t *testing.T) {
 	}
 }
 
+func TestMaildirStore_SetFlagsInFolder_AddRemove(t *testing.T) {
+	basePath := t.TempDir()
+	store := NewStore(basePath, "", "")
+	ctx := context.Background()
+
+	uid, err := store.AppendToFolder(ctx, "user@example.com", "work", strings.NewReader("Subject: Flags\r\n\r\nBody"), []string{"\\Seen"}, time.Now())
+	if err != nil {
+		t.Fatalf("AppendToFolder: %v", err)
+	}
+
+	flagsOf := func() []string {
+		t.Helper()
+		msgs, err := store.ListInFolder(ctx, "user@example.com", "work")
+		if err != nil {
+			t.Fatalf("ListInFolder: %v", err)
+		}
+		if len(msgs) != 1 {
+			t.Fatalf("expected 1 message, got %d", len(msgs))
+		}
+		flags := append([]string(nil), msgs[0].Flags...)
+		sort.Strings(flags)
+		return flags
+	}
+
+	if err := store.SetFlagsInFolder(ctx, "user@example.com", "work", uid, msgstore.FlagModeAdd, []string{"\\Flagged", "\\Seen"}); err != nil {
+		t.Fatalf("SetFlagsInFolder add: %v", err)
+	}
+	if got, want := flagsOf(), []string{"\\Flagged", "\\Seen"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after add: flags = %v, want %v", got, want)
+	}
+
+	if err := store.SetFlagsInFolder(ctx, "user@example.com", "work", uid, msgstore.FlagModeRemove, []string{"\\Seen", "\\Draft"}); err != nil {
+		t.Fatalf("SetFlagsInFolder remove: %v", err)
+	}
+	if got, want := flagsOf(), []string{"\\Flagged"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("after remove: flags = %v, want %v", got, want)
+	}
+}
+
 func TestMaildirStore_SetFlagsInFolder_INBOX(t *testing.T) {
 	basePath := t.TempDir()
 	store := NewStore(basePath, "", "")
@@ -1351,7 +1622,7 @@ func TestMaildirStore_SetFlagsInFolder_INBOX(t *testing.T) {
 		t.Fatalf("AppendToFolder: %v", err)
 	}
 
-	if err := store.SetFlagsInFolder(ctx, "user@example.com", "INBOX", uid, []string{"\\Answered"}); err != nil {
+	if err := store.SetFlagsInFolder(ctx, "user@example.com", "INBOX", uid, msgstore.FlagModeSet, []string{"\\Answered"}); err != nil {
 		t.Fatalf("SetFlagsInFolder INBOX: %v", err)
 	}
 }
@@ -1365,7 +1636,7 @@ func TestMaildirStore_SetFlagsInFolder_MessageNotFound(t *testing.T) {
 		t.Fatalf("CreateFolder: %v", err)
 	}
 
-	err := store.SetFlagsInFolder(ctx, "user@example.com", "work", "nonexistent-key", []string{"\\Seen"})
+	err := store.SetFlagsInFolder(ctx, "user@example.com", "work", "nonexistent-key", msgstore.FlagModeSet, []string{"\\Seen"})
 	if err != errors.ErrMessageNotFound {
 		t.Fatalf("expected ErrMessageNotFound, got %v", err)
 	}
@@ -1728,3 +1999,58 @@ func TestEnsureMaildir_CreatesDefaultFolders(t *testing.T) {
 		}
 	}
 }
+
+func TestMaildirStore_ConcurrentAppendAndDeliver(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+	mailbox := "user@example.com"
+	if _, err := store.List(ctx, mailbox); err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+
+	const n = 20
+	var wg sync.WaitGroup
+	keys := make(chan string, n)
+	for i := 0; i < n; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			key, err := store.AppendToFolder(ctx, mailbox, "INBOX", strings.NewReader("Subject: append\r\n\r\nx"), []string{"\\Seen"}, time.Now())
+			if err != nil {
+				t.Errorf("AppendToFolder failed: %v", err)
+				return
+			}
+			keys <- key
+		}()
+		go func() {
+			defer wg.Done()
+			envelope := msgstore.Envelope{From: "sender@example.com", Recipients: []string{mailbox}}
+			if err := store.Deliver(ctx, envelope, strings.NewReader("Subject: deliver\r\n\r\ny")); err != nil {
+				t.Errorf("Deliver failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(keys)
+
+	seen := make(map[string]bool)
+	for key := range keys {
+		if seen[key] {
+			t.Errorf("AppendToFolder returned key %s twice", key)
+		}
+		seen[key] = true
+	}
+
+	msgs, err := store.List(ctx, mailbox)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(msgs) != 2*n {
+		t.Fatalf("got %d messages, want %d", len(msgs), 2*n)
+	}
+	for _, msg := range msgs {
+		if seen[msg.UID] != (len(msg.Flags) > 0 && msg.Flags[len(msg.Flags)-1] == "\\Seen") {
+			t.Errorf("message %s flags %v do not match whether it was appended", msg.UID, msg.Flags)
+		}
+	}
+}
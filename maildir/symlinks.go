@@ -0,0 +1,85 @@
+package maildir
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/infodancer/msgstore/errors"
+)
+
+// maxSymlinks bounds the symbolic links followed while resolving one path,
+// as the kernel's ELOOP limit does.
+const maxSymlinks = 40
+
+// resolvePath returns the absolute form of path with every symbolic link
+// resolved through fsys, as filepath.EvalSymlinks does, except that a path
+// whose tail does not exist yet resolves to its existing part joined with
+// the rest, so paths can be checked before they are created.
+func resolvePath(fsys FS, path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	sep := string(filepath.Separator)
+	root := filepath.VolumeName(path) + sep
+	resolved := root
+	todo := strings.Split(strings.TrimPrefix(path, root), sep)
+	links := 0
+	for len(todo) > 0 {
+		name := todo[0]
+		todo = todo[1:]
+		switch name {
+		case "", ".":
+			continue
+		case "..":
+			resolved = filepath.Dir(resolved)
+			continue
+		}
+		next := filepath.Join(resolved, name)
+		fi, err := fsys.Lstat(next)
+		if os.IsNotExist(err) {
+			return filepath.Join(append([]string{next}, todo...)...), nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if fi.Mode()&fs.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+		if links++; links > maxSymlinks {
+			return "", &fs.PathError{Op: "resolve", Path: path, Err: fmt.Errorf("too many symbolic links")}
+		}
+		target, err := fsys.Readlink(next)
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			resolved = filepath.VolumeName(target) + sep
+			target = strings.TrimPrefix(target, resolved)
+		}
+		todo = append(strings.Split(target, sep), todo...)
+	}
+	return resolved, nil
+}
+
+// checkContained verifies that path stays inside base once symbolic links
+// in either are followed, so that a link planted inside the store cannot
+// lead it elsewhere. Links that keep the path inside base are allowed.
+func (s *MaildirStore) checkContained(base, path string) error {
+	resolvedBase, err := resolvePath(s.fs, base)
+	if err != nil {
+		return err
+	}
+	resolved, err := resolvePath(s.fs, path)
+	if err != nil {
+		return err
+	}
+	if resolved != resolvedBase && !strings.HasPrefix(resolved, resolvedBase+string(filepath.Separator)) {
+		return errors.ErrPathTraversal
+	}
+	return nil
+}
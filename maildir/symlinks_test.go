@@ -0,0 +1,80 @@
+package maildir
+
+import (
+	"context"
+	stderrors "errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/infodancer/msgstore/errors"
+)
+
+func TestMaildirStore_SymlinkEscapes(t *testing.T) {
+	basePath := t.TempDir()
+	outside := t.TempDir()
+	store := NewStore(basePath, "", "")
+	ctx := context.Background()
+
+	if err := os.Symlink(outside, filepath.Join(basePath, "mallory")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.List(ctx, "mallory@example.com"); !stderrors.Is(err, errors.ErrPathTraversal) {
+		t.Errorf("List through an escaping mailbox link error = %v, want ErrPathTraversal", err)
+	}
+	if entries, _ := os.ReadDir(outside); len(entries) != 0 {
+		t.Errorf("store wrote outside the base path: %v", entries)
+	}
+
+	// A folder link escaping the mailbox is rejected as well.
+	deliverTestMessage(t, store, "Subject: hi\r\n\r\n")
+	if err := os.Symlink(outside, filepath.Join(basePath, "user", ".Leak")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.ListInFolder(ctx, "user@example.com", "Leak"); !stderrors.Is(err, errors.ErrPathTraversal) {
+		t.Errorf("ListInFolder through an escaping folder link error = %v, want ErrPathTraversal", err)
+	}
+}
+
+func TestMaildirStore_SymlinksInsideBase(t *testing.T) {
+	realBase := t.TempDir()
+	linkedBase := filepath.Join(t.TempDir(), "mail")
+	if err := os.Symlink(realBase, linkedBase); err != nil {
+		t.Fatal(err)
+	}
+	// The base path itself and links staying inside it are fine.
+	store := NewStore(linkedBase, "", "")
+	deliverTestMessage(t, store, "Subject: hi\r\n\r\n")
+	if err := os.Symlink("user", filepath.Join(realBase, "alias")); err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := store.List(context.Background(), "alias@example.com")
+	if err != nil || len(msgs) != 1 {
+		t.Errorf("List through an internal link = %v, %v", msgs, err)
+	}
+}
+
+func TestResolvePath(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.Mkdir(filepath.Join(dir, "real"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("real", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("loop", filepath.Join(dir, "loop")); err != nil {
+		t.Fatal(err)
+	}
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := resolvePath(OSFS{}, filepath.Join(dir, "link", "missing", "..", "new"))
+	if want := filepath.Join(realDir, "real", "new"); err != nil || got != want {
+		t.Errorf("resolvePath = %q, %v; want %q", got, err, want)
+	}
+	if _, err := resolvePath(OSFS{}, filepath.Join(dir, "loop", "x")); err == nil {
+		t.Error("resolvePath followed a link loop without an error")
+	}
+}
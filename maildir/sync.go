@@ -0,0 +1,110 @@
+package maildir
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+const (
+	// syncTokenFormat encodes a folder state as its UIDVALIDITY,
+	// incarnation and highest modification sequence.
+	syncTokenFormat = "v2.%d.%d.%d"
+
+	// legacySyncTokenFormat is the format of tokens that did not record
+	// the incarnation. They are still accepted, but always reset.
+	legacySyncTokenFormat = "v1.%d.%d"
+)
+
+// syncToken is the folder state a sync token identifies.
+type syncToken struct {
+	uidValidity uint32
+	incarnation uint32
+	modSeq      uint64
+	legacy      bool
+}
+
+// String encodes t with syncTokenFormat.
+func (t syncToken) String() string {
+	return fmt.Sprintf(syncTokenFormat, t.uidValidity, t.incarnation, t.modSeq)
+}
+
+// parseSyncToken decodes a token made with syncTokenFormat or
+// legacySyncTokenFormat.
+func parseSyncToken(token string) (syncToken, error) {
+	// Round-tripping rejects trailing garbage and non-canonical numbers.
+	var t syncToken
+	if n, _ := fmt.Sscanf(token, syncTokenFormat, &t.uidValidity, &t.incarnation, &t.modSeq); n == 3 && t.String() == token {
+		return t, nil
+	}
+	t = syncToken{legacy: true}
+	n, _ := fmt.Sscanf(token, legacySyncTokenFormat, &t.uidValidity, &t.modSeq)
+	if n != 2 || fmt.Sprintf(legacySyncTokenFormat, t.uidValidity, t.modSeq) != token {
+		return syncToken{}, errors.ErrInvalidSyncToken
+	}
+	return t, nil
+}
+
+// ChangesSince implements msgstore.SyncStore.
+func (s *MaildirStore) ChangesSince(ctx context.Context, mailbox string, folder string, token string) (msgstore.SyncChanges, error) {
+	var from syncToken
+	if token != "" {
+		var err error
+		if from, err = parseSyncToken(token); err != nil {
+			return msgstore.SyncChanges{}, err
+		}
+	}
+	defer s.lockMailbox(mailbox)()
+
+	messages, path, log, err := s.scanChanges(mailbox, folder)
+	if err != nil {
+		return msgstore.SyncChanges{}, err
+	}
+	current, err := s.UIDValidity(ctx, mailbox, canonicalFolder(folder))
+	if err != nil {
+		return msgstore.SyncChanges{}, err
+	}
+	now := syncToken{uidValidity: current, incarnation: log.Incarnation, modSeq: log.HighestModSeq}
+	changes := msgstore.SyncChanges{Token: now.String()}
+	// A token from another incarnation of the folder describes messages
+	// that are gone, even where the modification sequences line up.
+	since := from.modSeq
+	changes.Reset = token == "" || from.legacy || from.uidValidity != current || from.incarnation != now.incarnation ||
+		since < log.Floor || since > log.HighestModSeq
+	if changes.Reset {
+		since = 0
+	}
+
+	sort.Slice(messages, func(i, j int) bool {
+		if log.Modified[messages[i].UID] != log.Modified[messages[j].UID] {
+			return log.Modified[messages[i].UID] < log.Modified[messages[j].UID]
+		}
+		return messages[i].UID < messages[j].UID
+	})
+	for _, m := range messages {
+		if log.Modified[m.UID] <= since {
+			continue
+		}
+		summary := s.headerSummaryFor(path, m.UID)
+		m.From, m.Subject, m.Date, m.MessageID = summary.from, summary.subject, summary.date, summary.messageID
+		if changes.Reset || log.Arrived[m.UID] > since {
+			changes.Added = append(changes.Added, m)
+		} else {
+			changes.Updated = append(changes.Updated, m)
+		}
+	}
+	if !changes.Reset {
+		for _, t := range log.Expunged {
+			if t.ModSeq > since {
+				changes.Removed = append(changes.Removed, t.UID)
+			}
+		}
+	}
+	return changes, nil
+}
+
+// Compile-time interface verification.
+var _ msgstore.SyncStore = (*MaildirStore)(nil)
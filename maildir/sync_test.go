@@ -0,0 +1,129 @@
+package maildir
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+func TestMaildirStore_ChangesSince(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+	mailbox := "user@example.com"
+
+	uids, err := store.AppendMultiple(ctx, mailbox, "INBOX", []msgstore.AppendItem{
+		{Message: strings.NewReader("Subject: a\r\n\r\na")},
+		{Message: strings.NewReader("Subject: b\r\n\r\nb")},
+	})
+	if err != nil {
+		t.Fatalf("AppendMultiple: %v", err)
+	}
+
+	full, err := store.ChangesSince(ctx, mailbox, "INBOX", "")
+	if err != nil {
+		t.Fatalf("ChangesSince: %v", err)
+	}
+	if !full.Reset || len(full.Added) != 2 || full.Token == "" {
+		t.Fatalf("initial ChangesSince = %+v", full)
+	}
+	if full.Added[0].Subject == "" {
+		t.Error("Added without header summary")
+	}
+
+	// Nothing changed: the token stays the same.
+	same, err := store.ChangesSince(ctx, mailbox, "INBOX", full.Token)
+	if err != nil {
+		t.Fatalf("ChangesSince: %v", err)
+	}
+	if same.Reset || len(same.Added)+len(same.Updated)+len(same.Removed) != 0 || same.Token != full.Token {
+		t.Errorf("ChangesSince without changes = %+v", same)
+	}
+
+	if err := store.SetFlagsInFolder(ctx, mailbox, "INBOX", uids[0], msgstore.FlagModeAdd, []string{"\\Flagged"}); err != nil {
+		t.Fatalf("SetFlagsInFolder: %v", err)
+	}
+	if err := store.Delete(ctx, mailbox, uids[1]); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := store.Expunge(ctx, mailbox); err != nil {
+		t.Fatalf("Expunge: %v", err)
+	}
+	added, err := store.AppendMultiple(ctx, mailbox, "INBOX", []msgstore.AppendItem{
+		{Message: strings.NewReader("Subject: c\r\n\r\nc")},
+	})
+	if err != nil {
+		t.Fatalf("AppendMultiple: %v", err)
+	}
+
+	delta, err := store.ChangesSince(ctx, mailbox, "INBOX", full.Token)
+	if err != nil {
+		t.Fatalf("ChangesSince: %v", err)
+	}
+	if delta.Reset || delta.Token == full.Token {
+		t.Fatalf("delta = %+v", delta)
+	}
+	if len(delta.Added) != 1 || delta.Added[0].UID != added[0] {
+		t.Errorf("Added = %+v, want %s", delta.Added, added[0])
+	}
+	if len(delta.Updated) != 1 || delta.Updated[0].UID != uids[0] {
+		t.Errorf("Updated = %+v, want %s", delta.Updated, uids[0])
+	}
+	if len(delta.Removed) != 1 || delta.Removed[0] != uids[1] {
+		t.Errorf("Removed = %v, want %s", delta.Removed, uids[1])
+	}
+
+	for _, token := range []string{"garbage", "v1.1.2x", "v1.01.2", "v2.1.2.3x", "v2.1.02.3"} {
+		if _, err := store.ChangesSince(ctx, mailbox, "INBOX", token); err != errors.ErrInvalidSyncToken {
+			t.Errorf("ChangesSince(%q) = %v, want ErrInvalidSyncToken", token, err)
+		}
+	}
+}
+
+func TestMaildirStore_ChangesSinceRecreatedFolder(t *testing.T) {
+	store := NewStore(t.TempDir(), "", "")
+	ctx := context.Background()
+	mailbox := "user@example.com"
+
+	appendThree := func() {
+		t.Helper()
+		if _, err := store.AppendMultiple(ctx, mailbox, "Work", []msgstore.AppendItem{
+			{Message: strings.NewReader("Subject: a\r\n\r\na")},
+			{Message: strings.NewReader("Subject: b\r\n\r\nb")},
+			{Message: strings.NewReader("Subject: c\r\n\r\nc")},
+		}); err != nil {
+			t.Fatalf("AppendMultiple: %v", err)
+		}
+	}
+	if err := store.CreateFolder(ctx, mailbox, "Work"); err != nil {
+		t.Fatalf("CreateFolder: %v", err)
+	}
+	appendThree()
+	old, err := store.ChangesSince(ctx, mailbox, "Work", "")
+	if err != nil {
+		t.Fatalf("ChangesSince: %v", err)
+	}
+
+	if err := store.DeleteFolder(ctx, mailbox, "Work", msgstore.WithForce()); err != nil {
+		t.Fatalf("DeleteFolder: %v", err)
+	}
+	if err := store.CreateFolder(ctx, mailbox, "Work"); err != nil {
+		t.Fatalf("CreateFolder: %v", err)
+	}
+	appendThree()
+	got, err := store.ChangesSince(ctx, mailbox, "Work", old.Token)
+	if err != nil {
+		t.Fatalf("ChangesSince: %v", err)
+	}
+	if !got.Reset || len(got.Added) != 3 || got.Token == old.Token {
+		t.Errorf("ChangesSince with a token of the deleted folder = %+v, want a reset", got)
+	}
+
+	// Tokens without an incarnation are accepted but reset.
+	legacy, err := store.ChangesSince(ctx, mailbox, "Work", "v1.1.1")
+	if err != nil || !legacy.Reset || len(legacy.Added) != 3 {
+		t.Errorf("ChangesSince with a v1 token = %+v, %v; want a reset", legacy, err)
+	}
+}
@@ -0,0 +1,78 @@
+package maildir
+
+import (
+	"log/slog"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultTmpMaxAge is the age after which files left in a maildir's
+	// tmp/ are removed, as the maildir specification recommends.
+	defaultTmpMaxAge = 36 * time.Hour
+
+	// defaultTmpCleanInterval is how often each maildir's tmp/ is scanned
+	// for stale files.
+	defaultTmpCleanInterval = time.Hour
+)
+
+// tmpCleaner removes files that crashed deliveries left behind in tmp/.
+// Scans are opportunistic, run before deliveries and rate-limited per
+// maildir, so busy mailboxes do not pay for a directory read on every
+// message.
+type tmpCleaner struct {
+	maxAge   time.Duration // 0 disables cleanup
+	interval time.Duration // minimum time between scans of one maildir
+
+	mu      sync.Mutex
+	scanned map[string]time.Time // maildir path -> last scan
+}
+
+// due reports whether the tmp/ of the maildir at path should be scanned
+// now, and if so records the scan.
+func (c *tmpCleaner) due(path string, now time.Time) bool {
+	if c.maxAge <= 0 {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if last, ok := c.scanned[path]; ok && now.Sub(last) < c.interval {
+		return false
+	}
+	if c.scanned == nil {
+		c.scanned = make(map[string]time.Time)
+	}
+	c.scanned[path] = now
+	return true
+}
+
+// cleanTmp removes files older than the configured age from the tmp/ of
+// the maildir at path, if a scan is due. Failures are only logged, since
+// they must not hold up the delivery that triggered the scan.
+func (s *MaildirStore) cleanTmp(path string) {
+	now := time.Now()
+	if !s.tmpCleaner.due(path, now) {
+		return
+	}
+	dir := filepath.Join(path, "tmp")
+	entries, err := s.fs.ReadDir(dir)
+	if err != nil {
+		return // no tmp/ yet
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || now.Sub(info.ModTime()) < s.tmpCleaner.maxAge {
+			continue
+		}
+		name := filepath.Join(dir, entry.Name())
+		if err := s.fs.Remove(name); err != nil {
+			slog.Warn("removing stale tmp file", "path", name, "error", err)
+			continue
+		}
+		slog.Info("removed stale tmp file", "path", name, "age", now.Sub(info.ModTime()))
+	}
+}
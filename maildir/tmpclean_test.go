@@ -0,0 +1,72 @@
+package maildir
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeTmpFile creates a file in the maildir's tmp/ last modified age ago.
+func writeTmpFile(t *testing.T, path, name string, age time.Duration) string {
+	t.Helper()
+	file := filepath.Join(path, "tmp", name)
+	if err := os.WriteFile(file, []byte("partial"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	at := time.Now().Add(-age)
+	if err := os.Chtimes(file, at, at); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+func TestMaildirStore_DeliveryRemovesStaleTmpFiles(t *testing.T) {
+	basePath := t.TempDir()
+	store := NewStore(basePath, "", "")
+	path := filepath.Join(basePath, "user")
+	deliverTestMessage(t, store, "Subject: first\r\n\r\n")
+
+	stale := writeTmpFile(t, path, "stale", 37*time.Hour)
+	fresh := writeTmpFile(t, path, "fresh", time.Hour)
+	// The first delivery scanned tmp/ already; a fresh store scans again.
+	store = NewStore(basePath, "", "")
+	deliverTestMessage(t, store, "Subject: second\r\n\r\n")
+
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Errorf("stale tmp file still present: %v", err)
+	}
+	if _, err := os.Stat(fresh); err != nil {
+		t.Errorf("fresh tmp file removed: %v", err)
+	}
+
+	// Further deliveries within the interval do not scan again.
+	later := writeTmpFile(t, path, "later", 37*time.Hour)
+	deliverTestMessage(t, store, "Subject: third\r\n\r\n")
+	if _, err := os.Stat(later); err != nil {
+		t.Errorf("tmp/ scanned again within the interval: %v", err)
+	}
+}
+
+func TestMaildirStore_TmpCleanupOptions(t *testing.T) {
+	basePath := t.TempDir()
+	path := filepath.Join(basePath, "user")
+	deliverTestMessage(t, NewStore(basePath, "", ""), "Subject: first\r\n\r\n")
+
+	old := writeTmpFile(t, path, "old", 2*time.Hour)
+	deliverTestMessage(t, NewStore(basePath, "", "", WithTmpCleanup(0, 0)), "Subject: x\r\n\r\n")
+	if _, err := os.Stat(old); err != nil {
+		t.Errorf("disabled cleanup removed a tmp file: %v", err)
+	}
+
+	store := NewStore(basePath, "", "", WithTmpCleanup(time.Hour, 0))
+	deliverTestMessage(t, store, "Subject: y\r\n\r\n")
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("tmp file older than maxAge still present: %v", err)
+	}
+	again := writeTmpFile(t, path, "again", 2*time.Hour)
+	deliverTestMessage(t, store, "Subject: z\r\n\r\n")
+	if _, err := os.Stat(again); !os.IsNotExist(err) {
+		t.Errorf("zero interval did not scan on every delivery: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package maildir
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// tracerName is the instrumentation scope reported on maildir spans.
+const tracerName = "github.com/infodancer/msgstore/maildir"
+
+// Span attribute keys. Mailboxes are recorded only as a hash so traces
+// exported to shared infrastructure do not reveal who receives mail.
+const (
+	attrStoreType   = attribute.Key("msgstore.store_type")
+	attrMailboxHash = attribute.Key("msgstore.mailbox_hash")
+	attrMessageSize = attribute.Key("msgstore.message_size")
+	attrRecipients  = attribute.Key("msgstore.recipient_count")
+	attrMessages    = attribute.Key("msgstore.message_count")
+)
+
+// tracer returns the tracer for maildir spans. Without WithTracerProvider the
+// global provider is used, which records nothing unless the embedding
+// daemon has installed one.
+func (s *MaildirStore) tracer() trace.Tracer {
+	tp := s.tracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(tracerName)
+}
+
+// startSpan starts a span for a store operation on mailbox.
+// mailbox may be empty for operations spanning several mailboxes.
+func (s *MaildirStore) startSpan(ctx context.Context, op, mailbox string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	attrs = append(attrs, attrStoreType.String("maildir"))
+	if mailbox != "" {
+		attrs = append(attrs, attrMailboxHash.String(mailboxHash(mailbox)))
+	}
+	return s.tracer().Start(ctx, "msgstore."+op, trace.WithAttributes(attrs...))
+}
+
+// endSpan records err on span, if any, and ends it.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// mailboxHash returns a short, stable pseudonym for a mailbox, so spans for
+// the same mailbox can be correlated without recording the address.
+func mailboxHash(mailbox string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(mailbox)))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,67 @@
+package maildir
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/infodancer/msgstore"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestMaildirStore_TracingSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	store := NewStore(t.TempDir(), "", "", WithTracerProvider(tp))
+	ctx := context.Background()
+
+	envelope := msgstore.Envelope{From: "sender@example.com", Recipients: []string{"user@example.com"}}
+	if err := store.Deliver(ctx, envelope, strings.NewReader("Subject: hi\r\n\r\nhello")); err != nil {
+		t.Fatalf("Deliver failed: %v", err)
+	}
+	msgs, err := store.List(ctx, "user@example.com")
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("List = %d messages, %v", len(msgs), err)
+	}
+	if _, err := store.Retrieve(ctx, "user@example.com", "missing"); err == nil {
+		t.Fatal("expected Retrieve of missing message to fail")
+	}
+
+	spans := recorder.Ended()
+	byName := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range spans {
+		byName[span.Name()] = span
+	}
+	for _, name := range []string{"msgstore.Deliver", "msgstore.DeliverToRecipient", "msgstore.List", "msgstore.Retrieve"} {
+		if _, ok := byName[name]; !ok {
+			t.Errorf("missing span %s", name)
+		}
+	}
+
+	deliver := byName["msgstore.Deliver"]
+	recipient := byName["msgstore.DeliverToRecipient"]
+	if recipient.Parent().SpanID() != deliver.SpanContext().SpanID() {
+		t.Error("DeliverToRecipient span is not a child of Deliver")
+	}
+
+	attrs := make(map[string]string)
+	for _, kv := range recipient.Attributes() {
+		attrs[string(kv.Key)] = kv.Value.Emit()
+	}
+	if attrs["msgstore.store_type"] != "maildir" {
+		t.Errorf("store_type = %q, want maildir", attrs["msgstore.store_type"])
+	}
+	if attrs["msgstore.mailbox_hash"] != mailboxHash("user@example.com") {
+		t.Errorf("mailbox_hash = %q", attrs["msgstore.mailbox_hash"])
+	}
+	for _, kv := range recipient.Attributes() {
+		if strings.Contains(kv.Value.Emit(), "user@example.com") {
+			t.Errorf("span attribute %s leaks the mailbox address", kv.Key)
+		}
+	}
+
+	if byName["msgstore.Retrieve"].Status().Code.String() != "Error" {
+		t.Error("failed Retrieve span does not have error status")
+	}
+}
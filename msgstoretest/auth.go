@@ -0,0 +1,124 @@
+package msgstoretest
+
+import (
+	"context"
+	"slices"
+	"sync"
+
+	"github.com/infodancer/auth"
+	"github.com/infodancer/msgstore/errors"
+)
+
+// AuthAgent is an in-memory authentication agent. It checks passwords
+// against users added with AddUser and serves their public keys as an
+// auth.KeyProvider, so it can back an EncryptingDeliveryAgent in tests.
+type AuthAgent struct {
+	faults
+
+	lock  sync.Mutex
+	users map[string]*user
+}
+
+type user struct {
+	password  string
+	publicKey []byte
+}
+
+// NewAuthAgent returns an AuthAgent with no users.
+func NewAuthAgent() *AuthAgent {
+	return &AuthAgent{users: make(map[string]*user)}
+}
+
+// AddUser adds or replaces a user with the given password.
+func (a *AuthAgent) AddUser(username, password string) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.users[username] = &user{password: password}
+}
+
+// SetPublicKey gives an existing user an encryption key; nil removes it.
+func (a *AuthAgent) SetPublicKey(username string, key []byte) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	u, ok := a.users[username]
+	if !ok {
+		return errors.ErrUserNotFound
+	}
+	u.publicKey = slices.Clone(key)
+	return nil
+}
+
+// Authenticate checks username and password. It returns
+// ErrAuthenticationFailed for an unknown user or a wrong password.
+func (a *AuthAgent) Authenticate(ctx context.Context, username, password string) (err error) {
+	done, err := a.begin(ctx, "Authenticate", username)
+	if err != nil {
+		return err
+	}
+	defer func() { done(err) }()
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	u, ok := a.users[username]
+	if !ok || u.password != password {
+		return errors.ErrAuthenticationFailed
+	}
+	return nil
+}
+
+// UserExists reports whether username has been added.
+func (a *AuthAgent) UserExists(ctx context.Context, username string) (_ bool, err error) {
+	done, err := a.begin(ctx, "UserExists", username)
+	if err != nil {
+		return false, err
+	}
+	defer func() { done(err) }()
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	_, ok := a.users[username]
+	return ok, nil
+}
+
+// GetPublicKey implements auth.KeyProvider.
+func (a *AuthAgent) GetPublicKey(ctx context.Context, username string) (_ []byte, err error) {
+	done, err := a.begin(ctx, "GetPublicKey", username)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { done(err) }()
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	u, ok := a.users[username]
+	if !ok {
+		return nil, errors.ErrUserNotFound
+	}
+	return slices.Clone(u.publicKey), nil
+}
+
+// HasEncryption implements auth.KeyProvider.
+func (a *AuthAgent) HasEncryption(ctx context.Context, username string) (_ bool, err error) {
+	done, err := a.begin(ctx, "HasEncryption", username)
+	if err != nil {
+		return false, err
+	}
+	defer func() { done(err) }()
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	u, ok := a.users[username]
+	if !ok {
+		return false, nil
+	}
+	return len(u.publicKey) > 0, nil
+}
+
+// Close releases nothing; it is recorded like any other call.
+func (a *AuthAgent) Close() error {
+	_, err := a.begin(context.Background(), "Close")
+	return err
+}
+
+// Compile-time interface verification.
+var _ auth.KeyProvider = (*AuthAgent)(nil)
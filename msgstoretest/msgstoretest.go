@@ -0,0 +1,148 @@
+// Package msgstoretest provides in-memory fakes of the msgstore interfaces
+// for use in consumers' tests.
+//
+// Store implements MsgStore and FolderStore without touching disk, and
+// AuthAgent stands in for the authentication agent. Both fakes record every
+// call, can be scripted to fail individual operations and can delay each
+// call to exercise timeouts:
+//
+//	store := msgstoretest.NewStore()
+//	store.FailNext("Deliver", errors.ErrQuotaExceeded)
+//	store.SetLatency(50 * time.Millisecond)
+//	// ... exercise the code under test ...
+//	for _, c := range store.Calls() { ... }
+//
+// Fakes are safe for concurrent use.
+package msgstoretest
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Call records one call made to a fake.
+type Call struct {
+	// Method is the name of the interface method, e.g. "Deliver".
+	Method string
+
+	// Args holds the string arguments of the call in order (mailbox,
+	// folder, uid, username, ...). Readers and contexts are not recorded.
+	Args []string
+
+	// Err is the error the call returned.
+	Err error
+}
+
+// faults holds the call log, scripted failures and latency shared by the fakes.
+type faults struct {
+	mu      sync.Mutex
+	calls   []Call
+	next    map[string][]error
+	always  map[string]error
+	latency time.Duration
+}
+
+// FailNext makes the next call to method return err. Repeated calls queue
+// further failures, consumed in order.
+func (f *faults) FailNext(method string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.next == nil {
+		f.next = make(map[string][]error)
+	}
+	f.next[method] = append(f.next[method], err)
+}
+
+// FailAlways makes every call to method return err until Reset. A nil err
+// clears the failure.
+func (f *faults) FailAlways(method string, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.always == nil {
+		f.always = make(map[string]error)
+	}
+	if err == nil {
+		delete(f.always, method)
+		return
+	}
+	f.always[method] = err
+}
+
+// SetLatency delays every call by d before it runs. A call whose context
+// ends during the delay returns the context's error.
+func (f *faults) SetLatency(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.latency = d
+}
+
+// Calls returns a copy of the calls recorded so far.
+func (f *faults) Calls() []Call {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Call(nil), f.calls...)
+}
+
+// CallCount returns how many times method was called.
+func (f *faults) CallCount(method string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	n := 0
+	for _, c := range f.calls {
+		if c.Method == method {
+			n++
+		}
+	}
+	return n
+}
+
+// Reset clears the call log, scripted failures and latency.
+func (f *faults) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = nil
+	f.next = nil
+	f.always = nil
+	f.latency = 0
+}
+
+// begin records a call, waits out the configured latency and returns the
+// scripted failure for method, if any. The returned function stores the
+// call's final error in the log.
+func (f *faults) begin(ctx context.Context, method string, args ...string) (func(error) error, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, Call{Method: method, Args: args})
+	idx := len(f.calls) - 1
+	latency := f.latency
+	var err error
+	if q := f.next[method]; len(q) > 0 {
+		err = q[0]
+		f.next[method] = q[1:]
+	} else if e, ok := f.always[method]; ok {
+		err = e
+	}
+	f.mu.Unlock()
+
+	done := func(err error) error {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if idx < len(f.calls) {
+			f.calls[idx].Err = err
+		}
+		return err
+	}
+	if latency > 0 {
+		t := time.NewTimer(latency)
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return done, done(ctx.Err())
+		case <-t.C:
+		}
+	}
+	if err != nil {
+		return done, done(err)
+	}
+	return done, nil
+}
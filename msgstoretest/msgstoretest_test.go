@@ -0,0 +1,194 @@
+package msgstoretest_test
+
+import (
+	"context"
+	stderrors "errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+	"github.com/infodancer/msgstore/msgstoretest"
+)
+
+func deliver(t *testing.T, store *msgstoretest.Store, body string, rcpts ...string) error {
+	t.Helper()
+	env := msgstore.Envelope{From: "sender@example.com", Recipients: rcpts, ReceivedTime: time.Now()}
+	return store.Deliver(context.Background(), env, strings.NewReader(body))
+}
+
+func TestStore_DeliverListRetrieve(t *testing.T) {
+	store := msgstoretest.NewStore()
+	ctx := context.Background()
+
+	if err := deliver(t, store, "Subject: hi\r\n\r\nbody\r\n", "a@example.com", "b@example.com"); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	for _, mb := range []string{"a@example.com", "b@example.com"} {
+		msgs, err := store.List(ctx, mb)
+		if err != nil {
+			t.Fatalf("List(%s): %v", mb, err)
+		}
+		if len(msgs) != 1 || msgs[0].UID != "1" {
+			t.Fatalf("List(%s) = %+v, want one message with UID 1", mb, msgs)
+		}
+	}
+
+	rc, err := store.Retrieve(ctx, "a@example.com", "1")
+	if err != nil {
+		t.Fatalf("Retrieve: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	_ = rc.Close()
+	if string(data) != "Subject: hi\r\n\r\nbody\r\n" {
+		t.Errorf("Retrieve = %q", data)
+	}
+
+	if err := store.Delete(ctx, "a@example.com", "1"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if count, _, _ := store.Stat(ctx, "a@example.com"); count != 0 {
+		t.Errorf("Stat count after Delete = %d, want 0", count)
+	}
+	removed, err := store.Expunge(ctx, "a@example.com")
+	if err != nil || !reflect.DeepEqual(removed, []string{"1"}) {
+		t.Errorf("Expunge = %v, %v; want [1]", removed, err)
+	}
+	if _, err := store.Retrieve(ctx, "a@example.com", "1"); !stderrors.Is(err, errors.ErrMessageNotFound) {
+		t.Errorf("Retrieve after Expunge error = %v, want ErrMessageNotFound", err)
+	}
+}
+
+func TestStore_Folders(t *testing.T) {
+	store := msgstoretest.NewStore()
+	ctx := context.Background()
+	mb := "user@example.com"
+
+	if err := store.CreateFolder(ctx, mb, "Work"); err != nil {
+		t.Fatalf("CreateFolder: %v", err)
+	}
+	if err := store.CreateFolder(ctx, mb, "Work.Projects"); err != nil {
+		t.Fatalf("CreateFolder nested: %v", err)
+	}
+	if err := store.CreateFolder(ctx, mb, "Work"); !stderrors.Is(err, errors.ErrFolderExists) {
+		t.Errorf("CreateFolder duplicate error = %v, want ErrFolderExists", err)
+	}
+
+	uid := store.Seed(mb, "INBOX", []byte("seeded"), "\\Flagged")
+	copied, err := store.CopyMessage(ctx, mb, "INBOX", uid, "Work.Projects")
+	if err != nil {
+		t.Fatalf("CopyMessage: %v", err)
+	}
+	if err := store.SetFlagsInFolder(ctx, mb, "Work.Projects", copied, msgstore.FlagModeAdd, []string{"\\Seen"}); err != nil {
+		t.Fatalf("SetFlagsInFolder: %v", err)
+	}
+
+	if err := store.RenameFolder(ctx, mb, "Work", "Job"); err != nil {
+		t.Fatalf("RenameFolder: %v", err)
+	}
+	folders, _ := store.ListFolders(ctx, mb)
+	if !reflect.DeepEqual(folders, []string{"Job", "Job.Projects"}) {
+		t.Errorf("ListFolders = %v, want [Job Job.Projects]", folders)
+	}
+	msgs, err := store.ListInFolder(ctx, mb, "Job.Projects")
+	if err != nil {
+		t.Fatalf("ListInFolder: %v", err)
+	}
+	if len(msgs) != 1 || !reflect.DeepEqual(msgs[0].Flags, []string{"\\Flagged", "\\Seen"}) {
+		t.Errorf("ListInFolder = %+v", msgs)
+	}
+
+	if err := store.DeleteFolder(ctx, mb, "Job", msgstore.WithRecursive()); !stderrors.Is(err, errors.ErrFolderNotEmpty) {
+		t.Errorf("DeleteFolder non-empty error = %v, want ErrFolderNotEmpty", err)
+	}
+	if err := store.DeleteFolder(ctx, mb, "Job", msgstore.WithRecursive(), msgstore.WithForce()); err != nil {
+		t.Fatalf("DeleteFolder: %v", err)
+	}
+	if folders, _ := store.ListFolders(ctx, mb); len(folders) != 0 {
+		t.Errorf("ListFolders after delete = %v, want none", folders)
+	}
+}
+
+func TestStore_ScriptedFailures(t *testing.T) {
+	store := msgstoretest.NewStore()
+
+	store.FailNext("Deliver", errors.ErrQuotaExceeded)
+	if err := deliver(t, store, "x", "a@example.com"); !stderrors.Is(err, errors.ErrQuotaExceeded) {
+		t.Fatalf("first Deliver error = %v, want ErrQuotaExceeded", err)
+	}
+	if err := deliver(t, store, "x", "a@example.com"); err != nil {
+		t.Fatalf("second Deliver: %v", err)
+	}
+
+	store.FailAlways("List", errors.ErrMailboxLocked)
+	for i := 0; i < 2; i++ {
+		if _, err := store.List(context.Background(), "a@example.com"); !stderrors.Is(err, errors.ErrMailboxLocked) {
+			t.Fatalf("List error = %v, want ErrMailboxLocked", err)
+		}
+	}
+	store.FailAlways("List", nil)
+	if _, err := store.List(context.Background(), "a@example.com"); err != nil {
+		t.Fatalf("List after clearing failure: %v", err)
+	}
+
+	calls := store.Calls()
+	if len(calls) != 5 {
+		t.Fatalf("recorded %d calls, want 5", len(calls))
+	}
+	if calls[0].Method != "Deliver" || !stderrors.Is(calls[0].Err, errors.ErrQuotaExceeded) {
+		t.Errorf("calls[0] = %+v", calls[0])
+	}
+	if !reflect.DeepEqual(calls[4].Args, []string{"a@example.com"}) || calls[4].Err != nil {
+		t.Errorf("calls[4] = %+v", calls[4])
+	}
+	if n := store.CallCount("List"); n != 3 {
+		t.Errorf("CallCount(List) = %d, want 3", n)
+	}
+}
+
+func TestStore_Latency(t *testing.T) {
+	store := msgstoretest.NewStore()
+	store.SetLatency(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := store.List(ctx, "a@example.com"); !stderrors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("List error = %v, want DeadlineExceeded", err)
+	}
+	if calls := store.Calls(); len(calls) != 1 || !stderrors.Is(calls[0].Err, context.DeadlineExceeded) {
+		t.Errorf("calls = %+v", calls)
+	}
+}
+
+func TestAuthAgent(t *testing.T) {
+	agent := msgstoretest.NewAuthAgent()
+	ctx := context.Background()
+	agent.AddUser("alice", "secret")
+
+	if err := agent.Authenticate(ctx, "alice", "secret"); err != nil {
+		t.Errorf("Authenticate: %v", err)
+	}
+	if err := agent.Authenticate(ctx, "alice", "wrong"); !stderrors.Is(err, errors.ErrAuthenticationFailed) {
+		t.Errorf("Authenticate wrong password error = %v, want ErrAuthenticationFailed", err)
+	}
+	if ok, _ := agent.HasEncryption(ctx, "alice"); ok {
+		t.Error("HasEncryption = true before a key is set")
+	}
+	if err := agent.SetPublicKey("alice", make([]byte, msgstore.PublicKeySize)); err != nil {
+		t.Fatalf("SetPublicKey: %v", err)
+	}
+	if ok, _ := agent.HasEncryption(ctx, "alice"); !ok {
+		t.Error("HasEncryption = false after a key is set")
+	}
+
+	agent.FailNext("Authenticate", errors.ErrMailboxLocked)
+	if err := agent.Authenticate(ctx, "alice", "secret"); !stderrors.Is(err, errors.ErrMailboxLocked) {
+		t.Errorf("scripted Authenticate error = %v", err)
+	}
+	if n := agent.CallCount("Authenticate"); n != 3 {
+		t.Errorf("CallCount(Authenticate) = %d, want 3", n)
+	}
+}
@@ -0,0 +1,595 @@
+package msgstoretest
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+// inbox is the key of a mailbox's inbox in mailbox.folders.
+const inbox = "INBOX"
+
+// Store is an in-memory MsgStore and FolderStore. Mailboxes are created on
+// first use; Deliver files a copy of the message into the INBOX of every
+// envelope recipient. Folder names nest with "." as the delimiter. UIDs are
+// decimal strings assigned in ascending order per folder.
+type Store struct {
+	faults
+
+	lock      sync.Mutex
+	mailboxes map[string]*mailbox
+	validity  uint32
+}
+
+type mailbox struct {
+	folders map[string]*folder
+}
+
+type folder struct {
+	validity uint32
+	nextUID  uint64
+	messages []*message
+}
+
+type message struct {
+	uid     string
+	data    []byte
+	flags   []string
+	date    time.Time
+	deleted bool
+}
+
+// NewStore returns an empty Store.
+func NewStore() *Store {
+	return &Store{mailboxes: make(map[string]*mailbox)}
+}
+
+// Seed stores data in a folder of mailbox without recording a call, creating
+// both as needed, and returns the new message's UID. folder may be "INBOX".
+func (s *Store) Seed(mailbox, folder string, data []byte, flags ...string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f := s.mailbox(mailbox).folders[folderKey(folder)]
+	if f == nil {
+		f = s.newFolder()
+		s.mailbox(mailbox).folders[folderKey(folder)] = f
+	}
+	return f.add(data, flags, time.Now())
+}
+
+// mailbox returns the named mailbox, creating it with an empty inbox.
+// The caller holds s.lock.
+func (s *Store) mailbox(name string) *mailbox {
+	mb, ok := s.mailboxes[name]
+	if !ok {
+		mb = &mailbox{folders: map[string]*folder{inbox: s.newFolder()}}
+		s.mailboxes[name] = mb
+	}
+	return mb
+}
+
+// newFolder returns an empty folder with a fresh UIDValidity.
+// The caller holds s.lock.
+func (s *Store) newFolder() *folder {
+	s.validity++
+	return &folder{validity: s.validity, nextUID: 1}
+}
+
+// folder returns an existing folder or ErrFolderNotFound.
+// The caller holds s.lock.
+func (s *Store) folder(mailbox, name string) (*folder, error) {
+	f, ok := s.mailbox(mailbox).folders[folderKey(name)]
+	if !ok {
+		return nil, errors.ErrFolderNotFound
+	}
+	return f, nil
+}
+
+// folderKey maps "INBOX" in any case to the inbox key.
+func folderKey(name string) string {
+	if strings.EqualFold(name, inbox) {
+		return inbox
+	}
+	return name
+}
+
+func (f *folder) add(data []byte, flags []string, date time.Time) string {
+	uid := strconv.FormatUint(f.nextUID, 10)
+	f.nextUID++
+	f.messages = append(f.messages, &message{
+		uid:   uid,
+		data:  data,
+		flags: slices.Clone(flags),
+		date:  date,
+	})
+	return uid
+}
+
+func (f *folder) message(uid string) (*message, error) {
+	for _, m := range f.messages {
+		if m.uid == uid {
+			return m, nil
+		}
+	}
+	return nil, errors.ErrMessageNotFound
+}
+
+func (f *folder) list() []msgstore.MessageInfo {
+	infos := []msgstore.MessageInfo{}
+	for _, m := range f.messages {
+		if m.deleted {
+			continue
+		}
+		infos = append(infos, msgstore.MessageInfo{
+			UID:          m.uid,
+			Size:         int64(len(m.data)),
+			Flags:        slices.Clone(m.flags),
+			InternalDate: m.date,
+		})
+	}
+	return infos
+}
+
+func (f *folder) stat() (count int, totalBytes int64) {
+	for _, info := range f.list() {
+		count++
+		totalBytes += info.Size
+	}
+	return count, totalBytes
+}
+
+func (f *folder) retrieve(uid string) (io.ReadCloser, error) {
+	m, err := f.message(uid)
+	if err != nil {
+		return nil, err
+	}
+	if m.deleted {
+		return nil, errors.ErrMessageDeleted
+	}
+	return io.NopCloser(bytes.NewReader(m.data)), nil
+}
+
+func (f *folder) delete(uid string) error {
+	m, err := f.message(uid)
+	if err != nil {
+		return err
+	}
+	m.deleted = true
+	return nil
+}
+
+func (f *folder) expunge() []string {
+	var removed []string
+	kept := f.messages[:0]
+	for _, m := range f.messages {
+		if m.deleted {
+			removed = append(removed, m.uid)
+			continue
+		}
+		kept = append(kept, m)
+	}
+	f.messages = kept
+	sort.Slice(removed, func(i, j int) bool {
+		a, _ := strconv.ParseUint(removed[i], 10, 64)
+		b, _ := strconv.ParseUint(removed[j], 10, 64)
+		return a < b
+	})
+	return removed
+}
+
+// Deliver implements msgstore.DeliveryAgent.
+func (s *Store) Deliver(ctx context.Context, envelope msgstore.Envelope, message io.Reader) (err error) {
+	done, err := s.begin(ctx, "Deliver", envelope.Recipients...)
+	if err != nil {
+		return err
+	}
+	defer func() { done(err) }()
+
+	if len(envelope.Recipients) == 0 {
+		return errors.ErrNoRecipients
+	}
+	data, err := io.ReadAll(message)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for _, rcpt := range envelope.Recipients {
+		s.mailbox(rcpt).folders[inbox].add(data, nil, time.Now())
+	}
+	return nil
+}
+
+// List implements msgstore.MessageStore.
+func (s *Store) List(ctx context.Context, mailbox string) ([]msgstore.MessageInfo, error) {
+	return s.listInFolder(ctx, "List", []string{mailbox}, mailbox, inbox)
+}
+
+// Retrieve implements msgstore.MessageStore.
+func (s *Store) Retrieve(ctx context.Context, mailbox string, uid string) (io.ReadCloser, error) {
+	return s.retrieveFromFolder(ctx, "Retrieve", []string{mailbox, uid}, mailbox, inbox, uid)
+}
+
+// Delete implements msgstore.MessageStore.
+func (s *Store) Delete(ctx context.Context, mailbox string, uid string) error {
+	return s.deleteInFolder(ctx, "Delete", []string{mailbox, uid}, mailbox, inbox, uid)
+}
+
+// Expunge implements msgstore.MessageStore.
+func (s *Store) Expunge(ctx context.Context, mailbox string) ([]string, error) {
+	return s.expungeFolder(ctx, "Expunge", []string{mailbox}, mailbox, inbox)
+}
+
+// Stat implements msgstore.MessageStore.
+func (s *Store) Stat(ctx context.Context, mailbox string) (int, int64, error) {
+	return s.statFolder(ctx, "Stat", []string{mailbox}, mailbox, inbox)
+}
+
+// CreateFolder implements msgstore.FolderStore.
+func (s *Store) CreateFolder(ctx context.Context, mailbox string, folder string) (err error) {
+	done, err := s.begin(ctx, "CreateFolder", mailbox, folder)
+	if err != nil {
+		return err
+	}
+	defer func() { done(err) }()
+
+	if folder == "" || folderKey(folder) == inbox {
+		return errors.ErrInvalidFolderName
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	mb := s.mailbox(mailbox)
+	if _, ok := mb.folders[folder]; ok {
+		return errors.ErrFolderExists
+	}
+	mb.folders[folder] = s.newFolder()
+	return nil
+}
+
+// ListFolders implements msgstore.FolderStore.
+func (s *Store) ListFolders(ctx context.Context, mailbox string) (_ []string, err error) {
+	done, err := s.begin(ctx, "ListFolders", mailbox)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { done(err) }()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	names := []string{}
+	for name := range s.mailbox(mailbox).folders {
+		if name != inbox {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// DeleteFolder implements msgstore.FolderStore.
+func (s *Store) DeleteFolder(ctx context.Context, mailbox string, folder string, opts ...msgstore.DeleteFolderOption) (err error) {
+	done, err := s.begin(ctx, "DeleteFolder", mailbox, folder)
+	if err != nil {
+		return err
+	}
+	defer func() { done(err) }()
+
+	var o msgstore.DeleteFolderOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if folderKey(folder) == inbox {
+		return errors.ErrInvalidFolderName
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	mb := s.mailbox(mailbox)
+	if _, ok := mb.folders[folder]; !ok {
+		return errors.ErrFolderNotFound
+	}
+	doomed := []string{folder}
+	if o.Recursive {
+		for name := range mb.folders {
+			if strings.HasPrefix(name, folder+".") {
+				doomed = append(doomed, name)
+			}
+		}
+	}
+	if !o.Force {
+		for _, name := range doomed {
+			if len(mb.folders[name].messages) > 0 {
+				return errors.ErrFolderNotEmpty
+			}
+		}
+	}
+	for _, name := range doomed {
+		delete(mb.folders, name)
+	}
+	return nil
+}
+
+// ListInFolder implements msgstore.FolderStore.
+func (s *Store) ListInFolder(ctx context.Context, mailbox string, folder string) ([]msgstore.MessageInfo, error) {
+	return s.listInFolder(ctx, "ListInFolder", []string{mailbox, folder}, mailbox, folder)
+}
+
+// listInFolder records the call as method with args, so the inbox and folder
+// variants can be scripted separately.
+func (s *Store) listInFolder(ctx context.Context, method string, args []string, mailbox string, folder string) (_ []msgstore.MessageInfo, err error) {
+	done, err := s.begin(ctx, method, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { done(err) }()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f, err := s.folder(mailbox, folder)
+	if err != nil {
+		return nil, err
+	}
+	return f.list(), nil
+}
+
+// StatFolder implements msgstore.FolderStore.
+func (s *Store) StatFolder(ctx context.Context, mailbox string, folder string) (int, int64, error) {
+	return s.statFolder(ctx, "StatFolder", []string{mailbox, folder}, mailbox, folder)
+}
+
+func (s *Store) statFolder(ctx context.Context, method string, args []string, mailbox string, folder string) (_ int, _ int64, err error) {
+	done, err := s.begin(ctx, method, args...)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer func() { done(err) }()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f, err := s.folder(mailbox, folder)
+	if err != nil {
+		return 0, 0, err
+	}
+	count, totalBytes := f.stat()
+	return count, totalBytes, nil
+}
+
+// RetrieveFromFolder implements msgstore.FolderStore.
+func (s *Store) RetrieveFromFolder(ctx context.Context, mailbox string, folder string, uid string) (io.ReadCloser, error) {
+	return s.retrieveFromFolder(ctx, "RetrieveFromFolder", []string{mailbox, folder, uid}, mailbox, folder, uid)
+}
+
+func (s *Store) retrieveFromFolder(ctx context.Context, method string, args []string, mailbox string, folder string, uid string) (_ io.ReadCloser, err error) {
+	done, err := s.begin(ctx, method, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { done(err) }()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f, err := s.folder(mailbox, folder)
+	if err != nil {
+		return nil, err
+	}
+	return f.retrieve(uid)
+}
+
+// DeleteInFolder implements msgstore.FolderStore.
+func (s *Store) DeleteInFolder(ctx context.Context, mailbox string, folder string, uid string) error {
+	return s.deleteInFolder(ctx, "DeleteInFolder", []string{mailbox, folder, uid}, mailbox, folder, uid)
+}
+
+func (s *Store) deleteInFolder(ctx context.Context, method string, args []string, mailbox string, folder string, uid string) (err error) {
+	done, err := s.begin(ctx, method, args...)
+	if err != nil {
+		return err
+	}
+	defer func() { done(err) }()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f, err := s.folder(mailbox, folder)
+	if err != nil {
+		return err
+	}
+	return f.delete(uid)
+}
+
+// ExpungeFolder implements msgstore.FolderStore.
+func (s *Store) ExpungeFolder(ctx context.Context, mailbox string, folder string) ([]string, error) {
+	return s.expungeFolder(ctx, "ExpungeFolder", []string{mailbox, folder}, mailbox, folder)
+}
+
+func (s *Store) expungeFolder(ctx context.Context, method string, args []string, mailbox string, folder string) (_ []string, err error) {
+	done, err := s.begin(ctx, method, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { done(err) }()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f, err := s.folder(mailbox, folder)
+	if err != nil {
+		return nil, err
+	}
+	return f.expunge(), nil
+}
+
+// DeliverToFolder implements msgstore.FolderStore.
+func (s *Store) DeliverToFolder(ctx context.Context, mailbox string, folder string, message io.Reader) (err error) {
+	done, err := s.begin(ctx, "DeliverToFolder", mailbox, folder)
+	if err != nil {
+		return err
+	}
+	defer func() { done(err) }()
+
+	data, err := io.ReadAll(message)
+	if err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f, err := s.folder(mailbox, folder)
+	if err != nil {
+		return err
+	}
+	f.add(data, nil, time.Now())
+	return nil
+}
+
+// RenameFolder implements msgstore.FolderStore.
+func (s *Store) RenameFolder(ctx context.Context, mailbox string, oldName string, newName string) (err error) {
+	done, err := s.begin(ctx, "RenameFolder", mailbox, oldName, newName)
+	if err != nil {
+		return err
+	}
+	defer func() { done(err) }()
+
+	if folderKey(oldName) == inbox || newName == "" || folderKey(newName) == inbox {
+		return errors.ErrInvalidFolderName
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	mb := s.mailbox(mailbox)
+	if _, ok := mb.folders[oldName]; !ok {
+		return errors.ErrFolderNotFound
+	}
+	renames := map[string]string{oldName: newName}
+	for name := range mb.folders {
+		if strings.HasPrefix(name, oldName+".") {
+			renames[name] = newName + strings.TrimPrefix(name, oldName)
+		}
+	}
+	for _, to := range renames {
+		if _, ok := mb.folders[to]; ok {
+			return errors.ErrFolderExists
+		}
+	}
+	moved := make(map[string]*folder, len(renames))
+	for from, to := range renames {
+		moved[to] = mb.folders[from]
+		delete(mb.folders, from)
+	}
+	for name, f := range moved {
+		mb.folders[name] = f
+	}
+	return nil
+}
+
+// AppendToFolder implements msgstore.FolderStore.
+func (s *Store) AppendToFolder(ctx context.Context, mailbox string, folder string, r io.Reader, flags []string, date time.Time) (_ string, err error) {
+	done, err := s.begin(ctx, "AppendToFolder", mailbox, folder)
+	if err != nil {
+		return "", err
+	}
+	defer func() { done(err) }()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	if date.IsZero() {
+		date = time.Now()
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f, err := s.folder(mailbox, folder)
+	if err != nil {
+		return "", err
+	}
+	return f.add(data, flags, date), nil
+}
+
+// SetFlagsInFolder implements msgstore.FolderStore.
+func (s *Store) SetFlagsInFolder(ctx context.Context, mailbox string, folder string, uid string, mode msgstore.FlagMode, flags []string) (err error) {
+	done, err := s.begin(ctx, "SetFlagsInFolder", mailbox, folder, uid)
+	if err != nil {
+		return err
+	}
+	defer func() { done(err) }()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f, err := s.folder(mailbox, folder)
+	if err != nil {
+		return err
+	}
+	m, err := f.message(uid)
+	if err != nil {
+		return err
+	}
+	switch mode {
+	case msgstore.FlagModeSet:
+		m.flags = nil
+		fallthrough
+	case msgstore.FlagModeAdd:
+		for _, flag := range flags {
+			if !slices.Contains(m.flags, flag) {
+				m.flags = append(m.flags, flag)
+			}
+		}
+	case msgstore.FlagModeRemove:
+		m.flags = slices.DeleteFunc(m.flags, func(flag string) bool {
+			return slices.Contains(flags, flag)
+		})
+	}
+	return nil
+}
+
+// CopyMessage implements msgstore.FolderStore.
+func (s *Store) CopyMessage(ctx context.Context, mailbox string, srcFolder string, uid string, destFolder string) (_ string, err error) {
+	done, err := s.begin(ctx, "CopyMessage", mailbox, srcFolder, uid, destFolder)
+	if err != nil {
+		return "", err
+	}
+	defer func() { done(err) }()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	src, err := s.folder(mailbox, srcFolder)
+	if err != nil {
+		return "", err
+	}
+	m, err := src.message(uid)
+	if err != nil {
+		return "", err
+	}
+	dest, err := s.folder(mailbox, destFolder)
+	if err != nil {
+		return "", err
+	}
+	return dest.add(m.data, m.flags, m.date), nil
+}
+
+// UIDValidity implements msgstore.FolderStore.
+func (s *Store) UIDValidity(ctx context.Context, mailbox string, folder string) (_ uint32, err error) {
+	done, err := s.begin(ctx, "UIDValidity", mailbox, folder)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { done(err) }()
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	f, err := s.folder(mailbox, folder)
+	if err != nil {
+		return 0, err
+	}
+	return f.validity, nil
+}
+
+// Compile-time interface verification.
+var (
+	_ msgstore.MsgStore    = (*Store)(nil)
+	_ msgstore.FolderStore = (*Store)(nil)
+)
@@ -0,0 +1,116 @@
+package msgstore
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"sync"
+)
+
+// StorePool shares stores between callers that open the same
+// configuration, so daemons that open a store per connection pay the
+// backend's setup once and keep its in-process caches warm. Stores are
+// reference counted: each Open returns a handle, and the store is closed
+// when the last handle is.
+type StorePool struct {
+	mu     sync.Mutex
+	stores map[string]*pooledStore // canonical config -> store
+}
+
+// pooledStore is a shared store and the number of open handles on it.
+type pooledStore struct {
+	store MsgStore
+	refs  int
+}
+
+// NewStorePool returns an empty pool.
+func NewStorePool() *StorePool {
+	return &StorePool{stores: make(map[string]*pooledStore)}
+}
+
+// defaultPool backs OpenShared.
+var defaultPool = NewStorePool()
+
+// OpenShared is like Open, but shares the store with other callers of
+// OpenShared using the same configuration.
+func OpenShared(config StoreConfig) (*PooledStore, error) {
+	return defaultPool.Open(config)
+}
+
+// Open returns a handle on the pool's store for config, opening it with
+// Open if no handle on an equivalent configuration is open. Configurations
+// are equivalent if they differ only in the spelling of BasePath or in
+// empty versus nil Options. Opening happens under the pool's lock, so
+// concurrent first opens of one configuration share a single store.
+func (p *StorePool) Open(config StoreConfig) (*PooledStore, error) {
+	key, err := poolKey(config)
+	if err != nil {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	entry, ok := p.stores[key]
+	if !ok {
+		store, err := Open(config)
+		if err != nil {
+			return nil, err
+		}
+		entry = &pooledStore{store: store}
+		p.stores[key] = entry
+	}
+	entry.refs++
+	return &PooledStore{MsgStore: entry.store, pool: p, key: key}, nil
+}
+
+// release drops one reference to the store under key and closes it when
+// none are left.
+func (p *StorePool) release(key string) error {
+	p.mu.Lock()
+	entry := p.stores[key]
+	entry.refs--
+	if entry.refs > 0 {
+		p.mu.Unlock()
+		return nil
+	}
+	delete(p.stores, key)
+	p.mu.Unlock()
+
+	if closer, ok := entry.store.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// poolKey returns the canonical form of config used to match equivalent
+// configurations.
+func poolKey(config StoreConfig) (string, error) {
+	if config.BasePath != "" {
+		config.BasePath = filepath.Clean(config.BasePath)
+	}
+	if len(config.Options) == 0 {
+		config.Options = nil
+	}
+	// Maps marshal with sorted keys, so equal options give equal keys.
+	data, err := json.Marshal(config)
+	return string(data), err
+}
+
+// PooledStore is a handle on a store shared through a StorePool. Optional
+// interfaces are implemented by the embedded store, so type-assert
+// MsgStore rather than the handle itself.
+type PooledStore struct {
+	MsgStore
+
+	pool *StorePool
+	key  string
+	once sync.Once
+}
+
+// Close releases the handle. The last handle on a store closes it, if it
+// implements io.Closer. Calls after the first do nothing.
+func (h *PooledStore) Close() error {
+	var err error
+	h.once.Do(func() { err = h.pool.release(h.key) })
+	return err
+}
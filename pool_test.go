@@ -0,0 +1,98 @@
+package msgstore_test
+
+import (
+	"context"
+	"io"
+	"sync/atomic"
+	"testing"
+
+	"github.com/infodancer/msgstore"
+)
+
+// closingStore counts how often it is closed.
+type closingStore struct {
+	msgstore.MsgStore
+	closed *atomic.Int32
+}
+
+func (s *closingStore) Close() error {
+	s.closed.Add(1)
+	return nil
+}
+
+var (
+	poolOpens  atomic.Int32
+	poolCloses atomic.Int32
+)
+
+func init() {
+	msgstore.Register("pooltest", func(config msgstore.StoreConfig) (msgstore.MsgStore, error) {
+		poolOpens.Add(1)
+		return &closingStore{closed: &poolCloses}, nil
+	})
+}
+
+func TestStorePool(t *testing.T) {
+	poolOpens.Store(0)
+	poolCloses.Store(0)
+	pool := msgstore.NewStorePool()
+
+	a, err := pool.Open(msgstore.StoreConfig{Type: "pooltest", BasePath: "/var/mail/", Options: map[string]string{"x": "1", "y": "2"}})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	b, err := pool.Open(msgstore.StoreConfig{Type: "pooltest", BasePath: "/var/mail", Options: map[string]string{"y": "2", "x": "1"}})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	c, err := pool.Open(msgstore.StoreConfig{Type: "pooltest", BasePath: "/srv/mail"})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if a.MsgStore != b.MsgStore || a.MsgStore == c.MsgStore {
+		t.Fatal("equivalent configurations should share a store, others not")
+	}
+	if n := poolOpens.Load(); n != 2 {
+		t.Fatalf("factory called %d times, want 2", n)
+	}
+
+	if err := a.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := a.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+	if n := poolCloses.Load(); n != 0 {
+		t.Fatalf("store closed with a handle still open")
+	}
+	_ = b.Close()
+	_ = c.Close()
+	if n := poolCloses.Load(); n != 2 {
+		t.Fatalf("stores closed %d times, want 2", n)
+	}
+
+	// A new handle after the last Close opens the store again.
+	d, err := pool.Open(msgstore.StoreConfig{Type: "pooltest", BasePath: "/var/mail", Options: map[string]string{"x": "1", "y": "2"}})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer d.Close()
+	if n := poolOpens.Load(); n != 3 {
+		t.Errorf("factory called %d times, want 3", n)
+	}
+}
+
+func TestOpenShared_OptionalInterfaces(t *testing.T) {
+	h, err := msgstore.OpenShared(msgstore.StoreConfig{Type: "maildir", BasePath: t.TempDir()})
+	if err != nil {
+		t.Fatalf("OpenShared: %v", err)
+	}
+	defer h.Close()
+	if _, ok := h.MsgStore.(msgstore.FolderStore); !ok {
+		t.Error("pooled maildir store does not implement FolderStore")
+	}
+	if _, err := h.List(context.Background(), "user@example.com"); err != nil {
+		t.Errorf("List: %v", err)
+	}
+	var _ io.Closer = h
+}
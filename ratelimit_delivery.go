@@ -0,0 +1,206 @@
+package msgstore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/infodancer/msgstore/errors"
+)
+
+// RateLimit configures per-mailbox delivery ceilings. A zero field disables
+// that limit.
+type RateLimit struct {
+	// MessagesPerMinute is the sustained number of messages a mailbox may
+	// receive per minute. Bursts up to this size are allowed.
+	MessagesPerMinute int
+
+	// BytesPerHour is the sustained number of message bytes a mailbox may
+	// receive per hour. Bursts up to this size are allowed.
+	BytesPerHour int64
+}
+
+// RateLimitBucket is the token bucket state for one mailbox.
+type RateLimitBucket struct {
+	// Messages is the number of message tokens available.
+	Messages float64
+
+	// Bytes is the number of byte tokens available.
+	Bytes float64
+
+	// Updated is when the bucket was last refilled.
+	Updated time.Time
+}
+
+// RateLimitState stores token buckets between deliveries. The default keeps
+// them in memory; an implementation backed by shared storage lets several
+// smtpd processes enforce one limit. Calls for a given delivery are
+// serialized by the RateLimitingDeliveryAgent, but implementations shared
+// across processes must tolerate concurrent writers.
+type RateLimitState interface {
+	// Load returns the bucket for mailbox. ok is false if none is stored.
+	Load(ctx context.Context, mailbox string) (bucket RateLimitBucket, ok bool, err error)
+
+	// Store saves the bucket for mailbox.
+	Store(ctx context.Context, mailbox string, bucket RateLimitBucket) error
+}
+
+// MemoryRateLimitState is an in-process RateLimitState.
+type MemoryRateLimitState struct {
+	mu      sync.Mutex
+	buckets map[string]RateLimitBucket
+}
+
+// NewMemoryRateLimitState creates an empty in-memory rate limit state.
+func NewMemoryRateLimitState() *MemoryRateLimitState {
+	return &MemoryRateLimitState{buckets: make(map[string]RateLimitBucket)}
+}
+
+// Load implements RateLimitState.
+func (m *MemoryRateLimitState) Load(ctx context.Context, mailbox string) (RateLimitBucket, bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	bucket, ok := m.buckets[mailbox]
+	return bucket, ok, nil
+}
+
+// Store implements RateLimitState.
+func (m *MemoryRateLimitState) Store(ctx context.Context, mailbox string, bucket RateLimitBucket) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.buckets[mailbox] = bucket
+	return nil
+}
+
+// RateLimitingDeliveryAgent wraps a DeliveryAgent to enforce per-mailbox
+// delivery rates with token buckets.
+//
+// A delivery is checked against every recipient mailbox before anything is
+// stored. If any mailbox is over its limit, nothing is delivered, no tokens
+// are consumed, and Deliver returns an error wrapping ErrRateLimited, so the
+// whole message can be retried without duplicating copies.
+type RateLimitingDeliveryAgent struct {
+	// underlying is the wrapped delivery agent.
+	underlying DeliveryAgent
+
+	// limit is the ceiling applied to every mailbox.
+	limit RateLimit
+
+	// state holds the token buckets.
+	state RateLimitState
+
+	// mu serializes check-and-consume so concurrent deliveries to the same
+	// mailbox cannot both spend the last token.
+	mu sync.Mutex
+
+	// now returns the current time; replaced in tests.
+	now func() time.Time
+}
+
+// NewRateLimitingDeliveryAgent creates a rate limiting delivery agent.
+// underlying is the delivery agent to wrap. If state is nil, buckets are
+// kept in memory.
+func NewRateLimitingDeliveryAgent(underlying DeliveryAgent, limit RateLimit, state RateLimitState) *RateLimitingDeliveryAgent {
+	if state == nil {
+		state = NewMemoryRateLimitState()
+	}
+	return &RateLimitingDeliveryAgent{
+		underlying: underlying,
+		limit:      limit,
+		state:      state,
+		now:        time.Now,
+	}
+}
+
+// Deliver checks the recipients' rates, consumes tokens and delivers.
+func (r *RateLimitingDeliveryAgent) Deliver(ctx context.Context, envelope Envelope, message io.Reader) error {
+	data, err := io.ReadAll(message)
+	if err != nil {
+		return fmt.Errorf("read message: %w", err)
+	}
+
+	if err := r.consume(ctx, envelope.Recipients, int64(len(data))); err != nil {
+		return err
+	}
+	return r.underlying.Deliver(ctx, envelope, bytes.NewReader(data))
+}
+
+// consume charges one message of size bytes per recipient against the
+// recipients' mailboxes, or charges nothing if any mailbox would exceed
+// its limit.
+func (r *RateLimitingDeliveryAgent) consume(ctx context.Context, recipients []string, size int64) error {
+	// Count copies per mailbox: user+a and user+b share one mailbox.
+	copies := make(map[string]int)
+	var mailboxes []string
+	for _, recipient := range recipients {
+		mailbox := strings.ToLower(ParseRecipient(recipient).Address)
+		if copies[mailbox] == 0 {
+			mailboxes = append(mailboxes, mailbox)
+		}
+		copies[mailbox]++
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := r.now()
+	buckets := make([]RateLimitBucket, len(mailboxes))
+	for i, mailbox := range mailboxes {
+		bucket, ok, err := r.state.Load(ctx, mailbox)
+		if err != nil {
+			return fmt.Errorf("load rate limit state: %w", err)
+		}
+		bucket = r.refill(bucket, ok, now)
+		n := copies[mailbox]
+		if !allow(bucket.Messages, float64(n), float64(r.limit.MessagesPerMinute)) ||
+			!allow(bucket.Bytes, float64(int64(n)*size), float64(r.limit.BytesPerHour)) {
+			return fmt.Errorf("%w: %s", errors.ErrRateLimited, mailbox)
+		}
+		bucket.Messages -= float64(n)
+		bucket.Bytes -= float64(int64(n) * size)
+		buckets[i] = bucket
+	}
+
+	for i, mailbox := range mailboxes {
+		if err := r.state.Store(ctx, mailbox, buckets[i]); err != nil {
+			return fmt.Errorf("store rate limit state: %w", err)
+		}
+	}
+	return nil
+}
+
+// refill tops up a bucket for the time elapsed since it was last updated.
+// A bucket seen for the first time starts full.
+func (r *RateLimitingDeliveryAgent) refill(bucket RateLimitBucket, ok bool, now time.Time) RateLimitBucket {
+	msgCap := float64(r.limit.MessagesPerMinute)
+	byteCap := float64(r.limit.BytesPerHour)
+	if !ok {
+		return RateLimitBucket{Messages: msgCap, Bytes: byteCap, Updated: now}
+	}
+	elapsed := now.Sub(bucket.Updated).Seconds()
+	if elapsed > 0 {
+		bucket.Messages = min(msgCap, bucket.Messages+elapsed*msgCap/60)
+		bucket.Bytes = min(byteCap, bucket.Bytes+elapsed*byteCap/3600)
+	}
+	bucket.Updated = now
+	return bucket
+}
+
+// allow reports whether cost tokens may be taken from a bucket holding
+// tokens with the given capacity. A capacity of zero means unlimited. A
+// cost larger than the whole capacity is allowed from a full bucket, so a
+// single oversized message is delayed rather than refused forever.
+func allow(tokens, cost, capacity float64) bool {
+	if capacity == 0 {
+		return true
+	}
+	return tokens >= cost || tokens >= capacity
+}
+
+// Compile-time interface verification.
+var _ DeliveryAgent = (*RateLimitingDeliveryAgent)(nil)
+var _ RateLimitState = (*MemoryRateLimitState)(nil)
@@ -0,0 +1,107 @@
+package msgstore
+
+import (
+	"context"
+	stderrors "errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/infodancer/msgstore/errors"
+)
+
+// newTestRateLimiter returns a rate limiter over a mock agent with a
+// controllable clock.
+func newTestRateLimiter(limit RateLimit) (*RateLimitingDeliveryAgent, *mockDeliveryAgent, *time.Time) {
+	underlying := &mockDeliveryAgent{}
+	agent := NewRateLimitingDeliveryAgent(underlying, limit, nil)
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	agent.now = func() time.Time { return now }
+	return agent, underlying, &now
+}
+
+func deliverTo(agent DeliveryAgent, message string, recipients ...string) error {
+	envelope := Envelope{From: "sender@example.com", Recipients: recipients}
+	return agent.Deliver(context.Background(), envelope, strings.NewReader(message))
+}
+
+func TestRateLimitingDeliveryAgent_MessagesPerMinute(t *testing.T) {
+	agent, underlying, now := newTestRateLimiter(RateLimit{MessagesPerMinute: 2})
+
+	for i := 0; i < 2; i++ {
+		if err := deliverTo(agent, "hi", "user@example.com"); err != nil {
+			t.Fatalf("delivery %d failed: %v", i, err)
+		}
+	}
+	if err := deliverTo(agent, "hi", "User+lists@example.com"); !stderrors.Is(err, errors.ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited for subaddress of limited mailbox, got %v", err)
+	}
+	if err := deliverTo(agent, "hi", "other@example.com"); err != nil {
+		t.Fatalf("other mailbox should not be limited: %v", err)
+	}
+
+	*now = now.Add(30 * time.Second)
+	if err := deliverTo(agent, "hi", "user@example.com"); err != nil {
+		t.Fatalf("delivery after refill failed: %v", err)
+	}
+	if err := deliverTo(agent, "hi", "user@example.com"); !stderrors.Is(err, errors.ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+
+	if len(underlying.deliveries) != 4 {
+		t.Errorf("underlying received %d deliveries, want 4", len(underlying.deliveries))
+	}
+}
+
+func TestRateLimitingDeliveryAgent_BytesPerHour(t *testing.T) {
+	agent, _, now := newTestRateLimiter(RateLimit{BytesPerHour: 100})
+
+	if err := deliverTo(agent, strings.Repeat("x", 80), "user@example.com"); err != nil {
+		t.Fatalf("first delivery failed: %v", err)
+	}
+	if err := deliverTo(agent, strings.Repeat("x", 30), "user@example.com"); !stderrors.Is(err, errors.ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+
+	// A message larger than the whole allowance goes through once the
+	// bucket is full, rather than never.
+	*now = now.Add(time.Hour)
+	if err := deliverTo(agent, strings.Repeat("x", 500), "user@example.com"); err != nil {
+		t.Fatalf("oversized delivery from full bucket failed: %v", err)
+	}
+	*now = now.Add(time.Hour)
+	if err := deliverTo(agent, "x", "user@example.com"); !stderrors.Is(err, errors.ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited while paying off oversized message, got %v", err)
+	}
+}
+
+func TestRateLimitingDeliveryAgent_AllOrNothing(t *testing.T) {
+	agent, underlying, _ := newTestRateLimiter(RateLimit{MessagesPerMinute: 1})
+
+	if err := deliverTo(agent, "hi", "busy@example.com"); err != nil {
+		t.Fatalf("first delivery failed: %v", err)
+	}
+	if err := deliverTo(agent, "hi", "idle@example.com", "busy@example.com"); !stderrors.Is(err, errors.ErrRateLimited) {
+		t.Fatalf("expected ErrRateLimited, got %v", err)
+	}
+	if len(underlying.deliveries) != 1 {
+		t.Fatalf("rejected delivery reached underlying agent")
+	}
+
+	// The rejected delivery did not spend idle@'s token.
+	if err := deliverTo(agent, "hi", "idle@example.com"); err != nil {
+		t.Fatalf("idle mailbox was charged for a rejected delivery: %v", err)
+	}
+}
+
+func TestRateLimitingDeliveryAgent_Unlimited(t *testing.T) {
+	agent, underlying, _ := newTestRateLimiter(RateLimit{})
+	for i := 0; i < 100; i++ {
+		if err := deliverTo(agent, "hi", "user@example.com"); err != nil {
+			t.Fatalf("delivery %d failed: %v", i, err)
+		}
+	}
+	if len(underlying.deliveries) != 100 {
+		t.Errorf("underlying received %d deliveries, want 100", len(underlying.deliveries))
+	}
+}
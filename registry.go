@@ -1,6 +1,7 @@
 package msgstore
 
 import (
+	"fmt"
 	"sort"
 	"sync"
 
@@ -22,15 +23,52 @@ type StoreConfig struct {
 	Options map[string]string
 }
 
+// OptionSpec describes one option a store type accepts in
+// StoreConfig.Options.
+type OptionSpec struct {
+	Name        string
+	Description string
+
+	// Default is the value used when the option is not set; "" leaves it
+	// unset.
+	Default string
+}
+
+// OptionSchema lists every option a store type accepts.
+type OptionSchema []OptionSpec
+
+// registration is a registered store type.
+type registration struct {
+	factory StoreFactory
+	schema  OptionSchema // nil: options are not checked
+}
+
 var (
 	registryMu sync.RWMutex
-	registry   = make(map[string]StoreFactory)
+	registry   = make(map[string]registration)
 )
 
 // Register adds a store factory to the registry.
 // It panics if called with an empty name or nil factory,
 // or if the name is already registered.
+//
+// Options of a type registered this way are passed to the factory
+// unchecked; RegisterWithSchema rejects unknown ones.
 func Register(name string, factory StoreFactory) {
+	register(name, factory, nil)
+}
+
+// RegisterWithSchema is like Register, but Open rejects configurations
+// with options missing from schema, and fills in the defaults of options
+// that are not set.
+func RegisterWithSchema(name string, factory StoreFactory, schema OptionSchema) {
+	if schema == nil {
+		schema = OptionSchema{}
+	}
+	register(name, factory, schema)
+}
+
+func register(name string, factory StoreFactory, schema OptionSchema) {
 	if name == "" {
 		panic("msgstore: Register called with empty name")
 	}
@@ -44,19 +82,112 @@ func Register(name string, factory StoreFactory) {
 	if _, exists := registry[name]; exists {
 		panic("msgstore: Register called twice for " + name)
 	}
-	registry[name] = factory
+	registry[name] = registration{factory: factory, schema: schema}
+}
+
+// Deregister removes a store type from the registry, so a test can
+// register a fake under its name. It does nothing if name is not
+// registered.
+func Deregister(name string) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	delete(registry, name)
+}
+
+// MustReplace swaps the factory of a registered store type, keeping its
+// option schema, and returns a function that restores the original. It is
+// meant for tests that substitute a fake for a real backend:
+//
+//	defer msgstore.MustReplace("maildir", fakeFactory)()
+//
+// It panics if factory is nil or name is not registered.
+func MustReplace(name string, factory StoreFactory) (restore func()) {
+	if factory == nil {
+		panic("msgstore: MustReplace called with nil factory")
+	}
+
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	original, exists := registry[name]
+	if !exists {
+		panic("msgstore: MustReplace called for unregistered " + name)
+	}
+	registry[name] = registration{factory: factory, schema: original.schema}
+	return func() {
+		registryMu.Lock()
+		defer registryMu.Unlock()
+		registry[name] = original
+	}
 }
 
 // Open creates a MsgStore using the registered factory for the config type.
+// If the type has an option schema, an option it does not list fails with
+// an error wrapping ErrStoreConfigInvalid.
 func Open(config StoreConfig) (MsgStore, error) {
 	registryMu.RLock()
-	factory, ok := registry[config.Type]
+	reg, ok := registry[config.Type]
 	registryMu.RUnlock()
 
 	if !ok {
 		return nil, errors.ErrStoreNotRegistered
 	}
-	return factory(config)
+	if reg.schema != nil {
+		options, err := reg.schema.apply(config.Type, config.Options)
+		if err != nil {
+			return nil, err
+		}
+		config.Options = options
+	}
+	return reg.factory(config)
+}
+
+// Schema returns the option schema of a registered store type, and false
+// if the type is not registered or was registered without one.
+func Schema(name string) (OptionSchema, bool) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	reg, ok := registry[name]
+	if !ok || reg.schema == nil {
+		return nil, false
+	}
+	return append(OptionSchema(nil), reg.schema...), true
+}
+
+// apply checks options against the schema of store type typ and returns a
+// copy with defaults filled in.
+func (schema OptionSchema) apply(typ string, options map[string]string) (map[string]string, error) {
+	known := make(map[string]OptionSpec, len(schema))
+	for _, spec := range schema {
+		known[spec.Name] = spec
+	}
+	var unknown []string
+	for key := range options {
+		if _, ok := known[key]; !ok {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		names := make([]string, 0, len(schema))
+		for _, spec := range schema {
+			names = append(names, spec.Name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("%w: unknown %s option %q (accepted: %v)", errors.ErrStoreConfigInvalid, typ, unknown[0], names)
+	}
+
+	result := make(map[string]string, len(schema))
+	for _, spec := range schema {
+		if spec.Default != "" {
+			result[spec.Name] = spec.Default
+		}
+	}
+	for key, value := range options {
+		result[key] = value
+	}
+	return result, nil
 }
 
 // RegisteredTypes returns a sorted list of registered store type names.
@@ -2,6 +2,7 @@ package msgstore_test
 
 import (
 	"context"
+	stderrors "errors"
 	"io"
 	"strings"
 	"testing"
@@ -130,7 +131,7 @@ func TestMsgStoreInterface(t *testing.T) {
 	}
 
 	// Test Expunge (MessageStore)
-	if err := store.Expunge(ctx, mailbox); err != nil {
+	if _, err := store.Expunge(ctx, mailbox); err != nil {
 		t.Fatalf("Expunge failed: %v", err)
 	}
 
@@ -143,3 +144,98 @@ func TestMsgStoreInterface(t *testing.T) {
 		t.Fatalf("expected 0 messages after expunge, got %d", len(messages))
 	}
 }
+
+func TestOpenUnknownOption(t *testing.T) {
+	_, err := msgstore.Open(msgstore.StoreConfig{
+		Type:     "maildir",
+		BasePath: t.TempDir(),
+		Options:  map[string]string{"maildir_subdr": "Maildir"},
+	})
+	if !stderrors.Is(err, errors.ErrStoreConfigInvalid) {
+		t.Fatalf("expected ErrStoreConfigInvalid, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "maildir_subdr") {
+		t.Errorf("error %q does not name the unknown option", err)
+	}
+}
+
+func TestOptionSchemaDefaults(t *testing.T) {
+	var got map[string]string
+	msgstore.RegisterWithSchema("schematest", func(config msgstore.StoreConfig) (msgstore.MsgStore, error) {
+		got = config.Options
+		return nil, nil
+	}, msgstore.OptionSchema{
+		{Name: "mode", Default: "fast"},
+		{Name: "extra"},
+	})
+
+	if _, err := msgstore.Open(msgstore.StoreConfig{Type: "schematest", Options: map[string]string{"extra": "x"}}); err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	if got["mode"] != "fast" || got["extra"] != "x" {
+		t.Errorf("factory got options %v", got)
+	}
+
+	schema, ok := msgstore.Schema("schematest")
+	if !ok || len(schema) != 2 || schema[0].Default != "fast" {
+		t.Errorf("Schema = %v, %v", schema, ok)
+	}
+	if _, ok := msgstore.Schema("nonexistent"); ok {
+		t.Error("Schema reported an unregistered type")
+	}
+}
+
+func TestMustReplace(t *testing.T) {
+	fake := &closingStore{}
+	restore := msgstore.MustReplace("maildir", func(config msgstore.StoreConfig) (msgstore.MsgStore, error) {
+		return fake, nil
+	})
+	store, err := msgstore.Open(msgstore.StoreConfig{Type: "maildir", BasePath: t.TempDir()})
+	if err != nil || store != fake {
+		t.Fatalf("Open with replaced factory = %v, %v", store, err)
+	}
+	// The schema stays in force for the replacement.
+	_, err = msgstore.Open(msgstore.StoreConfig{Type: "maildir", Options: map[string]string{"bogus": "1"}})
+	if !stderrors.Is(err, errors.ErrStoreConfigInvalid) {
+		t.Errorf("unknown option with replaced factory: got %v", err)
+	}
+
+	restore()
+	store, err = msgstore.Open(msgstore.StoreConfig{Type: "maildir", BasePath: t.TempDir()})
+	if err != nil || store == fake {
+		t.Fatalf("Open after restore = %v, %v", store, err)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("MustReplace of an unregistered type did not panic")
+		}
+	}()
+	msgstore.MustReplace("nonexistent", func(msgstore.StoreConfig) (msgstore.MsgStore, error) { return nil, nil })
+}
+
+func TestDeregister(t *testing.T) {
+	factory := func(msgstore.StoreConfig) (msgstore.MsgStore, error) { return nil, nil }
+	msgstore.Register("deregistertest", factory)
+	msgstore.Deregister("deregistertest")
+	if _, err := msgstore.Open(msgstore.StoreConfig{Type: "deregistertest"}); err != errors.ErrStoreNotRegistered {
+		t.Fatalf("Open after Deregister: got %v", err)
+	}
+	// The name can be registered again.
+	msgstore.Register("deregistertest", factory)
+	msgstore.Deregister("deregistertest")
+	msgstore.Deregister("deregistertest")
+}
+
+func TestOpenURL(t *testing.T) {
+	store, err := msgstore.OpenURL("maildir://" + t.TempDir() + "?maildir_subdir=Maildir")
+	if err != nil {
+		t.Fatalf("OpenURL: %v", err)
+	}
+	if _, ok := store.(msgstore.FolderStore); !ok {
+		t.Error("OpenURL did not return a maildir store")
+	}
+	if _, err := msgstore.OpenURL("maildir:///var/mail?maildir_subdr=Maildir"); !stderrors.Is(err, errors.ErrStoreConfigInvalid) {
+		t.Errorf("OpenURL with a misspelled option: got %v", err)
+	}
+}
@@ -287,7 +287,7 @@ func TestRoundTrip_Expunge_RemovesPermanently(t *testing.T) {
 	if err := store.Delete(ctx, "grace@test.local", uid); err != nil {
 		t.Fatalf("Delete: %v", err)
 	}
-	if err := store.Expunge(ctx, "grace@test.local"); err != nil {
+	if _, err := store.Expunge(ctx, "grace@test.local"); err != nil {
 		t.Fatalf("Expunge: %v", err)
 	}
 
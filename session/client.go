@@ -0,0 +1,441 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"os/exec"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+// Client implements msgstore.MsgStore and msgstore.FolderStore over a
+// session protocol connection. Requests are serialized on the connection;
+// Client is safe for concurrent use. Retrieved messages are read into
+// memory before they are returned, so an abandoned reader never stalls the
+// session.
+//
+// Any failure other than an error reported by the server (a broken
+// connection, a malformed response, or a context cancelled mid-request)
+// leaves the stream at an unknown position, so the Client closes the
+// connection and fails every later call.
+type Client struct {
+	mu      sync.Mutex
+	conn    io.ReadWriteCloser
+	r       *bufio.Reader
+	w       *bufio.Writer
+	mailbox string
+	wait    func() error
+	err     error // set once the connection has been abandoned
+}
+
+// NewClient starts a session on conn. The Client owns conn and closes it
+// on Close.
+func NewClient(conn io.ReadWriteCloser) *Client {
+	return &Client{conn: conn, r: bufio.NewReader(conn), w: bufio.NewWriter(conn)}
+}
+
+// Dial connects to a session server listening on the Unix socket at path.
+func Dial(ctx context.Context, path string) (*Client, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", path)
+	if err != nil {
+		return nil, err
+	}
+	return NewClient(conn), nil
+}
+
+// Start runs a storage process that serves a session on its stdin and
+// stdout, and returns a Client for it. The process is expected to exit when
+// the session ends; Close waits for it.
+func Start(name string, args ...string) (*Client, error) {
+	cmd := exec.Command(name, args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	c := NewClient(&pipeConn{Reader: stdout, WriteCloser: stdin})
+	c.wait = cmd.Wait
+	return c, nil
+}
+
+// pipeConn joins a subprocess's stdout and stdin into one connection.
+type pipeConn struct {
+	io.Reader
+	io.WriteCloser
+}
+
+// Compile-time interface verification.
+var (
+	_ msgstore.MsgStore    = (*Client)(nil)
+	_ msgstore.FolderStore = (*Client)(nil)
+)
+
+// Close ends the session and closes the connection.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var err error
+	if c.err == nil {
+		if err := writeLine(c.w, "QUIT"); err == nil && c.w.Flush() == nil {
+			_, _ = readLine(c.r)
+		}
+		err = c.conn.Close()
+		c.err = errClosed
+	}
+	if c.wait != nil {
+		if werr := c.wait(); err == nil {
+			err = werr
+		}
+	}
+	return err
+}
+
+// errClosed is returned by calls made after Close.
+var errClosed = fmt.Errorf("session: client closed")
+
+// call runs one request while holding the session. body, if non-nil, is
+// sent as data after the request line. read consumes the rest of a
+// successful response.
+func (c *Client) call(ctx context.Context, mailbox string, words []string, body io.Reader, read func(ok []string) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil {
+		return c.err
+	}
+
+	if dl, ok := c.conn.(interface{ SetDeadline(time.Time) error }); ok {
+		deadline, _ := ctx.Deadline()
+		_ = dl.SetDeadline(deadline)
+		// Cancellation interrupts a blocked read or write by expiring
+		// the deadline.
+		stop := context.AfterFunc(ctx, func() { _ = dl.SetDeadline(time.Now()) })
+		defer stop()
+	}
+	err := c.exchange(mailbox, words, body, read)
+	if err == nil {
+		return nil
+	}
+	if _, remote := err.(*remoteError); remote {
+		return err
+	}
+	// The stream position is unknown: abandon the connection rather than
+	// read the next response from the middle of this one.
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		err = ctxErr
+	}
+	c.err = fmt.Errorf("session: connection abandoned: %w", err)
+	_ = c.conn.Close()
+	return err
+}
+
+// exchange selects mailbox if needed, then runs one request.
+func (c *Client) exchange(mailbox string, words []string, body io.Reader, read func(ok []string) error) error {
+	if mailbox != "" && mailbox != c.mailbox {
+		if _, err := c.roundTrip([]string{"MAILBOX", mailbox}, nil); err != nil {
+			return err
+		}
+		c.mailbox = mailbox
+	}
+	ok, err := c.roundTrip(words, body)
+	if err != nil {
+		return err
+	}
+	if read != nil {
+		return read(ok)
+	}
+	return nil
+}
+
+// roundTrip sends a request and reads the response line, returning the
+// words after +OK.
+func (c *Client) roundTrip(words []string, body io.Reader) ([]string, error) {
+	if err := writeLine(c.w, words...); err != nil {
+		return nil, err
+	}
+	if body != nil {
+		if err := writeData(c.w, body); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.w.Flush(); err != nil {
+		return nil, err
+	}
+	resp, err := readLine(c.r)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case len(resp) >= 1 && resp[0] == "+OK":
+		return resp[1:], nil
+	case len(resp) == 3 && resp[0] == "-ERR":
+		return nil, decodeError(resp[1], resp[2])
+	}
+	return nil, fmt.Errorf("%w: bad response", errProtocol)
+}
+
+// readList reads the lines of a list response.
+func (c *Client) readList(ok []string) ([]string, error) {
+	if len(ok) != 1 {
+		return nil, fmt.Errorf("%w: bad list response", errProtocol)
+	}
+	n, err := strconv.Atoi(ok[0])
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("%w: bad list count", errProtocol)
+	}
+	lines := make([]string, 0, n)
+	for range n {
+		words, err := readLine(c.r)
+		if err != nil {
+			return nil, err
+		}
+		if len(words) != 1 {
+			return nil, fmt.Errorf("%w: bad list line", errProtocol)
+		}
+		lines = append(lines, words[0])
+	}
+	return lines, nil
+}
+
+// withFolder appends folder to words when it is not the mailbox root.
+func withFolder(words []string, folder string) []string {
+	if folder != "" {
+		words = append(words, folder)
+	}
+	return words
+}
+
+// List implements msgstore.MessageStore.
+func (c *Client) List(ctx context.Context, mailbox string) ([]msgstore.MessageInfo, error) {
+	return c.ListInFolder(ctx, mailbox, "")
+}
+
+// Retrieve implements msgstore.MessageStore.
+func (c *Client) Retrieve(ctx context.Context, mailbox string, uid string) (io.ReadCloser, error) {
+	return c.RetrieveFromFolder(ctx, mailbox, "", uid)
+}
+
+// RetrieveHeaders returns the header section of a message, including the
+// blank line that ends it. folder may be "" for the mailbox root.
+func (c *Client) RetrieveHeaders(ctx context.Context, mailbox string, folder string, uid string) ([]byte, error) {
+	return c.retrieve(ctx, "HEADERS", mailbox, folder, uid)
+}
+
+// Delete implements msgstore.MessageStore.
+func (c *Client) Delete(ctx context.Context, mailbox string, uid string) error {
+	return c.DeleteInFolder(ctx, mailbox, "", uid)
+}
+
+// Expunge implements msgstore.MessageStore.
+func (c *Client) Expunge(ctx context.Context, mailbox string) ([]string, error) {
+	return c.ExpungeFolder(ctx, mailbox, "")
+}
+
+// Stat implements msgstore.MessageStore.
+func (c *Client) Stat(ctx context.Context, mailbox string) (int, int64, error) {
+	return c.StatFolder(ctx, mailbox, "")
+}
+
+// Deliver implements msgstore.DeliveryAgent.
+func (c *Client) Deliver(ctx context.Context, envelope msgstore.Envelope, message io.Reader) error {
+	data, err := msgstore.MarshalEnvelope(envelope)
+	if err != nil {
+		return err
+	}
+	return c.call(ctx, "", []string{"DELIVER", string(data)}, message, nil)
+}
+
+// ListInFolder implements msgstore.FolderStore.
+func (c *Client) ListInFolder(ctx context.Context, mailbox string, folder string) ([]msgstore.MessageInfo, error) {
+	var msgs []msgstore.MessageInfo
+	err := c.call(ctx, mailbox, withFolder([]string{"LIST"}, folder), nil, func(ok []string) error {
+		lines, err := c.readList(ok)
+		if err != nil {
+			return err
+		}
+		msgs = make([]msgstore.MessageInfo, len(lines))
+		for i, line := range lines {
+			if err := json.Unmarshal([]byte(line), &msgs[i]); err != nil {
+				return fmt.Errorf("%w: %v", errProtocol, err)
+			}
+		}
+		return nil
+	})
+	return msgs, err
+}
+
+// StatFolder implements msgstore.FolderStore.
+func (c *Client) StatFolder(ctx context.Context, mailbox string, folder string) (int, int64, error) {
+	var count int
+	var total int64
+	err := c.call(ctx, mailbox, withFolder([]string{"STAT"}, folder), nil, func(ok []string) error {
+		if len(ok) != 2 {
+			return fmt.Errorf("%w: bad STAT response", errProtocol)
+		}
+		var err1, err2 error
+		count, err1 = strconv.Atoi(ok[0])
+		total, err2 = strconv.ParseInt(ok[1], 10, 64)
+		if err1 != nil || err2 != nil {
+			return fmt.Errorf("%w: bad STAT response", errProtocol)
+		}
+		return nil
+	})
+	return count, total, err
+}
+
+// RetrieveFromFolder implements msgstore.FolderStore.
+func (c *Client) RetrieveFromFolder(ctx context.Context, mailbox string, folder string, uid string) (io.ReadCloser, error) {
+	data, err := c.retrieve(ctx, "RETR", mailbox, folder, uid)
+	if err != nil {
+		return nil, err
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (c *Client) retrieve(ctx context.Context, cmd, mailbox, folder, uid string) ([]byte, error) {
+	var data []byte
+	err := c.call(ctx, mailbox, withFolder([]string{cmd, uid}, folder), nil, func([]string) error {
+		var err error
+		data, err = io.ReadAll(&dataReader{r: c.r})
+		return err
+	})
+	return data, err
+}
+
+// DeleteInFolder implements msgstore.FolderStore.
+func (c *Client) DeleteInFolder(ctx context.Context, mailbox string, folder string, uid string) error {
+	return c.call(ctx, mailbox, withFolder([]string{"DELE", uid}, folder), nil, nil)
+}
+
+// ExpungeFolder implements msgstore.FolderStore.
+func (c *Client) ExpungeFolder(ctx context.Context, mailbox string, folder string) ([]string, error) {
+	var removed []string
+	err := c.call(ctx, mailbox, withFolder([]string{"EXPUNGE"}, folder), nil, func(ok []string) error {
+		var err error
+		removed, err = c.readList(ok)
+		return err
+	})
+	return removed, err
+}
+
+// DeliverToFolder implements msgstore.FolderStore.
+func (c *Client) DeliverToFolder(ctx context.Context, mailbox string, folder string, message io.Reader) error {
+	return c.call(ctx, mailbox, []string{"PUT", folder}, message, nil)
+}
+
+// AppendToFolder implements msgstore.FolderStore. The date is sent with
+// one-second precision.
+func (c *Client) AppendToFolder(ctx context.Context, mailbox string, folder string, r io.Reader, flags []string, date time.Time) (string, error) {
+	var unix int64
+	if !date.IsZero() {
+		unix = date.Unix()
+	}
+	words := append([]string{"APPEND", folder, strconv.FormatInt(unix, 10)}, flags...)
+	return c.uidCall(ctx, mailbox, words, r)
+}
+
+// uidCall runs a command answered with "+OK <uid>".
+func (c *Client) uidCall(ctx context.Context, mailbox string, words []string, body io.Reader) (string, error) {
+	var uid string
+	err := c.call(ctx, mailbox, words, body, func(ok []string) error {
+		if len(ok) != 1 {
+			return fmt.Errorf("%w: missing UID", errProtocol)
+		}
+		uid = ok[0]
+		return nil
+	})
+	return uid, err
+}
+
+// CreateFolder implements msgstore.FolderStore.
+func (c *Client) CreateFolder(ctx context.Context, mailbox string, folder string) error {
+	return c.call(ctx, mailbox, []string{"CREATE", folder}, nil, nil)
+}
+
+// ListFolders implements msgstore.FolderStore.
+func (c *Client) ListFolders(ctx context.Context, mailbox string) ([]string, error) {
+	var folders []string
+	err := c.call(ctx, mailbox, []string{"FOLDERS"}, nil, func(ok []string) error {
+		var err error
+		folders, err = c.readList(ok)
+		return err
+	})
+	return folders, err
+}
+
+// DeleteFolder implements msgstore.FolderStore.
+func (c *Client) DeleteFolder(ctx context.Context, mailbox string, folder string, opts ...msgstore.DeleteFolderOption) error {
+	var o msgstore.DeleteFolderOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	words := []string{"DELFOLDER", folder}
+	if o.Force {
+		words = append(words, "FORCE")
+	}
+	if o.Recursive {
+		words = append(words, "RECURSIVE")
+	}
+	return c.call(ctx, mailbox, words, nil, nil)
+}
+
+// RenameFolder implements msgstore.FolderStore.
+func (c *Client) RenameFolder(ctx context.Context, mailbox string, oldName string, newName string) error {
+	return c.call(ctx, mailbox, []string{"RENAME", oldName, newName}, nil, nil)
+}
+
+// flagModeWords maps flag modes to FLAGS mode words.
+var flagModeWords = map[msgstore.FlagMode]string{
+	msgstore.FlagModeSet:    "SET",
+	msgstore.FlagModeAdd:    "ADD",
+	msgstore.FlagModeRemove: "REMOVE",
+}
+
+// SetFlagsInFolder implements msgstore.FolderStore.
+func (c *Client) SetFlagsInFolder(ctx context.Context, mailbox string, folder string, uid string, mode msgstore.FlagMode, flags []string) error {
+	word, ok := flagModeWords[mode]
+	if !ok {
+		return errors.ErrNotSupported
+	}
+	words := append([]string{"FLAGS", folder, uid, word}, flags...)
+	return c.call(ctx, mailbox, words, nil, nil)
+}
+
+// CopyMessage implements msgstore.FolderStore.
+func (c *Client) CopyMessage(ctx context.Context, mailbox string, srcFolder string, uid string, destFolder string) (string, error) {
+	return c.uidCall(ctx, mailbox, []string{"COPY", srcFolder, uid, destFolder}, nil)
+}
+
+// UIDValidity implements msgstore.FolderStore.
+func (c *Client) UIDValidity(ctx context.Context, mailbox string, folder string) (uint32, error) {
+	var v uint64
+	err := c.call(ctx, mailbox, []string{"UIDVALIDITY", folder}, nil, func(ok []string) error {
+		if len(ok) != 1 {
+			return fmt.Errorf("%w: bad UIDVALIDITY response", errProtocol)
+		}
+		var err error
+		if v, err = strconv.ParseUint(ok[0], 10, 32); err != nil {
+			return fmt.Errorf("%w: bad UIDVALIDITY response", errProtocol)
+		}
+		return nil
+	})
+	return uint32(v), err
+}
@@ -0,0 +1,274 @@
+package session_test
+
+import (
+	"bufio"
+	"context"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+	"github.com/infodancer/msgstore/maildir"
+	"github.com/infodancer/msgstore/session"
+)
+
+// serve runs a session server on a Unix socket and returns its path.
+func serve(t *testing.T, srv *session.Server) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "store.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- srv.Serve(ctx, l) }()
+	t.Cleanup(func() {
+		cancel()
+		if err := <-done; err != nil {
+			t.Errorf("Serve: %v", err)
+		}
+	})
+	return path
+}
+
+func TestClient_Registered(t *testing.T) {
+	path := serve(t, session.NewServer(maildir.NewStore(t.TempDir(), "", "")))
+
+	store, err := msgstore.Open(msgstore.StoreConfig{Type: "session", Options: map[string]string{"socket": path}})
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	client := store.(*session.Client)
+	defer func() { _ = client.Close() }()
+	ctx := context.Background()
+	mailbox := "user@example.com"
+
+	envelope := msgstore.Envelope{From: "sender@example.com", Recipients: []string{mailbox}}
+	if err := client.Deliver(ctx, envelope, strings.NewReader("Subject: hi\r\n\r\nbody\r\n")); err != nil {
+		t.Fatalf("Deliver: %v", err)
+	}
+	msgs, err := client.List(ctx, mailbox)
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("List = %v, %v; want one message", msgs, err)
+	}
+	rc, err := client.Retrieve(ctx, mailbox, msgs[0].UID)
+	if err != nil {
+		t.Fatalf("Retrieve: %v", err)
+	}
+	data, _ := io.ReadAll(rc)
+	_ = rc.Close()
+	if !strings.Contains(string(data), "body") {
+		t.Errorf("Retrieve = %q", data)
+	}
+	header, err := client.RetrieveHeaders(ctx, mailbox, "", msgs[0].UID)
+	if err != nil || strings.Contains(string(header), "body") {
+		t.Errorf("RetrieveHeaders = %q, %v", header, err)
+	}
+	if err := client.Delete(ctx, mailbox, msgs[0].UID); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if removed, err := client.Expunge(ctx, mailbox); err != nil || len(removed) != 1 {
+		t.Errorf("Expunge = %v, %v", removed, err)
+	}
+	if count, _, err := client.Stat(ctx, mailbox); err != nil || count != 0 {
+		t.Errorf("Stat = %d, %v; want 0", count, err)
+	}
+}
+
+func TestClient_Folders(t *testing.T) {
+	mailbox := "user@example.com"
+	path := serve(t, session.NewServer(maildir.NewStore(t.TempDir(), "", ""), session.WithMailbox(mailbox)))
+	client, err := session.Dial(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer func() { _ = client.Close() }()
+	ctx := context.Background()
+
+	if _, err := client.List(ctx, "other@example.com"); !stderrors.Is(err, errors.ErrPermissionDenied) {
+		t.Errorf("List other mailbox: err = %v, want ErrPermissionDenied", err)
+	}
+	if err := client.CreateFolder(ctx, mailbox, "Work"); err != nil {
+		t.Fatalf("CreateFolder: %v", err)
+	}
+	if err := client.CreateFolder(ctx, mailbox, "Work"); !stderrors.Is(err, errors.ErrFolderExists) {
+		t.Errorf("CreateFolder twice: err = %v, want ErrFolderExists", err)
+	}
+	uid, err := client.AppendToFolder(ctx, mailbox, "Work", strings.NewReader("Subject: a\r\n\r\n"), []string{"\\Seen"}, time.Now())
+	if err != nil {
+		t.Fatalf("AppendToFolder: %v", err)
+	}
+	if err := client.SetFlagsInFolder(ctx, mailbox, "Work", uid, msgstore.FlagModeAdd, []string{"\\Flagged"}); err != nil {
+		t.Fatalf("SetFlagsInFolder: %v", err)
+	}
+	msgs, err := client.ListInFolder(ctx, mailbox, "Work")
+	if err != nil || len(msgs) != 1 || len(msgs[0].Flags) != 2 {
+		t.Errorf("ListInFolder = %+v, %v; want one message with two flags", msgs, err)
+	}
+	if err := client.DeliverToFolder(ctx, mailbox, "Work", strings.NewReader("Subject: b\r\n\r\n")); err != nil {
+		t.Fatalf("DeliverToFolder: %v", err)
+	}
+	if _, err := client.CopyMessage(ctx, mailbox, "Work", uid, "INBOX"); err != nil {
+		t.Errorf("CopyMessage: %v", err)
+	}
+	if v, err := client.UIDValidity(ctx, mailbox, "Work"); err != nil || v == 0 {
+		t.Errorf("UIDValidity = %d, %v", v, err)
+	}
+	if err := client.RenameFolder(ctx, mailbox, "Work", "Play"); err != nil {
+		t.Fatalf("RenameFolder: %v", err)
+	}
+	if err := client.DeleteFolder(ctx, mailbox, "Play"); !stderrors.Is(err, errors.ErrFolderNotEmpty) {
+		t.Errorf("DeleteFolder non-empty: err = %v, want ErrFolderNotEmpty", err)
+	}
+	if err := client.DeleteFolder(ctx, mailbox, "Play", msgstore.WithForce()); err != nil {
+		t.Fatalf("DeleteFolder: %v", err)
+	}
+	folders, err := client.ListFolders(ctx, mailbox)
+	if err != nil {
+		t.Fatalf("ListFolders: %v", err)
+	}
+	for _, f := range folders {
+		if f == "Play" {
+			t.Errorf("ListFolders still lists Play: %v", folders)
+		}
+	}
+}
+
+// recordingStore records the arguments of folder calls before passing them
+// to the maildir store.
+type recordingStore struct {
+	*maildir.MaildirStore
+	calls []string
+}
+
+func (s *recordingStore) AppendToFolder(ctx context.Context, mailbox, folder string, r io.Reader, flags []string, date time.Time) (string, error) {
+	s.calls = append(s.calls, fmt.Sprintf("APPEND %q %v %d", folder, flags, date.Unix()))
+	return s.MaildirStore.AppendToFolder(ctx, mailbox, folder, r, flags, date)
+}
+
+func (s *recordingStore) DeliverToFolder(ctx context.Context, mailbox, folder string, r io.Reader) error {
+	s.calls = append(s.calls, fmt.Sprintf("PUT %q", folder))
+	return s.MaildirStore.DeliverToFolder(ctx, mailbox, folder, r)
+}
+
+func (s *recordingStore) SetFlagsInFolder(ctx context.Context, mailbox, folder, uid string, mode msgstore.FlagMode, flags []string) error {
+	s.calls = append(s.calls, fmt.Sprintf("FLAGS %q %q %v", folder, uid, flags))
+	return s.MaildirStore.SetFlagsInFolder(ctx, mailbox, folder, uid, mode, flags)
+}
+
+func (s *recordingStore) CopyMessage(ctx context.Context, mailbox, src, uid, dest string) (string, error) {
+	s.calls = append(s.calls, fmt.Sprintf("COPY %q %q %q", src, uid, dest))
+	return s.MaildirStore.CopyMessage(ctx, mailbox, src, uid, dest)
+}
+
+func (s *recordingStore) UIDValidity(ctx context.Context, mailbox, folder string) (uint32, error) {
+	s.calls = append(s.calls, fmt.Sprintf("UIDVALIDITY %q", folder))
+	return s.MaildirStore.UIDValidity(ctx, mailbox, folder)
+}
+
+func TestClient_EmptyFolder(t *testing.T) {
+	store := &recordingStore{MaildirStore: maildir.NewStore(t.TempDir(), "", "")}
+	path := serve(t, session.NewServer(store))
+	client, err := session.Dial(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer func() { _ = client.Close() }()
+	ctx := context.Background()
+	mailbox := "user@example.com"
+
+	// An empty folder must reach the store in its place, without shifting
+	// the arguments after it. Whatever the store makes of it, the answer
+	// must be its own and not a protocol error.
+	date := time.Unix(1700000000, 0)
+	_, err = client.AppendToFolder(ctx, mailbox, "", strings.NewReader("Subject: a\r\n\r\n"), []string{"\\Seen"}, date)
+	errs := []error{err}
+	errs = append(errs, client.DeliverToFolder(ctx, mailbox, "", strings.NewReader("Subject: b\r\n\r\n")))
+	errs = append(errs, client.SetFlagsInFolder(ctx, mailbox, "", "1", msgstore.FlagModeAdd, []string{"\\Flagged"}))
+	_, err = client.CopyMessage(ctx, mailbox, "", "1", "Work")
+	errs = append(errs, err)
+	_, err = client.UIDValidity(ctx, mailbox, "")
+	errs = append(errs, err)
+	for i, err := range errs {
+		if errors.CodeOf(err) == "PROTOCOL" {
+			t.Errorf("call %d: err = %v, want the store's answer", i, err)
+		}
+	}
+	want := []string{
+		`APPEND "" [\Seen] 1700000000`,
+		`PUT ""`,
+		`FLAGS "" "1" [\Flagged]`,
+		`COPY "" "1" "Work"`,
+		`UIDVALIDITY ""`,
+	}
+	if strings.Join(store.calls, "\n") != strings.Join(want, "\n") {
+		t.Errorf("store calls = %q, want %q", store.calls, want)
+	}
+}
+
+func TestOpen_InvalidConfig(t *testing.T) {
+	if _, err := msgstore.Open(msgstore.StoreConfig{Type: "session"}); err != errors.ErrStoreConfigInvalid {
+		t.Errorf("Open without socket or command: err = %v, want ErrStoreConfigInvalid", err)
+	}
+}
+
+func TestClient_AbandonsConnectionAfterCancel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "stall.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	defer func() { _ = l.Close() }()
+
+	// The server sends part of a message and stalls; it then records
+	// whatever else arrives on the connection.
+	sent := make(chan struct{})
+	rest := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			rest <- err.Error()
+			return
+		}
+		defer func() { _ = conn.Close() }()
+		r := bufio.NewReader(conn)
+		for _, reply := range []string{"+OK\n", "+OK\n5\nhello"} {
+			if _, err := r.ReadString('\n'); err != nil {
+				rest <- err.Error()
+				return
+			}
+			_, _ = io.WriteString(conn, reply)
+		}
+		close(sent)
+		data, _ := io.ReadAll(r)
+		rest <- string(data)
+	}()
+
+	client, err := session.Dial(context.Background(), path)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer func() { _ = client.Close() }()
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-sent
+		cancel()
+	}()
+	mailbox := "user@example.com"
+	if _, err := client.Retrieve(ctx, mailbox, "1"); !stderrors.Is(err, context.Canceled) {
+		t.Fatalf("Retrieve: err = %v, want context.Canceled", err)
+	}
+	if _, _, err := client.Stat(context.Background(), mailbox); err == nil {
+		t.Error("Stat after abandoned Retrieve succeeded")
+	}
+	if got := <-rest; got != "" {
+		t.Errorf("server received %q after the abandoned request", got)
+	}
+}
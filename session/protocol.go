@@ -0,0 +1,218 @@
+// Package session implements the mail-session protocol, a line-based
+// protocol over a Unix socket or stdio that gives privilege-separated
+// pop3d/imapd front ends access to a store owned by an unprivileged storage
+// process.
+//
+// A session is a sequence of requests, each answered before the next is
+// read. A request is one line of space-separated words; every word is
+// URL path-escaped so folder names and UIDs may contain spaces, and an
+// empty word (such as the INBOX folder "") is sent as "" so the words after
+// it keep their places. A response line starts with "+OK" or "-ERR":
+//
+//	+OK [word...]
+//	-ERR <code> <message>
+//
+// Commands that return a list answer "+OK <n>" followed by n lines. Message
+// bodies travel as data blocks, each "<length>\n" followed by that many
+// bytes, ending with a zero-length block; commands that upload a message
+// send the blocks right after the request line, and RETR and HEADERS answer
+// "+OK" followed by the blocks.
+//
+// Commands (folder arguments in brackets are optional; without them the
+// command addresses the mailbox root):
+//
+//	MAILBOX <mailbox>                        select the mailbox
+//	LIST [folder]                            one JSON MessageInfo per line
+//	STAT [folder]                            +OK <count> <bytes>
+//	RETR <uid> [folder]                      message data
+//	HEADERS <uid> [folder]                   header section data
+//	DELE <uid> [folder]                      mark for deletion
+//	EXPUNGE [folder]                         one removed UID per line
+//	DELIVER <envelope-json> + data           deliver by envelope
+//	FOLDERS                                  one folder per line
+//	CREATE <folder>
+//	DELFOLDER <folder> [FORCE] [RECURSIVE]
+//	RENAME <old> <new>
+//	PUT <folder> + data                      deliver into a folder
+//	APPEND <folder> <unix-date> [flag...] + data     +OK <uid>
+//	FLAGS <folder> <uid> <SET|ADD|REMOVE> [flag...]
+//	COPY <src-folder> <uid> <dest-folder>    +OK <uid>
+//	UIDVALIDITY <folder>                     +OK <uidvalidity>
+//	QUIT
+//
+// Store errors are reported with a code naming the sentinel error (for
+// example NOT_FOUND_FOLDER), so clients can map them back.
+package session
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/infodancer/msgstore/errors"
+)
+
+const (
+	// maxLineLength bounds a request or response line.
+	maxLineLength = 64 * 1024
+
+	// blockSize is the size of the data blocks written for message bodies.
+	blockSize = 32 * 1024
+)
+
+// codeProtocol is the code of errProtocol.
+const codeProtocol errors.Code = "PROTOCOL"
+
+// errProtocol reports a malformed request or response.
+var errProtocol = errors.New(codeProtocol, "session protocol error")
+
+// errorCode returns the protocol code for err: its errors.Code, or "ERROR"
+// if it has none.
+func errorCode(err error) string {
+	code := errors.CodeOf(err)
+	if code == errors.CodeUnknown {
+		return "ERROR"
+	}
+	return string(code)
+}
+
+// remoteError is an error reported by the peer, unwrapping to the sentinel
+// its code names.
+type remoteError struct {
+	msg string
+	err error
+}
+
+func (e *remoteError) Error() string { return e.msg }
+
+func (e *remoteError) Unwrap() error { return e.err }
+
+// decodeError converts an -ERR code and message into an error.
+func decodeError(code, msg string) error {
+	if errors.Code(code) == codeProtocol {
+		return &remoteError{msg: msg, err: errProtocol}
+	}
+	return &remoteError{msg: msg, err: errors.Sentinel(errors.Code(code))}
+}
+
+// emptyWord encodes the empty word. Path escaping never produces a bare
+// quote, so it cannot be mistaken for an escaped word.
+const emptyWord = `""`
+
+// writeLine writes words as one escaped line.
+func writeLine(w io.Writer, words ...string) error {
+	escaped := make([]string, len(words))
+	for i, word := range words {
+		escaped[i] = url.PathEscape(word)
+		if word == "" {
+			escaped[i] = emptyWord
+		}
+	}
+	_, err := io.WriteString(w, strings.Join(escaped, " ")+"\n")
+	return err
+}
+
+// readLine reads one line and returns its unescaped words.
+func readLine(r *bufio.Reader) ([]string, error) {
+	var line []byte
+	for {
+		chunk, isPrefix, err := r.ReadLine()
+		if err != nil {
+			return nil, err
+		}
+		line = append(line, chunk...)
+		if len(line) > maxLineLength {
+			return nil, fmt.Errorf("%w: line too long", errProtocol)
+		}
+		if !isPrefix {
+			break
+		}
+	}
+	fields := strings.Split(string(line), " ")
+	words := make([]string, 0, len(fields))
+	for _, f := range fields {
+		if f == "" {
+			continue
+		}
+		if f == emptyWord {
+			words = append(words, "")
+			continue
+		}
+		word, err := url.PathUnescape(f)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", errProtocol, err)
+		}
+		words = append(words, word)
+	}
+	return words, nil
+}
+
+// writeData copies r to w as data blocks, ending with the terminating
+// zero-length block.
+func writeData(w io.Writer, r io.Reader) error {
+	buf := make([]byte, blockSize)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			if _, werr := fmt.Fprintf(w, "%d\n", n); werr != nil {
+				return werr
+			}
+			if _, werr := w.Write(buf[:n]); werr != nil {
+				return werr
+			}
+		}
+		if err == io.EOF {
+			_, werr := io.WriteString(w, "0\n")
+			return werr
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// dataReader reads the data blocks of one message.
+type dataReader struct {
+	r      *bufio.Reader
+	remain int
+	done   bool
+}
+
+func (d *dataReader) Read(p []byte) (int, error) {
+	for d.remain == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		words, err := readLine(d.r)
+		if err != nil {
+			return 0, err
+		}
+		if len(words) != 1 {
+			return 0, fmt.Errorf("%w: bad data block", errProtocol)
+		}
+		n, err := strconv.Atoi(words[0])
+		if err != nil || n < 0 || n > maxLineLength {
+			return 0, fmt.Errorf("%w: bad data block length", errProtocol)
+		}
+		d.remain = n
+		d.done = n == 0
+	}
+	if len(p) > d.remain {
+		p = p[:d.remain]
+	}
+	n, err := d.r.Read(p)
+	d.remain -= n
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// drain discards any unread blocks, so the next line can be read.
+func (d *dataReader) drain() error {
+	_, err := io.Copy(io.Discard, d)
+	return err
+}
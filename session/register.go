@@ -0,0 +1,27 @@
+package session
+
+import (
+	"context"
+	"strings"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+func init() {
+	msgstore.RegisterWithSchema("session", func(config msgstore.StoreConfig) (msgstore.MsgStore, error) {
+		// socket is the Unix socket of a running session server
+		if path := config.Options["socket"]; path != "" {
+			return Dial(context.Background(), path)
+		}
+		// command starts a storage process serving the session on stdio,
+		// e.g., "/usr/libexec/mailstore --stdio"
+		if args := strings.Fields(config.Options["command"]); len(args) > 0 {
+			return Start(args[0], args[1:]...)
+		}
+		return nil, errors.ErrStoreConfigInvalid
+	}, msgstore.OptionSchema{
+		{Name: "socket", Description: "Unix socket of a running session server"},
+		{Name: "command", Description: "storage process serving the session on stdio"},
+	})
+}
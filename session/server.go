@@ -0,0 +1,472 @@
+package session
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/errors"
+)
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithMailbox restricts every session to mailbox: MAILBOX selecting any
+// other mailbox is refused and DELIVER, which addresses mailboxes by
+// recipient, is disabled. Use it when one storage process serves one
+// authenticated user.
+func WithMailbox(mailbox string) Option {
+	return func(s *Server) {
+		s.mailbox = mailbox
+	}
+}
+
+// WithLogger sets the logger for session failures. The default is
+// slog.Default().
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// Server serves the session protocol for a store. Folder commands are
+// served when the store implements msgstore.FolderStore.
+type Server struct {
+	store   msgstore.MsgStore
+	folders msgstore.FolderStore
+	mailbox string
+	logger  *slog.Logger
+}
+
+// NewServer creates a Server backed by store.
+func NewServer(store msgstore.MsgStore, opts ...Option) *Server {
+	s := &Server{store: store, logger: slog.Default()}
+	s.folders, _ = store.(msgstore.FolderStore)
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Serve accepts connections on l and serves a session on each until ctx is
+// cancelled, then closes l and waits for open sessions to end.
+func (s *Server) Serve(ctx context.Context, l net.Listener) error {
+	var wg sync.WaitGroup
+	defer wg.Wait()
+
+	stop := context.AfterFunc(ctx, func() { _ = l.Close() })
+	defer stop()
+
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { _ = conn.Close() }()
+			closeOnCancel := context.AfterFunc(ctx, func() { _ = conn.Close() })
+			defer closeOnCancel()
+			if err := s.ServeConn(ctx, conn); err != nil {
+				s.logger.Warn("session ended with error", slog.String("error", err.Error()))
+			}
+		}()
+	}
+}
+
+// ServeConn serves one session on rw until QUIT or end of input. For a
+// subprocess serving its parent over stdio, pass a reader and writer for
+// os.Stdin and os.Stdout.
+func (s *Server) ServeConn(ctx context.Context, rw io.ReadWriter) error {
+	sess := &serverSession{
+		Server:  s,
+		r:       bufio.NewReader(rw),
+		w:       bufio.NewWriter(rw),
+		mailbox: s.mailbox,
+	}
+	for {
+		words, err := readLine(sess.r)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(words) == 0 {
+			continue
+		}
+		quit, err := sess.handle(ctx, strings.ToUpper(words[0]), words[1:])
+		if err != nil {
+			return err
+		}
+		if err := sess.w.Flush(); err != nil {
+			return err
+		}
+		if quit {
+			return nil
+		}
+	}
+}
+
+// serverSession is the state of one session.
+type serverSession struct {
+	*Server
+	r       *bufio.Reader
+	w       *bufio.Writer
+	mailbox string
+}
+
+// handle runs one command. The returned error is a connection failure;
+// store errors are reported to the client.
+func (s *serverSession) handle(ctx context.Context, cmd string, args []string) (quit bool, err error) {
+	switch cmd {
+	case "QUIT":
+		return true, s.ok()
+	case "MAILBOX":
+		if len(args) != 1 {
+			return false, s.fail(errProtocol)
+		}
+		if s.Server.mailbox != "" && args[0] != s.Server.mailbox {
+			return false, s.fail(errors.ErrPermissionDenied)
+		}
+		s.mailbox = args[0]
+		return false, s.ok()
+	case "DELIVER":
+		return false, s.deliver(ctx, args)
+	case "PUT", "APPEND":
+		return false, s.upload(ctx, cmd, args)
+	}
+
+	if s.mailbox == "" {
+		return false, s.fail(fmt.Errorf("%w: no mailbox selected", errProtocol))
+	}
+	switch cmd {
+	case "LIST":
+		return false, s.list(ctx, args)
+	case "STAT":
+		return false, s.stat(ctx, args)
+	case "RETR", "HEADERS":
+		return false, s.retrieve(ctx, cmd == "HEADERS", args)
+	case "DELE":
+		return false, s.dele(ctx, args)
+	case "EXPUNGE":
+		return false, s.expunge(ctx, args)
+	case "FOLDERS", "CREATE", "DELFOLDER", "RENAME", "FLAGS", "COPY", "UIDVALIDITY":
+		if s.folders == nil {
+			return false, s.fail(errors.ErrNotSupported)
+		}
+		return false, s.folderCommand(ctx, cmd, args)
+	}
+	return false, s.fail(fmt.Errorf("%w: unknown command %s", errProtocol, cmd))
+}
+
+func (s *serverSession) ok(words ...string) error {
+	return writeLine(s.w, append([]string{"+OK"}, words...)...)
+}
+
+// fail reports err to the client. Errors without a protocol code are
+// logged, and the client sees only a generic message.
+func (s *serverSession) fail(err error) error {
+	code := errorCode(err)
+	msg := err.Error()
+	if code == "ERROR" {
+		s.logger.Error("session command failed", slog.String("error", msg))
+		msg = "internal error"
+	}
+	return writeLine(s.w, "-ERR", code, msg)
+}
+
+// optionalFolder returns the folder argument at index i, or "".
+func optionalFolder(args []string, i int) string {
+	if len(args) > i {
+		return args[i]
+	}
+	return ""
+}
+
+func (s *serverSession) list(ctx context.Context, args []string) error {
+	var msgs []msgstore.MessageInfo
+	var err error
+	if folder := optionalFolder(args, 0); folder == "" {
+		msgs, err = s.store.List(ctx, s.mailbox)
+	} else if s.folders == nil {
+		err = errors.ErrNotSupported
+	} else {
+		msgs, err = s.folders.ListInFolder(ctx, s.mailbox, folder)
+	}
+	if err != nil {
+		return s.fail(err)
+	}
+	lines := make([]string, len(msgs))
+	for i, m := range msgs {
+		data, err := json.Marshal(m)
+		if err != nil {
+			return s.fail(err)
+		}
+		lines[i] = string(data)
+	}
+	return s.okList(lines)
+}
+
+func (s *serverSession) okList(lines []string) error {
+	if err := s.ok(strconv.Itoa(len(lines))); err != nil {
+		return err
+	}
+	for _, line := range lines {
+		if err := writeLine(s.w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *serverSession) stat(ctx context.Context, args []string) error {
+	var count int
+	var total int64
+	var err error
+	if folder := optionalFolder(args, 0); folder == "" {
+		count, total, err = s.store.Stat(ctx, s.mailbox)
+	} else if s.folders == nil {
+		err = errors.ErrNotSupported
+	} else {
+		count, total, err = s.folders.StatFolder(ctx, s.mailbox, folder)
+	}
+	if err != nil {
+		return s.fail(err)
+	}
+	return s.ok(strconv.Itoa(count), strconv.FormatInt(total, 10))
+}
+
+func (s *serverSession) retrieve(ctx context.Context, headersOnly bool, args []string) error {
+	if len(args) < 1 {
+		return s.fail(errProtocol)
+	}
+	var rc io.ReadCloser
+	var err error
+	if folder := optionalFolder(args, 1); folder == "" {
+		rc, err = s.store.Retrieve(ctx, s.mailbox, args[0])
+	} else if s.folders == nil {
+		err = errors.ErrNotSupported
+	} else {
+		rc, err = s.folders.RetrieveFromFolder(ctx, s.mailbox, folder, args[0])
+	}
+	if err != nil {
+		return s.fail(err)
+	}
+	defer func() { _ = rc.Close() }()
+
+	var body io.Reader = rc
+	if headersOnly {
+		header, err := readHeader(rc)
+		if err != nil {
+			return s.fail(err)
+		}
+		body = bytes.NewReader(header)
+	}
+	if err := s.ok(); err != nil {
+		return err
+	}
+	// A read error midway cannot be reported any more; dropping the
+	// connection makes the client see a truncated message.
+	return writeData(s.w, body)
+}
+
+// readHeader returns the header section of a message, including the blank
+// line that ends it.
+func readHeader(r io.Reader) ([]byte, error) {
+	br := bufio.NewReader(r)
+	var header []byte
+	for {
+		line, err := br.ReadBytes('\n')
+		header = append(header, line...)
+		if err == io.EOF {
+			return header, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(bytes.TrimRight(line, "\r\n")) == 0 {
+			return header, nil
+		}
+	}
+}
+
+func (s *serverSession) dele(ctx context.Context, args []string) error {
+	if len(args) < 1 {
+		return s.fail(errProtocol)
+	}
+	var err error
+	if folder := optionalFolder(args, 1); folder == "" {
+		err = s.store.Delete(ctx, s.mailbox, args[0])
+	} else if s.folders == nil {
+		err = errors.ErrNotSupported
+	} else {
+		err = s.folders.DeleteInFolder(ctx, s.mailbox, folder, args[0])
+	}
+	if err != nil {
+		return s.fail(err)
+	}
+	return s.ok()
+}
+
+func (s *serverSession) expunge(ctx context.Context, args []string) error {
+	var removed []string
+	var err error
+	if folder := optionalFolder(args, 0); folder == "" {
+		removed, err = s.store.Expunge(ctx, s.mailbox)
+	} else if s.folders == nil {
+		err = errors.ErrNotSupported
+	} else {
+		removed, err = s.folders.ExpungeFolder(ctx, s.mailbox, folder)
+	}
+	if err != nil {
+		return s.fail(err)
+	}
+	return s.okList(removed)
+}
+
+// deliver handles DELIVER. The message data is always consumed, even when
+// the command is refused, to keep the session in step.
+func (s *serverSession) deliver(ctx context.Context, args []string) error {
+	body := &dataReader{r: s.r}
+	err := func() error {
+		if len(args) != 1 {
+			return errProtocol
+		}
+		if s.Server.mailbox != "" {
+			return errors.ErrPermissionDenied
+		}
+		envelope, err := msgstore.UnmarshalEnvelope([]byte(args[0]))
+		if err != nil {
+			return err
+		}
+		return s.store.Deliver(ctx, envelope, body)
+	}()
+	if derr := body.drain(); derr != nil {
+		return derr
+	}
+	if err != nil {
+		return s.fail(err)
+	}
+	return s.ok()
+}
+
+// upload handles PUT and APPEND, consuming the message data like deliver.
+func (s *serverSession) upload(ctx context.Context, cmd string, args []string) error {
+	body := &dataReader{r: s.r}
+	var uid string
+	err := func() error {
+		if s.mailbox == "" {
+			return fmt.Errorf("%w: no mailbox selected", errProtocol)
+		}
+		if s.folders == nil {
+			return errors.ErrNotSupported
+		}
+		if cmd == "PUT" {
+			if len(args) != 1 {
+				return errProtocol
+			}
+			return s.folders.DeliverToFolder(ctx, s.mailbox, args[0], body)
+		}
+		if len(args) < 2 {
+			return errProtocol
+		}
+		unix, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("%w: bad date", errProtocol)
+		}
+		var date time.Time
+		if unix != 0 {
+			date = time.Unix(unix, 0)
+		}
+		uid, err = s.folders.AppendToFolder(ctx, s.mailbox, args[0], body, args[2:], date)
+		return err
+	}()
+	if derr := body.drain(); derr != nil {
+		return derr
+	}
+	if err != nil {
+		return s.fail(err)
+	}
+	if cmd == "APPEND" {
+		return s.ok(uid)
+	}
+	return s.ok()
+}
+
+// flagModes maps FLAGS mode words to flag modes.
+var flagModes = map[string]msgstore.FlagMode{
+	"SET":    msgstore.FlagModeSet,
+	"ADD":    msgstore.FlagModeAdd,
+	"REMOVE": msgstore.FlagModeRemove,
+}
+
+func (s *serverSession) folderCommand(ctx context.Context, cmd string, args []string) error {
+	fs := s.folders
+	switch {
+	case cmd == "FOLDERS":
+		folders, err := fs.ListFolders(ctx, s.mailbox)
+		if err != nil {
+			return s.fail(err)
+		}
+		return s.okList(folders)
+	case cmd == "CREATE" && len(args) == 1:
+		return s.result(fs.CreateFolder(ctx, s.mailbox, args[0]))
+	case cmd == "DELFOLDER" && len(args) >= 1:
+		var opts []msgstore.DeleteFolderOption
+		for _, opt := range args[1:] {
+			switch strings.ToUpper(opt) {
+			case "FORCE":
+				opts = append(opts, msgstore.WithForce())
+			case "RECURSIVE":
+				opts = append(opts, msgstore.WithRecursive())
+			default:
+				return s.fail(errProtocol)
+			}
+		}
+		return s.result(fs.DeleteFolder(ctx, s.mailbox, args[0], opts...))
+	case cmd == "RENAME" && len(args) == 2:
+		return s.result(fs.RenameFolder(ctx, s.mailbox, args[0], args[1]))
+	case cmd == "FLAGS" && len(args) >= 3:
+		mode, ok := flagModes[strings.ToUpper(args[2])]
+		if !ok {
+			return s.fail(errProtocol)
+		}
+		return s.result(fs.SetFlagsInFolder(ctx, s.mailbox, args[0], args[1], mode, args[3:]))
+	case cmd == "COPY" && len(args) == 3:
+		uid, err := fs.CopyMessage(ctx, s.mailbox, args[0], args[1], args[2])
+		if err != nil {
+			return s.fail(err)
+		}
+		return s.ok(uid)
+	case cmd == "UIDVALIDITY" && len(args) == 1:
+		v, err := fs.UIDValidity(ctx, s.mailbox, args[0])
+		if err != nil {
+			return s.fail(err)
+		}
+		return s.ok(strconv.FormatUint(uint64(v), 10))
+	}
+	return s.fail(errProtocol)
+}
+
+// result answers +OK, or -ERR for a non-nil err.
+func (s *serverSession) result(err error) error {
+	if err != nil {
+		return s.fail(err)
+	}
+	return s.ok()
+}
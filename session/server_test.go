@@ -0,0 +1,210 @@
+package session
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/infodancer/msgstore"
+	"github.com/infodancer/msgstore/maildir"
+)
+
+// rawSession drives a server session over an in-memory connection.
+type rawSession struct {
+	t *testing.T
+	w net.Conn
+	r *bufio.Reader
+}
+
+func startSession(t *testing.T, srv *Server) *rawSession {
+	t.Helper()
+	client, server := net.Pipe()
+	done := make(chan error, 1)
+	go func() { done <- srv.ServeConn(context.Background(), server) }()
+	t.Cleanup(func() {
+		_ = client.Close()
+		_ = server.Close()
+		<-done
+	})
+	return &rawSession{t: t, w: client, r: bufio.NewReader(client)}
+}
+
+// cmd sends a request line and returns the words of the response line.
+func (s *rawSession) cmd(words ...string) []string {
+	s.t.Helper()
+	if err := writeLine(s.w, words...); err != nil {
+		s.t.Fatalf("write %v: %v", words, err)
+	}
+	return s.response()
+}
+
+// upload sends a request line followed by body as data blocks.
+func (s *rawSession) upload(body string, words ...string) []string {
+	s.t.Helper()
+	go func() {
+		_ = writeLine(s.w, words...)
+		_ = writeData(s.w, strings.NewReader(body))
+	}()
+	return s.response()
+}
+
+func (s *rawSession) response() []string {
+	s.t.Helper()
+	words, err := readLine(s.r)
+	if err != nil {
+		s.t.Fatalf("read response: %v", err)
+	}
+	return words
+}
+
+func (s *rawSession) lines(n string) []string {
+	s.t.Helper()
+	var lines []string
+	count, err := strconv.Atoi(n)
+	if err != nil {
+		s.t.Fatalf("bad count %q", n)
+	}
+	for range count {
+		words := s.response()
+		lines = append(lines, strings.Join(words, " "))
+	}
+	return lines
+}
+
+func TestProtocol_EmptyWords(t *testing.T) {
+	words := []string{"APPEND", "", "1700000000", `""`, "a b", ""}
+	var buf strings.Builder
+	if err := writeLine(&buf, words...); err != nil {
+		t.Fatalf("writeLine: %v", err)
+	}
+	got, err := readLine(bufio.NewReader(strings.NewReader(buf.String())))
+	if err != nil {
+		t.Fatalf("readLine: %v", err)
+	}
+	if strings.Join(got, "|") != strings.Join(words, "|") || len(got) != len(words) {
+		t.Errorf("round trip of %q = %q (wire %q)", words, got, buf.String())
+	}
+}
+
+func TestServer_Session(t *testing.T) {
+	s := startSession(t, NewServer(maildir.NewStore(t.TempDir(), "", "")))
+
+	if got := s.cmd("LIST"); got[0] != "-ERR" || got[1] != "PROTOCOL" {
+		t.Errorf("LIST without mailbox = %v, want -ERR PROTOCOL", got)
+	}
+
+	envelope, err := msgstore.MarshalEnvelope(msgstore.Envelope{From: "a@example.com", Recipients: []string{"user@example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := "Subject: hello\r\nFrom: a@example.com\r\n\r\n" + strings.Repeat("x", 3*blockSize)
+	if got := s.upload(body, "DELIVER", string(envelope)); got[0] != "+OK" {
+		t.Fatalf("DELIVER = %v", got)
+	}
+	if got := s.cmd("MAILBOX", "user@example.com"); got[0] != "+OK" {
+		t.Fatalf("MAILBOX = %v", got)
+	}
+
+	got := s.cmd("LIST")
+	if got[0] != "+OK" || got[1] != "1" {
+		t.Fatalf("LIST = %v, want one message", got)
+	}
+	var info msgstore.MessageInfo
+	if err := json.Unmarshal([]byte(s.lines(got[1])[0]), &info); err != nil {
+		t.Fatalf("decoding LIST line: %v", err)
+	}
+
+	if got := s.cmd("STAT"); got[0] != "+OK" || got[1] != "1" {
+		t.Errorf("STAT = %v", got)
+	}
+
+	if got := s.cmd("HEADERS", info.UID); got[0] != "+OK" {
+		t.Fatalf("HEADERS = %v", got)
+	}
+	header, err := io.ReadAll(&dataReader{r: s.r})
+	if err != nil || !strings.HasSuffix(string(header), "a@example.com\r\n\r\n") || strings.Contains(string(header), "xxx") {
+		t.Errorf("HEADERS data = %q, %v", header, err)
+	}
+
+	if got := s.cmd("RETR", info.UID); got[0] != "+OK" {
+		t.Fatalf("RETR = %v", got)
+	}
+	msg, err := io.ReadAll(&dataReader{r: s.r})
+	if err != nil || !strings.Contains(string(msg), body) {
+		t.Errorf("RETR returned %d bytes, %v", len(msg), err)
+	}
+
+	if got := s.cmd("DELE", info.UID); got[0] != "+OK" {
+		t.Errorf("DELE = %v", got)
+	}
+	if got := s.cmd("EXPUNGE"); got[0] != "+OK" || got[1] != "1" || s.lines(got[1])[0] != info.UID {
+		t.Errorf("EXPUNGE = %v", got)
+	}
+	if got := s.cmd("QUIT"); got[0] != "+OK" {
+		t.Errorf("QUIT = %v", got)
+	}
+}
+
+func TestServer_Folders(t *testing.T) {
+	s := startSession(t, NewServer(maildir.NewStore(t.TempDir(), "", ""), WithMailbox("user@example.com")))
+
+	if got := s.cmd("MAILBOX", "other@example.com"); got[0] != "-ERR" || got[1] != "PERMISSION_DENIED" {
+		t.Errorf("MAILBOX other = %v, want PERMISSION_DENIED", got)
+	}
+	if got := s.upload("Subject: x\r\n\r\n", "DELIVER", "{}"); got[0] != "-ERR" || got[1] != "PERMISSION_DENIED" {
+		t.Errorf("DELIVER with fixed mailbox = %v, want PERMISSION_DENIED", got)
+	}
+
+	if got := s.cmd("CREATE", "Work"); got[0] != "+OK" {
+		t.Fatalf("CREATE = %v", got)
+	}
+	if got := s.cmd("CREATE", "Work"); got[0] != "-ERR" || got[1] != "FOLDER_EXISTS" {
+		t.Errorf("CREATE twice = %v", got)
+	}
+	got := s.upload("Subject: appended\r\n\r\n", "APPEND", "Work", "1700000000", "\\Seen")
+	if got[0] != "+OK" || len(got) != 2 {
+		t.Fatalf("APPEND = %v", got)
+	}
+	uid := got[1]
+	if got := s.cmd("FLAGS", "Work", uid, "ADD", "\\Flagged"); got[0] != "+OK" {
+		t.Errorf("FLAGS = %v", got)
+	}
+	if got := s.upload("Subject: put\r\n\r\n", "PUT", "Work"); got[0] != "+OK" {
+		t.Errorf("PUT = %v", got)
+	}
+	if got := s.cmd("STAT", "Work"); got[0] != "+OK" || got[1] != "2" {
+		t.Errorf("STAT folder = %v", got)
+	}
+	if got := s.cmd("COPY", "Work", uid, "INBOX"); got[0] != "+OK" || len(got) != 2 {
+		t.Errorf("COPY = %v", got)
+	}
+	if got := s.cmd("UIDVALIDITY", "Work"); got[0] != "+OK" || got[1] == "0" {
+		t.Errorf("UIDVALIDITY = %v", got)
+	}
+	if got := s.cmd("DELFOLDER", "Work"); got[0] != "-ERR" || got[1] != "FOLDER_NOT_EMPTY" {
+		t.Errorf("DELFOLDER non-empty = %v", got)
+	}
+	if got := s.cmd("RENAME", "Work", "Play"); got[0] != "+OK" {
+		t.Errorf("RENAME = %v", got)
+	}
+	if got := s.cmd("DELFOLDER", "Play", "FORCE"); got[0] != "+OK" {
+		t.Errorf("DELFOLDER FORCE = %v", got)
+	}
+	got = s.cmd("FOLDERS")
+	if got[0] != "+OK" {
+		t.Fatalf("FOLDERS = %v", got)
+	}
+	for _, f := range s.lines(got[1]) {
+		if f == "Play" {
+			t.Errorf("FOLDERS still lists %s", f)
+		}
+	}
+	if got := s.cmd("BOGUS"); got[0] != "-ERR" || got[1] != "PROTOCOL" {
+		t.Errorf("BOGUS = %v", got)
+	}
+}
@@ -0,0 +1,45 @@
+package msgstore
+
+import "context"
+
+// SieveStore manages the Sieve scripts stored for a mailbox.
+// It models the script repository of the ManageSieve protocol (RFC 5804):
+// a mailbox holds any number of named scripts, at most one of which is
+// active and evaluated at delivery time.
+// Consumers that need script management should type-assert to SieveStore.
+type SieveStore interface {
+	// ListScripts returns all scripts stored for a mailbox, sorted by name.
+	ListScripts(ctx context.Context, mailbox string) ([]SieveScriptInfo, error)
+
+	// GetScript returns the source of a named script.
+	// Returns ErrScriptNotFound if the script does not exist.
+	GetScript(ctx context.Context, mailbox string, name string) ([]byte, error)
+
+	// PutScript stores a script under the given name, replacing any existing
+	// script with that name. The script is validated with CheckScript first
+	// and is not stored if it is invalid.
+	PutScript(ctx context.Context, mailbox string, name string, script []byte) error
+
+	// SetActive makes the named script the active script for the mailbox.
+	// An empty name deactivates all scripts.
+	// Returns ErrScriptNotFound if the script does not exist.
+	SetActive(ctx context.Context, mailbox string, name string) error
+
+	// DeleteScript removes a named script.
+	// Returns ErrScriptActive if the script is currently active and
+	// ErrScriptNotFound if it does not exist.
+	DeleteScript(ctx context.Context, mailbox string, name string) error
+
+	// CheckScript validates a script without storing it.
+	// Returns an error wrapping ErrInvalidScript if the script does not parse.
+	CheckScript(ctx context.Context, script []byte) error
+}
+
+// SieveScriptInfo describes a stored Sieve script.
+type SieveScriptInfo struct {
+	// Name is the script name as used by ManageSieve.
+	Name string
+
+	// Active reports whether this is the script evaluated at delivery time.
+	Active bool
+}
@@ -0,0 +1,872 @@
+package msgstore
+
+import (
+	"bytes"
+	stderrors "errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/mail"
+	"net/textproto"
+	"strings"
+
+	gosieve "git.sr.ht/~emersion/go-sieve"
+	"github.com/infodancer/msgstore/errors"
+)
+
+// SieveActionType identifies the kind of action produced by Sieve evaluation.
+type SieveActionType string
+
+// Sieve action types.
+const (
+	// SieveKeep stores the message in the inbox.
+	SieveKeep SieveActionType = "keep"
+
+	// SieveFileInto stores the message in the folder named by Mailbox.
+	SieveFileInto SieveActionType = "fileinto"
+
+	// SieveRedirect forwards the message to Address.
+	SieveRedirect SieveActionType = "redirect"
+
+	// SieveDiscard silently drops the message.
+	SieveDiscard SieveActionType = "discard"
+
+	// SieveReject refuses the message with Reason (RFC 5429 reject/ereject).
+	SieveReject SieveActionType = "reject"
+)
+
+// SieveAction is a single action that a Sieve script takes for a message.
+type SieveAction struct {
+	// Type is the kind of action.
+	Type SieveActionType
+
+	// Mailbox is the target folder for SieveFileInto.
+	Mailbox string
+
+	// Address is the target address for SieveRedirect.
+	Address string
+
+	// Reason is the refusal text for SieveReject.
+	Reason string
+
+	// Flags are the IMAP flags to set on the stored message (RFC 5232).
+	// Only meaningful for SieveKeep and SieveFileInto.
+	Flags []string
+
+	// Implicit reports that the action was not requested by the script but
+	// results from the implicit keep (RFC 5228 section 2.10.2).
+	Implicit bool
+
+	// System reports that the action was taken by the system-wide script
+	// rather than the user's script.
+	System bool
+}
+
+// sieveExtensions lists the extensions understood by the evaluator.
+var sieveExtensions = map[string]bool{
+	"fileinto":                   true,
+	"reject":                     true,
+	"ereject":                    true,
+	"envelope":                   true,
+	"copy":                       true,
+	"imap4flags":                 true,
+	"subaddress":                 true,
+	"include":                    true,
+	"comparator-i;octet":         true,
+	"comparator-i;ascii-casemap": true,
+}
+
+// maxSieveIncludeDepth bounds nesting of include commands.
+const maxSieveIncludeDepth = 10
+
+// errSieveStop unwinds evaluation when the script executes "stop".
+var errSieveStop = stderrors.New("sieve: stop")
+
+// errSieveReturn unwinds an included script when it executes "return".
+var errSieveReturn = stderrors.New("sieve: return")
+
+// SieveIncludeFunc loads the source of a script named by an include
+// command (RFC 6609). global is true for include :global and false for
+// include :personal. It returns ErrScriptNotFound if no such script exists.
+type SieveIncludeFunc func(name string, global bool) ([]byte, error)
+
+// SieveEvaluator evaluates Sieve scripts. The zero value evaluates scripts
+// without include support.
+type SieveEvaluator struct {
+	// Include resolves include commands. If nil, scripts using include fail.
+	Include SieveIncludeFunc
+
+	// SystemScript is an administrator-controlled script evaluated before
+	// the user's script. Its actions are marked with SieveAction.System, and
+	// if it executes "stop" the user's script is not evaluated.
+	SystemScript []byte
+}
+
+// EvaluateSieve runs script against a message and returns the actions it
+// would take, without performing any of them. Every address in
+// envelope.Recipients is a candidate value for envelope "to" tests.
+//
+// Supported are the RFC 5228 base language and the fileinto, envelope,
+// reject/ereject, copy, imap4flags, subaddress and include extensions.
+// Returns an error wrapping ErrInvalidScript if the script does not parse or
+// uses an unsupported command, test or extension.
+func EvaluateSieve(script []byte, envelope Envelope, message io.Reader) ([]SieveAction, error) {
+	return SieveEvaluator{}.Evaluate(script, envelope, message)
+}
+
+// Evaluate is like EvaluateSieve, additionally resolving include commands
+// through e.Include and evaluating e.SystemScript first.
+func (e SieveEvaluator) Evaluate(script []byte, envelope Envelope, message io.Reader) ([]SieveAction, error) {
+	var systemCmds []gosieve.Command
+	if e.SystemScript != nil {
+		var err error
+		systemCmds, err = gosieve.Parse(bytes.NewReader(e.SystemScript))
+		if err != nil {
+			return nil, fmt.Errorf("%w: system script: %w", errors.ErrInvalidScript, err)
+		}
+	}
+	cmds, err := gosieve.Parse(bytes.NewReader(script))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errors.ErrInvalidScript, err)
+	}
+
+	data, err := io.ReadAll(message)
+	if err != nil {
+		return nil, fmt.Errorf("read message: %w", err)
+	}
+
+	ev := newSieveEvaluator(envelope, data)
+	ev.include = e.Include
+	if systemCmds != nil {
+		ev.system = true
+		err := ev.block(systemCmds)
+		ev.system = false
+		if err == errSieveStop {
+			return ev.result(), nil
+		}
+		if err != nil && err != errSieveReturn {
+			return nil, fmt.Errorf("system script: %w", err)
+		}
+		ev.required = make(map[string]bool)
+	}
+	if err := ev.run(cmds); err != nil {
+		return nil, err
+	}
+	return ev.result(), nil
+}
+
+// sieveEvaluator holds the state of a single script evaluation.
+type sieveEvaluator struct {
+	envelope Envelope
+	header   mail.Header
+	size     int64
+
+	required map[string]bool
+	actions  []SieveAction
+	// cancelKeep is set once an action cancels the implicit keep.
+	cancelKeep bool
+	// flags is the imap4flags internal variable.
+	flags []string
+
+	include SieveIncludeFunc
+	// including holds the scripts on the current include chain, for loop detection.
+	including map[string]bool
+	// included holds every script included so far, for include :once.
+	included map[string]bool
+	// system is set while the system-wide script is being evaluated.
+	system bool
+}
+
+// newSieveEvaluator prepares an evaluator for a raw RFC 5322 message.
+// A message whose header cannot be parsed is evaluated with no headers.
+func newSieveEvaluator(envelope Envelope, data []byte) *sieveEvaluator {
+	header := mail.Header{}
+	if msg, err := mail.ReadMessage(bytes.NewReader(data)); err == nil {
+		header = msg.Header
+	}
+	return &sieveEvaluator{
+		envelope:  envelope,
+		header:    header,
+		size:      int64(len(data)),
+		required:  make(map[string]bool),
+		including: make(map[string]bool),
+		included:  make(map[string]bool),
+	}
+}
+
+// run executes a top-level command list, treating "stop" and "return" as
+// normal completion.
+func (ev *sieveEvaluator) run(cmds []gosieve.Command) error {
+	if err := ev.block(cmds); err != nil && err != errSieveStop && err != errSieveReturn {
+		return err
+	}
+	return nil
+}
+
+// result returns the collected actions, adding the implicit keep if no
+// action cancelled it.
+func (ev *sieveEvaluator) result() []SieveAction {
+	actions := ev.actions
+	if !ev.cancelKeep {
+		actions = append(actions, SieveAction{Type: SieveKeep, Flags: ev.flags, Implicit: true})
+	}
+	return actions
+}
+
+// addAction records an action, collapsing exact duplicates as RFC 5228
+// section 2.10.3 recommends.
+func (ev *sieveEvaluator) addAction(action SieveAction) {
+	for _, a := range ev.actions {
+		if a.Type == action.Type && a.Mailbox == action.Mailbox && a.Address == action.Address {
+			return
+		}
+	}
+	action.System = ev.system
+	ev.actions = append(ev.actions, action)
+}
+
+// sieveError returns an error wrapping ErrInvalidScript.
+func sieveError(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", errors.ErrInvalidScript, fmt.Sprintf(format, args...))
+}
+
+// block executes a list of commands, handling if/elsif/else chains.
+func (ev *sieveEvaluator) block(cmds []gosieve.Command) error {
+	// branchTaken is true once a branch of the current if-chain has run.
+	branchTaken := false
+	inChain := false
+
+	for _, cmd := range cmds {
+		name := strings.ToLower(cmd.Name)
+		switch name {
+		case "if", "elsif", "else":
+			if name != "if" && !inChain {
+				return sieveError("%s without preceding if", name)
+			}
+			if name == "if" {
+				branchTaken = false
+			}
+			inChain = name != "else"
+			if branchTaken {
+				continue
+			}
+			matched := true
+			if name != "else" {
+				if len(cmd.Tests) != 1 {
+					return sieveError("%s requires exactly one test", name)
+				}
+				var err error
+				if matched, err = ev.test(cmd.Tests[0]); err != nil {
+					return err
+				}
+			}
+			if matched {
+				branchTaken = true
+				if err := ev.block(cmd.Block); err != nil {
+					return err
+				}
+			}
+		default:
+			inChain = false
+			if err := ev.command(name, cmd); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// requireExtension returns an error unless ext was declared with require.
+func (ev *sieveEvaluator) requireExtension(ext, usedBy string) error {
+	if !ev.required[ext] {
+		return sieveError("%s used without require %q", usedBy, ext)
+	}
+	return nil
+}
+
+// command executes a single non-control command.
+func (ev *sieveEvaluator) command(name string, cmd gosieve.Command) error {
+	if name == "include" {
+		return ev.includeScript(cmd)
+	}
+
+	args, err := parseSieveArgs(cmd.Arguments, map[string]bool{":flags": true})
+	if err != nil {
+		return err
+	}
+
+	switch name {
+	case "require":
+		exts, err := args.stringList(0)
+		if err != nil {
+			return err
+		}
+		for _, ext := range exts {
+			if !sieveExtensions[ext] {
+				return sieveError("unsupported extension %q", ext)
+			}
+			ev.required[ext] = true
+		}
+	case "stop":
+		return errSieveStop
+	case "return":
+		if err := ev.requireExtension("include", name); err != nil {
+			return err
+		}
+		return errSieveReturn
+	case "keep":
+		flags, err := ev.actionFlags(args)
+		if err != nil {
+			return err
+		}
+		ev.cancelKeep = true
+		ev.addAction(SieveAction{Type: SieveKeep, Flags: flags})
+	case "discard":
+		ev.cancelKeep = true
+		ev.addAction(SieveAction{Type: SieveDiscard})
+	case "fileinto":
+		if err := ev.requireExtension("fileinto", name); err != nil {
+			return err
+		}
+		folder, err := args.string(0)
+		if err != nil {
+			return err
+		}
+		flags, err := ev.actionFlags(args)
+		if err != nil {
+			return err
+		}
+		if err := ev.applyCopy(args, name); err != nil {
+			return err
+		}
+		ev.addAction(SieveAction{Type: SieveFileInto, Mailbox: folder, Flags: flags})
+	case "redirect":
+		addr, err := args.string(0)
+		if err != nil {
+			return err
+		}
+		// RFC 5228 section 4.2: an address that is not valid syntax is
+		// a run-time error.
+		if checkForwardAddress(addr) != nil {
+			return sieveError("redirect to invalid address %q", addr)
+		}
+		if err := ev.applyCopy(args, name); err != nil {
+			return err
+		}
+		ev.addAction(SieveAction{Type: SieveRedirect, Address: addr})
+	case "reject", "ereject":
+		if err := ev.requireExtension(name, name); err != nil {
+			return err
+		}
+		reason, err := args.string(0)
+		if err != nil {
+			return err
+		}
+		ev.cancelKeep = true
+		ev.addAction(SieveAction{Type: SieveReject, Reason: reason})
+	case "setflag", "addflag", "removeflag":
+		if err := ev.requireExtension("imap4flags", name); err != nil {
+			return err
+		}
+		flags, err := args.stringList(0)
+		if err != nil {
+			return err
+		}
+		ev.flags = applyFlagCommand(name, ev.flags, flags)
+	default:
+		return sieveError("unsupported command %q", name)
+	}
+	return nil
+}
+
+// includeScript executes an include command (RFC 6609). The included script
+// runs with its own require declarations but shares the action list and
+// implicit keep with the including script.
+func (ev *sieveEvaluator) includeScript(cmd gosieve.Command) error {
+	if err := ev.requireExtension("include", "include"); err != nil {
+		return err
+	}
+	args, err := parseSieveArgs(cmd.Arguments, nil)
+	if err != nil {
+		return err
+	}
+	name, err := args.string(0)
+	if err != nil {
+		return err
+	}
+	_, global := args.tags[":global"]
+	_, once := args.tags[":once"]
+	_, optional := args.tags[":optional"]
+
+	if ev.include == nil {
+		return sieveError("include is not available")
+	}
+	key := "personal/" + name
+	if global {
+		key = "global/" + name
+	}
+	if ev.including[key] {
+		return sieveError("include loop on %q", name)
+	}
+	if len(ev.including) >= maxSieveIncludeDepth {
+		return sieveError("include nesting exceeds %d levels", maxSieveIncludeDepth)
+	}
+	if once && ev.included[key] {
+		return nil
+	}
+
+	src, err := ev.include(name, global)
+	if stderrors.Is(err, errors.ErrScriptNotFound) && optional {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("include %q: %w", name, err)
+	}
+	cmds, err := gosieve.Parse(bytes.NewReader(src))
+	if err != nil {
+		return fmt.Errorf("%w: include %q: %w", errors.ErrInvalidScript, name, err)
+	}
+
+	savedRequired := ev.required
+	ev.required = make(map[string]bool)
+	ev.including[key] = true
+	ev.included[key] = true
+	err = ev.block(cmds)
+	delete(ev.including, key)
+	ev.required = savedRequired
+
+	if err == errSieveReturn {
+		return nil
+	}
+	return err
+}
+
+// applyCopy cancels the implicit keep unless the :copy tag (RFC 3894) is present.
+func (ev *sieveEvaluator) applyCopy(args sieveArgs, usedBy string) error {
+	if _, ok := args.tags[":copy"]; ok {
+		return ev.requireExtension("copy", usedBy)
+	}
+	ev.cancelKeep = true
+	return nil
+}
+
+// actionFlags returns the flags for a keep or fileinto: the :flags argument
+// when given, otherwise the current value of the internal flags variable.
+func (ev *sieveEvaluator) actionFlags(args sieveArgs) ([]string, error) {
+	value, ok := args.tags[":flags"]
+	if !ok {
+		return ev.flags, nil
+	}
+	if err := ev.requireExtension("imap4flags", ":flags"); err != nil {
+		return nil, err
+	}
+	list, ok := value.(gosieve.ArgumentStringList)
+	if !ok {
+		return nil, sieveError(":flags requires a string list")
+	}
+	return applyFlagCommand("setflag", nil, list), nil
+}
+
+// applyFlagCommand applies an imap4flags setflag/addflag/removeflag to current.
+// Flag lists may contain space-separated flags; duplicates are removed
+// case-insensitively.
+func applyFlagCommand(name string, current []string, args []string) []string {
+	var given []string
+	for _, arg := range args {
+		given = append(given, strings.Fields(arg)...)
+	}
+
+	var result []string
+	switch name {
+	case "setflag":
+		result = nil
+	default:
+		result = append(result, current...)
+	}
+	for _, f := range given {
+		idx := -1
+		for i, existing := range result {
+			if strings.EqualFold(existing, f) {
+				idx = i
+				break
+			}
+		}
+		switch {
+		case name == "removeflag" && idx >= 0:
+			result = append(result[:idx], result[idx+1:]...)
+		case name != "removeflag" && idx < 0:
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// test evaluates a Sieve test.
+func (ev *sieveEvaluator) test(t gosieve.Test) (bool, error) {
+	name := strings.ToLower(t.Name)
+	switch name {
+	case "true":
+		return true, nil
+	case "false":
+		return false, nil
+	case "not":
+		if len(t.Tests) != 1 {
+			return false, sieveError("not requires exactly one test")
+		}
+		result, err := ev.test(t.Tests[0])
+		return !result, err
+	case "allof", "anyof":
+		for _, sub := range t.Tests {
+			result, err := ev.test(sub)
+			if err != nil {
+				return false, err
+			}
+			if name == "anyof" && result {
+				return true, nil
+			}
+			if name == "allof" && !result {
+				return false, nil
+			}
+		}
+		return name == "allof", nil
+	case "exists":
+		args, err := parseSieveArgs(t.Arguments, nil)
+		if err != nil {
+			return false, err
+		}
+		names, err := args.stringList(0)
+		if err != nil {
+			return false, err
+		}
+		for _, h := range names {
+			if len(ev.header[textproto.CanonicalMIMEHeaderKey(h)]) == 0 {
+				return false, nil
+			}
+		}
+		return true, nil
+	case "size":
+		return ev.sizeTest(t)
+	case "header", "address", "envelope":
+		if name == "envelope" {
+			if err := ev.requireExtension("envelope", name); err != nil {
+				return false, err
+			}
+		}
+		return ev.matchTest(name, t)
+	default:
+		return false, sieveError("unsupported test %q", name)
+	}
+}
+
+// sizeTest evaluates "size :over N" and "size :under N".
+func (ev *sieveEvaluator) sizeTest(t gosieve.Test) (bool, error) {
+	args, err := parseSieveArgs(t.Arguments, nil)
+	if err != nil {
+		return false, err
+	}
+	if len(args.positional) != 1 {
+		return false, sieveError("size requires a number")
+	}
+	num, ok := args.positional[0].(gosieve.ArgumentNumber)
+	if !ok {
+		return false, sieveError("size requires a number")
+	}
+	limit := int64(num.Value)
+	switch num.Quantifier {
+	case 'K', 'k':
+		limit <<= 10
+	case 'M', 'm':
+		limit <<= 20
+	case 'G', 'g':
+		limit <<= 30
+	}
+	_, over := args.tags[":over"]
+	_, under := args.tags[":under"]
+	switch {
+	case over && !under:
+		return ev.size > limit, nil
+	case under && !over:
+		return ev.size < limit, nil
+	default:
+		return false, sieveError("size requires exactly one of :over or :under")
+	}
+}
+
+// matchTest evaluates the header, address and envelope tests.
+func (ev *sieveEvaluator) matchTest(name string, t gosieve.Test) (bool, error) {
+	args, err := parseSieveArgs(t.Arguments, map[string]bool{":comparator": true})
+	if err != nil {
+		return false, err
+	}
+	fields, err := args.stringList(0)
+	if err != nil {
+		return false, err
+	}
+	keys, err := args.stringList(1)
+	if err != nil {
+		return false, err
+	}
+	matcher, err := ev.newMatcher(args)
+	if err != nil {
+		return false, err
+	}
+
+	var values []string
+	switch name {
+	case "header":
+		for _, field := range fields {
+			for _, raw := range ev.header[textproto.CanonicalMIMEHeaderKey(field)] {
+				values = append(values, decodeHeaderValue(raw))
+			}
+		}
+	case "address":
+		for _, field := range fields {
+			for _, raw := range ev.header[textproto.CanonicalMIMEHeaderKey(field)] {
+				values = append(values, headerAddresses(raw)...)
+			}
+		}
+	case "envelope":
+		for _, field := range fields {
+			switch strings.ToLower(field) {
+			case "from":
+				values = append(values, ev.envelope.From)
+			case "to":
+				values = append(values, ev.envelope.Recipients...)
+			case "auth":
+				if ev.envelope.AuthenticatedSender != "" {
+					values = append(values, ev.envelope.AuthenticatedSender)
+				}
+			}
+		}
+	}
+
+	if name != "header" {
+		part, err := ev.addressPart(args)
+		if err != nil {
+			return false, err
+		}
+		for i, v := range values {
+			values[i] = extractAddressPart(v, part)
+		}
+	}
+
+	for _, v := range values {
+		for _, key := range keys {
+			if matcher(v, key) {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// newMatcher builds the comparison function selected by the match-type
+// and :comparator tags of a test.
+func (ev *sieveEvaluator) newMatcher(args sieveArgs) (func(value, key string) bool, error) {
+	fold := true
+	if value, ok := args.tags[":comparator"]; ok {
+		list, ok := value.(gosieve.ArgumentStringList)
+		if !ok || len(list) != 1 {
+			return nil, sieveError(":comparator requires a string")
+		}
+		switch list[0] {
+		case "i;ascii-casemap":
+		case "i;octet":
+			fold = false
+		default:
+			return nil, sieveError("unsupported comparator %q", list[0])
+		}
+	}
+
+	normalize := func(s string) string {
+		if fold {
+			return asciiLower(s)
+		}
+		return s
+	}
+
+	_, contains := args.tags[":contains"]
+	_, matches := args.tags[":matches"]
+	switch {
+	case contains:
+		return func(v, k string) bool { return strings.Contains(normalize(v), normalize(k)) }, nil
+	case matches:
+		return func(v, k string) bool { return sieveWildcardMatch(normalize(v), normalize(k)) }, nil
+	default:
+		return func(v, k string) bool { return normalize(v) == normalize(k) }, nil
+	}
+}
+
+// addressPart returns the address-part tag of an address or envelope test.
+func (ev *sieveEvaluator) addressPart(args sieveArgs) (string, error) {
+	for _, part := range []string{":localpart", ":domain", ":user", ":detail"} {
+		if _, ok := args.tags[part]; ok {
+			if part == ":user" || part == ":detail" {
+				if err := ev.requireExtension("subaddress", part); err != nil {
+					return "", err
+				}
+			}
+			return part, nil
+		}
+	}
+	return ":all", nil
+}
+
+// extractAddressPart returns the requested part of an address.
+func extractAddressPart(addr, part string) string {
+	localpart, domain := addr, ""
+	if idx := strings.LastIndex(addr, "@"); idx >= 0 {
+		localpart, domain = addr[:idx], addr[idx+1:]
+	}
+	user, detail, _ := strings.Cut(localpart, "+")
+	switch part {
+	case ":localpart":
+		return localpart
+	case ":domain":
+		return domain
+	case ":user":
+		return user
+	case ":detail":
+		return detail
+	default:
+		return addr
+	}
+}
+
+// headerAddresses extracts the bare addresses from an address header value.
+// If the value does not parse as an address list it is returned unchanged.
+func headerAddresses(raw string) []string {
+	list, err := mail.ParseAddressList(raw)
+	if err != nil {
+		return []string{strings.TrimSpace(raw)}
+	}
+	addrs := make([]string, 0, len(list))
+	for _, a := range list {
+		addrs = append(addrs, a.Address)
+	}
+	return addrs
+}
+
+// decodeHeaderValue decodes RFC 2047 encoded-words, returning raw on failure.
+func decodeHeaderValue(raw string) string {
+	decoded, err := new(mime.WordDecoder).DecodeHeader(raw)
+	if err != nil {
+		return raw
+	}
+	return decoded
+}
+
+// asciiLower lower-cases ASCII letters only, as the i;ascii-casemap comparator requires.
+func asciiLower(s string) string {
+	b := []byte(s)
+	for i, c := range b {
+		if c >= 'A' && c <= 'Z' {
+			b[i] = c + ('a' - 'A')
+		}
+	}
+	return string(b)
+}
+
+// sieveWildcardMatch reports whether value matches a :matches pattern,
+// where "*" matches any sequence, "?" matches one character and a
+// backslash escapes the following character.
+func sieveWildcardMatch(value, pattern string) bool {
+	v := []rune(value)
+	p := []rune(pattern)
+	var match func(vi, pi int) bool
+	match = func(vi, pi int) bool {
+		for pi < len(p) {
+			switch p[pi] {
+			case '*':
+				for pi < len(p) && p[pi] == '*' {
+					pi++
+				}
+				if pi == len(p) {
+					return true
+				}
+				for i := vi; i <= len(v); i++ {
+					if match(i, pi) {
+						return true
+					}
+				}
+				return false
+			case '?':
+				if vi >= len(v) {
+					return false
+				}
+			case '\\':
+				if pi+1 < len(p) {
+					pi++
+				}
+				fallthrough
+			default:
+				if vi >= len(v) || v[vi] != p[pi] {
+					return false
+				}
+			}
+			vi++
+			pi++
+		}
+		return vi == len(v)
+	}
+	return match(0, 0)
+}
+
+// sieveArgs is a command or test argument list split into tagged and
+// positional arguments.
+type sieveArgs struct {
+	// tags maps each tag to its value argument, or nil for flag-like tags.
+	tags       map[string]gosieve.Argument
+	positional []gosieve.Argument
+}
+
+// parseSieveArgs splits arguments into tags and positional arguments.
+// Tags listed in valued consume the following argument as their value.
+func parseSieveArgs(args []gosieve.Argument, valued map[string]bool) (sieveArgs, error) {
+	result := sieveArgs{tags: make(map[string]gosieve.Argument)}
+	for i := 0; i < len(args); i++ {
+		tag, ok := args[i].(gosieve.ArgumentTag)
+		if !ok {
+			result.positional = append(result.positional, args[i])
+			continue
+		}
+		name := strings.ToLower(string(tag))
+		if !strings.HasPrefix(name, ":") {
+			name = ":" + name
+		}
+		var value gosieve.Argument
+		if valued[name] {
+			if i+1 >= len(args) {
+				return result, sieveError("%s requires an argument", name)
+			}
+			i++
+			value = args[i]
+		}
+		result.tags[name] = value
+	}
+	return result, nil
+}
+
+// stringList returns positional argument i as a string list.
+func (a sieveArgs) stringList(i int) ([]string, error) {
+	if i >= len(a.positional) {
+		return nil, sieveError("missing argument %d", i+1)
+	}
+	list, ok := a.positional[i].(gosieve.ArgumentStringList)
+	if !ok {
+		return nil, sieveError("argument %d must be a string", i+1)
+	}
+	return list, nil
+}
+
+// string returns positional argument i as a single string.
+func (a sieveArgs) string(i int) (string, error) {
+	list, err := a.stringList(i)
+	if err != nil {
+		return "", err
+	}
+	if len(list) != 1 {
+		return "", sieveError("argument %d must be a single string", i+1)
+	}
+	return list[0], nil
+}
@@ -0,0 +1,252 @@
+package msgstore
+
+import (
+	stderrors "errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/infodancer/msgstore/errors"
+)
+
+const sieveTestMessage = "From: Alice <alice@example.com>\r\n" +
+	"To: bob+lists@example.org\r\n" +
+	"Subject: =?UTF-8?Q?Invoice_n=C2=B0_42?=\r\n" +
+	"List-Id: <golang-nuts.googlegroups.com>\r\n" +
+	"\r\n" +
+	"Please pay.\r\n"
+
+func evaluateTestScript(t *testing.T, script string) []SieveAction {
+	t.Helper()
+	envelope := Envelope{
+		From:       "bounce@lists.example.com",
+		Recipients: []string{"bob+lists@example.org"},
+	}
+	actions, err := EvaluateSieve([]byte(script), envelope, strings.NewReader(sieveTestMessage))
+	if err != nil {
+		t.Fatalf("EvaluateSieve failed: %v", err)
+	}
+	return actions
+}
+
+func TestEvaluateSieve_ImplicitKeep(t *testing.T) {
+	actions := evaluateTestScript(t, `if header :is "Subject" "nope" { discard; }`)
+	want := []SieveAction{{Type: SieveKeep, Implicit: true}}
+	if !reflect.DeepEqual(actions, want) {
+		t.Errorf("actions = %+v, want %+v", actions, want)
+	}
+}
+
+func TestEvaluateSieve_Actions(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []SieveAction
+	}{
+		{
+			name:   "fileinto on decoded header",
+			script: `require "fileinto"; if header :contains "subject" "invoice n°" { fileinto "Bills"; }`,
+			want:   []SieveAction{{Type: SieveFileInto, Mailbox: "Bills"}},
+		},
+		{
+			name:   "exists and elsif",
+			script: `require "fileinto"; if exists "X-Spam" { discard; } elsif exists "List-Id" { fileinto "List"; } else { keep; }`,
+			want:   []SieveAction{{Type: SieveFileInto, Mailbox: "List"}},
+		},
+		{
+			name:   "address domain match",
+			script: `if address :domain "from" "example.com" { redirect "archive@example.net"; }`,
+			want:   []SieveAction{{Type: SieveRedirect, Address: "archive@example.net"}},
+		},
+		{
+			name:   "envelope detail with copy keeps implicit keep",
+			script: `require ["envelope", "subaddress", "copy", "fileinto"]; if envelope :detail "to" "lists" { fileinto :copy "List"; }`,
+			want: []SieveAction{
+				{Type: SieveFileInto, Mailbox: "List"},
+				{Type: SieveKeep, Implicit: true},
+			},
+		},
+		{
+			name:   "matches wildcard",
+			script: `if header :matches "List-Id" "*golang-*" { discard; stop; } keep;`,
+			want:   []SieveAction{{Type: SieveDiscard}},
+		},
+		{
+			name:   "size and allof",
+			script: `if allof (size :under 1K, not size :over 10M) { keep; }`,
+			want:   []SieveAction{{Type: SieveKeep}},
+		},
+		{
+			name:   "reject",
+			script: `require "reject"; if anyof (false, header :is "to" "bob+lists@example.org") { reject "go away"; }`,
+			want:   []SieveAction{{Type: SieveReject, Reason: "go away"}},
+		},
+		{
+			name:   "imap4flags",
+			script: `require ["imap4flags", "fileinto"]; addflag "\\Seen \\Flagged"; removeflag "\\Flagged"; fileinto "Read";`,
+			want:   []SieveAction{{Type: SieveFileInto, Mailbox: "Read", Flags: []string{"\\Seen"}}},
+		},
+		{
+			name:   "duplicate actions collapse",
+			script: `require "fileinto"; fileinto "A"; fileinto "A";`,
+			want:   []SieveAction{{Type: SieveFileInto, Mailbox: "A"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actions := evaluateTestScript(t, tt.script)
+			if !reflect.DeepEqual(actions, tt.want) {
+				t.Errorf("actions = %+v, want %+v", actions, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateSieve_Errors(t *testing.T) {
+	scripts := []string{
+		`keep; }`,
+		`fileinto "Work";`,
+		`require "vacation";`,
+		`frobnicate;`,
+		`if frob "x" { keep; }`,
+		`else { keep; }`,
+		`if header :comparator "i;unknown" "Subject" "x" { keep; }`,
+		"redirect \"victim@example.net>\r\nBcc: <attacker@evil.test\";",
+		`redirect "not an address";`,
+	}
+	for _, script := range scripts {
+		_, err := EvaluateSieve([]byte(script), Envelope{}, strings.NewReader(sieveTestMessage))
+		if !stderrors.Is(err, errors.ErrInvalidScript) {
+			t.Errorf("EvaluateSieve(%q): expected ErrInvalidScript, got %v", script, err)
+		}
+	}
+}
+
+func TestSieveWildcardMatch(t *testing.T) {
+	tests := []struct {
+		value, pattern string
+		want           bool
+	}{
+		{"hello", "h*o", true},
+		{"hello", "h?llo", true},
+		{"hello", "h?lo", false},
+		{"a*b", `a\*b`, true},
+		{"axb", `a\*b`, false},
+		{"", "*", true},
+		{"abc", "", false},
+	}
+	for _, tt := range tests {
+		if got := sieveWildcardMatch(tt.value, tt.pattern); got != tt.want {
+			t.Errorf("sieveWildcardMatch(%q, %q) = %v, want %v", tt.value, tt.pattern, got, tt.want)
+		}
+	}
+}
+
+func TestSieveEvaluator_Include(t *testing.T) {
+	scripts := map[string]string{
+		"global/spam":  `require "fileinto"; if exists "List-Id" { fileinto "List"; }`,
+		"personal/me":  `require "include"; include :global "spam"; return; discard;`,
+		"personal/a":   `require "include"; include :personal "b";`,
+		"personal/b":   `require "include"; include :personal "a";`,
+		"personal/dup": `require "include"; include :once :global "spam"; include :once :global "spam";`,
+	}
+	ev := SieveEvaluator{Include: func(name string, global bool) ([]byte, error) {
+		key := "personal/" + name
+		if global {
+			key = "global/" + name
+		}
+		src, ok := scripts[key]
+		if !ok {
+			return nil, errors.ErrScriptNotFound
+		}
+		return []byte(src), nil
+	}}
+	run := func(script string) ([]SieveAction, error) {
+		return ev.Evaluate([]byte(script), Envelope{}, strings.NewReader(sieveTestMessage))
+	}
+
+	actions, err := run(`require "include"; include :personal "me"; keep;`)
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	want := []SieveAction{{Type: SieveFileInto, Mailbox: "List"}, {Type: SieveKeep}}
+	if !reflect.DeepEqual(actions, want) {
+		t.Errorf("actions = %+v, want %+v", actions, want)
+	}
+
+	// The included script's require does not leak into the includer.
+	if _, err := run(`require "include"; include :global "spam"; fileinto "X";`); !stderrors.Is(err, errors.ErrInvalidScript) {
+		t.Errorf("expected ErrInvalidScript for fileinto without require, got %v", err)
+	}
+
+	if _, err := run(`require "include"; include "a";`); !stderrors.Is(err, errors.ErrInvalidScript) {
+		t.Errorf("expected ErrInvalidScript for include loop, got %v", err)
+	}
+
+	if _, err := run(`require "include"; include "missing";`); !stderrors.Is(err, errors.ErrScriptNotFound) {
+		t.Errorf("expected ErrScriptNotFound, got %v", err)
+	}
+	if _, err := run(`require "include"; include :optional "missing";`); err != nil {
+		t.Errorf("include :optional of missing script failed: %v", err)
+	}
+
+	if _, err := run(`require "include"; include "dup";`); err != nil {
+		t.Errorf("include :once failed: %v", err)
+	}
+
+	if _, err := EvaluateSieve([]byte(`require "include"; include "me";`), Envelope{}, strings.NewReader(sieveTestMessage)); !stderrors.Is(err, errors.ErrInvalidScript) {
+		t.Errorf("expected ErrInvalidScript without include resolver, got %v", err)
+	}
+}
+
+func TestSieveEvaluator_SystemScript(t *testing.T) {
+	ev := SieveEvaluator{
+		SystemScript: []byte(`require "fileinto"; if exists "X-Spam-Flag" { fileinto "Junk"; stop; }`),
+	}
+	user := []byte(`require "fileinto"; fileinto "Personal";`)
+
+	actions, err := ev.Evaluate(user, Envelope{}, strings.NewReader("X-Spam-Flag: YES\r\n\r\nbuy now"))
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	want := []SieveAction{{Type: SieveFileInto, Mailbox: "Junk", System: true}}
+	if !reflect.DeepEqual(actions, want) {
+		t.Errorf("actions = %+v, want %+v", actions, want)
+	}
+
+	actions, err = ev.Evaluate(user, Envelope{}, strings.NewReader("Subject: hi\r\n\r\nhello"))
+	if err != nil {
+		t.Fatalf("Evaluate failed: %v", err)
+	}
+	want = []SieveAction{{Type: SieveFileInto, Mailbox: "Personal"}}
+	if !reflect.DeepEqual(actions, want) {
+		t.Errorf("actions = %+v, want %+v", actions, want)
+	}
+
+	// The system script's require does not carry over to the user script.
+	_, err = ev.Evaluate([]byte(`fileinto "Personal";`), Envelope{}, strings.NewReader("Subject: hi\r\n\r\nhello"))
+	if !stderrors.Is(err, errors.ErrInvalidScript) {
+		t.Errorf("expected ErrInvalidScript, got %v", err)
+	}
+}
+
+func TestEvaluateSieve_EnvelopeAuth(t *testing.T) {
+	script := []byte(`require "envelope"; if envelope :is "auth" "alice" { discard; }`)
+	for _, tt := range []struct {
+		auth string
+		want SieveActionType
+	}{
+		{"alice", SieveDiscard},
+		{"", SieveKeep},
+	} {
+		envelope := Envelope{From: "alice@example.com", Recipients: []string{"bob@example.org"}, AuthenticatedSender: tt.auth}
+		actions, err := EvaluateSieve(script, envelope, strings.NewReader(sieveTestMessage))
+		if err != nil {
+			t.Fatalf("EvaluateSieve failed: %v", err)
+		}
+		if len(actions) != 1 || actions[0].Type != tt.want {
+			t.Errorf("auth %q: actions = %+v, want %s", tt.auth, actions, tt.want)
+		}
+	}
+}
@@ -3,6 +3,8 @@ package msgstore
 import (
 	"context"
 	"io"
+	"net"
+	"strings"
 	"time"
 )
 
@@ -20,8 +22,10 @@ type MessageStore interface {
 	// The message is not permanently removed until Expunge is called.
 	Delete(ctx context.Context, mailbox string, uid string) error
 
-	// Expunge permanently removes all messages marked for deletion.
-	Expunge(ctx context.Context, mailbox string) error
+	// Expunge permanently removes all messages marked for deletion and
+	// returns the UIDs of the messages actually removed, sorted. Messages
+	// that had already disappeared from storage are not included.
+	Expunge(ctx context.Context, mailbox string) (removed []string, err error)
 
 	// Stat returns mailbox statistics.
 	// count is the number of messages, totalBytes is the sum of all message sizes.
@@ -31,17 +35,141 @@ type MessageStore interface {
 // MessageInfo contains metadata about a stored message.
 type MessageInfo struct {
 	// UID is the unique identifier for the message within the mailbox.
-	UID string
+	UID string `json:"uid"`
 
 	// Size is the message size in bytes.
-	Size int64
+	Size int64 `json:"size"`
 
 	// Flags contains message flags (e.g., "\Seen", "\Deleted", "\Answered").
-	Flags []string
+	Flags []string `json:"flags"`
 
 	// InternalDate is the date the message was received by the server.
 	// Used by IMAP FETCH INTERNALDATE and date-based SEARCH criteria.
-	InternalDate time.Time
+	InternalDate time.Time `json:"internal_date"`
+
+	// The following header summary fields are populated only when listing
+	// with WithHeaderSummary, and are empty for messages whose headers
+	// cannot be read (e.g., encrypted messages).
+
+	// From is the decoded From header.
+	From string `json:"from,omitempty"`
+
+	// Subject is the decoded Subject header.
+	Subject string `json:"subject,omitempty"`
+
+	// Date is the parsed Date header; zero if absent or unparseable.
+	Date time.Time `json:"date,omitzero"`
+
+	// MessageID is the Message-ID header, including angle brackets.
+	MessageID string `json:"message_id,omitempty"`
+}
+
+// ListOptions controls optional work done when listing messages.
+type ListOptions struct {
+	// HeaderSummary requests the From, Subject, Date and MessageID fields
+	// of MessageInfo.
+	HeaderSummary bool
+
+	// Session identifies the IMAP session listing the folder, for \Recent.
+	Session string
+}
+
+// ListOption configures a listing.
+type ListOption func(*ListOptions)
+
+// WithHeaderSummary populates the header summary fields of MessageInfo, so a
+// mailbox view can be rendered from the listing alone. Stores serve these
+// from a header cache where possible, but the first listing of a message
+// reads its header from disk.
+func WithHeaderSummary() ListOption {
+	return func(o *ListOptions) {
+		o.HeaderSummary = true
+	}
+}
+
+// WithSession lists on behalf of an IMAP session. A message is \Recent in
+// exactly one session (RFC 3501 section 2.3.2): the first session to list
+// it after arrival claims it, and it stays \Recent on every listing in that
+// session until EndSession. Listings without a session report messages no
+// session has claimed yet as \Recent, without claiming them.
+func WithSession(session string) ListOption {
+	return func(o *ListOptions) {
+		o.Session = session
+	}
+}
+
+// MessageLister lists messages with options.
+// Consumers that need it should type-assert to MessageLister.
+type MessageLister interface {
+	// ListWithOptions returns message metadata for a folder.
+	// folder may be "INBOX" (or "") for the inbox.
+	ListWithOptions(ctx context.Context, mailbox string, folder string, opts ...ListOption) ([]MessageInfo, error)
+
+	// ListWithFilter returns metadata for the messages in a folder that
+	// match filter. The filter is applied while scanning, so callers
+	// asking for a small subset (e.g., unseen since yesterday) do not
+	// receive the full listing. folder may be "INBOX" (or "") for the inbox.
+	ListWithFilter(ctx context.Context, mailbox string, folder string, filter ListFilter) ([]MessageInfo, error)
+}
+
+// ListFilter selects messages by flags, internal date and size.
+// Zero-valued fields do not constrain the result; all set fields must match.
+type ListFilter struct {
+	// HasFlags lists flags every returned message must have (e.g., "\Flagged").
+	HasFlags []string
+
+	// LacksFlags lists flags no returned message may have (e.g., "\Seen").
+	LacksFlags []string
+
+	// Since selects messages with InternalDate at or after this time.
+	Since time.Time
+
+	// Before selects messages with InternalDate strictly before this time.
+	Before time.Time
+
+	// MinSize selects messages of at least this many bytes.
+	MinSize int64
+
+	// MaxSize selects messages of at most this many bytes.
+	MaxSize int64
+}
+
+// Matches reports whether a message satisfies the filter.
+// Flags are compared case-insensitively, as IMAP requires.
+func (f ListFilter) Matches(info MessageInfo) bool {
+	if !f.Since.IsZero() && info.InternalDate.Before(f.Since) {
+		return false
+	}
+	if !f.Before.IsZero() && !info.InternalDate.Before(f.Before) {
+		return false
+	}
+	if f.MinSize > 0 && info.Size < f.MinSize {
+		return false
+	}
+	if f.MaxSize > 0 && info.Size > f.MaxSize {
+		return false
+	}
+	for _, flag := range f.HasFlags {
+		if !hasFlag(info.Flags, flag) {
+			return false
+		}
+	}
+	for _, flag := range f.LacksFlags {
+		if hasFlag(info.Flags, flag) {
+			return false
+		}
+	}
+	return true
+}
+
+// hasFlag reports whether flags contains flag, ignoring case.
+func hasFlag(flags []string, flag string) bool {
+	for _, f := range flags {
+		if strings.EqualFold(f, flag) {
+			return true
+		}
+	}
+	return false
 }
 
 // FolderStore provides folder hierarchy operations within a user's mailbox.
@@ -56,9 +184,12 @@ type FolderStore interface {
 	// INBOX is implicit and not included in the returned list.
 	ListFolders(ctx context.Context, mailbox string) ([]string, error)
 
-	// DeleteFolder removes a folder and all messages within it.
+	// DeleteFolder removes a folder. Folders nested below it are kept unless
+	// WithRecursive is given.
 	// Returns ErrFolderNotFound if the folder does not exist.
-	DeleteFolder(ctx context.Context, mailbox string, folder string) error
+	// Returns ErrFolderNotEmpty if a folder to delete still holds messages,
+	// unless WithForce is given; nothing is deleted in that case.
+	DeleteFolder(ctx context.Context, mailbox string, folder string, opts ...DeleteFolderOption) error
 
 	// ListInFolder returns message metadata for all messages in a folder.
 	ListInFolder(ctx context.Context, mailbox string, folder string) ([]MessageInfo, error)
@@ -74,16 +205,20 @@ type FolderStore interface {
 	// The message is not permanently removed until ExpungeFolder is called.
 	DeleteInFolder(ctx context.Context, mailbox string, folder string, uid string) error
 
-	// ExpungeFolder permanently removes all messages marked for deletion in a folder.
-	ExpungeFolder(ctx context.Context, mailbox string, folder string) error
+	// ExpungeFolder permanently removes all messages marked for deletion in a
+	// folder and returns the UIDs of the messages actually removed, sorted.
+	ExpungeFolder(ctx context.Context, mailbox string, folder string) (removed []string, err error)
 
 	// DeliverToFolder delivers a message directly to a specific folder.
 	// Used by routing rules (SIEVE, user config) after deciding the target folder.
 	DeliverToFolder(ctx context.Context, mailbox string, folder string, message io.Reader) error
 
-	// RenameFolder renames a folder within a mailbox.
+	// RenameFolder renames a folder within a mailbox, together with all
+	// folders nested below it. Either the whole hierarchy is renamed or
+	// nothing is.
 	// Returns ErrFolderNotFound if oldName does not exist.
-	// Returns ErrFolderExists if newName already exists.
+	// Returns ErrFolderExists if newName, or the new name of a nested
+	// folder, already exists.
 	// INBOX cannot be renamed.
 	RenameFolder(ctx context.Context, mailbox string, oldName string, newName string) error
 
@@ -93,10 +228,13 @@ type FolderStore interface {
 	// folder may be "INBOX" to append to the inbox.
 	AppendToFolder(ctx context.Context, mailbox string, folder string, r io.Reader, flags []string, date time.Time) (uid string, err error)
 
-	// SetFlagsInFolder replaces the complete flag set on a message.
-	// flags uses IMAP flag strings (e.g. "\\Seen", "\\Deleted", "\\Answered").
+	// SetFlagsInFolder changes the flag set on a message as selected by mode:
+	// FlagModeSet replaces it, FlagModeAdd and FlagModeRemove add or remove
+	// the given flags (IMAP STORE FLAGS, +FLAGS and -FLAGS). The change is
+	// applied atomically. flags uses IMAP flag strings (e.g. "\\Seen",
+	// "\\Deleted", "\\Answered").
 	// folder may be "INBOX" to operate on inbox messages.
-	SetFlagsInFolder(ctx context.Context, mailbox string, folder string, uid string, flags []string) error
+	SetFlagsInFolder(ctx context.Context, mailbox string, folder string, uid string, mode FlagMode, flags []string) error
 
 	// CopyMessage copies a message to another folder within the same mailbox.
 	// Returns the UID assigned to the copy in destFolder.
@@ -109,6 +247,434 @@ type FolderStore interface {
 	UIDValidity(ctx context.Context, mailbox string, folder string) (uint32, error)
 }
 
+// Capabilities describes store properties consumers need to advertise.
+type Capabilities struct {
+	// HierarchyDelimiter separates levels in nested folder names
+	// (e.g., "." in "Work.Projects").
+	HierarchyDelimiter string
+
+	// OtherUsersPrefix is the RFC 2342 namespace prefix under which folders
+	// shared by other users appear (e.g., "Other Users/"). Empty if the
+	// store does not implement SharedStore.
+	OtherUsersPrefix string
+
+	// PublicPrefix is the RFC 2342 namespace prefix under which public
+	// folders appear (e.g., "Public/"). Empty if public folders are not
+	// configured.
+	PublicPrefix string
+}
+
+// CapabilityStore reports store capabilities.
+// Consumers that need it should type-assert to CapabilityStore.
+type CapabilityStore interface {
+	// Capabilities returns the store's capabilities. The result does not
+	// change over the life of the store.
+	Capabilities() Capabilities
+}
+
+// FlagMode selects how SetFlagsInFolder applies flags.
+type FlagMode int
+
+const (
+	// FlagModeSet replaces the message's flags.
+	FlagModeSet FlagMode = iota
+
+	// FlagModeAdd adds the flags, keeping the existing ones.
+	FlagModeAdd
+
+	// FlagModeRemove removes the flags, keeping the others.
+	FlagModeRemove
+)
+
+// FolderStatus summarizes a folder for IMAP STATUS and SELECT.
+type FolderStatus struct {
+	// Messages is the number of messages, excluding those marked for deletion.
+	Messages int `json:"messages"`
+
+	// Unseen is the number of messages without the \Seen flag.
+	Unseen int `json:"unseen"`
+
+	// Recent is the number of messages not yet seen by any session.
+	Recent int `json:"recent"`
+
+	// Size is the total size of the messages in bytes.
+	Size int64 `json:"size"`
+
+	// UIDValidity is the folder's UIDVALIDITY value.
+	UIDValidity uint32 `json:"uid_validity"`
+}
+
+// StatusStore reports folder status in a single call.
+// Consumers that need it should type-assert to StatusStore.
+type StatusStore interface {
+	// Status returns message counts and size for a folder without listing
+	// it. folder may be "INBOX" (or "") for the inbox.
+	Status(ctx context.Context, mailbox string, folder string) (FolderStatus, error)
+}
+
+// SessionStore tracks per-session state such as \Recent.
+// Consumers that list with WithSession should type-assert to SessionStore
+// and end the session when the client disconnects or deselects.
+type SessionStore interface {
+	// EndSession releases the state held for session. Messages that were
+	// \Recent in the session are no longer \Recent in any session.
+	EndSession(ctx context.Context, session string) error
+}
+
+// AppendItem is one message for MultiAppender.AppendMultiple.
+type AppendItem struct {
+	// Message is the full message content.
+	Message io.Reader
+
+	// Flags uses IMAP flag strings (e.g. "\Seen").
+	Flags []string
+
+	// Date is the internal date to record. Defaults to the time of the append.
+	Date time.Time
+}
+
+// MultiAppender appends several messages in one call, as needed for IMAP
+// MULTIAPPEND (RFC 3502) and migration tools.
+// Consumers that need it should type-assert to MultiAppender.
+type MultiAppender interface {
+	// AppendMultiple appends items to a folder and returns their UIDs in
+	// order. The append is atomic: if any message cannot be stored, none
+	// are. folder may be "INBOX".
+	AppendMultiple(ctx context.Context, mailbox string, folder string, items []AppendItem) (uids []string, err error)
+}
+
+// MessageCopier copies many messages in one call, as needed for IMAP COPY
+// of a large UID set.
+// Consumers that need it should type-assert to MessageCopier.
+type MessageCopier interface {
+	// CopyMessages copies the messages in uids from srcFolder to destFolder
+	// within the same mailbox, keeping their flags. It returns a map from
+	// each copied source UID to the UID of its copy; UIDs that do not exist
+	// are skipped. On error, the map holds the copies made so far.
+	// Either folder may be "INBOX".
+	CopyMessages(ctx context.Context, mailbox string, srcFolder string, uids []string, destFolder string) (copied map[string]string, err error)
+}
+
+// MessageMover moves messages between folders, as needed for IMAP MOVE
+// (RFC 6851).
+// Consumers that need it should type-assert to MessageMover.
+type MessageMover interface {
+	// MoveMessages moves the messages in uids from srcFolder to destFolder
+	// within the same mailbox, keeping their flags and deletion marks. Each
+	// message is moved atomically: it is in exactly one of the two folders
+	// at any time. It returns a map from each moved source UID to its UID in
+	// destFolder; UIDs that do not exist are skipped. On error, the map holds
+	// the messages moved so far. Either folder may be "INBOX".
+	MoveMessages(ctx context.Context, mailbox string, srcFolder string, uids []string, destFolder string) (moved map[string]string, err error)
+}
+
+// UIDExpunger removes a chosen subset of deleted messages, as needed for
+// IMAP UID EXPUNGE (RFC 4315, UIDPLUS).
+// Consumers that need it should type-assert to UIDExpunger.
+type UIDExpunger interface {
+	// ExpungeUIDs permanently removes the messages in uids that are marked
+	// for deletion in a folder; other deleted messages stay marked. UIDs that
+	// are not marked for deletion are ignored. folder may be "INBOX" (or "")
+	// for the inbox. Returns the UIDs of the messages actually removed, sorted.
+	ExpungeUIDs(ctx context.Context, mailbox string, folder string, uids []string) (removed []string, err error)
+}
+
+// Maintainer runs a store's background housekeeping policies, such as
+// archive routing, for one mailbox.
+// Consumers that need it should type-assert to Maintainer.
+type Maintainer interface {
+	// Maintain applies every configured policy to mailbox once, and wakes
+	// due snoozed messages in stores that implement Snoozer.
+	Maintain(ctx context.Context, mailbox string) error
+}
+
+// Unlocker releases a lock taken with MailboxLocker.
+type Unlocker interface {
+	// Unlock releases the lock. Calls after the first do nothing.
+	Unlock() error
+}
+
+// MailboxLocker lets maintenance tools (backup, reindexing, migration)
+// quiesce a mailbox through the store instead of guessing at its lock
+// files. While the lock is held, the store's operations on the mailbox and
+// its folders wait for it.
+// Consumers that need it should type-assert to MailboxLocker.
+type MailboxLocker interface {
+	// LockMailbox blocks until it holds mailbox's lock or ctx is done.
+	LockMailbox(ctx context.Context, mailbox string) (Unlocker, error)
+}
+
+// DomainLister enumerates the mailboxes a store holds for one domain, so
+// per-domain quota reports, migrations and the removal of a whole domain
+// need not go through the authentication backend's user list.
+// Consumers that need it should type-assert to DomainLister.
+type DomainLister interface {
+	// ListMailboxesByDomain returns the addresses of domain's mailboxes,
+	// sorted. Stores whose layout does not record domains return
+	// errors.ErrNotSupported.
+	ListMailboxesByDomain(ctx context.Context, domain string) ([]string, error)
+}
+
+// ScheduledDeliverer spools messages for delivery at a later time, for
+// delayed-send and digest features built on top of the store.
+// Consumers that need it should type-assert to ScheduledDeliverer.
+type ScheduledDeliverer interface {
+	// ScheduleDeliver spools message for delivery to envelope's recipients
+	// at the given time, and returns an ID for CancelScheduled.
+	ScheduleDeliver(ctx context.Context, envelope Envelope, message io.Reader, at time.Time) (id string, err error)
+
+	// CancelScheduled removes a spooled message before it is delivered.
+	// Returns ErrMessageNotFound if id is unknown or already delivered.
+	CancelScheduled(ctx context.Context, id string) error
+
+	// DeliverDue delivers every spooled message whose time has come.
+	// Stores with a maintenance worker call it on every run.
+	DeliverDue(ctx context.Context) error
+}
+
+// Greylister keeps greylisting triplets for smtpd, so that it can defer
+// mail from unknown combinations of client, sender and recipient without
+// a database of its own.
+// Consumers that need it should type-assert to Greylister.
+type Greylister interface {
+	// ShouldGreylist records a delivery attempt from clientIP by sender
+	// to recipient and reports whether it should be deferred with a
+	// temporary failure. The first attempt of a triplet is deferred, and
+	// so are retries that come sooner than the store's greylisting delay.
+	ShouldGreylist(ctx context.Context, clientIP net.IP, sender, recipient string) (bool, error)
+
+	// PurgeGreylist removes triplets that were never retried and passed
+	// triplets that have not been seen for a long time. Stores with a
+	// maintenance worker call it on every run.
+	PurgeGreylist(ctx context.Context) error
+}
+
+// GarbageReport summarizes a garbage collection run.
+type GarbageReport struct {
+	// Mailboxes is how many unused mailboxes were removed.
+	Mailboxes int
+
+	// Folders is how many leftover folders were pruned from the mailboxes
+	// that were kept.
+	Folders int
+
+	// Bytes is the space reclaimed: the total size of the removed files
+	// and directories.
+	Bytes int64
+}
+
+// GarbageCollector removes storage structure nothing uses: mailboxes that
+// were created on first access but never received mail, and folders left
+// behind by interrupted operations.
+// Consumers that need it should type-assert to GarbageCollector.
+type GarbageCollector interface {
+	// CollectGarbage sweeps the whole store once and reports what it
+	// removed. Stores with a maintenance worker call it on every run.
+	CollectGarbage(ctx context.Context) (GarbageReport, error)
+}
+
+// ExpungedMessage describes an expunged message still held for its grace
+// period.
+type ExpungedMessage struct {
+	// UID identifies the message in the holding area, for Restore.
+	UID string
+
+	// Folder is the folder it was expunged from ("INBOX" for the inbox).
+	Folder string
+
+	// ExpungedAt is when the message was expunged.
+	ExpungedAt time.Time
+
+	// Size is the message size in bytes.
+	Size int64
+}
+
+// ExpungeRecoverer restores messages expunged within the store's grace
+// period, protecting users from destructive client behavior.
+// Consumers that need it should type-assert to ExpungeRecoverer.
+type ExpungeRecoverer interface {
+	// ListExpunged returns the messages of mailbox that can still be
+	// restored, oldest first.
+	ListExpunged(ctx context.Context, mailbox string) ([]ExpungedMessage, error)
+
+	// Restore puts a held message back into the folder it was expunged
+	// from, or into the inbox if that folder is gone, and returns the
+	// folder and the message's UID there. Returns ErrMessageNotFound if uid
+	// is not held.
+	Restore(ctx context.Context, mailbox string, uid string) (folder string, newUID string, err error)
+}
+
+// Tombstone records a message that disappeared from a folder, by expunge or
+// by being moved out.
+type Tombstone struct {
+	UID        string
+	ModSeq     uint64 // folder modification sequence of the removal
+	ExpungedAt time.Time
+}
+
+// TombstoneStore keeps a bounded per-folder log of removed messages, so
+// synchronizing clients and IMAP QRESYNC (RFC 7162) can learn what
+// disappeared without a full resync.
+// Consumers that need it should type-assert to TombstoneStore.
+type TombstoneStore interface {
+	// ExpungedSince returns the messages removed from folder ("INBOX" for
+	// the inbox) with a modification sequence above since, oldest first,
+	// and the folder's highest modification sequence. complete is false if
+	// the log no longer reaches back to since, in which case the client
+	// must resynchronize in full.
+	ExpungedSince(ctx context.Context, mailbox string, folder string, since uint64) (tombstones []Tombstone, highest uint64, complete bool, err error)
+}
+
+// FlagChange reports the current flags of a message that arrived or whose
+// flags changed.
+type FlagChange struct {
+	UID    string
+	Flags  []string
+	ModSeq uint64
+}
+
+// ResyncResult is what changed in a folder since a client's last known
+// state.
+type ResyncResult struct {
+	// UIDValidity and HighestModSeq are the folder's current state, for
+	// the client to remember.
+	UIDValidity   uint32
+	HighestModSeq uint64
+
+	// Complete is false if the client's state is too old or its
+	// UIDVALIDITY no longer matches; Changed and Vanished are then empty
+	// and the client must resynchronize in full.
+	Complete bool
+
+	// Changed lists the messages that arrived or changed flags, in order
+	// of modification sequence.
+	Changed []FlagChange
+
+	// Vanished lists the UIDs of messages removed from the folder.
+	Vanished []string
+}
+
+// QResyncStore reports folder changes since a (UIDVALIDITY, MODSEQ) pair,
+// so imapd can implement QRESYNC (RFC 7162) and reconnecting clients need
+// not refetch flags for the whole folder.
+// Consumers that need it should type-assert to QResyncStore.
+type QResyncStore interface {
+	// Resync returns the changes to folder ("INBOX" for the inbox) after
+	// modification sequence since, for a client that last saw the folder
+	// with uidValidity.
+	Resync(ctx context.Context, mailbox string, folder string, uidValidity uint32, since uint64) (ResyncResult, error)
+}
+
+// SyncChanges is the difference between a client's copy of a folder and
+// its current contents.
+type SyncChanges struct {
+	// Added lists messages that arrived since the token, with header
+	// summaries.
+	Added []MessageInfo
+
+	// Updated lists messages whose flags changed since the token.
+	Updated []MessageInfo
+
+	// Removed lists the UIDs of messages that left the folder.
+	Removed []string
+
+	// Token identifies the folder's current state, for the next call.
+	Token string
+
+	// Reset is true if the client must discard its copy: the token was
+	// empty, too old, or from before the folder was recreated. Added then
+	// lists the whole folder.
+	Reset bool
+}
+
+// SyncStore is a backend-agnostic sync primitive for JMAP, webmail and
+// mobile push gateways.
+// Consumers that need it should type-assert to SyncStore.
+type SyncStore interface {
+	// ChangesSince returns what changed in folder ("INBOX" for the inbox)
+	// since the state identified by token, which is opaque and was
+	// returned by an earlier call; "" asks for the full contents. Returns
+	// ErrInvalidSyncToken if the store did not issue token.
+	ChangesSince(ctx context.Context, mailbox string, folder string, token string) (SyncChanges, error)
+}
+
+// SnoozedFolder is the folder holding snoozed messages until they wake.
+const SnoozedFolder = "Snoozed"
+
+// Snoozer hides messages from their folder until a wake time, the data
+// model behind a snooze feature. Snoozed messages wait in SnoozedFolder;
+// the store's maintenance moves them back once due and marks them \Recent.
+// Consumers that need it should type-assert to Snoozer.
+type Snoozer interface {
+	// Snooze moves the messages uids from folder ("INBOX" for the inbox) to
+	// SnoozedFolder until the wake time, and returns a map from each
+	// snoozed UID to its UID in SnoozedFolder. UIDs that do not exist are
+	// skipped.
+	Snooze(ctx context.Context, mailbox string, folder string, uids []string, until time.Time) (snoozed map[string]string, err error)
+}
+
+// DeleteFolderOptions controls FolderStore.DeleteFolder.
+type DeleteFolderOptions struct {
+	// Force deletes folders that still hold messages.
+	Force bool
+
+	// Recursive also deletes the folders nested below the folder.
+	Recursive bool
+}
+
+// DeleteFolderOption configures a folder deletion.
+type DeleteFolderOption func(*DeleteFolderOptions)
+
+// WithForce deletes a folder together with the messages in it. Without it,
+// only empty folders are deleted, protecting users from losing mail to a
+// mistaken IMAP DELETE.
+func WithForce() DeleteFolderOption {
+	return func(o *DeleteFolderOptions) {
+		o.Force = true
+	}
+}
+
+// WithRecursive also deletes every folder nested below the folder.
+func WithRecursive() DeleteFolderOption {
+	return func(o *DeleteFolderOptions) {
+		o.Recursive = true
+	}
+}
+
+// MetadataStore stores IMAP METADATA (RFC 5464) annotations for a mailbox
+// and its folders, such as /private/comment or /shared/vendor/... entries.
+// Consumers that need it should type-assert to MetadataStore.
+type MetadataStore interface {
+	// GetMetadata returns the values of the named entries that are set.
+	// If entries is empty, all entries are returned. folder "" addresses
+	// the mailbox itself (server annotations in RFC 5464 terms); any other
+	// folder, including "INBOX", addresses that folder.
+	GetMetadata(ctx context.Context, mailbox string, folder string, entries []string) (map[string]string, error)
+
+	// SetMetadata sets the given entries; an empty value removes the entry.
+	// Entry names must start with /private/ or /shared/.
+	// Returns ErrInvalidMetadataEntry or ErrMetadataTooLarge without
+	// changing anything if any entry is rejected.
+	SetMetadata(ctx context.Context, mailbox string, folder string, entries map[string]string) error
+}
+
+// AnnotationStore attaches key/value annotations to individual messages,
+// such as notes, labels beyond IMAP keywords, or webmail pinning, without
+// touching message content.
+// Consumers that need it should type-assert to AnnotationStore.
+type AnnotationStore interface {
+	// SetAnnotation sets key on the message uid in folder ("INBOX" for the
+	// inbox); an empty value removes it. Returns ErrMessageNotFound if the
+	// message does not exist, ErrInvalidAnnotationKey for a bad key, or
+	// ErrMetadataTooLarge if the value or the message's annotations exceed
+	// the store's limits.
+	SetAnnotation(ctx context.Context, mailbox string, folder string, uid string, key string, value string) error
+
+	// GetAnnotations returns every annotation set on the message uid; the
+	// map is empty if there are none.
+	GetAnnotations(ctx context.Context, mailbox string, folder string, uid string) (map[string]string, error)
+}
+
 // FolderSpec defines a default folder with an optional IMAP SPECIAL-USE attribute (RFC 6154).
 type FolderSpec struct {
 	// Name is the folder name (e.g., "Junk", "Sent").
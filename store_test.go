@@ -1,6 +1,10 @@
 package msgstore
 
-import "testing"
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
 
 func TestSpecialUseFor(t *testing.T) {
 	tests := []struct {
@@ -52,3 +56,64 @@ func TestDefaultFolders_NoDuplicates(t *testing.T) {
 		seen[f.Name] = true
 	}
 }
+
+func TestListFilter_Matches(t *testing.T) {
+	day := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+	msg := MessageInfo{
+		UID:          "1",
+		Size:         1000,
+		Flags:        []string{"\\Seen", "\\Flagged"},
+		InternalDate: day,
+	}
+	tests := []struct {
+		name   string
+		filter ListFilter
+		want   bool
+	}{
+		{"empty filter", ListFilter{}, true},
+		{"has flag", ListFilter{HasFlags: []string{"\\flagged"}}, true},
+		{"missing flag", ListFilter{HasFlags: []string{"\\Answered"}}, false},
+		{"lacks flag", ListFilter{LacksFlags: []string{"\\Draft"}}, true},
+		{"lacks present flag", ListFilter{LacksFlags: []string{"\\Seen"}}, false},
+		{"since inclusive", ListFilter{Since: day}, true},
+		{"since later", ListFilter{Since: day.Add(time.Second)}, false},
+		{"before exclusive", ListFilter{Before: day}, false},
+		{"before later", ListFilter{Before: day.Add(time.Second)}, true},
+		{"min size", ListFilter{MinSize: 1000}, true},
+		{"min size too large", ListFilter{MinSize: 1001}, false},
+		{"max size", ListFilter{MaxSize: 999}, false},
+		{"combined", ListFilter{HasFlags: []string{"\\Seen"}, MinSize: 10, MaxSize: 5000, Since: day.Add(-time.Hour)}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.filter.Matches(msg); got != tt.want {
+			t.Errorf("%s: Matches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMessageInfo_JSON(t *testing.T) {
+	info := MessageInfo{
+		UID:          "1700000000.M1P2.host",
+		Size:         1234,
+		Flags:        []string{"\\Seen"},
+		InternalDate: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	want := `{"uid":"1700000000.M1P2.host","size":1234,"flags":["\\Seen"],"internal_date":"2026-01-02T03:04:05Z"}`
+	if string(data) != want {
+		t.Errorf("MessageInfo JSON = %s, want %s", data, want)
+	}
+
+	status := FolderStatus{Messages: 3, Unseen: 1, Recent: 1, Size: 42, UIDValidity: 7}
+	data, err = json.Marshal(status)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	want = `{"messages":3,"unseen":1,"recent":1,"size":42,"uid_validity":7}`
+	if string(data) != want {
+		t.Errorf("FolderStatus JSON = %s, want %s", data, want)
+	}
+}
@@ -0,0 +1,60 @@
+package msgstore
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/infodancer/msgstore/errors"
+)
+
+// ParseStoreURL parses a store configuration written as a single URL, for
+// daemons and tests that take configuration as one string. The scheme is
+// the store type, the path is the base path and query parameters are the
+// options:
+//
+//	maildir:///var/mail?maildir_subdir=Maildir&path_template={localpart}
+//	session:?socket=/run/mailstore/store.sock
+//
+// A host, as in s3://bucket/prefix, is prepended to the path. Errors wrap
+// ErrStoreConfigInvalid.
+func ParseStoreURL(rawURL string) (StoreConfig, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return StoreConfig{}, fmt.Errorf("%w: %v", errors.ErrStoreConfigInvalid, err)
+	}
+	if u.Scheme == "" {
+		return StoreConfig{}, fmt.Errorf("%w: store URL %q has no scheme", errors.ErrStoreConfigInvalid, rawURL)
+	}
+	if u.User != nil || u.Fragment != "" {
+		return StoreConfig{}, fmt.Errorf("%w: store URL %q has user info or a fragment", errors.ErrStoreConfigInvalid, rawURL)
+	}
+
+	config := StoreConfig{Type: u.Scheme, BasePath: u.Host + u.Path}
+	if u.Opaque != "" {
+		config.BasePath = u.Opaque
+	}
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return StoreConfig{}, fmt.Errorf("%w: %v", errors.ErrStoreConfigInvalid, err)
+	}
+	if len(query) > 0 {
+		config.Options = make(map[string]string, len(query))
+		for key, values := range query {
+			if len(values) > 1 {
+				return StoreConfig{}, fmt.Errorf("%w: option %q given more than once", errors.ErrStoreConfigInvalid, key)
+			}
+			config.Options[key] = values[0]
+		}
+	}
+	return config, nil
+}
+
+// OpenURL opens the store described by a URL in the form accepted by
+// ParseStoreURL.
+func OpenURL(rawURL string) (MsgStore, error) {
+	config, err := ParseStoreURL(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	return Open(config)
+}
@@ -0,0 +1,345 @@
+package msgstore
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+const (
+	// StreamEncryptionAlgorithm is the algorithm identifier for messages
+	// encrypted in frames by streaming delivery. It uses the same NaCl box
+	// as EncryptionAlgorithm, but the ciphertext can be produced and read
+	// without holding the whole message in memory.
+	StreamEncryptionAlgorithm = "x25519-xsalsa20-poly1305-stream"
+
+	// streamFrameSize is the plaintext size of every frame but the last.
+	streamFrameSize = 64 * 1024
+
+	// streamNoncePrefixSize is the random part of each frame nonce; the
+	// remaining 8 bytes are the frame counter.
+	streamNoncePrefixSize = NonceSize - 8
+
+	// streamFinalFlag marks the last frame, in both its length prefix and
+	// its nonce counter, so a truncated stream cannot pass as complete.
+	streamFinalFlag = 1 << 31
+)
+
+// The stream format is:
+//
+//	ephemeral_public_key (32B) || nonce_prefix (16B) || frame...
+//
+// where each frame is a big-endian uint32 length, with streamFinalFlag set
+// on the last frame, followed by that many bytes of box output. Frame i is
+// sealed with nonce nonce_prefix || uint64(i), with the top bit of the
+// counter set for the last frame. The last frame may be empty.
+
+// streamEncrypter encrypts what is written to it into the stream format.
+type streamEncrypter struct {
+	w      io.Writer
+	shared [32]byte
+	prefix [streamNoncePrefixSize]byte
+	count  uint64
+	buf    []byte
+	closed bool
+}
+
+// newStreamEncrypter writes the stream header for recipientPubKey to w and
+// returns a writer encrypting into it. Close writes the last frame; it does
+// not close w.
+func newStreamEncrypter(w io.Writer, recipientPubKey []byte) (*streamEncrypter, error) {
+	if len(recipientPubKey) != PublicKeySize {
+		return nil, fmt.Errorf("invalid recipient public key size: %d", len(recipientPubKey))
+	}
+	ephemeralPub, ephemeralPriv, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate ephemeral key: %w", err)
+	}
+	var recipientKey [PublicKeySize]byte
+	copy(recipientKey[:], recipientPubKey)
+
+	e := &streamEncrypter{w: w, buf: make([]byte, 0, streamFrameSize)}
+	box.Precompute(&e.shared, &recipientKey, ephemeralPriv)
+	if _, err := rand.Read(e.prefix[:]); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+	if _, err := w.Write(ephemeralPub[:]); err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(e.prefix[:]); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Write buffers p and writes every completed frame.
+func (e *streamEncrypter) Write(p []byte) (int, error) {
+	if e.closed {
+		return 0, errors.New("write to closed stream encrypter")
+	}
+	n := 0
+	for len(p) > 0 {
+		// A full frame is held back until more data arrives, since it may
+		// turn out to be the last one.
+		if len(e.buf) == streamFrameSize {
+			if err := e.writeFrame(false); err != nil {
+				return n, err
+			}
+		}
+		chunk := min(len(p), streamFrameSize-len(e.buf))
+		e.buf = append(e.buf, p[:chunk]...)
+		p = p[chunk:]
+		n += chunk
+	}
+	return n, nil
+}
+
+// Close writes the buffered data as the last frame.
+func (e *streamEncrypter) Close() error {
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	return e.writeFrame(true)
+}
+
+func (e *streamEncrypter) writeFrame(final bool) error {
+	nonce := streamNonce(e.prefix, e.count, final)
+	e.count++
+	sealed := box.SealAfterPrecomputation(nil, e.buf, &nonce, &e.shared)
+	e.buf = e.buf[:0]
+
+	length := uint32(len(sealed))
+	if final {
+		length |= streamFinalFlag
+	}
+	var header [4]byte
+	binary.BigEndian.PutUint32(header[:], length)
+	if _, err := e.w.Write(header[:]); err != nil {
+		return err
+	}
+	_, err := e.w.Write(sealed)
+	return err
+}
+
+// streamNonce returns the nonce of frame count.
+func streamNonce(prefix [streamNoncePrefixSize]byte, count uint64, final bool) [NonceSize]byte {
+	var nonce [NonceSize]byte
+	copy(nonce[:], prefix[:])
+	if final {
+		count |= 1 << 63
+	}
+	binary.BigEndian.PutUint64(nonce[streamNoncePrefixSize:], count)
+	return nonce
+}
+
+// streamDecrypter reads plaintext from a stream-format ciphertext.
+type streamDecrypter struct {
+	r      *bufio.Reader
+	shared [32]byte
+	prefix [streamNoncePrefixSize]byte
+	count  uint64
+	plain  []byte
+	done   bool
+}
+
+// DecryptStream returns a reader of the plaintext of a message encrypted
+// with StreamEncryptionAlgorithm, decrypting one frame at a time with the
+// recipient's private key. Reading fails if a frame was altered, reordered
+// or dropped, or if the stream ends before its last frame.
+func DecryptStream(r io.Reader, privateKey []byte) (io.Reader, error) {
+	if len(privateKey) != PublicKeySize {
+		return nil, fmt.Errorf("invalid private key size: %d", len(privateKey))
+	}
+	d := &streamDecrypter{r: bufio.NewReader(r)}
+	var ephemeralPub, privKey [PublicKeySize]byte
+	if _, err := io.ReadFull(d.r, ephemeralPub[:]); err != nil {
+		return nil, fmt.Errorf("read stream header: %w", err)
+	}
+	if _, err := io.ReadFull(d.r, d.prefix[:]); err != nil {
+		return nil, fmt.Errorf("read stream header: %w", err)
+	}
+	copy(privKey[:], privateKey)
+	box.Precompute(&d.shared, &ephemeralPub, &privKey)
+	return d, nil
+}
+
+func (d *streamDecrypter) Read(p []byte) (int, error) {
+	for len(d.plain) == 0 {
+		if d.done {
+			return 0, io.EOF
+		}
+		if err := d.readFrame(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, d.plain)
+	d.plain = d.plain[n:]
+	return n, nil
+}
+
+func (d *streamDecrypter) readFrame() error {
+	var header [4]byte
+	if _, err := io.ReadFull(d.r, header[:]); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("read frame: %w", err)
+	}
+	length := binary.BigEndian.Uint32(header[:])
+	final := length&streamFinalFlag != 0
+	length &^= streamFinalFlag
+	if length < box.Overhead || length > streamFrameSize+box.Overhead {
+		return fmt.Errorf("invalid frame length %d", length)
+	}
+	sealed := make([]byte, length)
+	if _, err := io.ReadFull(d.r, sealed); err != nil {
+		return fmt.Errorf("read frame: %w", io.ErrUnexpectedEOF)
+	}
+
+	nonce := streamNonce(d.prefix, d.count, final)
+	d.count++
+	plain, ok := box.OpenAfterPrecomputation(nil, sealed, &nonce, &d.shared)
+	if !ok {
+		return fmt.Errorf("decryption failed")
+	}
+	d.plain = plain
+	if final {
+		d.done = true
+		if _, err := d.r.ReadByte(); err != io.EOF {
+			return fmt.Errorf("data after final frame")
+		}
+	}
+	return nil
+}
+
+// maxSniffSize is how much of a message streaming delivery reads ahead to
+// recognise end-to-end encrypted messages by their headers.
+const maxSniffSize = 64 * 1024
+
+// streamCopy is one copy of a message being delivered by streaming
+// delivery: the writer feeding it and the outcome of its delivery.
+type streamCopy struct {
+	recipient string // "" for the plaintext copy
+	pipe      *io.PipeWriter
+	w         io.Writer // pipe, or an encrypter writing into it
+	enc       *streamEncrypter
+	failed    bool
+	done      chan error
+}
+
+// deliverStreaming implements Deliver for WithStreamingEncryption.
+func (e *EncryptingDeliveryAgent) deliverStreaming(ctx context.Context, envelope Envelope, message io.Reader) error {
+	br := bufio.NewReaderSize(message, maxSniffSize)
+	if e.passthroughEncrypted {
+		head, _ := br.Peek(maxSniffSize)
+		if isEndToEndEncrypted(head) {
+			envelope.Encryption = nil
+			return e.underlying.Deliver(ctx, envelope, br)
+		}
+	}
+
+	plaintextRecipients, encryptedRecipients, recipientKeys, errs := e.groupRecipients(ctx, envelope.Recipients)
+
+	var copies []*streamCopy
+	start := func(env Envelope, recipient string, key []byte) {
+		pr, pw := io.Pipe()
+		c := &streamCopy{recipient: recipient, pipe: pw, w: pw, done: make(chan error, 1)}
+		copies = append(copies, c)
+		go func() {
+			err := e.underlying.Deliver(ctx, env, pr)
+			// Unblock the writer if the delivery stopped reading early.
+			pr.CloseWithError(io.ErrClosedPipe)
+			c.done <- err
+		}()
+		if key == nil {
+			return
+		}
+		// The encrypter writes the stream header into the pipe, so this
+		// comes after the delivery has started reading.
+		var enc *streamEncrypter
+		var err error
+		if e.marker {
+			_, err = io.WriteString(pw, newEncryptionMarker(StreamEncryptionAlgorithm, key).String())
+		}
+		if err == nil {
+			enc, err = newStreamEncrypter(pw, key)
+		}
+		if err != nil {
+			c.failed = true
+			pw.CloseWithError(fmt.Errorf("encrypt for %s: %w", recipient, err))
+			return
+		}
+		c.enc, c.w = enc, enc
+	}
+
+	if len(plaintextRecipients) > 0 {
+		plaintextEnvelope := envelope
+		plaintextEnvelope.Recipients = plaintextRecipients
+		plaintextEnvelope.Encryption = nil
+		start(plaintextEnvelope, "", nil)
+	}
+	for _, recipient := range encryptedRecipients {
+		encEnvelope := envelope
+		encEnvelope.Recipients = []string{recipient}
+		encEnvelope.Encryption = &EncryptionInfo{
+			Algorithm: StreamEncryptionAlgorithm,
+			Encrypted: true,
+		}
+		start(encEnvelope, recipient, recipientKeys[recipient])
+	}
+
+	_, readErr := io.Copy(fanOut(copies), br)
+	for _, c := range copies {
+		switch {
+		case readErr != nil:
+			c.pipe.CloseWithError(fmt.Errorf("read message: %w", readErr))
+		case c.enc != nil && !c.failed:
+			if err := c.enc.Close(); err != nil {
+				c.failed = true
+			}
+			c.pipe.Close()
+		default:
+			c.pipe.Close()
+		}
+	}
+	for _, c := range copies {
+		if err := <-c.done; err != nil {
+			if c.recipient != "" {
+				err = fmt.Errorf("deliver to %s: %w", c.recipient, err)
+			}
+			errs = append(errs, err)
+		}
+	}
+	if readErr != nil {
+		errs = append(errs, fmt.Errorf("read message: %w", readErr))
+	}
+	return errors.Join(errs...)
+}
+
+// fanOut returns a writer that writes to every copy, dropping copies whose
+// delivery has failed so the others carry on.
+func fanOut(copies []*streamCopy) io.Writer {
+	return writerFunc(func(p []byte) (int, error) {
+		for _, c := range copies {
+			if c.failed {
+				continue
+			}
+			if _, err := c.w.Write(p); err != nil {
+				c.failed = true
+			}
+		}
+		return len(p), nil
+	})
+}
+
+// writerFunc adapts a function to io.Writer.
+type writerFunc func(p []byte) (int, error)
+
+func (f writerFunc) Write(p []byte) (int, error) { return f(p) }
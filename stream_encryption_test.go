@@ -0,0 +1,134 @@
+package msgstore
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func encryptStream(t *testing.T, plaintext, pubKey []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	enc, err := newStreamEncrypter(&buf, pubKey)
+	if err != nil {
+		t.Fatalf("newStreamEncrypter: %v", err)
+	}
+	// Write in odd-sized pieces to exercise frame boundaries.
+	for len(plaintext) > 0 {
+		n := min(len(plaintext), 10000)
+		if _, err := enc.Write(plaintext[:n]); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		plaintext = plaintext[n:]
+	}
+	if err := enc.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	return buf.Bytes()
+}
+
+func TestStreamEncryption_RoundTrip(t *testing.T) {
+	pub, priv := generateTestKeyPair()
+	for _, size := range []int{0, 1, streamFrameSize, streamFrameSize + 1, 3*streamFrameSize + 17} {
+		plaintext := make([]byte, size)
+		_, _ = rand.Read(plaintext)
+		ciphertext := encryptStream(t, plaintext, pub)
+
+		r, err := DecryptStream(bytes.NewReader(ciphertext), priv)
+		if err != nil {
+			t.Fatalf("size %d: DecryptStream: %v", size, err)
+		}
+		got, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("size %d: reading plaintext: %v", size, err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Errorf("size %d: plaintext mismatch", size)
+		}
+	}
+}
+
+func TestStreamEncryption_DetectsTampering(t *testing.T) {
+	pub, priv := generateTestKeyPair()
+	plaintext := bytes.Repeat([]byte("x"), 2*streamFrameSize+5)
+	ciphertext := encryptStream(t, plaintext, pub)
+	header := PublicKeySize + streamNoncePrefixSize
+	firstFrame := 4 + streamFrameSize + 16 // length prefix, data, box overhead
+
+	flipped := bytes.Clone(ciphertext)
+	flipped[header+100] ^= 1
+	tests := map[string][]byte{
+		"truncated":  ciphertext[:header+2*firstFrame],
+		"flipped":    flipped,
+		"extended":   append(bytes.Clone(ciphertext), 0),
+		"no frames":  ciphertext[:header],
+		"cut header": ciphertext[:10],
+	}
+	for name, data := range tests {
+		r, err := DecryptStream(bytes.NewReader(data), priv)
+		if err == nil {
+			_, err = io.ReadAll(r)
+		}
+		if err == nil {
+			t.Errorf("%s: decrypted without error", name)
+		}
+	}
+}
+
+// earlyFailAgent fails deliveries to one recipient without reading the
+// message, and passes the rest on.
+type earlyFailAgent struct {
+	next      DeliveryAgent
+	recipient string
+}
+
+func (a *earlyFailAgent) Deliver(ctx context.Context, envelope Envelope, message io.Reader) error {
+	if envelope.Recipients[0] == a.recipient {
+		return errors.New("rejected")
+	}
+	return a.next.Deliver(ctx, envelope, message)
+}
+
+func TestEncryptingDeliveryAgent_Streaming(t *testing.T) {
+	alicePub, alicePriv := generateTestKeyPair()
+	bobPub, _ := generateTestKeyPair()
+	keyProvider := &mockKeyProvider{keys: map[string][]byte{"alice": alicePub, "bob": bobPub}}
+	underlying := &mockDeliveryAgent{}
+	agent := NewEncryptingDeliveryAgent(&earlyFailAgent{next: underlying, recipient: "bob@example.com"}, keyProvider, WithStreamingEncryption())
+
+	message := []byte("Subject: big\r\n\r\n" + strings.Repeat("line of text\r\n", 20000))
+	envelope := Envelope{Recipients: []string{"alice@example.com", "bob@example.com", "carol@example.com"}}
+	err := agent.Deliver(context.Background(), envelope, bytes.NewReader(message))
+	if err == nil || !strings.Contains(err.Error(), "bob@example.com") {
+		t.Fatalf("Deliver error = %v, want bob's failure", err)
+	}
+
+	if len(underlying.deliveries) != 2 {
+		t.Fatalf("expected 2 deliveries, got %d", len(underlying.deliveries))
+	}
+	for _, d := range underlying.deliveries {
+		switch d.envelope.Recipients[0] {
+		case "carol@example.com":
+			if d.envelope.Encryption != nil || !bytes.Equal(d.message, message) {
+				t.Error("plaintext copy differs from the message")
+			}
+		case "alice@example.com":
+			if d.envelope.Encryption == nil || d.envelope.Encryption.Algorithm != StreamEncryptionAlgorithm {
+				t.Fatalf("alice's copy has encryption %+v", d.envelope.Encryption)
+			}
+			r, err := DecryptStream(bytes.NewReader(d.message), alicePriv)
+			if err != nil {
+				t.Fatalf("DecryptStream: %v", err)
+			}
+			if got, err := io.ReadAll(r); err != nil || !bytes.Equal(got, message) {
+				t.Errorf("alice's copy decrypts to %d bytes, %v", len(got), err)
+			}
+		default:
+			t.Errorf("unexpected delivery to %v", d.envelope.Recipients)
+		}
+	}
+}
@@ -0,0 +1,396 @@
+package wkd
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+// OpenPGP packet tags (RFC 4880, section 4.3) used by the parser.
+const (
+	tagSignature    = 2
+	tagPublicKey    = 6
+	tagUserID       = 13
+	tagPublicSubkey = 14
+)
+
+// Signature types (RFC 4880, section 5.2.1) used by the parser.
+const (
+	sigCertGeneric      = 0x10
+	sigCertPositive     = 0x13
+	sigSubkeyBinding    = 0x18
+	sigDirectKey        = 0x1F
+	sigKeyRevocation    = 0x20
+	sigSubkeyRevocation = 0x28
+)
+
+// Signature subpacket types (RFC 4880, section 5.2.3.1; the issuer
+// fingerprint is from RFC 9580) used by the parser.
+const (
+	subCreationTime      = 2
+	subKeyExpiration     = 9
+	subIssuer            = 16
+	subKeyFlags          = 27
+	subIssuerFingerprint = 33
+)
+
+// flagsEncrypt are the key flags that allow encryption of communications
+// or storage.
+const flagsEncrypt = 0x04 | 0x08
+
+// algoECDH is the ECDH public key algorithm (RFC 6637).
+const algoECDH = 18
+
+// oidCurve25519 is the OID of Curve25519 as used by OpenPGP ECDH keys
+// (1.3.6.1.4.1.3029.1.5.1).
+var oidCurve25519 = []byte{0x2B, 0x06, 0x01, 0x04, 0x01, 0x97, 0x55, 0x01, 0x05, 0x01}
+
+// errMalformed reports a certificate that cannot be parsed.
+var errMalformed = errors.New("malformed OpenPGP certificate")
+
+// certificate is what the provider needs from a transferable public key.
+type certificate struct {
+	// fingerprint is the v4 fingerprint of the primary key, in upper-case
+	// hex.
+	fingerprint string
+
+	// userIDs are the User ID packets of the certificate.
+	userIDs []string
+
+	// x25519 is the newest usable Curve25519 ECDH encryption key of the
+	// certificate, primary or subkey, or nil if it has none.
+	x25519 []byte
+}
+
+// certKey is a key of a certificate with what its signatures say about it.
+type certKey struct {
+	x25519  []byte // nil if the key is not a Curve25519 ECDH key
+	created time.Time
+	primary bool
+
+	// bound is set once a subkey binding signature is seen. The fields
+	// below come from the newest binding or self-signature.
+	bound    bool
+	signed   time.Time
+	expires  uint32 // seconds after created; 0 never expires
+	flags    byte
+	hasFlags bool
+
+	revoked bool
+}
+
+// usable reports whether the key may be used for encryption at now: it
+// is not revoked or expired, a subkey is bound to the primary key, and its
+// key flags, if any, allow encryption.
+func (k *certKey) usable(now time.Time) bool {
+	switch {
+	case k.revoked, k.expired(now), !k.primary && !k.bound:
+		return false
+	case k.hasFlags && k.flags&flagsEncrypt == 0:
+		return false
+	}
+	return true
+}
+
+// expired reports whether the key has expired at now.
+func (k *certKey) expired(now time.Time) bool {
+	return k.expires != 0 && !now.Before(k.created.Add(time.Duration(k.expires)*time.Second))
+}
+
+// apply records what a signature says about the key. Subkeys take their
+// binding and revocation signatures; the primary key takes its own
+// self-signatures, both direct and on User IDs, and its revocation.
+func (k *certKey) apply(sig *signature, fingerprint string) {
+	if k.primary && !sig.issuedBy(fingerprint) {
+		return
+	}
+	switch {
+	case k.primary && sig.sigType == sigKeyRevocation,
+		!k.primary && sig.sigType == sigSubkeyRevocation:
+		k.revoked = true
+	case k.primary && (sig.sigType == sigDirectKey || sig.sigType >= sigCertGeneric && sig.sigType <= sigCertPositive),
+		!k.primary && sig.sigType == sigSubkeyBinding:
+		if k.bound && sig.created.Before(k.signed) {
+			return
+		}
+		k.bound, k.signed = true, sig.created
+		k.expires = sig.keyExpires
+		k.flags, k.hasFlags = sig.keyFlags, sig.hasKeyFlags
+	}
+}
+
+// hasAddress reports whether a User ID of the certificate is for address,
+// either as "Name <address>" or as the bare address, ignoring case.
+func (c *certificate) hasAddress(address string) bool {
+	address = strings.ToLower(address)
+	for _, uid := range c.userIDs {
+		uid = strings.ToLower(uid)
+		if uid == address || strings.Contains(uid, "<"+address+">") {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCertificate parses a binary transferable public key, the format WKD
+// serves, and picks its encryption key as of now. Only the packets the
+// provider uses are interpreted; other packets are skipped.
+//
+// Signatures are read but not verified (see the package documentation).
+// They decide which key is used: a revoked or expired certificate has
+// none, a subkey needs a binding signature and must be neither revoked
+// nor expired, and its key flags must allow encryption. Of the usable
+// keys the most recently created wins, so a rotated subkey replaces the
+// one it succeeds.
+func parseCertificate(data []byte, now time.Time) (*certificate, error) {
+	cert := &certificate{}
+	var keys []*certKey
+	for len(data) > 0 {
+		tag, body, rest, err := nextPacket(data)
+		if err != nil {
+			return nil, err
+		}
+		if len(keys) == 0 && tag != tagPublicKey {
+			return nil, errMalformed
+		}
+		if tag == tagPublicKey && len(keys) > 0 {
+			// The next certificate of a keyring; use only the first.
+			break
+		}
+		data = rest
+
+		switch tag {
+		case tagPublicKey, tagPublicSubkey:
+			if tag == tagPublicKey {
+				cert.fingerprint = fingerprintV4(body)
+			}
+			keys = append(keys, &certKey{x25519: x25519Key(body), created: keyCreated(body), primary: tag == tagPublicKey})
+		case tagUserID:
+			cert.userIDs = append(cert.userIDs, string(body))
+		case tagSignature:
+			// Signatures after a User ID certify it for the primary key.
+			key := keys[len(keys)-1]
+			if sig := parseSignature(body); sig != nil {
+				key.apply(sig, cert.fingerprint)
+			}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errMalformed
+	}
+
+	if primary := keys[0]; primary.revoked || primary.expired(now) {
+		return cert, nil
+	}
+	var best *certKey
+	for _, k := range keys {
+		if k.x25519 == nil || !k.usable(now) {
+			continue
+		}
+		if best == nil || !k.created.Before(best.created) {
+			best = k
+		}
+	}
+	if best != nil {
+		cert.x25519 = best.x25519
+	}
+	return cert, nil
+}
+
+// nextPacket splits the first packet off data, handling both the old and
+// the new packet header formats. Partial body lengths are only used for
+// data packets and are rejected.
+func nextPacket(data []byte) (tag int, body, rest []byte, err error) {
+	if len(data) < 2 || data[0]&0x80 == 0 {
+		return 0, nil, nil, errMalformed
+	}
+	var length, header int
+	if data[0]&0x40 != 0 {
+		tag = int(data[0] & 0x3f)
+		switch l := data[1]; {
+		case l < 192:
+			length, header = int(l), 2
+		case l < 224:
+			if len(data) < 3 {
+				return 0, nil, nil, errMalformed
+			}
+			length, header = (int(l)-192)<<8+int(data[2])+192, 3
+		case l == 255:
+			if len(data) < 6 {
+				return 0, nil, nil, errMalformed
+			}
+			length, header = int(binary.BigEndian.Uint32(data[2:6])), 6
+		default:
+			return 0, nil, nil, errMalformed
+		}
+	} else {
+		tag = int(data[0]>>2) & 0x0f
+		switch data[0] & 0x03 {
+		case 0:
+			length, header = int(data[1]), 2
+		case 1:
+			if len(data) < 3 {
+				return 0, nil, nil, errMalformed
+			}
+			length, header = int(binary.BigEndian.Uint16(data[1:3])), 3
+		case 2:
+			if len(data) < 5 {
+				return 0, nil, nil, errMalformed
+			}
+			length, header = int(binary.BigEndian.Uint32(data[1:5])), 5
+		default:
+			length, header = len(data)-1, 1
+		}
+	}
+	if length < 0 || length > len(data)-header {
+		return 0, nil, nil, errMalformed
+	}
+	return tag, data[header : header+length], data[header+length:], nil
+}
+
+// fingerprintV4 returns the v4 fingerprint of a public key packet body
+// (RFC 4880, section 12.2).
+func fingerprintV4(body []byte) string {
+	h := sha1.New()
+	h.Write([]byte{0x99, byte(len(body) >> 8), byte(len(body))})
+	h.Write(body)
+	return strings.ToUpper(hex.EncodeToString(h.Sum(nil)))
+}
+
+// x25519Key returns the X25519 public key of a v4 Curve25519 ECDH public
+// key packet body, or nil if the packet holds another kind of key.
+func x25519Key(body []byte) []byte {
+	// version(1) created(4) algorithm(1) oid-length(1) oid
+	if len(body) < 7 || body[0] != 4 || body[5] != algoECDH {
+		return nil
+	}
+	oidLen := int(body[6])
+	if len(body) < 7+oidLen || !bytes.Equal(body[7:7+oidLen], oidCurve25519) {
+		return nil
+	}
+	// The point is an MPI holding 0x40 followed by the 32-byte key.
+	point := body[7+oidLen:]
+	if len(point) < 2+33 || binary.BigEndian.Uint16(point) != 263 || point[2] != 0x40 {
+		return nil
+	}
+	key := make([]byte, 32)
+	copy(key, point[3:35])
+	return key
+}
+
+// keyCreated returns the creation time of a v4 public key packet body.
+func keyCreated(body []byte) time.Time {
+	if len(body) < 5 {
+		return time.Time{}
+	}
+	return time.Unix(int64(binary.BigEndian.Uint32(body[1:5])), 0)
+}
+
+// signature is what the parser needs from a v4 signature packet.
+type signature struct {
+	sigType byte
+	created time.Time
+
+	// keyExpires, keyFlags and hasKeyFlags come from the hashed
+	// subpackets, which the signature covers.
+	keyExpires  uint32
+	keyFlags    byte
+	hasKeyFlags bool
+
+	// issuer is the issuer key ID or fingerprint, from either subpacket
+	// area; nil if the signature names none.
+	issuer []byte
+}
+
+// issuedBy reports whether the signature was made by the key with the
+// given fingerprint. A signature that names no issuer is assumed to be.
+func (s *signature) issuedBy(fingerprint string) bool {
+	return s.issuer == nil || strings.HasSuffix(fingerprint, strings.ToUpper(hex.EncodeToString(s.issuer)))
+}
+
+// parseSignature parses a v4 signature packet body (RFC 4880, section
+// 5.2.3). It returns nil for other versions and malformed packets, which
+// the caller ignores.
+func parseSignature(body []byte) *signature {
+	// version(1) type(1) public-key-algorithm(1) hash-algorithm(1)
+	if len(body) < 6 || body[0] != 4 {
+		return nil
+	}
+	sig := &signature{sigType: body[1]}
+	hashedLen := int(binary.BigEndian.Uint16(body[4:6]))
+	if len(body) < 6+hashedLen+2 {
+		return nil
+	}
+	hashed := body[6 : 6+hashedLen]
+	unhashedLen := int(binary.BigEndian.Uint16(body[6+hashedLen:]))
+	if len(body) < 8+hashedLen+unhashedLen {
+		return nil
+	}
+	unhashed := body[8+hashedLen : 8+hashedLen+unhashedLen]
+
+	ok := eachSubpacket(hashed, func(typ byte, data []byte) {
+		switch {
+		case typ == subCreationTime && len(data) == 4:
+			sig.created = time.Unix(int64(binary.BigEndian.Uint32(data)), 0)
+		case typ == subKeyExpiration && len(data) == 4:
+			sig.keyExpires = binary.BigEndian.Uint32(data)
+		case typ == subKeyFlags && len(data) >= 1:
+			sig.keyFlags, sig.hasKeyFlags = data[0], true
+		case typ == subIssuer && len(data) == 8:
+			sig.issuer = data
+		case typ == subIssuerFingerprint && len(data) == 21 && data[0] == 4:
+			sig.issuer = data[1:]
+		}
+	})
+	if !ok {
+		return nil
+	}
+	if sig.issuer == nil {
+		ok = eachSubpacket(unhashed, func(typ byte, data []byte) {
+			switch {
+			case typ == subIssuer && len(data) == 8:
+				sig.issuer = data
+			case typ == subIssuerFingerprint && len(data) == 21 && data[0] == 4:
+				sig.issuer = data[1:]
+			}
+		})
+		if !ok {
+			return nil
+		}
+	}
+	return sig
+}
+
+// eachSubpacket calls fn with the type, without the critical bit, and the
+// data of each signature subpacket in area. It reports false if area is
+// malformed.
+func eachSubpacket(area []byte, fn func(typ byte, data []byte)) bool {
+	for len(area) > 0 {
+		var length, header int
+		switch l := area[0]; {
+		case l < 192:
+			length, header = int(l), 1
+		case l < 255:
+			if len(area) < 2 {
+				return false
+			}
+			length, header = (int(l)-192)<<8+int(area[1])+192, 2
+		default:
+			if len(area) < 5 {
+				return false
+			}
+			length, header = int(binary.BigEndian.Uint32(area[1:5])), 5
+		}
+		if length < 1 || length > len(area)-header {
+			return false
+		}
+		sub := area[header : header+length]
+		fn(sub[0]&0x7f, sub[1:])
+		area = area[header+length:]
+	}
+	return true
+}
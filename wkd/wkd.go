@@ -0,0 +1,201 @@
+// Package wkd discovers recipient encryption keys through the OpenPGP Web
+// Key Directory (draft-koch-openpgp-webkey-service), so encryption at rest
+// can reach users whose keys are not provisioned locally.
+//
+// The KeyProvider fetches a user's OpenPGP certificate over HTTPS and uses
+// its Curve25519 ECDH key, which is an X25519 key usable with the NaCl box
+// encryption of msgstore.EncryptingDeliveryAgent:
+//
+//	keys := msgstore.NewCachingKeyProvider(
+//	    wkd.NewKeyProvider("example.com", wkd.WithFingerprintVerifier(pinned)),
+//	    time.Hour, 10*time.Minute)
+//	agent := msgstore.NewEncryptingDeliveryAgent(store, keys)
+//
+// Lookups go to the network, so the provider should be wrapped in a
+// msgstore.CachingKeyProvider as above.
+//
+// Of the certificate's Curve25519 ECDH keys, the newest bound subkey that
+// may encrypt and is neither revoked nor expired is used, so a rotated
+// subkey replaces its predecessor.
+//
+// Self-signatures in the certificate are read but not verified. A
+// certificate is accepted if it was served over HTTPS for the domain,
+// carries a User ID with the requested address and, if a verifier is
+// configured, has an approved fingerprint.
+package wkd
+
+import (
+	"context"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/infodancer/auth"
+	autherrors "github.com/infodancer/auth/errors"
+	"github.com/infodancer/msgstore"
+)
+
+const (
+	// maxCertificateSize bounds the certificate downloaded for one user.
+	maxCertificateSize = 1 << 20
+
+	// DefaultTimeout bounds a lookup made with the default HTTP client,
+	// so an unresponsive server cannot hold up delivery.
+	DefaultTimeout = 10 * time.Second
+)
+
+// KeyProvider looks up keys in the Web Key Directory of one domain. It
+// implements auth.KeyProvider, whose usernames are local parts.
+type KeyProvider struct {
+	domain   string
+	client   *http.Client
+	verifier func(address, fingerprint string) bool
+}
+
+// Option configures optional KeyProvider behavior.
+type Option func(*KeyProvider)
+
+// WithHTTPClient sets the client used for lookups. Defaults to a client
+// with a DefaultTimeout timeout.
+func WithHTTPClient(client *http.Client) Option {
+	return func(p *KeyProvider) {
+		if client != nil {
+			p.client = client
+		}
+	}
+}
+
+// WithFingerprintVerifier sets a check applied to every certificate found:
+// verify receives the address looked up and the certificate's OpenPGP v4
+// fingerprint (40 upper-case hex digits), and the key is used only if it
+// returns true.
+func WithFingerprintVerifier(verify func(address, fingerprint string) bool) Option {
+	return func(p *KeyProvider) {
+		p.verifier = verify
+	}
+}
+
+// NewKeyProvider creates a provider for the users of domain.
+func NewKeyProvider(domain string, opts ...Option) *KeyProvider {
+	p := &KeyProvider{domain: strings.ToLower(domain), client: &http.Client{Timeout: DefaultTimeout}}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// GetPublicKey implements auth.KeyProvider. Users without a published
+// certificate, or whose certificate has no usable key, yield
+// autherrors.ErrKeyNotFound.
+func (p *KeyProvider) GetPublicKey(ctx context.Context, username string) ([]byte, error) {
+	address := username + "@" + p.domain
+	data, err := p.fetch(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+	cert, err := parseCertificate(data, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("wkd: certificate of %s: %w", address, err)
+	}
+	if !cert.hasAddress(address) {
+		return nil, fmt.Errorf("wkd: certificate of %s has no matching user ID: %w", address, autherrors.ErrKeyNotFound)
+	}
+	if p.verifier != nil && !p.verifier(address, cert.fingerprint) {
+		return nil, fmt.Errorf("wkd: certificate %s of %s rejected: %w", cert.fingerprint, address, autherrors.ErrKeyNotFound)
+	}
+	if cert.x25519 == nil {
+		return nil, fmt.Errorf("wkd: certificate of %s has no Curve25519 encryption key: %w", address, autherrors.ErrKeyNotFound)
+	}
+	return cert.x25519, nil
+}
+
+// HasEncryption implements auth.KeyProvider: a user has encryption if a
+// usable key is published for them.
+func (p *KeyProvider) HasEncryption(ctx context.Context, username string) (bool, error) {
+	key, err := p.ResolveKey(ctx, username)
+	return key != nil, err
+}
+
+// ResolveKey implements msgstore.KeyResolver, so wrappers answer both
+// HasEncryption and GetPublicKey with one lookup.
+func (p *KeyProvider) ResolveKey(ctx context.Context, username string) ([]byte, error) {
+	key, err := p.GetPublicKey(ctx, username)
+	if errors.Is(err, autherrors.ErrKeyNotFound) {
+		return nil, nil
+	}
+	return key, err
+}
+
+// fetch downloads the certificate of a local part with the advanced method
+// (openpgpkey subdomain). Only if that host does not exist is the direct
+// method used: a domain that runs the subdomain serves its directory there
+// alone. If the certificate does not exist, the error wraps
+// autherrors.ErrKeyNotFound.
+func (p *KeyProvider) fetch(ctx context.Context, localpart string) ([]byte, error) {
+	hash := hashLocalpart(localpart)
+	query := "?l=" + url.QueryEscape(localpart)
+	data, err := p.get(ctx, "https://openpgpkey."+p.domain+"/.well-known/openpgpkey/"+p.domain+"/hu/"+hash+query)
+	var dnsErr *net.DNSError
+	if !errors.As(err, &dnsErr) || !dnsErr.IsNotFound {
+		return data, err
+	}
+	return p.get(ctx, "https://"+p.domain+"/.well-known/openpgpkey/hu/"+hash+query)
+}
+
+// get fetches one URL. A 404 yields autherrors.ErrKeyNotFound.
+func (p *KeyProvider) get(ctx context.Context, u string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("wkd: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return nil, fmt.Errorf("wkd: %s: %w", u, autherrors.ErrKeyNotFound)
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("wkd: %s: %s", u, resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, maxCertificateSize))
+}
+
+// hashLocalpart returns the WKD hash of a local part: the z-base-32
+// encoding of the SHA-1 of its lower-case form.
+func hashLocalpart(localpart string) string {
+	sum := sha1.Sum([]byte(strings.ToLower(localpart)))
+	return zbase32(sum[:])
+}
+
+// zbase32 encodes data in z-base-32 (RFC 6189, section 5.1.6).
+func zbase32(data []byte) string {
+	const alphabet = "ybndrfg8ejkmcpqxot1uwisza345h769"
+	var sb strings.Builder
+	var buffer, bits uint
+	for _, b := range data {
+		buffer = buffer<<8 | uint(b)
+		bits += 8
+		for bits >= 5 {
+			bits -= 5
+			sb.WriteByte(alphabet[(buffer>>bits)&31])
+		}
+	}
+	if bits > 0 {
+		sb.WriteByte(alphabet[(buffer<<(5-bits))&31])
+	}
+	return sb.String()
+}
+
+// Compile-time interface verification.
+var (
+	_ auth.KeyProvider     = (*KeyProvider)(nil)
+	_ msgstore.KeyResolver = (*KeyProvider)(nil)
+)
@@ -0,0 +1,324 @@
+package wkd
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	autherrors "github.com/infodancer/auth/errors"
+)
+
+// packet returns a new-format OpenPGP packet.
+func packet(tag byte, body []byte) []byte {
+	if len(body) >= 192 {
+		panic("test packet too long")
+	}
+	return append([]byte{0xC0 | tag, byte(len(body))}, body...)
+}
+
+// ecdhKeyBody returns a v4 Curve25519 ECDH public key packet body.
+func ecdhKeyBody(key []byte) []byte {
+	return ecdhKeyBodyAt(key, 0x60000000)
+}
+
+// ecdhKeyBodyAt returns a v4 Curve25519 ECDH public key packet body for a
+// key created at the given Unix time.
+func ecdhKeyBodyAt(key []byte, created uint32) []byte {
+	body := []byte{4, 0, 0, 0, 0, algoECDH, byte(len(oidCurve25519))}
+	binary.BigEndian.PutUint32(body[1:5], created)
+	body = append(body, oidCurve25519...)
+	body = append(body, 0x01, 0x07, 0x40)
+	body = append(body, key...)
+	return append(body, 0x03, 0x01, 0x08, 0x07) // KDF parameters
+}
+
+// subpacket returns a signature subpacket.
+func subpacket(typ byte, data ...byte) []byte {
+	return append([]byte{byte(len(data) + 1), typ}, data...)
+}
+
+// uint32Bytes returns v in big-endian order.
+func uint32Bytes(v uint32) []byte {
+	return binary.BigEndian.AppendUint32(nil, v)
+}
+
+// signaturePacket returns a v4 signature packet of sigType with the given
+// hashed subpackets and no signature value, which the parser does not
+// verify.
+func signaturePacket(sigType byte, hashed ...[]byte) []byte {
+	area := bytes.Join(hashed, nil)
+	body := []byte{4, sigType, 22, 8, byte(len(area) >> 8), byte(len(area))}
+	body = append(body, area...)
+	return packet(tagSignature, append(body, 0, 0))
+}
+
+// binding returns a subkey binding signature made at created, allowing
+// encryption.
+func binding(created uint32, more ...[]byte) []byte {
+	hashed := append([][]byte{subpacket(subCreationTime, uint32Bytes(created)...), subpacket(subKeyFlags, flagsEncrypt)}, more...)
+	return signaturePacket(sigSubkeyBinding, hashed...)
+}
+
+// testPrimary returns an EdDSA primary key packet and a User ID for uid.
+func testPrimary(uid string) []byte {
+	primary := []byte{4, 0x60, 0, 0, 0, 22, 9, 0x2B, 0x06, 0x01, 0x04, 0x01, 0xDA, 0x47, 0x0F, 0x01, 0x01, 0x07, 0x40}
+	primary = append(primary, bytes.Repeat([]byte{0xEE}, 32)...)
+	var cert []byte
+	cert = append(cert, packet(tagPublicKey, primary)...)
+	cert = append(cert, packet(tagUserID, []byte(uid))...)
+	cert = append(cert, packet(tagSignature, []byte{4, 0x13})...) // truncated, ignored
+	return cert
+}
+
+// testCertificate returns a certificate with an EdDSA primary key, a
+// User ID and a bound ECDH subkey holding key.
+func testCertificate(uid string, key []byte) []byte {
+	cert := testPrimary(uid)
+	cert = append(cert, packet(tagPublicSubkey, ecdhKeyBody(key))...)
+	return append(cert, binding(0x60000000)...)
+}
+
+// rewriteTransport sends every request to the test server, keeping the
+// original URL for the handler to inspect. Requests to hosts in unresolved
+// fail as if the host did not exist.
+type rewriteTransport struct {
+	target     *url.URL
+	next       http.RoundTripper
+	unresolved map[string]bool
+
+	mu   sync.Mutex
+	urls []string
+}
+
+func (t *rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	t.urls = append(t.urls, req.URL.String())
+	t.mu.Unlock()
+	if t.unresolved[req.URL.Hostname()] {
+		return nil, &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: req.URL.Hostname(), IsNotFound: true}}
+	}
+	req = req.Clone(req.Context())
+	req.Header.Set("X-Original-Host", req.URL.Host)
+	req.URL.Scheme, req.URL.Host = t.target.Scheme, t.target.Host
+	return t.next.RoundTrip(req)
+}
+
+// newTestProvider serves certs, keyed by original host and path, and
+// returns a provider for example.com that talks to it. The openpgpkey
+// subdomain does not exist unless certs has an entry for it.
+func newTestProvider(t *testing.T, certs map[string][]byte, opts ...Option) (*KeyProvider, *rewriteTransport) {
+	t.Helper()
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := certs[r.Header.Get("X-Original-Host")+r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(srv.Close)
+	target, _ := url.Parse(srv.URL)
+	transport := &rewriteTransport{target: target, next: srv.Client().Transport, unresolved: map[string]bool{"openpgpkey.example.com": true}}
+	for path := range certs {
+		if strings.HasPrefix(path, "openpgpkey.example.com/") {
+			transport.unresolved = nil
+		}
+	}
+	opts = append([]Option{WithHTTPClient(&http.Client{Transport: transport})}, opts...)
+	return NewKeyProvider("example.com", opts...), transport
+}
+
+func TestHashLocalpart(t *testing.T) {
+	// Test vector from draft-koch-openpgp-webkey-service.
+	if got := hashLocalpart("Joe.Doe"); got != "iy9q119eutrkn8s1mk4r39qejnbu3n5q" {
+		t.Errorf("hashLocalpart = %q", got)
+	}
+}
+
+func TestNewKeyProvider_DefaultTimeout(t *testing.T) {
+	if p := NewKeyProvider("example.com"); p.client.Timeout != DefaultTimeout {
+		t.Errorf("default client timeout = %v, want %v", p.client.Timeout, DefaultTimeout)
+	}
+}
+
+func TestKeyProvider_Direct(t *testing.T) {
+	key := bytes.Repeat([]byte{0x42}, 32)
+	path := "example.com/.well-known/openpgpkey/hu/" + hashLocalpart("joe.doe")
+	p, transport := newTestProvider(t, map[string][]byte{
+		path: testCertificate("Joe Doe <Joe.Doe@example.com>", key),
+	})
+
+	got, err := p.GetPublicKey(context.Background(), "Joe.Doe")
+	if err != nil {
+		t.Fatalf("GetPublicKey: %v", err)
+	}
+	if !bytes.Equal(got, key) {
+		t.Errorf("key = %x, want %x", got, key)
+	}
+	if len(transport.urls) != 2 || !strings.HasPrefix(transport.urls[0], "https://openpgpkey.example.com/.well-known/openpgpkey/example.com/hu/") {
+		t.Errorf("requests = %v, want advanced then direct, as the subdomain does not exist", transport.urls)
+	}
+	if !strings.HasSuffix(transport.urls[1], "?l=Joe.Doe") {
+		t.Errorf("direct request %q lacks the l parameter", transport.urls[1])
+	}
+	if ok, err := p.HasEncryption(context.Background(), "Joe.Doe"); !ok || err != nil {
+		t.Errorf("HasEncryption = %v, %v", ok, err)
+	}
+}
+
+func TestKeyProvider_Advanced(t *testing.T) {
+	key := bytes.Repeat([]byte{0x07}, 32)
+	path := "openpgpkey.example.com/.well-known/openpgpkey/example.com/hu/" + hashLocalpart("user")
+	p, transport := newTestProvider(t, map[string][]byte{
+		path: testCertificate("user@example.com", key),
+	})
+	got, err := p.GetPublicKey(context.Background(), "user")
+	if err != nil || !bytes.Equal(got, key) {
+		t.Fatalf("GetPublicKey = %x, %v", got, err)
+	}
+	if len(transport.urls) != 1 {
+		t.Errorf("requests = %v, want only the advanced lookup", transport.urls)
+	}
+}
+
+func TestKeyProvider_AdvancedOnly(t *testing.T) {
+	// The subdomain exists, so the direct method is not consulted even
+	// though it has a certificate.
+	key := bytes.Repeat([]byte{0x09}, 32)
+	p, transport := newTestProvider(t, map[string][]byte{
+		"openpgpkey.example.com/.well-known/openpgpkey/example.com/hu/" + hashLocalpart("other"): testCertificate("other@example.com", key),
+		"example.com/.well-known/openpgpkey/hu/" + hashLocalpart("user"):                         testCertificate("user@example.com", key),
+	})
+	if _, err := p.GetPublicKey(context.Background(), "user"); !errors.Is(err, autherrors.ErrKeyNotFound) {
+		t.Errorf("GetPublicKey error = %v, want ErrKeyNotFound", err)
+	}
+	if len(transport.urls) != 1 {
+		t.Errorf("requests = %v, want only the advanced lookup", transport.urls)
+	}
+}
+
+func TestKeyProvider_NotFound(t *testing.T) {
+	p, _ := newTestProvider(t, nil)
+	if _, err := p.GetPublicKey(context.Background(), "nobody"); !errors.Is(err, autherrors.ErrKeyNotFound) {
+		t.Errorf("GetPublicKey error = %v, want ErrKeyNotFound", err)
+	}
+	if ok, err := p.HasEncryption(context.Background(), "nobody"); ok || err != nil {
+		t.Errorf("HasEncryption = %v, %v; want false, nil", ok, err)
+	}
+}
+
+func TestKeyProvider_Checks(t *testing.T) {
+	key := bytes.Repeat([]byte{0x01}, 32)
+	path := "example.com/.well-known/openpgpkey/hu/" + hashLocalpart("user")
+
+	// A certificate for another address is not used.
+	p, _ := newTestProvider(t, map[string][]byte{path: testCertificate("Mallory <mallory@example.net>", key)})
+	if _, err := p.GetPublicKey(context.Background(), "user"); !errors.Is(err, autherrors.ErrKeyNotFound) {
+		t.Errorf("mismatched user ID: error = %v, want ErrKeyNotFound", err)
+	}
+
+	// The verifier sees the address and fingerprint and can reject the key.
+	cert := testCertificate("user@example.com", key)
+	_, primary, _, err := nextPacket(cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var seen []string
+	verify := func(address, fingerprint string) bool {
+		seen = append(seen, address, fingerprint)
+		return false
+	}
+	p, _ = newTestProvider(t, map[string][]byte{path: cert}, WithFingerprintVerifier(verify))
+	if _, err := p.GetPublicKey(context.Background(), "user"); !errors.Is(err, autherrors.ErrKeyNotFound) {
+		t.Errorf("rejected fingerprint: error = %v, want ErrKeyNotFound", err)
+	}
+	if len(seen) != 2 || seen[0] != "user@example.com" || seen[1] != fingerprintV4(primary) || len(seen[1]) != 40 {
+		t.Errorf("verifier saw %v", seen)
+	}
+}
+
+func TestParseCertificate_Malformed(t *testing.T) {
+	good := testCertificate("user@example.com", make([]byte, 32))
+	for name, data := range map[string][]byte{
+		"empty":        nil,
+		"not a packet": []byte("-----BEGIN PGP PUBLIC KEY BLOCK-----"),
+		"truncated":    good[:len(good)-5],
+		"no primary":   packet(tagUserID, []byte("user@example.com")),
+	} {
+		if _, err := parseCertificate(data, time.Now()); err == nil {
+			t.Errorf("%s: parseCertificate succeeded", name)
+		}
+	}
+
+	// Old-format headers parse the same.
+	old := []byte{0x80 | tagPublicKey<<2, 0}
+	body := ecdhKeyBody(bytes.Repeat([]byte{0x09}, 32))
+	old[1] = byte(len(body))
+	old = append(old, body...)
+	cert, err := parseCertificate(old, time.Now())
+	if err != nil || !bytes.Equal(cert.x25519, bytes.Repeat([]byte{0x09}, 32)) {
+		t.Errorf("old format = %+v, %v", cert, err)
+	}
+}
+
+func TestParseCertificate_SubkeySelection(t *testing.T) {
+	const created = 0x60000000
+	now := time.Unix(created+1000, 0)
+	oldKey := bytes.Repeat([]byte{0x01}, 32)
+	newKey := bytes.Repeat([]byte{0x02}, 32)
+	subkey := func(key []byte, at uint32, sigs ...[]byte) []byte {
+		p := packet(tagPublicSubkey, ecdhKeyBodyAt(key, at))
+		return append(p, bytes.Join(sigs, nil)...)
+	}
+	revocation := signaturePacket(sigSubkeyRevocation, subpacket(subCreationTime, uint32Bytes(created+500)...))
+
+	for _, tc := range []struct {
+		name    string
+		subkeys [][]byte
+		want    []byte
+	}{
+		{"rotated", [][]byte{subkey(oldKey, created, binding(created)), subkey(newKey, created+100, binding(created+100))}, newKey},
+		{"rotated, listed first", [][]byte{subkey(newKey, created+100, binding(created+100)), subkey(oldKey, created, binding(created))}, newKey},
+		{"newest revoked", [][]byte{subkey(oldKey, created, binding(created)), subkey(newKey, created+100, binding(created+100), revocation)}, oldKey},
+		{"newest expired", [][]byte{subkey(oldKey, created, binding(created)), subkey(newKey, created+100, binding(created+100, subpacket(subKeyExpiration, uint32Bytes(500)...)))}, oldKey},
+		{"newest signing only", [][]byte{subkey(oldKey, created, binding(created)), subkey(newKey, created+100, signaturePacket(sigSubkeyBinding, subpacket(subKeyFlags, 0x02)))}, oldKey},
+		{"newest unbound", [][]byte{subkey(oldKey, created, binding(created)), subkey(newKey, created+100)}, oldKey},
+		{"expiry extended by newer binding", [][]byte{subkey(newKey, created, binding(created, subpacket(subKeyExpiration, uint32Bytes(500)...)), binding(created+400))}, newKey},
+		{"all revoked", [][]byte{subkey(oldKey, created, binding(created), revocation)}, nil},
+	} {
+		data := append(testPrimary("user@example.com"), bytes.Join(tc.subkeys, nil)...)
+		cert, err := parseCertificate(data, now)
+		if err != nil {
+			t.Fatalf("%s: parseCertificate: %v", tc.name, err)
+		}
+		if !bytes.Equal(cert.x25519, tc.want) {
+			t.Errorf("%s: key = %x, want %x", tc.name, cert.x25519, tc.want)
+		}
+	}
+
+	// A revoked or expired certificate has no usable key at all.
+	revoked := append(testPrimary("user@example.com"), signaturePacket(sigKeyRevocation)...)
+	expired := append(testPrimary("user@example.com"), signaturePacket(sigDirectKey, subpacket(subKeyExpiration, uint32Bytes(60)...))...)
+	for name, primary := range map[string][]byte{"revoked": revoked, "expired": expired} {
+		data := append(primary, subkey(newKey, created, binding(created))...)
+		if cert, err := parseCertificate(data, now); err != nil || cert.x25519 != nil {
+			t.Errorf("%s certificate: key = %x, %v; want none", name, cert.x25519, err)
+		}
+	}
+
+	// Self-signatures of another key do not change the primary key.
+	other := signaturePacket(sigDirectKey, subpacket(subIssuer, bytes.Repeat([]byte{0xAB}, 8)...), subpacket(subKeyExpiration, uint32Bytes(60)...))
+	data := append(append(testPrimary("user@example.com"), other...), subkey(newKey, created, binding(created))...)
+	if cert, err := parseCertificate(data, now); err != nil || !bytes.Equal(cert.x25519, newKey) {
+		t.Errorf("third-party signature: key = %x, %v; want %x", cert.x25519, err, newKey)
+	}
+}